@@ -1,9 +1,16 @@
 package cache
 
 import (
+	"archive/tar"
 	"context"
+	"io"
+	"time"
 
+	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/diff"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/images/converter"
+	"github.com/containerd/containerd/images/converter/uncompress"
 	"github.com/containerd/containerd/leases"
 	"github.com/containerd/containerd/mount"
 	"github.com/moby/buildkit/session"
@@ -26,8 +33,8 @@ var ErrNoBlobs = errors.Errorf("no blobs for snapshot")
 // computeBlobChain ensures every ref in a parent chain has an associated blob in the content store. If
 // a blob is missing and createIfNeeded is true, then the blob will be created, otherwise ErrNoBlobs will
 // be returned. Caller must hold a lease when calling this function.
-// If forceCompression is specified but the blob of compressionType doesn't exist, this function creates it.
-func (sr *immutableRef) computeBlobChain(ctx context.Context, createIfNeeded bool, compressionType compression.Type, forceCompression bool, s session.Group) error {
+// If comp.Force is specified but the blob of comp.Type doesn't exist, this function creates it.
+func (sr *immutableRef) computeBlobChain(ctx context.Context, createIfNeeded bool, comp compression.Config, s session.Group) error {
 	if _, ok := leases.FromContext(ctx); !ok {
 		return errors.Errorf("missing lease requirement for computeBlobChain")
 	}
@@ -40,28 +47,31 @@ func (sr *immutableRef) computeBlobChain(ctx context.Context, createIfNeeded boo
 		ctx = winlayers.UseWindowsLayerMode(ctx)
 	}
 
-	return computeBlobChain(ctx, sr, createIfNeeded, compressionType, forceCompression, s)
+	return computeBlobChain(ctx, sr, createIfNeeded, comp, s)
 }
 
-func computeBlobChain(ctx context.Context, sr *immutableRef, createIfNeeded bool, compressionType compression.Type, forceCompression bool, s session.Group) error {
+func computeBlobChain(ctx context.Context, sr *immutableRef, createIfNeeded bool, comp compression.Config, s session.Group) error {
 	baseCtx := ctx
 	eg, ctx := errgroup.WithContext(ctx)
 	var currentDescr ocispecs.Descriptor
 	if sr.parent != nil {
 		eg.Go(func() error {
-			return computeBlobChain(ctx, sr.parent, createIfNeeded, compressionType, forceCompression, s)
+			return computeBlobChain(ctx, sr.parent, createIfNeeded, comp, s)
 		})
 	}
 	eg.Go(func() error {
 		dp, err := g.Do(ctx, sr.ID(), func(ctx context.Context) (interface{}, error) {
 			refInfo := sr.Info()
 			if refInfo.Blob != "" {
-				if forceCompression {
+				if comp.Force {
 					desc, err := sr.ociDesc()
 					if err != nil {
 						return nil, err
 					}
-					if err := ensureCompression(ctx, sr, desc, compressionType, s); err != nil {
+					if info, err := sr.cm.ContentStore.Info(ctx, desc.Digest); err == nil {
+						desc = withLayerAnnotations(desc, info.Labels)
+					}
+					if err := ensureCompression(ctx, sr, desc, comp, s); err != nil {
 						return nil, err
 					}
 				}
@@ -69,19 +79,22 @@ func computeBlobChain(ctx context.Context, sr *immutableRef, createIfNeeded bool
 			} else if !createIfNeeded {
 				return nil, errors.WithStack(ErrNoBlobs)
 			}
+			if err := sr.cm.checkFreeSpace(ctx); err != nil {
+				return nil, err
+			}
 
-			var mediaType string
-			switch compressionType {
-			case compression.Uncompressed:
-				mediaType = ocispecs.MediaTypeImageLayer
-			case compression.Gzip:
-				mediaType = ocispecs.MediaTypeImageLayerGzip
-			default:
-				return nil, errors.Errorf("unknown layer compression type: %q", compressionType)
+			// nydus blobs are always created as a variant of a gzip blob
+			// because their digest isn't the diffID of the layer
+			blobComp := comp
+			if comp.Type == compression.Nydus {
+				blobComp = compression.New(compression.Gzip)
+			}
+			mediaType, err := diffMediaType(blobComp)
+			if err != nil {
+				return nil, err
 			}
 
 			var descr ocispecs.Descriptor
-			var err error
 
 			if descr.Digest == "" {
 				// reference needs to be committed
@@ -118,6 +131,17 @@ func computeBlobChain(ctx context.Context, sr *immutableRef, createIfNeeded bool
 				if err != nil {
 					return nil, err
 				}
+				if !differCompresses(blobComp) {
+					convert, _, err := getConverters(descr, blobComp)
+					if err != nil {
+						return nil, err
+					}
+					cdescr, err := sr.cm.convertLayer(ctx, convert, descr)
+					if err != nil {
+						return nil, err
+					}
+					descr = *cdescr
+				}
 			}
 
 			if descr.Annotations == nil {
@@ -131,14 +155,14 @@ func computeBlobChain(ctx context.Context, sr *immutableRef, createIfNeeded bool
 
 			if diffID, ok := info.Labels[containerdUncompressed]; ok {
 				descr.Annotations[containerdUncompressed] = diffID
-			} else if compressionType == compression.Uncompressed {
+			} else if blobComp.Type == compression.Uncompressed {
 				descr.Annotations[containerdUncompressed] = descr.Digest.String()
 			} else {
 				return nil, errors.Errorf("unknown layer compression type")
 			}
 
-			if forceCompression {
-				if err := ensureCompression(ctx, sr, descr, compressionType, s); err != nil {
+			if comp.Force {
+				if err := ensureCompression(ctx, sr, descr, comp, s); err != nil {
 					return nil, err
 				}
 			}
@@ -167,6 +191,111 @@ func computeBlobChain(ctx context.Context, sr *immutableRef, createIfNeeded bool
 	return nil
 }
 
+// diffMediaType returns the media type of the blobs the differ creates for
+// comp
+func diffMediaType(comp compression.Config) (string, error) {
+	switch comp.Type {
+	case compression.Uncompressed, compression.Gzip, compression.Zstd, compression.EStargz, compression.ZstdChunked, compression.Nydus:
+	default:
+		return "", errors.Errorf("unknown layer compression type: %q", comp.Type)
+	}
+	if comp.Type == compression.Gzip && differCompresses(comp) {
+		return ocispecs.MediaTypeImageLayerGzip, nil
+	}
+	// the uncompressed diff is converted afterwards
+	return ocispecs.MediaTypeImageLayer, nil
+}
+
+// differCompresses returns true if the blobs the differ creates already have
+// the compression of comp. The differ only creates gzip blobs of the default
+// level.
+func differCompresses(comp compression.Config) bool {
+	switch comp.Type {
+	case compression.Uncompressed:
+		return true
+	case compression.Gzip:
+		return comp.Level == nil
+	default:
+		return false
+	}
+}
+
+// SquashLayer returns a single layer blob with the complete filesystem of
+// ref. The blob is not associated with ref, so the layers of ref and its
+// parents stay in the cache. Caller must hold a lease when calling this
+// function.
+func SquashLayer(ctx context.Context, ref ImmutableRef, comp compression.Config, s session.Group) (*ocispecs.Descriptor, error) {
+	if _, ok := leases.FromContext(ctx); !ok {
+		return nil, errors.Errorf("missing lease requirement for SquashLayer")
+	}
+	sr, ok := ref.(*immutableRef)
+	if !ok {
+		return nil, errors.Errorf("invalid ref type %T", ref)
+	}
+	if isTypeWindows(sr) {
+		ctx = winlayers.UseWindowsLayerMode(ctx)
+		comp = windowsCompression(comp)
+	}
+	comp = sr.cm.withCompressionLevel(comp)
+	mediaType, err := diffMediaType(comp)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := sr.Mount(ctx, true, s)
+	if err != nil {
+		return nil, err
+	}
+	upper, release, err := m.Mount()
+	if err != nil {
+		return nil, err
+	}
+	if release != nil {
+		defer release()
+	}
+	descr, err := sr.cm.Differ.Compare(ctx, nil, upper,
+		diff.WithMediaType(mediaType),
+		diff.WithReference("squash-"+sr.ID()),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to squash layers")
+	}
+	if !differCompresses(comp) {
+		convert, _, err := getConverters(descr, comp)
+		if err != nil {
+			return nil, err
+		}
+		cdescr, err := sr.cm.convertLayer(ctx, convert, descr)
+		if err != nil {
+			return nil, err
+		}
+		descr = *cdescr
+	}
+
+	info, err := sr.cm.ContentStore.Info(ctx, descr.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if descr.Annotations == nil {
+		descr.Annotations = map[string]string{}
+	}
+	if diffID, ok := info.Labels[containerdUncompressed]; ok {
+		descr.Annotations[containerdUncompressed] = diffID
+	} else if comp.Type == compression.Uncompressed {
+		descr.Annotations[containerdUncompressed] = descr.Digest.String()
+	} else {
+		return nil, errors.Errorf("unknown layer compression type")
+	}
+	if createdAt := GetCreatedAt(sr.md); !createdAt.IsZero() {
+		dt, err := createdAt.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		descr.Annotations["buildkit/createdat"] = string(dt)
+	}
+	return &descr, nil
+}
+
 // setBlob associates a blob with the cache record.
 // A lease must be held for the blob when calling this function
 // Caller should call Info() for knowing what current values are actually set
@@ -241,10 +370,38 @@ func isTypeWindows(sr *immutableRef) bool {
 	return false
 }
 
+// windowsCompression returns the compression of the layers of Windows images.
+// Windows hosts only pull uncompressed and gzip layers.
+func windowsCompression(comp compression.Config) compression.Config {
+	if comp.Type != compression.Uncompressed {
+		comp.Type = compression.Gzip
+	}
+	return comp
+}
+
+// withCompressionLevel returns comp with the default level of the manager
+// if comp doesn't set one
+func (cm *cacheManager) withCompressionLevel(comp compression.Config) compression.Config {
+	if comp.Level != nil {
+		return comp
+	}
+	t := comp.Type
+	switch t {
+	case compression.EStargz:
+		t = compression.Gzip
+	case compression.ZstdChunked:
+		t = compression.Zstd
+	}
+	if level, ok := cm.CompressionLevels[t]; ok {
+		comp.Level = &level
+	}
+	return comp
+}
+
 // ensureCompression ensures the specified ref has the blob of the specified compression Type.
-func ensureCompression(ctx context.Context, ref *immutableRef, desc ocispecs.Descriptor, compressionType compression.Type, s session.Group) error {
+func ensureCompression(ctx context.Context, ref *immutableRef, desc ocispecs.Descriptor, comp compression.Config, s session.Group) error {
 	// Resolve converters
-	layerConvertFunc, _, err := getConverters(desc, compressionType)
+	layerConvertFunc, _, err := getConverters(desc, comp)
 	if err != nil {
 		return err
 	} else if layerConvertFunc == nil {
@@ -252,7 +409,7 @@ func ensureCompression(ctx context.Context, ref *immutableRef, desc ocispecs.Des
 	}
 
 	// First, lookup local content store
-	if _, err := ref.getCompressionBlob(ctx, compressionType); err == nil {
+	if _, err := ref.getCompressionBlob(ctx, comp); err == nil {
 		return nil // found the compression variant. no need to convert.
 	}
 
@@ -265,14 +422,83 @@ func ensureCompression(ctx context.Context, ref *immutableRef, desc ocispecs.Des
 	}).Unlazy(ctx); err != nil {
 		return err
 	}
-	newDesc, err := layerConvertFunc(ctx, ref.cm.ContentStore, desc)
+	newDesc, err := ref.cm.convertLayer(ctx, layerConvertFunc, desc)
 	if err != nil {
 		return err
 	}
 
 	// Start to track converted layer
-	if err := ref.addCompressionBlob(ctx, newDesc.Digest, compressionType); err != nil {
+	if err := ref.addCompressionBlob(ctx, newDesc.Digest, comp); err != nil {
 		return err
 	}
 	return nil
 }
+
+// convertLayer converts the layer blob desc with convert. Conversions are
+// CPU bound, so the number of conversions running at the same time is
+// limited with MaxParallelConversions.
+func (cm *cacheManager) convertLayer(ctx context.Context, convert converter.ConvertFunc, desc ocispecs.Descriptor) (*ocispecs.Descriptor, error) {
+	if err := cm.conversionSem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	defer cm.conversionSem.Release(1)
+	return convert(ctx, cm.ContentStore, desc)
+}
+
+// RewriteLayerTimestamps returns a layer blob based on desc in which the
+// timestamps of the files that are newer than epoch are set to epoch, so
+// that layers created by the differ at different times are identical.
+// The blob keeps the compression of desc, except for eStargz layers that are
+// rewritten as plain gzip.
+func RewriteLayerTimestamps(ctx context.Context, cs content.Store, desc ocispecs.Descriptor, epoch time.Time) (*ocispecs.Descriptor, error) {
+	var compressionType compression.Type
+	switch {
+	case !images.IsLayerType(desc.MediaType):
+		return &desc, nil
+	case uncompress.IsUncompressedType(desc.MediaType):
+		compressionType = compression.Uncompressed
+	case isGzipCompressedType(desc.MediaType):
+		compressionType = compression.Gzip
+	case isZstdCompressedType(desc.MediaType):
+		compressionType = compression.Zstd
+	default:
+		return nil, errors.Errorf("unsupported layer media type %s", desc.MediaType)
+	}
+	newDesc, err := rewriteLayerFunc(compression.New(compressionType), func(w io.Writer, r io.Reader) error {
+		return rewriteTarTimestamps(w, r, epoch)
+	})(ctx, cs, desc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to rewrite timestamps of layer %s", desc.Digest)
+	}
+	return newDesc, nil
+}
+
+func rewriteTarTimestamps(w io.Writer, r io.Reader, epoch time.Time) error {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	clamp := func(t time.Time) time.Time {
+		if t.After(epoch) {
+			return epoch
+		}
+		return t
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		hdr.ModTime = clamp(hdr.ModTime)
+		hdr.AccessTime = clamp(hdr.AccessTime)
+		hdr.ChangeTime = clamp(hdr.ChangeTime)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return errors.WithStack(err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(tw.Close())
+}
@@ -70,6 +70,21 @@ func ClearCacheContext(md *metadata.StorageItem) {
 	getDefaultManager().clearCacheContext(md.ID())
 }
 
+// FileChecksums returns the checksums of the regular files below p that were
+// already computed for ref, keyed by their path relative to p. Unlike
+// Checksum, it never scans or hashes files.
+func FileChecksums(ctx context.Context, ref cache.ImmutableRef, p string) (map[string]digest.Digest, error) {
+	cci, err := GetCacheContext(ctx, ensureOriginMetadata(ref.Metadata()), ref.IdentityMapping())
+	if err != nil {
+		return nil, err
+	}
+	cc, ok := cci.(*cacheContext)
+	if !ok {
+		return nil, errors.Errorf("invalid cachecontext: %T", cci)
+	}
+	return cc.fileChecksums(keyPath(p)), nil
+}
+
 type CacheContext interface {
 	Checksum(ctx context.Context, ref cache.Mountable, p string, opts ChecksumOpts, s session.Group) (digest.Digest, error)
 	HandleChange(kind fsutil.ChangeKind, p string, fi os.FileInfo, err error) error
@@ -432,6 +447,22 @@ func (cc *cacheContext) Checksum(ctx context.Context, mountable cache.Mountable,
 	return digester.Digest(), nil
 }
 
+func (cc *cacheContext) fileChecksums(p string) map[string]digest.Digest {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+
+	prefix := convertPathToKey([]byte(p + "/"))
+	m := map[string]digest.Digest{}
+	cc.tree.Root().WalkPrefix(prefix, func(k []byte, v interface{}) bool {
+		cr := v.(*CacheRecord)
+		if cr.Type == CacheRecordTypeFile && cr.Digest != "" {
+			m[string(convertKeyToPath(k[len(prefix):]))] = cr.Digest
+		}
+		return false
+	})
+	return m
+}
+
 func (cc *cacheContext) checksumFollow(ctx context.Context, m *mount, p string, follow bool) (digest.Digest, error) {
 	const maxSymlinkLimit = 255
 	i := 0
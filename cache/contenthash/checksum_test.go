@@ -286,6 +286,53 @@ func TestSymlinksNoFollow(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestFileChecksums(t *testing.T) {
+	t.Parallel()
+	tmpdir, err := ioutil.TempDir("", "buildkit-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
+	require.NoError(t, err)
+	cm, _ := setupCacheManager(t, tmpdir, "native", snapshotter)
+	defer cm.Close()
+
+	ch := []string{
+		"ADD foo file data0",
+		"ADD d0 dir",
+		"ADD d0/abc file data0",
+		"ADD d0/def file data1",
+		"ADD d0/ghi symlink abc",
+		"ADD d0/sub dir",
+		"ADD d0/sub/jkl file data0",
+	}
+
+	ref := createRef(t, cm, ch)
+
+	sums, err := FileChecksums(context.TODO(), ref, "d0")
+	require.NoError(t, err)
+	require.Empty(t, sums)
+
+	_, err = Checksum(context.TODO(), ref, "d0/abc", ChecksumOpts{}, nil)
+	require.NoError(t, err)
+	_, err = Checksum(context.TODO(), ref, "d0/sub", ChecksumOpts{}, nil)
+	require.NoError(t, err)
+
+	sums, err = FileChecksums(context.TODO(), ref, "d0")
+	require.NoError(t, err)
+	require.Equal(t, map[string]digest.Digest{
+		"abc":     dgstFileData0,
+		"sub/jkl": dgstFileData0,
+	}, sums)
+
+	sums, err = FileChecksums(context.TODO(), ref, "/")
+	require.NoError(t, err)
+	require.Equal(t, dgstFileData0, sums["d0/abc"])
+	require.NotContains(t, sums, "foo")
+
+	require.NoError(t, ref.Release(context.TODO()))
+}
+
 func TestChecksumBasicFile(t *testing.T) {
 	t.Parallel()
 	tmpdir, err := ioutil.TempDir("", "buildkit-state")
@@ -1,11 +1,12 @@
 package cache
 
 import (
-	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
+	"strings"
 
+	ctdcompression "github.com/containerd/containerd/archive/compression"
 	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/images"
@@ -17,84 +18,190 @@ import (
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
-// getConverters returns converter functions according to the specified compression type.
+// layerAnnotations are the annotations of the layer formats for lazy pulling
+var layerAnnotations = append(append(append([]string{}, eStargzAnnotations...), zstdChunkedAnnotations...), nydusAnnotations...)
+
+// withLayerAnnotations returns desc with the eStargz, zstd:chunked and nydus
+// annotations found in the content labels of the blob
+func withLayerAnnotations(desc ocispecs.Descriptor, labelz map[string]string) ocispecs.Descriptor {
+	annotations := make(map[string]string, len(desc.Annotations))
+	for k, v := range desc.Annotations {
+		annotations[k] = v
+	}
+	for _, k := range layerAnnotations {
+		if v, ok := labelz[k]; ok {
+			annotations[k] = v
+		} else {
+			delete(annotations, k)
+		}
+	}
+	desc.Annotations = annotations
+	return desc
+}
+
+// getConverters returns converter functions according to the specified compression.
 // If no conversion is needed, this returns nil without error.
-func getConverters(desc ocispecs.Descriptor, compressionType compression.Type) (converter.ConvertFunc, func(string) string, error) {
-	switch compressionType {
+func getConverters(desc ocispecs.Descriptor, comp compression.Config) (converter.ConvertFunc, func(string) string, error) {
+	if images.IsNonDistributable(desc.MediaType) {
+		// non-distributable layers are exported as references to their
+		// URLs and are never converted
+		return nil, nil, nil
+	}
+	switch comp.Type {
 	case compression.Uncompressed:
 		if !images.IsLayerType(desc.MediaType) || uncompress.IsUncompressedType(desc.MediaType) {
 			// No conversion. No need to return an error here.
 			return nil, nil, nil
 		}
+		if isZstdCompressedType(desc.MediaType) || isEStargz(desc) {
+			return layerConvertFunc(comp), convertMediaTypeToUncompress, nil
+		}
 		return uncompress.LayerConvertFunc, convertMediaTypeToUncompress, nil
 	case compression.Gzip:
 		if !images.IsLayerType(desc.MediaType) || isGzipCompressedType(desc.MediaType) {
 			// No conversion. No need to return an error here.
 			return nil, nil, nil
 		}
-		return gzipLayerConvertFunc, convertMediaTypeToGzip, nil
+		return layerConvertFunc(comp), convertMediaTypeToGzip, nil
+	case compression.Zstd:
+		if !images.IsLayerType(desc.MediaType) || isZstdCompressedType(desc.MediaType) {
+			// No conversion. No need to return an error here.
+			return nil, nil, nil
+		}
+		return layerConvertFunc(comp), convertMediaTypeToZstd, nil
+	case compression.EStargz:
+		if !images.IsLayerType(desc.MediaType) || isEStargz(desc) {
+			// No conversion. No need to return an error here.
+			return nil, nil, nil
+		}
+		return eStargzLayerConvertFunc(comp), func(mt string) string {
+			return convertMediaTypeToGzip(convertMediaTypeToUncompress(mt))
+		}, nil
+	case compression.ZstdChunked:
+		if !images.IsLayerType(desc.MediaType) || isZstdChunked(desc) {
+			// No conversion. No need to return an error here.
+			return nil, nil, nil
+		}
+		return zstdChunkedLayerConvertFunc(comp), convertMediaTypeToZstd, nil
+	case compression.Nydus:
+		if !images.IsLayerType(desc.MediaType) || IsNydusBlob(desc) {
+			// No conversion. No need to return an error here.
+			return nil, nil, nil
+		}
+		return nydusLayerConvertFunc, func(string) string {
+			return compression.MediaTypeNydusBlob
+		}, nil
 	default:
-		return nil, nil, fmt.Errorf("unknown compression type during conversion: %q", compressionType)
+		return nil, nil, fmt.Errorf("unknown compression type during conversion: %q", comp.Type)
 	}
 }
 
-func gzipLayerConvertFunc(ctx context.Context, cs content.Store, desc ocispecs.Descriptor) (*ocispecs.Descriptor, error) {
-	if !images.IsLayerType(desc.MediaType) || isGzipCompressedType(desc.MediaType) {
-		// No conversion. No need to return an error here.
-		return nil, nil
-	}
+// layerConvertFunc returns a converter that decompresses a layer blob and
+// compresses it again with comp.
+func layerConvertFunc(comp compression.Config) converter.ConvertFunc {
+	return rewriteLayerFunc(comp, nil)
+}
 
-	// prepare the source and destination
-	info, err := cs.Info(ctx, desc.Digest)
-	if err != nil {
-		return nil, err
-	}
-	labelz := info.Labels
-	if labelz == nil {
-		labelz = make(map[string]string)
-	}
-	ra, err := cs.ReaderAt(ctx, desc)
-	if err != nil {
-		return nil, err
-	}
-	defer ra.Close()
-	ref := fmt.Sprintf("convert-gzip-from-%s", desc.Digest)
-	w, err := cs.Writer(ctx, content.WithRef(ref))
-	if err != nil {
-		return nil, err
-	}
-	defer w.Close()
-	if err := w.Truncate(0); err != nil { // Old written data possibly remains
-		return nil, err
+// rewriteLayerFunc returns a converter that decompresses a layer blob,
+// optionally rewrites the layer tar with rewrite and compresses it again with
+// comp. Without rewrite, layers already using the media type of comp are not
+// converted.
+func rewriteLayerFunc(comp compression.Config, rewrite func(io.Writer, io.Reader) error) converter.ConvertFunc {
+	var convertMediaType func(string) string
+	switch comp.Type {
+	case compression.Uncompressed:
+		convertMediaType = convertMediaTypeToUncompress
+	case compression.Gzip:
+		convertMediaType = convertMediaTypeToGzip
+	case compression.Zstd:
+		convertMediaType = convertMediaTypeToZstd
 	}
-	zw := gzip.NewWriter(w)
-	defer zw.Close()
+	return func(ctx context.Context, cs content.Store, desc ocispecs.Descriptor) (*ocispecs.Descriptor, error) {
+		if !images.IsLayerType(desc.MediaType) || (rewrite == nil && convertMediaType(desc.MediaType) == desc.MediaType) {
+			// No conversion. No need to return an error here.
+			return nil, nil
+		}
 
-	// convert this layer
-	diffID := digest.Canonical.Digester()
-	if _, err := io.Copy(zw, io.TeeReader(io.NewSectionReader(ra, 0, ra.Size()), diffID.Hash())); err != nil {
-		return nil, err
-	}
-	if err := zw.Close(); err != nil { // Flush the writer
-		return nil, err
-	}
-	labelz[labels.LabelUncompressed] = diffID.Digest().String() // update diffID label
-	if err = w.Commit(ctx, 0, "", content.WithLabels(labelz)); err != nil && !errdefs.IsAlreadyExists(err) {
-		return nil, err
-	}
-	if err := w.Close(); err != nil {
-		return nil, err
-	}
-	info, err = cs.Info(ctx, w.Digest())
-	if err != nil {
-		return nil, err
-	}
+		// prepare the source and destination
+		info, err := cs.Info(ctx, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		labelz := info.Labels
+		if labelz == nil {
+			labelz = make(map[string]string)
+		}
+		ra, err := cs.ReaderAt(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		defer ra.Close()
+		r, err := ctdcompression.DecompressStream(io.NewSectionReader(ra, 0, ra.Size()))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		var tr io.Reader = r
+		if rewrite != nil {
+			pr, pw := io.Pipe()
+			go func() {
+				pw.CloseWithError(rewrite(pw, r))
+			}()
+			defer pr.Close()
+			tr = pr
+		}
+		ref := fmt.Sprintf("convert-%s-from-%s", comp.Type, desc.Digest)
+		if rewrite != nil {
+			ref = "rewrite-" + ref
+		}
+		w, err := cs.Writer(ctx, content.WithRef(ref))
+		if err != nil {
+			return nil, err
+		}
+		defer w.Close()
+		if err := w.Truncate(0); err != nil { // Old written data possibly remains
+			return nil, err
+		}
+		zw, err := comp.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		defer zw.Close()
 
-	newDesc := desc
-	newDesc.MediaType = convertMediaTypeToGzip(newDesc.MediaType)
-	newDesc.Digest = info.Digest
-	newDesc.Size = info.Size
-	return &newDesc, nil
+		// convert this layer
+		diffID := digest.Canonical.Digester()
+		if _, err := io.Copy(zw, io.TeeReader(tr, diffID.Hash())); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil { // Flush the writer
+			return nil, err
+		}
+		for _, k := range layerAnnotations {
+			delete(labelz, k)
+		}
+		if comp.Type == compression.Uncompressed {
+			delete(labelz, labels.LabelUncompressed)
+		} else {
+			labelz[labels.LabelUncompressed] = diffID.Digest().String() // update diffID label
+		}
+		if err = w.Commit(ctx, 0, "", content.WithLabels(labelz)); err != nil && !errdefs.IsAlreadyExists(err) {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		info, err = cs.Info(ctx, w.Digest())
+		if err != nil {
+			return nil, err
+		}
+
+		newDesc := withLayerAnnotations(desc, labelz)
+		newDesc.Annotations[labels.LabelUncompressed] = diffID.Digest().String()
+		newDesc.MediaType = convertMediaType(newDesc.MediaType)
+		newDesc.Digest = info.Digest
+		newDesc.Size = info.Size
+		return &newDesc, nil
+	}
 }
 
 func isGzipCompressedType(mt string) bool {
@@ -110,8 +217,16 @@ func isGzipCompressedType(mt string) bool {
 	}
 }
 
+func isZstdCompressedType(mt string) bool {
+	return strings.HasSuffix(mt, "+zstd")
+}
+
 func convertMediaTypeToUncompress(mt string) string {
 	switch mt {
+	case compression.MediaTypeImageLayerZstd:
+		return ocispecs.MediaTypeImageLayer
+	case ocispecs.MediaTypeImageLayerNonDistributable + "+zstd":
+		return ocispecs.MediaTypeImageLayerNonDistributable
 	case images.MediaTypeDockerSchema2LayerGzip:
 		return images.MediaTypeDockerSchema2Layer
 	case images.MediaTypeDockerSchema2LayerForeignGzip:
@@ -126,6 +241,9 @@ func convertMediaTypeToUncompress(mt string) string {
 }
 
 func convertMediaTypeToGzip(mt string) string {
+	if isZstdCompressedType(mt) {
+		mt = convertMediaTypeToUncompress(mt)
+	}
 	if uncompress.IsUncompressedType(mt) {
 		if images.IsDockerType(mt) {
 			mt += ".gzip"
@@ -136,3 +254,18 @@ func convertMediaTypeToGzip(mt string) string {
 	}
 	return mt
 }
+
+func convertMediaTypeToZstd(mt string) string {
+	mt = convertMediaTypeToUncompress(mt)
+	switch mt {
+	case images.MediaTypeDockerSchema2Layer:
+		// docker media types don't have a zstd variant
+		return compression.MediaTypeImageLayerZstd
+	case images.MediaTypeDockerSchema2LayerForeign:
+		return ocispecs.MediaTypeImageLayerNonDistributable + "+zstd"
+	case ocispecs.MediaTypeImageLayer, ocispecs.MediaTypeImageLayerNonDistributable:
+		return mt + "+zstd"
+	default:
+		return mt
+	}
+}
@@ -0,0 +1,523 @@
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	ctdcompression "github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/labels"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/snapshots/native"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/moby/buildkit/util/compression"
+	"github.com/moby/buildkit/util/leaseutil"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestZstdConversion(t *testing.T) {
+	t.Parallel()
+	ctx, cs, cleanup := newConverterTestStore(t)
+	defer cleanup()
+
+	dt := bytes.Repeat([]byte("layer data "), 1024)
+	orig := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageLayer,
+		Digest:    digest.FromBytes(dt),
+		Size:      int64(len(dt)),
+	}
+	require.NoError(t, content.WriteBlob(ctx, cs, "orig", bytes.NewReader(dt), orig))
+
+	convert, convertMediaType, err := getConverters(orig, compression.New(compression.Zstd))
+	require.NoError(t, err)
+	require.NotNil(t, convert)
+	require.Equal(t, compression.MediaTypeImageLayerZstd, convertMediaType(orig.MediaType))
+
+	zdesc, err := convert(ctx, cs, orig)
+	require.NoError(t, err)
+	require.Equal(t, compression.MediaTypeImageLayerZstd, zdesc.MediaType)
+
+	info, err := cs.Info(ctx, zdesc.Digest)
+	require.NoError(t, err)
+	require.Equal(t, orig.Digest.String(), info.Labels[labels.LabelUncompressed])
+
+	mt, err := compression.DetectLayerMediaType(ctx, cs, zdesc.Digest, false)
+	require.NoError(t, err)
+	require.Equal(t, compression.MediaTypeImageLayerZstd, mt)
+
+	convert, _, err = getConverters(*zdesc, compression.New(compression.Zstd))
+	require.NoError(t, err)
+	require.Nil(t, convert)
+
+	// zstd layers can be converted to the other compression types
+	convert, _, err = getConverters(*zdesc, compression.New(compression.Gzip))
+	require.NoError(t, err)
+	gdesc, err := convert(ctx, cs, *zdesc)
+	require.NoError(t, err)
+	require.Equal(t, ocispecs.MediaTypeImageLayerGzip, gdesc.MediaType)
+	info, err = cs.Info(ctx, gdesc.Digest)
+	require.NoError(t, err)
+	require.Equal(t, orig.Digest.String(), info.Labels[labels.LabelUncompressed])
+
+	convert, _, err = getConverters(*zdesc, compression.New(compression.Uncompressed))
+	require.NoError(t, err)
+	udesc, err := convert(ctx, cs, *zdesc)
+	require.NoError(t, err)
+	require.Equal(t, orig.MediaType, udesc.MediaType)
+	require.Equal(t, orig.Digest, udesc.Digest)
+}
+
+func TestConversionLevel(t *testing.T) {
+	t.Parallel()
+	ctx, cs, cleanup := newConverterTestStore(t)
+	defer cleanup()
+
+	dt := make([]byte, 0, 64*1024)
+	for i := 0; len(dt) < cap(dt); i++ {
+		dt = append(dt, fmt.Sprintf("line %d of the layer data\n", i%977)...)
+	}
+	orig := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageLayer,
+		Digest:    digest.FromBytes(dt),
+		Size:      int64(len(dt)),
+	}
+	require.NoError(t, content.WriteBlob(ctx, cs, "orig", bytes.NewReader(dt), orig))
+
+	convertLevel := func(ct compression.Type, level int) *ocispecs.Descriptor {
+		comp := compression.New(ct)
+		comp.Level = &level
+		convert, _, err := getConverters(orig, comp)
+		require.NoError(t, err)
+		desc, err := convert(ctx, cs, orig)
+		require.NoError(t, err)
+		info, err := cs.Info(ctx, desc.Digest)
+		require.NoError(t, err)
+		require.Equal(t, orig.Digest.String(), info.Labels[labels.LabelUncompressed])
+		return desc
+	}
+
+	fast, best := convertLevel(compression.Gzip, 1), convertLevel(compression.Gzip, 9)
+	require.NotEqual(t, fast.Digest, best.Digest)
+	require.Less(t, best.Size, fast.Size)
+
+	fast, best = convertLevel(compression.Zstd, 1), convertLevel(compression.Zstd, 19)
+	require.NotEqual(t, fast.Digest, best.Digest)
+	require.Less(t, best.Size, fast.Size)
+
+	// out of range levels are clamped
+	require.Equal(t, best.Digest, convertLevel(compression.Zstd, 100).Digest)
+}
+
+func TestEStargzConversion(t *testing.T) {
+	t.Parallel()
+	ctx, cs, cleanup := newConverterTestStore(t)
+	defer cleanup()
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, f := range []string{"foo", "bar"} {
+		dt := []byte("contents of " + f)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: f, Mode: 0644, Size: int64(len(dt)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write(dt)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	dt := buf.Bytes()
+	orig := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageLayer,
+		Digest:    digest.FromBytes(dt),
+		Size:      int64(len(dt)),
+	}
+	require.NoError(t, content.WriteBlob(ctx, cs, "orig", bytes.NewReader(dt), orig))
+
+	convert, convertMediaType, err := getConverters(orig, compression.New(compression.EStargz))
+	require.NoError(t, err)
+	require.NotNil(t, convert)
+	require.Equal(t, ocispecs.MediaTypeImageLayerGzip, convertMediaType(orig.MediaType))
+
+	edesc, err := convert(ctx, cs, orig)
+	if errors.Is(err, errEStargzUnsupported) {
+		// the estargz footer can't be built with the compress/gzip of this
+		// Go version, the conversion must fail instead of panicking
+		_, err = cs.Info(ctx, orig.Digest)
+		require.NoError(t, err)
+		return
+	}
+	require.NoError(t, err)
+	require.Equal(t, ocispecs.MediaTypeImageLayerGzip, edesc.MediaType)
+	require.True(t, isEStargz(*edesc))
+
+	ra, err := cs.ReaderAt(ctx, *edesc)
+	require.NoError(t, err)
+	defer ra.Close()
+	r, err := estargz.Open(io.NewSectionReader(ra, 0, ra.Size()))
+	require.NoError(t, err)
+	_, err = r.VerifyTOC(digest.Digest(edesc.Annotations[estargz.TOCJSONDigestAnnotation]))
+	require.NoError(t, err)
+	_, ok := r.Lookup("foo")
+	require.True(t, ok)
+
+	zr, err := gzip.NewReader(io.NewSectionReader(ra, 0, ra.Size()))
+	require.NoError(t, err)
+	uncompressed, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, digest.FromBytes(uncompressed).String(), edesc.Annotations[labels.LabelUncompressed])
+	require.Equal(t, fmt.Sprintf("%d", len(uncompressed)), edesc.Annotations[estargz.StoreUncompressedSizeAnnotation])
+
+	convert, _, err = getConverters(*edesc, compression.New(compression.EStargz))
+	require.NoError(t, err)
+	require.Nil(t, convert)
+
+	// converting back drops the eStargz annotations
+	convert, _, err = getConverters(*edesc, compression.New(compression.Zstd))
+	require.NoError(t, err)
+	zdesc, err := convert(ctx, cs, *edesc)
+	require.NoError(t, err)
+	require.False(t, isEStargz(*zdesc))
+}
+
+func TestZstdChunkedConversion(t *testing.T) {
+	t.Parallel()
+	ctx, cs, cleanup := newConverterTestStore(t)
+	defer cleanup()
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "dir/", Mode: 0755, Typeflag: tar.TypeDir}))
+	for _, f := range []string{"dir/foo", "bar"} {
+		dt := []byte("contents of " + f)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: f, Mode: 0644, Size: int64(len(dt)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write(dt)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	dt := buf.Bytes()
+	orig := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageLayer,
+		Digest:    digest.FromBytes(dt),
+		Size:      int64(len(dt)),
+	}
+	require.NoError(t, content.WriteBlob(ctx, cs, "orig", bytes.NewReader(dt), orig))
+
+	convert, convertMediaType, err := getConverters(orig, compression.New(compression.ZstdChunked))
+	require.NoError(t, err)
+	require.NotNil(t, convert)
+	require.Equal(t, compression.MediaTypeImageLayerZstd, convertMediaType(orig.MediaType))
+
+	zdesc, err := convert(ctx, cs, orig)
+	require.NoError(t, err)
+	require.Equal(t, compression.MediaTypeImageLayerZstd, zdesc.MediaType)
+	require.True(t, isZstdChunked(*zdesc))
+	require.True(t, isLazyMountable(&DescHandler{Annotations: zdesc.Annotations}))
+	require.Equal(t, orig.Digest.String(), zdesc.Annotations[labels.LabelUncompressed])
+
+	blob, err := content.ReadBlob(ctx, cs, *zdesc)
+	require.NoError(t, err)
+
+	// the blob is a regular zstd stream of the layer tar
+	zr, err := ctdcompression.DecompressStream(bytes.NewReader(blob))
+	require.NoError(t, err)
+	uncompressed, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, dt, uncompressed)
+
+	// the TOC is found with the annotations and points to the file contents
+	var offset, size, uncompressedSize, typ int
+	_, err = fmt.Sscanf(zdesc.Annotations[zstdChunkedManifestPositionAnnotation], "%d:%d:%d:%d", &offset, &size, &uncompressedSize, &typ)
+	require.NoError(t, err)
+	manifest := blob[offset : offset+size]
+	require.Equal(t, digest.FromBytes(manifest).String(), zdesc.Annotations[zstdChunkedManifestChecksumAnnotation])
+	zr, err = ctdcompression.DecompressStream(bytes.NewReader(manifest))
+	require.NoError(t, err)
+	var toc zstdChunkedTOC
+	require.NoError(t, json.NewDecoder(zr).Decode(&toc))
+	require.Equal(t, 3, len(toc.Entries))
+	require.Equal(t, "dir", toc.Entries[0].Type)
+	e := toc.Entries[1]
+	require.Equal(t, "dir/foo", e.Name)
+	zr, err = ctdcompression.DecompressStream(bytes.NewReader(blob[e.Offset:e.EndOffset]))
+	require.NoError(t, err)
+	fdt, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, "contents of dir/foo", string(fdt))
+	require.Equal(t, digest.FromBytes(fdt).String(), e.Digest)
+
+	convert, _, err = getConverters(*zdesc, compression.New(compression.ZstdChunked))
+	require.NoError(t, err)
+	require.Nil(t, convert)
+
+	// zstd:chunked layers are zstd layers, converting to gzip drops the TOC
+	convert, _, err = getConverters(*zdesc, compression.New(compression.Zstd))
+	require.NoError(t, err)
+	require.Nil(t, convert)
+	convert, _, err = getConverters(*zdesc, compression.New(compression.Gzip))
+	require.NoError(t, err)
+	gdesc, err := convert(ctx, cs, *zdesc)
+	require.NoError(t, err)
+	require.False(t, isZstdChunked(*gdesc))
+	require.False(t, isLazyMountable(&DescHandler{Annotations: gdesc.Annotations}))
+	require.Equal(t, orig.Digest.String(), gdesc.Annotations[labels.LabelUncompressed])
+}
+
+// fakeNydusBuilder is a nydus-image that stores the layer tar as the blob
+// and the name of the blob as the bootstrap, and concatenates bootstraps on
+// merge
+const fakeNydusBuilder = `#!/bin/sh
+cmd=$1
+shift
+src=
+while [ $# -gt 0 ]; do
+	case $1 in
+	--blob) blob=$2; shift 2 ;;
+	--bootstrap) bootstrap=$2; shift 2 ;;
+	--blob-digests) echo "$2" > "$(dirname "$0")/blob-digests"; shift 2 ;;
+	--*) shift 2 ;;
+	*) src="$src $1"; shift ;;
+	esac
+done
+case $cmd in
+create) cp $src "$blob" && echo "boot of $(basename $src)" > "$bootstrap" ;;
+merge) cat $src > "$bootstrap" ;;
+*) exit 1 ;;
+esac
+`
+
+func TestNydusConversion(t *testing.T) {
+	ctx, cs, cleanup := newConverterTestStore(t)
+	defer cleanup()
+
+	orig := ocispecs.Descriptor{MediaType: ocispecs.MediaTypeImageLayerGzip}
+	convert, _, err := getConverters(orig, compression.New(compression.Nydus))
+	require.NoError(t, err)
+
+	// the builder is looked up in PATH
+	t.Setenv("PATH", t.TempDir())
+	_, err = convert(ctx, cs, orig)
+	require.Error(t, err)
+	bin := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(bin, nydusBuilder), []byte(fakeNydusBuilder), 0755))
+	t.Setenv("PATH", bin+":/usr/bin:/bin")
+
+	layers := make([]ocispecs.Descriptor, 2)
+	for i := range layers {
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		tw := tar.NewWriter(gw)
+		dt := []byte(fmt.Sprintf("layer %d", i))
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "foo", Mode: 0644, Size: int64(len(dt)), Typeflag: tar.TypeReg}))
+		_, err = tw.Write(dt)
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+		require.NoError(t, gw.Close())
+		orig := ocispecs.Descriptor{
+			MediaType: ocispecs.MediaTypeImageLayerGzip,
+			Digest:    digest.FromBytes(buf.Bytes()),
+			Size:      int64(buf.Len()),
+		}
+		require.NoError(t, content.WriteBlob(ctx, cs, orig.Digest.String(), bytes.NewReader(buf.Bytes()), orig))
+
+		convert, convertMediaType, err := getConverters(orig, compression.New(compression.Nydus))
+		require.NoError(t, err)
+		require.Equal(t, compression.MediaTypeNydusBlob, convertMediaType(orig.MediaType))
+		ndesc, err := convert(ctx, cs, orig)
+		require.NoError(t, err)
+		require.Equal(t, compression.MediaTypeNydusBlob, ndesc.MediaType)
+		require.True(t, IsNydusBlob(*ndesc))
+		// nydus blobs are uncompressed
+		require.Equal(t, ndesc.Digest.String(), ndesc.Annotations[labels.LabelUncompressed])
+		layers[i] = *ndesc
+
+		// the layer is a tar of the blob and its bootstrap
+		blob, err := content.ReadBlob(ctx, cs, *ndesc)
+		require.NoError(t, err)
+		tr := tar.NewReader(bytes.NewReader(blob))
+		hdr, err := tr.Next()
+		require.NoError(t, err)
+		require.Equal(t, nydusEntryBlob, hdr.Name)
+		hdr, err = tr.Next()
+		require.NoError(t, err)
+		require.Equal(t, nydusEntryBootstrap, hdr.Name)
+
+		convert, _, err = getConverters(*ndesc, compression.New(compression.Nydus))
+		require.NoError(t, err)
+		require.Nil(t, convert)
+	}
+
+	desc, err := MergeNydus(ctx, cs, layers)
+	require.NoError(t, err)
+	require.Equal(t, ocispecs.MediaTypeImageLayerGzip, desc.MediaType)
+	require.Equal(t, "true", desc.Annotations[nydusBootstrapAnnotation])
+	dt, err := ioutil.ReadFile(filepath.Join(bin, "blob-digests"))
+	require.NoError(t, err)
+	require.Equal(t, layers[0].Digest.Hex()+","+layers[1].Digest.Hex()+"\n", string(dt))
+
+	blob, err := content.ReadBlob(ctx, cs, *desc)
+	require.NoError(t, err)
+	zr, err := ctdcompression.DecompressStream(bytes.NewReader(blob))
+	require.NoError(t, err)
+	uncompressed, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, digest.FromBytes(uncompressed).String(), desc.Annotations[labels.LabelUncompressed])
+	tr := tar.NewReader(bytes.NewReader(uncompressed))
+	hdr, err := tr.Next()
+	require.NoError(t, err)
+	require.Equal(t, nydusBootstrapFile, hdr.Name)
+	bootstrap, err := ioutil.ReadAll(tr)
+	require.NoError(t, err)
+	require.Equal(t, "boot of layer.tar\nboot of layer.tar\n", string(bootstrap))
+}
+
+func TestRewriteLayerTimestamps(t *testing.T) {
+	t.Parallel()
+	ctx, cs, cleanup := newConverterTestStore(t)
+	defer cleanup()
+
+	epoch := time.Unix(1000000000, 0).UTC()
+	old := epoch.Add(-time.Hour)
+
+	writeLayer := func(mtime time.Time) ocispecs.Descriptor {
+		buf := &bytes.Buffer{}
+		zw := gzip.NewWriter(buf)
+		tw := tar.NewWriter(zw)
+		for _, f := range []struct {
+			name  string
+			mtime time.Time
+		}{{"foo", mtime}, {"bar", old}} {
+			dt := []byte("contents of " + f.name)
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(dt)), Typeflag: tar.TypeReg, ModTime: f.mtime}))
+			_, err := tw.Write(dt)
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, zw.Close())
+		desc := ocispecs.Descriptor{
+			MediaType:   ocispecs.MediaTypeImageLayerGzip,
+			Digest:      digest.FromBytes(buf.Bytes()),
+			Size:        int64(buf.Len()),
+			Annotations: map[string]string{"buildkit/createdat": "foo"},
+		}
+		require.NoError(t, content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(buf.Bytes()), desc))
+		return desc
+	}
+
+	desc1 := writeLayer(time.Now())
+	desc2 := writeLayer(time.Now().Add(time.Minute))
+	require.NotEqual(t, desc1.Digest, desc2.Digest)
+
+	new1, err := RewriteLayerTimestamps(ctx, cs, desc1, epoch)
+	require.NoError(t, err)
+	new2, err := RewriteLayerTimestamps(ctx, cs, desc2, epoch)
+	require.NoError(t, err)
+	require.Equal(t, new1.Digest, new2.Digest)
+	require.Equal(t, ocispecs.MediaTypeImageLayerGzip, new1.MediaType)
+	require.Equal(t, "foo", new1.Annotations["buildkit/createdat"])
+
+	ra, err := cs.ReaderAt(ctx, *new1)
+	require.NoError(t, err)
+	defer ra.Close()
+	zr, err := gzip.NewReader(io.NewSectionReader(ra, 0, ra.Size()))
+	require.NoError(t, err)
+	uncompressed, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, digest.FromBytes(uncompressed).String(), new1.Annotations[labels.LabelUncompressed])
+
+	tr := tar.NewReader(bytes.NewReader(uncompressed))
+	mtimes := map[string]time.Time{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		mtimes[hdr.Name] = hdr.ModTime
+	}
+	require.True(t, epoch.Equal(mtimes["foo"]))
+	require.True(t, old.Equal(mtimes["bar"]))
+}
+
+func TestConvertLayerLimit(t *testing.T) {
+	t.Parallel()
+	cm := &cacheManager{
+		conversionSem: semaphore.NewWeighted(2),
+	}
+
+	var mu sync.Mutex
+	var running, maxRunning int
+	convert := func(ctx context.Context, cs content.Store, desc ocispecs.Descriptor) (*ocispecs.Descriptor, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return &desc, nil
+	}
+
+	eg, ctx := errgroup.WithContext(context.TODO())
+	for i := 0; i < 6; i++ {
+		desc := ocispecs.Descriptor{Digest: digest.FromString(fmt.Sprintf("layer%d", i))}
+		eg.Go(func() error {
+			newDesc, err := cm.convertLayer(ctx, convert, desc)
+			if err != nil {
+				return err
+			}
+			require.Equal(t, desc.Digest, newDesc.Digest)
+			return nil
+		})
+	}
+	require.NoError(t, eg.Wait())
+	require.Equal(t, 2, maxRunning)
+
+	canceled, cancel := context.WithCancel(context.TODO())
+	cancel()
+	require.NoError(t, cm.conversionSem.Acquire(context.TODO(), 2))
+	_, err := cm.convertLayer(canceled, convert, ocispecs.Descriptor{})
+	require.Error(t, err)
+	cm.conversionSem.Release(2)
+}
+
+func newConverterTestStore(t *testing.T) (context.Context, content.Store, func()) {
+	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
+
+	tmpdir, err := ioutil.TempDir("", "cachemanager")
+	require.NoError(t, err)
+
+	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
+	require.NoError(t, err)
+
+	co, cleanup, err := newCacheManager(ctx, cmOpt{
+		snapshotter:     snapshotter,
+		snapshotterName: "native",
+		tmpdir:          tmpdir,
+	})
+	require.NoError(t, err)
+
+	ctx, done, err := leaseutil.WithLease(ctx, co.lm, leaseutil.MakeTemporary)
+	require.NoError(t, err)
+
+	return ctx, co.cs, func() {
+		done(context.TODO())
+		cleanup()
+		os.RemoveAll(tmpdir)
+	}
+}
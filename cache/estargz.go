@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/images/converter"
+	"github.com/containerd/containerd/labels"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/moby/buildkit/util/compression"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// eStargzAnnotations are stored as content labels of eStargz blobs and added
+// to the layer descriptors on export, so that lazy-pulling snapshotters can
+// find the TOC
+var eStargzAnnotations = []string{estargz.TOCJSONDigestAnnotation, estargz.StoreUncompressedSizeAnnotation}
+
+// errEStargzUnsupported is returned if estargz can't build blobs with the
+// compress/gzip of the Go toolchain buildkitd was built with
+var errEStargzUnsupported = errors.New("estargz compression is not supported by this build of buildkitd")
+
+func isEStargz(desc ocispecs.Descriptor) bool {
+	_, ok := desc.Annotations[estargz.TOCJSONDigestAnnotation]
+	return ok
+}
+
+// eStargzLayerConvertFunc converts a layer blob into eStargz. The diffID of
+// the result differs from the source blob because the TOC is part of the
+// layer tar. The blob is compressed with the gzip level of comp.
+func eStargzLayerConvertFunc(comp compression.Config) converter.ConvertFunc {
+	return func(ctx context.Context, cs content.Store, desc ocispecs.Descriptor) (*ocispecs.Descriptor, error) {
+		if !images.IsLayerType(desc.MediaType) || isEStargz(desc) {
+			// No conversion. No need to return an error here.
+			return nil, nil
+		}
+
+		// prepare the source and destination
+		info, err := cs.Info(ctx, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		labelz := info.Labels
+		if labelz == nil {
+			labelz = make(map[string]string)
+		}
+		ra, err := cs.ReaderAt(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		defer ra.Close()
+		blob, err := buildEStargz(io.NewSectionReader(ra, 0, ra.Size()), estargz.WithCompressionLevel(comp.GzipLevel()))
+		if err != nil {
+			return nil, err
+		}
+		defer blob.Close()
+		ref := fmt.Sprintf("convert-estargz-from-%s", desc.Digest)
+		w, err := cs.Writer(ctx, content.WithRef(ref))
+		if err != nil {
+			return nil, err
+		}
+		defer w.Close()
+		if err := w.Truncate(0); err != nil { // Old written data possibly remains
+			return nil, err
+		}
+
+		// convert this layer, counting the uncompressed size on the way
+		var uncompressedSize int64
+		pr, pw := io.Pipe()
+		var eg errgroup.Group
+		eg.Go(func() error {
+			zr, err := gzip.NewReader(pr)
+			if err != nil {
+				pr.CloseWithError(err)
+				return err
+			}
+			uncompressedSize, err = io.Copy(ioutil.Discard, zr)
+			pr.CloseWithError(err)
+			return err
+		})
+		_, err = io.Copy(w, io.TeeReader(blob, pw))
+		pw.CloseWithError(err)
+		if err != nil {
+			return nil, err
+		}
+		if err := eg.Wait(); err != nil {
+			return nil, err
+		}
+
+		labelz[labels.LabelUncompressed] = blob.DiffID().String() // update diffID label
+		labelz[estargz.TOCJSONDigestAnnotation] = blob.TOCDigest().String()
+		labelz[estargz.StoreUncompressedSizeAnnotation] = fmt.Sprintf("%d", uncompressedSize)
+		if err = w.Commit(ctx, 0, "", content.WithLabels(labelz)); err != nil && !errdefs.IsAlreadyExists(err) {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		info, err = cs.Info(ctx, w.Digest())
+		if err != nil {
+			return nil, err
+		}
+
+		newDesc := withLayerAnnotations(desc, labelz)
+		newDesc.MediaType = convertMediaTypeToGzip(convertMediaTypeToUncompress(desc.MediaType))
+		newDesc.Digest = info.Digest
+		newDesc.Size = info.Size
+		newDesc.Annotations[labels.LabelUncompressed] = labelz[labels.LabelUncompressed]
+		return &newDesc, nil
+	}
+}
+
+// buildEStargz calls estargz.Build, which panics if the gzip footer written by
+// compress/gzip doesn't have the size estargz expects, e.g. with newer Go
+// versions
+func buildEStargz(sr *io.SectionReader, opts ...estargz.Option) (blob *estargz.Blob, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			blob = nil
+			err = errors.Wrapf(errEStargzUnsupported, "%v", r)
+		}
+	}()
+	return estargz.Build(sr, opts...)
+}
@@ -0,0 +1,17 @@
+// +build !windows
+
+package cache
+
+import (
+	"syscall"
+)
+
+// freeSpace returns the space available to unprivileged users on the
+// filesystem of path in bytes
+func freeSpace(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bsize) * int64(st.Bavail), nil
+}
@@ -0,0 +1,8 @@
+// +build windows
+
+package cache
+
+// freeSpace returns -1 as the free space isn't checked on Windows
+func freeSpace(path string) (int64, error) {
+	return -1, nil
+}
@@ -0,0 +1,239 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/moby/buildkit/solver/errdefs"
+	"github.com/moby/buildkit/util/bklog"
+	"github.com/pkg/errors"
+)
+
+// RecordLimitError is returned when a new cache record would exceed the
+// maximum number of records configured for the cache manager
+type RecordLimitError struct {
+	Count int
+	Limit int
+}
+
+func (e *RecordLimitError) Error() string {
+	return fmt.Sprintf("cache record limit reached: %d records exist and the limit is %d. Prune the build cache or increase the record limit of the worker", e.Count, e.Limit)
+}
+
+// RecordSizeError is returned when a cache record is larger than the maximum
+// record size configured for the cache manager
+type RecordSizeError struct {
+	ID          string
+	Description string
+	Size        int64
+	Limit       int64
+}
+
+func (e *RecordSizeError) Error() string {
+	descr := e.Description
+	if descr == "" {
+		descr = e.ID
+	}
+	return fmt.Sprintf("cache record %q is %s, exceeding the limit of %s. Check that the step doesn't add unexpected files, e.g. with a .dockerignore file, or increase the record size limit of the worker", descr, units.BytesSize(float64(e.Size)), units.BytesSize(float64(e.Limit)))
+}
+
+// checkRecordLimit must be called with cm.mu held
+func (cm *cacheManager) checkRecordLimit() error {
+	if cm.MaxRecords <= 0 || len(cm.records) < cm.MaxRecords {
+		return nil
+	}
+	return errors.WithStack(&RecordLimitError{Count: len(cm.records), Limit: cm.MaxRecords})
+}
+
+// checkSize returns the current size of the ref and a RecordSizeError if it
+// exceeds MaxRecordSize. sizeUnknown is returned if the size isn't limited.
+func (sr *mutableRef) checkSize(ctx context.Context) (int64, error) {
+	if sr.cm.MaxRecordSize <= 0 {
+		return sizeUnknown, nil
+	}
+	size, err := sr.CurrentSize(ctx)
+	if err != nil {
+		return sizeUnknown, err
+	}
+	if size <= sr.cm.MaxRecordSize {
+		return size, nil
+	}
+	return size, errors.WithStack(&RecordSizeError{
+		ID:          sr.ID(),
+		Description: GetDescription(sr.md),
+		Size:        size,
+		Limit:       sr.cm.MaxRecordSize,
+	})
+}
+
+// sizeCheckInterval is the interval of checking the size of the refs that a
+// build step writes to
+const sizeCheckInterval = 10 * time.Second
+
+// LimitSize runs fn with a context that is canceled when one of refs exceeds
+// the maximum record size of its cache manager, so that a step writing too
+// much fails while it runs instead of filling the disk before it's
+// committed. The RecordSizeError is returned instead of the error of fn.
+func LimitSize(ctx context.Context, refs []MutableRef, fn func(context.Context) error) error {
+	return limitSize(ctx, refs, sizeCheckInterval, fn)
+}
+
+func limitSize(ctx context.Context, refs []MutableRef, interval time.Duration, fn func(context.Context) error) error {
+	var limited []*mutableRef
+	for _, r := range refs {
+		if sr, ok := r.(*mutableRef); ok && sr.cm.MaxRecordSize > 0 {
+			limited = append(limited, sr)
+		}
+	}
+	if len(limited) == 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	var sizeErr error
+	go func() {
+		defer close(done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			for _, sr := range limited {
+				if _, err := sr.checkSize(ctx); err != nil {
+					var recordErr *RecordSizeError
+					if errors.As(err, &recordErr) {
+						sizeErr = err
+						cancel()
+						return
+					}
+					bklog.G(ctx).Debugf("failed to check size of %s: %v", sr.ID(), err)
+				}
+			}
+		}
+	}()
+	err := fn(ctx)
+	cancel()
+	<-done
+	if sizeErr != nil {
+		return sizeErr
+	}
+	return err
+}
+
+// InsufficientStorageError is returned when a filesystem of the cache has less
+// free space than the minimum configured for the cache manager, even after
+// pruning the cache
+type InsufficientStorageError struct {
+	Path  string
+	Free  int64
+	Limit int64
+}
+
+func (e *InsufficientStorageError) Error() string {
+	return fmt.Sprintf("insufficient storage: %s has %s free after pruning the build cache, less than the minimum of %s. Free up disk space or lower the minimum free space of the worker", e.Path, units.BytesSize(float64(e.Free)), units.BytesSize(float64(e.Limit)))
+}
+
+// checkFreeSpace prunes the cache if a filesystem of the cache has less free
+// space than MinFreeSpace, and fails if it still has too little so that the
+// build step fails before the writes of the step or of the metadata fail with
+// ENOSPC. Must be called without cm.mu held.
+func (cm *cacheManager) checkFreeSpace(ctx context.Context) error {
+	if cm.MinFreeSpace <= 0 {
+		return nil
+	}
+	if path, _ := cm.lowFreeSpace(ctx); path == "" {
+		return nil
+	}
+
+	cm.muFreeSpace.Lock()
+	defer cm.muFreeSpace.Unlock()
+
+	// the cache may have been pruned by a concurrent call
+	path, free := cm.lowFreeSpace(ctx)
+	if path == "" {
+		return nil
+	}
+	if len(cm.GCPolicy) > 0 {
+		bklog.G(ctx).Warnf("%s has %s free, pruning build cache", path, units.BytesSize(float64(free)))
+		if err := cm.Prune(ctx, nil, cm.GCPolicy...); err != nil {
+			return err
+		}
+		if path, free = cm.lowFreeSpace(ctx); path == "" {
+			return nil
+		}
+	}
+	return errdefs.WithCode(errors.WithStack(&InsufficientStorageError{
+		Path:  path,
+		Free:  free,
+		Limit: cm.MinFreeSpace,
+	}), errdefs.CodeDiskFull)
+}
+
+// freeSpaceInterval is the interval of checking the free space while the
+// manager is open
+const freeSpaceInterval = 10 * time.Second
+
+// maxFreeSpaceInterval is the longest interval of checking the free space
+// while pruning doesn't free enough space
+const maxFreeSpaceInterval = 5 * time.Minute
+
+// monitorFreeSpace checks the free space every interval, so that the cache
+// is pruned while build steps write to the filesystems and not only when
+// records are created or committed. While pruning doesn't free enough space,
+// e.g. because the disk is filled by other processes, the interval is doubled
+// up to maxFreeSpaceInterval so that the records aren't walked over and over.
+func (cm *cacheManager) monitorFreeSpace(ctx context.Context, interval time.Duration) {
+	delay := interval
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		err := cm.checkFreeSpace(ctx)
+		if err != nil && ctx.Err() == nil {
+			bklog.G(ctx).Warnf("%v", err)
+		}
+		delay = nextFreeSpaceInterval(delay, interval, err)
+		t.Reset(delay)
+	}
+}
+
+// nextFreeSpaceInterval returns the interval after checking the free space
+// with the result err and the interval delay
+func nextFreeSpaceInterval(delay, interval time.Duration, err error) time.Duration {
+	var storageErr *InsufficientStorageError
+	if !errors.As(err, &storageErr) {
+		return interval
+	}
+	delay *= 2
+	if delay > maxFreeSpaceInterval {
+		delay = maxFreeSpaceInterval
+	}
+	return delay
+}
+
+// lowFreeSpace returns the first of FreeSpacePaths with less free space than
+// MinFreeSpace and its free space
+func (cm *cacheManager) lowFreeSpace(ctx context.Context) (string, int64) {
+	for _, p := range cm.FreeSpacePaths {
+		free, err := freeSpace(p)
+		if err != nil {
+			bklog.G(ctx).Debugf("failed to get free space of %s: %v", p, err)
+			continue
+		}
+		if free >= 0 && free < cm.MinFreeSpace {
+			return p, free
+		}
+	}
+	return "", 0
+}
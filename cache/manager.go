@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"runtime"
 	"sort"
 	"sync"
 	"time"
@@ -18,6 +19,7 @@ import (
 	"github.com/moby/buildkit/identity"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/snapshot"
+	"github.com/moby/buildkit/util/compression"
 	"github.com/moby/buildkit/util/flightcontrol"
 	digest "github.com/opencontainers/go-digest"
 	imagespecidentity "github.com/opencontainers/image-spec/identity"
@@ -25,6 +27,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
 var (
@@ -42,6 +45,59 @@ type ManagerOpt struct {
 	GarbageCollect  func(ctx context.Context) (gc.Stats, error)
 	Applier         diff.Applier
 	Differ          diff.Comparer
+	// MaxRecords limits the number of cache records, 0 means no limit
+	MaxRecords int
+	// MaxRecordSize limits the size of a single committed record in bytes,
+	// 0 means no limit. It's checked when the record is committed and
+	// while build steps write to it, see LimitSize.
+	MaxRecordSize int64
+	// MaxParallelConversions limits the number of layer blobs converted to
+	// another compression at the same time, 0 means the number of CPUs
+	MaxParallelConversions int
+	// CompressionLevels are the default compression levels of the layer
+	// blobs per compression type. The gzip level also applies to eStargz and
+	// the zstd level to zstd:chunked blobs.
+	CompressionLevels map[compression.Type]int
+	// VerifyInterval is the interval of re-hashing the blobs of the content
+	// store to evict corrupt ones, 0 disables the periodic verification
+	VerifyInterval time.Duration
+	// FinalizePolicy controls when the snapshots of committed mutable refs
+	// are committed in the snapshotter
+	FinalizePolicy FinalizePolicy
+	// MinFreeSpace is the free space in bytes that the filesystems of
+	// FreeSpacePaths need to have for new records, 0 means no minimum. When
+	// there is less, the cache is pruned with GCPolicy first. The free space
+	// is also checked periodically, so that the cache is pruned while steps
+	// write to the filesystems.
+	MinFreeSpace   int64
+	FreeSpacePaths []string
+	GCPolicy       []client.PruneInfo
+}
+
+// FinalizePolicy controls when a ref committed from a mutable ref is
+// finalized, i.e. the snapshot of the mutable ref is committed and the
+// mutable ref is removed. Until then the ref is backed by the mutable ref
+// and has no blob.
+type FinalizePolicy int
+
+const (
+	// FinalizeLazy finalizes refs when they are needed as parents or their
+	// blobs are created, so that the mutable ref can be reused until then
+	FinalizeLazy FinalizePolicy = iota
+	// FinalizeEager finalizes refs when they are committed
+	FinalizeEager
+)
+
+// ParseFinalizePolicy parses "lazy" or "eager", empty is lazy
+func ParseFinalizePolicy(v string) (FinalizePolicy, error) {
+	switch v {
+	case "", "lazy":
+		return FinalizeLazy, nil
+	case "eager":
+		return FinalizeEager, nil
+	default:
+		return 0, errors.Errorf("invalid finalize policy %q", v)
+	}
 }
 
 type Accessor interface {
@@ -57,6 +113,7 @@ type Accessor interface {
 type Controller interface {
 	DiskUsage(ctx context.Context, info client.DiskUsageInfo) ([]*client.UsageInfo, error)
 	Prune(ctx context.Context, ch chan client.UsageInfo, info ...client.PruneInfo) error
+	VerifyBlobs(ctx context.Context, dryRun bool) (*client.VerifyInfo, error)
 }
 
 type Manager interface {
@@ -77,15 +134,25 @@ type cacheManager struct {
 	ManagerOpt
 	md *metadata.Store
 
-	muPrune sync.Mutex // make sure parallel prune is not allowed so there will not be inconsistent results
-	unlazyG flightcontrol.Group
+	muPrune     sync.Mutex // make sure parallel prune is not allowed so there will not be inconsistent results
+	muFreeSpace sync.Mutex
+	unlazyG     flightcontrol.Group
+
+	conversionSem *semaphore.Weighted
+	stopVerify    func()
+	stopFreeSpace func()
 }
 
 func NewManager(opt ManagerOpt) (Manager, error) {
+	maxConversions := opt.MaxParallelConversions
+	if maxConversions <= 0 {
+		maxConversions = runtime.NumCPU()
+	}
 	cm := &cacheManager{
-		ManagerOpt: opt,
-		md:         opt.MetadataStore,
-		records:    make(map[string]*cacheRecord),
+		ManagerOpt:    opt,
+		md:            opt.MetadataStore,
+		records:       make(map[string]*cacheRecord),
+		conversionSem: semaphore.NewWeighted(int64(maxConversions)),
 	}
 
 	if err := cm.init(context.TODO()); err != nil {
@@ -94,6 +161,17 @@ func NewManager(opt ManagerOpt) (Manager, error) {
 
 	// cm.scheduleGC(5 * time.Minute)
 
+	if opt.VerifyInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		cm.stopVerify = cancel
+		go cm.verifyBlobs(ctx, opt.VerifyInterval)
+	}
+	if opt.MinFreeSpace > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		cm.stopFreeSpace = cancel
+		go cm.monitorFreeSpace(ctx, freeSpaceInterval)
+	}
+
 	return cm, nil
 }
 
@@ -257,6 +335,7 @@ func (cm *cacheManager) GetByBlob(ctx context.Context, desc ocispecs.Descriptor,
 	queueBlobOnly(rec.md, blobOnly)
 	queueMediaType(rec.md, desc.MediaType)
 	queueBlobSize(rec.md, desc.Size)
+	queueURLs(rec.md, desc.URLs)
 	queueCommitted(rec.md)
 
 	if err := rec.md.Commit(); err != nil {
@@ -295,6 +374,12 @@ func (cm *cacheManager) IdentityMapping() *idtools.IdentityMapping {
 // method should be called after Close.
 func (cm *cacheManager) Close() error {
 	// TODO: allocate internal context and cancel it here
+	if cm.stopVerify != nil {
+		cm.stopVerify()
+	}
+	if cm.stopFreeSpace != nil {
+		cm.stopFreeSpace()
+	}
 	return cm.md.Close()
 }
 
@@ -340,7 +425,7 @@ func (cm *cacheManager) get(ctx context.Context, id string, opts ...RefOption) (
 		if rec.equalImmutable != nil {
 			return rec.equalImmutable.ref(triggerUpdate, descHandlers), nil
 		}
-		return rec.mref(triggerUpdate, descHandlers).commit(ctx)
+		return rec.mref(triggerUpdate, descHandlers).commit(ctx, sizeUnknown)
 	}
 
 	return rec.ref(triggerUpdate, descHandlers), nil
@@ -461,6 +546,17 @@ func (cm *cacheManager) getRecord(ctx context.Context, id string, opts ...RefOpt
 }
 
 func (cm *cacheManager) New(ctx context.Context, s ImmutableRef, sess session.Group, opts ...RefOption) (mr MutableRef, err error) {
+	if err := cm.checkFreeSpace(ctx); err != nil {
+		return nil, err
+	}
+
+	cm.mu.Lock()
+	err = cm.checkRecordLimit()
+	cm.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
 	id := identity.NewID()
 
 	var parent *immutableRef
@@ -650,6 +746,7 @@ func (cm *cacheManager) pruneOnce(ctx context.Context, ch chan client.UsageInfo,
 
 	return cm.prune(ctx, ch, pruneOpt{
 		filter:       filter,
+		cascade:      len(opt.Filter) > 0 && opt.KeepBytes == 0,
 		all:          opt.All,
 		checkShared:  check,
 		keepDuration: opt.KeepDuration,
@@ -660,6 +757,7 @@ func (cm *cacheManager) pruneOnce(ctx context.Context, ch chan client.UsageInfo,
 
 func (cm *cacheManager) prune(ctx context.Context, ch chan client.UsageInfo, opt pruneOpt) error {
 	var toDelete []*deleteRecord
+	var variants []*deleteVariant
 
 	if opt.keepBytes != 0 && opt.totalSize < opt.keepBytes {
 		return nil
@@ -708,10 +806,14 @@ func (cm *cacheManager) prune(ctx context.Context, ch chan client.UsageInfo, opt
 			}
 
 			c := &client.UsageInfo{
-				ID:         cr.ID(),
-				Mutable:    cr.mutable,
-				RecordType: recordType,
-				Shared:     shared,
+				ID:          cr.ID(),
+				Mutable:     cr.mutable,
+				RecordType:  recordType,
+				Shared:      shared,
+				Description: GetDescription(cr.md),
+			}
+			if cr.parent != nil {
+				c.Parent = cr.parent.ID()
 			}
 
 			usageCount, lastUsedAt := getLastUsed(cr.md)
@@ -725,7 +827,7 @@ func (cm *cacheManager) prune(ctx context.Context, ch chan client.UsageInfo, opt
 				}
 			}
 
-			if opt.filter.Match(adaptUsageInfo(c)) {
+			if opt.filter.Match(adaptUsageInfo(c, getOrigin(cr.md))) || opt.cascade && matchesParent(cr, opt.filter) {
 				toDelete = append(toDelete, &deleteRecord{
 					cacheRecord: cr,
 					lastUsedAt:  c.LastUsedAt,
@@ -744,11 +846,45 @@ func (cm *cacheManager) prune(ctx context.Context, ch chan client.UsageInfo, opt
 					locked[cr.mu] = struct{}{}
 					continue // leave the record locked
 				}
+			} else if !gcMode && !cr.mutable {
+				// the compression variants of the layer can be pruned
+				// without the record
+				for _, t := range sortedCompressionVariants(cr) {
+					ct, err := compression.Parse(t)
+					if err != nil {
+						continue
+					}
+					vc := compressionVariantUsage(c, t)
+					if opt.filter.Match(adaptUsageInfo(vc, getOrigin(cr.md))) {
+						if dgst, err := digest.Parse(getCompressionVariants(cr.md)[t]); err == nil {
+							if info, err := cm.ContentStore.Info(ctx, dgst); err == nil {
+								vc.Size = info.Size
+							}
+						}
+						variants = append(variants, &deleteVariant{cr: cr, compressionType: ct, info: vc})
+					}
+				}
 			}
 		}
 		cr.mu.Unlock()
 	}
 
+	if len(variants) > 0 {
+		cm.mu.Unlock()
+		for _, v := range variants {
+			if err := v.cr.removeCompressionVariant(ctx, v.compressionType); err != nil {
+				if errors.Is(err, errdefs.ErrNotFound) {
+					continue
+				}
+				return err
+			}
+			if ch != nil {
+				ch <- *v.info
+			}
+		}
+		cm.mu.Lock()
+	}
+
 	if gcMode && len(toDelete) > 0 {
 		sortDeleteRecords(toDelete)
 		var err error
@@ -871,6 +1007,44 @@ func (cm *cacheManager) markShared(m map[string]*cacheUsageInfo) error {
 	return nil
 }
 
+// deleteVariant is a compression variant of a record that is pruned
+type deleteVariant struct {
+	cr              *cacheRecord
+	compressionType compression.Type
+	info            *client.UsageInfo
+}
+
+// sortedCompressionVariants returns the compression types of the variants of
+// the layer of cr other than its blob
+func sortedCompressionVariants(cr *cacheRecord) []string {
+	blob := getBlob(cr.md)
+	var types []string
+	for t, dgst := range getCompressionVariants(cr.md) {
+		if dgst != blob {
+			types = append(types, t)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// compressionVariantUsage returns the usage of the compression variant t of
+// the record of info. Its ID is the ID of the record with the compression
+// type, e.g. <id>@zstd.
+func compressionVariantUsage(info *client.UsageInfo, t string) *client.UsageInfo {
+	return &client.UsageInfo{
+		ID:          info.ID + "@" + t,
+		InUse:       info.InUse,
+		Parent:      info.ID,
+		CreatedAt:   info.CreatedAt,
+		LastUsedAt:  info.LastUsedAt,
+		UsageCount:  info.UsageCount,
+		Description: t + " blob of " + info.ID,
+		RecordType:  client.UsageRecordTypeCompressionVariant,
+		Shared:      info.Shared,
+	}
+}
+
 type cacheUsageInfo struct {
 	refs        int
 	parent      string
@@ -880,10 +1054,13 @@ type cacheUsageInfo struct {
 	usageCount  int
 	lastUsedAt  *time.Time
 	description string
+	origin      origin
 	doubleRef   bool
 	recordType  client.UsageRecordType
 	shared      bool
 	parentChain []digest.Digest
+	// variants are the compression variants of the layer by type
+	variants map[string]digest.Digest
 }
 
 func (cm *cacheManager) DiskUsage(ctx context.Context, opt client.DiskUsageInfo) ([]*client.UsageInfo, error) {
@@ -914,6 +1091,7 @@ func (cm *cacheManager) DiskUsage(ctx context.Context, opt client.DiskUsageInfo)
 			usageCount:  usageCount,
 			lastUsedAt:  lastUsedAt,
 			description: GetDescription(cr.md),
+			origin:      getOrigin(cr.md),
 			doubleRef:   cr.equalImmutable != nil,
 			recordType:  GetRecordType(cr),
 			parentChain: cr.parentChain(),
@@ -927,6 +1105,16 @@ func (cm *cacheManager) DiskUsage(ctx context.Context, opt client.DiskUsageInfo)
 		if cr.mutable && c.refs > 0 {
 			c.size = 0 // size can not be determined because it is changing
 		}
+		if !cr.mutable {
+			for _, t := range sortedCompressionVariants(cr) {
+				if dgst, err := digest.Parse(getCompressionVariants(cr.md)[t]); err == nil {
+					if c.variants == nil {
+						c.variants = map[string]digest.Digest{}
+					}
+					c.variants[t] = dgst
+				}
+			}
+		}
 		m[id] = c
 		rescan[id] = struct{}{}
 		cr.mu.Unlock()
@@ -969,23 +1157,36 @@ func (cm *cacheManager) DiskUsage(ctx context.Context, opt client.DiskUsageInfo)
 			RecordType:  cr.recordType,
 			Shared:      cr.shared,
 		}
-		if filter.Match(adaptUsageInfo(c)) {
+		if filter.Match(adaptUsageInfo(c, cr.origin)) {
 			du = append(du, c)
 		}
+		for t, dgst := range cr.variants {
+			vc := compressionVariantUsage(c, t)
+			if info, err := cm.ContentStore.Info(ctx, dgst); err == nil {
+				vc.Size = info.Size
+			} else {
+				// the blob was removed by garbage collection
+				delete(cr.variants, t)
+				continue
+			}
+			if filter.Match(adaptUsageInfo(vc, cr.origin)) {
+				du = append(du, vc)
+			}
+		}
 	}
 
-	eg, ctx := errgroup.WithContext(ctx)
+	eg, egCtx := errgroup.WithContext(ctx)
 
 	for _, d := range du {
 		if d.Size == sizeUnknown {
 			func(d *client.UsageInfo) {
 				eg.Go(func() error {
-					ref, err := cm.Get(ctx, d.ID, NoUpdateLastUsed)
+					ref, err := cm.Get(egCtx, d.ID, NoUpdateLastUsed)
 					if err != nil {
 						d.Size = 0
 						return nil
 					}
-					s, err := ref.Size(ctx)
+					s, err := ref.Size(egCtx)
 					if err != nil {
 						return err
 					}
@@ -1000,6 +1201,25 @@ func (cm *cacheManager) DiskUsage(ctx context.Context, opt client.DiskUsageInfo)
 		return du, err
 	}
 
+	// the size of a record includes the blobs of its compression variants,
+	// which are listed separately
+	for _, d := range du {
+		cr, ok := m[d.ID]
+		if !ok || d.RecordType == client.UsageRecordTypeCompressionVariant {
+			continue
+		}
+		counted := map[digest.Digest]struct{}{}
+		for _, dgst := range cr.variants {
+			if _, ok := counted[dgst]; ok {
+				continue
+			}
+			counted[dgst] = struct{}{}
+			if info, err := cm.ContentStore.Info(ctx, dgst); err == nil && d.Size >= info.Size {
+				d.Size -= info.Size
+			}
+		}
+	}
+
 	return du, nil
 }
 
@@ -1104,7 +1324,28 @@ func initializeMetadata(m withMetadata, parent string, opts ...RefOption) error
 	return md.Commit()
 }
 
-func adaptUsageInfo(info *client.UsageInfo) filters.Adaptor {
+// matchesParent returns true if one of the parents of cr matches filter
+func matchesParent(cr *cacheRecord, filter filters.Filter) bool {
+	for p := cr.parent; p != nil; p = p.parent {
+		info := &client.UsageInfo{
+			ID:          p.ID(),
+			RecordType:  GetRecordType(p),
+			Description: GetDescription(p.md),
+		}
+		if info.RecordType == "" {
+			info.RecordType = client.UsageRecordTypeRegular
+		}
+		if p.parent != nil {
+			info.Parent = p.parent.ID()
+		}
+		if filter.Match(adaptUsageInfo(info, getOrigin(p.md))) {
+			return true
+		}
+	}
+	return false
+}
+
+func adaptUsageInfo(info *client.UsageInfo, o origin) filters.Adaptor {
 	return filters.AdapterFunc(func(fieldpath []string) (string, bool) {
 		if len(fieldpath) == 0 {
 			return "", false
@@ -1125,6 +1366,10 @@ func adaptUsageInfo(info *client.UsageInfo) filters.Adaptor {
 			return "", !info.Mutable
 		case "type":
 			return string(info.RecordType), info.RecordType != ""
+		case "optype":
+			return o.OpType, o.OpType != ""
+		case "source":
+			return o.Source, o.Source != ""
 		case "shared":
 			return "", info.Shared
 		case "private":
@@ -1138,7 +1383,10 @@ func adaptUsageInfo(info *client.UsageInfo) filters.Adaptor {
 }
 
 type pruneOpt struct {
-	filter       filters.Filter
+	filter filters.Filter
+	// cascade prunes the records that depend on the records matching
+	// filter too, as the records can't be pruned while they have children
+	cascade      bool
 	all          bool
 	checkShared  ExternalRefChecker
 	keepDuration time.Duration
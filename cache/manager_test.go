@@ -10,11 +10,16 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/content/local"
 	"github.com/containerd/containerd/diff/apply"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/filters"
+	"github.com/containerd/containerd/images"
 	"github.com/containerd/containerd/leases"
 	ctdmetadata "github.com/containerd/containerd/metadata"
 	"github.com/containerd/containerd/namespaces"
@@ -24,6 +29,8 @@ import (
 	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/snapshot"
 	containerdsnapshot "github.com/moby/buildkit/snapshot/containerd"
+	serrdefs "github.com/moby/buildkit/solver/errdefs"
+	"github.com/moby/buildkit/util/compression"
 	"github.com/moby/buildkit/util/leaseutil"
 	digest "github.com/opencontainers/go-digest"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
@@ -36,6 +43,11 @@ type cmOpt struct {
 	snapshotterName string
 	snapshotter     snapshots.Snapshotter
 	tmpdir          string
+	maxRecords      int
+	maxRecordSize   int64
+	finalizePolicy  FinalizePolicy
+	minFreeSpace    int64
+	gcPolicy        []client.PruneInfo
 }
 
 type cmOut struct {
@@ -125,6 +137,12 @@ func newCacheManager(ctx context.Context, opt cmOpt) (co *cmOut, cleanup func()
 		LeaseManager:   leaseutil.WithNamespace(lm, ns),
 		GarbageCollect: mdb.GarbageCollect,
 		Applier:        apply.NewFileSystemApplier(mdb.ContentStore()),
+		MaxRecords:     opt.maxRecords,
+		MaxRecordSize:  opt.maxRecordSize,
+		FinalizePolicy: opt.finalizePolicy,
+		MinFreeSpace:   opt.minFreeSpace,
+		FreeSpacePaths: []string{tmpdir},
+		GCPolicy:       opt.gcPolicy,
 	})
 	if err != nil {
 		return nil, nil, err
@@ -269,6 +287,407 @@ func TestManager(t *testing.T) {
 	require.Equal(t, 0, len(dirs))
 }
 
+func TestFinalizePolicy(t *testing.T) {
+	t.Parallel()
+
+	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
+
+	co, cleanup, err := newCacheManager(ctx, cmOpt{})
+	require.NoError(t, err)
+	defer cleanup()
+	cm := co.manager
+
+	active, err := cm.New(ctx, nil, nil)
+	require.NoError(t, err)
+	snap, err := active.Commit(ctx)
+	require.NoError(t, err)
+	require.False(t, snap.Finalized())
+	require.NoError(t, snap.Finalize(ctx))
+	require.True(t, snap.Finalized())
+	require.NoError(t, snap.Finalize(ctx))
+	require.NoError(t, snap.Release(ctx))
+
+	_, err = cm.GetMutable(ctx, active.ID())
+	require.True(t, errors.Is(err, errNotFound))
+
+	co, cleanup2, err := newCacheManager(ctx, cmOpt{finalizePolicy: FinalizeEager})
+	require.NoError(t, err)
+	defer cleanup2()
+	cm = co.manager
+
+	active, err = cm.New(ctx, nil, nil)
+	require.NoError(t, err)
+	snap, err = active.Commit(ctx)
+	require.NoError(t, err)
+	require.True(t, snap.Finalized())
+	require.NoError(t, snap.Release(ctx))
+
+	_, err = cm.GetMutable(ctx, active.ID())
+	require.True(t, errors.Is(err, errNotFound))
+
+	_, err = ParseFinalizePolicy("sometimes")
+	require.Error(t, err)
+}
+
+func TestMinFreeSpace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("free space isn't checked on Windows")
+	}
+	t.Parallel()
+
+	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
+
+	// no filesystem has this much free space
+	co, cleanup, err := newCacheManager(ctx, cmOpt{
+		minFreeSpace: 1 << 62,
+		gcPolicy:     []client.PruneInfo{{All: true}},
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	cm := co.manager
+
+	_, err = cm.New(ctx, nil, nil)
+	require.Error(t, err)
+	var storageErr *InsufficientStorageError
+	require.True(t, errors.As(err, &storageErr))
+	require.Equal(t, int64(1<<62), storageErr.Limit)
+	require.Equal(t, serrdefs.CodeDiskFull, serrdefs.GetCode(err))
+
+	co, cleanup2, err := newCacheManager(ctx, cmOpt{
+		minFreeSpace: 1,
+		gcPolicy:     []client.PruneInfo{{All: true}},
+	})
+	require.NoError(t, err)
+	defer cleanup2()
+	cm = co.manager
+
+	active, err := cm.New(ctx, nil, nil, CachePolicyRetain)
+	require.NoError(t, err)
+	snap, err := active.Commit(ctx)
+	require.NoError(t, err)
+	require.NoError(t, snap.Release(ctx))
+
+	// the cache is pruned when the free space gets low between records
+	du, err := cm.DiskUsage(ctx, client.DiskUsageInfo{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(du))
+	cm.(*cacheManager).MinFreeSpace = 1 << 62
+	mctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go cm.(*cacheManager).monitorFreeSpace(mctx, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		du, err := cm.DiskUsage(ctx, client.DiskUsageInfo{})
+		return err == nil && len(du) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNextFreeSpaceInterval(t *testing.T) {
+	t.Parallel()
+	storageErr := errors.WithStack(&InsufficientStorageError{Path: "/", Free: 1, Limit: 2})
+	require.Equal(t, time.Second, nextFreeSpaceInterval(time.Second, time.Second, nil))
+	require.Equal(t, 2*time.Second, nextFreeSpaceInterval(time.Second, time.Second, storageErr))
+	require.Equal(t, maxFreeSpaceInterval, nextFreeSpaceInterval(4*time.Minute, time.Second, storageErr))
+	// the interval is reset when enough space is free
+	require.Equal(t, time.Second, nextFreeSpaceInterval(time.Minute, time.Second, nil))
+	// other errors, e.g. of pruning, don't back off
+	require.Equal(t, time.Second, nextFreeSpaceInterval(time.Minute, time.Second, errors.New("failed to prune")))
+}
+
+func TestRecordLimits(t *testing.T) {
+	t.Parallel()
+
+	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
+
+	co, cleanup, err := newCacheManager(ctx, cmOpt{
+		maxRecords:    2,
+		maxRecordSize: 64 * 1024,
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	cm := co.manager
+
+	active, err := cm.New(ctx, nil, nil, WithDescription("big"))
+	require.NoError(t, err)
+
+	m, err := active.Mount(ctx, false, nil)
+	require.NoError(t, err)
+	lm := snapshot.LocalMounter(m)
+	target, err := lm.Mount()
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(target, "foo"), bytes.Repeat([]byte{'a'}, 128*1024), 0644)
+	require.NoError(t, err)
+	require.NoError(t, lm.Unmount())
+
+	_, err = active.Commit(ctx)
+	require.Error(t, err)
+	var sizeErr *RecordSizeError
+	require.True(t, errors.As(err, &sizeErr))
+	require.Equal(t, int64(64*1024), sizeErr.Limit)
+	require.Contains(t, err.Error(), `"big"`)
+	require.NoError(t, active.Release(ctx))
+
+	active, err = cm.New(ctx, nil, nil)
+	require.NoError(t, err)
+	snap, err := active.Commit(ctx)
+	require.NoError(t, err)
+
+	_, err = cm.New(ctx, nil, nil)
+	require.Error(t, err)
+	var limitErr *RecordLimitError
+	require.True(t, errors.As(err, &limitErr))
+	require.Equal(t, 2, limitErr.Count)
+
+	require.NoError(t, snap.Release(ctx))
+	buf := pruneResultBuffer()
+	require.NoError(t, cm.Prune(ctx, buf.C, client.PruneInfo{}))
+	buf.close()
+
+	active, err = cm.New(ctx, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, active.Release(ctx))
+}
+
+func TestLimitSize(t *testing.T) {
+	t.Parallel()
+
+	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
+
+	co, cleanup, err := newCacheManager(ctx, cmOpt{
+		maxRecordSize: 64 * 1024,
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	cm := co.manager
+
+	active, err := cm.New(ctx, nil, nil, WithDescription("big"))
+	require.NoError(t, err)
+	defer active.Release(ctx)
+
+	// the step is canceled while it writes to the ref
+	err = limitSize(ctx, []MutableRef{active}, 10*time.Millisecond, func(ctx context.Context) error {
+		m, err := active.Mount(ctx, false, nil)
+		if err != nil {
+			return err
+		}
+		lm := snapshot.LocalMounter(m)
+		target, err := lm.Mount()
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(target, "foo"), bytes.Repeat([]byte{'a'}, 128*1024), 0644)
+		lm.Unmount()
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Second):
+			return errors.New("step wasn't canceled")
+		}
+	})
+	var sizeErr *RecordSizeError
+	require.True(t, errors.As(err, &sizeErr), "%v", err)
+	require.Contains(t, err.Error(), `"big"`)
+
+	// the size measured for the commit is the size of the record
+	small, err := cm.New(ctx, nil, nil)
+	require.NoError(t, err)
+	err = limitSize(ctx, []MutableRef{small}, 10*time.Millisecond, func(ctx context.Context) error {
+		return nil
+	})
+	require.NoError(t, err)
+	snap, err := small.Commit(ctx)
+	require.NoError(t, err)
+	defer snap.Release(ctx)
+	require.NotEqual(t, sizeUnknown, getSize(snap.Metadata()))
+}
+
+func TestCompressionVariants(t *testing.T) {
+	t.Parallel()
+	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
+
+	tmpdir, err := ioutil.TempDir("", "cachemanager")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
+	require.NoError(t, err)
+
+	co, cleanup, err := newCacheManager(ctx, cmOpt{
+		snapshotter:     snapshotter,
+		snapshotterName: "native",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	cm := co.manager
+
+	b, desc, err := mapToBlob(map[string]string{"foo": "bar"}, true)
+	require.NoError(t, err)
+
+	leaseCtx, done, err := leaseutil.WithLease(ctx, co.lm, leaseutil.MakeTemporary)
+	require.NoError(t, err)
+	require.NoError(t, content.WriteBlob(leaseCtx, co.cs, "ref1", bytes.NewBuffer(b), desc))
+	ref, err := cm.GetByBlob(leaseCtx, desc, nil)
+	require.NoError(t, err)
+	sr := ref.(*immutableRef)
+
+	variants, err := ref.CompressionVariants(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(variants))
+
+	require.NoError(t, ensureCompression(leaseCtx, sr, desc, compression.New(compression.Zstd), nil))
+	require.NoError(t, ensureCompression(leaseCtx, sr, desc, compression.New(compression.Uncompressed), nil))
+	require.NoError(t, done(ctx))
+
+	variants, err = ref.CompressionVariants(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(variants))
+	require.Equal(t, compression.Uncompressed, variants[0].Type)
+	require.Equal(t, digest.Digest(desc.Annotations["containerd.io/uncompressed"]), variants[0].Digest)
+	require.Equal(t, compression.Zstd, variants[1].Type)
+
+	size, err := ref.Size(ctx)
+	require.NoError(t, err)
+	require.Equal(t, desc.Size+variants[0].Size+variants[1].Size, size)
+
+	// the variants are kept by the ref
+	_, err = co.manager.(*cacheManager).GarbageCollect(ctx)
+	require.NoError(t, err)
+	for _, v := range variants {
+		_, err := co.cs.Info(ctx, v.Digest)
+		require.NoError(t, err)
+	}
+	info, err := sr.getCompressionBlob(ctx, compression.New(compression.Zstd))
+	require.NoError(t, err)
+	require.Equal(t, variants[1].Digest, info.Digest)
+
+	require.NoError(t, ref.RemoveCompressionVariant(ctx, compression.Zstd))
+	err = ref.RemoveCompressionVariant(ctx, compression.Zstd)
+	require.True(t, errors.Is(err, errdefs.ErrNotFound))
+
+	variants2, err := ref.CompressionVariants(ctx)
+	require.NoError(t, err)
+	require.Equal(t, variants[:1], variants2)
+	require.Equal(t, sizeUnknown, getSize(sr.md))
+
+	_, err = co.manager.(*cacheManager).GarbageCollect(ctx)
+	require.NoError(t, err)
+	_, err = co.cs.Info(ctx, variants[1].Digest)
+	require.True(t, errors.Is(err, errdefs.ErrNotFound))
+	_, err = co.cs.Info(ctx, variants[0].Digest)
+	require.NoError(t, err)
+
+	// the blob no longer points to the removed variant
+	blobInfo, err := co.cs.Info(ctx, desc.Digest)
+	require.NoError(t, err)
+	require.NotContains(t, blobInfo.Labels, compressionVariantDigestLabel(compression.Zstd))
+	require.Contains(t, blobInfo.Labels, compressionVariantDigestLabel(compression.Uncompressed))
+
+	// the variants are listed and pruned separately from their record. The
+	// size of the record may be read from the calculation before the removal
+	// until it has been released.
+	var du []*client.UsageInfo
+	require.Eventually(t, func() bool {
+		du, err = cm.DiskUsage(ctx, client.DiskUsageInfo{})
+		require.NoError(t, err)
+		require.Equal(t, 2, len(du))
+		for _, d := range du {
+			if d.ID == ref.ID() {
+				return d.Size == desc.Size
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+	for _, d := range du {
+		if d.ID == ref.ID() {
+			continue
+		}
+		require.Equal(t, ref.ID()+"@uncompressed", d.ID)
+		require.Equal(t, ref.ID(), d.Parent)
+		require.Equal(t, client.UsageRecordTypeCompressionVariant, d.RecordType)
+		require.Equal(t, variants[0].Size, d.Size)
+		require.True(t, d.InUse)
+	}
+
+	require.NoError(t, ref.Release(ctx))
+
+	ch := make(chan client.UsageInfo, 10)
+	require.NoError(t, cm.Prune(ctx, ch, client.PruneInfo{Filter: []string{"type==compression.variant"}}))
+	close(ch)
+	var pruned []string
+	for d := range ch {
+		pruned = append(pruned, d.ID)
+	}
+	require.Equal(t, []string{ref.ID() + "@uncompressed"}, pruned)
+
+	require.Eventually(t, func() bool {
+		du, err = cm.DiskUsage(ctx, client.DiskUsageInfo{})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(du))
+		require.Equal(t, ref.ID(), du[0].ID)
+		return du[0].Size == desc.Size
+	}, time.Second, 10*time.Millisecond)
+	_, err = co.cs.Info(ctx, variants[0].Digest)
+	require.True(t, errors.Is(err, errdefs.ErrNotFound))
+}
+
+func TestCompressionVariantLevel(t *testing.T) {
+	t.Parallel()
+	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
+	tmpdir := t.TempDir()
+
+	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
+	require.NoError(t, err)
+	co, cleanup, err := newCacheManager(ctx, cmOpt{
+		tmpdir:          tmpdir,
+		snapshotter:     snapshotter,
+		snapshotterName: "native",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+
+	b, desc, err := mapToBlob(map[string]string{"foo": "bar"}, false)
+	require.NoError(t, err)
+	leaseCtx, done, err := leaseutil.WithLease(ctx, co.lm, leaseutil.MakeTemporary)
+	require.NoError(t, err)
+	require.NoError(t, content.WriteBlob(leaseCtx, co.cs, "ref1", bytes.NewBuffer(b), desc))
+	ref, err := co.manager.GetByBlob(leaseCtx, desc, nil)
+	require.NoError(t, err)
+	defer ref.Release(ctx)
+	sr := ref.(*immutableRef)
+
+	withLevel := func(level int) compression.Config {
+		return compression.Config{Type: compression.Gzip, Level: &level}
+	}
+	require.NoError(t, ensureCompression(leaseCtx, sr, desc, withLevel(1), nil))
+	info1, err := sr.getCompressionBlob(ctx, withLevel(1))
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"gzip": 1}, getCompressionVariantLevels(sr.md))
+
+	// the variant is reused without a level and converted again for
+	// another level
+	_, err = sr.getCompressionBlob(ctx, compression.New(compression.Gzip))
+	require.NoError(t, err)
+	_, err = sr.getCompressionBlob(ctx, withLevel(9))
+	require.True(t, errors.Is(err, errdefs.ErrNotFound))
+	require.NoError(t, ensureCompression(leaseCtx, sr, desc, withLevel(9), nil))
+	info9, err := sr.getCompressionBlob(ctx, withLevel(9))
+	require.NoError(t, err)
+	require.NotEqual(t, info1.Digest, info9.Digest)
+	require.Equal(t, "9", info9.Labels[compressionLevelLabel])
+	require.Equal(t, map[string]int{"gzip": 9}, getCompressionVariantLevels(sr.md))
+
+	// the variant of the previous level is released
+	require.NoError(t, done(ctx))
+	_, err = co.manager.(*cacheManager).GarbageCollect(ctx)
+	require.NoError(t, err)
+	_, err = co.cs.Info(ctx, info1.Digest)
+	require.True(t, errors.Is(err, errdefs.ErrNotFound))
+	_, err = co.cs.Info(ctx, info9.Digest)
+	require.NoError(t, err)
+}
+
 func TestLazyGetByBlob(t *testing.T) {
 	t.Parallel()
 	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
@@ -314,6 +733,46 @@ func TestLazyGetByBlob(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestNonDistributableBlob(t *testing.T) {
+	t.Parallel()
+	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
+
+	tmpdir, err := ioutil.TempDir("", "cachemanager")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
+	require.NoError(t, err)
+
+	co, cleanup, err := newCacheManager(ctx, cmOpt{
+		snapshotter:     snapshotter,
+		snapshotterName: "native",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	cm := co.manager
+
+	// Windows base layers are never pulled for exporting, they are referenced
+	// by their URLs and are not converted to other compressions
+	_, desc, err := mapToBlob(map[string]string{"foo": "bar"}, true)
+	require.NoError(t, err)
+	desc.MediaType = images.MediaTypeDockerSchema2LayerForeignGzip
+	desc.URLs = []string{"https://example.com/layer"}
+	descHandlers := DescHandlers(make(map[digest.Digest]*DescHandler))
+	descHandlers[desc.Digest] = &DescHandler{}
+
+	ref, err := cm.GetByBlob(ctx, desc, nil, descHandlers)
+	require.NoError(t, err)
+	defer ref.Release(ctx)
+
+	remote, err := ref.(*immutableRef).GetRemote(ctx, false, compression.Config{Type: compression.Zstd, Force: true}, nil)
+	require.NoError(t, err)
+	require.Len(t, remote.Descriptors, 1)
+	require.Equal(t, desc.Digest, remote.Descriptors[0].Digest)
+	require.Equal(t, images.MediaTypeDockerSchema2LayerForeignGzip, remote.Descriptors[0].MediaType)
+	require.Equal(t, desc.URLs, remote.Descriptors[0].URLs)
+}
+
 func TestSnapshotExtract(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("Depends on unimplemented containerd bind-mount support on Windows")
@@ -843,6 +1302,108 @@ func TestPrune(t *testing.T) {
 	require.Equal(t, 0, len(dirs))
 }
 
+func TestVerifyBlobs(t *testing.T) {
+	t.Parallel()
+	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
+
+	tmpdir, err := ioutil.TempDir("", "cachemanager")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	co, cleanup, err := newCacheManager(ctx, cmOpt{
+		tmpdir: tmpdir,
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	cm := co.manager
+
+	b, desc, err := mapToBlob(map[string]string{"foo": "bar"}, true)
+	require.NoError(t, err)
+	err = content.WriteBlob(ctx, co.cs, "ref1", bytes.NewBuffer(b), desc)
+	require.NoError(t, err)
+	snap, err := cm.GetByBlob(ctx, desc, nil)
+	require.NoError(t, err)
+
+	b2, desc2, err := mapToBlob(map[string]string{"foo": "bar123"}, true)
+	require.NoError(t, err)
+	err = content.WriteBlob(ctx, co.cs, "ref2", bytes.NewBuffer(b2), desc2)
+	require.NoError(t, err)
+	snap2, err := cm.GetByBlob(ctx, desc2, snap)
+	require.NoError(t, err)
+
+	info, err := cm.VerifyBlobs(ctx, false)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), info.Checked)
+	require.Len(t, info.Corrupt, 0)
+
+	// flip a byte of the first layer
+	p := filepath.Join(tmpdir, "blobs", desc.Digest.Algorithm().String(), desc.Digest.Hex())
+	require.NoError(t, os.Chmod(p, 0644))
+	b[len(b)-1] ^= 0xff
+	require.NoError(t, ioutil.WriteFile(p, b, 0644))
+
+	// the child is reported too, as it can't be exported without the blob
+	info, err = cm.VerifyBlobs(ctx, true)
+	require.NoError(t, err)
+	require.Len(t, info.Corrupt, 1)
+	require.Equal(t, desc.Digest, info.Corrupt[0].Digest)
+	expected := []string{snap.ID(), snap2.ID()}
+	sort.Strings(expected)
+	require.Equal(t, expected, info.Corrupt[0].Records)
+	require.False(t, info.Corrupt[0].Evicted)
+	checkNumBlobs(ctx, t, co.cs, 2)
+
+	// the child has the corrupt layer in its chain and is pruned, the
+	// record in use is kept
+	id2 := snap2.ID()
+	require.NoError(t, snap2.Release(ctx))
+	info, err = cm.VerifyBlobs(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, info.Corrupt, 1)
+	require.True(t, info.Corrupt[0].Evicted)
+	checkDiskUsage(ctx, t, cm, 1, 0)
+	_, err = cm.Get(ctx, id2)
+	require.Error(t, err)
+	_, err = co.cs.Info(ctx, desc.Digest)
+	require.True(t, errors.Is(err, errdefs.ErrNotFound))
+
+	// the record in use wasn't extracted and fetches the blob again
+	lazy, err := snap.(*immutableRef).isLazy(ctx)
+	require.NoError(t, err)
+	require.True(t, lazy)
+	require.NoError(t, snap.Release(ctx))
+
+	// the blob of an extracted record is created again from the snapshot
+	active, err := cm.New(ctx, nil, nil)
+	require.NoError(t, err)
+	snap3, err := active.Commit(ctx)
+	require.NoError(t, err)
+	b3, desc3, err := mapToBlob(map[string]string{"foo": "baz"}, true)
+	require.NoError(t, err)
+	err = content.WriteBlob(ctx, co.cs, "ref3", bytes.NewBuffer(b3), desc3)
+	require.NoError(t, err)
+	leaseCtx, done, err := leaseutil.WithLease(ctx, co.lm, leaseutil.MakeTemporary)
+	require.NoError(t, err)
+	require.NoError(t, snap3.(*immutableRef).setBlob(leaseCtx, desc3))
+	require.NoError(t, done(ctx))
+	require.Equal(t, desc3.Digest, snap3.Info().Blob)
+
+	p = filepath.Join(tmpdir, "blobs", desc3.Digest.Algorithm().String(), desc3.Digest.Hex())
+	require.NoError(t, os.Chmod(p, 0644))
+	b3[len(b3)-1] ^= 0xff
+	require.NoError(t, ioutil.WriteFile(p, b3, 0644))
+
+	info, err = cm.VerifyBlobs(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, info.Corrupt, 1)
+	require.Equal(t, []string{snap3.ID()}, info.Corrupt[0].Records)
+	refInfo := snap3.Info()
+	require.Equal(t, digest.Digest(""), refInfo.Blob)
+	require.Equal(t, digest.Digest(""), refInfo.ChainID)
+	require.Equal(t, digest.Digest(""), refInfo.BlobChainID)
+	require.NoError(t, snap3.Release(ctx))
+}
+
 func TestLazyCommit(t *testing.T) {
 	t.Parallel()
 
@@ -1093,3 +1654,94 @@ func mapToBlob(m map[string]string, compress bool) ([]byte, ocispecs.Descriptor,
 		},
 	}, nil
 }
+
+func TestUsageFilters(t *testing.T) {
+	t.Parallel()
+
+	type record struct {
+		info   *client.UsageInfo
+		origin origin
+	}
+	records := []record{
+		{&client.UsageInfo{ID: "exec", Description: "mount / from exec /bin/sh -c apt-get update", RecordType: client.UsageRecordTypeRegular}, origin{OpType: OpTypeExec}},
+		{&client.UsageInfo{ID: "file", Description: "fileop target", RecordType: client.UsageRecordTypeRegular}, origin{OpType: OpTypeFile}},
+		{&client.UsageInfo{ID: "image", Description: "pulled from docker.io/library/alpine:latest@sha256:abcd", RecordType: client.UsageRecordTypeRegular}, origin{OpType: OpTypeImage, Source: "docker.io/library/alpine:latest@sha256:abcd"}},
+		{&client.UsageInfo{ID: "git", Description: "git snapshot for https://github.com/moby/buildkit.git#main", RecordType: client.UsageRecordTypeGitCheckout}, origin{OpType: OpTypeGit, Source: "https://github.com/moby/buildkit.git#main"}},
+		{&client.UsageInfo{ID: "http", Description: "http url https://example.com/foo.tar", RecordType: client.UsageRecordTypeRegular}, origin{OpType: OpTypeHTTP, Source: "https://example.com/foo.tar"}},
+		{&client.UsageInfo{ID: "local", Description: "local source for context", RecordType: client.UsageRecordTypeLocalSource}, origin{OpType: OpTypeLocal, Source: "context"}},
+		{&client.UsageInfo{ID: "cachemount", Description: "cached mount /var/cache/apt from exec apt-get update", RecordType: client.UsageRecordTypeCacheMount}, origin{OpType: OpTypeCacheMount}},
+		// imported records have no origin
+		{&client.UsageInfo{ID: "imported", Description: "mount / from exec /bin/sh -c true", RecordType: client.UsageRecordTypeRegular}, origin{}},
+	}
+
+	match := func(fs ...string) []string {
+		f, err := filters.ParseAll(fs...)
+		require.NoError(t, err)
+		var ids []string
+		for _, r := range records {
+			if f.Match(adaptUsageInfo(r.info, r.origin)) {
+				ids = append(ids, r.info.ID)
+			}
+		}
+		return ids
+	}
+
+	require.Equal(t, []string{"exec", "cachemount"}, match(`description~="apt-get update"`))
+	require.Equal(t, []string{"exec"}, match("optype==exec"))
+	require.Equal(t, []string{"file"}, match("optype==file"))
+	require.Equal(t, []string{"cachemount"}, match("optype==cachemount"))
+	require.Equal(t, []string{"image"}, match("optype==image,source~=alpine"))
+	require.Equal(t, []string{"git"}, match("source~=github.com/moby/buildkit"))
+	require.Equal(t, []string{"http"}, match("source==https://example.com/foo.tar"))
+	require.Equal(t, []string{"local"}, match("optype==local", "source==context"))
+	require.Equal(t, []string{"git", "local", "cachemount", "imported"}, match("optype!=exec,optype!=file,optype!=image,optype!=http"))
+}
+
+func TestPruneFilterCascade(t *testing.T) {
+	t.Parallel()
+	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
+
+	tmpdir := t.TempDir()
+	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
+	require.NoError(t, err)
+
+	co, cleanup, err := newCacheManager(ctx, cmOpt{
+		snapshotter:     snapshotter,
+		snapshotterName: "native",
+	})
+	require.NoError(t, err)
+	defer cleanup()
+	cm := co.manager
+
+	active, err := cm.New(ctx, nil, nil, WithDescription("mount / from exec apt-get update"), WithOrigin(OpTypeExec, ""), CachePolicyRetain)
+	require.NoError(t, err)
+	update, err := active.Commit(ctx)
+	require.NoError(t, err)
+
+	active, err = cm.New(ctx, update, nil, WithDescription("mount / from exec apt-get install"), WithOrigin(OpTypeExec, ""), CachePolicyRetain)
+	require.NoError(t, err)
+	install, err := active.Commit(ctx)
+	require.NoError(t, err)
+
+	active, err = cm.New(ctx, nil, nil, WithDescription("fileop target"), WithOrigin(OpTypeFile, ""), CachePolicyRetain)
+	require.NoError(t, err)
+	file, err := active.Commit(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, update.Release(ctx))
+	require.NoError(t, install.Release(ctx))
+	require.NoError(t, file.Release(ctx))
+	checkDiskUsage(ctx, t, cm, 0, 3)
+
+	// the record that depends on the matching record is pruned with it
+	buf := pruneResultBuffer()
+	err = cm.Prune(ctx, buf.C, client.PruneInfo{Filter: []string{`description~="apt-get update"`}})
+	buf.close()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(buf.all))
+
+	du, err := cm.DiskUsage(ctx, client.DiskUsageInfo{Filter: []string{"optype==file"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(du))
+	checkDiskUsage(ctx, t, cm, 0, 1)
+}
@@ -14,6 +14,7 @@ const keySize = "snapshot.size"
 const keyEqualMutable = "cache.equalMutable"
 const keyCachePolicy = "cache.cachePolicy"
 const keyDescription = "cache.description"
+const keyOrigin = "cache.origin"
 const keyCreatedAt = "cache.createdAt"
 const keyLastUsedAt = "cache.lastUsedAt"
 const keyUsageCount = "cache.usageCount"
@@ -29,6 +30,9 @@ const keySnapshot = "cache.snapshot"
 const keyBlobOnly = "cache.blobonly"
 const keyMediaType = "cache.mediatype"
 const keyImageRefs = "cache.imageRefs"
+const keyCompressionVariants = "cache.compressionVariants"
+const keyCompressionVariantLevels = "cache.compressionVariantLevels"
+const keyURLs = "cache.urls"
 
 // BlobSize is the packed blob size as specified in the oci descriptor
 const keyBlobSize = "cache.blobsize"
@@ -193,6 +197,20 @@ func getBlob(si *metadata.StorageItem) string {
 	return str
 }
 
+// clearBlob removes the blob of the record and the values derived from it,
+// so that the blob is created again from the snapshot
+func clearBlob(si *metadata.StorageItem) error {
+	si.Update(func(b *bolt.Bucket) error {
+		for _, k := range []string{keyBlob, keyDiffID, keyChainID, keyBlobChainID, keyMediaType, keyBlobSize, keyCompressionVariants, keyCompressionVariantLevels} {
+			if err := si.SetValue(b, k, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return si.Commit()
+}
+
 func queueBlobOnly(si *metadata.StorageItem, b bool) error {
 	v, err := metadata.NewValue(b)
 	if err != nil {
@@ -311,6 +329,34 @@ func getSize(si *metadata.StorageItem) int64 {
 	return size
 }
 
+// queueURLs records the URLs of a non-distributable blob, e.g. a Windows base
+// layer, which are kept in the descriptors of exported images
+func queueURLs(si *metadata.StorageItem, urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	v, err := metadata.NewValue(urls)
+	if err != nil {
+		return errors.Wrap(err, "failed to create urls value")
+	}
+	si.Queue(func(b *bolt.Bucket) error {
+		return si.SetValue(b, keyURLs, v)
+	})
+	return nil
+}
+
+func getURLs(si *metadata.StorageItem) []string {
+	v := si.Get(keyURLs)
+	if v == nil {
+		return nil
+	}
+	var urls []string
+	if err := v.Unmarshal(&urls); err != nil {
+		return nil
+	}
+	return urls
+}
+
 func appendImageRef(si *metadata.StorageItem, s string) error {
 	return si.GetAndSetValue(keyImageRefs, func(v *metadata.Value) (*metadata.Value, error) {
 		var imageRefs []string
@@ -345,6 +391,88 @@ func getImageRefs(si *metadata.StorageItem) []string {
 	return refs
 }
 
+// setCompressionVariant records dgst as the blob of the record with the
+// compression type t. An empty dgst removes the variant.
+func setCompressionVariant(si *metadata.StorageItem, t string, dgst string) error {
+	return si.GetAndSetValue(keyCompressionVariants, func(v *metadata.Value) (*metadata.Value, error) {
+		variants := map[string]string{}
+		if v != nil {
+			if err := v.Unmarshal(&variants); err != nil {
+				return nil, err
+			}
+		}
+		if variants[t] == dgst {
+			return nil, metadata.ErrSkipSetValue
+		}
+		if dgst == "" {
+			delete(variants, t)
+		} else {
+			variants[t] = dgst
+		}
+		v, err := metadata.NewValue(variants)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create compressionVariants value")
+		}
+		return v, nil
+	})
+}
+
+// setCompressionVariantLevel records the compression level the variant of
+// the record with the compression type t was created with. A nil level
+// removes it, for variants of the default level.
+func setCompressionVariantLevel(si *metadata.StorageItem, t string, level *int) error {
+	return si.GetAndSetValue(keyCompressionVariantLevels, func(v *metadata.Value) (*metadata.Value, error) {
+		levels := map[string]int{}
+		if v != nil {
+			if err := v.Unmarshal(&levels); err != nil {
+				return nil, err
+			}
+		}
+		old, ok := levels[t]
+		if level == nil && !ok || level != nil && ok && old == *level {
+			return nil, metadata.ErrSkipSetValue
+		}
+		if level == nil {
+			delete(levels, t)
+		} else {
+			levels[t] = *level
+		}
+		v, err := metadata.NewValue(levels)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create compressionVariantLevels value")
+		}
+		return v, nil
+	})
+}
+
+// getCompressionVariantLevels returns the compression levels of the variants
+// that weren't created with the default level, by compression type
+func getCompressionVariantLevels(si *metadata.StorageItem) map[string]int {
+	v := si.Get(keyCompressionVariantLevels)
+	if v == nil {
+		return nil
+	}
+	var levels map[string]int
+	if err := v.Unmarshal(&levels); err != nil {
+		return nil
+	}
+	return levels
+}
+
+// getCompressionVariants returns the digests of the blobs of the record with
+// other compression types than its blob, by compression type
+func getCompressionVariants(si *metadata.StorageItem) map[string]string {
+	v := si.Get(keyCompressionVariants)
+	if v == nil {
+		return nil
+	}
+	var variants map[string]string
+	if err := v.Unmarshal(&variants); err != nil {
+		return nil
+	}
+	return variants
+}
+
 func queueBlobSize(si *metadata.StorageItem, s int64) error {
 	v, err := metadata.NewValue(s)
 	if err != nil {
@@ -432,6 +560,29 @@ func queueDescription(si *metadata.StorageItem, descr string) error {
 	return nil
 }
 
+func queueOrigin(si *metadata.StorageItem, o origin) error {
+	v, err := metadata.NewValue(o)
+	if err != nil {
+		return errors.Wrap(err, "failed to create origin value")
+	}
+	si.Queue(func(b *bolt.Bucket) error {
+		return si.SetValue(b, keyOrigin, v)
+	})
+	return nil
+}
+
+func getOrigin(si *metadata.StorageItem) origin {
+	v := si.Get(keyOrigin)
+	if v == nil {
+		return origin{}
+	}
+	var o origin
+	if err := v.Unmarshal(&o); err != nil {
+		return origin{}
+	}
+	return o
+}
+
 func GetDescription(si *metadata.StorageItem) string {
 	v := si.Get(keyDescription)
 	if v == nil {
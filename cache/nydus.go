@@ -0,0 +1,307 @@
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	ctdcompression "github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/labels"
+	"github.com/moby/buildkit/util/compression"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// nydusBuilder is the binary of the nydus image builder that converts
+	// layer tars into RAFS blobs and merges their bootstraps
+	nydusBuilder = "nydus-image"
+	// nydusFSVersion is the RAFS version of the blobs
+	nydusFSVersion = "6"
+
+	// nydusBlobAnnotation marks the layers of a nydus image that are RAFS
+	// blobs
+	nydusBlobAnnotation = "containerd.io/snapshot/nydus-blob"
+	// nydusBootstrapAnnotation marks the last layer of a nydus image that
+	// holds the merged bootstrap of the blobs
+	nydusBootstrapAnnotation = "containerd.io/snapshot/nydus-bootstrap"
+	// nydusFSVersionAnnotation is the RAFS version of the bootstrap layer
+	nydusFSVersionAnnotation = "containerd.io/snapshot/nydus-fs-version"
+
+	// the entries of the tar of a nydus blob layer
+	nydusEntryBlob      = "image.blob"
+	nydusEntryBootstrap = "image.boot"
+	// nydusBootstrapFile is the bootstrap in the tar of the bootstrap layer
+	nydusBootstrapFile = "image/image.boot"
+)
+
+// nydusAnnotations are stored as content labels of nydus blobs and added to
+// the layer descriptors on export, like eStargzAnnotations
+var nydusAnnotations = []string{nydusBlobAnnotation}
+
+// IsNydusBlob returns true for the RAFS blob layers of nydus images
+func IsNydusBlob(desc ocispecs.Descriptor) bool {
+	return desc.Annotations[nydusBlobAnnotation] == "true"
+}
+
+// nydusLayerConvertFunc converts a layer blob into a nydus blob layer with
+// nydus-image. The layer is a tar of the RAFS blob and the bootstrap of the
+// blob, which MergeNydus merges into the bootstrap layer of the image. The
+// blob is stored uncompressed, so its digest is its diffID.
+func nydusLayerConvertFunc(ctx context.Context, cs content.Store, desc ocispecs.Descriptor) (*ocispecs.Descriptor, error) {
+	if !images.IsLayerType(desc.MediaType) || IsNydusBlob(desc) {
+		// No conversion. No need to return an error here.
+		return nil, nil
+	}
+	builder, err := exec.LookPath(nydusBuilder)
+	if err != nil {
+		return nil, errors.Wrapf(err, "nydus compression requires %s", nydusBuilder)
+	}
+
+	// prepare the source and destination
+	info, err := cs.Info(ctx, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	labelz := info.Labels
+	if labelz == nil {
+		labelz = make(map[string]string)
+	}
+	dir, err := ioutil.TempDir("", "buildkit-nydus-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	layerPath := filepath.Join(dir, "layer.tar")
+	if err := writeUncompressedLayer(ctx, cs, desc, layerPath); err != nil {
+		return nil, err
+	}
+
+	// convert this layer
+	blobPath := filepath.Join(dir, nydusEntryBlob)
+	bootstrapPath := filepath.Join(dir, nydusEntryBootstrap)
+	if err := runNydusBuilder(ctx, builder, "create",
+		"--type", "tar-rafs",
+		"--fs-version", nydusFSVersion,
+		"--blob", blobPath,
+		"--bootstrap", bootstrapPath,
+		layerPath,
+	); err != nil {
+		return nil, err
+	}
+
+	ref := fmt.Sprintf("convert-nydus-from-%s", desc.Digest)
+	w, err := cs.Writer(ctx, content.WithRef(ref))
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+	if err := w.Truncate(0); err != nil { // Old written data possibly remains
+		return nil, err
+	}
+	if err := writeNydusLayer(w, blobPath, bootstrapPath); err != nil {
+		return nil, err
+	}
+	dgst := w.Digest()
+	for _, k := range layerAnnotations {
+		delete(labelz, k)
+	}
+	labelz[nydusBlobAnnotation] = "true"
+	labelz[labels.LabelUncompressed] = dgst.String() // update diffID label
+	if err = w.Commit(ctx, 0, "", content.WithLabels(labelz)); err != nil && !errdefs.IsAlreadyExists(err) {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	info, err = cs.Info(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+
+	newDesc := withLayerAnnotations(desc, labelz)
+	newDesc.MediaType = compression.MediaTypeNydusBlob
+	newDesc.Digest = info.Digest
+	newDesc.Size = info.Size
+	newDesc.Annotations[labels.LabelUncompressed] = dgst.String()
+	return &newDesc, nil
+}
+
+// MergeNydus merges the bootstraps of the nydus blob layers descs from the
+// bottom into the bootstrap layer of the image, which nydus-snapshotter mounts
+// the image with. The gzip compressed layer is written to cs.
+func MergeNydus(ctx context.Context, cs content.Store, descs []ocispecs.Descriptor) (*ocispecs.Descriptor, error) {
+	builder, err := exec.LookPath(nydusBuilder)
+	if err != nil {
+		return nil, errors.Wrapf(err, "nydus compression requires %s", nydusBuilder)
+	}
+	dir, err := ioutil.TempDir("", "buildkit-nydus-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// the blobs are referenced by the digests of their layers, which are
+	// fetched from the registry
+	args := []string{"merge", "--bootstrap", filepath.Join(dir, nydusEntryBootstrap)}
+	blobDigests := make([]string, 0, len(descs))
+	for _, desc := range descs {
+		blobDigests = append(blobDigests, desc.Digest.Hex())
+	}
+	args = append(args, "--blob-digests", strings.Join(blobDigests, ","))
+	for i, desc := range descs {
+		p := filepath.Join(dir, fmt.Sprintf("%d.boot", i))
+		if err := extractNydusBootstrap(ctx, cs, desc, p); err != nil {
+			return nil, err
+		}
+		args = append(args, p)
+	}
+	if err := runNydusBuilder(ctx, builder, args...); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	diffID := digest.Canonical.Digester()
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(io.MultiWriter(gw, diffID.Hash()))
+	if err := addTarFile(tw, nydusBootstrapFile, filepath.Join(dir, nydusEntryBootstrap)); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	desc := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageLayerGzip,
+		Digest:    digest.FromBytes(buf.Bytes()),
+		Size:      int64(buf.Len()),
+		Annotations: map[string]string{
+			labels.LabelUncompressed: diffID.Digest().String(),
+			nydusBootstrapAnnotation: "true",
+			nydusFSVersionAnnotation: nydusFSVersion,
+		},
+	}
+	if err := content.WriteBlob(ctx, cs, "nydus-bootstrap-"+desc.Digest.String(), bytes.NewReader(buf.Bytes()), desc, content.WithLabels(map[string]string{
+		labels.LabelUncompressed: diffID.Digest().String(),
+	})); err != nil {
+		return nil, errors.Wrap(err, "failed to write nydus bootstrap layer")
+	}
+	return &desc, nil
+}
+
+// writeUncompressedLayer writes the layer tar of desc to p
+func writeUncompressedLayer(ctx context.Context, cs content.Store, desc ocispecs.Descriptor, p string) error {
+	ra, err := cs.ReaderAt(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer ra.Close()
+	r, err := ctdcompression.DecompressStream(io.NewSectionReader(ra, 0, ra.Size()))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeNydusLayer writes the tar of a nydus blob layer with the blob and its
+// bootstrap to w
+func writeNydusLayer(w io.Writer, blobPath, bootstrapPath string) error {
+	tw := tar.NewWriter(w)
+	if err := addTarFile(tw, nydusEntryBlob, blobPath); err != nil {
+		return err
+	}
+	if err := addTarFile(tw, nydusEntryBootstrap, bootstrapPath); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// extractNydusBootstrap writes the bootstrap of the nydus blob layer desc to p
+func extractNydusBootstrap(ctx context.Context, cs content.Store, desc ocispecs.Descriptor, p string) error {
+	ra, err := cs.ReaderAt(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer ra.Close()
+	tr := tar.NewReader(io.NewSectionReader(ra, 0, ra.Size()))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return errors.Errorf("no bootstrap in nydus blob %s", desc.Digest)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to read nydus blob %s", desc.Digest)
+		}
+		if hdr.Name != nydusEntryBootstrap {
+			continue
+		}
+		f, err := os.Create(p)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
+
+// addTarFile adds the file at p to tw as a read-only regular file named name
+func addTarFile(tw *tar.Writer, name, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0444,
+		Size:     fi.Size(),
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// runNydusBuilder runs nydus-image with args and returns its output as the
+// error if it fails
+func runNydusBuilder(ctx context.Context, builder string, args ...string) error {
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, builder, append([]string{args[0], "--log-level", "warn"}, args[1:]...)...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "%s %s failed: %s", nydusBuilder, args[0], strings.TrimSpace(out.String()))
+	}
+	return nil
+}
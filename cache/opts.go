@@ -14,6 +14,9 @@ type DescHandler struct {
 	Progress       progress.Controller
 	SnapshotLabels map[string]string
 	Ref            string // string representation of desc origin, can be used as a sync key
+	// Annotations of the layer descriptor, e.g. the TOC of eStargz and
+	// zstd:chunked layers that remote snapshotters can mount lazily
+	Annotations map[string]string
 }
 
 type DescHandlers map[digest.Digest]*DescHandler
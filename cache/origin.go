@@ -0,0 +1,34 @@
+package cache
+
+// Op types of cache records for the "optype" filter
+const (
+	OpTypeExec       = "exec"
+	OpTypeFile       = "file"
+	OpTypeCacheMount = "cachemount"
+	OpTypeImage      = "image"
+	OpTypeGit        = "git"
+	OpTypeHTTP       = "http"
+	OpTypeLocal      = "local"
+)
+
+// origin is the type of the op that created a cache record and, for sources,
+// the image reference, git remote, URL or local name the record was loaded
+// from
+type origin struct {
+	OpType string `json:"opType,omitempty"`
+	Source string `json:"source,omitempty"`
+}
+
+// WithOrigin records the type of the op that creates a cache record and the
+// source it is loaded from for the "optype" and "source" filters
+func WithOrigin(opType, source string) RefOption {
+	return func(m withMetadata) error {
+		return queueOrigin(m.Metadata(), origin{OpType: opType, Source: source})
+	}
+}
+
+// IsImageLayer returns whether ref is a layer of a pulled image and wasn't
+// created by a build
+func IsImageLayer(ref ImmutableRef) bool {
+	return len(getImageRefs(ref.Metadata())) > 0
+}
@@ -3,6 +3,8 @@ package cache
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -46,7 +48,17 @@ type ImmutableRef interface {
 
 	Info() RefInfo
 	Extract(ctx context.Context, s session.Group) error // +progress
-	GetRemote(ctx context.Context, createIfNeeded bool, compressionType compression.Type, forceCompression bool, s session.Group) (*solver.Remote, error)
+	GetRemote(ctx context.Context, createIfNeeded bool, comp compression.Config, s session.Group) (*solver.Remote, error)
+	// CompressionVariants and RemoveCompressionVariant list and release the
+	// blobs of the layer converted to other compression types
+	CompressionVariants(ctx context.Context) ([]CompressionVariant, error)
+	RemoveCompressionVariant(ctx context.Context, compressionType compression.Type) error
+	// Finalize commits the snapshot of the mutable ref the ref was committed
+	// from, see FinalizePolicy. It's a no-op for finalized refs. Custom ops
+	// call it before using the snapshot of the ref outside of the manager.
+	Finalize(ctx context.Context) error
+	// Finalized returns whether the ref is no longer backed by a mutable ref
+	Finalized() bool
 }
 
 type RefInfo struct {
@@ -62,6 +74,10 @@ type RefInfo struct {
 type MutableRef interface {
 	Ref
 	Commit(context.Context) (ImmutableRef, error)
+	// CurrentSize returns the disk usage of the changes in the ref now.
+	// Unlike Size it isn't stored, so it can be polled while the ref is
+	// mounted.
+	CurrentSize(context.Context) (int64, error)
 }
 
 type Mountable interface {
@@ -208,17 +224,26 @@ func (cr *cacheRecord) Size(ctx context.Context) (int64, error) {
 			if err == nil {
 				usage.Size += info.Size
 			}
+			// accumulate size of compression variant blobs, counting every
+			// blob once
+			counted := map[string]struct{}{dgst: {}}
+			var variants []string
 			for k, v := range info.Labels {
-				// accumulate size of compression variant blobs
 				if strings.HasPrefix(k, compressionVariantDigestLabelPrefix) {
-					if cdgst, err := digest.Parse(v); err == nil {
-						if digest.Digest(dgst) == cdgst {
-							// do not double count if the label points to this content itself.
-							continue
-						}
-						if info, err := cr.cm.ContentStore.Info(ctx, cdgst); err == nil {
-							usage.Size += info.Size
-						}
+					variants = append(variants, v)
+				}
+			}
+			for _, v := range getCompressionVariants(cr.md) {
+				variants = append(variants, v)
+			}
+			for _, v := range variants {
+				if _, ok := counted[v]; ok {
+					continue
+				}
+				counted[v] = struct{}{}
+				if cdgst, err := digest.Parse(v); err == nil {
+					if info, err := cr.cm.ContentStore.Info(ctx, cdgst); err == nil {
+						usage.Size += info.Size
 					}
 				}
 			}
@@ -365,6 +390,7 @@ func (sr *immutableRef) ociDesc() (ocispecs.Descriptor, error) {
 		Digest:      digest.Digest(getBlob(sr.md)),
 		Size:        getBlobSize(sr.md),
 		MediaType:   getMediaType(sr.md),
+		URLs:        getURLs(sr.md),
 		Annotations: make(map[string]string),
 	}
 
@@ -391,29 +417,94 @@ func compressionVariantDigestLabel(compressionType compression.Type) string {
 	return compressionVariantDigestLabelPrefix + compressionType.String()
 }
 
-func (sr *immutableRef) getCompressionBlob(ctx context.Context, compressionType compression.Type) (content.Info, error) {
+// CompressionVariant is a blob of a ref with another compression type than
+// the blob of the ref
+type CompressionVariant struct {
+	Type   compression.Type
+	Digest digest.Digest
+	Size   int64
+}
+
+// compressionLevelLabel is the compression level of variant blobs that
+// weren't created with the default level
+const compressionLevelLabel = "buildkit.io/compression/level"
+
+// getCompressionBlob returns the variant of the ref with the compression of
+// comp. Variants of another level than the level set in comp aren't returned,
+// so that they are converted again.
+func (sr *immutableRef) getCompressionBlob(ctx context.Context, comp compression.Config) (content.Info, error) {
 	cs := sr.cm.ContentStore
+	if dgstS, ok := getCompressionVariants(sr.md)[comp.Type.String()]; ok {
+		dgst, err := digest.Parse(dgstS)
+		if err != nil {
+			return content.Info{}, err
+		}
+		if comp.Level != nil {
+			if level, ok := getCompressionVariantLevels(sr.md)[comp.Type.String()]; !ok || level != *comp.Level {
+				return content.Info{}, errors.Wrapf(errdefs.ErrNotFound, "no %s blob of level %d", comp.Type, *comp.Level)
+			}
+		}
+		return cs.Info(ctx, dgst)
+	}
+
+	// variants created for other refs with the same blob are labeled on the
+	// blob
 	info, err := cs.Info(ctx, digest.Digest(getBlob(sr.md)))
 	if err != nil {
 		return content.Info{}, err
 	}
-	dgstS, ok := info.Labels[compressionVariantDigestLabel(compressionType)]
+	dgstS, ok := info.Labels[compressionVariantDigestLabel(comp.Type)]
 	if ok {
 		dgst, err := digest.Parse(dgstS)
 		if err != nil {
 			return content.Info{}, err
 		}
-		return cs.Info(ctx, dgst)
+		info, err := cs.Info(ctx, dgst)
+		if err != nil {
+			return content.Info{}, err
+		}
+		level, err := blobCompressionLevel(info)
+		if err != nil {
+			return content.Info{}, err
+		}
+		if comp.Level != nil && (level == nil || *level != *comp.Level) {
+			return content.Info{}, errors.Wrapf(errdefs.ErrNotFound, "no %s blob of level %d", comp.Type, *comp.Level)
+		}
+		// track the variant with this ref too, so that it isn't removed
+		// together with the ref it was created for
+		if err := sr.trackCompressionBlob(ctx, dgst, comp.Type, level); err != nil {
+			return content.Info{}, err
+		}
+		return info, nil
 	}
 	return content.Info{}, errdefs.ErrNotFound
 }
 
-func (sr *immutableRef) addCompressionBlob(ctx context.Context, dgst digest.Digest, compressionType compression.Type) error {
+// blobCompressionLevel returns the compression level of a variant blob, nil
+// for the default level
+func blobCompressionLevel(info content.Info) (*int, error) {
+	v, ok := info.Labels[compressionLevelLabel]
+	if !ok {
+		return nil, nil
+	}
+	level, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid compression level of %s", info.Digest)
+	}
+	return &level, nil
+}
+
+func (sr *immutableRef) addCompressionBlob(ctx context.Context, dgst digest.Digest, comp compression.Config) error {
 	cs := sr.cm.ContentStore
-	if err := sr.cm.ManagerOpt.LeaseManager.AddResource(ctx, leases.Lease{ID: sr.ID()}, leases.Resource{
-		ID:   dgst.String(),
-		Type: "content",
-	}); err != nil {
+	if comp.Level != nil {
+		if _, err := cs.Update(ctx, content.Info{
+			Digest: dgst,
+			Labels: map[string]string{compressionLevelLabel: strconv.Itoa(*comp.Level)},
+		}, "labels."+compressionLevelLabel); err != nil {
+			return err
+		}
+	}
+	if err := sr.trackCompressionBlob(ctx, dgst, comp.Type, comp.Level); err != nil {
 		return err
 	}
 	info, err := cs.Info(ctx, digest.Digest(getBlob(sr.md)))
@@ -423,7 +514,7 @@ func (sr *immutableRef) addCompressionBlob(ctx context.Context, dgst digest.Dige
 	if info.Labels == nil {
 		info.Labels = make(map[string]string)
 	}
-	cachedVariantLabel := compressionVariantDigestLabel(compressionType)
+	cachedVariantLabel := compressionVariantDigestLabel(comp.Type)
 	info.Labels[cachedVariantLabel] = dgst.String()
 	if _, err := cs.Update(ctx, info, "labels."+cachedVariantLabel); err != nil {
 		return err
@@ -431,6 +522,111 @@ func (sr *immutableRef) addCompressionBlob(ctx context.Context, dgst digest.Dige
 	return nil
 }
 
+// trackCompressionBlob adds the blob dgst to the lease and the metadata of
+// the ref, so that it is kept and accounted for until the ref is removed. A
+// variant of another level that the ref had is released.
+func (sr *immutableRef) trackCompressionBlob(ctx context.Context, dgst digest.Digest, compressionType compression.Type, level *int) error {
+	if err := sr.cm.ManagerOpt.LeaseManager.AddResource(ctx, leases.Lease{ID: sr.ID()}, leases.Resource{
+		ID:   dgst.String(),
+		Type: "content",
+	}); err != nil {
+		return err
+	}
+	if old, ok := getCompressionVariants(sr.md)[compressionType.String()]; ok && old != dgst.String() && old != getBlob(sr.md) {
+		if err := sr.cm.ManagerOpt.LeaseManager.DeleteResource(ctx, leases.Lease{ID: sr.ID()}, leases.Resource{
+			ID:   old,
+			Type: "content",
+		}); err != nil && !errors.Is(err, errdefs.ErrNotFound) {
+			return err
+		}
+	}
+	if err := setCompressionVariant(sr.md, compressionType.String(), dgst.String()); err != nil {
+		return err
+	}
+	if err := setCompressionVariantLevel(sr.md, compressionType.String(), level); err != nil {
+		return err
+	}
+	return sr.resetSize()
+}
+
+// CompressionVariants returns the blobs of the ref with other compression
+// types than its blob that were created by conversions, e.g. for exports with
+// force-compression.
+func (sr *immutableRef) CompressionVariants(ctx context.Context) ([]CompressionVariant, error) {
+	variants := getCompressionVariants(sr.md)
+	out := make([]CompressionVariant, 0, len(variants))
+	for t, dgstS := range variants {
+		ct, err := compression.Parse(t)
+		if err != nil {
+			return nil, err
+		}
+		dgst, err := digest.Parse(dgstS)
+		if err != nil {
+			return nil, err
+		}
+		info, err := sr.cm.ContentStore.Info(ctx, dgst)
+		if err != nil {
+			if errors.Is(err, errdefs.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		out = append(out, CompressionVariant{Type: ct, Digest: dgst, Size: info.Size})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Type < out[j].Type
+	})
+	return out, nil
+}
+
+// RemoveCompressionVariant releases the blob of the ref with compressionType,
+// so that it is garbage collected if no other ref uses it. The blob the ref
+// was created with can't be removed.
+func (sr *immutableRef) RemoveCompressionVariant(ctx context.Context, compressionType compression.Type) error {
+	return sr.removeCompressionVariant(ctx, compressionType)
+}
+
+func (cr *cacheRecord) removeCompressionVariant(ctx context.Context, compressionType compression.Type) error {
+	dgstS, ok := getCompressionVariants(cr.md)[compressionType.String()]
+	if !ok {
+		return errors.Wrapf(errdefs.ErrNotFound, "no %s blob for %s", compressionType, cr.ID())
+	}
+	blob := getBlob(cr.md)
+	if dgstS == blob {
+		return errors.Errorf("can't remove blob %s of %s", dgstS, cr.ID())
+	}
+	if err := cr.cm.ManagerOpt.LeaseManager.DeleteResource(ctx, leases.Lease{ID: cr.ID()}, leases.Resource{
+		ID:   dgstS,
+		Type: "content",
+	}); err != nil && !errors.Is(err, errdefs.ErrNotFound) {
+		return err
+	}
+	// the blob no longer points other refs to the variant, which is garbage
+	// collected unless the refs that already use it keep it
+	cs := cr.cm.ContentStore
+	label := compressionVariantDigestLabel(compressionType)
+	if info, err := cs.Info(ctx, digest.Digest(blob)); err == nil && info.Labels[label] == dgstS {
+		if _, err := cs.Update(ctx, content.Info{Digest: info.Digest}, "labels."+label); err != nil && !errors.Is(err, errdefs.ErrNotFound) {
+			return err
+		}
+	}
+	if err := setCompressionVariant(cr.md, compressionType.String(), ""); err != nil {
+		return err
+	}
+	if err := setCompressionVariantLevel(cr.md, compressionType.String(), nil); err != nil {
+		return err
+	}
+	return cr.resetSize()
+}
+
+// resetSize makes Size recalculate the size of the record
+func (cr *cacheRecord) resetSize() error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	setSize(cr.md, sizeUnknown)
+	return cr.md.Commit()
+}
+
 // order is from parent->child, sr will be at end of slice
 func (sr *immutableRef) parentRefChain() []*immutableRef {
 	var count int
@@ -548,8 +744,7 @@ func (sr *immutableRef) prepareRemoteSnapshotsStargzMode(ctx context.Context, s
 		dhs := sr.descHandlers
 		for _, r := range sr.parentRefChain() {
 			r := r
-			snapshotID := getSnapshotID(r.md)
-			if _, err := r.cm.Snapshotter.Stat(ctx, snapshotID); err == nil {
+			if _, err := r.cm.Snapshotter.Stat(ctx, getSnapshotID(r.md)); err == nil {
 				continue
 			}
 
@@ -563,53 +758,12 @@ func (sr *immutableRef) prepareRemoteSnapshotsStargzMode(ctx context.Context, s
 				return nil, nil
 			}
 
-			// tmpLabels contains dh.SnapshotLabels + session IDs. All keys contain
-			// an unique ID for avoiding the collision among snapshotter API calls to
-			// this snapshot. tmpLabels will be removed at the end of this function.
-			defaultLabels := snapshots.FilterInheritedLabels(dh.SnapshotLabels)
-			if defaultLabels == nil {
-				defaultLabels = make(map[string]string)
-			}
-			tmpFields, tmpLabels := makeTmpLabelsStargzMode(defaultLabels, s)
-			defaultLabels["containerd.io/snapshot.ref"] = snapshotID
-
-			// Prepare remote snapshots
-			var (
-				key  = fmt.Sprintf("tmp-%s %s", identity.NewID(), r.Info().ChainID)
-				opts = []snapshots.Opt{
-					snapshots.WithLabels(defaultLabels),
-					snapshots.WithLabels(tmpLabels),
-				}
-			)
-			parentID := ""
-			if r.parent != nil {
-				parentID = getSnapshotID(r.parent.md)
+			if !r.prepareRemoteSnapshotStargzMode(ctx, dh, s) {
+				// This layer and all upper layers cannot be prepared without
+				// unlazying. Upper layers with a TOC are tried again on
+				// extract, once this layer is unlazied.
+				break
 			}
-			if err = r.cm.Snapshotter.Prepare(ctx, key, parentID, opts...); err != nil {
-				if errdefs.IsAlreadyExists(err) {
-					// Check if the targeting snapshot ID has been prepared as
-					// a remote snapshot in the snapshotter.
-					info, err := r.cm.Snapshotter.Stat(ctx, snapshotID)
-					if err == nil { // usable as remote snapshot without unlazying.
-						defer func() {
-							// Remove tmp labels appended in this func
-							for k := range tmpLabels {
-								info.Labels[k] = ""
-							}
-							if _, err := r.cm.Snapshotter.Update(ctx, info, tmpFields...); err != nil {
-								logrus.Warn(errors.Wrapf(err,
-									"failed to remove tmp remote labels after prepare"))
-							}
-						}()
-
-						// Try the next layer as well.
-						continue
-					}
-				}
-			}
-
-			// This layer and all upper layers cannot be prepared without unlazying.
-			break
 		}
 
 		return nil, nil
@@ -617,6 +771,67 @@ func (sr *immutableRef) prepareRemoteSnapshotsStargzMode(ctx context.Context, s
 	return err
 }
 
+// prepareRemoteSnapshotStargzMode prepares the snapshot of sr as a remote
+// snapshot on top of the snapshot of its parent, which has to exist already.
+// It returns false if the snapshotter can't mount the layer without
+// unlazying it.
+func (sr *immutableRef) prepareRemoteSnapshotStargzMode(ctx context.Context, dh *DescHandler, s session.Group) bool {
+	snapshotID := getSnapshotID(sr.md)
+
+	// tmpLabels contains dh.SnapshotLabels + session IDs. All keys contain
+	// an unique ID for avoiding the collision among snapshotter API calls to
+	// this snapshot. tmpLabels will be removed at the end of this function.
+	defaultLabels := snapshots.FilterInheritedLabels(dh.SnapshotLabels)
+	if defaultLabels == nil {
+		defaultLabels = make(map[string]string)
+	}
+	tmpFields, tmpLabels := makeTmpLabelsStargzMode(defaultLabels, s)
+	defaultLabels["containerd.io/snapshot.ref"] = snapshotID
+
+	// Prepare remote snapshots
+	var (
+		key  = fmt.Sprintf("tmp-%s %s", identity.NewID(), sr.Info().ChainID)
+		opts = []snapshots.Opt{
+			snapshots.WithLabels(defaultLabels),
+			snapshots.WithLabels(tmpLabels),
+		}
+	)
+	parentID := ""
+	if sr.parent != nil {
+		parentID = getSnapshotID(sr.parent.md)
+	}
+	if err := sr.cm.Snapshotter.Prepare(ctx, key, parentID, opts...); err == nil || !errdefs.IsAlreadyExists(err) {
+		return false
+	}
+
+	// Check if the targeting snapshot ID has been prepared as
+	// a remote snapshot in the snapshotter.
+	info, err := sr.cm.Snapshotter.Stat(ctx, snapshotID)
+	if err != nil {
+		return false
+	}
+	// usable as remote snapshot without unlazying.
+	// Remove tmp labels appended in this func
+	for k := range tmpLabels {
+		info.Labels[k] = ""
+	}
+	if _, err := sr.cm.Snapshotter.Update(ctx, info, tmpFields...); err != nil {
+		logrus.Warn(errors.Wrapf(err,
+			"failed to remove tmp remote labels after prepare"))
+	}
+	return true
+}
+
+// isLazyMountable returns true for layers with a TOC that remote
+// snapshotters can mount without downloading the whole layer
+func isLazyMountable(dh *DescHandler) bool {
+	if dh == nil {
+		return false
+	}
+	desc := ocispecs.Descriptor{Annotations: dh.Annotations}
+	return isEStargz(desc) || isZstdChunked(desc)
+}
+
 func makeTmpLabelsStargzMode(labels map[string]string, s session.Group) (fields []string, res map[string]string) {
 	res = make(map[string]string)
 	// Append unique ID to labels for avoiding collision of labels among calls
@@ -664,6 +879,19 @@ func (sr *immutableRef) extract(ctx context.Context, dhs DescHandlers, s session
 		}
 		dh := dhs[desc.Digest]
 
+		if sr.cm.Snapshotter.Name() == "stargz" && isLazyMountable(dh) {
+			// the layer can still be mounted lazily if its parent had to be
+			// unlazied, falling back to unlazying it if the snapshotter can't
+			// handle its format
+			if err := eg.Wait(); err != nil {
+				return nil, err
+			}
+			if sr.prepareRemoteSnapshotStargzMode(ctx, dh, s) {
+				return nil, nil
+			}
+			eg, egctx = errgroup.WithContext(ctx)
+		}
+
 		eg.Go(func() error {
 			// unlazies if needed, otherwise a no-op
 			return lazyRefProvider{
@@ -777,6 +1005,16 @@ func (sr *immutableRef) release(ctx context.Context) error {
 	return nil
 }
 
+func (sr *immutableRef) Finalize(ctx context.Context) error {
+	return sr.finalizeLocked(ctx)
+}
+
+func (sr *immutableRef) Finalized() bool {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return sr.equalMutable == nil
+}
+
 func (sr *immutableRef) finalizeLocked(ctx context.Context) error {
 	sr.mu.Lock()
 	defer sr.mu.Unlock()
@@ -838,7 +1076,9 @@ func (sr *mutableRef) updateLastUsed() bool {
 	return sr.triggerLastUsed
 }
 
-func (sr *mutableRef) commit(ctx context.Context) (*immutableRef, error) {
+// commit commits the ref. size is the size of the snapshot if it was
+// measured for the commit, so that it isn't measured again, or sizeUnknown.
+func (sr *mutableRef) commit(ctx context.Context, size int64) (*immutableRef, error) {
 	if !sr.mutable || len(sr.refs) == 0 {
 		return nil, errors.Wrapf(errInvalid, "invalid mutable ref %p", sr)
 	}
@@ -875,7 +1115,7 @@ func (sr *mutableRef) commit(ctx context.Context) (*immutableRef, error) {
 	}
 
 	queueCommitted(md)
-	setSize(md, sizeUnknown)
+	setSize(md, size)
 	setEqualMutable(md, sr.ID())
 	if err := md.Commit(); err != nil {
 		return nil, err
@@ -883,6 +1123,13 @@ func (sr *mutableRef) commit(ctx context.Context) (*immutableRef, error) {
 
 	ref := rec.ref(true, sr.descHandlers)
 	sr.equalImmutable = ref
+
+	if sr.cm.FinalizePolicy == FinalizeEager {
+		// the ref is still usable, it's finalized again when it's needed
+		if err := rec.finalize(ctx); err != nil {
+			logrus.Warnf("failed to finalize %s: %v", rec.ID(), err)
+		}
+	}
 	return ref, nil
 }
 
@@ -906,14 +1153,33 @@ func (sr *mutableRef) Mount(ctx context.Context, readonly bool, s session.Group)
 	return sr.mount(ctx, readonly)
 }
 
+func (sr *mutableRef) CurrentSize(ctx context.Context) (int64, error) {
+	sr.mu.Lock()
+	id := getSnapshotID(sr.md)
+	sr.mu.Unlock()
+	usage, err := sr.cm.Snapshotter.Usage(ctx, id)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get usage for %s", sr.ID())
+	}
+	return usage.Size, nil
+}
+
 func (sr *mutableRef) Commit(ctx context.Context) (ImmutableRef, error) {
+	size, err := sr.checkSize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := sr.cm.checkFreeSpace(ctx); err != nil {
+		return nil, err
+	}
+
 	sr.cm.mu.Lock()
 	defer sr.cm.mu.Unlock()
 
 	sr.mu.Lock()
 	defer sr.mu.Unlock()
 
-	return sr.commit(ctx)
+	return sr.commit(ctx, size)
 }
 
 func (sr *mutableRef) Release(ctx context.Context) error {
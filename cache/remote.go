@@ -27,14 +27,23 @@ type Unlazier interface {
 
 // GetRemote gets a *solver.Remote from content store for this ref (potentially pulling lazily).
 // Note: Use WorkerRef.GetRemote instead as moby integration requires custom GetRemote implementation.
-func (sr *immutableRef) GetRemote(ctx context.Context, createIfNeeded bool, compressionType compression.Type, forceCompression bool, s session.Group) (*solver.Remote, error) {
+func (sr *immutableRef) GetRemote(ctx context.Context, createIfNeeded bool, comp compression.Config, s session.Group) (*solver.Remote, error) {
 	ctx, done, err := leaseutil.WithLease(ctx, sr.cm.LeaseManager, leaseutil.MakeTemporary)
 	if err != nil {
 		return nil, err
 	}
 	defer done(ctx)
 
-	err = sr.computeBlobChain(ctx, createIfNeeded, compressionType, forceCompression, s)
+	if isTypeWindows(sr) {
+		comp = windowsCompression(comp)
+	}
+	comp = sr.cm.withCompressionLevel(comp)
+	if comp.Type == compression.Nydus {
+		// the blobs of refs are never nydus blobs, see computeBlobChain
+		comp.Force = true
+	}
+
+	err = sr.computeBlobChain(ctx, createIfNeeded, comp, s)
 	if err != nil {
 		return nil, err
 	}
@@ -63,6 +72,12 @@ func (sr *immutableRef) GetRemote(ctx context.Context, createIfNeeded bool, comp
 			}
 		}
 
+		// eStargz blobs keep their TOC annotations as content labels. Lazy
+		// blobs aren't in the content store yet.
+		if info, err := ref.cm.ContentStore.Info(ctx, desc.Digest); err == nil {
+			desc = withLayerAnnotations(desc, info.Labels)
+		}
+
 		// update distribution source annotation for lazy-refs (non-lazy refs
 		// will already have their dsl stored in the content store, which is
 		// used by the push handlers)
@@ -105,23 +120,26 @@ func (sr *immutableRef) GetRemote(ctx context.Context, createIfNeeded bool, comp
 			}
 		}
 
-		if forceCompression {
+		if comp.Force {
 			// ensure the compression type.
 			// compressed blob must be created and stored in the content store.
-			_, convertMediaTypeFunc, err := getConverters(desc, compressionType)
+			_, convertMediaTypeFunc, err := getConverters(desc, comp)
 			if err != nil {
 				return nil, err
 			}
 			if convertMediaTypeFunc != nil {
 				// needs conversion
-				info, err := ref.getCompressionBlob(ctx, compressionType)
+				info, err := ref.getCompressionBlob(ctx, comp)
 				if err != nil {
 					return nil, err
 				}
-				newDesc := desc
+				newDesc := withLayerAnnotations(desc, info.Labels)
 				newDesc.MediaType = convertMediaTypeFunc(newDesc.MediaType)
 				newDesc.Digest = info.Digest
 				newDesc.Size = info.Size
+				if diffID, ok := info.Labels[containerdUncompressed]; ok {
+					newDesc.Annotations[containerdUncompressed] = diffID
+				}
 				if desc.Digest != newDesc.Digest {
 					mproviderBase.Add(newDesc.Digest, ref.cm.ContentStore)
 				}
@@ -202,6 +220,10 @@ func (p lazyRefProvider) Unlazy(ctx context.Context) error {
 			defer stopProgress(rerr)
 		}
 
+		if err := p.ref.cm.checkFreeSpace(ctx); err != nil {
+			return nil, err
+		}
+
 		// For now, just pull down the whole content and then return a ReaderAt from the local content
 		// store. If efficient partial reads are desired in the future, something more like a "tee"
 		// that caches remote partial reads to a local store may need to replace this.
@@ -218,6 +240,7 @@ func (p lazyRefProvider) Unlazy(ctx context.Context) error {
 			imageRef := imageRefs[0]
 			if GetDescription(p.ref.md) == "" {
 				queueDescription(p.ref.md, "pulled from "+imageRef)
+				queueOrigin(p.ref.md, origin{OpType: OpTypeImage, Source: imageRef})
 				err := p.ref.md.Commit()
 				if err != nil {
 					return nil, err
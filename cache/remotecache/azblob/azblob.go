@@ -0,0 +1,195 @@
+package azblob
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moby/buildkit/cache/remotecache"
+	"github.com/moby/buildkit/cache/remotecache/objectstore"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/util/tracing"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	attrAccountURL  = "account_url"
+	attrAccountName = "account_name"
+	attrContainer   = "container"
+	attrPrefix      = "prefix"
+	attrName        = "name"
+	attrIndexURL    = "index_url"
+	attrSASToken    = "sas_token"
+	attrClientID    = "client_id"
+	attrBlockSize   = "upload_block_size"
+
+	defaultBlockSize = 64 << 20
+	maxBlockSize     = 4000 << 20
+)
+
+type Config struct {
+	// AccountURL is the URL of the Blob service of the storage account,
+	// e.g. https://<account>.blob.core.windows.net
+	AccountURL string
+	Container  string
+	// Prefix is prepended to the names of the layer and manifest blobs
+	Prefix string
+	// Name of the cache manifest, defaults to buildkit
+	Name string
+	// IndexURL is the URL of a key-value store, e.g. redis://host:6379/0,
+	// that the cache chains are written to instead of the cache manifest
+	IndexURL string
+	// SASToken is a shared access signature of the container or account.
+	// Without it the requests are authorized with tokens of the managed
+	// identity of the instance or of AKS workload identity.
+	SASToken string
+	// ClientID selects a user-assigned managed identity
+	ClientID string
+	// BlockSize is the size of the blocks of large uploads, blobs up to
+	// this size are uploaded with a single request
+	BlockSize int64
+}
+
+func getConfig(attrs map[string]string) (*Config, error) {
+	cfg := &Config{
+		AccountURL: attrs[attrAccountURL],
+		Container:  attrs[attrContainer],
+		Prefix:     attrs[attrPrefix],
+		Name:       attrs[attrName],
+		IndexURL:   attrs[attrIndexURL],
+		SASToken:   attrs[attrSASToken],
+		ClientID:   attrs[attrClientID],
+		BlockSize:  defaultBlockSize,
+	}
+	if cfg.AccountURL == "" {
+		account := attrs[attrAccountName]
+		if account == "" {
+			account = os.Getenv("AZURE_STORAGE_ACCOUNT")
+		}
+		if account == "" {
+			return nil, errors.Errorf("%s or %s not set for azblob cache", attrAccountURL, attrAccountName)
+		}
+		cfg.AccountURL = "https://" + account + ".blob.core.windows.net"
+	}
+	if cfg.Container == "" {
+		return nil, errors.Errorf("container not set for azblob cache")
+	}
+	if cfg.Name == "" {
+		cfg.Name = "buildkit"
+	}
+	if cfg.SASToken == "" {
+		cfg.SASToken = os.Getenv("AZURE_STORAGE_SAS_TOKEN")
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = os.Getenv("AZURE_CLIENT_ID")
+	}
+	if v, ok := attrs[attrBlockSize]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n > maxBlockSize {
+			return nil, errors.Errorf("invalid %s %q, expected at most %d bytes", attrBlockSize, v, maxBlockSize)
+		}
+		cfg.BlockSize = n
+	}
+	return cfg, nil
+}
+
+func newClient(c *Config) (*client, error) {
+	u, err := url.Parse(c.AccountURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", attrAccountURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("invalid %s %q, expected http or https URL", attrAccountURL, c.AccountURL)
+	}
+	// a SAS may also be part of the account URL
+	sas := u.Query()
+	u.RawQuery = ""
+	if c.SASToken != "" {
+		sas, err = url.ParseQuery(strings.TrimPrefix(c.SASToken, "?"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", attrSASToken)
+		}
+	}
+	cl := &client{
+		httpClient:   tracing.DefaultClient,
+		containerURL: strings.TrimSuffix(u.String(), "/") + "/" + url.PathEscape(c.Container),
+		blockSize:    c.BlockSize,
+	}
+	if len(sas) > 0 {
+		cl.sas = sas
+		return cl, nil
+	}
+	// AKS workload identity injects the federated token and the tenant
+	ts := &tokenSource{
+		httpClient:    tracing.DefaultClient,
+		imdsURL:       defaultIMDSEndpoint,
+		clientID:      c.ClientID,
+		tenantID:      os.Getenv("AZURE_TENANT_ID"),
+		authorityHost: os.Getenv("AZURE_AUTHORITY_HOST"),
+		now:           time.Now,
+	}
+	if f := os.Getenv("AZURE_FEDERATED_TOKEN_FILE"); f != "" && ts.tenantID != "" && ts.clientID != "" {
+		ts.tokenFile = f
+		if ts.authorityHost == "" {
+			ts.authorityHost = defaultAuthorityHost
+		}
+	}
+	cl.tokens = ts
+	return cl, nil
+}
+
+// storeConfig returns the location of the cache in the azblob store
+func storeConfig(c *Config) objectstore.Config {
+	return objectstore.Config{
+		Prefix:      c.Prefix,
+		Name:        c.Name,
+		IndexURL:    c.IndexURL,
+		IndexPrefix: "azblob:" + c.Container + "/",
+	}
+}
+
+// ResolveCacheExporterFunc for Azure Blob Storage cache exporter.
+func ResolveCacheExporterFunc() remotecache.ResolveCacheExporterFunc {
+	return func(ctx context.Context, g session.Group, attrs map[string]string) (remotecache.Exporter, error) {
+		cfg, err := getConfig(attrs)
+		if err != nil {
+			return nil, err
+		}
+		return NewExporter(cfg)
+	}
+}
+
+func NewExporter(c *Config) (remotecache.Exporter, error) {
+	cl, err := newClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return objectstore.NewExporter(cl, storeConfig(c)), nil
+}
+
+// ResolveCacheImporterFunc for Azure Blob Storage cache importer.
+func ResolveCacheImporterFunc() remotecache.ResolveCacheImporterFunc {
+	return func(ctx context.Context, g session.Group, attrs map[string]string) (remotecache.Importer, ocispecs.Descriptor, error) {
+		cfg, err := getConfig(attrs)
+		if err != nil {
+			return nil, ocispecs.Descriptor{}, err
+		}
+		i, err := NewImporter(cfg)
+		if err != nil {
+			return nil, ocispecs.Descriptor{}, err
+		}
+		return i, ocispecs.Descriptor{}, nil
+	}
+}
+
+func NewImporter(c *Config) (remotecache.Importer, error) {
+	cl, err := newClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return objectstore.NewImporter(cl, storeConfig(c)), nil
+}
@@ -0,0 +1,338 @@
+package azblob
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// apiVersion is the version of the Blob service REST API, it supports
+	// bearer tokens
+	apiVersion = "2020-10-02"
+	// maxBlocks is the maximum number of blocks of a block blob
+	maxBlocks = 50000
+
+	storageResource      = "https://storage.azure.com/"
+	defaultIMDSEndpoint  = "http://169.254.169.254/metadata/identity/oauth2/token"
+	defaultAuthorityHost = "https://login.microsoftonline.com/"
+)
+
+// tokenSource returns the OAuth2 access tokens the requests are authorized
+// with. Tokens are exchanged for the federated token of AKS workload
+// identity if it is configured and fetched for the managed identity of the
+// instance from the instance metadata service otherwise.
+type tokenSource struct {
+	httpClient *http.Client
+	// imdsURL is the token endpoint of the instance metadata service
+	imdsURL string
+	// clientID selects a user-assigned managed identity or is the client
+	// of workload identity
+	clientID string
+	// tenantID, authorityHost and tokenFile are set for workload identity
+	tenantID      string
+	authorityHost string
+	tokenFile     string
+	now           func() time.Time
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func (ts *tokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	// refresh five minutes early so that tokens don't expire in flight
+	if ts.token != "" && ts.now().Add(5*time.Minute).Before(ts.expiry) {
+		return ts.token, nil
+	}
+
+	var req *http.Request
+	var err error
+	if ts.tokenFile != "" {
+		req, err = ts.workloadIdentityRequest()
+	} else {
+		req, err = ts.managedIdentityRequest()
+	}
+	if err != nil {
+		return "", err
+	}
+	resp, err := ts.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get azure access token")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		dt, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", errors.Errorf("failed to get azure access token: %s %s", resp.Status, bytes.TrimSpace(dt))
+	}
+	var tr struct {
+		AccessToken string `json:"access_token"`
+		// ExpiresIn is a string for managed identities and a number for
+		// workload identity
+		ExpiresIn json.RawMessage `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", errors.Wrap(err, "invalid azure access token response")
+	}
+	if tr.AccessToken == "" {
+		return "", errors.Errorf("no azure access token returned")
+	}
+	expiresIn, err := strconv.ParseInt(strings.Trim(string(tr.ExpiresIn), `"`), 10, 64)
+	if err != nil {
+		return "", errors.Errorf("invalid expiry %s of azure access token", tr.ExpiresIn)
+	}
+	ts.token = tr.AccessToken
+	ts.expiry = ts.now().Add(time.Duration(expiresIn) * time.Second)
+	return ts.token, nil
+}
+
+func (ts *tokenSource) managedIdentityRequest() (*http.Request, error) {
+	q := url.Values{
+		"api-version": {"2018-02-01"},
+		"resource":    {storageResource},
+	}
+	if ts.clientID != "" {
+		q.Set("client_id", ts.clientID)
+	}
+	req, err := http.NewRequest(http.MethodGet, ts.imdsURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Metadata", "true")
+	return req, nil
+}
+
+func (ts *tokenSource) workloadIdentityRequest() (*http.Request, error) {
+	// the federated token is rotated by the kubelet, read it for every
+	// exchange
+	assertion, err := ioutil.ReadFile(ts.tokenFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read federated token")
+	}
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_id":             {ts.clientID},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {strings.TrimSpace(string(assertion))},
+		"scope":                 {storageResource + ".default"},
+	}
+	u := strings.TrimSuffix(ts.authorityHost, "/") + "/" + url.PathEscape(ts.tenantID) + "/oauth2/v2.0/token"
+	req, err := http.NewRequest(http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// client is a minimal client of the Blob service REST API
+type client struct {
+	httpClient *http.Client
+	// containerURL is the URL of the container without query
+	containerURL string
+	// sas is the shared access signature, requests are authorized with
+	// tokens without it
+	sas       url.Values
+	tokens    *tokenSource
+	blockSize int64
+}
+
+func (c *client) blobURL(key string, query url.Values) string {
+	q := url.Values{}
+	for k, v := range c.sas {
+		q[k] = v
+	}
+	for k, v := range query {
+		q[k] = v
+	}
+	u := c.containerURL + "/" + (&url.URL{Path: key}).EscapedPath()
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+// do authorizes and sends req. Responses with other status codes than ok
+// are returned as errors.
+func (c *client) do(req *http.Request, ok ...int) (*http.Response, error) {
+	req.Header.Set("x-ms-version", apiVersion)
+	if c.sas == nil {
+		token, err := c.tokens.Token(req.Context())
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to %s %s", req.Method, req.URL.Path)
+	}
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	return nil, responseError(req, resp)
+}
+
+func (c *client) newRequest(ctx context.Context, method, u string, body io.Reader, size int64) (*http.Request, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.ContentLength = size
+	}
+	return req, nil
+}
+
+// Exists returns false if the blob with key doesn't exist
+func (c *client) Exists(ctx context.Context, key string) (bool, error) {
+	req, err := c.newRequest(ctx, http.MethodHead, c.blobURL(key, nil), nil, 0)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.do(req, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// Get returns the contents of the blob with key from offset off. nil is
+// returned if the blob doesn't exist.
+func (c *client) Get(ctx context.Context, key string, off int64) (io.ReadCloser, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, c.blobURL(key, nil), nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if off > 0 {
+		req.Header.Set("x-ms-range", fmt.Sprintf("bytes=%d-", off))
+	}
+	resp, err := c.do(req, http.StatusOK, http.StatusPartialContent, http.StatusNotFound)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, nil
+	}
+	if off > 0 && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, errors.Errorf("range requests not supported for %s", key)
+	}
+	return resp.Body, nil
+}
+
+// Put uploads the block blob with key. Blobs larger than the block size are
+// uploaded in blocks that are committed with a block list.
+func (c *client) Put(ctx context.Context, key string, ra io.ReaderAt, size int64) error {
+	if size > c.blockSize {
+		return c.putBlocks(ctx, key, ra, size)
+	}
+	req, err := c.newRequest(ctx, http.MethodPut, c.blobURL(key, nil), io.NewSectionReader(ra, 0, size), size)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := c.do(req, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type blockList struct {
+	XMLName xml.Name `xml:"BlockList"`
+	Latest  []string `xml:"Latest"`
+}
+
+func (c *client) putBlocks(ctx context.Context, key string, ra io.ReaderAt, size int64) error {
+	if (size+c.blockSize-1)/c.blockSize > maxBlocks {
+		return errors.Errorf("blob %s of %d bytes exceeds %d blocks, increase %s", key, size, maxBlocks, attrBlockSize)
+	}
+	var bl blockList
+	for off := int64(0); off < size; off += c.blockSize {
+		n := c.blockSize
+		if size-off < n {
+			n = size - off
+		}
+		// block IDs of a blob must have the same length
+		id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", len(bl.Latest))))
+		req, err := c.newRequest(ctx, http.MethodPut, c.blobURL(key, url.Values{"comp": {"block"}, "blockid": {id}}), io.NewSectionReader(ra, off, n), n)
+		if err != nil {
+			return err
+		}
+		resp, err := c.do(req, http.StatusCreated)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		bl.Latest = append(bl.Latest, id)
+	}
+
+	dt, err := xml.Marshal(bl)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	dt = append([]byte(xml.Header), dt...)
+	req, err := c.newRequest(ctx, http.MethodPut, c.blobURL(key, url.Values{"comp": {"blocklist"}}), bytes.NewReader(dt), int64(len(dt)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("x-ms-blob-content-type", "application/octet-stream")
+	resp, err := c.do(req, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type azError struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func responseError(req *http.Request, resp *http.Response) error {
+	dt, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var e azError
+	if err := xml.Unmarshal(bytes.TrimSpace(dt), &e); err == nil && e.Code != "" {
+		return errors.Errorf("failed to %s %s: %s: %s", req.Method, req.URL.Path, e.Code, firstLine(e.Message))
+	}
+	// responses of HEAD requests have no body
+	if code := resp.Header.Get("x-ms-error-code"); code != "" {
+		return errors.Errorf("failed to %s %s: %s", req.Method, req.URL.Path, code)
+	}
+	return errors.Errorf("failed to %s %s: %s", req.Method, req.URL.Path, http.StatusText(resp.StatusCode))
+}
+
+// firstLine returns the first line of the messages of the service, the
+// others contain request IDs and times
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i != -1 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
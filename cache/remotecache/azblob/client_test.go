@@ -0,0 +1,231 @@
+package azblob
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToken(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/metadata/identity/oauth2/token":
+			q := r.URL.Query()
+			if r.Header.Get("Metadata") != "true" || q.Get("resource") != storageResource || q.Get("client_id") != "client" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, `{"access_token":"token%d","expires_in":"3600","token_type":"Bearer"}`, requests)
+		case "/tenant/oauth2/v2.0/token":
+			r.ParseForm()
+			if r.PostForm.Get("client_assertion") != "federated" || r.PostForm.Get("client_id") != "client" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `{"access_token":"token%d","expires_in":3600,"token_type":"Bearer"}`, requests)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	ts := &tokenSource{
+		httpClient: srv.Client(),
+		imdsURL:    srv.URL + "/metadata/identity/oauth2/token",
+		clientID:   "client",
+		now:        func() time.Time { return now },
+	}
+	token, err := ts.Token(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, "token1", token)
+
+	token, err = ts.Token(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, "token1", token)
+
+	// tokens are refreshed before they expire
+	now = now.Add(time.Hour - time.Minute)
+	token, err = ts.Token(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, "token2", token)
+	require.Equal(t, 2, requests)
+
+	tmpdir, err := ioutil.TempDir("", "azblob")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+	tokenFile := filepath.Join(tmpdir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("federated\n"), 0600))
+
+	ts = &tokenSource{
+		httpClient:    srv.Client(),
+		clientID:      "client",
+		tenantID:      "tenant",
+		authorityHost: srv.URL,
+		tokenFile:     tokenFile,
+		now:           time.Now,
+	}
+	token, err = ts.Token(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, "token3", token)
+}
+
+func TestClient(t *testing.T) {
+	s := newFakeBlobService()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	cfg, err := getConfig(map[string]string{
+		attrAccountURL: srv.URL + "/account",
+		attrContainer:  "cache",
+		attrSASToken:   "?sv=2020-10-02&sig=secret",
+		attrBlockSize:  "1024",
+	})
+	require.NoError(t, err)
+	cl, err := newClient(cfg)
+	require.NoError(t, err)
+	cl.httpClient = srv.Client()
+	ctx := context.TODO()
+
+	exists, err := cl.Exists(ctx, "blobs/sha256:small")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	small := []byte("small blob")
+	require.NoError(t, cl.Put(ctx, "blobs/sha256:small", bytes.NewReader(small), int64(len(small))))
+	exists, err = cl.Exists(ctx, "blobs/sha256:small")
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, 0, s.blocks)
+
+	large := bytes.Repeat([]byte("0123456789abcdef"), (2*1024+100)/16)
+	require.NoError(t, cl.Put(ctx, "blobs/sha256:large", bytes.NewReader(large), int64(len(large))))
+	require.Equal(t, 3, s.blocks)
+	require.Equal(t, large, s.blobs["blobs/sha256:large"])
+
+	rc, err := cl.Get(ctx, "blobs/sha256:large", 1027)
+	require.NoError(t, err)
+	dt, err := ioutil.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	require.Equal(t, large[1027:], dt)
+
+	rc, err = cl.Get(ctx, "manifests/missing", 0)
+	require.NoError(t, err)
+	require.Nil(t, rc)
+
+	cl.sas.Set("sig", "invalid")
+	_, err = cl.Exists(ctx, "blobs/sha256:small")
+	require.EqualError(t, err, "failed to HEAD /account/cache/blobs/sha256:small: AuthenticationFailed")
+}
+
+// fakeBlobService is an in-memory Blob service of the container cache that
+// is authorized with a SAS
+type fakeBlobService struct {
+	mu     sync.Mutex
+	blobs  map[string][]byte
+	staged map[string][]byte
+	blocks int
+}
+
+func newFakeBlobService() *fakeBlobService {
+	return &fakeBlobService{blobs: map[string][]byte{}, staged: map[string][]byte{}}
+}
+
+func (s *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("sig") != "secret" || r.Header.Get("x-ms-version") == "" {
+		w.Header().Set("x-ms-error-code", "AuthenticationFailed")
+		w.WriteHeader(http.StatusForbidden)
+		if r.Method != http.MethodHead {
+			fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><Error><Code>AuthenticationFailed</Code><Message>Server failed to authenticate the request.
+RequestId:1</Message></Error>`)
+		}
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/account/cache/")
+	if r.Method == http.MethodGet {
+		// the lock isn't held while the body is written as readers may
+		// leave it unread
+		s.serveBlob(w, r, key)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodHead:
+		if _, ok := s.blobs[key]; !ok {
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPut && q.Get("comp") == "block":
+		dt, _ := ioutil.ReadAll(r.Body)
+		s.staged[key+"#"+q.Get("blockid")] = dt
+		s.blocks++
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && q.Get("comp") == "blocklist":
+		var bl blockList
+		if err := xml.NewDecoder(r.Body).Decode(&bl); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ids := append([]string{}, bl.Latest...)
+		sort.Strings(ids)
+		var dt []byte
+		for i, id := range bl.Latest {
+			if ids[i] != id {
+				// ids are compared as strings by the service
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			dt = append(dt, s.staged[key+"#"+id]...)
+		}
+		s.blobs[key] = dt
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && r.Header.Get("x-ms-blob-type") == "BlockBlob":
+		dt, _ := ioutil.ReadAll(r.Body)
+		s.blobs[key] = dt
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeBlobService) serveBlob(w http.ResponseWriter, r *http.Request, key string) {
+	s.mu.Lock()
+	dt, ok := s.blobs[key]
+	if ok {
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><Error><Code>BlobNotFound</Code><Message>The specified blob does not exist.</Message></Error>`)
+		return
+	}
+	if rng := r.Header.Get("x-ms-range"); rng != "" {
+		off, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(dt[off:])
+		return
+	}
+	w.Write(dt)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/images"
 	v1 "github.com/moby/buildkit/cache/remotecache/v1"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/solver"
 	"github.com/moby/buildkit/util/compression"
@@ -43,7 +44,9 @@ func oneOffProgress(ctx context.Context, id string) func(err error) error {
 type Exporter interface {
 	solver.CacheExporterTarget
 	// Finalize finalizes and return metadata that are returned to the client
-	// e.g. ExporterResponseManifestDesc
+	// e.g. ExporterResponseManifestDesc. If a build exports to multiple
+	// caches, keys returned by more than one exporter are suffixed with
+	// "/<index>" of the exporter in the request.
 	Finalize(ctx context.Context) (map[string]string, error)
 }
 
@@ -51,19 +54,58 @@ const (
 	// ExportResponseManifestDesc is a key for the map returned from Exporter.Finalize.
 	// The map value is a JSON string of an OCI desciptor of a manifest.
 	ExporterResponseManifestDesc = "cache.manifest"
+
+	// AnnotationTTL is the annotation of the cache manifest with the duration,
+	// in time.ParseDuration format, after which importers ignore a cache
+	// result, counted from the time the result was created
+	AnnotationTTL = "moby.buildkit.cache.ttl"
 )
 
+// ParseTTL parses the cache ttl attribute key of a cache exporter. The ttl is
+// 0 if the attribute isn't set.
+func ParseTTL(attrs map[string]string, key string) (time.Duration, error) {
+	v, ok := attrs[key]
+	if !ok {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %s", key)
+	}
+	if d < 0 {
+		return 0, errors.Errorf("invalid %s %s", key, v)
+	}
+	return d, nil
+}
+
 type contentCacheExporter struct {
 	solver.CacheExporterTarget
 	chains   *v1.CacheChains
 	ingester content.Ingester
 	oci      bool
 	ref      string
+	ttl      time.Duration
+	artifact bool
 }
 
 func NewExporter(ingester content.Ingester, ref string, oci bool) Exporter {
+	return NewExpiringExporter(ingester, ref, oci, 0)
+}
+
+// NewExpiringExporter returns an exporter that stamps the cache manifest with
+// ttl, see AnnotationTTL. The cache doesn't expire if ttl is 0.
+func NewExpiringExporter(ingester content.Ingester, ref string, oci bool, ttl time.Duration) Exporter {
+	cc := v1.NewCacheChains()
+	return &contentCacheExporter{CacheExporterTarget: cc, chains: cc, ingester: ingester, oci: oci, ref: ref, ttl: ttl}
+}
+
+// NewArtifactExporter returns an exporter that writes the cache as an OCI 1.1
+// artifact instead of an index: an image manifest with the cache config as
+// config, the layers and the cache config media type as artifactType.
+// Registries that reject indexes of blobs that aren't manifests accept it.
+func NewArtifactExporter(ingester content.Ingester, ref string, ttl time.Duration) Exporter {
 	cc := v1.NewCacheChains()
-	return &contentCacheExporter{CacheExporterTarget: cc, chains: cc, ingester: ingester, oci: oci, ref: ref}
+	return &contentCacheExporter{CacheExporterTarget: cc, chains: cc, ingester: ingester, oci: true, ref: ref, ttl: ttl, artifact: true}
 }
 
 func (ce *contentCacheExporter) Finalize(ctx context.Context) (map[string]string, error) {
@@ -81,6 +123,8 @@ func (ce *contentCacheExporter) Finalize(ctx context.Context) (map[string]string
 
 		// Manifests references platform specific manifests.
 		Manifests []ocispecs.Descriptor `json:"manifests"`
+
+		Annotations map[string]string `json:"annotations,omitempty"`
 	}
 
 	var mfst manifestList
@@ -89,6 +133,11 @@ func (ce *contentCacheExporter) Finalize(ctx context.Context) (map[string]string
 	if ce.oci {
 		mfst.MediaType = ocispecs.MediaTypeImageIndex
 	}
+	if ce.ttl > 0 {
+		mfst.Annotations = map[string]string{
+			AnnotationTTL: ce.ttl.String(),
+		}
+	}
 
 	for _, l := range config.Layers {
 		dgstPair, ok := descs[l.Blob]
@@ -121,11 +170,18 @@ func (ce *contentCacheExporter) Finalize(ctx context.Context) (map[string]string
 	}
 	configDone(nil)
 
-	mfst.Manifests = append(mfst.Manifests, desc)
-
-	dt, err = json.Marshal(mfst)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to marshal manifest")
+	if ce.artifact {
+		dt, err = ce.artifactManifest(ctx, desc, mfst.Manifests, mfst.Annotations)
+		if err != nil {
+			return nil, err
+		}
+		mfst.MediaType = ocispecs.MediaTypeImageManifest
+	} else {
+		mfst.Manifests = append(mfst.Manifests, desc)
+		dt, err = json.Marshal(mfst)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal manifest")
+		}
 	}
 	dgst = digest.FromBytes(dt)
 
@@ -146,3 +202,47 @@ func (ce *contentCacheExporter) Finalize(ctx context.Context) (map[string]string
 	mfstDone(nil)
 	return res, nil
 }
+
+// artifactManifest returns the image manifest of the cache exported as an
+// artifact with config and layers
+func (ce *contentCacheExporter) artifactManifest(ctx context.Context, config ocispecs.Descriptor, layers []ocispecs.Descriptor, annotations map[string]string) ([]byte, error) {
+	if len(layers) == 0 {
+		// the image spec requires at least one layer
+		empty := []byte("{}")
+		desc := ocispecs.Descriptor{
+			Digest:    digest.FromBytes(empty),
+			Size:      int64(len(empty)),
+			MediaType: exptypes.MediaTypeEmptyJSON,
+		}
+		if err := content.WriteBlob(ctx, ce.ingester, desc.Digest.String(), bytes.NewReader(empty), desc); err != nil {
+			return nil, errors.Wrap(err, "error writing empty blob")
+		}
+		layers = []ocispecs.Descriptor{desc}
+	}
+
+	mfst := struct {
+		// MediaType is reserved in the OCI spec but
+		// excluded from go types.
+		MediaType string `json:"mediaType,omitempty"`
+		// ArtifactType was added in OCI 1.1
+		ArtifactType string `json:"artifactType,omitempty"`
+
+		ocispecs.Manifest
+	}{
+		MediaType:    ocispecs.MediaTypeImageManifest,
+		ArtifactType: v1.CacheConfigMediaTypeV0,
+		Manifest: ocispecs.Manifest{
+			Versioned: specs.Versioned{
+				SchemaVersion: 2,
+			},
+			Config:      config,
+			Layers:      layers,
+			Annotations: annotations,
+		},
+	}
+	dt, err := json.Marshal(mfst)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal manifest")
+	}
+	return dt, nil
+}
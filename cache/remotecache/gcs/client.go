@@ -0,0 +1,268 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// chunkAlignment is the alignment of the chunks of resumable uploads
+	// except the last one
+	chunkAlignment = 256 << 10
+	// statusResumeIncomplete is returned for the chunks of a resumable
+	// upload before the last one
+	statusResumeIncomplete = 308
+
+	defaultMetadataHost = "metadata.google.internal"
+)
+
+// tokenSource returns the OAuth2 access tokens the requests are authorized
+// with. Without a static token the tokens of the service account of the
+// instance are fetched from the metadata server, which is how workload
+// identity provides credentials on GKE.
+type tokenSource struct {
+	httpClient  *http.Client
+	static      string
+	metadataURL string
+	now         func() time.Time
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func (ts *tokenSource) Token(ctx context.Context) (string, error) {
+	if ts.static != "" {
+		return ts.static, nil
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	// refresh a minute early so that tokens don't expire in flight
+	if ts.token != "" && ts.now().Add(time.Minute).Before(ts.expiry) {
+		return ts.token, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.metadataURL+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := ts.httpClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get access token from metadata server")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("failed to get access token from metadata server: %s", resp.Status)
+	}
+	var tr struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", errors.Wrap(err, "invalid access token response of metadata server")
+	}
+	if tr.AccessToken == "" {
+		return "", errors.Errorf("metadata server returned no access token")
+	}
+	ts.token = tr.AccessToken
+	ts.expiry = ts.now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	return ts.token, nil
+}
+
+// client is a minimal client of the JSON API of Cloud Storage
+type client struct {
+	httpClient *http.Client
+	endpoint   string
+	bucket     string
+	tokens     *tokenSource
+	chunkSize  int64
+}
+
+func (c *client) objectURL(key string, query url.Values) string {
+	u := c.endpoint + "/storage/v1/b/" + url.PathEscape(c.bucket) + "/o/" + url.PathEscape(key)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+func (c *client) uploadURL(key string, uploadType string) string {
+	return c.endpoint + "/upload/storage/v1/b/" + url.PathEscape(c.bucket) + "/o?" + url.Values{
+		"uploadType": {uploadType},
+		"name":       {key},
+	}.Encode()
+}
+
+// do authorizes and sends req. Responses with other status codes than ok
+// are returned as errors.
+func (c *client) do(req *http.Request, ok ...int) (*http.Response, error) {
+	token, err := c.tokens.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to %s %s", req.Method, req.URL.Path)
+	}
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	return nil, responseError(req, resp)
+}
+
+func (c *client) newRequest(ctx context.Context, method, u string, body io.Reader, size int64) (*http.Request, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.ContentLength = size
+	}
+	return req, nil
+}
+
+// Exists returns false if the object with key doesn't exist
+func (c *client) Exists(ctx context.Context, key string) (bool, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, c.objectURL(key, url.Values{"fields": {"name"}}), nil, 0)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.do(req, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// Get returns the contents of the object with key from offset off. nil is
+// returned if the object doesn't exist.
+func (c *client) Get(ctx context.Context, key string, off int64) (io.ReadCloser, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, c.objectURL(key, url.Values{"alt": {"media"}}), nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if off > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", off))
+	}
+	resp, err := c.do(req, http.StatusOK, http.StatusPartialContent, http.StatusNotFound)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, nil
+	}
+	if off > 0 && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, errors.Errorf("range requests not supported for %s", key)
+	}
+	return resp.Body, nil
+}
+
+// Put uploads the object with key. Objects larger than the chunk size are
+// uploaded with a resumable upload.
+func (c *client) Put(ctx context.Context, key string, ra io.ReaderAt, size int64) error {
+	if size > c.chunkSize {
+		return c.putResumable(ctx, key, ra, size)
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, c.uploadURL(key, "media"), io.NewSectionReader(ra, 0, size), size)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *client) putResumable(ctx context.Context, key string, ra io.ReaderAt, size int64) error {
+	req, err := c.newRequest(ctx, http.MethodPost, c.uploadURL(key, "resumable"), nil, 0)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Upload-Content-Type", "application/octet-stream")
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return errors.Errorf("no session URI for resumable upload of %s", key)
+	}
+
+	for off := int64(0); off < size; {
+		n := c.chunkSize
+		if size-off < n {
+			n = size - off
+		}
+		req, err := c.newRequest(ctx, http.MethodPut, session, io.NewSectionReader(ra, off, n), n)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", off, off+n-1, size))
+		resp, err := c.do(req, http.StatusOK, http.StatusCreated, statusResumeIncomplete)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != statusResumeIncomplete {
+			return nil
+		}
+		// the server may persist less than the chunk, continue after the
+		// persisted range
+		next := int64(0)
+		if rng := resp.Header.Get("Range"); rng != "" {
+			if i := strings.LastIndex(rng, "-"); i != -1 {
+				if last, err := strconv.ParseInt(rng[i+1:], 10, 64); err == nil {
+					next = last + 1
+				}
+			}
+		}
+		if next <= off || next > off+n {
+			return errors.Errorf("invalid persisted range %q of resumable upload of %s", resp.Header.Get("Range"), key)
+		}
+		off = next
+	}
+	return errors.Errorf("resumable upload of %s didn't complete", key)
+}
+
+type gcsError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func responseError(req *http.Request, resp *http.Response) error {
+	dt, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var e gcsError
+	if err := json.Unmarshal(bytes.TrimSpace(dt), &e); err == nil && e.Error.Message != "" {
+		return errors.Errorf("failed to %s %s: %s", req.Method, req.URL.Path, e.Error.Message)
+	}
+	return errors.Errorf("failed to %s %s: %s", req.Method, req.URL.Path, http.StatusText(resp.StatusCode))
+}
@@ -0,0 +1,183 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToken(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token":"token%d","expires_in":3600,"token_type":"Bearer"}`, requests)
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	ts := &tokenSource{
+		httpClient:  srv.Client(),
+		metadataURL: srv.URL,
+		now:         func() time.Time { return now },
+	}
+	token, err := ts.Token(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, "token1", token)
+
+	token, err = ts.Token(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, "token1", token)
+
+	// tokens are refreshed before they expire
+	now = now.Add(time.Hour - 30*time.Second)
+	token, err = ts.Token(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, "token2", token)
+	require.Equal(t, 2, requests)
+}
+
+func TestClient(t *testing.T) {
+	s := newFakeGCS()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	cl, err := newClient(&Config{
+		Bucket:      "cache",
+		EndpointURL: srv.URL,
+		AccessToken: "token",
+		ChunkSize:   chunkAlignment,
+	})
+	require.NoError(t, err)
+	cl.httpClient = srv.Client()
+	ctx := context.TODO()
+
+	exists, err := cl.Exists(ctx, "blobs/sha256:small")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	small := []byte("small blob")
+	require.NoError(t, cl.Put(ctx, "blobs/sha256:small", bytes.NewReader(small), int64(len(small))))
+	exists, err = cl.Exists(ctx, "blobs/sha256:small")
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, 0, s.resumable)
+
+	large := bytes.Repeat([]byte("0123456789abcdef"), (2*chunkAlignment+100)/16)
+	require.NoError(t, cl.Put(ctx, "blobs/sha256:large", bytes.NewReader(large), int64(len(large))))
+	require.Equal(t, 1, s.resumable)
+	require.Equal(t, large, s.objects["blobs/sha256:large"])
+
+	rc, err := cl.Get(ctx, "blobs/sha256:large", chunkAlignment+3)
+	require.NoError(t, err)
+	dt, err := ioutil.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	require.Equal(t, large[chunkAlignment+3:], dt)
+
+	rc, err = cl.Get(ctx, "manifests/missing", 0)
+	require.NoError(t, err)
+	require.Nil(t, rc)
+}
+
+// fakeGCS is an in-memory server of the JSON API that persists at most
+// half of the chunks of resumable uploads
+type fakeGCS struct {
+	mu        sync.Mutex
+	objects   map[string][]byte
+	uploads   map[string][]byte
+	resumable int
+}
+
+func newFakeGCS() *fakeGCS {
+	return &fakeGCS{objects: map[string][]byte{}, uploads: map[string][]byte{}}
+}
+
+func (s *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":{"code":401,"message":"unauthorized"}}`)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Query().Get("alt") == "media" {
+		// the lock isn't held while the body is written as readers may
+		// leave it unread
+		s.serveObject(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/storage/v1/b/cache/o/"):
+		if _, ok := s.objects[strings.TrimPrefix(r.URL.Path, "/storage/v1/b/cache/o/")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"name":"object"}`)
+	case r.Method == http.MethodPost && q.Get("uploadType") == "media":
+		dt, _ := ioutil.ReadAll(r.Body)
+		s.objects[q.Get("name")] = dt
+	case r.Method == http.MethodPost && q.Get("uploadType") == "resumable":
+		id := strconv.Itoa(len(s.uploads) + 1)
+		s.uploads[id] = nil
+		s.resumable++
+		w.Header().Set("Location", "http://"+r.Host+"/upload/session/"+id+"?name="+q.Get("name"))
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/upload/session/"):
+		id := strings.TrimPrefix(r.URL.Path, "/upload/session/")
+		var start, end, size int
+		if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil || start != len(s.uploads[id]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		dt, _ := ioutil.ReadAll(r.Body)
+		if end+1 < size {
+			dt = dt[:len(dt)/2]
+		}
+		s.uploads[id] = append(s.uploads[id], dt...)
+		if len(s.uploads[id]) < size {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(s.uploads[id])-1))
+			w.WriteHeader(statusResumeIncomplete)
+			return
+		}
+		s.objects[q.Get("name")] = s.uploads[id]
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeGCS) serveObject(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	dt, ok := s.objects[strings.TrimPrefix(r.URL.Path, "/storage/v1/b/cache/o/")]
+	if ok {
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"code":404,"message":"not found"}}`)
+		return
+	}
+	if rng := r.Header.Get("Range"); rng != "" {
+		off, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(dt[off:])
+		return
+	}
+	w.Write(dt)
+}
@@ -0,0 +1,160 @@
+package gcs
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moby/buildkit/cache/remotecache"
+	"github.com/moby/buildkit/cache/remotecache/objectstore"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/util/tracing"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	attrBucket      = "bucket"
+	attrPrefix      = "prefix"
+	attrName        = "name"
+	attrIndexURL    = "index_url"
+	attrEndpointURL = "endpoint_url"
+	attrAccessToken = "access_token"
+	attrChunkSize   = "upload_chunk_size"
+
+	defaultEndpoint  = "https://storage.googleapis.com"
+	defaultChunkSize = 64 << 20
+)
+
+type Config struct {
+	Bucket string
+	// Prefix is prepended to the names of the blob and manifest objects
+	Prefix string
+	// Name of the cache manifest, defaults to buildkit
+	Name string
+	// IndexURL is the URL of a key-value store, e.g. redis://host:6379/0,
+	// that the cache chains are written to instead of the cache manifest
+	IndexURL string
+	// EndpointURL of the JSON API, e.g. of an emulator, defaults to Google
+	EndpointURL string
+	// AccessToken is a static OAuth2 access token. Without it the tokens
+	// of the service account of the instance are used, e.g. the one of the
+	// Kubernetes service account with workload identity on GKE.
+	AccessToken string
+	// ChunkSize is the size of the chunks of resumable uploads, blobs up to
+	// this size are uploaded with a single request
+	ChunkSize int64
+}
+
+func getConfig(attrs map[string]string) (*Config, error) {
+	cfg := &Config{
+		Bucket:      attrs[attrBucket],
+		Prefix:      attrs[attrPrefix],
+		Name:        attrs[attrName],
+		IndexURL:    attrs[attrIndexURL],
+		EndpointURL: attrs[attrEndpointURL],
+		AccessToken: attrs[attrAccessToken],
+		ChunkSize:   defaultChunkSize,
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.Errorf("bucket not set for gcs cache")
+	}
+	if cfg.Name == "" {
+		cfg.Name = "buildkit"
+	}
+	if v, ok := attrs[attrChunkSize]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n%chunkAlignment != 0 {
+			return nil, errors.Errorf("invalid %s %q, expected a multiple of %d bytes", attrChunkSize, v, chunkAlignment)
+		}
+		cfg.ChunkSize = n
+	}
+	return cfg, nil
+}
+
+func newClient(c *Config) (*client, error) {
+	endpoint := c.EndpointURL
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", attrEndpointURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("invalid %s %q, expected http or https URL", attrEndpointURL, endpoint)
+	}
+	// GCE_METADATA_HOST is the override of the metadata server of the
+	// Google client libraries
+	metadataHost := os.Getenv("GCE_METADATA_HOST")
+	if metadataHost == "" {
+		metadataHost = defaultMetadataHost
+	}
+	return &client{
+		httpClient: tracing.DefaultClient,
+		endpoint:   strings.TrimSuffix(u.String(), "/"),
+		bucket:     c.Bucket,
+		tokens: &tokenSource{
+			httpClient:  tracing.DefaultClient,
+			static:      c.AccessToken,
+			metadataURL: "http://" + metadataHost,
+			now:         time.Now,
+		},
+		chunkSize: c.ChunkSize,
+	}, nil
+}
+
+// storeConfig returns the location of the cache in the gcs store
+func storeConfig(c *Config) objectstore.Config {
+	return objectstore.Config{
+		Prefix:      c.Prefix,
+		Name:        c.Name,
+		IndexURL:    c.IndexURL,
+		IndexPrefix: "gcs:" + c.Bucket + "/",
+	}
+}
+
+// ResolveCacheExporterFunc for GCS cache exporter.
+func ResolveCacheExporterFunc() remotecache.ResolveCacheExporterFunc {
+	return func(ctx context.Context, g session.Group, attrs map[string]string) (remotecache.Exporter, error) {
+		cfg, err := getConfig(attrs)
+		if err != nil {
+			return nil, err
+		}
+		return NewExporter(cfg)
+	}
+}
+
+func NewExporter(c *Config) (remotecache.Exporter, error) {
+	cl, err := newClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return objectstore.NewExporter(cl, storeConfig(c)), nil
+}
+
+// ResolveCacheImporterFunc for GCS cache importer.
+func ResolveCacheImporterFunc() remotecache.ResolveCacheImporterFunc {
+	return func(ctx context.Context, g session.Group, attrs map[string]string) (remotecache.Importer, ocispecs.Descriptor, error) {
+		cfg, err := getConfig(attrs)
+		if err != nil {
+			return nil, ocispecs.Descriptor{}, err
+		}
+		i, err := NewImporter(cfg)
+		if err != nil {
+			return nil, ocispecs.Descriptor{}, err
+		}
+		return i, ocispecs.Descriptor{}, nil
+	}
+}
+
+func NewImporter(c *Config) (remotecache.Importer, error) {
+	cl, err := newClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return objectstore.NewImporter(cl, storeConfig(c)), nil
+}
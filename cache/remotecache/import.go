@@ -9,9 +9,11 @@ import (
 
 	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
 	v1 "github.com/moby/buildkit/cache/remotecache/v1"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/util/bklog"
 	"github.com/moby/buildkit/util/imageutil"
 	"github.com/moby/buildkit/worker"
 	digest "github.com/opencontainers/go-digest"
@@ -37,11 +39,34 @@ func NewImporter(provider content.Provider) Importer {
 	return &contentCacheImporter{provider: provider}
 }
 
+// NewPlatformImporter returns an importer that only imports the inline cache
+// of the manifests of an image index whose platform matches p. Manifests
+// without a platform are always imported.
+func NewPlatformImporter(provider content.Provider, p platforms.Matcher) Importer {
+	return &contentCacheImporter{provider: provider, platforms: p}
+}
+
 type contentCacheImporter struct {
-	provider content.Provider
+	provider  content.Provider
+	platforms platforms.Matcher
 }
 
-func (ci *contentCacheImporter) Resolve(ctx context.Context, desc ocispecs.Descriptor, id string, w worker.Worker) (solver.CacheManager, error) {
+func (ci *contentCacheImporter) Resolve(ctx context.Context, desc ocispecs.Descriptor, id string, w worker.Worker) (_ solver.CacheManager, err error) {
+	if corruptManifests.blacklisted(desc.Digest) {
+		return nil, errors.Errorf("cache manifest %s is ignored after delivering corrupt content", desc.Digest)
+	}
+	defer func() {
+		if errors.Is(err, ErrCorruptContent) {
+			corruptManifests.add(desc.Digest)
+		}
+	}()
+
+	provider := &verifyingProvider{
+		Provider: ci.provider,
+		manifest: desc.Digest,
+		tracker:  corruptManifests,
+	}
+
 	dt, err := readBlob(ctx, ci.provider, desc)
 	if err != nil {
 		return nil, err
@@ -52,6 +77,12 @@ func (ci *contentCacheImporter) Resolve(ctx context.Context, desc ocispecs.Descr
 		return nil, err
 	}
 
+	// caches exported as artifacts have the cache config as image config
+	var am ocispecs.Manifest
+	if err := json.Unmarshal(dt, &am); err == nil && am.Config.MediaType == v1.CacheConfigMediaTypeV0 {
+		mfst.Manifests = append(am.Layers, am.Config)
+	}
+
 	allLayers := v1.DescriptorProvider{}
 
 	var configDesc ocispecs.Descriptor
@@ -63,7 +94,7 @@ func (ci *contentCacheImporter) Resolve(ctx context.Context, desc ocispecs.Descr
 		}
 		allLayers[m.Digest] = v1.DescriptorProviderPair{
 			Descriptor: m,
-			Provider:   ci.provider,
+			Provider:   provider,
 		}
 	}
 
@@ -77,7 +108,7 @@ func (ci *contentCacheImporter) Resolve(ctx context.Context, desc ocispecs.Descr
 	}
 
 	if configDesc.Digest == "" {
-		return ci.importInlineCache(ctx, dt, id, w)
+		return ci.importInlineCache(ctx, dt, id, w, provider)
 	}
 
 	dt, err = readBlob(ctx, ci.provider, configDesc)
@@ -85,8 +116,16 @@ func (ci *contentCacheImporter) Resolve(ctx context.Context, desc ocispecs.Descr
 		return nil, err
 	}
 
+	var config v1.CacheConfig
+	if err := json.Unmarshal(dt, &config); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if n := dropExpired(&config, ttl(mfst.Annotations), time.Now()); n > 0 {
+		bklog.G(ctx).Debugf("skipping %d expired cache results of %s", n, desc.Digest)
+	}
+
 	cc := v1.NewCacheChains()
-	if err := v1.Parse(dt, allLayers, cc); err != nil {
+	if err := v1.ParseConfig(config, allLayers, cc); err != nil {
 		return nil, err
 	}
 
@@ -97,6 +136,39 @@ func (ci *contentCacheImporter) Resolve(ctx context.Context, desc ocispecs.Descr
 	return solver.NewCacheManager(ctx, id, keysStorage, resultStorage), nil
 }
 
+// ttl returns the ttl of the cache manifest with annotations. Manifests with
+// an invalid ttl never expire.
+func ttl(annotations map[string]string) time.Duration {
+	d, err := time.ParseDuration(annotations[AnnotationTTL])
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// dropExpired removes the results of config that were created more than ttl
+// before now and returns how many were removed. Records are kept so that the
+// links between them stay valid. Results without a creation time never
+// expire.
+func dropExpired(config *v1.CacheConfig, ttl time.Duration, now time.Time) int {
+	if ttl == 0 {
+		return 0
+	}
+	var n int
+	for i, rec := range config.Records {
+		results := rec.Results[:0]
+		for _, res := range rec.Results {
+			if !res.CreatedAt.IsZero() && now.After(res.CreatedAt.Add(ttl)) {
+				n++
+				continue
+			}
+			results = append(results, res)
+		}
+		config.Records[i].Results = results
+	}
+	return n
+}
+
 func readBlob(ctx context.Context, provider content.Provider, desc ocispecs.Descriptor) ([]byte, error) {
 	maxBlobSize := int64(1 << 20)
 	if desc.Size > maxBlobSize {
@@ -115,13 +187,22 @@ func readBlob(ctx context.Context, provider content.Provider, desc ocispecs.Desc
 			}
 		}
 	}
-	return dt, errors.WithStack(err)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !desc.Digest.Algorithm().Available() {
+		return dt, nil
+	}
+	if dgst := desc.Digest.Algorithm().FromBytes(dt); dgst != desc.Digest {
+		return nil, errors.Wrapf(ErrCorruptContent, "expected %s, got %s", desc.Digest, dgst)
+	}
+	return dt, nil
 }
 
-func (ci *contentCacheImporter) importInlineCache(ctx context.Context, dt []byte, id string, w worker.Worker) (solver.CacheManager, error) {
+func (ci *contentCacheImporter) importInlineCache(ctx context.Context, dt []byte, id string, w worker.Worker, provider content.Provider) (solver.CacheManager, error) {
 	m := map[digest.Digest][]byte{}
 
-	if err := ci.allDistributionManifests(ctx, dt, m); err != nil {
+	if err := ci.allDistributionManifests(ctx, dt, m, provider); err != nil {
 		return nil, err
 	}
 
@@ -150,7 +231,7 @@ func (ci *contentCacheImporter) importInlineCache(ctx context.Context, dt []byte
 					}
 				}
 
-				p, err := content.ReadBlob(ctx, ci.provider, m.Config)
+				p, err := content.ReadBlob(ctx, provider, m.Config)
 				if err != nil {
 					return errors.WithStack(err)
 				}
@@ -194,7 +275,7 @@ func (ci *contentCacheImporter) importInlineCache(ctx context.Context, dt []byte
 					m.Annotations["containerd.io/uncompressed"] = img.Rootfs.DiffIDs[i].String()
 					layers[m.Digest] = v1.DescriptorProviderPair{
 						Descriptor: m,
-						Provider:   ci.provider,
+						Provider:   provider,
 					}
 					config.Layers = append(config.Layers, v1.CacheLayer{
 						Blob:        m.Digest,
@@ -235,7 +316,7 @@ func (ci *contentCacheImporter) importInlineCache(ctx context.Context, dt []byte
 	return solver.NewCombinedCacheManager(cms, nil), nil
 }
 
-func (ci *contentCacheImporter) allDistributionManifests(ctx context.Context, dt []byte, m map[digest.Digest][]byte) error {
+func (ci *contentCacheImporter) allDistributionManifests(ctx context.Context, dt []byte, m map[digest.Digest][]byte, provider content.Provider) error {
 	mt, err := imageutil.DetectManifestBlobMediaType(dt)
 	if err != nil {
 		return err
@@ -254,11 +335,14 @@ func (ci *contentCacheImporter) allDistributionManifests(ctx context.Context, dt
 			if _, ok := m[d.Digest]; ok {
 				continue
 			}
-			p, err := content.ReadBlob(ctx, ci.provider, d)
+			if ci.platforms != nil && d.Platform != nil && !ci.platforms.Match(*d.Platform) {
+				continue
+			}
+			p, err := content.ReadBlob(ctx, provider, d)
 			if err != nil {
 				return errors.WithStack(err)
 			}
-			if err := ci.allDistributionManifests(ctx, p, m); err != nil {
+			if err := ci.allDistributionManifests(ctx, p, m, provider); err != nil {
 				return err
 			}
 		}
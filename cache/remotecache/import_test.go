@@ -0,0 +1,140 @@
+package remotecache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/platforms"
+	v1 "github.com/moby/buildkit/cache/remotecache/v1"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/util/contentutil"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllDistributionManifestsPlatforms(t *testing.T) {
+	ctx := context.TODO()
+	b := contentutil.NewBuffer()
+
+	write := func(v interface{}, mediaType string) ocispecs.Descriptor {
+		dt, err := json.Marshal(v)
+		require.NoError(t, err)
+		desc := ocispecs.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(dt), Size: int64(len(dt))}
+		require.NoError(t, content.WriteBlob(ctx, b, desc.Digest.String(), bytes.NewReader(dt), desc))
+		return desc
+	}
+	manifest := func(config string) ocispecs.Descriptor {
+		return write(ocispecs.Manifest{
+			Config: ocispecs.Descriptor{MediaType: ocispecs.MediaTypeImageConfig, Digest: digest.FromString(config)},
+		}, ocispecs.MediaTypeImageManifest)
+	}
+
+	amd64 := manifest("amd64")
+	amd64.Platform = &ocispecs.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := manifest("arm64")
+	arm64.Platform = &ocispecs.Platform{OS: "linux", Architecture: "arm64"}
+	noPlatform := manifest("none")
+	idx := ocispecs.Index{Manifests: []ocispecs.Descriptor{amd64, arm64, noPlatform}}
+	idx.SchemaVersion = 2
+	dt, err := json.Marshal(idx)
+	require.NoError(t, err)
+
+	ci := NewImporter(b).(*contentCacheImporter)
+	m := map[digest.Digest][]byte{}
+	require.NoError(t, ci.allDistributionManifests(ctx, dt, m, b))
+	require.Equal(t, 3, len(m))
+
+	ci = NewPlatformImporter(b, platforms.Any(platforms.MustParse("linux/arm64"))).(*contentCacheImporter)
+	m = map[digest.Digest][]byte{}
+	require.NoError(t, ci.allDistributionManifests(ctx, dt, m, b))
+	require.Equal(t, 2, len(m))
+	require.Contains(t, m, arm64.Digest)
+	require.Contains(t, m, noPlatform.Digest)
+}
+
+func TestExpiringExporter(t *testing.T) {
+	ctx := context.TODO()
+	b := contentutil.NewBuffer()
+
+	res, err := NewExpiringExporter(b, "", true, time.Hour).Finalize(ctx)
+	require.NoError(t, err)
+	var desc ocispecs.Descriptor
+	require.NoError(t, json.Unmarshal([]byte(res[ExporterResponseManifestDesc]), &desc))
+	dt, err := content.ReadBlob(ctx, b, desc)
+	require.NoError(t, err)
+	var mfst ocispecs.Index
+	require.NoError(t, json.Unmarshal(dt, &mfst))
+	require.Equal(t, time.Hour, ttl(mfst.Annotations))
+
+	// manifests without a valid ttl never expire
+	require.Equal(t, time.Duration(0), ttl(nil))
+	require.Equal(t, time.Duration(0), ttl(map[string]string{AnnotationTTL: "tomorrow"}))
+
+	res, err = NewExporter(b, "", true).Finalize(ctx)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(res[ExporterResponseManifestDesc]), &desc))
+	dt, err = content.ReadBlob(ctx, b, desc)
+	require.NoError(t, err)
+	mfst = ocispecs.Index{}
+	require.NoError(t, json.Unmarshal(dt, &mfst))
+	require.NotContains(t, mfst.Annotations, AnnotationTTL)
+}
+
+func TestDropExpired(t *testing.T) {
+	now := time.Now()
+	config := v1.CacheConfig{
+		Records: []v1.CacheRecord{
+			{Results: []v1.CacheResult{
+				{LayerIndex: 0, CreatedAt: now.Add(-2 * time.Hour)},
+				{LayerIndex: 1, CreatedAt: now.Add(-time.Minute)},
+			}},
+			{Results: []v1.CacheResult{
+				{LayerIndex: 2},
+			}},
+			{Inputs: [][]v1.CacheInput{{{LinkIndex: 0}}}},
+		},
+	}
+
+	require.Equal(t, 0, dropExpired(&config, 0, now))
+	require.Equal(t, 2, len(config.Records[0].Results))
+
+	require.Equal(t, 1, dropExpired(&config, time.Hour, now))
+	require.Equal(t, 3, len(config.Records))
+	require.Equal(t, []v1.CacheResult{{LayerIndex: 1, CreatedAt: now.Add(-time.Minute)}}, config.Records[0].Results)
+	// results without a creation time never expire
+	require.Equal(t, 1, len(config.Records[1].Results))
+}
+
+func TestArtifactExporter(t *testing.T) {
+	ctx := context.TODO()
+	b := contentutil.NewBuffer()
+
+	res, err := NewArtifactExporter(b, "", time.Hour).Finalize(ctx)
+	require.NoError(t, err)
+	var desc ocispecs.Descriptor
+	require.NoError(t, json.Unmarshal([]byte(res[ExporterResponseManifestDesc]), &desc))
+	require.Equal(t, ocispecs.MediaTypeImageManifest, desc.MediaType)
+
+	dt, err := content.ReadBlob(ctx, b, desc)
+	require.NoError(t, err)
+	var mfst struct {
+		MediaType    string `json:"mediaType"`
+		ArtifactType string `json:"artifactType"`
+		ocispecs.Manifest
+	}
+	require.NoError(t, json.Unmarshal(dt, &mfst))
+	require.Equal(t, ocispecs.MediaTypeImageManifest, mfst.MediaType)
+	require.Equal(t, v1.CacheConfigMediaTypeV0, mfst.ArtifactType)
+	require.Equal(t, v1.CacheConfigMediaTypeV0, mfst.Config.MediaType)
+	require.Equal(t, 1, len(mfst.Layers))
+	require.Equal(t, exptypes.MediaTypeEmptyJSON, mfst.Layers[0].MediaType)
+	require.Contains(t, mfst.Annotations, AnnotationTTL)
+
+	_, err = NewImporter(b).Resolve(ctx, desc, "test", nil)
+	require.NoError(t, err)
+}
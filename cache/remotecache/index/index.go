@@ -0,0 +1,226 @@
+// Package index stores the cache chains of remote caches in a key-value
+// store, e.g. Redis, separately from their blobs. Importers query the index
+// for the cache keys of a build instead of downloading the cache manifest of
+// all the keys, which is slow for large caches exported with mode=max.
+//
+// Cache keys with inputs get stable IDs so that the exports of different
+// builds are merged in the index.
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "github.com/moby/buildkit/cache/remotecache/v1"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// Store is the key-value store of an index
+type Store interface {
+	// Get returns the value of key, nil if it doesn't exist
+	Get(ctx context.Context, key string) ([]byte, error)
+	// SetMembers returns the members of the set of key
+	SetMembers(ctx context.Context, key string) ([]string, error)
+	// Apply writes ops in a single request if the store supports it
+	Apply(ctx context.Context, ops []Op) error
+	Close() error
+}
+
+// Op sets the value of a key or adds members to the set of a key
+type Op struct {
+	Key     string
+	Value   []byte
+	Members []string
+}
+
+// result is the value of the result keys
+type result struct {
+	CreatedAt time.Time             `json:"createdAt,omitempty"`
+	Layers    []ocispecs.Descriptor `json:"layers"`
+}
+
+// backlink is a member of the backlinks sets
+type backlink struct {
+	ID       string        `json:"id"`
+	Input    int           `json:"input"`
+	Digest   digest.Digest `json:"digest"`
+	Selector string        `json:"selector,omitempty"`
+}
+
+func keyKey(prefix, id string) string {
+	return prefix + "key:" + id
+}
+
+func linksKey(prefix, id string, input int, dgst digest.Digest, selector string) string {
+	return fmt.Sprintf("%slinks:%s:%d:%s:%s", prefix, id, input, dgst, selector)
+}
+
+func backlinksKey(prefix, id string) string {
+	return prefix + "backlinks:" + id
+}
+
+func resultsKey(prefix, id string) string {
+	return prefix + "results:" + id
+}
+
+func resultKey(prefix, resultID string) string {
+	return prefix + "result:" + resultID
+}
+
+func idsKey(prefix, resultID string) string {
+	return prefix + "ids:" + resultID
+}
+
+// Write adds the records of config to the index in s under prefix. The
+// layers of config must have annotations.
+func Write(ctx context.Context, s Store, prefix string, config *v1.CacheConfig) error {
+	ids, err := recordIDs(config)
+	if err != nil {
+		return err
+	}
+
+	var ops []Op
+	for i, rec := range config.Records {
+		id := ids[i]
+		ops = append(ops, Op{Key: keyKey(prefix, id), Value: []byte(rec.Digest)})
+		for input, links := range rec.Inputs {
+			for _, l := range links {
+				src := ids[l.LinkIndex]
+				ops = append(ops, Op{Key: linksKey(prefix, src, input, rec.Digest, l.Selector), Members: []string{id}})
+				dt, err := json.Marshal(backlink{ID: src, Input: input, Digest: rec.Digest, Selector: l.Selector})
+				if err != nil {
+					return errors.WithStack(err)
+				}
+				ops = append(ops, Op{Key: backlinksKey(prefix, id), Members: []string{string(dt)}})
+			}
+		}
+		for _, res := range rec.Results {
+			layers, err := layerChain(config.Layers, res.LayerIndex)
+			if err != nil {
+				return err
+			}
+			dt, err := json.Marshal(result{CreatedAt: res.CreatedAt, Layers: layers})
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			resultID := remoteID(layers)
+			ops = append(ops,
+				Op{Key: resultKey(prefix, resultID), Value: dt},
+				Op{Key: resultsKey(prefix, id), Members: []string{resultID}},
+				Op{Key: idsKey(prefix, resultID), Members: []string{id}},
+			)
+		}
+	}
+	return s.Apply(ctx, ops)
+}
+
+// recordIDs returns the IDs of the records. Records without inputs have
+// their digest as ID, like the keys of the other cache storages, the IDs of
+// other records are digests of their digest and the IDs of their inputs.
+func recordIDs(config *v1.CacheConfig) ([]string, error) {
+	ids := make([]string, len(config.Records))
+	visited := make([]bool, len(config.Records))
+	var recordID func(i int) (string, error)
+	recordID = func(i int) (string, error) {
+		if i < 0 || i >= len(config.Records) {
+			return "", errors.Errorf("invalid record index %d", i)
+		}
+		if ids[i] != "" {
+			return ids[i], nil
+		}
+		if visited[i] {
+			return "", errors.Errorf("invalid looping record")
+		}
+		visited[i] = true
+		rec := config.Records[i]
+		if len(rec.Inputs) == 0 {
+			ids[i] = rec.Digest.String()
+			return ids[i], nil
+		}
+		var sb strings.Builder
+		sb.WriteString(rec.Digest.String())
+		for input, links := range rec.Inputs {
+			inputs := make([]string, 0, len(links))
+			for _, l := range links {
+				src, err := recordID(l.LinkIndex)
+				if err != nil {
+					return "", err
+				}
+				inputs = append(inputs, src+"@"+l.Selector)
+			}
+			sort.Strings(inputs)
+			fmt.Fprintf(&sb, "\n%d:%s", input, strings.Join(inputs, ","))
+		}
+		ids[i] = digest.FromString(sb.String()).String()
+		return ids[i], nil
+	}
+	for i := range config.Records {
+		if _, err := recordID(i); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// layerChain returns the descriptors of the layer at idx and its parents,
+// the base layer first
+func layerChain(layers []v1.CacheLayer, idx int) ([]ocispecs.Descriptor, error) {
+	var chain []ocispecs.Descriptor
+	for idx != -1 {
+		if idx < 0 || idx >= len(layers) {
+			return nil, errors.Errorf("invalid layer index %d", idx)
+		}
+		if len(chain) > len(layers) {
+			return nil, errors.Errorf("invalid looping layer")
+		}
+		l := layers[idx]
+		desc, err := layerDescriptor(l)
+		if err != nil {
+			return nil, err
+		}
+		chain = append([]ocispecs.Descriptor{desc}, chain...)
+		idx = l.ParentIndex
+	}
+	return chain, nil
+}
+
+func layerDescriptor(l v1.CacheLayer) (ocispecs.Descriptor, error) {
+	if l.Annotations == nil {
+		return ocispecs.Descriptor{}, errors.Errorf("cache layer with missing annotations")
+	}
+	if l.Annotations.DiffID == "" {
+		return ocispecs.Descriptor{}, errors.Errorf("cache layer with missing diffid")
+	}
+	annotations := map[string]string{
+		"containerd.io/uncompressed": l.Annotations.DiffID.String(),
+	}
+	if !l.Annotations.CreatedAt.IsZero() {
+		txt, err := l.Annotations.CreatedAt.MarshalText()
+		if err != nil {
+			return ocispecs.Descriptor{}, err
+		}
+		annotations["buildkit/createdat"] = string(txt)
+	}
+	return ocispecs.Descriptor{
+		MediaType:   l.Annotations.MediaType,
+		Digest:      l.Blob,
+		Size:        l.Annotations.Size,
+		Annotations: annotations,
+	}, nil
+}
+
+// remoteID is the ID of the result of layers, like the result IDs of the
+// other remote caches
+func remoteID(layers []ocispecs.Descriptor) string {
+	dgstr := digest.Canonical.Digester()
+	for _, desc := range layers {
+		dgstr.Hash().Write([]byte(desc.Digest))
+	}
+	return dgstr.Digest().String()
+}
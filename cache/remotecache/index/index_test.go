@@ -0,0 +1,229 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/moby/buildkit/cache/remotecache/v1"
+	"github.com/moby/buildkit/solver"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndex(t *testing.T) {
+	ctx := context.TODO()
+	s := newMemoryStore()
+	createdAt := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	base := digest.FromString("base")
+	run := digest.FromString("run")
+	config := func(blob digest.Digest) *v1.CacheConfig {
+		return &v1.CacheConfig{
+			Layers: []v1.CacheLayer{
+				{Blob: digest.FromString("layer0"), ParentIndex: -1, Annotations: &v1.LayerAnnotations{DiffID: digest.FromString("diff0"), Size: 10, MediaType: "application/vnd.oci.image.layer.v1.tar+gzip"}},
+				{Blob: blob, ParentIndex: 0, Annotations: &v1.LayerAnnotations{DiffID: digest.FromString("diff1"), Size: 20, MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", CreatedAt: createdAt}},
+			},
+			Records: []v1.CacheRecord{
+				{Digest: outputKey(base, 0), Results: []v1.CacheResult{{LayerIndex: 0, CreatedAt: createdAt}}},
+				{Digest: outputKey(run, 0), Inputs: [][]v1.CacheInput{{{LinkIndex: 0}}}, Results: []v1.CacheResult{{LayerIndex: 1, CreatedAt: createdAt}}},
+			},
+		}
+	}
+	require.NoError(t, Write(ctx, s, "test:", config(digest.FromString("layer1"))))
+	// exports of other builds are merged
+	require.NoError(t, Write(ctx, s, "test:", config(digest.FromString("layer2"))))
+
+	keys, results := NewCacheKeyStorage(s, "test:", nil, nil)
+	rootID := outputKey(base, 0).String()
+	require.True(t, keys.Exists(rootID))
+	require.False(t, keys.Exists(outputKey(run, 0).String()))
+
+	link := solver.CacheInfoLink{Input: 0, Output: 0, Digest: run}
+	var ids []string
+	require.NoError(t, keys.WalkLinks(rootID, link, func(id string) error {
+		ids = append(ids, id)
+		return nil
+	}))
+	require.Equal(t, 1, len(ids))
+	require.True(t, keys.Exists(ids[0]))
+	require.True(t, keys.HasLink(rootID, link, ids[0]))
+	require.False(t, keys.HasLink(rootID, solver.CacheInfoLink{Input: 0, Output: 1, Digest: run}, ids[0]))
+
+	var backlinks []string
+	require.NoError(t, keys.WalkBacklinks(ids[0], func(id string, l solver.CacheInfoLink) error {
+		require.Equal(t, outputKey(run, 0), l.Digest)
+		backlinks = append(backlinks, id)
+		return nil
+	}))
+	require.Equal(t, []string{rootID}, backlinks)
+
+	var res []solver.CacheResult
+	require.NoError(t, keys.WalkResults(ids[0], func(r solver.CacheResult) error {
+		res = append(res, r)
+		return nil
+	}))
+	require.Equal(t, 2, len(res))
+	require.Equal(t, createdAt, res[0].CreatedAt)
+
+	for _, r := range res {
+		require.True(t, results.Exists(r.ID))
+		remote, err := results.LoadRemote(ctx, r, nil)
+		require.NoError(t, err)
+		require.Equal(t, 2, len(remote.Descriptors))
+		require.Equal(t, digest.FromString("layer0"), remote.Descriptors[0].Digest)
+		require.Equal(t, digest.FromString("diff1").String(), remote.Descriptors[1].Annotations["containerd.io/uncompressed"])
+		require.Equal(t, "2021-01-01T00:00:00Z", remote.Descriptors[1].Annotations["buildkit/createdat"])
+
+		var byResult []string
+		require.NoError(t, keys.WalkIDsByResult(r.ID, func(id string) error {
+			byResult = append(byResult, id)
+			return nil
+		}))
+		require.Equal(t, ids, byResult)
+	}
+
+	_, err := results.LoadRemote(ctx, solver.CacheResult{ID: "missing"}, nil)
+	require.ErrorIs(t, err, solver.ErrNotFound)
+}
+
+func TestRecordIDs(t *testing.T) {
+	config := &v1.CacheConfig{
+		Records: []v1.CacheRecord{
+			{Digest: digest.FromString("a")},
+			{Digest: digest.FromString("b")},
+			{Digest: digest.FromString("c"), Inputs: [][]v1.CacheInput{{{LinkIndex: 0}, {LinkIndex: 1}}}},
+		},
+	}
+	ids, err := recordIDs(config)
+	require.NoError(t, err)
+	require.Equal(t, digest.FromString("a").String(), ids[0])
+
+	// ids don't depend on the order of the records
+	config.Records[0], config.Records[1] = config.Records[1], config.Records[0]
+	ids2, err := recordIDs(config)
+	require.NoError(t, err)
+	require.Equal(t, ids[2], ids2[2])
+
+	config.Records[0].Inputs = [][]v1.CacheInput{{{LinkIndex: 2}}}
+	_, err = recordIDs(config)
+	require.EqualError(t, err, "invalid looping record")
+}
+
+func TestOpen(t *testing.T) {
+	s1, err := Open("redis://localhost:6379/1")
+	require.NoError(t, err)
+	s2, err := Open("redis://localhost:6379/1")
+	require.NoError(t, err)
+	require.True(t, s1 == s2)
+	require.NoError(t, s1.Close())
+
+	s3, err := Open("redis://localhost:6379/2")
+	require.NoError(t, err)
+	require.False(t, s1 == s3)
+
+	_, err = Open("memcached://localhost:11211")
+	require.Error(t, err)
+
+	s4, err := Open("redis://localhost:6379/3?ttl=720h")
+	require.NoError(t, err)
+	require.Equal(t, 720*time.Hour, s4.(*redisStore).ttl)
+	_, err = Open("redis://localhost:6379/3?ttl=500ms")
+	require.Error(t, err)
+
+	// the least recently used stores are evicted
+	s2, err = Open("redis://localhost:6379/2")
+	require.NoError(t, err)
+	require.True(t, s2 == s3)
+	for i := 0; i < maxStores; i++ {
+		_, err := Open(fmt.Sprintf("redis://localhost:6379/%d", 100+i))
+		require.NoError(t, err)
+	}
+	require.LessOrEqual(t, len(stores), maxStores)
+	s2, err = Open("redis://localhost:6379/2")
+	require.NoError(t, err)
+	require.False(t, s2 == s3)
+}
+
+func TestLookupMiss(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	s, err := Open("redis://" + addr)
+	require.NoError(t, err)
+	keys, results := NewCacheKeyStorage(s, "test:", nil, nil)
+
+	require.False(t, keys.Exists("foo"))
+	// requests fail without being sent after a failed request
+	_, err = s.Get(context.TODO(), "foo")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cache index is unavailable")
+
+	require.NoError(t, keys.WalkResults("foo", func(solver.CacheResult) error {
+		return errors.New("unexpected result")
+	}))
+	require.NoError(t, keys.WalkLinks("foo", solver.CacheInfoLink{}, func(string) error {
+		return errors.New("unexpected link")
+	}))
+	_, err = keys.Load("foo", "bar")
+	require.ErrorIs(t, err, solver.ErrNotFound)
+	_, err = results.LoadRemote(context.TODO(), solver.CacheResult{ID: "bar"}, nil)
+	require.ErrorIs(t, err, solver.ErrNotFound)
+	require.False(t, results.Exists("bar"))
+}
+
+type memoryStore struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	sets   map[string]map[string]struct{}
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{values: map[string][]byte{}, sets: map[string]map[string]struct{}{}}
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key], nil
+}
+
+func (s *memoryStore) SetMembers(ctx context.Context, key string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var members []string
+	for m := range s.sets[key] {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+func (s *memoryStore) Apply(ctx context.Context, ops []Op) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, op := range ops {
+		if op.Value != nil {
+			s.values[op.Key] = op.Value
+			continue
+		}
+		if s.sets[op.Key] == nil {
+			s.sets[op.Key] = map[string]struct{}{}
+		}
+		for _, m := range op.Members {
+			s.sets[op.Key][m] = struct{}{}
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
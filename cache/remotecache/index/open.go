@@ -0,0 +1,200 @@
+package index
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/moby/buildkit/cache/remotecache/index/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxStores is the number of stores that are kept open. Closing the
+	// least recently used one only closes its idle connections, its caches
+	// open new ones.
+	maxStores = 16
+	// retryInterval is the time after a failed request that requests fail
+	// without being sent, so that lookups of an unreachable store are fast
+	// cache misses
+	retryInterval = 30 * time.Second
+)
+
+var (
+	storesMu sync.Mutex
+	// stores are the stores by URL. The importers query their store for the
+	// rest of the build, so the connections are shared by all builds
+	// instead of being opened for each one.
+	stores = map[string]Store{}
+	// storesLRU are the URLs of stores, the least recently used first
+	storesLRU []string
+)
+
+// Open returns the store of the index at rawurl. Redis servers are
+// supported with redis:// and rediss:// URLs. With the ttl query parameter,
+// e.g. ttl=720h, the keys expire ttl after the last export that wrote them.
+// The store is shared by the caches of the URL, closing it only closes its
+// idle connections.
+func Open(rawurl string) (Store, error) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if s, ok := stores[rawurl]; ok {
+		touchStore(rawurl)
+		return s, nil
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid cache index URL")
+	}
+	q := u.Query()
+	var ttl time.Duration
+	if v := q.Get("ttl"); v != "" {
+		ttl, err = time.ParseDuration(v)
+		if err != nil || ttl < time.Second {
+			return nil, errors.Errorf("invalid ttl %q of cache index URL", v)
+		}
+		q.Del("ttl")
+		u.RawQuery = q.Encode()
+	}
+	var s Store
+	switch u.Scheme {
+	case "redis", "rediss":
+		c, err := redis.New(u.String())
+		if err != nil {
+			return nil, err
+		}
+		s = &redisStore{c: c, ttl: ttl}
+	default:
+		return nil, errors.Errorf("unsupported cache index URL scheme %q", u.Scheme)
+	}
+	stores[rawurl] = s
+	touchStore(rawurl)
+	if len(storesLRU) > maxStores {
+		old := storesLRU[0]
+		storesLRU = storesLRU[1:]
+		stores[old].Close()
+		delete(stores, old)
+	}
+	return s, nil
+}
+
+func touchStore(rawurl string) {
+	for i, u := range storesLRU {
+		if u == rawurl {
+			storesLRU = append(storesLRU[:i], storesLRU[i+1:]...)
+			break
+		}
+	}
+	storesLRU = append(storesLRU, rawurl)
+}
+
+type redisStore struct {
+	c   *redis.Client
+	ttl time.Duration
+
+	mu       sync.Mutex
+	failedAt time.Time
+}
+
+// pipeline sends cmds unless a request failed in the last retryInterval
+func (s *redisStore) pipeline(ctx context.Context, cmds [][]string) ([]interface{}, error) {
+	s.mu.Lock()
+	failedAt := s.failedAt
+	s.mu.Unlock()
+	if d := time.Since(failedAt); d < retryInterval {
+		return nil, errors.Errorf("cache index is unavailable after a failed request %s ago", d.Round(time.Second))
+	}
+	replies, err := s.c.Pipeline(ctx, cmds)
+	var rerr redis.Error
+	if err != nil && !errors.As(err, &rerr) && !errors.Is(ctx.Err(), context.Canceled) {
+		s.mu.Lock()
+		s.failedAt = time.Now()
+		s.mu.Unlock()
+	}
+	return replies, err
+}
+
+func (s *redisStore) do(ctx context.Context, args ...string) (interface{}, error) {
+	replies, err := s.pipeline(ctx, [][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	r, err := s.do(ctx, "GET", key)
+	if err != nil || r == nil {
+		return nil, err
+	}
+	dt, ok := r.([]byte)
+	if !ok {
+		return nil, errors.Errorf("invalid reply of type %T to GET", r)
+	}
+	return dt, nil
+}
+
+func (s *redisStore) SetMembers(ctx context.Context, key string) ([]string, error) {
+	r, err := s.do(ctx, "SMEMBERS", key)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := r.([]interface{})
+	if !ok {
+		return nil, errors.Errorf("invalid reply of type %T to SMEMBERS", r)
+	}
+	members := make([]string, 0, len(arr))
+	for _, m := range arr {
+		dt, ok := m.([]byte)
+		if !ok {
+			return nil, errors.Errorf("invalid member of type %T in SMEMBERS reply", m)
+		}
+		members = append(members, string(dt))
+	}
+	return members, nil
+}
+
+// maxPipelinedOps is the number of ops that are sent without waiting for
+// their replies
+const maxPipelinedOps = 1000
+
+func (s *redisStore) Apply(ctx context.Context, ops []Op) error {
+	for len(ops) > 0 {
+		n := len(ops)
+		if n > maxPipelinedOps {
+			n = maxPipelinedOps
+		}
+		cmds := make([][]string, 0, 2*n)
+		for _, op := range ops[:n] {
+			if op.Value != nil {
+				cmd := []string{"SET", op.Key, string(op.Value)}
+				if s.ttl > 0 {
+					cmd = append(cmd, "EX", s.ttlSeconds())
+				}
+				cmds = append(cmds, cmd)
+			} else {
+				cmds = append(cmds, append([]string{"SADD", op.Key}, op.Members...))
+				if s.ttl > 0 {
+					cmds = append(cmds, []string{"EXPIRE", op.Key, s.ttlSeconds()})
+				}
+			}
+		}
+		if _, err := s.pipeline(ctx, cmds); err != nil {
+			return err
+		}
+		ops = ops[n:]
+	}
+	return nil
+}
+
+func (s *redisStore) ttlSeconds() string {
+	return strconv.FormatInt(int64(s.ttl/time.Second), 10)
+}
+
+// Close closes the idle connections, later requests open new ones
+func (s *redisStore) Close() error {
+	return s.c.Close()
+}
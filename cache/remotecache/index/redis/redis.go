@@ -0,0 +1,343 @@
+// Package redis is a minimal client of the Redis protocol (RESP2) for the
+// indexes of remote caches.
+//
+// The indexes only send GET, SET, SADD, EXPIRE and SMEMBERS commands, pipelined,
+// after the AUTH and SELECT of the connection. No Redis client is vendored
+// and the full clients bring in a large dependency tree, cluster and pub/sub
+// support for those few commands, so the client implements just the
+// request encoding and the reply types of RESP2.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultPort = "6379"
+	// defaultTimeout is the deadline of commands sent with a context
+	// without deadline
+	defaultTimeout = 30 * time.Second
+	// dialTimeout is the deadline of connecting to the server
+	dialTimeout = 5 * time.Second
+	// maxIdleConns is the number of connections kept for later commands
+	maxIdleConns = 4
+)
+
+// Error is an error reply of the server
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Client sends commands to a Redis server. Connections are reused by
+// later commands.
+type Client struct {
+	addr      string
+	tlsConfig *tls.Config
+	username  string
+	password  string
+	db        int
+
+	mu   sync.Mutex
+	idle []*conn
+}
+
+// New returns a client of the server at the address of a URL of the form
+// redis://[[username]:password@]host[:port][/db], rediss:// for TLS. The
+// TLS config of rediss:// URLs is set with the ca_cert, client_cert,
+// client_key and skip_verify query parameters.
+func New(rawurl string) (*Client, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid redis URL")
+	}
+	c := &Client{}
+	switch u.Scheme {
+	case "redis":
+		if u.RawQuery != "" {
+			return nil, errors.Errorf("invalid redis URL %q, query parameters require rediss:// scheme", u.Redacted())
+		}
+	case "rediss":
+		c.tlsConfig, err = tlsConfig(u)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("invalid redis URL %q, expected redis:// or rediss:// scheme", u.Redacted())
+	}
+	if u.Host == "" {
+		return nil, errors.Errorf("invalid redis URL %q without host", u.Redacted())
+	}
+	c.addr = u.Host
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		c.db, err = strconv.Atoi(db)
+		if err != nil || c.db < 0 {
+			return nil, errors.Errorf("invalid database %q of redis URL", db)
+		}
+	}
+	return c, nil
+}
+
+func tlsConfig(u *url.URL) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: u.Hostname()}
+	q := u.Query()
+	for k := range q {
+		switch k {
+		case "ca_cert", "client_cert", "client_key", "skip_verify":
+		default:
+			return nil, errors.Errorf("unknown query parameter %q of redis URL", k)
+		}
+	}
+	if ca := q.Get("ca_cert"); ca != "" {
+		dt, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read redis CA certificate")
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(dt) {
+			return nil, errors.Errorf("no certificates in redis CA certificate %s", ca)
+		}
+	}
+	cert, key := q.Get("client_cert"), q.Get("client_key")
+	if (cert == "") != (key == "") {
+		return nil, errors.Errorf("client_cert and client_key of redis URL must be set together")
+	}
+	if cert != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load redis client certificate")
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	if v := q.Get("skip_verify"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid skip_verify of redis URL")
+		}
+		cfg.InsecureSkipVerify = b
+	}
+	return cfg, nil
+}
+
+// Do sends a command and returns its reply. Replies are strings, int64,
+// []byte, nil or []interface{} of those.
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	replies, err := c.Pipeline(ctx, [][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// Pipeline sends commands without waiting for their replies in between.
+// The first error reply is returned.
+func (c *Client) Pipeline(ctx context.Context, cmds [][]string) ([]interface{}, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+	if err := cn.SetDeadline(deadline); err != nil {
+		cn.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	replies, err := cn.pipeline(cmds)
+	if err != nil {
+		cn.Close()
+		return nil, errors.Wrapf(err, "failed to send redis commands to %s", c.addr)
+	}
+	c.put(cn)
+	for _, r := range replies {
+		if err, ok := r.(Error); ok {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return replies, nil
+}
+
+// Close closes the idle connections
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cn := range c.idle {
+		cn.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+	return c.dial(ctx)
+}
+
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.idle) >= maxIdleConns {
+		cn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+	nc.SetDeadline(deadline)
+	if c.tlsConfig != nil {
+		tc := tls.Client(nc, c.tlsConfig)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			nc.Close()
+			return nil, errors.WithStack(err)
+		}
+		nc = tc
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	var setup [][]string
+	if c.password != "" {
+		if c.username != "" {
+			setup = append(setup, []string{"AUTH", c.username, c.password})
+		} else {
+			setup = append(setup, []string{"AUTH", c.password})
+		}
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	if len(setup) == 0 {
+		return cn, nil
+	}
+	replies, err := cn.pipeline(setup)
+	if err != nil {
+		nc.Close()
+		return nil, errors.Wrapf(err, "failed to connect to redis %s", c.addr)
+	}
+	for _, r := range replies {
+		if err, ok := r.(Error); ok {
+			nc.Close()
+			return nil, errors.Wrapf(err, "failed to connect to redis %s", c.addr)
+		}
+	}
+	return cn, nil
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (c *conn) pipeline(cmds [][]string) ([]interface{}, error) {
+	for _, args := range cmds {
+		c.w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+		for _, a := range args {
+			c.w.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, len(cmds))
+	for i := range cmds {
+		r, err := c.readReply()
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = r
+	}
+	return replies, nil
+}
+
+func (c *conn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, errors.Errorf("invalid redis reply %q", line)
+	}
+	typ, line := line[0], line[1:len(line)-2]
+	switch typ {
+	case '+':
+		return line, nil
+	case '-':
+		return Error(line), nil
+	case ':':
+		n, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid redis integer %q", line)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, errors.Errorf("invalid redis bulk string length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, errors.Errorf("invalid redis array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			if arr[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	default:
+		return nil, errors.Errorf("invalid redis reply type %q", typ)
+	}
+}
@@ -0,0 +1,236 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/buildkit/worker"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// lookupTimeout is the deadline of the queries of a lookup. Failed queries
+// are cache misses so that the solver runs the steps instead of failing the
+// build or waiting for the index.
+const lookupTimeout = 5 * time.Second
+
+func lookupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, lookupTimeout)
+}
+
+// miss logs a failed query of the index that is a cache miss
+func miss(ctx context.Context, err error) {
+	bklog.G(ctx).Warnf("failed to query cache index: %v", err)
+}
+
+// NewCacheKeyStorage returns the storages of the cache in the index in s
+// under prefix. They query the index for every lookup of the solver. The
+// blobs of the results are read from provider.
+func NewCacheKeyStorage(s Store, prefix string, provider content.Provider, w worker.Worker) (solver.CacheKeyStorage, solver.CacheResultStorage) {
+	return &cacheKeyStorage{s: s, prefix: prefix}, &cacheResultStorage{s: s, prefix: prefix, provider: provider, w: w}
+}
+
+type cacheKeyStorage struct {
+	s      Store
+	prefix string
+}
+
+func (cs *cacheKeyStorage) Exists(id string) bool {
+	ctx, cancel := lookupContext(context.TODO())
+	defer cancel()
+	dt, err := cs.s.Get(ctx, keyKey(cs.prefix, id))
+	if err != nil {
+		miss(ctx, err)
+		return false
+	}
+	return dt != nil
+}
+
+func (cs *cacheKeyStorage) Walk(func(id string) error) error {
+	return nil
+}
+
+func (cs *cacheKeyStorage) WalkResults(id string, fn func(solver.CacheResult) error) error {
+	ctx, cancel := lookupContext(context.TODO())
+	defer cancel()
+	resultIDs, err := cs.s.SetMembers(ctx, resultsKey(cs.prefix, id))
+	if err != nil {
+		miss(ctx, err)
+		return nil
+	}
+	for _, resultID := range resultIDs {
+		res, err := loadResult(ctx, cs.s, cs.prefix, resultID)
+		if err != nil {
+			miss(ctx, err)
+			continue
+		}
+		if res == nil {
+			continue
+		}
+		if err := fn(solver.CacheResult{ID: resultID, CreatedAt: res.CreatedAt}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cs *cacheKeyStorage) Load(id string, resultID string) (solver.CacheResult, error) {
+	ctx, cancel := lookupContext(context.TODO())
+	defer cancel()
+	res, err := loadResult(ctx, cs.s, cs.prefix, resultID)
+	if err != nil {
+		miss(ctx, err)
+	}
+	if res == nil {
+		return solver.CacheResult{}, errors.WithStack(solver.ErrNotFound)
+	}
+	return solver.CacheResult{ID: resultID, CreatedAt: res.CreatedAt}, nil
+}
+
+func (cs *cacheKeyStorage) AddResult(id string, res solver.CacheResult) error {
+	return nil
+}
+
+func (cs *cacheKeyStorage) Release(resultID string) error {
+	return nil
+}
+
+func (cs *cacheKeyStorage) WalkIDsByResult(resultID string, fn func(string) error) error {
+	ctx, cancel := lookupContext(context.TODO())
+	defer cancel()
+	ids, err := cs.s.SetMembers(ctx, idsKey(cs.prefix, resultID))
+	if err != nil {
+		miss(ctx, err)
+		return nil
+	}
+	for _, id := range ids {
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cs *cacheKeyStorage) AddLink(id string, link solver.CacheInfoLink, target string) error {
+	return nil
+}
+
+func (cs *cacheKeyStorage) WalkLinks(id string, link solver.CacheInfoLink, fn func(id string) error) error {
+	ctx, cancel := lookupContext(context.TODO())
+	defer cancel()
+	ids, err := cs.s.SetMembers(ctx, linksKey(cs.prefix, id, int(link.Input), outputKey(link.Digest, int(link.Output)), link.Selector.String()))
+	if err != nil {
+		miss(ctx, err)
+		return nil
+	}
+	for _, id := range ids {
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cs *cacheKeyStorage) HasLink(id string, link solver.CacheInfoLink, target string) bool {
+	var found bool
+	cs.WalkLinks(id, link, func(id string) error {
+		found = found || id == target
+		return nil
+	})
+	return found
+}
+
+func (cs *cacheKeyStorage) WalkBacklinks(id string, fn func(id string, link solver.CacheInfoLink) error) error {
+	ctx, cancel := lookupContext(context.TODO())
+	defer cancel()
+	members, err := cs.s.SetMembers(ctx, backlinksKey(cs.prefix, id))
+	if err != nil {
+		miss(ctx, err)
+		return nil
+	}
+	for _, m := range members {
+		var bl backlink
+		if err := json.Unmarshal([]byte(m), &bl); err != nil {
+			return errors.Wrap(err, "invalid backlink in cache index")
+		}
+		if err := fn(bl.ID, solver.CacheInfoLink{
+			Input:    solver.Index(bl.Input),
+			Selector: digest.Digest(bl.Selector),
+			Digest:   bl.Digest,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type cacheResultStorage struct {
+	s        Store
+	prefix   string
+	provider content.Provider
+	w        worker.Worker
+}
+
+func (cs *cacheResultStorage) Save(res solver.Result, createdAt time.Time) (solver.CacheResult, error) {
+	return solver.CacheResult{}, errors.Errorf("importer is immutable")
+}
+
+func (cs *cacheResultStorage) Load(ctx context.Context, res solver.CacheResult) (solver.Result, error) {
+	remote, err := cs.LoadRemote(ctx, res, nil)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := cs.w.FromRemote(ctx, remote)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load result from remote")
+	}
+	return worker.NewWorkerRefResult(ref, cs.w), nil
+}
+
+func (cs *cacheResultStorage) LoadRemote(ctx context.Context, res solver.CacheResult, _ session.Group) (*solver.Remote, error) {
+	lctx, cancel := lookupContext(ctx)
+	defer cancel()
+	r, err := loadResult(lctx, cs.s, cs.prefix, res.ID)
+	if err != nil {
+		miss(ctx, err)
+	}
+	if r == nil || len(r.Layers) == 0 {
+		return nil, errors.WithStack(solver.ErrNotFound)
+	}
+	return &solver.Remote{Descriptors: r.Layers, Provider: cs.provider}, nil
+}
+
+func (cs *cacheResultStorage) Exists(id string) bool {
+	ctx, cancel := lookupContext(context.TODO())
+	defer cancel()
+	res, err := loadResult(ctx, cs.s, cs.prefix, id)
+	if err != nil {
+		miss(ctx, err)
+		return false
+	}
+	return res != nil
+}
+
+func loadResult(ctx context.Context, s Store, prefix, resultID string) (*result, error) {
+	dt, err := s.Get(ctx, resultKey(prefix, resultID))
+	if err != nil || dt == nil {
+		return nil, err
+	}
+	var res result
+	if err := json.Unmarshal(dt, &res); err != nil {
+		return nil, errors.Wrapf(err, "invalid result %s in cache index", resultID)
+	}
+	return &res, nil
+}
+
+// outputKey is the digest of the records of the outputs of vertexes, like
+// in the cache configs of the other remote caches
+func outputKey(dgst digest.Digest, idx int) digest.Digest {
+	return digest.FromBytes([]byte(fmt.Sprintf("%s@%d", dgst, idx)))
+}
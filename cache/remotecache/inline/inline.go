@@ -39,6 +39,10 @@ func (ce *exporter) reset() {
 }
 
 func (ce *exporter) ExportForLayers(layers []digest.Digest) ([]byte, error) {
+	// the chains are reset for every call so that the records of one platform
+	// of a multi-platform result don't leak into the cache of the next one
+	defer ce.reset()
+
 	config, descs, err := ce.chains.Marshal()
 	if err != nil {
 		return nil, err
@@ -89,8 +93,6 @@ func (ce *exporter) ExportForLayers(layers []digest.Digest) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	ce.reset()
-
 	return dt, nil
 }
 
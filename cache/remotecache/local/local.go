@@ -19,6 +19,7 @@ const (
 	attrSrc              = "src"
 	attrDest             = "dest"
 	attrOCIMediatypes    = "oci-mediatypes"
+	attrTTL              = "ttl"
 	contentStoreIDPrefix = "local:"
 )
 
@@ -37,13 +38,36 @@ func ResolveCacheExporterFunc(sm *session.Manager) remotecache.ResolveCacheExpor
 			}
 			ociMediatypes = b
 		}
+		ttl, err := remotecache.ParseTTL(attrs, attrTTL)
+		if err != nil {
+			return nil, err
+		}
 		csID := contentStoreIDPrefix + store
 		cs, err := getContentStore(ctx, sm, g, csID)
 		if err != nil {
 			return nil, err
 		}
-		return remotecache.NewExporter(cs, "", ociMediatypes), nil
+		return &exporter{Exporter: remotecache.NewExpiringExporter(cs, "", ociMediatypes, ttl), csID: csID}, nil
+	}
+}
+
+// exporter additionally returns the manifest descriptor keyed by the content
+// store, so that clients exporting to multiple local stores can tell them
+// apart
+type exporter struct {
+	remotecache.Exporter
+	csID string
+}
+
+func (e *exporter) Finalize(ctx context.Context) (map[string]string, error) {
+	res, err := e.Exporter.Finalize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := res[remotecache.ExporterResponseManifestDesc]; ok {
+		res[remotecache.ExporterResponseManifestDesc+"/"+e.csID] = v
 	}
+	return res, nil
 }
 
 // ResolveCacheImporterFunc for "local" cache importer.
@@ -0,0 +1,339 @@
+// Package objectstore implements the cache exporter and importer of the
+// object store backends, e.g. s3. The layer blobs and the cache manifest are
+// stored as objects, the backends only implement the Client of their API.
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/moby/buildkit/cache/remotecache"
+	"github.com/moby/buildkit/cache/remotecache/index"
+	v1 "github.com/moby/buildkit/cache/remotecache/v1"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/util/progress"
+	"github.com/moby/buildkit/worker"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// Client is the API of an object store
+type Client interface {
+	// Exists returns false if the object with key doesn't exist
+	Exists(ctx context.Context, key string) (bool, error)
+	// Get returns the contents of the object with key from offset off. nil
+	// is returned if the object doesn't exist.
+	Get(ctx context.Context, key string, off int64) (io.ReadCloser, error)
+	// Put uploads the object with key
+	Put(ctx context.Context, key string, ra io.ReaderAt, size int64) error
+}
+
+// Config is the location of a cache in an object store
+type Config struct {
+	// Prefix is prepended to the keys of the blobs and manifests
+	Prefix string
+	// Name of the cache manifest
+	Name string
+	// IndexURL is the URL of a key-value store, e.g. redis://host:6379/0,
+	// that the cache chains are written to instead of the cache manifest
+	IndexURL string
+	// IndexPrefix is the prefix of the keys of the cache in the index. It
+	// identifies the store, e.g. s3:<bucket>/.
+	IndexPrefix string
+}
+
+func (c Config) blobKey(dgst digest.Digest) string {
+	return c.Prefix + "blobs/" + dgst.String()
+}
+
+func (c Config) manifestKey() string {
+	return c.Prefix + "manifests/" + c.Name
+}
+
+func (c Config) indexPrefix() string {
+	return c.IndexPrefix + c.Prefix + c.Name + ":"
+}
+
+type exporter struct {
+	solver.CacheExporterTarget
+	chains *v1.CacheChains
+	client Client
+	config Config
+}
+
+// NewExporter returns an exporter that writes the cache to the store of
+// client
+func NewExporter(client Client, config Config) remotecache.Exporter {
+	cc := v1.NewCacheChains()
+	return &exporter{CacheExporterTarget: cc, chains: cc, client: client, config: config}
+}
+
+func (ce *exporter) Finalize(ctx context.Context) (map[string]string, error) {
+	config, descs, err := ce.chains.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, l := range config.Layers {
+		dgstPair, ok := descs[l.Blob]
+		if !ok {
+			return nil, errors.Errorf("missing blob %s", l.Blob)
+		}
+		if dgstPair.Descriptor.Annotations == nil {
+			return nil, errors.Errorf("invalid descriptor without annotations")
+		}
+		v, ok := dgstPair.Descriptor.Annotations["containerd.io/uncompressed"]
+		if !ok {
+			return nil, errors.Errorf("invalid descriptor without uncompressed annotation")
+		}
+		diffID, err := digest.Parse(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse uncompressed annotation")
+		}
+
+		key := ce.config.blobKey(dgstPair.Descriptor.Digest)
+		exists, err := ce.client.Exists(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			layerDone := oneOffProgress(ctx, fmt.Sprintf("writing layer %s", l.Blob))
+			ra, err := dgstPair.Provider.ReaderAt(ctx, dgstPair.Descriptor)
+			if err != nil {
+				return nil, layerDone(err)
+			}
+			err = ce.client.Put(ctx, key, ra, ra.Size())
+			ra.Close()
+			if err != nil {
+				return nil, layerDone(errors.Wrap(err, "error writing layer blob"))
+			}
+			layerDone(nil)
+		}
+		la := &v1.LayerAnnotations{
+			DiffID:    diffID,
+			Size:      dgstPair.Descriptor.Size,
+			MediaType: dgstPair.Descriptor.MediaType,
+		}
+		if v, ok := dgstPair.Descriptor.Annotations["buildkit/createdat"]; ok {
+			var t time.Time
+			if err := (&t).UnmarshalText([]byte(v)); err != nil {
+				return nil, err
+			}
+			la.CreatedAt = t.UTC()
+		}
+		config.Layers[i].Annotations = la
+	}
+
+	if ce.config.IndexURL != "" {
+		s, err := index.Open(ce.config.IndexURL)
+		if err != nil {
+			return nil, err
+		}
+		if err := index.Write(ctx, s, ce.config.indexPrefix(), config); err != nil {
+			return nil, errors.Wrap(err, "error writing cache index")
+		}
+		return nil, nil
+	}
+
+	dt, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := ce.client.Put(ctx, ce.config.manifestKey(), bytes.NewReader(dt), int64(len(dt))); err != nil {
+		return nil, errors.Wrap(err, "error writing cache manifest")
+	}
+	return nil, nil
+}
+
+type importer struct {
+	client Client
+	config Config
+}
+
+// NewImporter returns an importer that reads the cache from the store of
+// client
+func NewImporter(client Client, config Config) remotecache.Importer {
+	return &importer{client: client, config: config}
+}
+
+func (ci *importer) makeDescriptorProviderPair(l v1.CacheLayer) (*v1.DescriptorProviderPair, error) {
+	if l.Annotations == nil {
+		return nil, errors.Errorf("cache layer with missing annotations")
+	}
+	annotations := map[string]string{}
+	if l.Annotations.DiffID == "" {
+		return nil, errors.Errorf("cache layer with missing diffid")
+	}
+	annotations["containerd.io/uncompressed"] = l.Annotations.DiffID.String()
+	if !l.Annotations.CreatedAt.IsZero() {
+		txt, err := l.Annotations.CreatedAt.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		annotations["buildkit/createdat"] = string(txt)
+	}
+	desc := ocispecs.Descriptor{
+		MediaType:   l.Annotations.MediaType,
+		Digest:      l.Blob,
+		Size:        l.Annotations.Size,
+		Annotations: annotations,
+	}
+	return &v1.DescriptorProviderPair{
+		Descriptor: desc,
+		Provider:   &ciProvider{ci: ci},
+	}, nil
+}
+
+func (ci *importer) Resolve(ctx context.Context, _ ocispecs.Descriptor, id string, w worker.Worker) (solver.CacheManager, error) {
+	if ci.config.IndexURL != "" {
+		s, err := index.Open(ci.config.IndexURL)
+		if err != nil {
+			return nil, err
+		}
+		// the store is used by the cache manager for the rest of the build,
+		// it is shared by the caches of the URL
+		keysStorage, resultStorage := index.NewCacheKeyStorage(s, ci.config.indexPrefix(), &ciProvider{ci: ci}, w)
+		return solver.NewCacheManager(ctx, id, keysStorage, resultStorage), nil
+	}
+
+	cc, err := ci.chains(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keysStorage, resultStorage, err := v1.NewCacheKeyStorage(cc, w)
+	if err != nil {
+		return nil, err
+	}
+	return solver.NewCacheManager(ctx, id, keysStorage, resultStorage), nil
+}
+
+// chains returns the cache chains of the cache manifest, no chains if the
+// manifest doesn't exist
+func (ci *importer) chains(ctx context.Context) (*v1.CacheChains, error) {
+	cc := v1.NewCacheChains()
+	rc, err := ci.client.Get(ctx, ci.config.manifestKey(), 0)
+	if err != nil || rc == nil {
+		return cc, err
+	}
+	dt, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var config v1.CacheConfig
+	if err := json.Unmarshal(dt, &config); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	allLayers := v1.DescriptorProvider{}
+	for _, l := range config.Layers {
+		dpp, err := ci.makeDescriptorProviderPair(l)
+		if err != nil {
+			return nil, err
+		}
+		allLayers[l.Blob] = *dpp
+	}
+	if err := v1.ParseConfig(config, allLayers, cc); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+// ciProvider fetches the blobs of the cache lazily when a result is loaded
+type ciProvider struct {
+	ci *importer
+}
+
+func (p *ciProvider) ReaderAt(ctx context.Context, desc ocispecs.Descriptor) (content.ReaderAt, error) {
+	return &readerAt{ctx: ctx, client: p.ci.client, key: p.ci.config.blobKey(desc.Digest), size: desc.Size}, nil
+}
+
+// readerAt reads a blob with ranged requests. Sequential reads share a
+// request.
+type readerAt struct {
+	ctx    context.Context
+	client Client
+	key    string
+	size   int64
+
+	mu     sync.Mutex
+	rc     io.ReadCloser
+	offset int64
+}
+
+func (r *readerAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if r.rc != nil && off != r.offset {
+		r.rc.Close()
+		r.rc = nil
+	}
+	if r.rc == nil {
+		rc, err := r.client.Get(r.ctx, r.key, off)
+		if err != nil {
+			return 0, err
+		}
+		if rc == nil {
+			return 0, errors.Errorf("blob %s not found", r.key)
+		}
+		r.rc = rc
+		r.offset = off
+	}
+	n, err := io.ReadFull(r.rc, p)
+	r.offset += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// reads past the end of the blob are short, the object ending
+		// before its size is an error
+		if r.offset < r.size {
+			err = errors.Wrapf(io.ErrUnexpectedEOF, "blob %s ended at %d of %d bytes", r.key, r.offset, r.size)
+		} else {
+			err = io.EOF
+		}
+	}
+	if err != nil {
+		r.rc.Close()
+		r.rc = nil
+	}
+	return n, err
+}
+
+func (r *readerAt) Size() int64 {
+	return r.size
+}
+
+func (r *readerAt) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rc != nil {
+		r.rc.Close()
+		r.rc = nil
+	}
+	return nil
+}
+
+func oneOffProgress(ctx context.Context, id string) func(err error) error {
+	pw, _, _ := progress.NewFromContext(ctx)
+	now := time.Now()
+	st := progress.Status{
+		Started: &now,
+	}
+	pw.Write(id, st)
+	return func(err error) error {
+		now := time.Now()
+		st.Completed = &now
+		pw.Write(id, st)
+		pw.Close()
+		return err
+	}
+}
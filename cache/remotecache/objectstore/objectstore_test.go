@@ -0,0 +1,168 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/util/contentutil"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.TODO()
+	b := contentutil.NewBuffer()
+	layer := []byte("contents of the layer")
+	desc := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageLayerGzip,
+		Digest:    digest.FromBytes(layer),
+		Size:      int64(len(layer)),
+		Annotations: map[string]string{
+			"containerd.io/uncompressed": digest.FromString("diff").String(),
+		},
+	}
+	require.NoError(t, content.WriteBlob(ctx, b, desc.Digest.String(), bytes.NewReader(layer), desc))
+
+	cl := newMemClient()
+	config := Config{Prefix: "cache/", Name: "main", IndexPrefix: "mem:"}
+	exp := NewExporter(cl, config)
+	foo := exp.Add(digest.FromString("foo"))
+	bar := exp.Add(digest.FromString("bar"))
+	bar.LinkFrom(foo, 0, "")
+	bar.AddResult(time.Now(), &solver.Remote{Descriptors: []ocispecs.Descriptor{desc}, Provider: b})
+	_, err := exp.Finalize(ctx)
+	require.NoError(t, err)
+	require.Equal(t, layer, cl.objects["cache/blobs/"+desc.Digest.String()])
+	require.Contains(t, cl.objects, "cache/manifests/main")
+
+	// the existing blobs aren't uploaded again
+	puts := cl.puts
+	_, err = exp.Finalize(ctx)
+	require.NoError(t, err)
+	require.Equal(t, puts+1, cl.puts)
+
+	ci := NewImporter(cl, config).(*importer)
+	cc, err := ci.chains(ctx)
+	require.NoError(t, err)
+	expected, _, err := exp.(*exporter).chains.Marshal()
+	require.NoError(t, err)
+	actual, descs, err := cc.Marshal()
+	require.NoError(t, err)
+	require.Equal(t, len(expected.Records), len(actual.Records))
+	for i, r := range expected.Records {
+		require.Equal(t, r.Digest, actual.Records[i].Digest)
+		require.Equal(t, r.Inputs, actual.Records[i].Inputs)
+		require.Equal(t, len(r.Results), len(actual.Records[i].Results))
+	}
+	require.Equal(t, 1, len(actual.Layers))
+	require.Equal(t, desc.Digest, actual.Layers[0].Blob)
+
+	pair, ok := descs[desc.Digest]
+	require.True(t, ok)
+	require.Equal(t, desc.MediaType, pair.Descriptor.MediaType)
+	require.Equal(t, desc.Annotations["containerd.io/uncompressed"], pair.Descriptor.Annotations["containerd.io/uncompressed"])
+	dt, err := content.ReadBlob(ctx, pair.Provider, pair.Descriptor)
+	require.NoError(t, err)
+	require.Equal(t, layer, dt)
+
+	_, err = ci.Resolve(ctx, ocispecs.Descriptor{}, "test", nil)
+	require.NoError(t, err)
+
+	// a cache that wasn't exported has no chains
+	cc, err = NewImporter(cl, Config{Name: "missing"}).(*importer).chains(ctx)
+	require.NoError(t, err)
+	actual, _, err = cc.Marshal()
+	require.NoError(t, err)
+	require.Empty(t, actual.Records)
+}
+
+func TestReaderAt(t *testing.T) {
+	cl := newMemClient()
+	cl.objects["blob"] = []byte("0123456789")
+
+	ra := &readerAt{ctx: context.TODO(), client: cl, key: "blob", size: 10}
+	defer ra.Close()
+	buf := make([]byte, 4)
+	n, err := ra.ReadAt(buf, 2)
+	require.NoError(t, err)
+	require.Equal(t, "2345", string(buf[:n]))
+	// sequential reads share the request
+	_, err = ra.ReadAt(buf, 6)
+	require.NoError(t, err)
+	require.Equal(t, "6789", string(buf))
+	require.Equal(t, 1, cl.gets)
+
+	// reads past the end of the blob are short
+	n, err = ra.ReadAt(buf, 8)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, "89", string(buf[:n]))
+
+	// objects that are shorter than the blob fail the read
+	ra = &readerAt{ctx: context.TODO(), client: cl, key: "blob", size: 12}
+	n, err = ra.ReadAt(buf, 8)
+	require.Error(t, err)
+	require.NotEqual(t, io.EOF, err)
+	require.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+	require.Equal(t, 2, n)
+
+	// the reads are canceled with the context of the import
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	ra = &readerAt{ctx: ctx, client: cl, key: "blob", size: 10}
+	_, err = ra.ReadAt(buf, 0)
+	require.Equal(t, context.Canceled, err)
+}
+
+// memClient is an in-memory object store
+type memClient struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	gets    int
+	puts    int
+}
+
+func newMemClient() *memClient {
+	return &memClient{objects: map[string][]byte{}}
+}
+
+func (c *memClient) Exists(ctx context.Context, key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.objects[key]
+	return ok, nil
+}
+
+func (c *memClient) Get(ctx context.Context, key string, off int64) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gets++
+	dt, ok := c.objects[key]
+	if !ok {
+		return nil, nil
+	}
+	return ioutil.NopCloser(bytes.NewReader(dt[off:])), nil
+}
+
+func (c *memClient) Put(ctx context.Context, key string, ra io.ReaderAt, size int64) error {
+	dt, err := ioutil.ReadAll(io.NewSectionReader(ra, 0, size))
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.puts++
+	c.objects[key] = dt
+	return nil
+}
@@ -3,8 +3,10 @@ package registry
 import (
 	"context"
 	"strconv"
+	"strings"
 
 	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/platforms"
 	"github.com/containerd/containerd/remotes/docker"
 	"github.com/docker/distribution/reference"
 	"github.com/moby/buildkit/cache/remotecache"
@@ -31,8 +33,47 @@ func canonicalizeRef(rawRef string) (string, error) {
 const (
 	attrRef           = "ref"
 	attrOCIMediatypes = "oci-mediatypes"
+	attrInsecure      = "registry.insecure"
+	attrPlatform      = "platform"
+	attrTTL           = "ttl"
+	attrArtifact      = "artifact"
 )
 
+// parsePlatforms returns the matcher of the comma-separated platforms in v
+func parsePlatforms(v string) (platforms.Matcher, error) {
+	var ps []ocispecs.Platform
+	for _, s := range strings.Split(v, ",") {
+		p, err := platforms.Parse(strings.TrimSpace(s))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", attrPlatform)
+		}
+		ps = append(ps, platforms.Normalize(p))
+	}
+	return platforms.Any(ps...), nil
+}
+
+// registryHosts returns the registry configuration for the cache ref. Cache
+// may live in a different registry than the exported image so its host
+// configuration is resolved independently from the image push target.
+func registryHosts(hosts docker.RegistryHosts, ref string, scope string, attrs map[string]string) (docker.RegistryHosts, string, error) {
+	v, ok := attrs[attrInsecure]
+	if !ok {
+		return hosts, scope, nil
+	}
+	insecure, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to parse %s", attrInsecure)
+	}
+	if !insecure {
+		return hosts, scope, nil
+	}
+	parsed, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return nil, "", err
+	}
+	return resolver.InsecureHosts(hosts, reference.Domain(parsed)), scope + ":insecure", nil
+}
+
 func ResolveCacheExporterFunc(sm *session.Manager, hosts docker.RegistryHosts) remotecache.ResolveCacheExporterFunc {
 	return func(ctx context.Context, g session.Group, attrs map[string]string) (remotecache.Exporter, error) {
 		ref, err := canonicalizeRef(attrs[attrRef])
@@ -47,12 +88,34 @@ func ResolveCacheExporterFunc(sm *session.Manager, hosts docker.RegistryHosts) r
 			}
 			ociMediatypes = b
 		}
-		remote := resolver.DefaultPool.GetResolver(hosts, ref, "push", sm, g)
+		var artifact bool
+		if v, ok := attrs[attrArtifact]; ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s", attrArtifact)
+			}
+			artifact = b
+		}
+		if artifact && !ociMediatypes {
+			return nil, errors.Errorf("%s requires %s", attrArtifact, attrOCIMediatypes)
+		}
+		ttl, err := remotecache.ParseTTL(attrs, attrTTL)
+		if err != nil {
+			return nil, err
+		}
+		hosts, scope, err := registryHosts(hosts, ref, "push", attrs)
+		if err != nil {
+			return nil, err
+		}
+		remote := resolver.DefaultPool.GetResolver(hosts, ref, scope, sm, g)
 		pusher, err := remote.Pusher(ctx, ref)
 		if err != nil {
 			return nil, err
 		}
-		return remotecache.NewExporter(contentutil.FromPusher(pusher), ref, ociMediatypes), nil
+		if artifact {
+			return remotecache.NewArtifactExporter(contentutil.FromPusher(pusher), ref, ttl), nil
+		}
+		return remotecache.NewExpiringExporter(contentutil.FromPusher(pusher), ref, ociMediatypes, ttl), nil
 	}
 }
 
@@ -62,7 +125,17 @@ func ResolveCacheImporterFunc(sm *session.Manager, cs content.Store, hosts docke
 		if err != nil {
 			return nil, ocispecs.Descriptor{}, err
 		}
-		remote := resolver.DefaultPool.GetResolver(hosts, ref, "pull", sm, g)
+		var p platforms.Matcher
+		if v, ok := attrs[attrPlatform]; ok && v != "" {
+			if p, err = parsePlatforms(v); err != nil {
+				return nil, ocispecs.Descriptor{}, err
+			}
+		}
+		hosts, scope, err := registryHosts(hosts, ref, "pull", attrs)
+		if err != nil {
+			return nil, ocispecs.Descriptor{}, err
+		}
+		remote := resolver.DefaultPool.GetResolver(hosts, ref, scope, sm, g)
 		xref, desc, err := remote.Resolve(ctx, ref)
 		if err != nil {
 			return nil, ocispecs.Descriptor{}, err
@@ -76,6 +149,9 @@ func ResolveCacheImporterFunc(sm *session.Manager, cs content.Store, hosts docke
 			ref:      ref,
 			source:   cs,
 		}
+		if p != nil {
+			return remotecache.NewPlatformImporter(src, p), desc, nil
+		}
 		return remotecache.NewImporter(src), desc, nil
 	}
 }
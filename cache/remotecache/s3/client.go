@@ -0,0 +1,374 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	// minPartSize is the minimum size of the parts of a multipart upload
+	// except the last one
+	minPartSize = 5 << 20
+)
+
+// credentials are the AWS credentials the requests are signed with
+type credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// client is a minimal client of the S3 REST API. Requests are signed with
+// AWS signature version 4.
+type client struct {
+	httpClient *http.Client
+	endpoint   *url.URL
+	bucket     string
+	region     string
+	pathStyle  bool
+	creds      *credentialsProvider
+	partSize   int64
+	now        func() time.Time
+}
+
+func (c *client) objectURL(key string, query url.Values) *url.URL {
+	u := *c.endpoint
+	if c.pathStyle {
+		u.Path = "/" + c.bucket + "/" + key
+	} else {
+		u.Host = c.bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = ""
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+func (c *client) newRequest(ctx context.Context, method, key string, query url.Values, body io.Reader, size int64) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.objectURL(key, query).String(), body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.ContentLength = size
+	}
+	return req, nil
+}
+
+// do signs and sends req. Responses with other status codes than ok are
+// returned as errors.
+func (c *client) do(req *http.Request, payloadHash string, ok ...int) (*http.Response, error) {
+	creds, err := c.creds.Credentials(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	c.sign(req, payloadHash, creds)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to %s %s", req.Method, req.URL.Path)
+	}
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	return nil, responseError(req, resp)
+}
+
+// Exists returns false if the object with key doesn't exist
+func (c *client) Exists(ctx context.Context, key string) (bool, error) {
+	req, err := c.newRequest(ctx, http.MethodHead, key, nil, nil, 0)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.do(req, emptyPayloadHash, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// Get returns the contents of the object with key from offset off. nil is
+// returned if the object doesn't exist.
+func (c *client) Get(ctx context.Context, key string, off int64) (io.ReadCloser, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, key, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if off > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", off))
+	}
+	resp, err := c.do(req, emptyPayloadHash, http.StatusOK, http.StatusPartialContent, http.StatusNotFound)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, nil
+	}
+	if off > 0 && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, errors.Errorf("range requests not supported for %s", key)
+	}
+	return resp.Body, nil
+}
+
+// Put uploads the object with key. Objects larger than the part size are
+// uploaded with a multipart upload.
+func (c *client) Put(ctx context.Context, key string, ra io.ReaderAt, size int64) error {
+	if size > c.partSize {
+		return c.putMultipart(ctx, key, ra, size)
+	}
+	req, err := c.newRequest(ctx, http.MethodPut, key, nil, io.NewSectionReader(ra, 0, size), size)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req, unsignedPayload, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+func (c *client) putMultipart(ctx context.Context, key string, ra io.ReaderAt, size int64) (err error) {
+	req, err := c.newRequest(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req, emptyPayloadHash, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	var res initiateMultipartUploadResult
+	err = xml.NewDecoder(resp.Body).Decode(&res)
+	resp.Body.Close()
+	if err != nil {
+		return errors.Wrapf(err, "failed to start multipart upload of %s", key)
+	}
+	uploadID := res.UploadID
+
+	defer func() {
+		if err != nil {
+			c.abortMultipart(context.TODO(), key, uploadID)
+		}
+	}()
+
+	var complete completeMultipartUpload
+	for off, n := int64(0), 1; off < size; off, n = off+c.partSize, n+1 {
+		partSize := c.partSize
+		if size-off < partSize {
+			partSize = size - off
+		}
+		req, err := c.newRequest(ctx, http.MethodPut, key, url.Values{
+			"partNumber": {strconv.Itoa(n)},
+			"uploadId":   {uploadID},
+		}, io.NewSectionReader(ra, off, partSize), partSize)
+		if err != nil {
+			return err
+		}
+		resp, err := c.do(req, unsignedPayload, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		complete.Parts = append(complete.Parts, completedPart{PartNumber: n, ETag: resp.Header.Get("ETag")})
+	}
+
+	dt, err := xml.Marshal(complete)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req, err = c.newRequest(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, bytes.NewReader(dt), int64(len(dt)))
+	if err != nil {
+		return err
+	}
+	resp, err = c.do(req, payloadHash(dt), http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// errors after the upload started are returned with status ok
+	dt, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if bytes.Contains(dt, []byte("<Error>")) {
+		return parseError(req, resp.StatusCode, dt)
+	}
+	return nil
+}
+
+func (c *client) abortMultipart(ctx context.Context, key, uploadID string) {
+	req, err := c.newRequest(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, 0)
+	if err != nil {
+		return
+	}
+	if resp, err := c.do(req, emptyPayloadHash, http.StatusNoContent); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// sign adds the AWS signature version 4 headers to req
+func (c *client) sign(req *http.Request, payloadHash string, creds credentials) {
+	t := c.now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-") || k == "range" || k == "content-md5" {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(sha256Sum([]byte(canonicalRequest))),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes query sorted by key as required for signing
+func canonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, escape(k)+"="+escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = escape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// escape encodes all bytes of s except the unreserved characters of RFC 3986
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func payloadHash(dt []byte) string {
+	return hex.EncodeToString(sha256Sum(dt))
+}
+
+func sha256Sum(dt []byte) []byte {
+	h := sha256.Sum256(dt)
+	return h[:]
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func responseError(req *http.Request, resp *http.Response) error {
+	dt, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	return parseError(req, resp.StatusCode, dt)
+}
+
+func parseError(req *http.Request, status int, dt []byte) error {
+	var e s3Error
+	if err := xml.Unmarshal(dt, &e); err == nil && e.Code != "" {
+		return errors.Errorf("failed to %s %s: %s: %s", req.Method, req.URL.Path, e.Code, e.Message)
+	}
+	return errors.Errorf("failed to %s %s: %s", req.Method, req.URL.Path, http.StatusText(status))
+}
@@ -0,0 +1,363 @@
+package s3
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultContainerCredentialsHost = "http://169.254.170.2"
+	defaultIMDSEndpoint             = "http://169.254.169.254"
+
+	// imdsTimeout bounds the requests to the instance metadata service so
+	// that hosts outside of EC2 fail fast
+	imdsTimeout = 5 * time.Second
+)
+
+// credentialsProvider resolves the credentials the requests are signed with.
+// Without static credentials the default credential chain of the AWS SDKs is
+// followed: the environment, the shared credentials file, web identity
+// federation, the container credentials of ECS and EKS pod identity and the
+// instance profile of EC2. Temporary credentials are cached until shortly
+// before they expire.
+type credentialsProvider struct {
+	httpClient    *http.Client
+	static        *credentials
+	region        string
+	stsURL        string
+	containerHost string
+	imdsURL       string
+	now           func() time.Time
+
+	mu     sync.Mutex
+	creds  credentials
+	expiry time.Time
+}
+
+func newCredentialsProvider(c *Config, httpClient *http.Client) *credentialsProvider {
+	p := &credentialsProvider{
+		httpClient:    httpClient,
+		region:        c.Region,
+		stsURL:        "https://sts." + c.Region + ".amazonaws.com/",
+		containerHost: defaultContainerCredentialsHost,
+		imdsURL:       defaultIMDSEndpoint,
+		now:           time.Now,
+	}
+	if c.AccessKeyID != "" || c.SecretAccessKey != "" {
+		p.static = &credentials{
+			AccessKeyID:     c.AccessKeyID,
+			SecretAccessKey: c.SecretAccessKey,
+			SessionToken:    c.SessionToken,
+		}
+	}
+	if v := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"); v != "" {
+		p.imdsURL = strings.TrimSuffix(v, "/")
+	}
+	return p
+}
+
+// Credentials returns the credentials of the first source of the chain that
+// is configured
+func (p *credentialsProvider) Credentials(ctx context.Context) (credentials, error) {
+	if p.static != nil {
+		return *p.static, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// refresh a few minutes early so that credentials don't expire in flight
+	if p.creds.AccessKeyID != "" && (p.expiry.IsZero() || p.now().Add(5*time.Minute).Before(p.expiry)) {
+		return p.creds, nil
+	}
+
+	sources := []func(context.Context) (credentials, time.Time, bool, error){
+		p.fromEnv,
+		p.fromSharedFile,
+		p.fromWebIdentity,
+		p.fromContainer,
+		p.fromIMDS,
+	}
+	for _, source := range sources {
+		creds, expiry, ok, err := source(ctx)
+		if err != nil {
+			return credentials{}, err
+		}
+		if ok {
+			p.creds, p.expiry = creds, expiry
+			return creds, nil
+		}
+	}
+	return credentials{}, errors.Errorf("credentials not set for s3 cache")
+}
+
+func (p *credentialsProvider) fromEnv(ctx context.Context) (credentials, time.Time, bool, error) {
+	id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if id == "" || secret == "" {
+		return credentials{}, time.Time{}, false, nil
+	}
+	return credentials{
+		AccessKeyID:     id,
+		SecretAccessKey: secret,
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}, time.Time{}, true, nil
+}
+
+// fromSharedFile reads the profile AWS_PROFILE of the shared credentials
+// file, ~/.aws/credentials by default
+func (p *credentialsProvider) fromSharedFile(ctx context.Context) (credentials, time.Time, bool, error) {
+	fn := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if fn == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return credentials{}, time.Time{}, false, nil
+		}
+		fn = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return credentials{}, time.Time{}, false, nil
+		}
+		return credentials{}, time.Time{}, false, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	var section string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		if parts := strings.SplitN(line, "=", 2); len(parts) == 2 {
+			values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return credentials{}, time.Time{}, false, errors.Wrapf(err, "failed to read %s", fn)
+	}
+	if values["aws_access_key_id"] == "" || values["aws_secret_access_key"] == "" {
+		return credentials{}, time.Time{}, false, nil
+	}
+	return credentials{
+		AccessKeyID:     values["aws_access_key_id"],
+		SecretAccessKey: values["aws_secret_access_key"],
+		SessionToken:    values["aws_session_token"],
+	}, time.Time{}, true, nil
+}
+
+// fromWebIdentity assumes the role AWS_ROLE_ARN with the token in
+// AWS_WEB_IDENTITY_TOKEN_FILE, which is how IRSA provides credentials on EKS
+func (p *credentialsProvider) fromWebIdentity(ctx context.Context) (credentials, time.Time, bool, error) {
+	fn, role := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN")
+	if fn == "" || role == "" {
+		return credentials{}, time.Time{}, false, nil
+	}
+	token, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return credentials{}, time.Time{}, false, errors.Wrap(err, "failed to read web identity token")
+	}
+	session := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if session == "" {
+		session = fmt.Sprintf("buildkit-%d", p.now().UnixNano())
+	}
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {session},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequest(http.MethodPost, p.stsURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return credentials{}, time.Time{}, false, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return credentials{}, time.Time{}, false, errors.Wrapf(err, "failed to assume role %s", role)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		dt, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<12))
+		return credentials{}, time.Time{}, false, errors.Errorf("failed to assume role %s: unexpected status %s: %s", role, resp.Status, strings.TrimSpace(string(dt)))
+	}
+	var out struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return credentials{}, time.Time{}, false, errors.Wrap(err, "failed to decode STS response")
+	}
+	c := out.Credentials
+	return credentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+	}, c.Expiration, true, nil
+}
+
+// fromContainer gets the credentials of the task role on ECS or of EKS pod
+// identity from the container credentials endpoint
+func (p *credentialsProvider) fromContainer(ctx context.Context) (credentials, time.Time, bool, error) {
+	var u string
+	if v := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); v != "" {
+		u = p.containerHost + v
+	} else if v := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); v != "" {
+		u = v
+	} else {
+		return credentials{}, time.Time{}, false, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return credentials{}, time.Time{}, false, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if fn := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); fn != "" {
+		dt, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return credentials{}, time.Time{}, false, errors.Wrap(err, "failed to read container authorization token")
+		}
+		token = strings.TrimSpace(string(dt))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	creds, expiry, err := p.getJSONCredentials(req)
+	if err != nil {
+		return credentials{}, time.Time{}, false, errors.Wrap(err, "failed to get container credentials")
+	}
+	return creds, expiry, true, nil
+}
+
+// fromIMDS gets the credentials of the instance profile from the instance
+// metadata service of EC2 with a session token as required by IMDSv2
+func (p *credentialsProvider) fromIMDS(ctx context.Context) (credentials, time.Time, bool, error) {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return credentials{}, time.Time{}, false, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, imdsTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPut, p.imdsURL+"/latest/api/token", nil)
+	if err != nil {
+		return credentials{}, time.Time{}, false, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		// not running on EC2
+		return credentials{}, time.Time{}, false, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return credentials{}, time.Time{}, false, errors.Errorf("failed to get instance metadata token: %s", resp.Status)
+	}
+	dt, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<12))
+	if err != nil {
+		return credentials{}, time.Time{}, false, errors.WithStack(err)
+	}
+	token := string(dt)
+
+	base := p.imdsURL + "/latest/meta-data/iam/security-credentials/"
+	req, err = http.NewRequest(http.MethodGet, base, nil)
+	if err != nil {
+		return credentials{}, time.Time{}, false, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	resp, err = p.httpClient.Do(req)
+	if err != nil {
+		return credentials{}, time.Time{}, false, errors.Wrap(err, "failed to get instance profile")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// no instance profile attached
+		return credentials{}, time.Time{}, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return credentials{}, time.Time{}, false, errors.Errorf("failed to get instance profile: %s", resp.Status)
+	}
+	dt, err = ioutil.ReadAll(io.LimitReader(resp.Body, 1<<12))
+	if err != nil {
+		return credentials{}, time.Time{}, false, errors.WithStack(err)
+	}
+	role := strings.TrimSpace(strings.SplitN(string(dt), "\n", 2)[0])
+	if role == "" {
+		return credentials{}, time.Time{}, false, nil
+	}
+
+	req, err = http.NewRequest(http.MethodGet, base+url.PathEscape(role), nil)
+	if err != nil {
+		return credentials{}, time.Time{}, false, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	creds, expiry, err := p.getJSONCredentials(req)
+	if err != nil {
+		return credentials{}, time.Time{}, false, errors.Wrapf(err, "failed to get credentials of instance profile %s", role)
+	}
+	return creds, expiry, true, nil
+}
+
+// getJSONCredentials sends req and decodes the credentials in the format of
+// the container and instance metadata endpoints
+func (p *credentialsProvider) getJSONCredentials(req *http.Request) (credentials, time.Time, error) {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return credentials{}, time.Time{}, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return credentials{}, time.Time{}, errors.Errorf("unexpected status %s", resp.Status)
+	}
+	var out struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return credentials{}, time.Time{}, errors.Wrap(err, "invalid credentials response")
+	}
+	if out.AccessKeyID == "" || out.SecretAccessKey == "" {
+		return credentials{}, time.Time{}, errors.New("no credentials in response")
+	}
+	return credentials{
+		AccessKeyID:     out.AccessKeyID,
+		SecretAccessKey: out.SecretAccessKey,
+		SessionToken:    out.Token,
+	}, out.Expiration, nil
+}
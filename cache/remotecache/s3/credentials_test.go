@@ -0,0 +1,176 @@
+package s3
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// clearCredentialsEnv unsets the variables of the credential chain so that
+// the environment of the test doesn't leak into it
+func clearCredentialsEnv(t *testing.T) {
+	for _, k := range []string{
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+		"AWS_SHARED_CREDENTIALS_FILE", "AWS_PROFILE",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_ROLE_SESSION_NAME",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN", "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+		"AWS_EC2_METADATA_SERVICE_ENDPOINT",
+	} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+func TestCredentialsStatic(t *testing.T) {
+	clearCredentialsEnv(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "env")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+
+	p := newCredentialsProvider(&Config{Region: "us-east-1", AccessKeyID: "id", SecretAccessKey: "secret"}, http.DefaultClient)
+	creds, err := p.Credentials(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, credentials{AccessKeyID: "id", SecretAccessKey: "secret"}, creds)
+}
+
+func TestCredentialsEnv(t *testing.T) {
+	clearCredentialsEnv(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "env")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+	t.Setenv("AWS_SESSION_TOKEN", "env-token")
+
+	p := newCredentialsProvider(&Config{Region: "us-east-1"}, http.DefaultClient)
+	creds, err := p.Credentials(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, credentials{AccessKeyID: "env", SecretAccessKey: "env-secret", SessionToken: "env-token"}, creds)
+}
+
+func TestCredentialsSharedFile(t *testing.T) {
+	clearCredentialsEnv(t)
+	fn := filepath.Join(t.TempDir(), "credentials")
+	require.NoError(t, ioutil.WriteFile(fn, []byte(`[default]
+aws_access_key_id = default
+aws_secret_access_key = default-secret
+
+# builder profile
+[builder]
+aws_access_key_id = builder
+aws_secret_access_key = builder-secret
+aws_session_token = builder-token
+`), 0600))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", fn)
+
+	p := newCredentialsProvider(&Config{Region: "us-east-1"}, http.DefaultClient)
+	creds, err := p.Credentials(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, credentials{AccessKeyID: "default", SecretAccessKey: "default-secret"}, creds)
+
+	t.Setenv("AWS_PROFILE", "builder")
+	p = newCredentialsProvider(&Config{Region: "us-east-1"}, http.DefaultClient)
+	creds, err = p.Credentials(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, credentials{AccessKeyID: "builder", SecretAccessKey: "builder-secret", SessionToken: "builder-token"}, creds)
+}
+
+func TestCredentialsWebIdentity(t *testing.T) {
+	clearCredentialsEnv(t)
+	fn := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, ioutil.WriteFile(fn, []byte("jwt\n"), 0600))
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", fn)
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/builder")
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "AssumeRoleWithWebIdentity", r.Form.Get("Action"))
+		require.Equal(t, "arn:aws:iam::123456789012:role/builder", r.Form.Get("RoleArn"))
+		require.Equal(t, "jwt", r.Form.Get("WebIdentityToken"))
+		w.Write([]byte(`<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+<AccessKeyId>role</AccessKeyId><SecretAccessKey>role-secret</SecretAccessKey><SessionToken>role-token</SessionToken><Expiration>2020-01-01T01:00:00Z</Expiration>
+</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`))
+	}))
+	defer srv.Close()
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := newCredentialsProvider(&Config{Region: "us-east-1"}, srv.Client())
+	p.stsURL = srv.URL
+	p.now = func() time.Time { return now }
+
+	creds, err := p.Credentials(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, credentials{AccessKeyID: "role", SecretAccessKey: "role-secret", SessionToken: "role-token"}, creds)
+
+	_, err = p.Credentials(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+
+	// refreshed shortly before they expire
+	now = now.Add(58 * time.Minute)
+	_, err = p.Credentials(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+}
+
+func TestCredentialsContainer(t *testing.T) {
+	clearCredentialsEnv(t)
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "/v2/credentials/task")
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "auth")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v2/credentials/task", r.URL.Path)
+		require.Equal(t, "auth", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"AccessKeyId":"task","SecretAccessKey":"task-secret","Token":"task-token","Expiration":"2020-01-01T01:00:00Z"}`))
+	}))
+	defer srv.Close()
+
+	p := newCredentialsProvider(&Config{Region: "us-east-1"}, srv.Client())
+	p.containerHost = srv.URL
+	creds, err := p.Credentials(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, credentials{AccessKeyID: "task", SecretAccessKey: "task-secret", SessionToken: "task-token"}, creds)
+}
+
+func TestCredentialsIMDS(t *testing.T) {
+	clearCredentialsEnv(t)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPut, r.Method)
+		w.Write([]byte("session"))
+	})
+	mux.HandleFunc("/latest/meta-data/iam/security-credentials/", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "session", r.Header.Get("X-aws-ec2-metadata-token"))
+		if r.URL.Path == "/latest/meta-data/iam/security-credentials/" {
+			w.Write([]byte("builder"))
+			return
+		}
+		require.Equal(t, "/latest/meta-data/iam/security-credentials/builder", r.URL.Path)
+		w.Write([]byte(`{"Code":"Success","AccessKeyId":"instance","SecretAccessKey":"instance-secret","Token":"instance-token","Expiration":"2020-01-01T01:00:00Z"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", srv.URL)
+
+	p := newCredentialsProvider(&Config{Region: "us-east-1"}, srv.Client())
+	creds, err := p.Credentials(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, credentials{AccessKeyID: "instance", SecretAccessKey: "instance-secret", SessionToken: "instance-token"}, creds)
+}
+
+func TestCredentialsNotSet(t *testing.T) {
+	clearCredentialsEnv(t)
+
+	p := newCredentialsProvider(&Config{Region: "us-east-1"}, http.DefaultClient)
+	_, err := p.Credentials(context.TODO())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "credentials not set")
+}
@@ -0,0 +1,177 @@
+package s3
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/moby/buildkit/cache/remotecache"
+	"github.com/moby/buildkit/cache/remotecache/objectstore"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/util/tracing"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	attrBucket          = "bucket"
+	attrRegion          = "region"
+	attrPrefix          = "prefix"
+	attrName            = "name"
+	attrIndexURL        = "index_url"
+	attrEndpointURL     = "endpoint_url"
+	attrUsePathStyle    = "use_path_style"
+	attrAccessKeyID     = "access_key_id"
+	attrSecretAccessKey = "secret_access_key"
+	attrSessionToken    = "session_token"
+	attrPartSize        = "upload_part_size"
+
+	defaultPartSize = 64 << 20
+)
+
+type Config struct {
+	Bucket string
+	Region string
+	// Prefix is prepended to the keys of the blobs and manifests
+	Prefix string
+	// Name of the cache manifest, defaults to buildkit
+	Name string
+	// IndexURL is the URL of a key-value store, e.g. redis://host:6379/0,
+	// that the cache chains are written to instead of the cache manifest
+	IndexURL string
+	// EndpointURL of S3 compatible services, defaults to AWS
+	EndpointURL  string
+	UsePathStyle bool
+	// AccessKeyID, SecretAccessKey and SessionToken are static
+	// credentials. Without them the credentials are resolved with the
+	// default credential chain of the AWS SDKs.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// PartSize is the size of the parts of multipart uploads, blobs up to
+	// this size are uploaded with a single request
+	PartSize int64
+}
+
+func getConfig(attrs map[string]string) (*Config, error) {
+	cfg := &Config{
+		Bucket:          attrs[attrBucket],
+		Region:          attrs[attrRegion],
+		Prefix:          attrs[attrPrefix],
+		Name:            attrs[attrName],
+		IndexURL:        attrs[attrIndexURL],
+		EndpointURL:     attrs[attrEndpointURL],
+		AccessKeyID:     attrs[attrAccessKeyID],
+		SecretAccessKey: attrs[attrSecretAccessKey],
+		SessionToken:    attrs[attrSessionToken],
+		PartSize:        defaultPartSize,
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.Errorf("bucket not set for s3 cache")
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+	if cfg.Region == "" {
+		return nil, errors.Errorf("region not set for s3 cache")
+	}
+	if cfg.Name == "" {
+		cfg.Name = "buildkit"
+	}
+	if (cfg.AccessKeyID == "") != (cfg.SecretAccessKey == "") {
+		return nil, errors.Errorf("%s and %s must be set together for s3 cache", attrAccessKeyID, attrSecretAccessKey)
+	}
+	if v, ok := attrs[attrUsePathStyle]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "non-bool value specified for %s", attrUsePathStyle)
+		}
+		cfg.UsePathStyle = b
+	}
+	if v, ok := attrs[attrPartSize]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < minPartSize {
+			return nil, errors.Errorf("invalid %s %q, expected at least %d bytes", attrPartSize, v, minPartSize)
+		}
+		cfg.PartSize = n
+	}
+	return cfg, nil
+}
+
+func newClient(c *Config) (*client, error) {
+	endpoint := c.EndpointURL
+	if endpoint == "" {
+		endpoint = "https://s3." + c.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", attrEndpointURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("invalid %s %q, expected http or https URL", attrEndpointURL, endpoint)
+	}
+	return &client{
+		httpClient: tracing.DefaultClient,
+		endpoint:   u,
+		bucket:     c.Bucket,
+		region:     c.Region,
+		pathStyle:  c.UsePathStyle,
+		creds:      newCredentialsProvider(c, tracing.DefaultClient),
+		partSize:   c.PartSize,
+		now:        time.Now,
+	}, nil
+}
+
+// storeConfig returns the location of the cache in the s3 store
+func storeConfig(c *Config) objectstore.Config {
+	return objectstore.Config{
+		Prefix:      c.Prefix,
+		Name:        c.Name,
+		IndexURL:    c.IndexURL,
+		IndexPrefix: "s3:" + c.Bucket + "/",
+	}
+}
+
+// ResolveCacheExporterFunc for S3 cache exporter.
+func ResolveCacheExporterFunc() remotecache.ResolveCacheExporterFunc {
+	return func(ctx context.Context, g session.Group, attrs map[string]string) (remotecache.Exporter, error) {
+		cfg, err := getConfig(attrs)
+		if err != nil {
+			return nil, err
+		}
+		return NewExporter(cfg)
+	}
+}
+
+func NewExporter(c *Config) (remotecache.Exporter, error) {
+	cl, err := newClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return objectstore.NewExporter(cl, storeConfig(c)), nil
+}
+
+// ResolveCacheImporterFunc for S3 cache importer.
+func ResolveCacheImporterFunc() remotecache.ResolveCacheImporterFunc {
+	return func(ctx context.Context, g session.Group, attrs map[string]string) (remotecache.Importer, ocispecs.Descriptor, error) {
+		cfg, err := getConfig(attrs)
+		if err != nil {
+			return nil, ocispecs.Descriptor{}, err
+		}
+		i, err := NewImporter(cfg)
+		if err != nil {
+			return nil, ocispecs.Descriptor{}, err
+		}
+		return i, ocispecs.Descriptor{}, nil
+	}
+}
+
+func NewImporter(c *Config) (remotecache.Importer, error) {
+	cl, err := newClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return objectstore.NewImporter(cl, storeConfig(c)), nil
+}
@@ -0,0 +1,122 @@
+package remotecache
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/containerd/containerd/content"
+	"github.com/moby/buildkit/util/bklog"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// ErrCorruptContent is returned when a blob fetched from a remote cache
+// doesn't match its descriptor
+var ErrCorruptContent = errors.New("corrupt content")
+
+// maxCorruptBlobs is the number of corrupt blobs a cache manifest may deliver
+// before it isn't imported anymore
+const maxCorruptBlobs = 3
+
+var corruptManifests = newCorruptionTracker(maxCorruptBlobs)
+
+// corruptionTracker counts corrupt blobs delivered per cache manifest
+type corruptionTracker struct {
+	mu    sync.Mutex
+	max   int
+	count map[digest.Digest]int
+}
+
+func newCorruptionTracker(max int) *corruptionTracker {
+	return &corruptionTracker{
+		max:   max,
+		count: map[digest.Digest]int{},
+	}
+}
+
+func (t *corruptionTracker) add(manifest digest.Digest) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.count[manifest]++
+}
+
+func (t *corruptionTracker) blacklisted(manifest digest.Digest) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.count[manifest] >= t.max
+}
+
+// verifyingProvider checks the digest of blobs read sequentially from the
+// remote cache, so that corrupt layers are rejected before they are recorded
+// as local blobs. Corrupt blobs are counted against the cache manifest.
+type verifyingProvider struct {
+	content.Provider
+	manifest digest.Digest
+	tracker  *corruptionTracker
+}
+
+func (p *verifyingProvider) ReaderAt(ctx context.Context, desc ocispecs.Descriptor) (content.ReaderAt, error) {
+	ra, err := p.Provider.ReaderAt(ctx, desc)
+	if err != nil || !desc.Digest.Algorithm().Available() {
+		return ra, err
+	}
+	return &verifyingReaderAt{
+		ReaderAt: ra,
+		desc:     desc,
+		digester: desc.Digest.Algorithm().Digester(),
+		onCorrupt: func(err error) {
+			bklog.G(ctx).Warnf("cache manifest %s delivered corrupt blob: %v", p.manifest, err)
+			p.tracker.add(p.manifest)
+		},
+	}, nil
+}
+
+type verifyingReaderAt struct {
+	content.ReaderAt
+	desc      ocispecs.Descriptor
+	onCorrupt func(error)
+
+	mu       sync.Mutex
+	digester digest.Digester
+	offset   int64
+	// skip is set once the blob isn't read sequentially, verification is
+	// then left to the content store
+	skip bool
+}
+
+func (r *verifyingReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	n, err := r.ReaderAt.ReadAt(b, off)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.skip || (n == 0 && err == nil) {
+		return n, err
+	}
+	if off != r.offset {
+		r.skip = true
+		return n, err
+	}
+	r.digester.Hash().Write(b[:n])
+	r.offset += int64(n)
+
+	var verr error
+	switch {
+	case r.offset > r.desc.Size:
+		verr = errors.Wrapf(ErrCorruptContent, "blob %s is larger than expected %d bytes", r.desc.Digest, r.desc.Size)
+	case r.offset == r.desc.Size:
+		if dgst := r.digester.Digest(); dgst != r.desc.Digest {
+			verr = errors.Wrapf(ErrCorruptContent, "expected %s, got %s", r.desc.Digest, dgst)
+		}
+		r.skip = true
+	case err == io.EOF:
+		verr = errors.Wrapf(ErrCorruptContent, "blob %s is truncated at %d of %d bytes", r.desc.Digest, r.offset, r.desc.Size)
+	}
+	if verr != nil {
+		r.skip = true
+		r.onCorrupt(verr)
+		return n, verr
+	}
+	return n, err
+}
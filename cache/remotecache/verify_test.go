@@ -0,0 +1,56 @@
+package remotecache
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyingProvider(t *testing.T) {
+	ctx := context.TODO()
+	good := []byte("layer data")
+	desc := ocispecs.Descriptor{
+		Digest: digest.FromBytes(good),
+		Size:   int64(len(good)),
+	}
+	manifest := digest.FromBytes([]byte("manifest"))
+	tracker := newCorruptionTracker(2)
+
+	p := &verifyingProvider{Provider: staticProvider(good), manifest: manifest, tracker: tracker}
+	dt, err := content.ReadBlob(ctx, p, desc)
+	require.NoError(t, err)
+	require.Equal(t, good, dt)
+	require.False(t, tracker.blacklisted(manifest))
+
+	p = &verifyingProvider{Provider: staticProvider([]byte("evil data!")), manifest: manifest, tracker: tracker}
+	_, err = content.ReadBlob(ctx, p, desc)
+	require.True(t, errors.Is(err, ErrCorruptContent))
+	require.False(t, tracker.blacklisted(manifest))
+
+	p = &verifyingProvider{Provider: staticProvider(good[:4]), manifest: manifest, tracker: tracker}
+	ra, err := p.ReaderAt(ctx, desc)
+	require.NoError(t, err)
+	_, err = ra.ReadAt(make([]byte, 8), 0)
+	require.True(t, errors.Is(err, ErrCorruptContent))
+	require.True(t, tracker.blacklisted(manifest))
+}
+
+type staticProvider []byte
+
+func (p staticProvider) ReaderAt(ctx context.Context, desc ocispecs.Descriptor) (content.ReaderAt, error) {
+	return &readerAt{Reader: bytes.NewReader(p)}, nil
+}
+
+type readerAt struct {
+	*bytes.Reader
+}
+
+func (r *readerAt) Close() error {
+	return nil
+}
@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/filters"
+	"github.com/containerd/containerd/leases"
+	"github.com/moby/buildkit/client"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// VerifyBlobs re-hashes the blobs of the content store and compares them
+// with their digests. Unless dryRun is set, corrupt blobs are deleted and the
+// records that have them in their chain are pruned if they aren't in use.
+// Records in use that weren't extracted become lazy and fetch the blob again
+// from their remote. The blobs of the extracted ones are cleared, so that
+// they are created again from their snapshots.
+func (cm *cacheManager) VerifyBlobs(ctx context.Context, dryRun bool) (*client.VerifyInfo, error) {
+	var infos []content.Info
+	if err := cm.ContentStore.Walk(ctx, func(info content.Info) error {
+		infos = append(infos, info)
+		return nil
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	res := &client.VerifyInfo{}
+	for _, info := range infos {
+		ok, err := verifyBlob(ctx, cm.ContentStore, info)
+		if err != nil {
+			// deleted while verifying
+			if errors.Is(err, errdefs.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		res.Checked++
+		if !ok {
+			res.Corrupt = append(res.Corrupt, client.CorruptBlob{
+				Digest: info.Digest,
+				Size:   info.Size,
+			})
+		}
+	}
+	if len(res.Corrupt) == 0 {
+		return res, nil
+	}
+
+	corrupt := make(map[digest.Digest]*client.CorruptBlob, len(res.Corrupt))
+	for i := range res.Corrupt {
+		corrupt[res.Corrupt[i].Digest] = &res.Corrupt[i]
+	}
+	affected := map[string]struct{}{}
+	cm.mu.Lock()
+	for id, cr := range cm.records {
+		cr.mu.Lock()
+		// children can't be exported without the blobs of their parents, so
+		// they are reported for the corrupt blobs of their chain
+		for _, dgst := range cr.parentChain() {
+			if b, ok := corrupt[dgst]; ok {
+				b.Records = append(b.Records, id)
+				affected[id] = struct{}{}
+			}
+		}
+		cr.mu.Unlock()
+	}
+	cm.mu.Unlock()
+	for _, b := range res.Corrupt {
+		sort.Strings(b.Records)
+	}
+
+	if dryRun {
+		return res, nil
+	}
+
+	for i := range res.Corrupt {
+		b := &res.Corrupt[i]
+		if err := cm.ContentStore.Delete(ctx, b.Digest); err != nil && !errors.Is(err, errdefs.ErrNotFound) {
+			return nil, errors.Wrapf(err, "failed to evict corrupt blob %s", b.Digest)
+		}
+		b.Evicted = true
+	}
+
+	cm.muPrune.Lock()
+	err := cm.prune(ctx, nil, pruneOpt{
+		filter: filters.FilterFunc(func(a filters.Adaptor) bool {
+			id, _ := a.Field([]string{"id"})
+			_, ok := affected[id]
+			return ok
+		}),
+		all: true,
+	})
+	cm.muPrune.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cm.clearCorruptBlobs(ctx, affected); err != nil {
+		return nil, err
+	}
+
+	if cm.GarbageCollect != nil {
+		if _, err := cm.GarbageCollect(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// clearCorruptBlobs clears the blobs of the affected records that were kept
+// by the prune as they are in use. Records that weren't extracted keep their
+// blob and are lazy now that it is missing.
+func (cm *cacheManager) clearCorruptBlobs(ctx context.Context, affected map[string]struct{}) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	for id := range affected {
+		cr, ok := cm.records[id]
+		if !ok {
+			continue
+		}
+		cr.mu.Lock()
+		cr.parentChainCache = nil
+		if !getBlobOnly(cr.md) {
+			if blob := getBlob(cr.md); blob != "" {
+				if err := cm.LeaseManager.DeleteResource(ctx, leases.Lease{ID: id}, leases.Resource{
+					ID:   blob,
+					Type: "content",
+				}); err != nil && !errors.Is(err, errdefs.ErrNotFound) {
+					cr.mu.Unlock()
+					return err
+				}
+			}
+			if err := clearBlob(cr.md); err != nil {
+				cr.mu.Unlock()
+				return err
+			}
+		}
+		cr.mu.Unlock()
+	}
+	return nil
+}
+
+// verifyBlobs verifies the blobs every interval until ctx is done
+func (cm *cacheManager) verifyBlobs(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		res, err := cm.VerifyBlobs(ctx, false)
+		if err != nil {
+			logrus.Warnf("failed to verify blobs: %+v", err)
+			continue
+		}
+		for _, b := range res.Corrupt {
+			logrus.Warnf("evicted corrupt blob %s of cache records %v", b.Digest, b.Records)
+		}
+	}
+}
+
+// verifyBlob returns if the content of the blob info matches its digest
+func verifyBlob(ctx context.Context, p content.Provider, info content.Info) (bool, error) {
+	if err := info.Digest.Validate(); err != nil {
+		return false, nil
+	}
+	ra, err := p.ReaderAt(ctx, ocispecs.Descriptor{Digest: info.Digest, Size: info.Size})
+	if err != nil {
+		return false, err
+	}
+	defer ra.Close()
+
+	verifier := info.Digest.Verifier()
+	n, err := io.Copy(verifier, content.NewReader(ra))
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to read blob %s", info.Digest)
+	}
+	return n == info.Size && verifier.Verified(), nil
+}
@@ -0,0 +1,330 @@
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	ctdcompression "github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/images/converter"
+	"github.com/containerd/containerd/labels"
+	"github.com/moby/buildkit/util/compression"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// zstdChunkedManifestChecksumAnnotation is the digest of the compressed
+	// TOC of a zstd:chunked layer
+	zstdChunkedManifestChecksumAnnotation = "io.github.containers.zstd-chunked.manifest-checksum"
+	// zstdChunkedManifestPositionAnnotation is the
+	// offset:compressed size:uncompressed size:type of the TOC
+	zstdChunkedManifestPositionAnnotation = "io.github.containers.zstd-chunked.manifest-position"
+
+	zstdChunkedManifestTypeCRFS = 1
+)
+
+// zstdChunkedAnnotations are stored as content labels of zstd:chunked blobs
+// and added to the layer descriptors on export, like eStargzAnnotations
+var zstdChunkedAnnotations = []string{zstdChunkedManifestChecksumAnnotation, zstdChunkedManifestPositionAnnotation}
+
+var (
+	zstdSkippableFrameMagic = []byte{0x50, 0x2a, 0x4d, 0x18}
+	zstdChunkedFooterMagic  = []byte("GNUlInUx")
+)
+
+func isZstdChunked(desc ocispecs.Descriptor) bool {
+	_, ok := desc.Annotations[zstdChunkedManifestChecksumAnnotation]
+	return ok
+}
+
+// zstdChunkedLayerConvertFunc converts a layer blob into zstd:chunked, a zstd
+// stream in which the contents of every file are a separate frame, followed by
+// a TOC of the files in skippable frames. Lazy-pulling snapshotters can fetch
+// single files with the TOC, other clients read it as a regular zstd layer, so
+// the diffID doesn't change. The frames are compressed with the level of comp.
+func zstdChunkedLayerConvertFunc(comp compression.Config) converter.ConvertFunc {
+	return func(ctx context.Context, cs content.Store, desc ocispecs.Descriptor) (*ocispecs.Descriptor, error) {
+		if !images.IsLayerType(desc.MediaType) || isZstdChunked(desc) {
+			// No conversion. No need to return an error here.
+			return nil, nil
+		}
+
+		// prepare the source and destination
+		info, err := cs.Info(ctx, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		labelz := info.Labels
+		if labelz == nil {
+			labelz = make(map[string]string)
+		}
+		ra, err := cs.ReaderAt(ctx, desc)
+		if err != nil {
+			return nil, err
+		}
+		defer ra.Close()
+		r, err := ctdcompression.DecompressStream(io.NewSectionReader(ra, 0, ra.Size()))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		ref := fmt.Sprintf("convert-zstdchunked-from-%s", desc.Digest)
+		w, err := cs.Writer(ctx, content.WithRef(ref))
+		if err != nil {
+			return nil, err
+		}
+		defer w.Close()
+		if err := w.Truncate(0); err != nil { // Old written data possibly remains
+			return nil, err
+		}
+
+		// convert this layer
+		diffID, annotations, err := writeZstdChunked(w, r, comp)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range layerAnnotations {
+			delete(labelz, k)
+		}
+		for k, v := range annotations {
+			labelz[k] = v
+		}
+		labelz[labels.LabelUncompressed] = diffID.String() // update diffID label
+		if err = w.Commit(ctx, 0, "", content.WithLabels(labelz)); err != nil && !errdefs.IsAlreadyExists(err) {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		info, err = cs.Info(ctx, w.Digest())
+		if err != nil {
+			return nil, err
+		}
+
+		newDesc := withLayerAnnotations(desc, labelz)
+		newDesc.MediaType = convertMediaTypeToZstd(desc.MediaType)
+		newDesc.Digest = info.Digest
+		newDesc.Size = info.Size
+		newDesc.Annotations[labels.LabelUncompressed] = diffID.String()
+		return &newDesc, nil
+	}
+}
+
+// zstdChunkedEntry is an entry of the TOC of a zstd:chunked layer
+type zstdChunkedEntry struct {
+	Type      string            `json:"type"`
+	Name      string            `json:"name"`
+	Linkname  string            `json:"linkName,omitempty"`
+	Mode      int64             `json:"mode,omitempty"`
+	Size      int64             `json:"size,omitempty"`
+	UID       int               `json:"uid,omitempty"`
+	GID       int               `json:"gid,omitempty"`
+	ModTime   *time.Time        `json:"modtime,omitempty"`
+	Devmajor  int64             `json:"devMajor,omitempty"`
+	Devminor  int64             `json:"devMinor,omitempty"`
+	Xattrs    map[string]string `json:"xattrs,omitempty"`
+	Digest    string            `json:"digest,omitempty"`
+	Offset    int64             `json:"offset,omitempty"`
+	EndOffset int64             `json:"endOffset,omitempty"`
+}
+
+type zstdChunkedTOC struct {
+	Version int                `json:"version"`
+	Entries []zstdChunkedEntry `json:"entries"`
+}
+
+// writeZstdChunked compresses the layer tar r to w in the zstd:chunked format
+// and returns the diffID of the tar and the annotations of the blob
+func writeZstdChunked(w io.Writer, r io.Reader, comp compression.Config) (digest.Digest, map[string]string, error) {
+	cw := &countingWriter{w: w}
+	zw := &zstdFrameWriter{w: cw, comp: comp}
+	diffID := digest.Canonical.Digester()
+	// the tar reader doesn't read ahead, so all bytes of the tar up to the
+	// current entry have been passed to zw
+	tr := tar.NewReader(io.TeeReader(r, io.MultiWriter(diffID.Hash(), zw)))
+
+	var toc zstdChunkedTOC
+	toc.Version = 1
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", nil, errors.Wrap(err, "failed to read layer tar")
+		}
+		e, err := newZstdChunkedEntry(hdr)
+		if err != nil {
+			return "", nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg && hdr.Size > 0 {
+			// the contents of the file start a new frame
+			if err := zw.endFrame(); err != nil {
+				return "", nil, err
+			}
+			e.Offset = cw.n
+			dgst := digest.Canonical.Digester()
+			if _, err := io.Copy(dgst.Hash(), tr); err != nil {
+				return "", nil, errors.Wrap(err, "failed to read layer tar")
+			}
+			if err := zw.endFrame(); err != nil {
+				return "", nil, err
+			}
+			e.EndOffset = cw.n
+			e.Digest = dgst.Digest().String()
+		}
+		toc.Entries = append(toc.Entries, e)
+	}
+	// the tar may be padded after the end of archive entry
+	if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+		return "", nil, errors.Wrap(err, "failed to read layer tar")
+	}
+	if err := zw.endFrame(); err != nil {
+		return "", nil, err
+	}
+
+	dt, err := json.Marshal(toc)
+	if err != nil {
+		return "", nil, err
+	}
+	buf := &bytes.Buffer{}
+	mw := &zstdFrameWriter{w: buf, comp: comp}
+	if _, err := mw.Write(dt); err != nil {
+		return "", nil, err
+	}
+	if err := mw.endFrame(); err != nil {
+		return "", nil, err
+	}
+	manifest := buf.Bytes()
+	manifestOffset := cw.n + 8 // after the header of the skippable frame
+	if err := writeZstdSkippableFrame(cw, manifest); err != nil {
+		return "", nil, err
+	}
+
+	footer := make([]byte, 0, 40)
+	for _, v := range []uint64{uint64(manifestOffset), uint64(len(manifest)), uint64(len(dt)), zstdChunkedManifestTypeCRFS} {
+		footer = appendUint64(footer, v)
+	}
+	footer = append(footer, zstdChunkedFooterMagic...)
+	if err := writeZstdSkippableFrame(cw, footer); err != nil {
+		return "", nil, err
+	}
+
+	return diffID.Digest(), map[string]string{
+		zstdChunkedManifestChecksumAnnotation: digest.FromBytes(manifest).String(),
+		zstdChunkedManifestPositionAnnotation: fmt.Sprintf("%d:%d:%d:%d", manifestOffset, len(manifest), len(dt), zstdChunkedManifestTypeCRFS),
+	}, nil
+}
+
+func newZstdChunkedEntry(hdr *tar.Header) (zstdChunkedEntry, error) {
+	e := zstdChunkedEntry{
+		Name:     hdr.Name,
+		Linkname: hdr.Linkname,
+		Mode:     hdr.Mode,
+		Size:     hdr.Size,
+		UID:      hdr.Uid,
+		GID:      hdr.Gid,
+		Devmajor: hdr.Devmajor,
+		Devminor: hdr.Devminor,
+	}
+	if !hdr.ModTime.IsZero() {
+		t := hdr.ModTime.UTC()
+		e.ModTime = &t
+	}
+	switch hdr.Typeflag {
+	case tar.TypeReg:
+		e.Type = "reg"
+	case tar.TypeLink:
+		e.Type = "hardlink"
+	case tar.TypeSymlink:
+		e.Type = "symlink"
+	case tar.TypeChar:
+		e.Type = "char"
+	case tar.TypeBlock:
+		e.Type = "block"
+	case tar.TypeDir:
+		e.Type = "dir"
+	case tar.TypeFifo:
+		e.Type = "fifo"
+	default:
+		return e, errors.Errorf("unsupported type %q of %s in layer tar", hdr.Typeflag, hdr.Name)
+	}
+	for k, v := range hdr.PAXRecords {
+		const prefix = "SCHILY.xattr."
+		if len(k) > len(prefix) && k[:len(prefix)] == prefix {
+			if e.Xattrs == nil {
+				e.Xattrs = map[string]string{}
+			}
+			e.Xattrs[k[len(prefix):]] = base64.StdEncoding.EncodeToString([]byte(v))
+		}
+	}
+	return e, nil
+}
+
+func writeZstdSkippableFrame(w io.Writer, dt []byte) error {
+	hdr := append([]byte{}, zstdSkippableFrameMagic...)
+	hdr = append(hdr, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(len(dt)))
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := w.Write(dt)
+	return err
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var dt [8]byte
+	binary.LittleEndian.PutUint64(dt[:], v)
+	return append(b, dt[:]...)
+}
+
+// zstdFrameWriter compresses the data written to it with zstd. endFrame ends
+// the current frame, so that the next write starts a new one.
+type zstdFrameWriter struct {
+	w    io.Writer
+	comp compression.Config
+	zw   io.WriteCloser
+}
+
+func (fw *zstdFrameWriter) Write(dt []byte) (int, error) {
+	if fw.zw == nil {
+		zw, err := fw.comp.NewWriter(fw.w)
+		if err != nil {
+			return 0, err
+		}
+		fw.zw = zw
+	}
+	return fw.zw.Write(dt)
+}
+
+func (fw *zstdFrameWriter) endFrame() error {
+	if fw.zw == nil {
+		return nil
+	}
+	err := fw.zw.Close()
+	fw.zw = nil
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(dt []byte) (int, error) {
+	n, err := cw.w.Write(dt)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/pkg/errors"
+)
+
+// CheckResult is the result of a single daemon environment check. Status is
+// one of "ok", "warning" or "error". Hint describes how to fix a failed
+// check.
+type CheckResult struct {
+	Name    string
+	Status  string
+	Message string
+	Hint    string
+}
+
+// Check validates the environment of the daemon, e.g. snapshotter, network
+// and emulator support
+func (c *Client) Check(ctx context.Context) ([]*CheckResult, error) {
+	resp, err := c.controlClient().Check(ctx, &controlapi.CheckRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to check daemon")
+	}
+
+	var out []*CheckResult
+	for _, r := range resp.Results {
+		out = append(out, &CheckResult{
+			Name:    r.Name,
+			Status:  r.Status,
+			Message: r.Message,
+			Hint:    r.Hint,
+		})
+	}
+	return out, nil
+}
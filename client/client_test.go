@@ -31,6 +31,7 @@ import (
 	"github.com/containerd/containerd/snapshots"
 	"github.com/containerd/continuity/fs/fstest"
 	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/client/ociindex"
 	"github.com/moby/buildkit/exporter/containerimage/exptypes"
 	gateway "github.com/moby/buildkit/frontend/gateway/client"
 	"github.com/moby/buildkit/identity"
@@ -87,6 +88,7 @@ func TestIntegration(t *testing.T) {
 		testResolveAndHosts,
 		testUser,
 		testOCIExporter,
+		testOCIExporterLayoutDir,
 		testWhiteoutParentDir,
 		testFrontendImageNaming,
 		testDuplicateWhiteouts,
@@ -96,6 +98,7 @@ func TestIntegration(t *testing.T) {
 		testReadonlyRootFS,
 		testBasicRegistryCacheImportExport,
 		testBasicLocalCacheImportExport,
+		testMultipleLocalCacheExports,
 		testCachedMounts,
 		testCopyFromEmptyImage,
 		testProxyEnv,
@@ -1738,6 +1741,80 @@ func testOCIExporter(t *testing.T, sb integration.Sandbox) {
 	checkAllReleasable(t, c, sb, true)
 }
 
+func testOCIExporterLayoutDir(t *testing.T, sb integration.Sandbox) {
+	skipDockerd(t, sb)
+	requiresLinux(t)
+	c, err := New(sb.Context(), sb.Address())
+	require.NoError(t, err)
+	defer c.Close()
+
+	busybox := llb.Image("busybox:latest")
+	st := llb.Scratch()
+
+	run := func(cmd string) {
+		st = busybox.Run(llb.Shlex(cmd), llb.Dir("/wd")).AddMount("/wd", st)
+	}
+
+	destDir := t.TempDir()
+	export := func(name string) ocispecs.Manifest {
+		def, err := st.Marshal(sb.Context())
+		require.NoError(t, err)
+		_, err = c.Solve(sb.Context(), def, SolveOpt{
+			Exports: []ExportEntry{
+				{
+					Type:      ExporterOCI,
+					Attrs:     map[string]string{"name": name, "tar": "false"},
+					OutputDir: destDir,
+				},
+			},
+		}, nil)
+		require.NoError(t, err)
+
+		_, err = os.Stat(filepath.Join(destDir, ocispecs.ImageLayoutFile))
+		require.NoError(t, err)
+		idx, err := ociindex.ReadIndexJSONFileLocked(filepath.Join(destDir, "index.json"))
+		require.NoError(t, err)
+		var desc *ocispecs.Descriptor
+		for _, m := range idx.Manifests {
+			if m.Annotations[images.AnnotationImageName] == name {
+				m := m
+				desc = &m
+			}
+		}
+		require.NotNil(t, desc)
+		dt, err := ioutil.ReadFile(filepath.Join(destDir, "blobs", "sha256", desc.Digest.Hex()))
+		require.NoError(t, err)
+		var mfst ocispecs.Manifest
+		require.NoError(t, json.Unmarshal(dt, &mfst))
+		for _, l := range append(mfst.Layers, mfst.Config) {
+			_, err := os.Stat(filepath.Join(destDir, "blobs", "sha256", l.Digest.Hex()))
+			require.NoError(t, err)
+		}
+		return mfst
+	}
+
+	run(`sh -c "echo -n first > foo"`)
+	mfst := export("example.com/buildkit/testoci:v1")
+	require.Equal(t, 1, len(mfst.Layers))
+	basePath := filepath.Join(destDir, "blobs", "sha256", mfst.Layers[0].Digest.Hex())
+	base, err := os.Stat(basePath)
+	require.NoError(t, err)
+
+	// the existing layer is not sent again
+	run(`sh -c "echo -n second > bar"`)
+	mfst = export("example.com/buildkit/testoci:v2")
+	require.Equal(t, 2, len(mfst.Layers))
+	fi, err := os.Stat(basePath)
+	require.NoError(t, err)
+	require.True(t, os.SameFile(base, fi))
+
+	idx, err := ociindex.ReadIndexJSONFileLocked(filepath.Join(destDir, "index.json"))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(idx.Manifests))
+
+	checkAllReleasable(t, c, sb, true)
+}
+
 func testFrontendMetadataReturn(t *testing.T, sb integration.Sandbox) {
 	skipDockerd(t, sb)
 	requiresLinux(t)
@@ -2747,6 +2824,45 @@ func testBasicLocalCacheImportExport(t *testing.T, sb integration.Sandbox) {
 	testBasicCacheImportExport(t, sb, []CacheOptionsEntry{im}, []CacheOptionsEntry{ex})
 }
 
+func testMultipleLocalCacheExports(t *testing.T, sb integration.Sandbox) {
+	skipDockerd(t, sb)
+	dirMin, err := ioutil.TempDir("", "buildkit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dirMin)
+	dirMax, err := ioutil.TempDir("", "buildkit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dirMax)
+	exMin := CacheOptionsEntry{
+		Type: "local",
+		Attrs: map[string]string{
+			"dest": dirMin,
+		},
+	}
+	exMax := CacheOptionsEntry{
+		Type: "local",
+		Attrs: map[string]string{
+			"dest": dirMax,
+			"mode": "max",
+		},
+	}
+	im := CacheOptionsEntry{
+		Type: "local",
+		Attrs: map[string]string{
+			"src": dirMax,
+		},
+	}
+	testBasicCacheImportExport(t, sb, []CacheOptionsEntry{im}, []CacheOptionsEntry{exMin, exMax})
+
+	// both stores have an index pointing to their own manifest
+	for _, dir := range []string{dirMin, dirMax} {
+		idx, err := ociindex.ReadIndexJSONFileLocked(filepath.Join(dir, "index.json"))
+		require.NoError(t, err)
+		require.Equal(t, 1, len(idx.Manifests))
+		_, err = os.Stat(filepath.Join(dir, "blobs", idx.Manifests[0].Digest.Algorithm().String(), idx.Manifests[0].Digest.Hex()))
+		require.NoError(t, err)
+	}
+}
+
 func testBasicInlineCacheImportExport(t *testing.T, sb integration.Sandbox) {
 	skipDockerd(t, sb)
 	requiresLinux(t)
@@ -81,4 +81,7 @@ const (
 	UsageRecordTypeGitCheckout UsageRecordType = "source.git.checkout"
 	UsageRecordTypeCacheMount  UsageRecordType = "exec.cachemount"
 	UsageRecordTypeRegular     UsageRecordType = "regular"
+	// UsageRecordTypeCompressionVariant is a blob of the layer of its parent
+	// record with another compression type, which is pruned separately
+	UsageRecordTypeCompressionVariant UsageRecordType = "compression.variant"
 )
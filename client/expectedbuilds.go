@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/pkg/errors"
+)
+
+// ExpectedBuild is a build that is expected to run, e.g. on a schedule. The
+// daemon prefetches its frontend image, Images and the manifests of its
+// registry CacheImports while it is idle.
+type ExpectedBuild struct {
+	// ID identifies the build, registering an ID again replaces the build
+	ID            string
+	Frontend      string
+	FrontendAttrs map[string]string
+	// Images are prefetched with their layers, e.g. the base images of the
+	// build
+	Images       []string
+	CacheImports []CacheOptionsEntry
+}
+
+// RegisterExpectedBuilds registers builds, replacing the ones with the same
+// ID, and unregisters the builds with the IDs in remove. All builds that are
+// registered in the daemon afterwards are returned, so calling it without
+// builds lists them.
+func (c *Client) RegisterExpectedBuilds(ctx context.Context, builds []ExpectedBuild, remove []string) ([]ExpectedBuild, error) {
+	req := &controlapi.RegisterExpectedBuildsRequest{
+		Remove: remove,
+	}
+	for _, b := range builds {
+		eb := &controlapi.ExpectedBuild{
+			ID:            b.ID,
+			Frontend:      b.Frontend,
+			FrontendAttrs: b.FrontendAttrs,
+			Images:        b.Images,
+		}
+		for _, im := range b.CacheImports {
+			eb.CacheImports = append(eb.CacheImports, &controlapi.CacheOptionsEntry{
+				Type:  im.Type,
+				Attrs: im.Attrs,
+			})
+		}
+		req.Builds = append(req.Builds, eb)
+	}
+
+	resp, err := c.controlClient().RegisterExpectedBuilds(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to register expected builds")
+	}
+
+	var out []ExpectedBuild
+	for _, eb := range resp.Builds {
+		b := ExpectedBuild{
+			ID:            eb.ID,
+			Frontend:      eb.Frontend,
+			FrontendAttrs: eb.FrontendAttrs,
+			Images:        eb.Images,
+		}
+		for _, im := range eb.CacheImports {
+			b.CacheImports = append(b.CacheImports, CacheOptionsEntry{
+				Type:  im.Type,
+				Attrs: im.Attrs,
+			})
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
@@ -1,9 +1,47 @@
 package client
 
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
 const (
 	ExporterImage  = "image"
 	ExporterLocal  = "local"
 	ExporterTar    = "tar"
 	ExporterOCI    = "oci"
 	ExporterDocker = "docker"
+	// ExporterMoby exports to the image store of dockerd, only available
+	// when buildkit is embedded in it
+	ExporterMoby = "moby"
 )
+
+// checkExporterOption returns an error unless the daemon lists value for the
+// option key of the exporter typ. Daemons ignore the options they don't
+// know, so options changing the format of the output are checked before the
+// build.
+func (c *Client) checkExporterOption(ctx context.Context, typ, key, value string) error {
+	workers, err := c.ListWorkers(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list exporters")
+	}
+	for _, w := range workers {
+		for _, e := range w.Exporters {
+			if e.Type != typ {
+				continue
+			}
+			for _, o := range e.Options {
+				if o.Key != key {
+					continue
+				}
+				for _, v := range o.Values {
+					if v == value {
+						return nil
+					}
+				}
+			}
+		}
+	}
+	return errors.Errorf("%s=%s is not supported by the %s exporter of the daemon", key, value, typ)
+}
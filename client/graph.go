@@ -25,8 +25,13 @@ type VertexStatus struct {
 	Timestamp time.Time
 	Started   *time.Time
 	Completed *time.Time
+	Host      string
+	Retries   int64
 }
 
+// VertexLog is output of a vertex. Logs of the build that don't belong to a
+// vertex, e.g. warnings about the attributes of the request, have an empty
+// Vertex.
 type VertexLog struct {
 	Vertex    digest.Digest
 	Stream    int
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/grpchijack"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// ImageDiffOpt configures ImageDiff
+type ImageDiffOpt struct {
+	// Session provides the registry credentials for images that aren't
+	// available to the worker
+	Session   []session.Attachable
+	SharedKey string
+	// Platform of the images to compare, defaults to the platform of the
+	// worker
+	Platform string
+	// Files compares the root filesystems of the images
+	Files bool
+}
+
+// ImageDiff is the difference between two images
+type ImageDiff struct {
+	ManifestA digest.Digest        `json:"manifestA"`
+	ManifestB digest.Digest        `json:"manifestB"`
+	Config    []*ImageConfigChange `json:"config,omitempty"`
+	Layers    []*ImageLayerChange  `json:"layers"`
+	Files     []*ImageFileChange   `json:"files,omitempty"`
+}
+
+// ImageConfigChange is a changed field of the image config
+type ImageConfigChange struct {
+	Field string `json:"field"`
+	A     string `json:"a,omitempty"`
+	B     string `json:"b,omitempty"`
+}
+
+// ImageLayerChange is a layer of the images. Change is unchanged for the
+// common base layers, removed for the following layers of image A and added
+// for those of image B.
+type ImageLayerChange struct {
+	Digest digest.Digest `json:"digest"`
+	Size   int64         `json:"size"`
+	Change string        `json:"change"`
+}
+
+// ImageFileChange is a file that was added, removed or changed in image B.
+// Layer is the top layer of image B containing the change.
+type ImageFileChange struct {
+	Path   string        `json:"path"`
+	Change string        `json:"change"`
+	SizeA  int64         `json:"sizeA"`
+	SizeB  int64         `json:"sizeB"`
+	Layer  digest.Digest `json:"layer,omitempty"`
+}
+
+// ImageDiff compares the configs, layers and optionally the files of two
+// images. The images are read from the image store of the worker or pulled
+// from their registry.
+func (c *Client) ImageDiff(ctx context.Context, refA, refB string, opt ImageDiffOpt) (*ImageDiff, error) {
+	s, err := session.NewSession(ctx, defaultSessionName(), opt.SharedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create session")
+	}
+	for _, a := range opt.Session {
+		s.Allow(a)
+	}
+
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		return s.Run(ctx, grpchijack.Dialer(c.controlClient()))
+	})
+
+	var diff *ImageDiff
+	eg.Go(func() error {
+		defer s.Close()
+		resp, err := c.controlClient().ImageDiff(ctx, &controlapi.ImageDiffRequest{
+			RefA:     refA,
+			RefB:     refB,
+			Platform: opt.Platform,
+			Files:    opt.Files,
+			Session:  s.ID(),
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to diff images")
+		}
+		diff = &ImageDiff{
+			ManifestA: resp.ManifestA,
+			ManifestB: resp.ManifestB,
+		}
+		for _, ch := range resp.Config {
+			diff.Config = append(diff.Config, &ImageConfigChange{Field: ch.Field, A: ch.A, B: ch.B})
+		}
+		for _, l := range resp.Layers {
+			diff.Layers = append(diff.Layers, &ImageLayerChange{Digest: l.Digest, Size: l.Size_, Change: l.Change})
+		}
+		for _, f := range resp.Files {
+			diff.Files = append(diff.Files, &ImageFileChange{
+				Path:   f.Path,
+				Change: f.Change,
+				SizeA:  f.SizeA,
+				SizeB:  f.SizeB,
+				Layer:  f.Layer,
+			})
+		}
+		return nil
+	})
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
@@ -57,6 +57,7 @@ type ExecOp struct {
 	isValidated bool
 	secrets     []SecretInfo
 	ssh         []SSHInfo
+	coreDump    int64
 }
 
 func (e *ExecOp) AddMount(target string, source Output, opt ...MountOption) Output {
@@ -192,6 +193,10 @@ func (e *ExecOp) Marshal(ctx context.Context, c *Constraints) (digest.Digest, []
 		User:     user,
 		Hostname: hostname,
 	}
+	if e.coreDump > 0 {
+		meta.CoreDumpSize = e.coreDump
+		addCap(&e.constraints, pb.CapExecMetaCoreDump)
+	}
 	extraHosts, err := getExtraHosts(e.base)(ctx, c)
 	if err != nil {
 		return "", nil, nil, nil, err
@@ -619,6 +624,18 @@ func ReadonlyRootFS() RunOption {
 	})
 }
 
+// WithCoreDump enables core dumps of processes crashing in the exec, limited
+// to maxSize bytes. Dumps are written according to the core_pattern of the
+// host. With an absolute pattern they are captured in a scratch mount that
+// is returned after the mounts of the exec in the error of the failed solve,
+// otherwise they are kept in the mounts of the failed exec. Dumps piped to a
+// handler on the host can't be captured.
+func WithCoreDump(maxSize int64) RunOption {
+	return runOptionFunc(func(ei *ExecInfo) {
+		ei.CoreDumpSize = maxSize
+	})
+}
+
 func WithProxy(ps ProxyEnv) RunOption {
 	return runOptionFunc(func(ei *ExecInfo) {
 		ei.ProxyEnv = &ps
@@ -633,6 +650,7 @@ type ExecInfo struct {
 	ProxyEnv       *ProxyEnv
 	Secrets        []SecretInfo
 	SSH            []SSHInfo
+	CoreDumpSize   int64
 }
 
 type MountInfo struct {
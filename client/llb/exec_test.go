@@ -50,3 +50,26 @@ func TestValidGetMountIndex(t *testing.T) {
 	require.NoError(t, err, "failed to getIndex")
 	require.Equal(t, pb.OutputIndex(1), mountIndex, "unexpected mount index")
 }
+
+func TestExecCoreDump(t *testing.T) {
+	t.Parallel()
+
+	st := Image("foo").Run(Shlex("args"), WithCoreDump(1<<20)).Root()
+	def, err := st.Marshal(context.TODO())
+	require.NoError(t, err)
+
+	m, arr := parseDef(t, def.Def)
+	dgst, _ := last(t, arr)
+	exec := m[dgst].Op.(*pb.Op_Exec).Exec
+	require.Equal(t, int64(1<<20), exec.Meta.CoreDumpSize)
+	require.True(t, def.Metadata[dgst].Caps[pb.CapExecMetaCoreDump])
+
+	st = Image("foo").Run(Shlex("args")).Root()
+	def, err = st.Marshal(context.TODO())
+	require.NoError(t, err)
+
+	m, arr = parseDef(t, def.Def)
+	dgst, _ = last(t, arr)
+	require.Equal(t, int64(0), m[dgst].Op.(*pb.Op_Exec).Exec.Meta.CoreDumpSize)
+	require.False(t, def.Metadata[dgst].Caps[pb.CapExecMetaCoreDump])
+}
@@ -0,0 +1,78 @@
+package llb
+
+import (
+	"context"
+	"strings"
+
+	"github.com/containerd/containerd/platforms"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// PlatformMatrix is the set of target platforms of a multi-platform build
+type PlatformMatrix []ocispecs.Platform
+
+// NewPlatformMatrix returns a matrix of the normalized platforms with
+// duplicates removed
+func NewPlatformMatrix(pp ...ocispecs.Platform) PlatformMatrix {
+	m := make(PlatformMatrix, 0, len(pp))
+	seen := map[string]struct{}{}
+	for _, p := range pp {
+		p = platforms.Normalize(p)
+		k := platforms.Format(p)
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		m = append(m, p)
+	}
+	return m
+}
+
+// ParsePlatformMatrix parses a comma separated list of platforms, e.g. the
+// value of the "platform" frontend option
+func ParsePlatformMatrix(v string) (PlatformMatrix, error) {
+	var pp []ocispecs.Platform
+	for _, v := range strings.Split(v, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		p, err := platforms.Parse(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse target platform %s", v)
+		}
+		pp = append(pp, p)
+	}
+	return NewPlatformMatrix(pp...), nil
+}
+
+// Key returns the identifier of the i-th platform of the matrix as used in
+// multi-platform results
+func (m PlatformMatrix) Key(i int) string {
+	return platforms.Format(m[i])
+}
+
+// Each calls f for every platform of the matrix in parallel. The returned
+// states are in the order of the matrix.
+func (m PlatformMatrix) Each(ctx context.Context, f func(ctx context.Context, p ocispecs.Platform) (State, error)) ([]State, error) {
+	out := make([]State, len(m))
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, p := range m {
+		func(i int, p ocispecs.Platform) {
+			eg.Go(func() error {
+				st, err := f(ctx, p)
+				if err != nil {
+					return errors.Wrapf(err, "failed to build for %s", platforms.Format(p))
+				}
+				out[i] = st
+				return nil
+			})
+		}(i, p)
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
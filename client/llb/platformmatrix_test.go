@@ -0,0 +1,36 @@
+package llb
+
+import (
+	"context"
+	"testing"
+
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlatformMatrix(t *testing.T) {
+	t.Parallel()
+
+	m, err := ParsePlatformMatrix("linux/amd64, linux/arm64,linux/amd64,linux/arm/v7")
+	require.NoError(t, err)
+	require.Equal(t, 3, len(m))
+	require.Equal(t, "linux/amd64", m.Key(0))
+	require.Equal(t, "linux/arm64", m.Key(1))
+	require.Equal(t, "linux/arm/v7", m.Key(2))
+
+	_, err = ParsePlatformMatrix("linux/amd64,foo/bar/baz/qux")
+	require.Error(t, err)
+
+	sts, err := m.Each(context.TODO(), func(ctx context.Context, p ocispecs.Platform) (State, error) {
+		return Image("busybox", Platform(p)), nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(sts))
+
+	for i, st := range sts {
+		def, err := st.Marshal(context.TODO())
+		require.NoError(t, err)
+		_, arr := parseDef(t, def.Def)
+		require.Equal(t, m[i].Architecture, arr[0].Platform.Architecture)
+	}
+}
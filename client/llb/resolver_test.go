@@ -67,11 +67,50 @@ func TestImageResolveDigest(t *testing.T) {
 	require.Equal(t, "/foo", d)
 }
 
+func TestImageFallbackRefs(t *testing.T) {
+	t.Parallel()
+
+	dgst := digest.FromBytes([]byte("baz"))
+	st := Image("alpine", WithMetaResolver(&testResolver{
+		digest: dgst,
+		dir:    "/baz",
+		fail:   []string{"docker.io/library/alpine:latest"},
+	}), ResolveDigest(true), WithFallbackRefs("mirror.example.com/alpine", "other.example.com/library/alpine"))
+
+	def, err := st.Marshal(context.TODO())
+	require.NoError(t, err)
+
+	_, arr := parseDef(t, def.Def)
+	require.Equal(t, 2, len(arr))
+
+	src := arr[0].Op.(*pb.Op_Source).Source
+	require.Equal(t, "docker-image://mirror.example.com/alpine:latest@"+string(dgst), src.GetIdentifier())
+	require.Equal(t, "docker.io/library/alpine:latest@"+string(dgst)+",other.example.com/library/alpine:latest@"+string(dgst), src.Attrs[pb.AttrImageFallbackRefs])
+
+	d, err := st.GetDir(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, "/baz", d)
+
+	st = Image("alpine", WithFallbackRefs("mirror.example.com/alpine"))
+	def, err = st.Marshal(context.TODO())
+	require.NoError(t, err)
+	m, arr := parseDef(t, def.Def)
+	dgst, _ = last(t, arr)
+	src = m[dgst].Op.(*pb.Op_Source).Source
+	require.Equal(t, "docker-image://docker.io/library/alpine:latest", src.GetIdentifier())
+	require.Equal(t, "mirror.example.com/alpine:latest", src.Attrs[pb.AttrImageFallbackRefs])
+	require.True(t, def.Metadata[dgst].Caps[pb.CapSourceImageFallbackRefs])
+
+	_, err = Image("alpine", WithFallbackRefs("Invalid Ref")).Marshal(context.TODO())
+	require.Error(t, err)
+}
+
 type testResolver struct {
 	digest   digest.Digest
 	dir      string
 	called   bool
 	platform string
+	fail     []string
 }
 
 func (r *testResolver) ResolveImageConfig(ctx context.Context, ref string, opt ResolveImageConfigOpt) (digest.Digest, []byte, error) {
@@ -84,6 +123,12 @@ func (r *testResolver) ResolveImageConfig(ctx context.Context, ref string, opt R
 	}
 	r.called = true
 
+	for _, f := range r.fail {
+		if f == ref {
+			return "", nil, errors.Errorf("failed to resolve %s", ref)
+		}
+	}
+
 	img.Config.WorkingDir = r.dir
 
 	if opt.Platform != nil {
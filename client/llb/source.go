@@ -116,9 +116,26 @@ func Image(ref string, opts ...ImageOption) State {
 		attrs[pb.AttrImageRecordType] = info.RecordType
 	}
 
+	var fallbackErr error
+	fallbackRefs := make([]string, 0, len(info.fallbackRefs))
+	for _, v := range info.fallbackRefs {
+		fr, err := reference.ParseNormalizedNamed(v)
+		if err != nil {
+			fallbackErr = errors.Wrapf(err, "invalid fallback ref %s", v)
+			continue
+		}
+		fallbackRefs = append(fallbackRefs, reference.TagNameOnly(fr).String())
+	}
+	if len(fallbackRefs) > 0 {
+		attrs[pb.AttrImageFallbackRefs] = strings.Join(fallbackRefs, ",")
+		addCap(&info.Constraints, pb.CapSourceImageFallbackRefs)
+	}
+
 	src := NewSource("docker-image://"+ref, attrs, info.Constraints) // controversial
 	if err != nil {
 		src.err = err
+	} else if fallbackErr != nil {
+		src.err = fallbackErr
 	} else if info.metaResolver != nil {
 		if _, ok := r.(reference.Digested); ok || !info.resolveDigest {
 			return NewState(src.Output()).Async(func(ctx context.Context, st State, c *Constraints) (State, error) {
@@ -126,7 +143,7 @@ func Image(ref string, opts ...ImageOption) State {
 				if p == nil {
 					p = c.Platform
 				}
-				_, dt, err := info.metaResolver.ResolveImageConfig(ctx, ref, ResolveImageConfigOpt{
+				_, _, dt, err := resolveImageConfigWithFallback(ctx, info.metaResolver, append([]string{ref}, fallbackRefs...), ResolveImageConfigOpt{
 					Platform:    p,
 					ResolveMode: info.resolveMode.String(),
 				})
@@ -141,25 +158,68 @@ func Image(ref string, opts ...ImageOption) State {
 			if p == nil {
 				p = c.Platform
 			}
-			dgst, dt, err := info.metaResolver.ResolveImageConfig(context.TODO(), ref, ResolveImageConfigOpt{
+			refs := append([]string{ref}, fallbackRefs...)
+			resolved, dgst, dt, err := resolveImageConfigWithFallback(context.TODO(), info.metaResolver, refs, ResolveImageConfigOpt{
 				Platform:    p,
 				ResolveMode: info.resolveMode.String(),
 			})
 			if err != nil {
 				return State{}, err
 			}
-			if dgst != "" {
-				r, err = reference.WithDigest(r, dgst)
+			if dgst == "" {
+				return NewState(NewSource("docker-image://"+r.String(), attrs, info.Constraints).Output()).WithImageConfig(dt)
+			}
+			// pin all refs to the resolved digest, starting with the one
+			// that could be resolved
+			var pinned []string
+			seen := map[string]struct{}{}
+			for _, v := range append([]string{resolved}, refs...) {
+				if _, ok := seen[v]; ok {
+					continue
+				}
+				seen[v] = struct{}{}
+				pr, err := reference.ParseNormalizedNamed(v)
 				if err != nil {
 					return State{}, err
 				}
+				pr, err = reference.WithDigest(pr, dgst)
+				if err != nil {
+					return State{}, err
+				}
+				pinned = append(pinned, pr.String())
+			}
+			pinnedAttrs := map[string]string{}
+			for k, v := range attrs {
+				pinnedAttrs[k] = v
 			}
-			return NewState(NewSource("docker-image://"+r.String(), attrs, info.Constraints).Output()).WithImageConfig(dt)
+			if len(pinned) > 1 {
+				pinnedAttrs[pb.AttrImageFallbackRefs] = strings.Join(pinned[1:], ",")
+			}
+			return NewState(NewSource("docker-image://"+pinned[0], pinnedAttrs, info.Constraints).Output()).WithImageConfig(dt)
 		})
 	}
 	return NewState(src.Output())
 }
 
+// resolveImageConfigWithFallback resolves the image config of the first ref
+// that can be resolved and returns that ref
+func resolveImageConfigWithFallback(ctx context.Context, mr ImageMetaResolver, refs []string, opt ResolveImageConfigOpt) (string, digest.Digest, []byte, error) {
+	var firstErr error
+	for _, ref := range refs {
+		dgst, dt, err := mr.ResolveImageConfig(ctx, ref, opt)
+		if err == nil {
+			return ref, dgst, dt, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if errors.Is(err, context.Canceled) {
+			break
+		}
+	}
+	return "", "", nil, firstErr
+}
+
 type ImageOption interface {
 	SetImageOption(*ImageInfo)
 }
@@ -170,6 +230,14 @@ func (fn imageOptionFunc) SetImageOption(ii *ImageInfo) {
 	fn(ii)
 }
 
+// WithFallbackRefs sets equivalent references, e.g. mirror repositories, that
+// are tried in order if the image can't be resolved or pulled
+func WithFallbackRefs(refs ...string) ImageOption {
+	return imageOptionFunc(func(ii *ImageInfo) {
+		ii.fallbackRefs = append(ii.fallbackRefs, refs...)
+	})
+}
+
 var MarkImageInternal = imageOptionFunc(func(ii *ImageInfo) {
 	ii.RecordType = "internal"
 })
@@ -205,6 +273,7 @@ type ImageInfo struct {
 	resolveDigest bool
 	resolveMode   ResolveMode
 	RecordType    string
+	fallbackRefs  []string
 }
 
 func Git(remote, ref string, opts ...GitOption) State {
@@ -369,6 +438,9 @@ func Local(name string, opts ...LocalOption) State {
 		attrs[pb.AttrSharedKeyHint] = gi.SharedKeyHint
 		addCap(&gi.Constraints, pb.CapSourceLocalSharedKeyHint)
 	}
+	if gi.VerboseProgress {
+		attrs[pb.AttrLocalVerboseProgress] = "true"
+	}
 	if gi.Differ.Type != "" {
 		attrs[pb.AttrLocalDiffer] = string(gi.Differ.Type)
 		if gi.Differ.Required {
@@ -446,6 +518,14 @@ func Differ(t DiffType, required bool) LocalOption {
 	})
 }
 
+// VerboseProgress logs the path and size of every transferred file of the
+// local source to the progress of its vertex
+func VerboseProgress() LocalOption {
+	return localOptionFunc(func(li *LocalInfo) {
+		li.VerboseProgress = true
+	})
+}
+
 type DiffType string
 
 const (
@@ -471,6 +551,7 @@ type LocalInfo struct {
 	FollowPaths     string
 	SharedKeyHint   string
 	Differ          DifferInfo
+	VerboseProgress bool
 }
 
 func HTTP(url string, opts ...HTTPOption) State {
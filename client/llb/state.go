@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/containerd/containerd/platforms"
 	"github.com/moby/buildkit/identity"
@@ -161,6 +162,9 @@ func (s State) Marshal(ctx context.Context, co ...ConstraintsOpt) (*Definition,
 		if m.ExportCache != nil {
 			md.Caps[pb.CapMetaExportCache] = true
 		}
+		if m.CacheTtl != 0 {
+			md.Caps[pb.CapMetaCacheTTL] = true
+		}
 	}
 
 	def.Metadata[dgst] = md
@@ -259,6 +263,7 @@ func (s State) Run(ro ...RunOption) ExecState {
 	}
 	exec.secrets = ei.Secrets
 	exec.ssh = ei.SSH
+	exec.coreDump = ei.CoreDumpSize
 
 	return ExecState{
 		State: s.WithOutput(exec.Output()),
@@ -483,6 +488,9 @@ func mergeMetadata(m1, m2 pb.OpMetadata) pb.OpMetadata {
 	if m2.ExportCache != nil {
 		m1.ExportCache = m2.ExportCache
 	}
+	if m2.CacheTtl != 0 {
+		m1.CacheTtl = m2.CacheTtl
+	}
 
 	for k := range m2.Caps {
 		if m1.Caps == nil {
@@ -498,6 +506,20 @@ var IgnoreCache = constraintsOptFunc(func(c *Constraints) {
 	c.Metadata.IgnoreCache = true
 })
 
+// CacheTTL makes the cache of the vertex expire after d. The cache keys of
+// the vertex change with every time window of duration d, so the vertex runs
+// again in the first build of a new window. d is rounded up to whole seconds
+// and a d that isn't positive doesn't expire the cache.
+func CacheTTL(d time.Duration) ConstraintsOpt {
+	return constraintsOptFunc(func(c *Constraints) {
+		if d <= 0 {
+			c.Metadata.CacheTtl = 0
+			return
+		}
+		c.Metadata.CacheTtl = int64((d + time.Second - 1) / time.Second)
+	})
+}
+
 func WithDescription(m map[string]string) ConstraintsOpt {
 	return constraintsOptFunc(func(c *Constraints) {
 		if c.Metadata.Description == nil {
@@ -3,6 +3,7 @@ package llb
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/moby/buildkit/solver/pb"
 	digest "github.com/opencontainers/go-digest"
@@ -167,3 +168,43 @@ func getEnvHelper(t *testing.T, s State, k string) (string, bool) {
 	require.NoError(t, err)
 	return v, ok
 }
+
+func TestCacheTTL(t *testing.T) {
+	t.Parallel()
+
+	st := Image("foo").Run(Shlex("apt-get update"), CacheTTL(24*time.Hour)).Root()
+	def, err := st.Marshal(context.TODO())
+	require.NoError(t, err)
+
+	var ttls []int64
+	var hasCap bool
+	for _, md := range def.Metadata {
+		if md.CacheTtl != 0 {
+			ttls = append(ttls, md.CacheTtl)
+		}
+		if md.Caps[pb.CapMetaCacheTTL] {
+			hasCap = true
+		}
+	}
+	require.Equal(t, []int64{86400}, ttls)
+	require.True(t, hasCap)
+}
+
+func TestCacheTTLRounding(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		d   time.Duration
+		ttl int64
+	}{
+		{500 * time.Millisecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{0, 0},
+		{-time.Minute, 0},
+	} {
+		var c Constraints
+		CacheTTL(tc.d).SetConstraintsOption(&c)
+		require.Equal(t, tc.ttl, c.Metadata.CacheTtl, "%s", tc.d)
+	}
+}
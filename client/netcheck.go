@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/pkg/errors"
+)
+
+// NetcheckResult is the connectivity of the daemon to an endpoint over a
+// single address family. Family is "ipv4", "ipv6" or "dual" for the happy
+// eyeballs connection over both families that the daemon uses for pulls and
+// sources. Error is empty if the endpoint is reachable.
+type NetcheckResult struct {
+	Endpoint  string
+	Family    string
+	Addresses []string
+	Latency   time.Duration
+	Error     string
+}
+
+// Netcheck checks the connectivity of the daemon host to endpoints in the
+// form host[:port]. The daemon only checks the default registry and source
+// endpoints and the registries and mirrors of its config, and checks all of
+// them if no endpoints are passed. A zero timeout uses the default of the
+// daemon.
+func (c *Client) Netcheck(ctx context.Context, endpoints []string, timeout time.Duration) ([]*NetcheckResult, error) {
+	resp, err := c.controlClient().Netcheck(ctx, &controlapi.NetcheckRequest{
+		Endpoints: endpoints,
+		Timeout:   int64(timeout),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to check network")
+	}
+
+	var out []*NetcheckResult
+	for _, r := range resp.Results {
+		out = append(out, &NetcheckResult{
+			Endpoint:  r.Endpoint,
+			Family:    r.Family,
+			Addresses: r.Addresses,
+			Latency:   time.Duration(r.Latency),
+			Error:     r.Error,
+		})
+	}
+	return out, nil
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 
+	"github.com/containerd/containerd/images"
 	"github.com/gofrs/flock"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
@@ -43,6 +44,50 @@ func PutDescToIndex(index *ocispecs.Index, desc ocispecs.Descriptor, tag string)
 }
 
 func PutDescToIndexJSONFileLocked(indexJSONPath string, desc ocispecs.Descriptor, tag string) error {
+	return updateIndexJSONFileLocked(indexJSONPath, func(idx *ocispecs.Index) error {
+		return PutDescToIndex(idx, desc, tag)
+	})
+}
+
+// PutManifestsToIndex adds manifests to index. Existing manifests with the
+// same io.containerd.image.name annotation, or the same tag if they have no
+// image name, are replaced. Manifests without a name replace existing
+// manifests with the same digest.
+func PutManifestsToIndex(index *ocispecs.Index, manifests []ocispecs.Descriptor) {
+	if index.SchemaVersion == 0 {
+		index.SchemaVersion = 2
+	}
+	for _, desc := range manifests {
+		kept := index.Manifests[:0]
+		for _, m := range index.Manifests {
+			if manifestKey(m) != manifestKey(desc) {
+				kept = append(kept, m)
+			}
+		}
+		index.Manifests = append(kept, desc)
+	}
+}
+
+func manifestKey(desc ocispecs.Descriptor) string {
+	if name := desc.Annotations[images.AnnotationImageName]; name != "" {
+		return "name:" + name
+	}
+	if tag := desc.Annotations[ocispecs.AnnotationRefName]; tag != "" {
+		return "tag:" + tag
+	}
+	return "digest:" + desc.Digest.String()
+}
+
+// PutManifestsToIndexJSONFileLocked adds manifests to the index of
+// indexJSONPath as PutManifestsToIndex does
+func PutManifestsToIndexJSONFileLocked(indexJSONPath string, manifests []ocispecs.Descriptor) error {
+	return updateIndexJSONFileLocked(indexJSONPath, func(idx *ocispecs.Index) error {
+		PutManifestsToIndex(idx, manifests)
+		return nil
+	})
+}
+
+func updateIndexJSONFileLocked(indexJSONPath string, update func(*ocispecs.Index) error) error {
 	lockPath := indexJSONPath + IndexJSONLockFileSuffix
 	lock := flock.New(lockPath)
 	locked, err := lock.TryLock()
@@ -71,7 +116,7 @@ func PutDescToIndexJSONFileLocked(indexJSONPath string, desc ocispecs.Descriptor
 			return errors.Wrapf(err, "could not unmarshal %s (%q)", indexJSONPath, string(b))
 		}
 	}
-	if err = PutDescToIndex(&idx, desc, tag); err != nil {
+	if err = update(&idx); err != nil {
 		return err
 	}
 	b, err = json.Marshal(idx)
@@ -0,0 +1,45 @@
+package ociindex
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/images"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutManifestsToIndex(t *testing.T) {
+	named := func(dgst, name, tag string) ocispecs.Descriptor {
+		desc := ocispecs.Descriptor{MediaType: ocispecs.MediaTypeImageManifest, Digest: digest.FromString(dgst)}
+		if name != "" {
+			desc.Annotations = map[string]string{images.AnnotationImageName: name}
+		}
+		if tag != "" {
+			if desc.Annotations == nil {
+				desc.Annotations = map[string]string{}
+			}
+			desc.Annotations[ocispecs.AnnotationRefName] = tag
+		}
+		return desc
+	}
+	foo := named("1", "docker.io/library/foo:latest", "latest")
+	bar := named("1", "docker.io/library/bar:latest", "latest")
+	v1 := named("1", "", "v1")
+	att := named("att", "", "")
+
+	idxPath := filepath.Join(t.TempDir(), "index.json")
+	require.NoError(t, PutManifestsToIndexJSONFileLocked(idxPath, []ocispecs.Descriptor{foo, bar, v1, att}))
+	idx, err := ReadIndexJSONFileLocked(idxPath)
+	require.NoError(t, err)
+	require.Equal(t, 2, idx.SchemaVersion)
+	require.Equal(t, []ocispecs.Descriptor{foo, bar, v1, att}, idx.Manifests)
+
+	foo2 := named("2", "docker.io/library/foo:latest", "latest")
+	v12 := named("2", "", "v1")
+	require.NoError(t, PutManifestsToIndexJSONFileLocked(idxPath, []ocispecs.Descriptor{foo2, v12, att}))
+	idx, err = ReadIndexJSONFileLocked(idxPath)
+	require.NoError(t, err)
+	require.Equal(t, []ocispecs.Descriptor{bar, foo2, v12, att}, idx.Manifests)
+}
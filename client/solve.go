@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,6 +16,7 @@ import (
 	controlapi "github.com/moby/buildkit/api/services/control"
 	"github.com/moby/buildkit/client/llb"
 	"github.com/moby/buildkit/client/ociindex"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
 	"github.com/moby/buildkit/identity"
 	"github.com/moby/buildkit/session"
 	sessioncontent "github.com/moby/buildkit/session/content"
@@ -42,13 +45,14 @@ type SolveOpt struct {
 	AllowedEntitlements   []entitlements.Entitlement
 	SharedSession         *session.Session // TODO: refactor to better session syncing
 	SessionPreInitialized bool             // TODO: refactor to better session syncing
+	Ref                   string           // optional build ref that other clients can use to follow progress
 }
 
 type ExportEntry struct {
 	Type      string
 	Attrs     map[string]string
 	Output    func(map[string]string) (io.WriteCloser, error) // for ExporterOCI and ExporterDocker
-	OutputDir string                                          // for ExporterLocal
+	OutputDir string                                          // for ExporterLocal, and ExporterOCI and ExporterDocker with tar=false
 }
 
 type CacheOptionsEntry struct {
@@ -87,7 +91,10 @@ func (c *Client) solve(ctx context.Context, def *llb.Definition, runGateway runG
 		return nil, err
 	}
 
-	ref := identity.NewID()
+	ref := opt.Ref
+	if ref == "" {
+		ref = identity.NewID()
+	}
 	eg, ctx := errgroup.WithContext(ctx)
 
 	statusContext, cancelStatus := context.WithCancel(context.Background())
@@ -139,10 +146,31 @@ func (c *Client) solve(ctx context.Context, def *llb.Definition, runGateway runG
 			if ex.OutputDir == "" {
 				return nil, errors.New("output directory is required for local exporter")
 			}
+			// the daemon doesn't advertise its llb caps outside of a
+			// gateway, the options of its exporters are checked instead
+			if ex.Attrs["mode"] == "tar" {
+				if err := c.checkExporterOption(ctx, ExporterLocal, "mode", "tar"); err != nil {
+					return nil, err
+				}
+			}
 			s.Allow(filesync.NewFSSyncTargetDir(ex.OutputDir))
 		case ExporterOCI, ExporterDocker, ExporterTar:
-			if ex.OutputDir != "" {
-				return nil, errors.Errorf("output directory %s is not supported by %s exporter", ex.OutputDir, ex.Type)
+			if ex.OutputDir != "" && !IsLayoutDirExport(ex.Type, ex.Attrs) {
+				return nil, errors.Errorf("output directory %s is not supported by %s exporter without tar=false", ex.OutputDir, ex.Type)
+			}
+			if IsLayoutDirExport(ex.Type, ex.Attrs) {
+				if ex.Output != nil {
+					return nil, errors.Errorf("output file writer is not supported by %s exporter with tar=false", ex.Type)
+				}
+				if ex.OutputDir == "" {
+					return nil, errors.Errorf("output directory is required for %s exporter with tar=false", ex.Type)
+				}
+				cs, err := prepareLayoutDir(ex.OutputDir)
+				if err != nil {
+					return nil, err
+				}
+				cacheOpt.contentStores[sessioncontent.ExportStoreID] = cs
+				break
 			}
 			if ex.Output == nil {
 				return nil, errors.Errorf("output file writer is required for %s exporter", ex.Type)
@@ -242,56 +270,7 @@ func (c *Client) solve(ctx context.Context, def *llb.Definition, runGateway runG
 	}
 
 	eg.Go(func() error {
-		stream, err := c.controlClient().Status(statusContext, &controlapi.StatusRequest{
-			Ref: ref,
-		})
-		if err != nil {
-			return errors.Wrap(err, "failed to get status")
-		}
-		for {
-			resp, err := stream.Recv()
-			if err != nil {
-				if err == io.EOF {
-					return nil
-				}
-				return errors.Wrap(err, "failed to receive status")
-			}
-			s := SolveStatus{}
-			for _, v := range resp.Vertexes {
-				s.Vertexes = append(s.Vertexes, &Vertex{
-					Digest:    v.Digest,
-					Inputs:    v.Inputs,
-					Name:      v.Name,
-					Started:   v.Started,
-					Completed: v.Completed,
-					Error:     v.Error,
-					Cached:    v.Cached,
-				})
-			}
-			for _, v := range resp.Statuses {
-				s.Statuses = append(s.Statuses, &VertexStatus{
-					ID:        v.ID,
-					Vertex:    v.Vertex,
-					Name:      v.Name,
-					Total:     v.Total,
-					Current:   v.Current,
-					Timestamp: v.Timestamp,
-					Started:   v.Started,
-					Completed: v.Completed,
-				})
-			}
-			for _, v := range resp.Logs {
-				s.Logs = append(s.Logs, &VertexLog{
-					Vertex:    v.Vertex,
-					Stream:    int(v.Stream),
-					Data:      v.Msg,
-					Timestamp: v.Timestamp,
-				})
-			}
-			if statusChan != nil {
-				statusChan <- &s
-			}
-		}
+		return c.status(statusContext, ref, statusChan)
 	})
 
 	if err := eg.Wait(); err != nil {
@@ -299,20 +278,69 @@ func (c *Client) solve(ctx context.Context, def *llb.Definition, runGateway runG
 	}
 	// Update index.json of exported cache content store
 	// FIXME(AkihiroSuda): dedupe const definition of cache/remotecache.ExporterResponseManifestDesc = "cache.manifest"
-	if manifestDescJSON := res.ExporterResponse["cache.manifest"]; manifestDescJSON != "" {
+	for indexJSONPath, idx := range cacheOpt.indicesToUpdate {
+		// daemons exporting to multiple caches return the manifest of
+		// every local store separately
+		manifestDescJSON, ok := res.ExporterResponse["cache.manifest/"+idx.storeID]
+		if !ok {
+			manifestDescJSON = res.ExporterResponse["cache.manifest"]
+		}
+		if manifestDescJSON == "" {
+			continue
+		}
 		var manifestDesc ocispecs.Descriptor
 		if err = json.Unmarshal([]byte(manifestDescJSON), &manifestDesc); err != nil {
 			return nil, err
 		}
-		for indexJSONPath, tag := range cacheOpt.indicesToUpdate {
-			if err = ociindex.PutDescToIndexJSONFileLocked(indexJSONPath, manifestDesc, tag); err != nil {
-				return nil, err
-			}
+		if err = ociindex.PutDescToIndexJSONFileLocked(indexJSONPath, manifestDesc, idx.tag); err != nil {
+			return nil, err
+		}
+	}
+	// Update index.json of the exported OCI layout directory
+	if dt, ok := res.ExporterResponse[exptypes.ExporterOCILayoutManifestsKey]; ok && ex.OutputDir != "" {
+		var manifests []ocispecs.Descriptor
+		if err := json.Unmarshal([]byte(dt), &manifests); err != nil {
+			return nil, errors.Wrap(err, "failed to parse manifests of exported layout")
+		}
+		if err := ociindex.PutManifestsToIndexJSONFileLocked(filepath.Join(ex.OutputDir, "index.json"), manifests); err != nil {
+			return nil, err
 		}
 	}
 	return res, nil
 }
 
+// IsLayoutDirExport returns true if the exporter of typ writes an OCI layout
+// to a directory instead of a tarball
+func IsLayoutDirExport(typ string, attrs map[string]string) bool {
+	if typ != ExporterOCI && typ != ExporterDocker {
+		return false
+	}
+	v, ok := attrs["tar"]
+	if !ok {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	return err == nil && !b
+}
+
+// prepareLayoutDir returns the content store of the OCI layout directory dir
+func prepareLayoutDir(dir string) (content.Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	layoutPath := filepath.Join(dir, ocispecs.ImageLayoutFile)
+	if _, err := os.Stat(layoutPath); errors.Is(err, os.ErrNotExist) {
+		dt, err := json.Marshal(ocispecs.ImageLayout{Version: ocispecs.ImageLayoutVersion})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := ioutil.WriteFile(layoutPath, dt, 0644); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return contentlocal.NewStore(dir)
+}
+
 func prepareSyncedDirs(def *llb.Definition, localDirs map[string]string) ([]filesync.SyncedDir, error) {
 	for _, d := range localDirs {
 		fi, err := os.Stat(d)
@@ -366,10 +394,15 @@ func defaultSessionName() string {
 type cacheOptions struct {
 	options         controlapi.CacheOptions
 	contentStores   map[string]content.Store // key: ID of content store ("local:" + csDir)
-	indicesToUpdate map[string]string        // key: index.JSON file name, value: tag
+	indicesToUpdate map[string]cacheIndex    // key: index.JSON file name
 	frontendAttrs   map[string]string
 }
 
+type cacheIndex struct {
+	storeID string // ID of the content store of the index
+	tag     string
+}
+
 func parseCacheOptions(ctx context.Context, opt SolveOpt) (*cacheOptions, error) {
 	var (
 		cacheExports []*controlapi.CacheOptionsEntry
@@ -379,7 +412,7 @@ func parseCacheOptions(ctx context.Context, opt SolveOpt) (*cacheOptions, error)
 		legacyImportRefs []string
 	)
 	contentStores := make(map[string]content.Store)
-	indicesToUpdate := make(map[string]string) // key: index.JSON file name, value: tag
+	indicesToUpdate := make(map[string]cacheIndex) // key: index.JSON file name
 	frontendAttrs := make(map[string]string)
 	legacyExportAttrs := make(map[string]string)
 	for _, ex := range opt.CacheExports {
@@ -398,7 +431,7 @@ func parseCacheOptions(ctx context.Context, opt SolveOpt) (*cacheOptions, error)
 			contentStores["local:"+csDir] = cs
 			// TODO(AkihiroSuda): support custom index JSON path and tag
 			indexJSONPath := filepath.Join(csDir, "index.json")
-			indicesToUpdate[indexJSONPath] = "latest"
+			indicesToUpdate[indexJSONPath] = cacheIndex{storeID: "local:" + csDir, tag: "latest"}
 		}
 		if ex.Type == "registry" && legacyExportRef == "" {
 			legacyExportRef = ex.Attrs["ref"]
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"io"
+	"time"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/pkg/errors"
+)
+
+// BuildInfo contains information about a build running in the daemon
+type BuildInfo struct {
+	Ref       string
+	CreatedAt time.Time
+}
+
+// ListBuilds lists the builds currently known to the daemon. The returned
+// refs can be passed to Status to follow the progress of a build started by
+// another client.
+func (c *Client) ListBuilds(ctx context.Context) ([]*BuildInfo, error) {
+	resp, err := c.controlClient().ListBuilds(ctx, &controlapi.ListBuildsRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list builds")
+	}
+
+	var bi []*BuildInfo
+	for _, r := range resp.Records {
+		bi = append(bi, &BuildInfo{
+			Ref:       r.Ref,
+			CreatedAt: r.CreatedAt,
+		})
+	}
+	return bi, nil
+}
+
+// Status subscribes to the progress of the build with the given ref. The
+// build may have been started by a different client or process. Progress
+// that was already reported before subscribing is replayed. statusChan is
+// closed when the build completes.
+func (c *Client) Status(ctx context.Context, ref string, statusChan chan *SolveStatus) error {
+	defer func() {
+		if statusChan != nil {
+			close(statusChan)
+		}
+	}()
+	return c.status(ctx, ref, statusChan)
+}
+
+func (c *Client) status(ctx context.Context, ref string, statusChan chan *SolveStatus) error {
+	stream, err := c.controlClient().Status(ctx, &controlapi.StatusRequest{
+		Ref: ref,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to get status")
+	}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.Wrap(err, "failed to receive status")
+		}
+		s := SolveStatus{}
+		for _, v := range resp.Vertexes {
+			s.Vertexes = append(s.Vertexes, &Vertex{
+				Digest:    v.Digest,
+				Inputs:    v.Inputs,
+				Name:      v.Name,
+				Started:   v.Started,
+				Completed: v.Completed,
+				Error:     v.Error,
+				Cached:    v.Cached,
+			})
+		}
+		for _, v := range resp.Statuses {
+			s.Statuses = append(s.Statuses, &VertexStatus{
+				ID:        v.ID,
+				Vertex:    v.Vertex,
+				Name:      v.Name,
+				Total:     v.Total,
+				Current:   v.Current,
+				Timestamp: v.Timestamp,
+				Started:   v.Started,
+				Completed: v.Completed,
+				Host:      v.Host,
+				Retries:   v.Retries,
+			})
+		}
+		for _, v := range resp.Logs {
+			s.Logs = append(s.Logs, &VertexLog{
+				Vertex:    v.Vertex,
+				Stream:    int(v.Stream),
+				Data:      v.Msg,
+				Timestamp: v.Timestamp,
+			})
+		}
+		if statusChan != nil {
+			statusChan <- &s
+		}
+	}
+}
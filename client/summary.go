@@ -0,0 +1,145 @@
+package client
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// BuildSummary is a machine-readable report of a completed build
+type BuildSummary struct {
+	Started          *time.Time        `json:"started,omitempty"`
+	Completed        *time.Time        `json:"completed,omitempty"`
+	Duration         float64           `json:"duration"`
+	Steps            []BuildStep       `json:"steps"`
+	StepsTotal       int               `json:"stepsTotal"`
+	StepsCached      int               `json:"stepsCached"`
+	StepsFailed      int               `json:"stepsFailed"`
+	ImageDigest      string            `json:"imageDigest,omitempty"`
+	ConfigDigest     string            `json:"configDigest,omitempty"`
+	ExporterResponse map[string]string `json:"exporterResponse,omitempty"`
+	Error            string            `json:"error,omitempty"`
+}
+
+// BuildStep describes a single vertex of a build in BuildSummary
+type BuildStep struct {
+	Digest      digest.Digest   `json:"digest"`
+	Inputs      []digest.Digest `json:"inputs,omitempty"`
+	Name        string          `json:"name"`
+	Started     *time.Time      `json:"started,omitempty"`
+	Completed   *time.Time      `json:"completed,omitempty"`
+	Duration    float64         `json:"duration"`
+	Cached      bool            `json:"cached"`
+	Error       string          `json:"error,omitempty"`
+	Transferred int64           `json:"transferred,omitempty"`
+	LogBytes    int64           `json:"logBytes,omitempty"`
+}
+
+// SummaryCollector records the status updates of a solve and produces a
+// BuildSummary when the build has completed.
+type SummaryCollector struct {
+	mu       sync.Mutex
+	vertexes map[digest.Digest]*BuildStep
+	statuses map[string]*VertexStatus
+	order    []digest.Digest
+}
+
+// NewSummaryCollector returns a new SummaryCollector
+func NewSummaryCollector() *SummaryCollector {
+	return &SummaryCollector{
+		vertexes: map[digest.Digest]*BuildStep{},
+		statuses: map[string]*VertexStatus{},
+	}
+}
+
+// Add records a status update
+func (sc *SummaryCollector) Add(s *SolveStatus) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for _, v := range s.Vertexes {
+		st, ok := sc.vertexes[v.Digest]
+		if !ok {
+			st = &BuildStep{Digest: v.Digest}
+			sc.vertexes[v.Digest] = st
+			sc.order = append(sc.order, v.Digest)
+		}
+		st.Inputs = v.Inputs
+		st.Name = v.Name
+		if v.Started != nil {
+			st.Started = v.Started
+		}
+		st.Completed = v.Completed
+		st.Cached = v.Cached
+		st.Error = v.Error
+	}
+	for _, s := range s.Statuses {
+		sc.statuses[string(s.Vertex)+"/"+s.ID] = s
+	}
+	for _, l := range s.Logs {
+		if st, ok := sc.vertexes[l.Vertex]; ok {
+			st.LogBytes += int64(len(l.Data))
+		}
+	}
+}
+
+// Summary returns the report for the recorded updates. resp may be nil if
+// the build failed, in which case err describes the failure.
+func (sc *SummaryCollector) Summary(resp *SolveResponse, err error) *BuildSummary {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for _, s := range sc.statuses {
+		if st, ok := sc.vertexes[s.Vertex]; ok {
+			st.Transferred += s.Current
+		}
+	}
+	// make sure repeated calls don't count transfers twice
+	sc.statuses = map[string]*VertexStatus{}
+
+	bs := &BuildSummary{
+		Steps: make([]BuildStep, 0, len(sc.order)),
+	}
+	for _, dgst := range sc.order {
+		st := sc.vertexes[dgst]
+		if st.Started != nil && st.Completed != nil {
+			st.Duration = st.Completed.Sub(*st.Started).Seconds()
+		}
+		if st.Started != nil && (bs.Started == nil || st.Started.Before(*bs.Started)) {
+			bs.Started = st.Started
+		}
+		if st.Completed != nil && (bs.Completed == nil || st.Completed.After(*bs.Completed)) {
+			bs.Completed = st.Completed
+		}
+		if st.Cached {
+			bs.StepsCached++
+		}
+		if st.Error != "" {
+			bs.StepsFailed++
+		}
+		bs.Steps = append(bs.Steps, *st)
+	}
+	sort.SliceStable(bs.Steps, func(i, j int) bool {
+		if bs.Steps[i].Started == nil || bs.Steps[j].Started == nil {
+			return bs.Steps[j].Started == nil && bs.Steps[i].Started != nil
+		}
+		return bs.Steps[i].Started.Before(*bs.Steps[j].Started)
+	})
+	bs.StepsTotal = len(bs.Steps)
+	if bs.Started != nil && bs.Completed != nil {
+		bs.Duration = bs.Completed.Sub(*bs.Started).Seconds()
+	}
+
+	if resp != nil {
+		bs.ExporterResponse = resp.ExporterResponse
+		bs.ImageDigest = resp.ExporterResponse[exptypes.ExporterImageDigestKey]
+		bs.ConfigDigest = resp.ExporterResponse[exptypes.ExporterImageConfigDigestKey]
+	}
+	if err != nil {
+		bs.Error = err.Error()
+	}
+	return bs
+}
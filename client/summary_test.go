@@ -0,0 +1,42 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummaryCollector(t *testing.T) {
+	t.Parallel()
+
+	sc := NewSummaryCollector()
+	now := time.Now()
+	later := now.Add(2 * time.Second)
+	d1 := digest.FromBytes([]byte("1"))
+	d2 := digest.FromBytes([]byte("2"))
+
+	sc.Add(&SolveStatus{
+		Vertexes: []*Vertex{
+			{Digest: d1, Name: "first", Started: &now},
+			{Digest: d2, Name: "second", Started: &now, Completed: &now, Cached: true},
+		},
+	})
+	sc.Add(&SolveStatus{
+		Vertexes: []*Vertex{{Digest: d1, Name: "first", Started: &now, Completed: &later}},
+		Statuses: []*VertexStatus{{ID: "layer", Vertex: d1, Current: 10, Total: 10}},
+		Logs:     []*VertexLog{{Vertex: d1, Data: []byte("hello\n")}},
+	})
+
+	s := sc.Summary(&SolveResponse{ExporterResponse: map[string]string{"containerimage.digest": "sha256:abc"}}, nil)
+	require.Equal(t, 2, s.StepsTotal)
+	require.Equal(t, 1, s.StepsCached)
+	require.Equal(t, 0, s.StepsFailed)
+	require.Equal(t, "sha256:abc", s.ImageDigest)
+	require.Equal(t, 2.0, s.Duration)
+	require.Equal(t, "first", s.Steps[0].Name)
+	require.Equal(t, 2.0, s.Steps[0].Duration)
+	require.Equal(t, int64(10), s.Steps[0].Transferred)
+	require.Equal(t, int64(6), s.Steps[0].LogBytes)
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/grpchijack"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// TagOpt configures Tag
+type TagOpt struct {
+	// Session provides the registry credentials, e.g. the docker auth
+	// provider
+	Session   []session.Attachable
+	SharedKey string
+	// Insecure allows tagging in insecure HTTP registries
+	Insecure bool
+}
+
+// Tag adds tags to the manifest of an image that was pushed to a registry,
+// without pulling or pushing its layers. ref is the image by tag or digest
+// and tags are added in its repository. The digest of the tagged manifest is
+// returned.
+func (c *Client) Tag(ctx context.Context, ref string, tags []string, opt TagOpt) (digest.Digest, error) {
+	s, err := session.NewSession(ctx, defaultSessionName(), opt.SharedKey)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create session")
+	}
+	for _, a := range opt.Session {
+		s.Allow(a)
+	}
+
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		return s.Run(ctx, grpchijack.Dialer(c.controlClient()))
+	})
+
+	var dgst digest.Digest
+	eg.Go(func() error {
+		defer s.Close()
+		resp, err := c.controlClient().Tag(ctx, &controlapi.TagRequest{
+			Ref:      ref,
+			Tags:     tags,
+			Insecure: opt.Insecure,
+			Session:  s.ID(),
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to tag")
+		}
+		dgst = resp.Digest
+		return nil
+	})
+	if err := eg.Wait(); err != nil {
+		return "", err
+	}
+	return dgst, nil
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/util/entitlements"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// LLBDiagnostic is a problem found in an LLB definition. Severity is "error"
+// for problems that fail a solve and "warning" otherwise. Vertex is empty
+// for problems of the whole definition.
+type LLBDiagnostic struct {
+	Vertex   digest.Digest
+	Severity string
+	Message  string
+}
+
+// ValidateLLB checks def against the daemon without solving it. ent are the
+// entitlements the build would be granted.
+func (c *Client) ValidateLLB(ctx context.Context, def *llb.Definition, ent ...entitlements.Entitlement) ([]*LLBDiagnostic, error) {
+	if def == nil {
+		return nil, errors.New("invalid nil definition")
+	}
+	resp, err := c.controlClient().ValidateLLB(ctx, &controlapi.ValidateLLBRequest{
+		Definition:   def.ToPB(),
+		Entitlements: ent,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to validate llb")
+	}
+
+	var out []*LLBDiagnostic
+	for _, d := range resp.Diagnostics {
+		out = append(out, &LLBDiagnostic{
+			Vertex:   d.Vertex,
+			Severity: d.Severity,
+			Message:  d.Message,
+		})
+	}
+	return out, nil
+}
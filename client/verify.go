@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// VerifyInfo is the result of verifying the blobs of the content store
+type VerifyInfo struct {
+	// Checked is the number of verified blobs
+	Checked int64
+	Corrupt []CorruptBlob
+}
+
+// CorruptBlob is a blob whose content doesn't match its digest
+type CorruptBlob struct {
+	Digest digest.Digest
+	Size   int64
+	// Records are the cache records with the blob as one of their layers
+	Records []string
+	// Evicted is set if the blob was deleted and the records that weren't
+	// in use were pruned
+	Evicted bool
+}
+
+// VerifyBlobs re-hashes the blobs stored by the daemon and evicts the
+// corrupt ones, unless dryRun is set
+func (c *Client) VerifyBlobs(ctx context.Context, dryRun bool) (*VerifyInfo, error) {
+	resp, err := c.controlClient().VerifyBlobs(ctx, &controlapi.VerifyBlobsRequest{
+		DryRun: dryRun,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to verify blobs")
+	}
+
+	info := &VerifyInfo{
+		Checked: resp.Checked,
+	}
+	for _, b := range resp.Corrupt {
+		info.Corrupt = append(info.Corrupt, CorruptBlob{
+			Digest:  b.Digest,
+			Size:    b.Size_,
+			Records: b.Records,
+			Evicted: b.Evicted,
+		})
+	}
+	return info, nil
+}
@@ -17,6 +17,29 @@ type WorkerInfo struct {
 	Labels    map[string]string
 	Platforms []ocispecs.Platform
 	GCPolicy  []PruneInfo
+	// Exporters are the exporters supported by the worker
+	Exporters []ExporterInfo
+}
+
+// ExporterInfo describes an exporter and the attributes it accepts
+type ExporterInfo struct {
+	Type    string
+	Options []ExporterOption
+}
+
+// ExporterOption describes an attribute accepted by an exporter
+type ExporterOption struct {
+	Key         string
+	Type        string
+	Values      []string `json:",omitempty"`
+	Description string
+}
+
+// CacheBackends contains the types of the cache exporters and importers
+// supported by the daemon
+type CacheBackends struct {
+	Exporters []string
+	Importers []string
 }
 
 // ListWorkers lists all active workers
@@ -40,12 +63,26 @@ func (c *Client) ListWorkers(ctx context.Context, opts ...ListWorkersOption) ([]
 			Labels:    w.Labels,
 			Platforms: pb.ToSpecPlatforms(w.Platforms),
 			GCPolicy:  fromAPIGCPolicy(w.GCPolicy),
+			Exporters: fromAPIExporters(w.Exporters),
 		})
 	}
 
 	return wi, nil
 }
 
+// ListCacheBackends lists the cache backends supported by the daemon. Older
+// daemons return no backends.
+func (c *Client) ListCacheBackends(ctx context.Context) (*CacheBackends, error) {
+	resp, err := c.controlClient().ListWorkers(ctx, &controlapi.ListWorkersRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list cache backends")
+	}
+	return &CacheBackends{
+		Exporters: resp.CacheExporters,
+		Importers: resp.CacheImporters,
+	}, nil
+}
+
 // ListWorkersOption is an option for a worker list query
 type ListWorkersOption interface {
 	SetListWorkersOption(*ListWorkersInfo)
@@ -68,3 +105,20 @@ func fromAPIGCPolicy(in []*apitypes.GCPolicy) []PruneInfo {
 	}
 	return out
 }
+
+func fromAPIExporters(in []*apitypes.ExporterInfo) []ExporterInfo {
+	out := make([]ExporterInfo, 0, len(in))
+	for _, e := range in {
+		info := ExporterInfo{Type: e.Type}
+		for _, o := range e.Options {
+			info.Options = append(info.Options, ExporterOption{
+				Key:         o.Key,
+				Type:        o.Type,
+				Values:      o.Values,
+				Description: o.Description,
+			})
+		}
+		out = append(out, info)
+	}
+	return out
+}
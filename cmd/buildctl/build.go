@@ -94,6 +94,10 @@ var buildCommand = cli.Command{
 			Name:  "secret",
 			Usage: "Secret value exposed to the build. Format id=secretname,src=filepath",
 		},
+		cli.StringSliceFlag{
+			Name:  "sign-key",
+			Usage: "Private key for signing pushed images, e.g. --sign-key id=mykey,src=cosign.key",
+		},
 		cli.StringSliceFlag{
 			Name:  "allow",
 			Usage: "Allow extra privileged entitlement, e.g. network.host, security.insecure",
@@ -106,6 +110,18 @@ var buildCommand = cli.Command{
 			Name:  "metadata-file",
 			Usage: "Output build metadata (e.g., image digest) to a file as JSON",
 		},
+		cli.StringSliceFlag{
+			Name:  "registry-auth-config",
+			Usage: "Use a separate docker config directory for the credentials of a registry host, e.g. for the cache registry. Format <host>=<dir>",
+		},
+		cli.StringFlag{
+			Name:  "summary-file",
+			Usage: "Output a build summary (steps, durations, cache hits, image digest) to a file as JSON",
+		},
+		cli.StringFlag{
+			Name:  "shared-key",
+			Usage: "Shared key of the session. Builds with the dedup opt are only shared by sessions with the same key",
+		},
 	},
 }
 
@@ -158,7 +174,11 @@ func buildAction(clicontext *cli.Context) error {
 		logrus.Infof("tracing logs to %s", traceFile.Name())
 	}
 
-	attachable := []session.Attachable{authprovider.NewDockerAuthProvider(os.Stderr)}
+	authOpts, err := build.ParseRegistryAuthConfig(clicontext.StringSlice("registry-auth-config"))
+	if err != nil {
+		return err
+	}
+	attachable := []session.Attachable{authprovider.NewDockerAuthProvider(os.Stderr, authOpts...)}
 
 	if ssh := clicontext.StringSlice("ssh"); len(ssh) > 0 {
 		configs, err := build.ParseSSH(ssh)
@@ -180,6 +200,14 @@ func buildAction(clicontext *cli.Context) error {
 		attachable = append(attachable, secretProvider)
 	}
 
+	if keys := clicontext.StringSlice("sign-key"); len(keys) > 0 {
+		signProvider, err := build.ParseSignKey(keys)
+		if err != nil {
+			return err
+		}
+		attachable = append(attachable, signProvider)
+	}
+
 	allowed, err := build.ParseAllow(clicontext.StringSlice("allow"))
 	if err != nil {
 		return err
@@ -219,6 +247,7 @@ func buildAction(clicontext *cli.Context) error {
 		CacheImports:        cacheImports,
 		Session:             attachable,
 		AllowedEntitlements: allowed,
+		SharedKey:           clicontext.String("shared-key"),
 	}
 
 	solveOpt.FrontendAttrs, err = build.ParseOpt(clicontext.StringSlice("opt"), clicontext.StringSlice("frontend-opt"))
@@ -267,6 +296,23 @@ func buildAction(clicontext *cli.Context) error {
 			return nil
 		})
 	}
+	var (
+		solveResp *client.SolveResponse
+		solveErr  error
+		solveDone = make(chan struct{})
+	)
+	if summaryFile := clicontext.String("summary-file"); summaryFile != "" {
+		summary := client.NewSummaryCollector()
+		summaryCh := make(chan *client.SolveStatus)
+		pw = progresswriter.Tee(pw, summaryCh)
+		eg.Go(func() error {
+			for s := range summaryCh {
+				summary.Add(s)
+			}
+			<-solveDone
+			return writeSummaryFile(summaryFile, summary.Summary(solveResp, solveErr))
+		})
+	}
 	mw := progresswriter.NewMultiWriter(pw)
 
 	var writers []progresswriter.Writer
@@ -289,6 +335,8 @@ func buildAction(clicontext *cli.Context) error {
 			}
 		}()
 		resp, err := c.Solve(ctx, def, solveOpt, progresswriter.ResetTime(mw.WithPrefix("", false)).Status())
+		solveResp, solveErr = resp, err
+		close(solveDone)
 		if err != nil {
 			return err
 		}
@@ -321,3 +369,11 @@ func writeMetadataFile(filename string, exporterResponse map[string]string) erro
 	}
 	return continuity.AtomicWriteFile(filename, b, 0666)
 }
+
+func writeSummaryFile(filename string, summary *client.BuildSummary) error {
+	b, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return continuity.AtomicWriteFile(filename, b, 0666)
+}
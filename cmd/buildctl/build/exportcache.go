@@ -2,6 +2,7 @@ package build
 
 import (
 	"encoding/csv"
+	"os"
 	"strings"
 
 	"github.com/moby/buildkit/client"
@@ -39,9 +40,28 @@ func parseExportCacheCSV(s string) (client.CacheOptionsEntry, error) {
 	if _, ok := ex.Attrs["mode"]; !ok {
 		ex.Attrs["mode"] = "min"
 	}
+	addGithubToken(&ex)
 	return ex, nil
 }
 
+// addGithubToken sets the url and token of gha caches that don't set them to
+// the ones of the runtime of the GitHub Actions job buildctl runs in
+func addGithubToken(ci *client.CacheOptionsEntry) {
+	if ci.Type != "gha" {
+		return
+	}
+	if _, ok := ci.Attrs["url"]; !ok {
+		if v, ok := os.LookupEnv("ACTIONS_CACHE_URL"); ok {
+			ci.Attrs["url"] = v
+		}
+	}
+	if _, ok := ci.Attrs["token"]; !ok {
+		if v, ok := os.LookupEnv("ACTIONS_RUNTIME_TOKEN"); ok {
+			ci.Attrs["token"] = v
+		}
+	}
+}
+
 // ParseExportCache parses --export-cache (and legacy --export-cache-opt)
 func ParseExportCache(exportCaches, legacyExportCacheOpts []string) ([]client.CacheOptionsEntry, error) {
 	var exports []client.CacheOptionsEntry
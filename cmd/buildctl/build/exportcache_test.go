@@ -1,6 +1,7 @@
 package build
 
 import (
+	"os"
 	"testing"
 
 	"github.com/moby/buildkit/client"
@@ -45,9 +46,37 @@ func TestParseExportCache(t *testing.T) {
 			legacyExportCacheOpts: []string{"mode=max"},
 			expectedErr:           "--export-cache-opt is not supported for the specified --export-cache",
 		},
+		{
+			exportCaches: []string{"type=gha,scope=foo", "type=gha,url=https://example.com/,token=bar"},
+			expected: []client.CacheOptionsEntry{
+				{
+					Type: "gha",
+					Attrs: map[string]string{
+						"scope": "foo",
+						"mode":  "min",
+						"url":   "https://cache.example.com/",
+						"token": "runtime-token",
+					},
+				},
+				{
+					Type: "gha",
+					Attrs: map[string]string{
+						"mode":  "min",
+						"url":   "https://example.com/",
+						"token": "bar",
+					},
+				},
+			},
+		},
 		// TODO: test multiple exportCaches (valid for CLI but not supported by solver)
 
 	}
+	os.Setenv("ACTIONS_CACHE_URL", "https://cache.example.com/")
+	os.Setenv("ACTIONS_RUNTIME_TOKEN", "runtime-token")
+	defer func() {
+		os.Unsetenv("ACTIONS_CACHE_URL")
+		os.Unsetenv("ACTIONS_RUNTIME_TOKEN")
+	}()
 	for _, tc := range testCases {
 		ex, err := ParseExportCache(tc.exportCaches, tc.legacyExportCacheOpts)
 		if tc.expectedErr == "" {
@@ -36,6 +36,7 @@ func parseImportCacheCSV(s string) (client.CacheOptionsEntry, error) {
 	if im.Type == "" {
 		return im, errors.New("--import-cache requires type=<type>")
 	}
+	addGithubToken(&im)
 	return im, nil
 }
 
@@ -1,6 +1,7 @@
 package build
 
 import (
+	"os"
 	"testing"
 
 	"github.com/moby/buildkit/client"
@@ -48,7 +49,26 @@ func TestParseImportCache(t *testing.T) {
 				},
 			},
 		},
+		{
+			importCaches: []string{"type=gha,scope=foo"},
+			expected: []client.CacheOptionsEntry{
+				{
+					Type: "gha",
+					Attrs: map[string]string{
+						"scope": "foo",
+						"url":   "https://cache.example.com/",
+						"token": "runtime-token",
+					},
+				},
+			},
+		},
 	}
+	os.Setenv("ACTIONS_CACHE_URL", "https://cache.example.com/")
+	os.Setenv("ACTIONS_RUNTIME_TOKEN", "runtime-token")
+	defer func() {
+		os.Unsetenv("ACTIONS_CACHE_URL")
+		os.Unsetenv("ACTIONS_RUNTIME_TOKEN")
+	}()
 	for _, tc := range testCases {
 		im, err := ParseImportCache(tc.importCaches)
 		if tc.expectedErr == "" {
@@ -42,7 +42,7 @@ func parseOutputCSV(s string) (client.ExportEntry, error) {
 	if v, ok := ex.Attrs["output"]; ok {
 		return ex, errors.Errorf("output=%s not supported for --output, you meant dest=%s?", v, v)
 	}
-	ex.Output, ex.OutputDir, err = resolveExporterDest(ex.Type, ex.Attrs["dest"])
+	ex.Output, ex.OutputDir, err = resolveExporterDest(ex.Type, ex.Attrs["dest"], ex.Attrs)
 	if err != nil {
 		return ex, errors.Wrap(err, "invalid output option: output")
 	}
@@ -77,7 +77,7 @@ func ParseLegacyExporter(legacyExporter string, legacyExporterOpts []string) ([]
 	if v, ok := ex.Attrs["dest"]; ok {
 		return nil, errors.Errorf("dest=%s not supported for --exporter-opt, you meant output=%s?", v, v)
 	}
-	ex.Output, ex.OutputDir, err = resolveExporterDest(ex.Type, ex.Attrs["output"])
+	ex.Output, ex.OutputDir, err = resolveExporterDest(ex.Type, ex.Attrs["output"], ex.Attrs)
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid exporter option: output")
 	}
@@ -88,7 +88,7 @@ func ParseLegacyExporter(legacyExporter string, legacyExporterOpts []string) ([]
 }
 
 // resolveExporterDest returns at most either one of io.WriteCloser (single file) or a string (directory path).
-func resolveExporterDest(exporter, dest string) (func(map[string]string) (io.WriteCloser, error), string, error) {
+func resolveExporterDest(exporter, dest string, attrs map[string]string) (func(map[string]string) (io.WriteCloser, error), string, error) {
 	wrapWriter := func(wc io.WriteCloser) func(map[string]string) (io.WriteCloser, error) {
 		return func(m map[string]string) (io.WriteCloser, error) {
 			return wc, nil
@@ -101,6 +101,12 @@ func resolveExporterDest(exporter, dest string) (func(map[string]string) (io.Wri
 		}
 		return nil, dest, nil
 	case client.ExporterOCI, client.ExporterDocker, client.ExporterTar:
+		if client.IsLayoutDirExport(exporter, attrs) {
+			if dest == "" {
+				return nil, "", errors.Errorf("output directory is required for %s exporter with tar=false", exporter)
+			}
+			return nil, dest, nil
+		}
 		if dest != "" && dest != "-" {
 			fi, err := os.Stat(dest)
 			if err != nil && !errors.Is(err, os.ErrNotExist) {
@@ -0,0 +1,26 @@
+package build
+
+import (
+	"strings"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/moby/buildkit/session/auth/authprovider"
+	"github.com/pkg/errors"
+)
+
+// ParseRegistryAuthConfig parses --registry-auth-config
+func ParseRegistryAuthConfig(sl []string) ([]authprovider.DockerAuthProviderOpt, error) {
+	opts := make([]authprovider.DockerAuthProviderOpt, 0, len(sl))
+	for _, v := range sl {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid registry auth config %q, expected <host>=<docker config dir>", v)
+		}
+		cfg, err := config.Load(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load docker config for %s", parts[0])
+		}
+		opts = append(opts, authprovider.WithHostConfig(parts[0], cfg))
+	}
+	return opts, nil
+}
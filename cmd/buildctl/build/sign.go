@@ -0,0 +1,52 @@
+package build
+
+import (
+	"encoding/csv"
+	"strings"
+
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/sign/signprovider"
+	"github.com/pkg/errors"
+)
+
+// ParseSignKey parses --sign-key
+func ParseSignKey(sl []string) (session.Attachable, error) {
+	srcs := make([]signprovider.Source, 0, len(sl))
+	for _, v := range sl {
+		s, err := parseSignKey(v)
+		if err != nil {
+			return nil, err
+		}
+		srcs = append(srcs, *s)
+	}
+	return signprovider.NewSignProvider(srcs)
+}
+
+func parseSignKey(value string) (*signprovider.Source, error) {
+	csvReader := csv.NewReader(strings.NewReader(value))
+	fields, err := csvReader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse csv sign key")
+	}
+
+	src := signprovider.Source{}
+	for _, field := range fields {
+		parts := strings.SplitN(field, "=", 2)
+		key := strings.ToLower(parts[0])
+
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid field '%s' must be a key=value pair", field)
+		}
+
+		value := parts[1]
+		switch key {
+		case "id":
+			src.ID = value
+		case "source", "src":
+			src.FilePath = value
+		default:
+			return nil, errors.Errorf("unexpected key '%s' in '%s'", key, field)
+		}
+	}
+	return &src, nil
+}
@@ -0,0 +1,78 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+const (
+	// FormatTable prints human-readable tables
+	FormatTable = "table"
+	// FormatJSON prints the result as a JSON document
+	FormatJSON = "json"
+)
+
+// FormatFlag selects the output format of commands listing records
+var FormatFlag = cli.StringFlag{
+	Name:  "format",
+	Usage: "Output format: table, json, or a Go template executed for each record, e.g. '{{.ID}}'",
+	Value: FormatTable,
+}
+
+// Formatter writes records in a machine-readable format
+type Formatter struct {
+	w    io.Writer
+	json bool
+	tmpl *template.Template
+}
+
+// NewFormatter returns a formatter for format. It returns nil for the table
+// format, which is printed by the command itself.
+func NewFormatter(w io.Writer, format string) (*Formatter, error) {
+	switch format {
+	case "", FormatTable:
+		return nil, nil
+	case FormatJSON:
+		return &Formatter{w: w, json: true}, nil
+	}
+	tmpl, err := template.New("format").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			dt, err := json.Marshal(v)
+			return string(dt), err
+		},
+	}).Parse(format)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse format %q", format)
+	}
+	return &Formatter{w: w, tmpl: tmpl}, nil
+}
+
+// Write writes records, which must be a slice. JSON output is a single
+// array, templates are executed for every element.
+func (f *Formatter) Write(records interface{}) error {
+	v := reflect.ValueOf(records)
+	if v.Kind() != reflect.Slice {
+		return errors.Errorf("invalid records type %T", records)
+	}
+	if f.json {
+		if v.IsNil() {
+			records = []interface{}{}
+		}
+		enc := json.NewEncoder(f.w)
+		enc.SetIndent("", "  ")
+		return errors.WithStack(enc.Encode(records))
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := f.tmpl.Execute(f.w, v.Index(i).Interface()); err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Fprintln(f.w)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/moby/buildkit/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatter(t *testing.T) {
+	f, err := NewFormatter(&bytes.Buffer{}, FormatTable)
+	require.NoError(t, err)
+	require.Nil(t, f)
+
+	records := []*client.UsageInfo{
+		{ID: "foo", Size: 10},
+		{ID: "bar", InUse: true},
+	}
+
+	buf := &bytes.Buffer{}
+	f, err = NewFormatter(buf, FormatJSON)
+	require.NoError(t, err)
+	require.NoError(t, f.Write(records))
+	var out []client.UsageInfo
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+	require.Len(t, out, 2)
+	require.Equal(t, "foo", out[0].ID)
+	require.Equal(t, int64(10), out[0].Size)
+	require.True(t, out[1].InUse)
+
+	buf.Reset()
+	require.NoError(t, f.Write([]*client.UsageInfo(nil)))
+	require.Equal(t, "[]\n", buf.String())
+
+	buf.Reset()
+	f, err = NewFormatter(buf, "{{.ID}} {{.InUse}}")
+	require.NoError(t, err)
+	require.NoError(t, f.Write(records))
+	require.Equal(t, "foo false\nbar true\n", buf.String())
+
+	_, err = NewFormatter(buf, "{{.ID")
+	require.Error(t, err)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+var completionCommand = cli.Command{
+	Name:      "completion",
+	Usage:     "print shell completion script",
+	ArgsUsage: "bash|zsh",
+	Action:    completion,
+	Description: `Load the completion script in the current shell with e.g.
+
+   source <(buildctl completion bash)`,
+}
+
+// completionScript wraps the urfave/cli completion protocol, which lists
+// candidates when the command line ends with --generate-bash-completion
+const completionScript = `_buildctl_complete() {
+  local cur opts
+  COMPREPLY=()
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  if [[ "$cur" == "-"* ]]; then
+    opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} ${cur} --generate-bash-completion )
+  else
+    opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} --generate-bash-completion )
+  fi
+  COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+  return 0
+}
+complete -o bashdefault -o default -o nospace -F _buildctl_complete buildctl
+`
+
+func completion(clicontext *cli.Context) error {
+	switch shell := clicontext.Args().First(); shell {
+	case "bash":
+		fmt.Fprint(clicontext.App.Writer, completionScript)
+	case "zsh":
+		fmt.Fprint(clicontext.App.Writer, "autoload -U +X bashcompinit && bashcompinit\n"+completionScript)
+	default:
+		return errors.Errorf("unsupported shell %q, expected bash or zsh", shell)
+	}
+	return nil
+}
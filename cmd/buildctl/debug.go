@@ -12,5 +12,10 @@ var debugCommand = cli.Command{
 		debug.DumpLLBCommand,
 		debug.DumpMetadataCommand,
 		debug.WorkersCommand,
+		debug.NetcheckCommand,
+		debug.CheckCommand,
+		debug.ValidateLLBCommand,
+		debug.ReplayCommand,
+		debug.ImageDiffCommand,
 	},
 }
@@ -0,0 +1,51 @@
+package debug
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	bccommon "github.com/moby/buildkit/cmd/buildctl/common"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+var CheckCommand = cli.Command{
+	Name:   "check",
+	Usage:  "validate the environment of the daemon",
+	Action: checkAction,
+}
+
+func checkAction(clicontext *cli.Context) error {
+	c, err := bccommon.ResolveClient(clicontext)
+	if err != nil {
+		return err
+	}
+
+	results, err := c.Check(commandContext(clicontext))
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 1, 8, 1, '\t', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAILS")
+	var failed int
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Name, r.Status, r.Message)
+		if r.Status == "error" {
+			failed++
+		}
+	}
+	tw.Flush()
+
+	for _, r := range results {
+		if r.Status != "ok" && r.Hint != "" {
+			fmt.Printf("\n%s: %s\n", r.Name, r.Hint)
+		}
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package debug
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/cmd/buildctl/build"
+	bccommon "github.com/moby/buildkit/cmd/buildctl/common"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/auth/authprovider"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/tonistiigi/units"
+	"github.com/urfave/cli"
+)
+
+var ImageDiffCommand = cli.Command{
+	Name:      "image-diff",
+	Usage:     "compare the configs, layers and files of two images",
+	ArgsUsage: "<refA> <refB>",
+	Action:    imageDiff,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "files",
+			Usage: "Compare the files of the images, reading all of their layers",
+		},
+		cli.StringFlag{
+			Name:  "platform",
+			Usage: "Platform of the images, defaults to the platform of the worker",
+		},
+		cli.StringSliceFlag{
+			Name:  "registry-auth-config",
+			Usage: "Use a separate docker config directory for the credentials of a registry host. Format <host>=<dir>",
+		},
+		bccommon.FormatFlag,
+	},
+}
+
+func imageDiff(clicontext *cli.Context) error {
+	args := clicontext.Args()
+	if len(args) != 2 {
+		return errors.Errorf("image-diff requires exactly two image references")
+	}
+	f, err := bccommon.NewFormatter(os.Stdout, clicontext.String("format"))
+	if err != nil {
+		return err
+	}
+	authOpts, err := build.ParseRegistryAuthConfig(clicontext.StringSlice("registry-auth-config"))
+	if err != nil {
+		return err
+	}
+
+	c, err := bccommon.ResolveClient(clicontext)
+	if err != nil {
+		return err
+	}
+
+	diff, err := c.ImageDiff(commandContext(clicontext), args[0], args[1], client.ImageDiffOpt{
+		Session:  []session.Attachable{authprovider.NewDockerAuthProvider(os.Stderr, authOpts...)},
+		Platform: clicontext.String("platform"),
+		Files:    clicontext.Bool("files"),
+	})
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		return f.Write(diff)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 1, 8, 1, '\t', 0)
+	fmt.Fprintf(tw, "Manifest A:\t%s\n", diff.ManifestA)
+	fmt.Fprintf(tw, "Manifest B:\t%s\n", diff.ManifestB)
+
+	if len(diff.Config) > 0 {
+		fmt.Fprintf(tw, "\nCONFIG\tA\tB\n")
+		for _, ch := range diff.Config {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", ch.Field, ch.A, ch.B)
+		}
+	}
+
+	var sizeA, sizeB int64
+	fmt.Fprintf(tw, "\nLAYER\tSIZE\tCHANGE\n")
+	for _, l := range diff.Layers {
+		fmt.Fprintf(tw, "%s\t%.2f\t%s\n", l.Digest, units.Bytes(l.Size), l.Change)
+		if l.Change != "added" {
+			sizeA += l.Size
+		}
+		if l.Change != "removed" {
+			sizeB += l.Size
+		}
+	}
+	fmt.Fprintf(tw, "Total:\t%.2f -> %.2f\n", units.Bytes(sizeA), units.Bytes(sizeB))
+
+	if clicontext.Bool("files") {
+		printFileChanges(tw, diff)
+	}
+	return tw.Flush()
+}
+
+// printFileChanges prints the changed files and attributes the size of the
+// added and changed files to the layers of image B
+func printFileChanges(tw *tabwriter.Writer, diff *client.ImageDiff) {
+	fmt.Fprintf(tw, "\nFILE\tCHANGE\tSIZE A\tSIZE B\n")
+	perLayer := map[digest.Digest]int64{}
+	for _, f := range diff.Files {
+		fmt.Fprintf(tw, "%s\t%s\t%.2f\t%.2f\n", f.Path, f.Change, units.Bytes(f.SizeA), units.Bytes(f.SizeB))
+		if f.Layer != "" {
+			perLayer[f.Layer] += f.SizeB
+		}
+	}
+
+	fmt.Fprintf(tw, "\nLAYER\tCHANGED FILES SIZE\n")
+	for _, l := range diff.Layers {
+		if size, ok := perLayer[l.Digest]; ok {
+			fmt.Fprintf(tw, "%s\t%.2f\n", l.Digest, units.Bytes(size))
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package debug
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	bccommon "github.com/moby/buildkit/cmd/buildctl/common"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+var NetcheckCommand = cli.Command{
+	Name:        "netcheck",
+	Usage:       "check IPv4, IPv6 and happy eyeballs connectivity of the daemon to registry and source endpoints",
+	ArgsUsage:   "[host[:port]...]",
+	Description: "Endpoints must be the default endpoints or the registries and mirrors configured for the daemon.",
+	Action:      netcheckAction,
+	Flags: []cli.Flag{
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "Timeout for each endpoint and address family (default of the daemon if unset)",
+		},
+	},
+}
+
+func netcheckAction(clicontext *cli.Context) error {
+	c, err := bccommon.ResolveClient(clicontext)
+	if err != nil {
+		return err
+	}
+
+	results, err := c.Netcheck(commandContext(clicontext), clicontext.Args(), clicontext.Duration("timeout"))
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 1, 8, 1, '\t', 0)
+	fmt.Fprintln(tw, "ENDPOINT\tFAMILY\tADDRESSES\tRESULT")
+
+	var endpoints []string
+	reachable := map[string]bool{}
+	for _, r := range results {
+		if _, ok := reachable[r.Endpoint]; !ok {
+			endpoints = append(endpoints, r.Endpoint)
+			reachable[r.Endpoint] = false
+		}
+		status := fmt.Sprintf("ok (%s)", r.Latency.Round(time.Millisecond))
+		if r.Error != "" {
+			status = "failed: " + r.Error
+		} else {
+			reachable[r.Endpoint] = true
+		}
+		addrs := "-"
+		if len(r.Addresses) > 0 {
+			addrs = strings.Join(r.Addresses, ",")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Endpoint, r.Family, addrs, status)
+	}
+	tw.Flush()
+
+	var failed int
+	for _, ep := range endpoints {
+		if !reachable[ep] {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d endpoints unreachable", failed, len(endpoints))
+	}
+	return nil
+}
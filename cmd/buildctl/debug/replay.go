@@ -0,0 +1,155 @@
+package debug
+
+import (
+	"context"
+	"os"
+
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/cmd/buildctl/build"
+	bccommon "github.com/moby/buildkit/cmd/buildctl/common"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/auth/authprovider"
+	"github.com/moby/buildkit/session/sshforward/sshprovider"
+	"github.com/moby/buildkit/util/entitlements"
+	"github.com/moby/buildkit/util/progress/progresswriter"
+	"github.com/moby/buildkit/util/solverecord"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"golang.org/x/sync/errgroup"
+)
+
+var ReplayCommand = cli.Command{
+	Name:      "replay",
+	Usage:     "re-run a solve request recorded with buildkitd --debug-record-dir",
+	ArgsUsage: "<file>",
+	Action:    replayAction,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "progress",
+			Usage: "Set type of progress (auto, plain, tty). Use plain to show container output",
+			Value: "auto",
+		},
+		cli.StringSliceFlag{
+			Name:  "local",
+			Usage: "Allow build access to the local directory, required for the local sources of the request",
+		},
+		cli.StringSliceFlag{
+			Name:  "output,o",
+			Usage: "Define exports for build result. The recorded exporter is not used",
+		},
+		cli.StringSliceFlag{
+			Name:  "secret",
+			Usage: "Secret value exposed to the build. Format id=secretname,src=filepath",
+		},
+		cli.StringSliceFlag{
+			Name:  "ssh",
+			Usage: "Allow forwarding SSH agent to the builder. Format default|<id>[=<socket>|<key>[,<key>]]",
+		},
+		cli.BoolFlag{
+			Name:  "no-cache-import",
+			Usage: "Don't import the recorded cache sources",
+		},
+	},
+}
+
+func replayAction(clicontext *cli.Context) error {
+	if clicontext.NArg() != 1 {
+		return errors.Errorf("replay requires exactly one record file argument")
+	}
+	r, err := solverecord.Load(clicontext.Args().First())
+	if err != nil {
+		return err
+	}
+	req := r.Request
+
+	c, err := bccommon.ResolveClient(clicontext)
+	if err != nil {
+		return err
+	}
+
+	attachable := []session.Attachable{authprovider.NewDockerAuthProvider(os.Stderr)}
+	if ssh := clicontext.StringSlice("ssh"); len(ssh) > 0 {
+		configs, err := build.ParseSSH(ssh)
+		if err != nil {
+			return err
+		}
+		sp, err := sshprovider.NewSSHAgentProvider(configs)
+		if err != nil {
+			return err
+		}
+		attachable = append(attachable, sp)
+	}
+	if secrets := clicontext.StringSlice("secret"); len(secrets) > 0 {
+		secretProvider, err := build.ParseSecret(secrets)
+		if err != nil {
+			return err
+		}
+		attachable = append(attachable, secretProvider)
+	}
+
+	exports, err := build.ParseOutput(clicontext.StringSlice("output"))
+	if err != nil {
+		return err
+	}
+
+	localDirs, err := build.ParseLocal(clicontext.StringSlice("local"))
+	if err != nil {
+		return errors.Wrap(err, "invalid local")
+	}
+	for _, name := range r.Locals {
+		if _, ok := localDirs[name]; !ok {
+			return errors.Errorf("the request reads local source %q, set it with --local %s=<dir>", name, name)
+		}
+	}
+
+	solveOpt := client.SolveOpt{
+		Exports:             exports,
+		LocalDirs:           localDirs,
+		Frontend:            req.Frontend,
+		FrontendAttrs:       req.FrontendAttrs,
+		FrontendInputs:      map[string]llb.State{},
+		Session:             attachable,
+		AllowedEntitlements: append([]entitlements.Entitlement{}, req.Entitlements...),
+	}
+	for k, v := range req.FrontendInputs {
+		op, err := llb.NewDefinitionOp(v)
+		if err != nil {
+			return errors.Wrapf(err, "invalid frontend input %s", k)
+		}
+		solveOpt.FrontendInputs[k] = llb.NewState(op)
+	}
+	if !clicontext.Bool("no-cache-import") {
+		for _, im := range req.Cache.Imports {
+			solveOpt.CacheImports = append(solveOpt.CacheImports, client.CacheOptionsEntry{
+				Type:  im.Type,
+				Attrs: im.Attrs,
+			})
+		}
+	}
+
+	var def *llb.Definition
+	if req.Definition != nil {
+		def = &llb.Definition{}
+		def.FromPB(req.Definition)
+	}
+
+	logrus.Infof("replaying solve request %s recorded at %s", req.Ref, r.Time)
+
+	pw, err := progresswriter.NewPrinter(context.TODO(), os.Stderr, clicontext.String("progress"))
+	if err != nil {
+		return err
+	}
+
+	eg, ctx := errgroup.WithContext(commandContext(clicontext))
+	eg.Go(func() error {
+		_, err := c.Solve(ctx, def, solveOpt, progresswriter.ResetTime(pw).Status())
+		return err
+	})
+	eg.Go(func() error {
+		<-pw.Done()
+		return pw.Err()
+	})
+	return eg.Wait()
+}
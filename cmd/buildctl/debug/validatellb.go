@@ -0,0 +1,91 @@
+package debug
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/cmd/buildctl/build"
+	bccommon "github.com/moby/buildkit/cmd/buildctl/common"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+var ValidateLLBCommand = cli.Command{
+	Name:      "validate-llb",
+	Usage:     "validate LLB against the daemon without building it. LLB can be also passed via stdin.",
+	ArgsUsage: "<llbfile>",
+	Action:    validateLLB,
+	Flags: []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "allow",
+			Usage: "Allow extra privileged entitlement, e.g. network.host, security.insecure",
+		},
+		bccommon.FormatFlag,
+	},
+}
+
+func validateLLB(clicontext *cli.Context) error {
+	f, err := bccommon.NewFormatter(os.Stdout, clicontext.String("format"))
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader
+	if llbFile := clicontext.Args().First(); llbFile != "" && llbFile != "-" {
+		file, err := os.Open(llbFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	} else {
+		r = os.Stdin
+	}
+	def, err := llb.ReadFrom(r)
+	if err != nil {
+		return err
+	}
+
+	allowed, err := build.ParseAllow(clicontext.StringSlice("allow"))
+	if err != nil {
+		return err
+	}
+
+	c, err := bccommon.ResolveClient(clicontext)
+	if err != nil {
+		return err
+	}
+
+	diags, err := c.ValidateLLB(commandContext(clicontext), def, allowed...)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, d := range diags {
+		if d.Severity == "error" {
+			failed++
+		}
+	}
+
+	if f != nil {
+		if err := f.Write(diags); err != nil {
+			return err
+		}
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 1, 8, 1, '\t', 0)
+		fmt.Fprintln(tw, "SEVERITY\tVERTEX\tMESSAGE")
+		for _, d := range diags {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", d.Severity, d.Vertex, d.Message)
+		}
+		tw.Flush()
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d errors found in llb", failed)
+	}
+	return nil
+}
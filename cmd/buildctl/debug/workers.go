@@ -29,10 +29,16 @@ var WorkersCommand = cli.Command{
 			Name:  "verbose, v",
 			Usage: "Verbose output",
 		},
+		bccommon.FormatFlag,
 	},
 }
 
 func listWorkers(clicontext *cli.Context) error {
+	f, err := bccommon.NewFormatter(os.Stdout, clicontext.String("format"))
+	if err != nil {
+		return err
+	}
+
 	c, err := bccommon.ResolveClient(clicontext)
 	if err != nil {
 		return err
@@ -42,6 +48,10 @@ func listWorkers(clicontext *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	if f != nil {
+		return f.Write(workers)
+	}
+
 	tw := tabwriter.NewWriter(os.Stdout, 1, 8, 1, '\t', 0)
 
 	if clicontext.Bool("verbose") {
@@ -61,6 +71,13 @@ func printWorkersVerbose(tw *tabwriter.Writer, winfo []*client.WorkerInfo) {
 			v := wi.Labels[k]
 			fmt.Fprintf(tw, "\t%s:\t%s\n", k, v)
 		}
+		if len(wi.Exporters) > 0 {
+			types := make([]string, 0, len(wi.Exporters))
+			for _, e := range wi.Exporters {
+				types = append(types, e.Type)
+			}
+			fmt.Fprintf(tw, "Exporters:\t%s\n", strings.Join(types, ","))
+		}
 		for i, rule := range wi.GCPolicy {
 			fmt.Fprintf(tw, "GC Policy rule#%d:\n", i)
 			fmt.Fprintf(tw, "\tAll:\t%v\n", rule.All)
@@ -25,10 +25,16 @@ var diskUsageCommand = cli.Command{
 			Name:  "verbose, v",
 			Usage: "Verbose output",
 		},
+		bccommon.FormatFlag,
 	},
 }
 
 func diskUsage(clicontext *cli.Context) error {
+	f, err := bccommon.NewFormatter(os.Stdout, clicontext.String("format"))
+	if err != nil {
+		return err
+	}
+
 	c, err := bccommon.ResolveClient(clicontext)
 	if err != nil {
 		return err
@@ -39,6 +45,10 @@ func diskUsage(clicontext *cli.Context) error {
 		return err
 	}
 
+	if f != nil {
+		return f.Write(du)
+	}
+
 	tw := tabwriter.NewWriter(os.Stdout, 1, 8, 1, '\t', 0)
 
 	if clicontext.Bool("verbose") {
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/cmd/buildctl/build"
+	bccommon "github.com/moby/buildkit/cmd/buildctl/common"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+const buildArgPrefix = "build-arg:"
+
+var expectCommand = cli.Command{
+	Name:      "expect",
+	Usage:     "register a build that is expected to run, so that its images are prefetched while the daemon is idle",
+	ArgsUsage: "[<id>]",
+	Action:    expect,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "frontend",
+			Usage: "Frontend of the build, e.g. dockerfile.v0",
+		},
+		cli.StringSliceFlag{
+			Name:  "opt",
+			Usage: "Frontend options of the build, e.g. build-arg:BUILDKIT_SYNTAX=docker/dockerfile:1",
+		},
+		cli.StringFlag{
+			Name:  "dockerfile",
+			Usage: "Dockerfile of the build, its syntax directive and base images are prefetched",
+		},
+		cli.StringSliceFlag{
+			Name:  "image",
+			Usage: "Image used by the build, e.g. a base image",
+		},
+		cli.StringSliceFlag{
+			Name:  "import-cache",
+			Usage: "Cache import of the build, e.g. type=registry,ref=example.com/foo/bar:cache",
+		},
+		cli.BoolFlag{
+			Name:  "remove",
+			Usage: "Unregister the build",
+		},
+	},
+}
+
+func expect(clicontext *cli.Context) error {
+	args := clicontext.Args()
+	if len(args) > 1 {
+		return errors.Errorf("expect requires at most one build ID")
+	}
+
+	var builds []client.ExpectedBuild
+	var remove []string
+	if len(args) == 1 {
+		if clicontext.Bool("remove") {
+			remove = append(remove, args[0])
+		} else {
+			attrs, err := build.ParseOpt(clicontext.StringSlice("opt"), nil)
+			if err != nil {
+				return err
+			}
+			cacheImports, err := build.ParseImportCache(clicontext.StringSlice("import-cache"))
+			if err != nil {
+				return err
+			}
+			images := clicontext.StringSlice("image")
+			if fn := clicontext.String("dockerfile"); fn != "" {
+				imgs, err := dockerfileImages(fn, attrs)
+				if err != nil {
+					return err
+				}
+				images = append(images, imgs...)
+			}
+			builds = append(builds, client.ExpectedBuild{
+				ID:            args[0],
+				Frontend:      clicontext.String("frontend"),
+				FrontendAttrs: attrs,
+				Images:        images,
+				CacheImports:  cacheImports,
+			})
+		}
+	} else if clicontext.Bool("remove") {
+		return errors.Errorf("--remove requires a build ID")
+	}
+
+	c, err := bccommon.ResolveClient(clicontext)
+	if err != nil {
+		return err
+	}
+
+	registered, err := c.RegisterExpectedBuilds(bccommon.CommandContext(clicontext), builds, remove)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 1, 8, 1, '\t', 0)
+	fmt.Fprintln(tw, "ID\tFRONTEND\tIMAGES")
+	for _, b := range registered {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", b.ID, b.Frontend, strings.Join(b.Images, ","))
+	}
+	return tw.Flush()
+}
+
+// dockerfileImages returns the base images of the Dockerfile fn and the
+// image of its syntax directive unless the frontend attrs override it
+func dockerfileImages(fn string, attrs map[string]string) ([]string, error) {
+	dt, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	buildArgs := map[string]string{}
+	for k, v := range attrs {
+		if strings.HasPrefix(k, buildArgPrefix) {
+			buildArgs[strings.TrimPrefix(k, buildArgPrefix)] = v
+		}
+	}
+	syntax, images, err := dockerfile2llb.BaseImages(dt, buildArgs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", fn)
+	}
+	if _, ok := buildArgs["BUILDKIT_SYNTAX"]; !ok && syntax != "" {
+		images = append([]string{syntax}, images...)
+	}
+	return images, nil
+}
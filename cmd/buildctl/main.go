@@ -39,6 +39,7 @@ func main() {
 	app.Name = "buildctl"
 	app.Usage = "build utility"
 	app.Version = version.Version
+	app.EnableBashCompletion = true
 
 	defaultAddress := os.Getenv("BUILDKIT_HOST")
 	if defaultAddress == "" {
@@ -91,8 +92,12 @@ func main() {
 		diskUsageCommand,
 		pruneCommand,
 		buildCommand,
+		tagCommand,
+		expectCommand,
+		verifyCommand,
 		debugCommand,
 		dialStdioCommand,
+		completionCommand,
 	}
 
 	var debugEnabled bool
@@ -128,6 +133,9 @@ func handleErr(debug bool, err error) {
 	} else {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 	}
+	if code := errdefs.GetCode(err); code != "" {
+		fmt.Fprintf(os.Stderr, "error code: %s\n", code)
+	}
 	os.Exit(1)
 }
 
@@ -26,7 +26,7 @@ var pruneCommand = cli.Command{
 		},
 		cli.StringSliceFlag{
 			Name:  "filter, f",
-			Usage: "Filter records",
+			Usage: "Filter records, e.g. description~=apt-get, optype==exec, source~=alpine",
 		},
 		cli.BoolFlag{
 			Name:  "all",
@@ -36,10 +36,16 @@ var pruneCommand = cli.Command{
 			Name:  "verbose, v",
 			Usage: "Verbose output",
 		},
+		bccommon.FormatFlag,
 	},
 }
 
 func prune(clicontext *cli.Context) error {
+	f, err := bccommon.NewFormatter(os.Stdout, clicontext.String("format"))
+	if err != nil {
+		return err
+	}
+
 	c, err := bccommon.ResolveClient(clicontext)
 	if err != nil {
 		return err
@@ -51,12 +57,16 @@ func prune(clicontext *cli.Context) error {
 	tw := tabwriter.NewWriter(os.Stdout, 1, 8, 1, '\t', 0)
 	first := true
 	total := int64(0)
+	var pruned []*client.UsageInfo
 
 	go func() {
 		defer close(printed)
 		for du := range ch {
+			du := du
 			total += du.Size
-			if clicontext.Bool("verbose") {
+			if f != nil {
+				pruned = append(pruned, &du)
+			} else if clicontext.Bool("verbose") {
 				printVerbose(tw, []*client.UsageInfo{&du})
 			} else {
 				if first {
@@ -85,6 +95,10 @@ func prune(clicontext *cli.Context) error {
 		return err
 	}
 
+	if f != nil {
+		return f.Write(pruned)
+	}
+
 	tw = tabwriter.NewWriter(os.Stdout, 1, 8, 1, '\t', 0)
 	fmt.Fprintf(tw, "Total:\t%.2f\n", units.Bytes(total))
 	tw.Flush()
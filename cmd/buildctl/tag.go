@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/cmd/buildctl/build"
+	bccommon "github.com/moby/buildkit/cmd/buildctl/common"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/auth/authprovider"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+var tagCommand = cli.Command{
+	Name:      "tag",
+	Usage:     "add tags to an image in a registry without pulling or pushing its layers",
+	ArgsUsage: "<ref> <tag>...",
+	Action:    tag,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "insecure",
+			Usage: "Allow an insecure HTTP registry",
+		},
+		cli.StringSliceFlag{
+			Name:  "registry-auth-config",
+			Usage: "Use a separate docker config directory for the credentials of a registry host. Format <host>=<dir>",
+		},
+	},
+}
+
+func tag(clicontext *cli.Context) error {
+	args := clicontext.Args()
+	if len(args) < 2 {
+		return errors.Errorf("tag requires an image and at least one tag")
+	}
+
+	authOpts, err := build.ParseRegistryAuthConfig(clicontext.StringSlice("registry-auth-config"))
+	if err != nil {
+		return err
+	}
+
+	c, err := bccommon.ResolveClient(clicontext)
+	if err != nil {
+		return err
+	}
+
+	dgst, err := c.Tag(bccommon.CommandContext(clicontext), args[0], args[1:], client.TagOpt{
+		Session:  []session.Attachable{authprovider.NewDockerAuthProvider(os.Stderr, authOpts...)},
+		Insecure: clicontext.Bool("insecure"),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println(dgst)
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	bccommon "github.com/moby/buildkit/cmd/buildctl/common"
+	"github.com/tonistiigi/units"
+	"github.com/urfave/cli"
+)
+
+var verifyCommand = cli.Command{
+	Name:   "verify",
+	Usage:  "re-hash the stored blobs and evict the corrupt ones",
+	Action: verify,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Report corrupt blobs without evicting them",
+		},
+		bccommon.FormatFlag,
+	},
+}
+
+func verify(clicontext *cli.Context) error {
+	f, err := bccommon.NewFormatter(os.Stdout, clicontext.String("format"))
+	if err != nil {
+		return err
+	}
+
+	c, err := bccommon.ResolveClient(clicontext)
+	if err != nil {
+		return err
+	}
+
+	info, err := c.VerifyBlobs(bccommon.CommandContext(clicontext), clicontext.Bool("dry-run"))
+	if err != nil {
+		return err
+	}
+
+	if f != nil {
+		return f.Write(info.Corrupt)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 1, 8, 1, '\t', 0)
+	if len(info.Corrupt) > 0 {
+		fmt.Fprintln(tw, "DIGEST\tSIZE\tEVICTED\tRECORDS")
+		for _, b := range info.Corrupt {
+			fmt.Fprintf(tw, "%s\t%.2f\t%v\t%s\n", b.Digest, units.Bytes(b.Size), b.Evicted, strings.Join(b.Records, ","))
+		}
+	}
+	fmt.Fprintf(tw, "Checked:\t%d\n", info.Checked)
+	fmt.Fprintf(tw, "Corrupt:\t%d\n", len(info.Corrupt))
+	return tw.Flush()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/moby/buildkit/cmd/buildkitd/config"
+	"github.com/moby/buildkit/executor"
+	"github.com/moby/buildkit/source/git"
+	"github.com/moby/buildkit/util/resolver"
+	"github.com/pkg/errors"
+)
+
+const (
+	caCertificatesTemplate = "ca-certificates"
+	defaultCACertsTarget   = "/etc/ssl/buildkit/ca-certificates.crt"
+)
+
+// systemCABundles are the locations of the CA bundle of the host, as searched
+// by crypto/x509
+var systemCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// setupCACertificates adds the additional CAs of the config to the trusted
+// roots of the registry clients, of tr and of the git CLI. It returns the
+// mount template of the bundle of the system CAs and the additional CAs for
+// build steps, nil if there are no additional CAs or the mount is disabled.
+func setupCACertificates(cfg *config.Config, tr *http.Transport) (*executor.MountTemplate, error) {
+	cc := cfg.CACertificates
+	if len(cc.Files) == 0 {
+		return nil, nil
+	}
+
+	var extra bytes.Buffer
+	for _, f := range cc.Files {
+		dt, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read CA certificates %s", f)
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(dt) {
+			return nil, errors.Errorf("no CA certificates found in %s", f)
+		}
+		extra.Write(bytes.TrimSpace(dt))
+		extra.WriteByte('\n')
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		if runtime.GOOS != "windows" {
+			return nil, errors.Wrap(err, "unable to get system cert pool")
+		}
+		pool = x509.NewCertPool()
+	}
+	pool.AppendCertsFromPEM(extra.Bytes())
+
+	target := cc.Target
+	if target == "" {
+		target = defaultCACertsTarget
+	}
+	if !cc.DisableMount {
+		if !filepath.IsAbs(target) {
+			return nil, errors.Errorf("target %s of CA certificates is not an absolute path", target)
+		}
+		if _, ok := cfg.MountTemplates[caCertificatesTemplate]; ok {
+			return nil, errors.Errorf("mount template %s is reserved for the CA certificates", caCertificatesTemplate)
+		}
+	}
+
+	// the bundle is also passed to the git CLI, which doesn't use the
+	// clients of the daemon
+	bundle, err := systemCABundle()
+	if err != nil {
+		return nil, err
+	}
+	bundle = append(bundle, extra.Bytes()...)
+	p := filepath.Join(cfg.Root, "ca-certificates.crt")
+	if err := writeFileAtomic(p, bundle, 0644); err != nil {
+		return nil, err
+	}
+
+	resolver.SetRootCAs(pool)
+	git.SetCAInfo(p)
+	// the http source and the remote caches use the default transport
+	if tr != nil {
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		tr.TLSClientConfig.RootCAs = pool
+	}
+
+	if cc.DisableMount {
+		return nil, nil
+	}
+	return &executor.MountTemplate{
+		Name:   caCertificatesTemplate,
+		Source: p,
+		Dest:   target,
+		Auto:   true,
+		Env:    []string{"SSL_CERT_FILE=" + target},
+	}, nil
+}
+
+// systemCABundle returns the contents of the CA bundle of the host, empty if
+// it has none
+func systemCABundle() ([]byte, error) {
+	bundles := systemCABundles
+	if f := os.Getenv("SSL_CERT_FILE"); f != "" {
+		bundles = []string{f}
+	}
+	for _, f := range bundles {
+		dt, err := ioutil.ReadFile(f)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "failed to read system CA certificates %s", f)
+		}
+		dt = bytes.TrimSpace(dt)
+		if len(dt) > 0 {
+			dt = append(dt, '\n')
+		}
+		return dt, nil
+	}
+	return nil, nil
+}
+
+func writeFileAtomic(p string, dt []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(p), "."+filepath.Base(p))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(dt); err != nil {
+		f.Close()
+		return errors.WithStack(err)
+	}
+	if err := f.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(f.Name(), p))
+}
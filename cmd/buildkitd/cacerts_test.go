@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moby/buildkit/cmd/buildkitd/config"
+	"github.com/moby/buildkit/source/git"
+	"github.com/moby/buildkit/util/resolver"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupCACertificates(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	tmpdir, err := ioutil.TempDir("", "cacerts")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	caFile := filepath.Join(tmpdir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(caFile, ca, 0600))
+	invalidFile := filepath.Join(tmpdir, "invalid.pem")
+	require.NoError(t, ioutil.WriteFile(invalidFile, []byte("invalid"), 0600))
+
+	tr := &http.Transport{}
+	defer func() {
+		resolver.SetRootCAs(nil)
+		git.SetCAInfo("")
+	}()
+
+	cfg := &config.Config{Root: tmpdir}
+	tmpl, err := setupCACertificates(cfg, tr)
+	require.NoError(t, err)
+	require.Nil(t, tmpl)
+
+	cfg.CACertificates.Files = []string{invalidFile}
+	_, err = setupCACertificates(cfg, tr)
+	require.Error(t, err)
+
+	_, err = (&http.Client{Transport: tr.Clone()}).Get(srv.URL)
+	require.Error(t, err)
+
+	cfg.CACertificates.Files = []string{caFile}
+	tmpl, err = setupCACertificates(cfg, tr)
+	require.NoError(t, err)
+	require.Equal(t, caCertificatesTemplate, tmpl.Name)
+	require.Equal(t, defaultCACertsTarget, tmpl.Dest)
+	require.Equal(t, true, tmpl.Auto)
+	require.Equal(t, []string{"SSL_CERT_FILE=" + defaultCACertsTarget}, tmpl.Env)
+
+	dt, err := ioutil.ReadFile(tmpl.Source)
+	require.NoError(t, err)
+	require.Contains(t, string(dt), string(ca))
+
+	resp, err := (&http.Client{Transport: tr.Clone()}).Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.NoError(t, os.Remove(tmpl.Source))
+	cfg.CACertificates.DisableMount = true
+	tmpl, err = setupCACertificates(cfg, tr)
+	require.NoError(t, err)
+	require.Nil(t, tmpl)
+
+	// the git CLI is passed the bundle even without the mount
+	dt, err = ioutil.ReadFile(filepath.Join(tmpdir, "ca-certificates.crt"))
+	require.NoError(t, err)
+	require.Contains(t, string(dt), string(ca))
+}
@@ -8,6 +8,14 @@ import (
 // Config provides containerd configuration data for the server
 type Config struct {
 	Debug bool `toml:"debug"`
+	// DebugRecordDir is a directory that all solve requests are recorded to
+	DebugRecordDir string `toml:"debug-record-dir"`
+	// DebugRecordKeepDuration is the time in seconds recorded requests are
+	// kept for. Defaults to 48 hours.
+	DebugRecordKeepDuration int64 `toml:"debug-record-keep-duration"`
+	// DebugRecordMaxSize is the total size in bytes the oldest recorded
+	// requests are removed above. Defaults to 100MiB.
+	DebugRecordMaxSize int64 `toml:"debug-record-max-size"`
 
 	// Root is the path to a directory where buildkit will store persistent data
 	Root string `toml:"root"`
@@ -25,6 +33,29 @@ type Config struct {
 	Registries map[string]resolver.RegistryConfig `toml:"registry"`
 
 	DNS *DNSConfig `toml:"dns"`
+
+	// MountTemplates are files or directories of the host by name that are
+	// mounted read-only into the build steps of the workers
+	MountTemplates map[string]MountTemplateConfig `toml:"mount-template"`
+
+	// BuildArgs are default build args of all builds
+	BuildArgs BuildArgsConfig `toml:"build-args"`
+
+	// ExperimentalOptions accepts exporter and frontend attributes that are
+	// marked experimental
+	ExperimentalOptions bool `toml:"experimental-options"`
+
+	// DownloadCache shares the downloads of the http and git sources
+	// between the builds of all workers
+	DownloadCache DownloadCacheConfig `toml:"download-cache"`
+
+	// CACertificates are additional CAs trusted by the registry and http
+	// clients of the daemon and by the build steps
+	CACertificates CACertificatesConfig `toml:"ca-certificates"`
+
+	// OutputPolicy are the rules the results of builds are verified with
+	// before they are exported
+	OutputPolicy []OutputPolicyRule `toml:"output-policy"`
 }
 
 type GRPCConfig struct {
@@ -56,6 +87,99 @@ type NetworkConfig struct {
 	CNIBinaryPath string `toml:"cniBinaryPath"`
 }
 
+type UserConfig struct {
+	// DefaultUser is the user for build steps that don't set one, e.g.
+	// because the image config has none. Format <user>[:<group>]
+	DefaultUser string `toml:"default-user"`
+	// DefaultGroups are supplementary group IDs added for DefaultUser
+	DefaultGroups []uint32 `toml:"default-groups"`
+	// RejectRoot fails build steps that would run as root
+	RejectRoot bool `toml:"reject-root"`
+}
+
+type CacheLimitsConfig struct {
+	// MaxCacheRecords is the maximum number of cache records of the worker
+	MaxCacheRecords int `toml:"max-cache-records"`
+	// MaxCacheRecordSize is the maximum size of a single cache record in bytes
+	MaxCacheRecordSize int64 `toml:"max-cache-record-size"`
+	// MaxParallelConversions is the maximum number of layer blobs converted
+	// to another compression at the same time, e.g. for force-compression.
+	// Defaults to the number of CPUs.
+	MaxParallelConversions int `toml:"max-parallel-conversions"`
+	// VerifyBlobsInterval is the interval in seconds the blobs of the
+	// content store are re-hashed to evict corrupt ones. 0 disables the
+	// periodic verification.
+	VerifyBlobsInterval int64 `toml:"verify-blobs-interval"`
+	// FinalizePolicy is "lazy" (default) to commit the snapshots of build
+	// steps when they are used, or "eager" to commit them when the steps
+	// complete
+	FinalizePolicy string `toml:"finalize-policy"`
+	// MinFreeSpace is the free space in bytes of the filesystems of the
+	// cache below which the cache is pruned with the GC policy, and build
+	// steps fail if it's still too low. 0 disables the check.
+	MinFreeSpace int64 `toml:"min-free-space"`
+}
+
+type CompressionConfig struct {
+	// CompressionLevel is the default level of the layer blobs created for
+	// exports per compression type, e.g. {gzip = 9, zstd = 19}. The gzip
+	// level also applies to estargz and the zstd level to zstd:chunked.
+	CompressionLevel map[string]int `toml:"compression-level"`
+}
+
+type AttestationConfig struct {
+	// SBOMScanner is the command generating SBOMs for the attest:sbom
+	// exporter option. "{root}" is replaced by the path of the scanned root
+	// filesystem. Defaults to syft.
+	SBOMScanner []string `toml:"sbom-scanner"`
+	// SBOMPredicateType is the in-toto predicate type of the SBOMScanner
+	// output. Defaults to SPDX.
+	SBOMPredicateType string `toml:"sbom-predicate-type"`
+}
+
+type PushConfig struct {
+	// PushConcurrency is the default maximum number of parallel blob
+	// uploads of an image push. By default pushes to a registry share a
+	// limit of 4 uploads.
+	PushConcurrency int `toml:"push-concurrency"`
+	// PushChunkSize is the default maximum size in bytes of the requests a
+	// layer is uploaded with. 0 uploads a layer with a single request.
+	PushChunkSize int64 `toml:"push-chunk-size"`
+}
+
+type ExportConfig struct {
+	// ExportContainerdAddresses are the addresses of the containerd
+	// instances the image exporter may copy images to with
+	// containerd.address, unix:///path or tcp://host:port. Exporting to other
+	// containerd instances is denied if empty.
+	ExportContainerdAddresses []string `toml:"export-containerd-addresses"`
+	// ExportContainerdNamespaces are the other namespaces of the containerd
+	// worker the image exporter may create images in with namespaces.
+	// Exporting to other namespaces is denied if empty.
+	ExportContainerdNamespaces []string `toml:"export-containerd-namespaces"`
+}
+
+type RemoteExecutorConfig struct {
+	// Address is the address of the executor service the build steps of the
+	// worker are dispatched to, unix:///path or tcp://host:port
+	Address string `toml:"address"`
+	// Fallback runs build steps with the local executor if the service
+	// can't be reached
+	Fallback bool `toml:"fallback"`
+	// TLS is the client certificate and the CA of tcp connections, which
+	// always use TLS
+	TLS TLSConfig `toml:"tls"`
+}
+
+type DefaultsConfig struct {
+	// DefaultPath is the PATH per OS, e.g. "linux", for build steps whose
+	// image config doesn't set one
+	DefaultPath map[string]string `toml:"default-path"`
+	// DefaultShell is the shell per OS used for the shell form of commands
+	// when the image config doesn't set one
+	DefaultShell map[string][]string `toml:"default-shell"`
+}
+
 type OCIConfig struct {
 	Enabled          *bool             `toml:"enabled"`
 	Labels           map[string]string `toml:"labels"`
@@ -65,6 +189,17 @@ type OCIConfig struct {
 	NoProcessSandbox bool              `toml:"noProcessSandbox"`
 	GCConfig
 	NetworkConfig
+	UserConfig
+	CacheLimitsConfig
+	CompressionConfig
+	DefaultsConfig
+	AttestationConfig
+	PushConfig
+	ExportConfig
+	RemoteExecutor RemoteExecutorConfig `toml:"remote-executor"`
+	// SnapshotterMigrateFrom is the name of a snapshotter whose existing
+	// cache state is migrated to Snapshotter on startup
+	SnapshotterMigrateFrom string `toml:"snapshotter-migrate-from"`
 	// UserRemapUnsupported is unsupported key for testing. The feature is
 	// incomplete and the intention is to make it default without config.
 	UserRemapUnsupported string `toml:"userRemapUnsupported"`
@@ -83,6 +218,19 @@ type OCIConfig struct {
 
 	// MaxParallelism is the maximum number of parallel build steps that can be run at the same time.
 	MaxParallelism int `toml:"max-parallelism"`
+
+	// CheckpointInterval is the interval in seconds build steps are
+	// checkpointed in with CRIU, so that they can be restored after a
+	// restart. Experimental, 0 disables checkpointing.
+	CheckpointInterval int64 `toml:"experimental-checkpoint-interval"`
+
+	// ContentDedup stores the blobs of the content store as content-defined
+	// chunks, so that identical ranges of blobs are stored once.
+	ContentDedup bool `toml:"content-dedup"`
+
+	// Differ creates the layer blobs of snapshots: "auto", "overlayfs" or
+	// "walking". Auto uses the upperdir of overlayfs snapshots when safe.
+	Differ string `toml:"differ"`
 }
 
 type ContainerdConfig struct {
@@ -93,13 +241,84 @@ type ContainerdConfig struct {
 	Namespace string            `toml:"namespace"`
 	GCConfig
 	NetworkConfig
-	Snapshotter string `toml:"snapshotter"`
+	UserConfig
+	CacheLimitsConfig
+	CompressionConfig
+	DefaultsConfig
+	AttestationConfig
+	PushConfig
+	ExportConfig
+	RemoteExecutor RemoteExecutorConfig `toml:"remote-executor"`
+	Snapshotter    string               `toml:"snapshotter"`
 
 	// ApparmorProfile is the name of the apparmor profile that should be used to constrain build containers.
 	// The profile should already be loaded (by a higher level system) before creating a worker.
 	ApparmorProfile string `toml:"apparmor-profile"`
 
 	MaxParallelism int `toml:"max-parallelism"`
+
+	// Differ creates the layer blobs of snapshots, see OCIConfig
+	Differ string `toml:"differ"`
+}
+
+type MountTemplateConfig struct {
+	// Source is the file or directory on the host
+	Source string `toml:"source"`
+	// Target is the absolute path the template is mounted at in build steps
+	Target string `toml:"target"`
+	// Auto mounts the template into every build step. Otherwise it is only
+	// mounted for the solves that request it with the mount-templates
+	// frontend attr.
+	Auto bool `toml:"auto"`
+}
+
+type BuildArgsConfig struct {
+	// Defaults are added to the build args of every build. Build args set
+	// by the client take precedence.
+	Defaults map[string]string `toml:"defaults"`
+	// AllowExclude are the names of the default build args clients can
+	// exclude with the exclude-default-build-args frontend option, "*" for
+	// all of them
+	AllowExclude []string `toml:"allow-exclude"`
+}
+
+type DownloadCacheConfig struct {
+	Enabled bool `toml:"enabled"`
+	// TTL is the time in seconds downloads, and resolved git refs if
+	// enabled, are used without checking the remote for changes. Defaults to
+	// 10 minutes.
+	TTL int64 `toml:"ttl"`
+	// MaxSize is the size in bytes the least recently used downloads are
+	// removed above. 0 doesn't limit the size.
+	MaxSize int64 `toml:"max-size"`
+	// GitRefs reuses the commits that git branches and tags resolve to for
+	// the TTL. Builds don't see pushes made within the TTL then.
+	GitRefs bool `toml:"git-refs"`
+}
+
+type CACertificatesConfig struct {
+	// Files are PEM files of the additional CAs
+	Files []string `toml:"files"`
+	// Target is the path the bundle of the system CAs and the additional
+	// CAs is mounted at in build steps. SSL_CERT_FILE defaults to it.
+	// Defaults to /etc/ssl/buildkit/ca-certificates.crt.
+	Target string `toml:"target"`
+	// DisableMount only adds the CAs to the clients of the daemon and git
+	DisableMount bool `toml:"disable-mount"`
+}
+
+type OutputPolicyRule struct {
+	// Name identifies the rule in the reports of failed exports
+	Name string `toml:"name"`
+	// DenyPaths are patterns of paths that must not exist in the result,
+	// absolute like /root/.ssh or of base names like *.pem
+	DenyPaths []string `toml:"deny-paths"`
+	// MaxSize is the size in bytes the files of the layers of the result
+	// must not exceed
+	MaxSize int64 `toml:"max-size"`
+	// Exporters are the exporter types the rule applies to, e.g. image or
+	// cache for remote cache exports, all exporters if empty
+	Exporters []string `toml:"exporters"`
 }
 
 type GCPolicy struct {
@@ -31,9 +31,22 @@ snapshotter="overlay"
 rootless=true
 gc=false
 gckeepstorage=123456789
+default-user="1000:1000"
+default-groups=[1001,1002]
+reject-root=true
+max-cache-record-size=1000000
+max-parallel-conversions=2
+content-dedup=true
+sbom-scanner=["trivy","fs","--format","spdx-json","{root}"]
+[worker.oci.compression-level]
+zstd=19
 [worker.oci.labels]
 foo="bar"
 "aa.bb.cc"="baz"
+[worker.oci.default-path]
+linux="/busybox:/usr/bin"
+[worker.oci.default-shell]
+windows=["powershell","-Command"]
 
 [worker.containerd]
 namespace="non-default"
@@ -54,10 +67,48 @@ http=true
 insecure=true
 ca=["myca.pem"]
 tlsconfigdir=["/etc/buildkitd/myregistry"]
+maxidleconns=100
+maxconnsperhost=8
+http2=true
+tlssessioncache=64
 [[registry."docker.io".keypair]]
 key="key.pem"
 cert="cert.pem"
 
+[registry."123456789012.dkr.ecr.us-east-1.amazonaws.com".workload-identity]
+provider="ecr"
+role-arn="arn:aws:iam::123456789012:role/builder"
+
+[mount-template.ca]
+source="/etc/ssl/certs/corp-ca.pem"
+target="/usr/local/share/ca-certificates/corp-ca.crt"
+auto=true
+[mount-template.pip]
+source="/etc/buildkit/pip.conf"
+target="/etc/pip.conf"
+
+[build-args]
+allow-exclude=["HTTP_PROXY"]
+[build-args.defaults]
+HTTP_PROXY="http://proxy:3128"
+INTERNAL_MIRROR="mirror.example.com"
+
+[download-cache]
+enabled=true
+ttl=300
+max-size=1073741824
+
+[ca-certificates]
+files=["/etc/buildkit/certs/corp-ca.pem"]
+target="/etc/ssl/certs/ca-bundle.crt"
+
+[[output-policy]]
+name="no-secrets"
+deny-paths=["/root/.ssh", "*.pem"]
+[[output-policy]]
+max-size=1048576
+exporters=["image"]
+
 [dns]
 nameservers=["1.1.1.1","8.8.8.8"]
 options=["edns0"]
@@ -85,9 +136,47 @@ searchDomains=["example.com"]
 	require.Equal(t, "overlay", cfg.Workers.OCI.Snapshotter)
 	require.Equal(t, true, cfg.Workers.OCI.Rootless)
 	require.Equal(t, false, *cfg.Workers.OCI.GC)
+	require.Equal(t, "1000:1000", cfg.Workers.OCI.DefaultUser)
+	require.Equal(t, []uint32{1001, 1002}, cfg.Workers.OCI.DefaultGroups)
+	require.Equal(t, true, cfg.Workers.OCI.RejectRoot)
+	require.Equal(t, false, cfg.Workers.Containerd.RejectRoot)
+	require.Equal(t, int64(1000000), cfg.Workers.OCI.MaxCacheRecordSize)
+	require.Equal(t, 0, cfg.Workers.OCI.MaxCacheRecords)
+	require.Equal(t, 2, cfg.Workers.OCI.MaxParallelConversions)
+	require.Equal(t, map[string]int{"zstd": 19}, cfg.Workers.OCI.CompressionLevel)
+	require.True(t, cfg.Workers.OCI.ContentDedup)
+	require.Equal(t, []string{"trivy", "fs", "--format", "spdx-json", "{root}"}, cfg.Workers.OCI.SBOMScanner)
+	require.Equal(t, "", cfg.Workers.OCI.SBOMPredicateType)
+	require.Equal(t, 0, len(cfg.Workers.Containerd.SBOMScanner))
 
 	require.Equal(t, "bar", cfg.Workers.OCI.Labels["foo"])
 	require.Equal(t, "baz", cfg.Workers.OCI.Labels["aa.bb.cc"])
+	require.Equal(t, "/busybox:/usr/bin", cfg.Workers.OCI.DefaultPath["linux"])
+	require.Equal(t, []string{"powershell", "-Command"}, cfg.Workers.OCI.DefaultShell["windows"])
+	require.Equal(t, 0, len(cfg.Workers.Containerd.DefaultPath))
+
+	require.Equal(t, 2, len(cfg.MountTemplates))
+	require.Equal(t, "/etc/ssl/certs/corp-ca.pem", cfg.MountTemplates["ca"].Source)
+	require.Equal(t, "/usr/local/share/ca-certificates/corp-ca.crt", cfg.MountTemplates["ca"].Target)
+	require.Equal(t, true, cfg.MountTemplates["ca"].Auto)
+	require.Equal(t, false, cfg.MountTemplates["pip"].Auto)
+
+	require.Equal(t, map[string]string{"HTTP_PROXY": "http://proxy:3128", "INTERNAL_MIRROR": "mirror.example.com"}, cfg.BuildArgs.Defaults)
+	require.Equal(t, []string{"HTTP_PROXY"}, cfg.BuildArgs.AllowExclude)
+
+	require.Equal(t, true, cfg.DownloadCache.Enabled)
+	require.Equal(t, int64(300), cfg.DownloadCache.TTL)
+	require.Equal(t, int64(1073741824), cfg.DownloadCache.MaxSize)
+
+	require.Equal(t, []string{"/etc/buildkit/certs/corp-ca.pem"}, cfg.CACertificates.Files)
+	require.Equal(t, "/etc/ssl/certs/ca-bundle.crt", cfg.CACertificates.Target)
+	require.Equal(t, false, cfg.CACertificates.DisableMount)
+
+	require.Equal(t, 2, len(cfg.OutputPolicy))
+	require.Equal(t, "no-secrets", cfg.OutputPolicy[0].Name)
+	require.Equal(t, []string{"/root/.ssh", "*.pem"}, cfg.OutputPolicy[0].DenyPaths)
+	require.Equal(t, int64(1048576), cfg.OutputPolicy[1].MaxSize)
+	require.Equal(t, []string{"image"}, cfg.OutputPolicy[1].Exporters)
 
 	require.Nil(t, cfg.Workers.Containerd.Enabled)
 	require.Equal(t, 1, len(cfg.Workers.Containerd.Platforms))
@@ -114,6 +203,14 @@ searchDomains=["example.com"]
 	require.Equal(t, cfg.Registries["docker.io"].TLSConfigDir, []string{"/etc/buildkitd/myregistry"})
 	require.Equal(t, cfg.Registries["docker.io"].KeyPairs[0].Key, "key.pem")
 	require.Equal(t, cfg.Registries["docker.io"].KeyPairs[0].Certificate, "cert.pem")
+	require.Equal(t, *cfg.Registries["docker.io"].MaxIdleConns, 100)
+	require.Nil(t, cfg.Registries["docker.io"].MaxIdleConnsPerHost)
+	require.Equal(t, *cfg.Registries["docker.io"].MaxConnsPerHost, 8)
+	require.Equal(t, *cfg.Registries["docker.io"].HTTP2, true)
+	require.Equal(t, *cfg.Registries["docker.io"].TLSSessionCache, 64)
+	require.Nil(t, cfg.Registries["docker.io"].WorkloadIdentity)
+	require.Equal(t, "ecr", cfg.Registries["123456789012.dkr.ecr.us-east-1.amazonaws.com"].WorkloadIdentity.Provider)
+	require.Equal(t, "arn:aws:iam::123456789012:role/builder", cfg.Registries["123456789012.dkr.ecr.us-east-1.amazonaws.com"].WorkloadIdentity.RoleARN)
 
 	require.NotNil(t, cfg.DNS)
 	require.Equal(t, cfg.DNS.Nameservers, []string{"1.1.1.1", "8.8.8.8"})
@@ -7,6 +7,7 @@ import (
 	"net/http/pprof"
 	"runtime"
 
+	"github.com/moby/buildkit/util/mountusage"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/trace"
 )
@@ -21,6 +22,7 @@ func setupDebugHandlers(addr string) error {
 	m.Handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
 	m.Handle("/debug/requests", http.HandlerFunc(trace.Traces))
 	m.Handle("/debug/events", http.HandlerFunc(trace.Events))
+	m.Handle("/debug/mounts", mountusage.Default.Handler())
 
 	m.Handle("/debug/gc", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		runtime.GC()
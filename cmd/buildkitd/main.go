@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -28,35 +29,51 @@ import (
 	"github.com/gofrs/flock"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/moby/buildkit/cache/remotecache"
+	azblobremotecache "github.com/moby/buildkit/cache/remotecache/azblob"
+	gcsremotecache "github.com/moby/buildkit/cache/remotecache/gcs"
 	"github.com/moby/buildkit/cache/remotecache/gha"
 	inlineremotecache "github.com/moby/buildkit/cache/remotecache/inline"
 	localremotecache "github.com/moby/buildkit/cache/remotecache/local"
 	registryremotecache "github.com/moby/buildkit/cache/remotecache/registry"
+	s3remotecache "github.com/moby/buildkit/cache/remotecache/s3"
 	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/cmd/buildkitd/config"
 	"github.com/moby/buildkit/control"
+	"github.com/moby/buildkit/control/prefetch"
+	"github.com/moby/buildkit/executor"
 	"github.com/moby/buildkit/executor/oci"
+	"github.com/moby/buildkit/executor/remoteexecutor"
+	"github.com/moby/buildkit/exporter/attestation"
+	"github.com/moby/buildkit/exporter/outputpolicy"
 	"github.com/moby/buildkit/frontend"
 	dockerfile "github.com/moby/buildkit/frontend/dockerfile/builder"
 	"github.com/moby/buildkit/frontend/gateway"
 	"github.com/moby/buildkit/frontend/gateway/forwarder"
+	targets "github.com/moby/buildkit/frontend/targets/builder"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/solver/bboltcachestorage"
+	"github.com/moby/buildkit/source/downloadcache"
 	"github.com/moby/buildkit/util/apicaps"
 	"github.com/moby/buildkit/util/appcontext"
 	"github.com/moby/buildkit/util/appdefaults"
 	"github.com/moby/buildkit/util/archutil"
 	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/buildkit/util/compression"
 	"github.com/moby/buildkit/util/grpcerrors"
+	"github.com/moby/buildkit/util/netcheck"
 	"github.com/moby/buildkit/util/profiler"
+	"github.com/moby/buildkit/util/push"
 	"github.com/moby/buildkit/util/resolver"
+	"github.com/moby/buildkit/util/selfcheck"
 	"github.com/moby/buildkit/util/stack"
+	"github.com/moby/buildkit/util/system"
 	"github.com/moby/buildkit/util/tracing/detect"
 	_ "github.com/moby/buildkit/util/tracing/detect/jaeger"
 	_ "github.com/moby/buildkit/util/tracing/env"
 	"github.com/moby/buildkit/util/tracing/transform"
 	"github.com/moby/buildkit/version"
 	"github.com/moby/buildkit/worker"
+	"github.com/moby/buildkit/worker/base"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -88,10 +105,17 @@ type workerInitializerOpt struct {
 	configMetaData *toml.MetaData
 	sessionManager *session.Manager
 	traceSocket    string
+	downloadCache  *downloadcache.Cache
+	// caCertificates is the mount template of the CA bundle, nil if there
+	// are no additional CAs
+	caCertificates *executor.MountTemplate
 }
 
 type workerInitializer struct {
 	fn func(c *cli.Context, common workerInitializerOpt) ([]worker.Worker, error)
+	// selfCheck returns the environment to validate for the worker, or nil if
+	// the worker is disabled
+	selfCheck func(c *cli.Context, cfg *config.Config) (*selfcheck.Opt, error)
 	// less priority number, more preferred
 	priority int
 }
@@ -170,6 +194,18 @@ func main() {
 			Usage: "group (name or gid) which will own all Unix socket listening addresses",
 			Value: groupValue(defaultConf.GRPC.GID),
 		},
+		cli.StringFlag{
+			Name:  "debug-record-dir",
+			Usage: "record all solve requests to the directory for replaying them with buildctl debug replay",
+		},
+		cli.BoolFlag{
+			Name:  "experimental-options",
+			Usage: "accept exporter and frontend attributes that are marked experimental",
+		},
+		cli.BoolFlag{
+			Name:  "check",
+			Usage: "validate the environment, print a report and exit",
+		},
 		cli.StringFlag{
 			Name:  "debugaddr",
 			Usage: "debugging address (eg. 0.0.0.0:6060)",
@@ -251,6 +287,10 @@ func main() {
 			return errors.Wrapf(err, "failed to create %s", root)
 		}
 
+		if c.GlobalBool("check") {
+			return runSelfCheck(ctx, c, &cfg)
+		}
+
 		lockPath := filepath.Join(root, "buildkitd.lock")
 		lock := flock.New(lockPath)
 		locked, err := lock.TryLock()
@@ -269,6 +309,7 @@ func main() {
 		if err != nil {
 			return err
 		}
+		defer controller.Close()
 
 		controller.Register(server)
 
@@ -462,6 +503,14 @@ func applyMainFlags(c *cli.Context, cfg *config.Config, md *toml.MetaData) error
 		cfg.GRPC.DebugAddress = c.String("debugaddr")
 	}
 
+	if c.IsSet("debug-record-dir") {
+		cfg.DebugRecordDir = c.String("debug-record-dir")
+	}
+
+	if c.IsSet("experimental-options") {
+		cfg.ExperimentalOptions = c.Bool("experimental-options")
+	}
+
 	if md == nil || !md.IsDefined("grpc", "uid") {
 		cfg.GRPC.UID = os.Getuid()
 	}
@@ -632,11 +681,29 @@ func newController(c *cli.Context, cfg *config.Config, md *toml.MetaData) (*cont
 		}
 	}
 
+	// the http source and the remote caches use the default transport
+	if tr, ok := http.DefaultTransport.(*http.Transport); ok {
+		tr.DialContext = netcheck.Dialer(30*time.Second, 30*time.Second).DialContext
+	}
+
+	downloadCache, err := getDownloadCache(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	tr, _ := http.DefaultTransport.(*http.Transport)
+	caCertificates, err := setupCACertificates(cfg, tr)
+	if err != nil {
+		return nil, err
+	}
+
 	wc, err := newWorkerController(c, workerInitializerOpt{
 		config:         cfg,
 		configMetaData: md,
 		sessionManager: sessionManager,
 		traceSocket:    traceSocket,
+		downloadCache:  downloadCache,
+		caCertificates: caCertificates,
 	})
 	if err != nil {
 		return nil, err
@@ -644,12 +711,18 @@ func newController(c *cli.Context, cfg *config.Config, md *toml.MetaData) (*cont
 	frontends := map[string]frontend.Frontend{}
 	frontends["dockerfile.v0"] = forwarder.NewGatewayForwarder(wc, dockerfile.Build)
 	frontends["gateway.v0"] = gateway.NewGatewayFrontend(wc)
+	frontends["targets.v0"] = forwarder.NewGatewayForwarder(wc, targets.Build)
 
 	cacheStorage, err := bboltcachestorage.NewStore(filepath.Join(cfg.Root, "cache.db"))
 	if err != nil {
 		return nil, err
 	}
 
+	workerCredentials, err := resolver.NewWorkerCredentials(cfg.Registries)
+	if err != nil {
+		return nil, err
+	}
+	resolver.DefaultPool.SetWorkerCredentials(workerCredentials)
 	resolverFn := resolverFunc(cfg)
 
 	w, err := wc.GetDefault()
@@ -662,11 +735,42 @@ func newController(c *cli.Context, cfg *config.Config, md *toml.MetaData) (*cont
 		"local":    localremotecache.ResolveCacheExporterFunc(sessionManager),
 		"inline":   inlineremotecache.ResolveCacheExporterFunc(),
 		"gha":      gha.ResolveCacheExporterFunc(),
+		"s3":       s3remotecache.ResolveCacheExporterFunc(),
+		"gcs":      gcsremotecache.ResolveCacheExporterFunc(),
+		"azblob":   azblobremotecache.ResolveCacheExporterFunc(),
 	}
 	remoteCacheImporterFuncs := map[string]remotecache.ResolveCacheImporterFunc{
 		"registry": registryremotecache.ResolveCacheImporterFunc(sessionManager, w.ContentStore(), resolverFn),
 		"local":    localremotecache.ResolveCacheImporterFunc(sessionManager),
 		"gha":      gha.ResolveCacheImporterFunc(),
+		"s3":       s3remotecache.ResolveCacheImporterFunc(),
+		"gcs":      gcsremotecache.ResolveCacheImporterFunc(),
+		"azblob":   azblobremotecache.ResolveCacheImporterFunc(),
+	}
+
+	selfCheck, err := selfCheckOpt(c, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	outputPolicy, err := getOutputPolicy(cfg.OutputPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	var prefetcher *prefetch.Prefetcher
+	if bw, ok := w.(*base.Worker); ok {
+		prefetcher, err = prefetch.New(prefetch.Opt{
+			StatePath:     filepath.Join(cfg.Root, "expected-builds.json"),
+			ContentStore:  w.ContentStore(),
+			LeaseManager:  bw.LeaseManager,
+			RegistryHosts: resolverFn,
+			Credentials:   workerCredentials,
+			Platform:      platforms.Normalize(w.Platforms(false)[0]),
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return control.NewController(control.Opt{
@@ -678,6 +782,17 @@ func newController(c *cli.Context, cfg *config.Config, md *toml.MetaData) (*cont
 		CacheKeyStorage:           cacheStorage,
 		Entitlements:              cfg.Entitlements,
 		TraceCollector:            tc,
+		SelfCheck:                 selfCheck,
+		SolveRecordDir:            cfg.DebugRecordDir,
+		SolveRecordKeepDuration:   time.Duration(cfg.DebugRecordKeepDuration) * time.Second,
+		SolveRecordMaxSize:        cfg.DebugRecordMaxSize,
+		NetcheckEndpoints:         append(append([]string{}, netcheck.DefaultEndpoints...), resolver.Endpoints(cfg.Registries)...),
+		RegistryHosts:             resolverFn,
+		DefaultBuildArgs:          cfg.BuildArgs.Defaults,
+		ExcludableBuildArgs:       cfg.BuildArgs.AllowExclude,
+		Prefetcher:                prefetcher,
+		ExperimentalOptions:       cfg.ExperimentalOptions,
+		OutputPolicy:              outputPolicy,
 	})
 }
 
@@ -715,6 +830,42 @@ func newWorkerController(c *cli.Context, wiOpt workerInitializerOpt) (*worker.Co
 	return wc, nil
 }
 
+// selfCheckOpt returns the environment to validate for the preferred
+// enabled worker
+func selfCheckOpt(c *cli.Context, cfg *config.Config) (*selfcheck.Opt, error) {
+	for _, wi := range workerInitializers {
+		if wi.selfCheck == nil {
+			continue
+		}
+		opt, err := wi.selfCheck(c, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if opt != nil {
+			return opt, nil
+		}
+	}
+	return nil, nil
+}
+
+func runSelfCheck(ctx context.Context, c *cli.Context, cfg *config.Config) error {
+	opt, err := selfCheckOpt(c, cfg)
+	if err != nil {
+		return err
+	}
+	if opt == nil {
+		return errors.New("no worker found, rebuild the buildkit daemon?")
+	}
+	results := selfcheck.Run(ctx, *opt)
+	if err := selfcheck.PrintReport(os.Stdout, results); err != nil {
+		return err
+	}
+	if selfcheck.Failed(results) {
+		return errors.New("environment check failed")
+	}
+	return nil
+}
+
 func attrMap(sl []string) (map[string]string, error) {
 	m := map[string]string{}
 	for _, v := range sl {
@@ -778,6 +929,142 @@ func getDNSConfig(cfg *config.DNSConfig) *oci.DNSConfig {
 	return dns
 }
 
+func getDefaults(cfg config.DefaultsConfig) system.Defaults {
+	return system.Defaults{
+		PathEnv: cfg.DefaultPath,
+		Shell:   cfg.DefaultShell,
+	}
+}
+
+func getSBOMScanner(cfg config.AttestationConfig) attestation.Scanner {
+	if len(cfg.SBOMScanner) == 0 {
+		return nil
+	}
+	return &attestation.CommandScanner{
+		Args:          cfg.SBOMScanner,
+		PredicateType: cfg.SBOMPredicateType,
+	}
+}
+
+func getMountTemplates(cfg map[string]config.MountTemplateConfig, caCertificates *executor.MountTemplate) ([]executor.MountTemplate, error) {
+	var templates []executor.MountTemplate
+	if caCertificates != nil {
+		templates = append(templates, *caCertificates)
+	}
+	for name, t := range cfg {
+		if t.Source == "" || t.Target == "" {
+			return nil, errors.Errorf("mount template %s requires source and target", name)
+		}
+		if !filepath.IsAbs(t.Target) {
+			return nil, errors.Errorf("target %s of mount template %s is not an absolute path", t.Target, name)
+		}
+		if _, err := os.Stat(t.Source); err != nil {
+			return nil, errors.Wrapf(err, "invalid source of mount template %s", name)
+		}
+		templates = append(templates, executor.MountTemplate{
+			Name:   name,
+			Source: t.Source,
+			Dest:   t.Target,
+			Auto:   t.Auto,
+		})
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
+
+func getOutputPolicy(cfg []config.OutputPolicyRule) (*outputpolicy.Policy, error) {
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+	p := &outputpolicy.Policy{}
+	for i, r := range cfg {
+		rule := outputpolicy.Rule{
+			Name:      r.Name,
+			DenyPaths: r.DenyPaths,
+			MaxSize:   r.MaxSize,
+			Exporters: r.Exporters,
+		}
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		p.Rules = append(p.Rules, rule)
+	}
+	return p, nil
+}
+
+func getDownloadCache(cfg *config.Config) (*downloadcache.Cache, error) {
+	if !cfg.DownloadCache.Enabled {
+		return nil, nil
+	}
+	return downloadcache.New(downloadcache.Opt{
+		Root:          filepath.Join(cfg.Root, "downloads"),
+		TTL:           time.Duration(cfg.DownloadCache.TTL) * time.Second,
+		MaxSize:       cfg.DownloadCache.MaxSize,
+		CacheResolved: cfg.DownloadCache.GitRefs,
+	})
+}
+
+func getCompressionLevels(cfg config.CompressionConfig) (map[compression.Type]int, error) {
+	if len(cfg.CompressionLevel) == 0 {
+		return nil, nil
+	}
+	levels := make(map[compression.Type]int, len(cfg.CompressionLevel))
+	for k, v := range cfg.CompressionLevel {
+		t, err := compression.Parse(k)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid compression-level")
+		}
+		levels[t] = v
+	}
+	return levels, nil
+}
+
+func getPushOpt(cfg config.PushConfig) push.Opt {
+	return push.Opt{
+		Concurrency: cfg.PushConcurrency,
+		ChunkSize:   cfg.PushChunkSize,
+	}
+}
+
+func getRemoteExecutor(cfg config.RemoteExecutorConfig, local executor.Executor) (executor.Executor, error) {
+	if cfg.Address == "" {
+		return local, nil
+	}
+	opt := remoteexecutor.Opt{
+		Address:  cfg.Address,
+		Fallback: cfg.Fallback,
+	}
+	// tcp connections verify the service with the system roots by default
+	if strings.HasPrefix(cfg.Address, "tcp://") || cfg.TLS.Cert != "" || cfg.TLS.Key != "" || cfg.TLS.CA != "" {
+		tlsConf := &tls.Config{}
+		if cfg.TLS.Cert != "" || cfg.TLS.Key != "" {
+			certificate, err := tls.LoadX509KeyPair(cfg.TLS.Cert, cfg.TLS.Key)
+			if err != nil {
+				return nil, errors.Wrap(err, "could not load remote executor client key pair")
+			}
+			tlsConf.Certificates = []tls.Certificate{certificate}
+		}
+		if cfg.TLS.CA != "" {
+			certPool := x509.NewCertPool()
+			ca, err := ioutil.ReadFile(cfg.TLS.CA)
+			if err != nil {
+				return nil, errors.Wrap(err, "could not read remote executor ca certificate")
+			}
+			if ok := certPool.AppendCertsFromPEM(ca); !ok {
+				return nil, errors.New("failed to append remote executor ca cert")
+			}
+			tlsConf.RootCAs = certPool
+		}
+		opt.TLS = tlsConf
+	}
+	return remoteexecutor.New(opt, local)
+}
+
 func runTraceController(p string, exp sdktrace.SpanExporter) error {
 	server := grpc.NewServer()
 	tracev1.RegisterTraceServiceServer(server, &traceCollector{exporter: exp})
@@ -10,9 +10,12 @@ import (
 	"time"
 
 	ctd "github.com/containerd/containerd"
+	"github.com/moby/buildkit/cache"
 	"github.com/moby/buildkit/cmd/buildkitd/config"
+	"github.com/moby/buildkit/executor/oci"
 	"github.com/moby/buildkit/util/network/cniprovider"
 	"github.com/moby/buildkit/util/network/netproviders"
+	"github.com/moby/buildkit/util/selfcheck"
 	"github.com/moby/buildkit/worker"
 	"github.com/moby/buildkit/worker/base"
 	"github.com/moby/buildkit/worker/containerd"
@@ -124,7 +127,8 @@ func init() {
 
 	registerWorkerInitializer(
 		workerInitializer{
-			fn: containerdWorkerInitializer,
+			fn:        containerdWorkerInitializer,
+			selfCheck: containerdSelfCheckOpt,
 			// 1 is less preferred than 0 (runcCtor)
 			priority: 1,
 		},
@@ -205,6 +209,25 @@ func applyContainerdFlags(c *cli.Context, cfg *config.Config) error {
 	return nil
 }
 
+// containerdSelfCheckOpt skips the snapshotter checks as snapshots are
+// managed by containerd
+func containerdSelfCheckOpt(c *cli.Context, cfg *config.Config) (*selfcheck.Opt, error) {
+	if err := applyContainerdFlags(c, cfg); err != nil {
+		return nil, err
+	}
+
+	cc := cfg.Workers.Containerd
+	if (cc.Enabled == nil && !validContainerdSocket(cc.Address)) || (cc.Enabled != nil && !*cc.Enabled) {
+		return nil, nil
+	}
+	return &selfcheck.Opt{
+		Root:          cfg.Root,
+		NetworkMode:   cc.NetworkConfig.Mode,
+		CNIConfigPath: cc.CNIConfigPath,
+		CNIBinaryDir:  cc.CNIBinaryPath,
+	}, nil
+}
+
 func containerdWorkerInitializer(c *cli.Context, common workerInitializerOpt) ([]worker.Worker, error) {
 	if err := applyContainerdFlags(c, common.config); err != nil {
 		return nil, err
@@ -236,12 +259,45 @@ func containerdWorkerInitializer(c *cli.Context, common workerInitializerOpt) ([
 	if cfg.Snapshotter != "" {
 		snapshotter = cfg.Snapshotter
 	}
-	opt, err := containerd.NewWorkerOpt(common.config.Root, cfg.Address, snapshotter, cfg.Namespace, cfg.Labels, dns, nc, common.config.Workers.Containerd.ApparmorProfile, parallelismSem, common.traceSocket, ctd.WithTimeout(60*time.Second))
+	opt, err := containerd.NewWorkerOpt(common.config.Root, cfg.Address, snapshotter, cfg.Namespace, cfg.Labels, dns, nc, common.config.Workers.Containerd.ApparmorProfile, parallelismSem, common.traceSocket, cfg.Differ, ctd.WithTimeout(60*time.Second))
 	if err != nil {
 		return nil, err
 	}
 	opt.GCPolicy = getGCPolicy(cfg.GCConfig, common.config.Root)
 	opt.RegistryHosts = resolverFunc(common.config)
+	opt.Executor = oci.WithUserPolicy(opt.Executor, oci.UserPolicy{
+		DefaultUser:   cfg.DefaultUser,
+		DefaultGroups: cfg.DefaultGroups,
+		RejectRoot:    cfg.RejectRoot,
+	})
+	opt.MaxCacheRecords = cfg.MaxCacheRecords
+	opt.MaxCacheRecordSize = cfg.MaxCacheRecordSize
+	opt.MaxParallelConversions = cfg.MaxParallelConversions
+	if opt.CompressionLevels, err = getCompressionLevels(cfg.CompressionConfig); err != nil {
+		return nil, err
+	}
+	opt.VerifyBlobsInterval = time.Duration(cfg.VerifyBlobsInterval) * time.Second
+	if opt.FinalizePolicy, err = cache.ParseFinalizePolicy(cfg.FinalizePolicy); err != nil {
+		return nil, err
+	}
+	opt.MinFreeSpace = cfg.MinFreeSpace
+	// the snapshots and content are stored by containerd, buildkitd's root
+	// only has the metadata of the cache
+	opt.FreeSpacePaths = append(opt.FreeSpacePaths, common.config.Root)
+	opt.SBOMScanner = getSBOMScanner(cfg.AttestationConfig)
+	opt.PushOpt = getPushOpt(cfg.PushConfig)
+	opt.ExportContainerdAddresses = cfg.ExportContainerdAddresses
+	opt.ExportContainerdNamespaces = cfg.ExportContainerdNamespaces
+	opt.DownloadCache = common.downloadCache
+	if opt.MountTemplates, err = getMountTemplates(common.config.MountTemplates, common.caCertificates); err != nil {
+		return nil, err
+	}
+	if opt.Executor, err = getRemoteExecutor(cfg.RemoteExecutor, opt.Executor); err != nil {
+		return nil, err
+	}
+	for k, v := range getDefaults(cfg.DefaultsConfig).Labels() {
+		opt.Labels[k] = v
+	}
 
 	if platformsStr := cfg.Platforms; len(platformsStr) != 0 {
 		platforms, err := parsePlatforms(platformsStr)
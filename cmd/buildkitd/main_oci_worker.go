@@ -29,12 +29,14 @@ import (
 	sgzconf "github.com/containerd/stargz-snapshotter/fs/config"
 	sgzsource "github.com/containerd/stargz-snapshotter/fs/source"
 	remotesn "github.com/containerd/stargz-snapshotter/snapshot"
+	"github.com/moby/buildkit/cache"
 	"github.com/moby/buildkit/cmd/buildkitd/config"
 	"github.com/moby/buildkit/executor/oci"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/util/network/cniprovider"
 	"github.com/moby/buildkit/util/network/netproviders"
 	"github.com/moby/buildkit/util/resolver"
+	"github.com/moby/buildkit/util/selfcheck"
 	"github.com/moby/buildkit/worker"
 	"github.com/moby/buildkit/worker/base"
 	"github.com/moby/buildkit/worker/runc"
@@ -75,6 +77,10 @@ func init() {
 			Usage: "name of snapshotter (overlayfs, native, etc.)",
 			Value: defaultConf.Workers.OCI.Snapshotter,
 		},
+		cli.StringFlag{
+			Name:  "oci-worker-snapshotter-migrate-from",
+			Usage: "name of a previously used snapshotter to migrate the existing cache from",
+		},
 		cli.StringFlag{
 			Name:  "oci-worker-proxy-snapshotter-path",
 			Usage: "address of proxy snapshotter socket (do not include 'unix://' prefix)",
@@ -150,8 +156,9 @@ func init() {
 
 	registerWorkerInitializer(
 		workerInitializer{
-			fn:       ociWorkerInitializer,
-			priority: 0,
+			fn:        ociWorkerInitializer,
+			selfCheck: ociSelfCheckOpt,
+			priority:  0,
 		},
 		flags...,
 	)
@@ -184,6 +191,9 @@ func applyOCIFlags(c *cli.Context, cfg *config.Config) error {
 	if c.GlobalIsSet("oci-worker-snapshotter") {
 		cfg.Workers.OCI.Snapshotter = c.GlobalString("oci-worker-snapshotter")
 	}
+	if c.GlobalIsSet("oci-worker-snapshotter-migrate-from") {
+		cfg.Workers.OCI.SnapshotterMigrateFrom = c.GlobalString("oci-worker-snapshotter-migrate-from")
+	}
 
 	if c.GlobalIsSet("rootless") || c.GlobalBool("rootless") {
 		cfg.Workers.OCI.Rootless = c.GlobalBool("rootless")
@@ -232,6 +242,26 @@ func applyOCIFlags(c *cli.Context, cfg *config.Config) error {
 	return nil
 }
 
+func ociSelfCheckOpt(c *cli.Context, cfg *config.Config) (*selfcheck.Opt, error) {
+	if err := applyOCIFlags(c, cfg); err != nil {
+		return nil, err
+	}
+
+	oc := cfg.Workers.OCI
+	if (oc.Enabled == nil && !validOCIBinary()) || (oc.Enabled != nil && !*oc.Enabled) {
+		return nil, nil
+	}
+	return &selfcheck.Opt{
+		Root:          cfg.Root,
+		Snapshotter:   oc.Snapshotter,
+		NetworkMode:   oc.NetworkConfig.Mode,
+		CNIConfigPath: oc.CNIConfigPath,
+		CNIBinaryDir:  oc.CNIBinaryPath,
+		Rootless:      oc.Rootless,
+		UserRemap:     oc.UserRemapUnsupported != "",
+	}, nil
+}
+
 func ociWorkerInitializer(c *cli.Context, common workerInitializerOpt) ([]worker.Worker, error) {
 	if err := applyOCIFlags(c, common.config); err != nil {
 		return nil, err
@@ -255,6 +285,19 @@ func ociWorkerInitializer(c *cli.Context, common workerInitializerOpt) ([]worker
 		return nil, err
 	}
 
+	if from := cfg.SnapshotterMigrateFrom; from != "" && from != snFactory.Name {
+		srcCfg := cfg
+		srcCfg.Snapshotter = from
+		srcCfg.ProxySnapshotterPath = ""
+		srcFactory, err := snapshotterFactory(common.config.Root, srcCfg, common.sessionManager, hosts, common.configMetaData)
+		if err != nil {
+			return nil, err
+		}
+		if err := runc.MigrateSnapshotter(context.TODO(), common.config.Root, srcFactory, snFactory); err != nil {
+			return nil, err
+		}
+	}
+
 	if cfg.Rootless {
 		logrus.Debugf("running in rootless mode")
 		if common.config.Workers.OCI.NetworkConfig.Mode == "auto" {
@@ -287,12 +330,42 @@ func ociWorkerInitializer(c *cli.Context, common workerInitializerOpt) ([]worker
 		parallelismSem = semaphore.NewWeighted(int64(cfg.MaxParallelism))
 	}
 
-	opt, err := runc.NewWorkerOpt(common.config.Root, snFactory, cfg.Rootless, processMode, cfg.Labels, idmapping, nc, dns, cfg.Binary, cfg.ApparmorProfile, parallelismSem, common.traceSocket)
+	opt, err := runc.NewWorkerOpt(common.config.Root, snFactory, cfg.Rootless, processMode, cfg.Labels, idmapping, nc, dns, cfg.Binary, cfg.ApparmorProfile, parallelismSem, common.traceSocket, time.Duration(cfg.CheckpointInterval)*time.Second, cfg.ContentDedup, cfg.Differ)
 	if err != nil {
 		return nil, err
 	}
 	opt.GCPolicy = getGCPolicy(cfg.GCConfig, common.config.Root)
 	opt.RegistryHosts = hosts
+	opt.Executor = oci.WithUserPolicy(opt.Executor, oci.UserPolicy{
+		DefaultUser:   cfg.DefaultUser,
+		DefaultGroups: cfg.DefaultGroups,
+		RejectRoot:    cfg.RejectRoot,
+	})
+	opt.MaxCacheRecords = cfg.MaxCacheRecords
+	opt.MaxCacheRecordSize = cfg.MaxCacheRecordSize
+	opt.MaxParallelConversions = cfg.MaxParallelConversions
+	if opt.CompressionLevels, err = getCompressionLevels(cfg.CompressionConfig); err != nil {
+		return nil, err
+	}
+	opt.VerifyBlobsInterval = time.Duration(cfg.VerifyBlobsInterval) * time.Second
+	if opt.FinalizePolicy, err = cache.ParseFinalizePolicy(cfg.FinalizePolicy); err != nil {
+		return nil, err
+	}
+	opt.MinFreeSpace = cfg.MinFreeSpace
+	opt.FreeSpacePaths = []string{common.config.Root}
+	opt.SBOMScanner = getSBOMScanner(cfg.AttestationConfig)
+	opt.PushOpt = getPushOpt(cfg.PushConfig)
+	opt.ExportContainerdAddresses = cfg.ExportContainerdAddresses
+	opt.DownloadCache = common.downloadCache
+	if opt.MountTemplates, err = getMountTemplates(common.config.MountTemplates, common.caCertificates); err != nil {
+		return nil, err
+	}
+	if opt.Executor, err = getRemoteExecutor(cfg.RemoteExecutor, opt.Executor); err != nil {
+		return nil, err
+	}
+	for k, v := range getDefaults(cfg.DefaultsConfig).Labels() {
+		opt.Labels[k] = v
+	}
 
 	if platformsStr := cfg.Platforms; len(platformsStr) != 0 {
 		platforms, err := parsePlatforms(platformsStr)
@@ -355,6 +428,20 @@ func snapshotterFactory(commonRoot string, cfg config.OCIConfig, sm *session.Man
 			}
 		}
 		logrus.Infof("auto snapshotter: using %s", name)
+	} else {
+		// detect explicitly configured snapshotters that can't work on the state
+		// directory, e.g. overlayfs on a backing filesystem that doesn't support it
+		var err error
+		switch name {
+		case "overlayfs":
+			err = overlayutils.Supported(commonRoot)
+		case "fuse-overlayfs":
+			err = fuseoverlayfs.Supported(commonRoot)
+		}
+		if err != nil {
+			logrus.Warnf("snapshotter %s is not available for %s, falling back to native: %v", name, commonRoot, err)
+			name = "native"
+		}
 	}
 
 	snFactory := runc.SnapshotterFactory{
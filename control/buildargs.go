@@ -0,0 +1,63 @@
+package control
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	buildArgPrefix = "build-arg:"
+	// frontendOptExcludeBuildArgs is the frontend attr with the comma
+	// separated names of the default build args not to add to a solve
+	frontendOptExcludeBuildArgs = "exclude-default-build-args"
+)
+
+// withDefaultBuildArgs adds the default build args of the daemon to the
+// frontend attrs that don't set them already, so that build args of the
+// client take precedence. Args can only be excluded if allowExclude contains
+// their name or "*".
+func withDefaultBuildArgs(attrs map[string]string, defaults map[string]string, allowExclude []string) (map[string]string, error) {
+	var exclude []string
+	for _, name := range strings.Split(attrs[frontendOptExcludeBuildArgs], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			exclude = append(exclude, name)
+		}
+	}
+	if len(defaults) == 0 && len(exclude) == 0 {
+		return attrs, nil
+	}
+
+	excluded := make(map[string]struct{}, len(exclude))
+	for _, name := range exclude {
+		if !containsString(allowExclude, name) && !containsString(allowExclude, "*") {
+			return nil, errors.Errorf("default build arg %s can't be excluded, it is not allowed by the daemon config", name)
+		}
+		excluded[name] = struct{}{}
+	}
+
+	out := make(map[string]string, len(attrs)+len(defaults))
+	for k, v := range attrs {
+		if k != frontendOptExcludeBuildArgs {
+			out[k] = v
+		}
+	}
+	for name, v := range defaults {
+		if _, ok := excluded[name]; ok {
+			continue
+		}
+		if _, ok := out[buildArgPrefix+name]; !ok {
+			out[buildArgPrefix+name] = v
+		}
+	}
+	return out, nil
+}
+
+func containsString(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
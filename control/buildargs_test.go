@@ -0,0 +1,44 @@
+package control
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDefaultBuildArgs(t *testing.T) {
+	defaults := map[string]string{
+		"HTTP_PROXY":      "http://proxy:3128",
+		"INTERNAL_MIRROR": "mirror.example.com",
+	}
+
+	attrs, err := withDefaultBuildArgs(map[string]string{
+		"build-arg:HTTP_PROXY": "",
+		"build-arg:FOO":        "bar",
+	}, defaults, nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"build-arg:HTTP_PROXY":      "",
+		"build-arg:FOO":             "bar",
+		"build-arg:INTERNAL_MIRROR": "mirror.example.com",
+	}, attrs)
+
+	attrs, err = withDefaultBuildArgs(map[string]string{
+		"exclude-default-build-args": "HTTP_PROXY",
+	}, defaults, []string{"HTTP_PROXY"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"build-arg:INTERNAL_MIRROR": "mirror.example.com",
+	}, attrs)
+
+	_, err = withDefaultBuildArgs(map[string]string{
+		"exclude-default-build-args": "INTERNAL_MIRROR",
+	}, defaults, []string{"HTTP_PROXY"})
+	require.Error(t, err)
+
+	attrs, err = withDefaultBuildArgs(map[string]string{
+		"exclude-default-build-args": "HTTP_PROXY,INTERNAL_MIRROR",
+	}, defaults, []string{"*"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{}, attrs)
+}
@@ -0,0 +1,31 @@
+package control
+
+import (
+	"testing"
+
+	"github.com/moby/buildkit/util/compression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCacheExportCompression(t *testing.T) {
+	comp, err := parseCacheExportCompression("registry", map[string]string{
+		"compression":       "zstd",
+		"force-compression": "true",
+		"compression-level": "3",
+	})
+	require.NoError(t, err)
+	require.Equal(t, compression.Zstd, comp.Type)
+	require.True(t, comp.Force)
+	require.Equal(t, 3, *comp.Level)
+
+	_, err = parseCacheExportCompression("registry", map[string]string{"compression": "nydus"})
+	require.Error(t, err)
+
+	_, err = parseCacheExportCompression("inline", map[string]string{})
+	require.NoError(t, err)
+	for _, k := range []string{"compression", "force-compression", "compression-level"} {
+		_, err = parseCacheExportCompression("inline", map[string]string{k: "1"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not supported for inline cache")
+	}
+}
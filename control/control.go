@@ -2,10 +2,13 @@ package control
 
 import (
 	"context"
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/containerd/containerd/remotes/docker"
 	"github.com/moby/buildkit/util/bklog"
 
 	controlapi "github.com/moby/buildkit/api/services/control"
@@ -13,14 +16,24 @@ import (
 	"github.com/moby/buildkit/cache/remotecache"
 	"github.com/moby/buildkit/client"
 	controlgateway "github.com/moby/buildkit/control/gateway"
+	"github.com/moby/buildkit/control/prefetch"
 	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/exporter/outputpolicy"
 	"github.com/moby/buildkit/frontend"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/session/grpchijack"
 	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/solver/errdefs"
 	"github.com/moby/buildkit/solver/llbsolver"
+	llberrdefs "github.com/moby/buildkit/solver/llbsolver/errdefs"
 	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/compression"
 	"github.com/moby/buildkit/util/imageutil"
+	"github.com/moby/buildkit/util/optionstatus"
+	"github.com/moby/buildkit/util/push"
+	"github.com/moby/buildkit/util/selfcheck"
+	"github.com/moby/buildkit/util/solverecord"
 	"github.com/moby/buildkit/util/throttle"
 	"github.com/moby/buildkit/util/tracing/transform"
 	"github.com/moby/buildkit/worker"
@@ -42,6 +55,39 @@ type Opt struct {
 	ResolveCacheImporterFuncs map[string]remotecache.ResolveCacheImporterFunc
 	Entitlements              []string
 	TraceCollector            sdktrace.SpanExporter
+	// SelfCheck describes the environment validated by the Check RPC. The
+	// RPC returns no results if nil.
+	SelfCheck *selfcheck.Opt
+	// SolveRecordDir is a directory that every solve request is recorded to
+	// for replaying it with `buildctl debug replay`. Requests are not
+	// recorded if empty.
+	SolveRecordDir string
+	// SolveRecordKeepDuration and SolveRecordMaxSize limit the age and the
+	// total size of the records in SolveRecordDir. Defaults to
+	// solverecord.DefaultKeepDuration and solverecord.DefaultMaxSize.
+	SolveRecordKeepDuration time.Duration
+	SolveRecordMaxSize      int64
+	// NetcheckEndpoints are the host:port endpoints the Netcheck RPC may
+	// check. The RPC checks only netcheck.DefaultEndpoints if empty.
+	NetcheckEndpoints []string
+	// RegistryHosts configures the registries of the Tag RPC
+	RegistryHosts docker.RegistryHosts
+	// DefaultBuildArgs are added to the build args of every solve that
+	// doesn't set them
+	DefaultBuildArgs map[string]string
+	// ExcludableBuildArgs are the names of the DefaultBuildArgs that clients
+	// can exclude from a solve, "*" for all of them
+	ExcludableBuildArgs []string
+	// Prefetcher keeps the builds of the RegisterExpectedBuilds RPC and
+	// prefetches their content while no builds run. The RPC is not supported
+	// if nil.
+	Prefetcher *prefetch.Prefetcher
+	// ExperimentalOptions accepts the exporter and frontend attributes that
+	// are marked experimental in the optionstatus registry
+	ExperimentalOptions bool
+	// OutputPolicy is verified on the results of solves before they are
+	// exported
+	OutputPolicy *outputpolicy.Policy
 }
 
 type Controller struct { // TODO: ControlService
@@ -54,6 +100,8 @@ type Controller struct { // TODO: ControlService
 	gatewayForwarder *controlgateway.GatewayForwarder
 	throttledGC      func()
 	gcmu             sync.Mutex
+	dedup            *solveDedup
+	stopPrefetch     func()
 }
 
 func NewController(opt Opt) (*Controller, error) {
@@ -61,7 +109,7 @@ func NewController(opt Opt) (*Controller, error) {
 
 	gatewayForwarder := controlgateway.NewGatewayForwarder()
 
-	solver, err := llbsolver.New(opt.WorkerController, opt.Frontends, cache, opt.ResolveCacheImporterFuncs, gatewayForwarder, opt.SessionManager, opt.Entitlements)
+	solver, err := llbsolver.New(opt.WorkerController, opt.Frontends, cache, opt.ResolveCacheImporterFuncs, gatewayForwarder, opt.SessionManager, opt.Entitlements, opt.ExperimentalOptions)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create solver")
 	}
@@ -71,9 +119,25 @@ func NewController(opt Opt) (*Controller, error) {
 		solver:           solver,
 		cache:            cache,
 		gatewayForwarder: gatewayForwarder,
+		dedup:            newSolveDedup(),
 	}
 	c.throttledGC = throttle.After(time.Minute, c.gc)
 
+	if opt.Prefetcher != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			opt.Prefetcher.Run(ctx, prefetch.Interval, func() bool {
+				return atomic.LoadInt64(&c.buildCount) == 0
+			})
+		}()
+		c.stopPrefetch = func() {
+			cancel()
+			<-done
+		}
+	}
+
 	defer func() {
 		time.AfterFunc(time.Second, c.throttledGC)
 	}()
@@ -81,6 +145,14 @@ func NewController(opt Opt) (*Controller, error) {
 	return c, nil
 }
 
+// Close stops the background prefetching of the controller
+func (c *Controller) Close() error {
+	if c.stopPrefetch != nil {
+		c.stopPrefetch()
+	}
+	return nil
+}
+
 func (c *Controller) Register(server *grpc.Server) error {
 	controlapi.RegisterControlServer(server, c)
 	c.gatewayForwarder.Register(server)
@@ -235,17 +307,54 @@ func translateLegacySolveRequest(req *controlapi.SolveRequest) error {
 }
 
 func (c *Controller) Solve(ctx context.Context, req *controlapi.SolveRequest) (*controlapi.SolveResponse, error) {
+	if err := translateLegacySolveRequest(req); err != nil {
+		return nil, err
+	}
+
+	var sharedKey string
+	if caller, err := c.opt.SessionManager.Get(ctx, req.Session, true); err == nil && caller != nil {
+		sharedKey = caller.SharedKey()
+	}
+	key, err := dedupKey(req, sharedKey)
+	if err != nil {
+		return nil, err
+	}
+	var resp *controlapi.SolveResponse
+	if key != "" {
+		resp, err = c.dedupSolve(ctx, key, req)
+	} else {
+		resp, err = c.solve(ctx, req)
+	}
+	// the clients get the code of the class of the failure
+	return resp, llberrdefs.WithErrorCode(err)
+}
+
+func (c *Controller) solve(ctx context.Context, req *controlapi.SolveRequest) (*controlapi.SolveResponse, error) {
 	atomic.AddInt64(&c.buildCount, 1)
 	defer atomic.AddInt64(&c.buildCount, -1)
 
-	if err := translateLegacySolveRequest(req); err != nil {
-		return nil, err
+	if c.opt.SolveRecordDir != "" {
+		if p, err := solverecord.Write(c.opt.SolveRecordDir, req); err != nil {
+			bklog.G(ctx).Warnf("failed to record solve request %s: %v", req.Ref, err)
+		} else {
+			bklog.G(ctx).Debugf("recorded solve request %s to %s", req.Ref, p)
+		}
+		if err := solverecord.Prune(c.opt.SolveRecordDir, c.opt.SolveRecordKeepDuration, c.opt.SolveRecordMaxSize); err != nil {
+			bklog.G(ctx).Warnf("failed to prune solve records: %v", err)
+		}
 	}
 
 	defer func() {
 		time.AfterFunc(time.Second, c.throttledGC)
 	}()
 
+	frontendAttrs, err := withDefaultBuildArgs(req.FrontendAttrs, c.opt.DefaultBuildArgs, c.opt.ExcludableBuildArgs)
+	if err != nil {
+		return nil, err
+	}
+	req.FrontendAttrs = withoutDedupOpt(frontendAttrs)
+
+	var warnings []optionstatus.Warning
 	var expi exporter.ExporterInstance
 	// TODO: multiworker
 	// This is actually tricky, as the exporter should come from the worker that has the returned reference. We may need to delay this so that the solver loads this.
@@ -258,36 +367,49 @@ func (c *Controller) Solve(ctx context.Context, req *controlapi.SolveRequest) (*
 		if err != nil {
 			return nil, err
 		}
-		expi, err = exp.Resolve(ctx, req.ExporterAttrs)
+		warnings, err = optionstatus.Check(optionstatus.Exporter(req.Exporter), req.ExporterAttrs, c.opt.ExperimentalOptions)
+		if err != nil {
+			return nil, err
+		}
+		expi, err = exp.Resolve(ctx, exporterAttrsWithEpoch(req.ExporterAttrs, req.FrontendAttrs))
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	var (
-		cacheExporter   remotecache.Exporter
-		cacheExportMode solver.CacheExportMode
-		cacheImports    []frontend.CacheOptionsEntry
+		cacheExporters []llbsolver.RemoteCacheExporter
+		cacheImports   []frontend.CacheOptionsEntry
 	)
-	if len(req.Cache.Exports) > 1 {
-		// TODO(AkihiroSuda): this should be fairly easy
-		return nil, errors.New("specifying multiple cache exports is not supported currently")
-	}
-
-	if len(req.Cache.Exports) == 1 {
-		e := req.Cache.Exports[0]
+	for _, e := range req.Cache.Exports {
 		cacheExporterFunc, ok := c.opt.ResolveCacheExporterFuncs[e.Type]
 		if !ok {
 			return nil, errors.Errorf("unknown cache exporter: %q", e.Type)
 		}
-		cacheExporter, err = cacheExporterFunc(ctx, session.NewGroup(req.Session), e.Attrs)
+		exp, err := cacheExporterFunc(ctx, session.NewGroup(req.Session), e.Attrs)
 		if err != nil {
 			return nil, err
 		}
-		if exportMode, supported := parseCacheExportMode(e.Attrs["mode"]); !supported {
+		cacheExportMode, supported := parseCacheExportMode(e.Attrs["mode"])
+		if !supported {
 			bklog.G(ctx).Debugf("skipping invalid cache export mode: %s", e.Attrs["mode"])
-		} else {
-			cacheExportMode = exportMode
+		}
+		comp, err := parseCacheExportCompression(e.Type, e.Attrs)
+		if err != nil {
+			return nil, err
+		}
+		cacheExporters = append(cacheExporters, llbsolver.RemoteCacheExporter{
+			Exporter:        exp,
+			CacheExportMode: cacheExportMode,
+			Compression:     comp,
+		})
+	}
+	// the output policy is verified on the result, not on the intermediate
+	// results that are exported with mode=max
+	cachePolicy := c.opt.OutputPolicy.ForExporter(outputpolicy.CacheExporter)
+	for _, e := range cacheExporters {
+		if cachePolicy != nil && e.CacheExportMode == solver.CacheExportModeMax {
+			return nil, errdefs.WithCode(errors.New("cache export with mode=max is not allowed by the output policy of the daemon"), errdefs.CodePolicyDenied)
 		}
 	}
 	for _, im := range req.Cache.Imports {
@@ -304,10 +426,11 @@ func (c *Controller) Solve(ctx context.Context, req *controlapi.SolveRequest) (*
 		FrontendInputs: req.FrontendInputs,
 		CacheImports:   cacheImports,
 	}, llbsolver.ExporterRequest{
-		Exporter:        expi,
-		CacheExporter:   cacheExporter,
-		CacheExportMode: cacheExportMode,
-	}, req.Entitlements)
+		Exporter:       expi,
+		CacheExporters: cacheExporters,
+		OutputPolicy:   c.opt.OutputPolicy.ForExporter(req.Exporter),
+		CachePolicy:    cachePolicy,
+	}, req.Entitlements, warnings)
 	if err != nil {
 		return nil, err
 	}
@@ -321,7 +444,7 @@ func (c *Controller) Status(req *controlapi.StatusRequest, stream controlapi.Con
 
 	eg, ctx := errgroup.WithContext(stream.Context())
 	eg.Go(func() error {
-		return c.solver.Status(ctx, req.Ref, ch)
+		return c.solveStatus(ctx, req.Ref, ch)
 	})
 
 	eg.Go(func() error {
@@ -355,6 +478,8 @@ func (c *Controller) Status(req *controlapi.StatusRequest, stream controlapi.Con
 						Timestamp: v.Timestamp,
 						Started:   v.Started,
 						Completed: v.Completed,
+						Host:      v.Host,
+						Retries:   v.Retries,
 					})
 				}
 				for i, v := range ss.Logs {
@@ -416,11 +541,146 @@ func (c *Controller) ListWorkers(ctx context.Context, r *controlapi.ListWorkersR
 			Labels:    w.Labels(),
 			Platforms: pb.PlatformsFromSpec(w.Platforms(true)),
 			GCPolicy:  toPBGCPolicy(w.GCPolicy()),
+			Exporters: c.exporterInfos(w),
+		})
+	}
+	for k := range c.opt.ResolveCacheExporterFuncs {
+		resp.CacheExporters = append(resp.CacheExporters, k)
+	}
+	for k := range c.opt.ResolveCacheImporterFuncs {
+		resp.CacheImporters = append(resp.CacheImporters, k)
+	}
+	sort.Strings(resp.CacheExporters)
+	sort.Strings(resp.CacheImporters)
+	return resp, nil
+}
+
+func (c *Controller) exporterInfos(w worker.Worker) []*apitypes.ExporterInfo {
+	var out []*apitypes.ExporterInfo
+	for _, name := range w.ExporterTypes() {
+		info := &apitypes.ExporterInfo{Type: name}
+		e, err := w.Exporter(name, c.opt.SessionManager)
+		if err != nil {
+			continue
+		}
+		if d, ok := e.(exporter.Describer); ok {
+			for _, o := range d.Options() {
+				info.Options = append(info.Options, &apitypes.ExporterOption{
+					Key:         o.Key,
+					Type:        o.Type,
+					Values:      o.Values,
+					Description: describeStatus(o.Description, optionstatus.Lookup(optionstatus.Exporter(name), o.Key)),
+				})
+			}
+		}
+		out = append(out, info)
+	}
+	return out
+}
+
+// describeStatus adds the status of non-stable options to their description
+func describeStatus(desc string, o optionstatus.Option) string {
+	switch o.Status {
+	case optionstatus.Experimental:
+		return desc + " (experimental)"
+	case optionstatus.Deprecated:
+		if o.Replacement != "" {
+			return desc + " (deprecated, use " + o.Replacement + ")"
+		}
+		return desc + " (deprecated)"
+	}
+	return desc
+}
+
+func (c *Controller) ListBuilds(ctx context.Context, r *controlapi.ListBuildsRequest) (*controlapi.ListBuildsResponse, error) {
+	resp := &controlapi.ListBuildsResponse{}
+	for _, j := range c.solver.Jobs() {
+		resp.Records = append(resp.Records, &controlapi.BuildRecord{
+			Ref:       j.ID(),
+			CreatedAt: j.CreatedAt(),
 		})
 	}
 	return resp, nil
 }
 
+func (c *Controller) Check(ctx context.Context, r *controlapi.CheckRequest) (*controlapi.CheckResponse, error) {
+	resp := &controlapi.CheckResponse{}
+	if c.opt.SelfCheck == nil {
+		return resp, nil
+	}
+	for _, res := range selfcheck.Run(ctx, *c.opt.SelfCheck) {
+		resp.Results = append(resp.Results, &controlapi.CheckResult{
+			Name:    res.Name,
+			Status:  string(res.Status),
+			Message: res.Message,
+			Hint:    res.Hint,
+		})
+	}
+	return resp, nil
+}
+
+func (c *Controller) ValidateLLB(ctx context.Context, r *controlapi.ValidateLLBRequest) (*controlapi.ValidateLLBResponse, error) {
+	diags, err := c.solver.Validate(r.Definition, r.Entitlements)
+	if err != nil {
+		return nil, err
+	}
+	resp := &controlapi.ValidateLLBResponse{}
+	for _, d := range diags {
+		resp.Diagnostics = append(resp.Diagnostics, &controlapi.LLBDiagnostic{
+			Vertex:   d.Vertex,
+			Severity: string(d.Severity),
+			Message:  d.Message,
+		})
+	}
+	return resp, nil
+}
+
+func (c *Controller) Tag(ctx context.Context, r *controlapi.TagRequest) (*controlapi.TagResponse, error) {
+	if c.opt.RegistryHosts == nil {
+		return nil, errors.New("tagging is not supported by the daemon")
+	}
+	dgst, err := push.Tag(ctx, c.opt.SessionManager, r.Session, c.opt.RegistryHosts, r.Ref, r.Tags, r.Insecure)
+	if err != nil {
+		return nil, err
+	}
+	return &controlapi.TagResponse{Digest: dgst}, nil
+}
+
+func (c *Controller) RegisterExpectedBuilds(ctx context.Context, r *controlapi.RegisterExpectedBuildsRequest) (*controlapi.RegisterExpectedBuildsResponse, error) {
+	if c.opt.Prefetcher == nil {
+		return nil, errors.New("expected builds are not supported by the daemon")
+	}
+	builds, err := c.opt.Prefetcher.Register(ctx, r.Builds, r.Remove)
+	if err != nil {
+		return nil, err
+	}
+	return &controlapi.RegisterExpectedBuildsResponse{Builds: builds}, nil
+}
+
+func (c *Controller) VerifyBlobs(ctx context.Context, r *controlapi.VerifyBlobsRequest) (*controlapi.VerifyBlobsResponse, error) {
+	workers, err := c.opt.WorkerController.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list workers for verify")
+	}
+	resp := &controlapi.VerifyBlobsResponse{}
+	for _, w := range workers {
+		info, err := w.CacheManager().VerifyBlobs(ctx, r.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		resp.Checked += info.Checked
+		for _, b := range info.Corrupt {
+			resp.Corrupt = append(resp.Corrupt, &controlapi.CorruptBlob{
+				Digest:  b.Digest,
+				Size_:   b.Size,
+				Records: b.Records,
+				Evicted: b.Evicted,
+			})
+		}
+	}
+	return resp, nil
+}
+
 func (c *Controller) gc() {
 	c.gcmu.Lock()
 	defer c.gcmu.Unlock()
@@ -474,6 +734,52 @@ func parseCacheExportMode(mode string) (solver.CacheExportMode, bool) {
 	return solver.CacheExportModeMin, false
 }
 
+// parseCacheExportCompression returns the compression of the layer blobs
+// of a cache export, independent of the compression of the image exporter.
+// The inline cache describes the layers of the image, so it has the
+// compression of the image exporter.
+func parseCacheExportCompression(typ string, attrs map[string]string) (compression.Config, error) {
+	comp := compression.New(compression.Default)
+	if typ == "inline" {
+		for _, k := range []string{"compression", "force-compression", "compression-level"} {
+			if _, ok := attrs[k]; ok {
+				return comp, errors.Errorf("%s is not supported for inline cache, set it on the image output instead", k)
+			}
+		}
+		return comp, nil
+	}
+	if v, ok := attrs["compression"]; ok {
+		t, err := compression.Parse(v)
+		if err != nil {
+			return comp, err
+		}
+		if t == compression.Nydus {
+			// cache imports need the diffIDs of the layers
+			return comp, errors.Errorf("%s compression is not supported for cache exports", t)
+		}
+		comp.Type = t
+	}
+	if v, ok := attrs["force-compression"]; ok {
+		if v == "" {
+			comp.Force = true
+		} else {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return comp, errors.Wrap(err, "non-bool value specified for force-compression")
+			}
+			comp.Force = b
+		}
+	}
+	if v, ok := attrs["compression-level"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return comp, errors.Wrap(err, "non-int value specified for compression-level")
+		}
+		comp.Level = &n
+	}
+	return comp, nil
+}
+
 func toPBGCPolicy(in []client.PruneInfo) []*apitypes.GCPolicy {
 	policy := make([]*apitypes.GCPolicy, 0, len(in))
 	for _, p := range in {
@@ -486,3 +792,21 @@ func toPBGCPolicy(in []client.PruneInfo) []*apitypes.GCPolicy {
 	}
 	return policy
 }
+
+// exporterAttrsWithEpoch passes the SOURCE_DATE_EPOCH build arg to the
+// exporter unless the exporter attrs set it already
+func exporterAttrsWithEpoch(attrs, frontendAttrs map[string]string) map[string]string {
+	v, ok := frontendAttrs["build-arg:SOURCE_DATE_EPOCH"]
+	if !ok {
+		return attrs
+	}
+	if _, ok := attrs[exptypes.OptKeySourceDateEpoch]; ok {
+		return attrs
+	}
+	out := make(map[string]string, len(attrs)+1)
+	for k, v := range attrs {
+		out[k] = v
+	}
+	out[exptypes.OptKeySourceDateEpoch] = v
+	return out
+}
@@ -0,0 +1,272 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/util/bklog"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// frontendOptDedup is the frontend attr that opts a solve in to being
+// coalesced with identical in-flight solves. Its value identifies the
+// inputs of the build that the daemon can't compare, e.g. the revision of a
+// local build context, or is "true" if there are none.
+const frontendOptDedup = "dedup"
+
+// aliasTimeout is how long the alias of a solve that waited for an
+// identical solve is kept for its status stream after the solve returned
+const aliasTimeout = time.Minute
+
+// dedupExporters are the exporters whose results aren't sent to the client,
+// so that they can be shared by identical solves
+var dedupExporters = map[string]struct{}{
+	"":                   {},
+	client.ExporterImage: {},
+}
+
+// inflightSolve is a solve that identical solves wait for
+type inflightSolve struct {
+	ref  string
+	done chan struct{}
+	resp *controlapi.SolveResponse
+	err  error
+}
+
+// solveDedup coalesces identical in-flight solves. The later solves return
+// the response of the first one, and their status streams follow it.
+type solveDedup struct {
+	mu       sync.Mutex
+	inflight map[digest.Digest]*inflightSolve
+	// aliases are the solves waiting for an in-flight solve by their ref
+	aliases map[string]*alias
+}
+
+// alias is the ref of the in-flight solve a solve waits for. It is removed
+// when the solve has returned and its status stream has detached.
+type alias struct {
+	ref      string
+	left     bool
+	attached bool
+	// changed is closed when ref changes or the solve returns
+	changed chan struct{}
+}
+
+func (a *alias) signal() {
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+func newSolveDedup() *solveDedup {
+	return &solveDedup{
+		inflight: map[digest.Digest]*inflightSolve{},
+		aliases:  map[string]*alias{},
+	}
+}
+
+// dedupKey returns the key of identical solves, empty if the solve doesn't
+// opt in or can't be shared. The solves are only shared by the sessions of
+// sharedKey, as the in-flight solve uses the secrets, SSH agents and
+// registry credentials of its own session. Sessions without a shared key
+// aren't shared.
+func dedupKey(req *controlapi.SolveRequest, sharedKey string) (digest.Digest, error) {
+	v, ok := req.FrontendAttrs[frontendOptDedup]
+	if !ok || v == "" || v == "false" {
+		return "", nil
+	}
+	if _, ok := dedupExporters[req.Exporter]; !ok {
+		return "", nil
+	}
+	if sharedKey == "" {
+		return "", nil
+	}
+
+	key := struct {
+		SharedKey string
+		Req       controlapi.SolveRequest
+	}{SharedKey: sharedKey, Req: *req}
+	key.Req.Ref = ""
+	key.Req.Session = ""
+	dt, err := json.Marshal(&key)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return digest.FromBytes(dt), nil
+}
+
+// withoutDedupOpt returns attrs without the dedup attr, which isn't passed
+// to the frontend
+func withoutDedupOpt(attrs map[string]string) map[string]string {
+	if _, ok := attrs[frontendOptDedup]; !ok {
+		return attrs
+	}
+	out := make(map[string]string, len(attrs)-1)
+	for k, v := range attrs {
+		if k != frontendOptDedup {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// join returns the in-flight solve of key, and whether it was started by
+// this call so that the caller has to run it
+func (d *solveDedup) join(key digest.Digest, ref string) (*inflightSolve, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if s, ok := d.inflight[key]; ok {
+		if a, ok := d.aliases[ref]; ok {
+			a.ref = s.ref
+			a.signal()
+		} else {
+			d.aliases[ref] = &alias{ref: s.ref, changed: make(chan struct{})}
+		}
+		return s, false
+	}
+	// a solve that waited runs again with its own job
+	if a, ok := d.aliases[ref]; ok {
+		a.ref = ref
+		a.signal()
+	}
+	s := &inflightSolve{ref: ref, done: make(chan struct{})}
+	d.inflight[key] = s
+	return s, true
+}
+
+func (d *solveDedup) finish(key digest.Digest, s *inflightSolve, resp *controlapi.SolveResponse, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.inflight, key)
+	s.resp, s.err = resp, err
+	close(s.done)
+}
+
+// leave marks the solve of ref as returned. Its alias is removed when its
+// status stream detaches, or after aliasTimeout if the client doesn't
+// request the status.
+func (d *solveDedup) leave(ref string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	a, ok := d.aliases[ref]
+	if !ok {
+		return
+	}
+	a.left = true
+	a.signal()
+	if a.attached {
+		return
+	}
+	time.AfterFunc(aliasTimeout, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.aliases[ref] == a && !a.attached {
+			delete(d.aliases, ref)
+		}
+	})
+}
+
+// attach returns the ref of the job whose status the status stream of ref
+// follows, ref if the solve doesn't wait for an in-flight solve. changed is
+// closed when the solve of ref starts to wait for another solve, runs again
+// itself or returns, and is nil if the solve never waited. left is true if
+// the solve of ref has returned.
+func (d *solveDedup) attach(ref string) (target string, changed <-chan struct{}, left bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	a, ok := d.aliases[ref]
+	if !ok {
+		return ref, nil, false
+	}
+	a.attached = true
+	return a.ref, a.changed, a.left
+}
+
+// detach is called when the status stream of ref has ended
+func (d *solveDedup) detach(ref string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	a, ok := d.aliases[ref]
+	if !ok {
+		return
+	}
+	a.attached = false
+	if a.left {
+		delete(d.aliases, ref)
+	}
+}
+
+// dedupSolve runs the solve of req unless an identical solve is in flight,
+// then it returns the response of that solve
+func (c *Controller) dedupSolve(ctx context.Context, key digest.Digest, req *controlapi.SolveRequest) (*controlapi.SolveResponse, error) {
+	defer c.dedup.leave(req.Ref)
+	for {
+		s, leader := c.dedup.join(key, req.Ref)
+		if leader {
+			resp, err := c.solve(ctx, req)
+			c.dedup.finish(key, s, resp, err)
+			return resp, err
+		}
+		bklog.G(ctx).Debugf("solve %s waits for identical solve %s", req.Ref, s.ref)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.done:
+		}
+		// the solve is run again if the client of the in-flight solve went
+		// away, e.g. the retried job of a CI run was canceled
+		if errors.Is(s.err, context.Canceled) && ctx.Err() == nil {
+			continue
+		}
+		return s.resp, s.err
+	}
+}
+
+// solveStatus sends the status of the solve of ref to ch and closes it.
+// Solves that wait for an identical solve have no job, they get the status
+// of the identical solve, and again of their own job if they run again
+// because the identical solve was canceled.
+func (c *Controller) solveStatus(ctx context.Context, ref string, ch chan *client.SolveStatus) error {
+	defer close(ch)
+	defer c.dedup.detach(ref)
+	for {
+		target, changed, left := c.dedup.attach(ref)
+		err := c.forwardStatus(ctx, target, ch)
+		if changed == nil {
+			// the solver waits for the job of ref before it fails, the
+			// solve may have joined an in-flight solve in the meantime
+			if next, _, _ := c.dedup.attach(ref); err != nil && next != ref {
+				continue
+			}
+			return err
+		}
+		if target == ref || left {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+		if _, _, left := c.dedup.attach(ref); left {
+			return err
+		}
+	}
+}
+
+// forwardStatus sends the status of the job of ref to ch without closing it
+func (c *Controller) forwardStatus(ctx context.Context, ref string, ch chan *client.SolveStatus) error {
+	sch := make(chan *client.SolveStatus, 8)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.solver.Status(ctx, ref, sch)
+	}()
+	for ss := range sch {
+		ch <- ss
+	}
+	return <-errCh
+}
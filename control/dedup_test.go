@@ -0,0 +1,132 @@
+package control
+
+import (
+	"context"
+	"testing"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupKey(t *testing.T) {
+	req := func(ref, exporter string, attrs map[string]string) *controlapi.SolveRequest {
+		return &controlapi.SolveRequest{
+			Ref:           ref,
+			Session:       ref + "-session",
+			Frontend:      "dockerfile.v0",
+			FrontendAttrs: attrs,
+			Exporter:      exporter,
+			ExporterAttrs: map[string]string{"name": "docker.io/library/foo", "push": "true"},
+		}
+	}
+
+	k1, err := dedupKey(req("ref1", "image", map[string]string{"context": "https://github.com/moby/buildkit.git", frontendOptDedup: "true"}), "ci")
+	require.NoError(t, err)
+	require.NotEmpty(t, k1)
+	k2, err := dedupKey(req("ref2", "image", map[string]string{"context": "https://github.com/moby/buildkit.git", frontendOptDedup: "true"}), "ci")
+	require.NoError(t, err)
+	require.Equal(t, k1, k2)
+
+	k2, err = dedupKey(req("ref2", "image", map[string]string{"context": "https://github.com/moby/buildkit.git#v0.9.0", frontendOptDedup: "true"}), "ci")
+	require.NoError(t, err)
+	require.NotEqual(t, k1, k2)
+	k2, err = dedupKey(req("ref2", "image", map[string]string{"context": "https://github.com/moby/buildkit.git", frontendOptDedup: "abc123"}), "ci")
+	require.NoError(t, err)
+	require.NotEqual(t, k1, k2)
+
+	// the solves of other clients use their own secrets and credentials
+	k2, err = dedupKey(req("ref2", "image", map[string]string{"context": "https://github.com/moby/buildkit.git", frontendOptDedup: "true"}), "other")
+	require.NoError(t, err)
+	require.NotEqual(t, k1, k2)
+
+	// solves that don't opt in, export to the client or have no shared key
+	// aren't shared
+	for _, r := range []*controlapi.SolveRequest{
+		req("ref", "image", nil),
+		req("ref", "image", map[string]string{frontendOptDedup: "false"}),
+		req("ref", "local", map[string]string{frontendOptDedup: "true"}),
+	} {
+		k, err := dedupKey(r, "ci")
+		require.NoError(t, err)
+		require.Empty(t, k)
+	}
+	k, err := dedupKey(req("ref", "image", map[string]string{frontendOptDedup: "true"}), "")
+	require.NoError(t, err)
+	require.Empty(t, k)
+
+	require.Equal(t, map[string]string{"context": "."}, withoutDedupOpt(map[string]string{"context": ".", frontendOptDedup: "true"}))
+}
+
+func TestSolveDedup(t *testing.T) {
+	d := newSolveDedup()
+
+	s, leader := d.join("key", "ref1")
+	require.True(t, leader)
+	s2, leader := d.join("key", "ref2")
+	require.False(t, leader)
+	require.Equal(t, s, s2)
+	_, leader = d.join("key", "ref3")
+	require.False(t, leader)
+	target, changed, left := d.attach("ref2")
+	require.Equal(t, "ref1", target)
+	require.False(t, left)
+	target, changed1, _ := d.attach("ref1")
+	require.Equal(t, "ref1", target)
+	require.Nil(t, changed1)
+
+	resp := &controlapi.SolveResponse{ExporterResponse: map[string]string{"containerimage.digest": "sha256:abc"}}
+	d.finish("key", s, resp, nil)
+	<-s2.done
+	require.Equal(t, resp, s2.resp)
+
+	// the status stream is notified when the solve returns and the alias is
+	// removed when the stream detaches
+	d.leave("ref2")
+	<-changed
+	_, _, left = d.attach("ref2")
+	require.True(t, left)
+	d.detach("ref2")
+	target, _, _ = d.attach("ref2")
+	require.Equal(t, "ref2", target)
+
+	// the alias is kept until the status of the solve has attached
+	d.leave("ref3")
+	target, _, left = d.attach("ref3")
+	require.Equal(t, "ref1", target)
+	require.True(t, left)
+	d.detach("ref3")
+	target, _, _ = d.attach("ref3")
+	require.Equal(t, "ref3", target)
+
+	// finished solves aren't joined
+	_, leader = d.join("key", "ref4")
+	require.True(t, leader)
+}
+
+func TestSolveDedupRerun(t *testing.T) {
+	d := newSolveDedup()
+
+	s, leader := d.join("key", "ref1")
+	require.True(t, leader)
+	_, leader = d.join("key", "ref2")
+	require.False(t, leader)
+	_, leader = d.join("key", "ref3")
+	require.False(t, leader)
+	_, changed2, _ := d.attach("ref2")
+	_, changed3, _ := d.attach("ref3")
+
+	// the first solve is canceled, ref2 runs again and ref3 waits for it
+	d.finish("key", s, nil, context.Canceled)
+	_, leader = d.join("key", "ref2")
+	require.True(t, leader)
+	<-changed2
+	target, _, left := d.attach("ref2")
+	require.Equal(t, "ref2", target)
+	require.False(t, left)
+
+	_, leader = d.join("key", "ref3")
+	require.False(t, leader)
+	<-changed3
+	target, _, _ = d.attach("ref3")
+	require.Equal(t, "ref2", target)
+}
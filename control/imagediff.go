@@ -0,0 +1,124 @@
+package control
+
+import (
+	"context"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/platforms"
+	"github.com/docker/distribution/reference"
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/source"
+	"github.com/moby/buildkit/util/contentutil"
+	"github.com/moby/buildkit/util/filemanifest"
+	"github.com/moby/buildkit/util/imagediff"
+	"github.com/moby/buildkit/util/resolver"
+	"github.com/moby/buildkit/worker"
+	"github.com/moby/buildkit/worker/base"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+func (c *Controller) ImageDiff(ctx context.Context, r *controlapi.ImageDiffRequest) (*controlapi.ImageDiffResponse, error) {
+	if c.opt.RegistryHosts == nil {
+		return nil, errors.New("image diff is not supported by the daemon")
+	}
+	w, err := c.opt.WorkerController.GetDefault()
+	if err != nil {
+		return nil, err
+	}
+	p := w.Platforms(false)[0]
+	if r.Platform != "" {
+		if p, err = platforms.Parse(r.Platform); err != nil {
+			return nil, errors.Wrapf(err, "invalid platform %q", r.Platform)
+		}
+	}
+	p = platforms.Normalize(p)
+
+	g := session.NewGroup(r.Session)
+	a, providerA, err := c.loadImage(ctx, w, r.RefA, p, g)
+	if err != nil {
+		return nil, err
+	}
+	b, providerB, err := c.loadImage(ctx, w, r.RefB, p, g)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &controlapi.ImageDiffResponse{
+		ManifestA: a.Manifest.Digest,
+		ManifestB: b.Manifest.Digest,
+	}
+	for _, ch := range imagediff.Config(a.Config, b.Config) {
+		resp.Config = append(resp.Config, &controlapi.ImageConfigChange{Field: ch.Field, A: ch.A, B: ch.B})
+	}
+	for _, l := range imagediff.Layers(a.Layers, b.Layers) {
+		resp.Layers = append(resp.Layers, &controlapi.LayerChange{Digest: l.Digest, Size_: l.Size, Change: string(l.Change)})
+	}
+	if r.Files {
+		ma, err := filemanifest.FromLayers(ctx, providerA, a.Layers)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list files of %s", r.RefA)
+		}
+		mb, err := filemanifest.FromLayers(ctx, providerB, b.Layers)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list files of %s", r.RefB)
+		}
+		for _, f := range imagediff.Files(ma, mb) {
+			resp.Files = append(resp.Files, &controlapi.FileChange{
+				Path:   f.Path,
+				Change: string(f.Change),
+				SizeA:  f.SizeA,
+				SizeB:  f.SizeB,
+				Layer:  f.Layer,
+			})
+		}
+	}
+	return resp, nil
+}
+
+// loadImage resolves ref in the image store of the worker or in its
+// registry. The returned provider reads the blobs of the image from the
+// content store of the worker and fetches missing blobs from the registry.
+func (c *Controller) loadImage(ctx context.Context, w worker.Worker, ref string, p ocispecs.Platform, g session.Group) (*imagediff.Image, content.Provider, error) {
+	parsed, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid image reference %q", ref)
+	}
+	ref = reference.TagNameOnly(parsed).String()
+
+	r := resolver.DefaultPool.GetResolver(c.opt.RegistryHosts, ref, "pull", c.opt.SessionManager, g)
+	if bw, ok := w.(*base.Worker); ok && bw.ImageStore != nil {
+		r = r.WithImageStore(bw.ImageStore, source.ResolveModePreferLocal)
+	}
+	_, desc, err := r.Resolve(ctx, ref)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to resolve %s", ref)
+	}
+	fetcher, err := r.Fetcher(ctx, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider := &fallbackProvider{local: w.ContentStore(), remote: contentutil.FromFetcher(fetcher)}
+	img, err := imagediff.Load(ctx, provider, desc, platforms.Only(p))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to load %s", ref)
+	}
+	return img, provider, nil
+}
+
+// fallbackProvider reads blobs from local and from remote if they are
+// missing locally
+type fallbackProvider struct {
+	local  content.Provider
+	remote content.Provider
+}
+
+func (p *fallbackProvider) ReaderAt(ctx context.Context, desc ocispecs.Descriptor) (content.ReaderAt, error) {
+	ra, err := p.local.ReaderAt(ctx, desc)
+	if err == nil || !errdefs.IsNotFound(err) {
+		return ra, err
+	}
+	return p.remote.ReaderAt(ctx, desc)
+}
@@ -0,0 +1,67 @@
+package control
+
+import (
+	"context"
+	"time"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/moby/buildkit/util/netcheck"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultNetcheckTimeout = 5 * time.Second
+
+// Netcheck checks the connectivity of the daemon host to the requested
+// endpoints, or to all of the endpoints the daemon is configured for. Only
+// the configured endpoints can be checked so that clients can't make the
+// daemon dial arbitrary hosts.
+func (c *Controller) Netcheck(ctx context.Context, r *controlapi.NetcheckRequest) (*controlapi.NetcheckResponse, error) {
+	allowed := c.opt.NetcheckEndpoints
+	if len(allowed) == 0 {
+		allowed = netcheck.DefaultEndpoints
+	}
+	endpoints := allowed
+	if len(r.Endpoints) > 0 {
+		endpoints = make([]string, 0, len(r.Endpoints))
+		for _, ep := range r.Endpoints {
+			ep = netcheck.Normalize(ep)
+			if !containsEndpoint(allowed, ep) {
+				return nil, status.Errorf(codes.PermissionDenied, "endpoint %s is not configured for the daemon", ep)
+			}
+			endpoints = append(endpoints, ep)
+		}
+	}
+	timeout := time.Duration(r.Timeout)
+	if timeout <= 0 {
+		timeout = defaultNetcheckTimeout
+	}
+
+	resp := &controlapi.NetcheckResponse{}
+	for _, ep := range endpoints {
+		for _, res := range netcheck.Check(ctx, ep, timeout) {
+			out := &controlapi.NetcheckResult{
+				Endpoint: res.Endpoint,
+				Family:   string(res.Family),
+				Latency:  int64(res.Latency),
+			}
+			for _, ip := range res.Addresses {
+				out.Addresses = append(out.Addresses, ip.String())
+			}
+			if res.Err != nil {
+				out.Error = res.Err.Error()
+			}
+			resp.Results = append(resp.Results, out)
+		}
+	}
+	return resp, nil
+}
+
+func containsEndpoint(endpoints []string, ep string) bool {
+	for _, e := range endpoints {
+		if netcheck.Normalize(e) == ep {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package control
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNetcheckEndpoints(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	c := &Controller{opt: Opt{NetcheckEndpoints: []string{l.Addr().String()}}}
+
+	_, err = c.Netcheck(context.TODO(), &controlapi.NetcheckRequest{Endpoints: []string{"example.com"}})
+	require.Error(t, err)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	resp, err := c.Netcheck(context.TODO(), &controlapi.NetcheckRequest{Endpoints: []string{l.Addr().String()}})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(resp.Results))
+
+	resp, err = c.Netcheck(context.TODO(), &controlapi.NetcheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(resp.Results))
+	require.Equal(t, l.Addr().String(), resp.Results[0].Endpoint)
+}
@@ -0,0 +1,326 @@
+// Package prefetch fetches the images and cache manifests of builds that are
+// expected to run, e.g. nightly builds, into the content store while the
+// daemon is idle, so that the builds don't start with a cold cache.
+package prefetch
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/leases"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes/docker"
+	remoteserrors "github.com/containerd/containerd/remotes/errors"
+	"github.com/containerd/continuity"
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/buildkit/util/resolver"
+	"github.com/moby/buildkit/util/resolver/limited"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Interval is the interval of prefetching the expected builds
+	Interval = 30 * time.Minute
+
+	// leaseExpiration keeps the prefetched content for a while after the
+	// build was unregistered or its images became unavailable
+	leaseExpiration = 24 * time.Hour
+	labelBuildID    = "buildkit/prefetch.build"
+
+	keySyntax = "build-arg:BUILDKIT_SYNTAX"
+	keySource = "source"
+)
+
+type Opt struct {
+	// StatePath is the file that the expected builds are persisted to
+	StatePath     string
+	ContentStore  content.Store
+	LeaseManager  leases.Manager
+	RegistryHosts docker.RegistryHosts
+	// Credentials are the registry credentials stored in the daemon. Sources
+	// of registries without credentials are only prefetched if they are
+	// public.
+	Credentials resolver.WorkerCredentials
+	// Platform selects the manifest of multi-platform images
+	Platform ocispecs.Platform
+}
+
+// Prefetcher keeps the expected builds and prefetches their content
+type Prefetcher struct {
+	opt Opt
+	// pool is separate from the resolvers of the builds so that the
+	// credentials of clients are never used for prefetching
+	pool *resolver.Pool
+
+	mu     sync.Mutex
+	builds map[string]*controlapi.ExpectedBuild
+	// fetchMu serializes the prefetches of Run and Prefetch
+	fetchMu sync.Mutex
+}
+
+// New returns a prefetcher with the builds persisted in opt.StatePath
+func New(opt Opt) (*Prefetcher, error) {
+	p := &Prefetcher{
+		opt:    opt,
+		pool:   resolver.NewPool(),
+		builds: map[string]*controlapi.ExpectedBuild{},
+	}
+	p.pool.SetWorkerCredentials(opt.Credentials)
+	dt, err := ioutil.ReadFile(opt.StatePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return p, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	var builds []*controlapi.ExpectedBuild
+	if err := json.Unmarshal(dt, &builds); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", opt.StatePath)
+	}
+	for _, b := range builds {
+		p.builds[b.ID] = b
+	}
+	return p, nil
+}
+
+// Register adds the builds, replacing registered builds with the same ID,
+// and removes the builds with the IDs in remove. All registered builds are
+// returned.
+func (p *Prefetcher) Register(ctx context.Context, builds []*controlapi.ExpectedBuild, remove []string) ([]*controlapi.ExpectedBuild, error) {
+	for _, b := range builds {
+		if b.ID == "" {
+			return nil, errors.New("expected build requires an ID")
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m := make(map[string]*controlapi.ExpectedBuild, len(p.builds))
+	for id, b := range p.builds {
+		m[id] = b
+	}
+	for _, id := range remove {
+		if _, ok := m[id]; !ok {
+			return nil, errors.Errorf("expected build %s is not registered", id)
+		}
+		delete(m, id)
+	}
+	for _, b := range builds {
+		m[b.ID] = b
+	}
+
+	list := sortedBuilds(m)
+	dt, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := continuity.AtomicWriteFile(p.opt.StatePath, dt, 0600); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	p.builds = m
+
+	for _, id := range remove {
+		if _, ok := m[id]; ok {
+			continue
+		}
+		if err := p.release(ctx, id, ""); err != nil {
+			bklog.G(ctx).Warnf("failed to release prefetched content of expected build %s: %v", id, err)
+		}
+	}
+	return list, nil
+}
+
+// Builds returns the registered builds sorted by ID
+func (p *Prefetcher) Builds() []*controlapi.ExpectedBuild {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return sortedBuilds(p.builds)
+}
+
+// Run prefetches the registered builds every interval while idle returns
+// true, until ctx is done. A running prefetch is canceled with ctx.
+func (p *Prefetcher) Run(ctx context.Context, interval time.Duration, idle func() bool) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if idle() {
+			p.Prefetch(ctx)
+		}
+	}
+}
+
+// Prefetch fetches the content of all registered builds. Errors are only
+// logged, so that an unavailable image doesn't stop the other prefetches.
+func (p *Prefetcher) Prefetch(ctx context.Context) {
+	p.fetchMu.Lock()
+	defer p.fetchMu.Unlock()
+
+	for _, b := range p.Builds() {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := p.prefetch(ctx, b); err != nil {
+			bklog.G(ctx).Warnf("failed to prefetch expected build %s: %v", b.ID, err)
+		}
+	}
+}
+
+func (p *Prefetcher) prefetch(ctx context.Context, b *controlapi.ExpectedBuild) error {
+	l, err := p.opt.LeaseManager.Create(ctx, leases.WithRandomID(), leases.WithExpiration(leaseExpiration), leases.WithLabels(map[string]string{
+		labelBuildID: b.ID,
+	}))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	ctx = leases.WithLease(ctx, l.ID)
+
+	imgs, caches := Refs(b)
+	var descs []ocispecs.Descriptor
+	for _, ref := range imgs {
+		d, err := p.fetch(ctx, ref, true)
+		if err != nil {
+			logFetchError(ctx, err, "image", ref, b.ID)
+			continue
+		}
+		descs = append(descs, d...)
+	}
+	for _, ref := range caches {
+		d, err := p.fetch(ctx, ref, false)
+		if err != nil {
+			logFetchError(ctx, err, "cache", ref, b.ID)
+			continue
+		}
+		descs = append(descs, d...)
+	}
+
+	// content that was already in the store isn't added to the lease by
+	// fetching it
+	for _, desc := range descs {
+		if err := p.opt.LeaseManager.AddResource(ctx, l, leases.Resource{
+			ID:   desc.Digest.String(),
+			Type: "content",
+		}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return p.release(ctx, b.ID, l.ID)
+}
+
+// fetch pulls ref into the content store and returns the descriptors of
+// the fetched blobs. Layers are skipped unless layers is set, e.g. for
+// cache manifests.
+func (p *Prefetcher) fetch(ctx context.Context, ref string, layers bool) ([]ocispecs.Descriptor, error) {
+	// without a session only the stored credentials of the daemon are used
+	// and other sources are fetched anonymously
+	r := p.pool.GetResolver(p.opt.RegistryHosts, ref, "pull", nil, nil)
+	name, desc, err := r.Resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	fetcher, err := r.Fetcher(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	platform := platforms.Only(p.opt.Platform)
+	children := images.FilterPlatforms(images.ChildrenHandler(p.opt.ContentStore), platform)
+	if layers {
+		// cache manifests list layers as manifests, so only images are
+		// limited to the manifest of the platform
+		children = images.LimitManifests(children, platform, 1)
+	}
+
+	var mu sync.Mutex
+	var descs []ocispecs.Descriptor
+	record := images.HandlerFunc(func(ctx context.Context, desc ocispecs.Descriptor) ([]ocispecs.Descriptor, error) {
+		if !layers && images.IsLayerType(desc.MediaType) {
+			return nil, images.ErrSkipDesc
+		}
+		mu.Lock()
+		descs = append(descs, desc)
+		mu.Unlock()
+		return nil, nil
+	})
+	if err := images.Dispatch(ctx, images.Handlers(record, limited.FetchHandler(p.opt.ContentStore, fetcher, name), children), nil, desc); err != nil {
+		return nil, err
+	}
+	return descs, nil
+}
+
+// logFetchError logs the failed prefetch of ref. Private sources without
+// stored credentials are expected to fail and only logged for debugging.
+func logFetchError(ctx context.Context, err error, kind, ref, id string) {
+	var errStatus remoteserrors.ErrUnexpectedStatus
+	if errors.Is(err, docker.ErrInvalidAuthorization) || (errors.As(err, &errStatus) && (errStatus.StatusCode == http.StatusUnauthorized || errStatus.StatusCode == http.StatusForbidden)) {
+		bklog.G(ctx).Debugf("skipping prefetch of %s %s of expected build %s without stored credentials: %v", kind, ref, id, err)
+		return
+	}
+	bklog.G(ctx).Warnf("failed to prefetch %s %s of expected build %s: %v", kind, ref, id, err)
+}
+
+// release deletes the leases of earlier prefetches of the build except keep
+func (p *Prefetcher) release(ctx context.Context, id, keep string) error {
+	ls, err := p.opt.LeaseManager.List(ctx, "labels.\""+labelBuildID+"\"")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, l := range ls {
+		if l.ID == keep || l.Labels[labelBuildID] != id {
+			continue
+		}
+		if err := p.opt.LeaseManager.Delete(ctx, l); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Refs returns the images of the build that are prefetched with their
+// layers, and the refs of its registry cache imports
+func Refs(b *controlapi.ExpectedBuild) (imgs []string, caches []string) {
+	switch b.Frontend {
+	case "gateway.v0":
+		if src := b.FrontendAttrs[keySource]; src != "" {
+			imgs = append(imgs, src)
+		}
+	case "dockerfile.v0":
+		if syntax := strings.Fields(b.FrontendAttrs[keySyntax]); len(syntax) > 0 {
+			imgs = append(imgs, syntax[0])
+		}
+	}
+	imgs = append(imgs, b.Images...)
+	for _, im := range b.CacheImports {
+		if im.Type == "registry" && im.Attrs["ref"] != "" {
+			caches = append(caches, im.Attrs["ref"])
+		}
+	}
+	return imgs, caches
+}
+
+func sortedBuilds(m map[string]*controlapi.ExpectedBuild) []*controlapi.ExpectedBuild {
+	list := make([]*controlapi.ExpectedBuild, 0, len(m))
+	for _, b := range m {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
@@ -0,0 +1,128 @@
+package prefetch
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/leases"
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefs(t *testing.T) {
+	imgs, caches := Refs(&controlapi.ExpectedBuild{
+		Frontend: "dockerfile.v0",
+		FrontendAttrs: map[string]string{
+			"build-arg:BUILDKIT_SYNTAX": "docker/dockerfile:1 --arg",
+		},
+		Images: []string{"alpine:3.17"},
+		CacheImports: []*controlapi.CacheOptionsEntry{
+			{Type: "registry", Attrs: map[string]string{"ref": "example.com/foo:cache"}},
+			{Type: "local", Attrs: map[string]string{"src": "/cache"}},
+		},
+	})
+	require.Equal(t, []string{"docker/dockerfile:1", "alpine:3.17"}, imgs)
+	require.Equal(t, []string{"example.com/foo:cache"}, caches)
+
+	imgs, caches = Refs(&controlapi.ExpectedBuild{
+		Frontend:      "gateway.v0",
+		FrontendAttrs: map[string]string{"source": "example.com/frontend"},
+	})
+	require.Equal(t, []string{"example.com/frontend"}, imgs)
+	require.Len(t, caches, 0)
+}
+
+func TestRegister(t *testing.T) {
+	ctx := context.TODO()
+	lm := &leaseManager{}
+	opt := Opt{
+		StatePath:    filepath.Join(t.TempDir(), "expected-builds.json"),
+		LeaseManager: lm,
+	}
+	p, err := New(opt)
+	require.NoError(t, err)
+	require.Len(t, p.Builds(), 0)
+
+	_, err = p.Register(ctx, []*controlapi.ExpectedBuild{{Frontend: "dockerfile.v0"}}, nil)
+	require.Error(t, err)
+
+	builds, err := p.Register(ctx, []*controlapi.ExpectedBuild{
+		{ID: "nightly", Images: []string{"alpine"}},
+		{ID: "hourly", Images: []string{"busybox"}},
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, builds, 2)
+	require.Equal(t, "hourly", builds[0].ID)
+
+	// the builds are persisted
+	p, err = New(opt)
+	require.NoError(t, err)
+	builds = p.Builds()
+	require.Len(t, builds, 2)
+	require.Equal(t, []string{"alpine"}, builds[1].Images)
+
+	_, err = p.Register(ctx, nil, []string{"weekly"})
+	require.Error(t, err)
+
+	lm.leases = []leases.Lease{
+		{ID: "l1", Labels: map[string]string{labelBuildID: "hourly"}},
+		{ID: "l2", Labels: map[string]string{labelBuildID: "nightly"}},
+	}
+	builds, err = p.Register(ctx, nil, []string{"hourly"})
+	require.NoError(t, err)
+	require.Len(t, builds, 1)
+	require.Equal(t, "nightly", builds[0].ID)
+	// the prefetched content of removed builds is released
+	require.Len(t, lm.leases, 1)
+	require.Equal(t, "l2", lm.leases[0].ID)
+}
+
+type leaseManager struct {
+	leases.Manager
+	leases []leases.Lease
+}
+
+func (lm *leaseManager) List(ctx context.Context, filters ...string) ([]leases.Lease, error) {
+	return append([]leases.Lease{}, lm.leases...), nil
+}
+
+func (lm *leaseManager) Delete(ctx context.Context, l leases.Lease, opts ...leases.DeleteOpt) error {
+	for i := range lm.leases {
+		if lm.leases[i].ID == l.ID {
+			lm.leases = append(lm.leases[:i], lm.leases[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func TestRunStops(t *testing.T) {
+	p, err := New(Opt{
+		StatePath:    filepath.Join(t.TempDir(), "expected-builds.json"),
+		LeaseManager: &leaseManager{},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	done := make(chan struct{})
+	var runs int64
+	go func() {
+		defer close(done)
+		p.Run(ctx, time.Millisecond, func() bool {
+			atomic.AddInt64(&runs, 1)
+			return true
+		})
+	}()
+	for atomic.LoadInt64(&runs) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("prefetcher didn't stop")
+	}
+}
@@ -143,6 +143,8 @@ func (w *containerdExecutor) Run(ctx context.Context, id string, root executor.M
 		}
 	}
 
+	sgids = append(sgids, meta.AdditionalGids...)
+
 	provider, ok := w.networkProviders[meta.NetMode]
 	if !ok {
 		return errors.Errorf("unknown network mode %s", meta.NetMode)
@@ -214,6 +216,7 @@ func (w *containerdExecutor) Run(ctx context.Context, id string, root executor.M
 		}
 	}()
 
+	oomCounter := oci.NewOOMCounter(w.cgroupParent)
 	err = w.runProcess(ctx, task, process.Resize, func() {
 		startedOnce.Do(func() {
 			if started != nil {
@@ -221,7 +224,7 @@ func (w *containerdExecutor) Run(ctx context.Context, id string, root executor.M
 			}
 		})
 	})
-	return err
+	return oomCounter.WithCode(err)
 }
 
 func (w *containerdExecutor) Exec(ctx context.Context, id string, process executor.ProcessInfo) (err error) {
@@ -284,7 +287,7 @@ func (w *containerdExecutor) Exec(ctx context.Context, id string, process execut
 		proc.User = specs.User{
 			UID:            uid,
 			GID:            gid,
-			AdditionalGids: []uint32{},
+			AdditionalGids: append([]uint32{}, meta.AdditionalGids...),
 		}
 	}
 
@@ -13,6 +13,7 @@ type Meta struct {
 	Args           []string
 	Env            []string
 	User           string
+	AdditionalGids []uint32 // supplementary groups in addition to the ones of User
 	Cwd            string
 	Hostname       string
 	Tty            bool
@@ -20,6 +21,11 @@ type Meta struct {
 	ExtraHosts     []HostIP
 	NetMode        pb.NetMode
 	SecurityMode   pb.SecurityMode
+	CoreDumpSize   int64 // RLIMIT_CORE of the process, 0 disables core dumps
+	// CheckpointKey identifies the process across daemon restarts by the
+	// cache key of its step. Executors that checkpoint processes restore the
+	// latest checkpoint of the key.
+	CheckpointKey string
 }
 
 type Mountable interface {
@@ -31,6 +37,9 @@ type Mount struct {
 	Selector string
 	Dest     string
 	Readonly bool
+	// MountType is the type of the mount of the op, e.g. secret mounts
+	// are tmpfs mounts with the secret as their contents
+	MountType pb.MountType
 }
 
 type WinSize struct {
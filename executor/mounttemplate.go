@@ -0,0 +1,110 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/containerd/mount"
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/moby/buildkit/snapshot"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// MountTemplate is a file or directory of the host that is mounted read-only
+// into the processes of build steps, e.g. a CA bundle or the config of a
+// package proxy
+type MountTemplate struct {
+	Name string
+	// Source is the path on the host
+	Source string
+	// Dest is the path in the container
+	Dest string
+	// Auto mounts the template into the processes of every solve. Other
+	// templates are only mounted for the solves that request them.
+	Auto bool
+	// Env are default environment variables of the processes the template is
+	// mounted into, e.g. SSL_CERT_FILE for a CA bundle. Variables set by the
+	// build step take precedence.
+	Env []string
+}
+
+// Mount returns the read-only bind mount of the template
+func (t MountTemplate) Mount() Mount {
+	return Mount{
+		Src:      &hostMountable{source: t.Source},
+		Dest:     t.Dest,
+		Readonly: true,
+	}
+}
+
+// Digest returns the digest of the contents of the source of the template,
+// with the paths, modes and link targets of the files of a directory
+func (t MountTemplate) Digest() (digest.Digest, error) {
+	// the bind mount follows a symlink source
+	src, err := filepath.EvalSymlinks(t.Source)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read mount template %s", t.Name)
+	}
+	h := digest.Canonical.Digester()
+	err = filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h.Hash(), "%s\x00%o\x00", filepath.ToSlash(rel), fi.Mode())
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h.Hash(), "%s\x00", target)
+		case fi.Mode().IsRegular():
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			fmt.Fprintf(h.Hash(), "%d\x00", fi.Size())
+			if _, err := io.Copy(h.Hash(), f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read mount template %s", t.Name)
+	}
+	return h.Digest(), nil
+}
+
+type hostMountable struct {
+	source string
+}
+
+func (m *hostMountable) Mount(ctx context.Context, readonly bool) (snapshot.Mountable, error) {
+	return &hostMount{source: m.source}, nil
+}
+
+type hostMount struct {
+	source string
+}
+
+func (m *hostMount) Mount() ([]mount.Mount, func() error, error) {
+	return []mount.Mount{{
+		Type:    "bind",
+		Source:  m.source,
+		Options: []string{"rbind", "ro"},
+	}}, func() error { return nil }, nil
+}
+
+func (m *hostMount) IdentityMapping() *idtools.IdentityMapping {
+	return nil
+}
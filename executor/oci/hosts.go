@@ -76,12 +76,13 @@ func makeHostsFile(stateDir string, extraHosts []executor.HostIP, idmap *idtools
 }
 
 func initHostsFile(hostname string) string {
-	var hosts string
-	if hostname != "" {
-		hosts = fmt.Sprintf("127.0.0.1	localhost %s", hostname)
-	} else {
-		hosts = fmt.Sprintf("127.0.0.1	localhost %s", defaultHostname)
+	if hostname == "" {
+		hostname = defaultHostname
 	}
-	hosts = fmt.Sprintf("%s\n::1	localhost ip6-localhost ip6-loopback\n", hosts)
+	hosts := fmt.Sprintf("127.0.0.1	localhost %s\n", hostname)
+	// the hostname resolves over IPv6 too for IPv6-only networks
+	hosts += fmt.Sprintf("::1	localhost ip6-localhost ip6-loopback %s\n", hostname)
+	// standard IPv6 entries so that lookups don't leak to DNS on IPv6-only hosts
+	hosts += "fe00::0	ip6-localnet\nff00::0	ip6-mcastprefix\nff02::1	ip6-allnodes\nff02::2	ip6-allrouters\n"
 	return hosts
 }
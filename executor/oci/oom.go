@@ -0,0 +1,81 @@
+package oci
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	gatewayapi "github.com/moby/buildkit/frontend/gateway/pb"
+	"github.com/moby/buildkit/solver/errdefs"
+	"github.com/pkg/errors"
+)
+
+// exitCodeKilled is the exit code of processes killed by SIGKILL, which the
+// out-of-memory killer sends
+const exitCodeKilled = 128 + 9
+
+// OOMCounter compares the number of processes killed by the out-of-memory
+// killer with the number at the time it was created, so that a process
+// killed with SIGKILL is only reported as out of memory if the kernel killed
+// a process in the meantime
+type OOMCounter struct {
+	path   string
+	before uint64
+	ok     bool
+}
+
+// NewOOMCounter returns a counter of the oom_kill events of the cgroup v2
+// cgroupParent of the containers, or of the host if the containers have no
+// cgroup parent or its events can't be read, e.g. with cgroup v1 or the
+// systemd cgroup driver
+func NewOOMCounter(cgroupParent string) *OOMCounter {
+	if cgroupParent != "" && !(strings.Contains(cgroupParent, ".slice") && strings.HasSuffix(cgroupParent, ":")) {
+		c := newOOMCounter(filepath.Join("/sys/fs/cgroup", cgroupParent, "memory.events"))
+		if c.ok {
+			return c
+		}
+	}
+	return newOOMCounter("/proc/vmstat")
+}
+
+func newOOMCounter(path string) *OOMCounter {
+	n, ok := readOOMKills(path)
+	return &OOMCounter{path: path, before: n, ok: ok}
+}
+
+// WithCode returns err with the oom error code if err is the exit of a
+// process killed with SIGKILL and the oom_kill counter increased
+func (c *OOMCounter) WithCode(err error) error {
+	var exitErr *gatewayapi.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != exitCodeKilled || errors.Is(err, context.Canceled) {
+		return err
+	}
+	if !c.ok {
+		return err
+	}
+	if n, ok := readOOMKills(c.path); !ok || n <= c.before {
+		return err
+	}
+	return errdefs.WithCode(err, errdefs.CodeOOM)
+}
+
+// readOOMKills reads the oom_kill counter of memory.events or /proc/vmstat
+func readOOMKills(path string) (uint64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, err := strconv.ParseUint(fields[1], 10, 64)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
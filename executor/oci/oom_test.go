@@ -0,0 +1,36 @@
+package oci
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	gatewayapi "github.com/moby/buildkit/frontend/gateway/pb"
+	"github.com/moby/buildkit/solver/errdefs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOOMCounter(t *testing.T) {
+	t.Parallel()
+	p := filepath.Join(t.TempDir(), "memory.events")
+	require.NoError(t, ioutil.WriteFile(p, []byte("low 0\nhigh 0\nmax 3\noom 2\noom_kill 1\n"), 0600))
+
+	c := newOOMCounter(p)
+	require.True(t, c.ok)
+	killed := &gatewayapi.ExitError{ExitCode: 137}
+
+	// killed with SIGKILL without an oom kill, e.g. by a user
+	require.Equal(t, "", errdefs.GetCode(c.WithCode(killed)))
+
+	require.NoError(t, ioutil.WriteFile(p, []byte("low 0\nhigh 0\nmax 5\noom 3\noom_kill 2\n"), 0600))
+	require.Equal(t, errdefs.CodeOOM, errdefs.GetCode(c.WithCode(killed)))
+	require.Equal(t, "", errdefs.GetCode(c.WithCode(&gatewayapi.ExitError{ExitCode: 1})))
+	require.Equal(t, "", errdefs.GetCode(c.WithCode(&gatewayapi.ExitError{ExitCode: 137, Err: errors.Wrap(context.Canceled, "exit code: 137")})))
+
+	// without a counter processes are never reported as out of memory
+	c = newOOMCounter(filepath.Join(t.TempDir(), "memory.events"))
+	require.False(t, c.ok)
+	require.Equal(t, "", errdefs.GetCode(c.WithCode(killed)))
+}
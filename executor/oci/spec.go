@@ -102,6 +102,13 @@ func GenerateSpec(ctx context.Context, meta executor.Meta, mounts []executor.Mou
 	}
 
 	s.Process.Rlimits = nil // reset open files limit
+	if meta.CoreDumpSize > 0 {
+		s.Process.Rlimits = []specs.POSIXRlimit{{
+			Type: "RLIMIT_CORE",
+			Hard: uint64(meta.CoreDumpSize),
+			Soft: uint64(meta.CoreDumpSize),
+		}}
+	}
 
 	sm := &submounts{}
 
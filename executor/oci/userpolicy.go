@@ -0,0 +1,109 @@
+package oci
+
+import (
+	"context"
+
+	"github.com/moby/buildkit/executor"
+	"github.com/moby/buildkit/snapshot"
+	"github.com/pkg/errors"
+)
+
+// UserPolicy configures the user that build steps run as on a worker
+type UserPolicy struct {
+	// DefaultUser is used for processes that don't set a user, e.g. because
+	// the image config has none
+	DefaultUser string
+	// DefaultGroups are supplementary group IDs added to DefaultUser
+	DefaultGroups []uint32
+	// RejectRoot fails processes that would run as uid 0
+	RejectRoot bool
+}
+
+// IsEmpty returns true if the policy doesn't change any behavior
+func (p UserPolicy) IsEmpty() bool {
+	return p.DefaultUser == "" && len(p.DefaultGroups) == 0 && !p.RejectRoot
+}
+
+// WithUserPolicy returns an executor that applies the user policy to every
+// process before running it with e
+func WithUserPolicy(e executor.Executor, p UserPolicy) executor.Executor {
+	if p.IsEmpty() {
+		return e
+	}
+	return &userPolicyExecutor{Executor: e, policy: p}
+}
+
+type userPolicyExecutor struct {
+	executor.Executor
+	policy UserPolicy
+}
+
+func (e *userPolicyExecutor) Run(ctx context.Context, id string, rootfs executor.Mount, mounts []executor.Mount, process executor.ProcessInfo, started chan<- struct{}) error {
+	e.applyDefaults(&process.Meta)
+	if err := e.checkRoot(ctx, &rootfs, process.Meta.User); err != nil {
+		return err
+	}
+	return e.Executor.Run(ctx, id, rootfs, mounts, process, started)
+}
+
+func (e *userPolicyExecutor) Exec(ctx context.Context, id string, process executor.ProcessInfo) error {
+	// an empty user inherits the user of the container that was already
+	// validated by Run
+	if process.Meta.User != "" {
+		if err := e.checkRoot(ctx, nil, process.Meta.User); err != nil {
+			return err
+		}
+	}
+	return e.Executor.Exec(ctx, id, process)
+}
+
+func (e *userPolicyExecutor) applyDefaults(meta *executor.Meta) {
+	if meta.User != "" || e.policy.DefaultUser == "" {
+		return
+	}
+	meta.User = e.policy.DefaultUser
+	meta.AdditionalGids = append(meta.AdditionalGids, e.policy.DefaultGroups...)
+}
+
+func (e *userPolicyExecutor) checkRoot(ctx context.Context, rootfs *executor.Mount, username string) error {
+	if !e.policy.RejectRoot {
+		return nil
+	}
+	uid, err := e.resolveUID(ctx, rootfs, username)
+	if err != nil {
+		return err
+	}
+	if uid == 0 {
+		return errors.Errorf("running build steps as root is not allowed on this worker (user %q). Set a non-root USER for the step", username)
+	}
+	return nil
+}
+
+func (e *userPolicyExecutor) resolveUID(ctx context.Context, rootfs *executor.Mount, username string) (uint32, error) {
+	if uid, _, err := ParseUIDGID(username); err == nil {
+		return uid, nil
+	}
+	if uid, err := parseUID(username); err == nil {
+		return uid, nil
+	}
+	if rootfs == nil {
+		return 0, errors.Errorf("cannot verify user %q against the worker user policy", username)
+	}
+
+	m, err := rootfs.Src.Mount(ctx, true)
+	if err != nil {
+		return 0, err
+	}
+	lm := snapshot.LocalMounter(m)
+	root, err := lm.Mount()
+	if err != nil {
+		return 0, err
+	}
+	defer lm.Unmount()
+
+	uid, _, _, err := GetUser(root, username)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to resolve user %q", username)
+	}
+	return uid, nil
+}
@@ -0,0 +1,57 @@
+package oci
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moby/buildkit/executor"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingExecutor struct {
+	executor.Executor
+	meta *executor.Meta
+}
+
+func (e *recordingExecutor) Run(ctx context.Context, id string, rootfs executor.Mount, mounts []executor.Mount, process executor.ProcessInfo, started chan<- struct{}) error {
+	e.meta = &process.Meta
+	return nil
+}
+
+func (e *recordingExecutor) Exec(ctx context.Context, id string, process executor.ProcessInfo) error {
+	e.meta = &process.Meta
+	return nil
+}
+
+func TestUserPolicy(t *testing.T) {
+	ctx := context.TODO()
+	re := &recordingExecutor{}
+
+	require.Equal(t, executor.Executor(re), WithUserPolicy(re, UserPolicy{}))
+
+	e := WithUserPolicy(re, UserPolicy{DefaultUser: "1000:1000", DefaultGroups: []uint32{1001}, RejectRoot: true})
+
+	err := e.Run(ctx, "", executor.Mount{}, nil, executor.ProcessInfo{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "1000:1000", re.meta.User)
+	require.Equal(t, []uint32{1001}, re.meta.AdditionalGids)
+
+	err = e.Run(ctx, "", executor.Mount{}, nil, executor.ProcessInfo{Meta: executor.Meta{User: "2000"}}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "2000", re.meta.User)
+	require.Equal(t, 0, len(re.meta.AdditionalGids))
+
+	err = e.Run(ctx, "", executor.Mount{}, nil, executor.ProcessInfo{Meta: executor.Meta{User: "0:0"}}, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "root")
+
+	err = e.Exec(ctx, "", executor.ProcessInfo{Meta: executor.Meta{User: "0"}})
+	require.Error(t, err)
+
+	err = e.Exec(ctx, "", executor.ProcessInfo{})
+	require.NoError(t, err)
+
+	err = e.Exec(ctx, "", executor.ProcessInfo{Meta: executor.Meta{User: "builder"}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot verify")
+}
@@ -0,0 +1,3 @@
+package remoteexecutor
+
+//go:generate protoc -I=. -I=../../vendor/ --gogoslick_out=plugins=grpc:. executor.proto
@@ -0,0 +1,452 @@
+package remoteexecutor
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/containerd/containerd/archive"
+	"github.com/containerd/continuity/fs"
+	"github.com/moby/buildkit/executor"
+	gatewayapi "github.com/moby/buildkit/frontend/gateway/pb"
+	"github.com/moby/buildkit/snapshot"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/buildkit/util/grpcerrors"
+	"github.com/pkg/errors"
+	"github.com/tonistiigi/fsutil"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+)
+
+// chunkSize is the maximum size of the data of a message
+const chunkSize = 32 * 1024
+
+// Opt configures the connection to the executor service
+type Opt struct {
+	// Address is the address of the service, unix:///path or tcp://host:port
+	Address string
+	// TLS is the TLS config of tcp connections. It is required for tcp
+	// addresses as the mounts and the environment of the processes are
+	// sent to the service.
+	TLS *tls.Config
+	// Fallback runs processes with the local executor if the service can't
+	// be reached
+	Fallback bool
+}
+
+type remoteExecutor struct {
+	opt    Opt
+	local  executor.Executor
+	client ExecutorClient
+
+	mu sync.Mutex
+	// remote are the IDs of the containers running on the service
+	remote map[string]struct{}
+}
+
+// New returns an executor that runs the processes of build steps with the
+// executor service of opt. Interactive processes, processes with mounts
+// that can't be sent to the service and the processes the service declines
+// are run with local.
+func New(opt Opt, local executor.Executor) (executor.Executor, error) {
+	u, err := url.Parse(opt.Address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid remote executor address %s", opt.Address)
+	}
+	var network, addr string
+	switch u.Scheme {
+	case "unix":
+		network, addr = "unix", u.Path
+	case "tcp":
+		network, addr = "tcp", u.Host
+		if opt.TLS == nil {
+			return nil, errors.Errorf("remote executor address %s requires tls", opt.Address)
+		}
+	default:
+		return nil, errors.Errorf("unsupported remote executor address %s, expected unix:// or tcp://", opt.Address)
+	}
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}),
+		grpc.WithUnaryInterceptor(grpcerrors.UnaryClientInterceptor),
+		grpc.WithStreamInterceptor(grpcerrors.StreamClientInterceptor),
+	}
+	if network == "tcp" {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(opt.TLS)))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithInsecure())
+	}
+	conn, err := grpc.Dial(addr, dialOpts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to remote executor %s", opt.Address)
+	}
+	return &remoteExecutor{
+		opt:    opt,
+		local:  local,
+		client: NewExecutorClient(conn),
+		remote: map[string]struct{}{},
+	}, nil
+}
+
+func (e *remoteExecutor) Run(ctx context.Context, id string, root executor.Mount, mounts []executor.Mount, process executor.ProcessInfo, started chan<- struct{}) error {
+	if process.Stdin != nil || process.Meta.Tty {
+		return e.local.Run(ctx, id, root, mounts, process, started)
+	}
+	for _, m := range mounts {
+		if !remoteMount(m) {
+			bklog.G(ctx).Debugf("running process locally, %s mount %s isn't supported by the remote executor", strings.ToLower(m.MountType.String()), m.Dest)
+			return e.local.Run(ctx, id, root, mounts, process, started)
+		}
+	}
+	if id != "" {
+		e.mu.Lock()
+		e.remote[id] = struct{}{}
+		e.mu.Unlock()
+		defer func() {
+			e.mu.Lock()
+			delete(e.remote, id)
+			e.mu.Unlock()
+		}()
+	}
+
+	r := &run{
+		mounts: append([]executor.Mount{root}, mounts...),
+	}
+	r.dirs = make([]string, len(r.mounts))
+	r.unmounts = make([]func() error, len(r.mounts))
+	defer r.release()
+
+	err := r.run(ctx, e.client, id, process, started)
+	if errors.Is(err, errFallback) {
+		code := grpcerrors.Code(err)
+		if code != codes.Unimplemented && !e.opt.Fallback {
+			return errors.Wrapf(err, "failed to run process on remote executor %s", e.opt.Address)
+		}
+		if code != codes.Unimplemented {
+			bklog.G(ctx).Warnf("running process locally, remote executor %s failed: %v", e.opt.Address, err)
+		}
+		r.release()
+		e.mu.Lock()
+		delete(e.remote, id)
+		e.mu.Unlock()
+		return e.local.Run(ctx, id, root, mounts, process, started)
+	}
+	return err
+}
+
+func (e *remoteExecutor) Exec(ctx context.Context, id string, process executor.ProcessInfo) error {
+	e.mu.Lock()
+	_, ok := e.remote[id]
+	e.mu.Unlock()
+	if ok {
+		return errors.Errorf("exec is not supported for container %s of the remote executor", id)
+	}
+	return e.local.Exec(ctx, id, process)
+}
+
+// errFallback marks the errors before the process was started remotely
+var errFallback = errors.New("process not started")
+
+type fallbackError struct {
+	error
+}
+
+func (e *fallbackError) Is(target error) bool {
+	return target == errFallback
+}
+
+func (e *fallbackError) Unwrap() error {
+	return e.error
+}
+
+type run struct {
+	mounts   []executor.Mount
+	mu       sync.Mutex
+	dirs     []string
+	unmounts []func() error
+
+	sendMu sync.Mutex
+	stream Executor_RunClient
+
+	uploadMu  sync.Mutex
+	exited    bool
+	uploadErr error
+}
+
+// dir mounts the mount index locally if it isn't mounted yet
+func (r *run) dir(ctx context.Context, index uint32) (string, error) {
+	if int(index) >= len(r.mounts) {
+		return "", errors.Errorf("invalid mount index %d", index)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dirs[index] != "" {
+		return r.dirs[index], nil
+	}
+	m := r.mounts[index]
+	mountable, err := m.Src.Mount(ctx, m.Readonly)
+	if err != nil {
+		return "", err
+	}
+	lm := snapshot.LocalMounter(mountable)
+	dir, err := lm.Mount()
+	if err != nil {
+		return "", err
+	}
+	r.unmounts[index] = lm.Unmount
+	if m.Selector != "" {
+		if dir, err = fs.RootPath(dir, m.Selector); err != nil {
+			return "", err
+		}
+	}
+	r.dirs[index] = dir
+	return dir, nil
+}
+
+func (r *run) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, unmount := range r.unmounts {
+		if unmount != nil {
+			unmount()
+		}
+		r.unmounts[i] = nil
+		r.dirs[i] = ""
+	}
+}
+
+func (r *run) send(msg *ClientMessage) error {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+	return r.stream.Send(msg)
+}
+
+func (r *run) run(ctx context.Context, client ExecutorClient, id string, process executor.ProcessInfo, started chan<- struct{}) error {
+	ctx, cancel := context.WithCancel(ctx)
+	eg, egCtx := errgroup.WithContext(ctx)
+	// the uploads are separate from the diffs as the service may stop
+	// reading a mount once the process has exited
+	uploadCtx, cancelUploads := context.WithCancel(ctx)
+	var uploads sync.WaitGroup
+	defer func() {
+		// the mounts are released after the transfers have stopped
+		cancelUploads()
+		cancel()
+		uploads.Wait()
+		eg.Wait()
+	}()
+
+	stream, err := client.Run(ctx)
+	if err != nil {
+		return &fallbackError{err}
+	}
+	r.stream = stream
+
+	if err := r.send(&ClientMessage{Message: &ClientMessage_Run{Run: runRequest(id, process.Meta, r.mounts)}}); err != nil {
+		return &fallbackError{err}
+	}
+
+	diffs := map[uint32]*io.PipeWriter{}
+	var startedOnce sync.Once
+	isStarted := false
+	defer func() {
+		for _, pw := range diffs {
+			pw.CloseWithError(errors.New("remote executor stream ended"))
+		}
+	}()
+
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			r.uploadMu.Lock()
+			uploadErr := r.uploadErr
+			r.uploadMu.Unlock()
+			if uploadErr != nil {
+				return uploadErr
+			}
+			if !isStarted {
+				return &fallbackError{err}
+			}
+			if err == io.EOF {
+				err = errors.New("remote executor ended the stream without exit status")
+			}
+			return errors.WithStack(err)
+		}
+		switch m := msg.Message.(type) {
+		case *ServerMessage_Started:
+			isStarted = true
+			if started != nil {
+				startedOnce.Do(func() {
+					close(started)
+				})
+			}
+		case *ServerMessage_Fetch:
+			index := m.Fetch.Index
+			uploads.Add(1)
+			go func() {
+				defer uploads.Done()
+				err := r.sendMount(uploadCtx, index)
+				if err == nil {
+					return
+				}
+				r.uploadMu.Lock()
+				defer r.uploadMu.Unlock()
+				if r.exited {
+					bklog.G(ctx).Debugf("ignoring upload error of %s after the remote process exited: %v", r.mounts[index].Dest, err)
+					return
+				}
+				if r.uploadErr == nil {
+					r.uploadErr = err
+				}
+				// the stream is closed to stop waiting for the service
+				cancel()
+			}()
+		case *ServerMessage_Output:
+			w := process.Stdout
+			if m.Output.Fd == 2 {
+				w = process.Stderr
+			}
+			if w != nil {
+				if _, err := w.Write(m.Output.Data); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+		case *ServerMessage_Diff:
+			// the changes can't be reverted for running the process locally
+			isStarted = true
+			index := m.Diff.Index
+			pw, ok := diffs[index]
+			if !ok {
+				if int(index) >= len(r.mounts) || r.mounts[index].Readonly {
+					return errors.Errorf("diff for invalid mount %d", index)
+				}
+				dir, err := r.dir(egCtx, index)
+				if err != nil {
+					return err
+				}
+				var pr *io.PipeReader
+				pr, pw = io.Pipe()
+				diffs[index] = pw
+				eg.Go(func() error {
+					_, err := archive.Apply(egCtx, dir, pr)
+					pr.CloseWithError(err)
+					return errors.Wrapf(err, "failed to apply changes of %s", r.mounts[index].Dest)
+				})
+			}
+			if _, err := pw.Write(m.Diff.Data); err != nil {
+				return errors.WithStack(err)
+			}
+			if m.Diff.EOF {
+				pw.Close()
+			}
+		case *ServerMessage_Exit:
+			r.uploadMu.Lock()
+			r.exited = true
+			r.uploadMu.Unlock()
+			cancelUploads()
+			uploads.Wait()
+			for _, pw := range diffs {
+				pw.Close()
+			}
+			if err := eg.Wait(); err != nil {
+				return err
+			}
+			stream.CloseSend()
+			if m.Exit.Code == 0 && m.Exit.Error == "" {
+				return nil
+			}
+			exitErr := &gatewayapi.ExitError{ExitCode: m.Exit.Code}
+			if m.Exit.Error != "" {
+				exitErr.Err = errors.New(m.Exit.Error)
+			}
+			return exitErr
+		}
+	}
+}
+
+// sendMount sends the tar stream of the contents of the mount index
+func (r *run) sendMount(ctx context.Context, index uint32) error {
+	dir, err := r.dir(ctx, index)
+	if err != nil {
+		return err
+	}
+	cw := &chunkWriter{r: r, index: index}
+	bw := bufio.NewWriterSize(cw, chunkSize)
+	if err := fsutil.WriteTar(ctx, fsutil.NewFS(dir, &fsutil.WalkOpt{}), bw); err != nil {
+		return errors.Wrapf(err, "failed to send contents of %s", r.mounts[index].Dest)
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return r.send(&ClientMessage{Message: &ClientMessage_Mount{Mount: &MountData{Index: index, EOF: true}}})
+}
+
+type chunkWriter struct {
+	r     *run
+	index uint32
+}
+
+func (w *chunkWriter) Write(dt []byte) (int, error) {
+	n := 0
+	for len(dt) > 0 {
+		l := len(dt)
+		if l > chunkSize {
+			l = chunkSize
+		}
+		if err := w.r.send(&ClientMessage{Message: &ClientMessage_Mount{Mount: &MountData{Index: w.index, Data: dt[:l]}}}); err != nil {
+			return n, errors.WithStack(err)
+		}
+		n += l
+		dt = dt[l:]
+	}
+	return n, nil
+}
+
+// remoteMount returns true if m can be sent to the service. The contents of
+// secret and SSH mounts must not leave the daemon. The service only gets
+// copies of the bind mounts: the protocol has no tmpfs mounts, and the
+// changes to a cache mount would only be applied after the process exited
+// while other steps share it, so steps with either run locally.
+func remoteMount(m executor.Mount) bool {
+	return m.MountType == pb.MountType_BIND
+}
+
+// runRequest returns the request of the process. The proxy variables of the
+// op are part of the environment of meta.
+func runRequest(id string, meta executor.Meta, mounts []executor.Mount) *RunRequest {
+	req := &RunRequest{
+		ID:             id,
+		Args:           meta.Args,
+		Env:            meta.Env,
+		User:           meta.User,
+		AdditionalGids: meta.AdditionalGids,
+		Cwd:            meta.Cwd,
+		Hostname:       meta.Hostname,
+		ReadonlyRootfs: meta.ReadonlyRootFS,
+		NetMode:        meta.NetMode.String(),
+		SecurityMode:   meta.SecurityMode.String(),
+		CoreDumpSize:   meta.CoreDumpSize,
+	}
+	for _, h := range meta.ExtraHosts {
+		req.ExtraHosts = append(req.ExtraHosts, &HostIP{Host: h.Host, IP: h.IP.String()})
+	}
+	for i, m := range mounts {
+		dest := m.Dest
+		if i == 0 {
+			dest = "/"
+		}
+		req.Mounts = append(req.Mounts, &Mount{Dest: dest, Readonly: m.Readonly})
+	}
+	return req
+}
@@ -0,0 +1,245 @@
+package remoteexecutor
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/mount"
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/moby/buildkit/executor"
+	gatewayapi "github.com/moby/buildkit/frontend/gateway/pb"
+	"github.com/moby/buildkit/snapshot"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type bindMountable struct {
+	dir string
+}
+
+func (m *bindMountable) Mount(ctx context.Context, readonly bool) (snapshot.Mountable, error) {
+	return &bindMount{dir: m.dir}, nil
+}
+
+type bindMount struct {
+	dir string
+}
+
+func (m *bindMount) Mount() ([]mount.Mount, func() error, error) {
+	return []mount.Mount{{Type: "bind", Source: m.dir, Options: []string{"rbind"}}}, func() error { return nil }, nil
+}
+
+func (m *bindMount) IdentityMapping() *idtools.IdentityMapping {
+	return nil
+}
+
+type localExecutor struct {
+	runs int
+}
+
+func (e *localExecutor) Run(ctx context.Context, id string, root executor.Mount, mounts []executor.Mount, process executor.ProcessInfo, started chan<- struct{}) error {
+	e.runs++
+	return nil
+}
+
+func (e *localExecutor) Exec(ctx context.Context, id string, process executor.ProcessInfo) error {
+	return nil
+}
+
+// testService runs the process "true" by printing the contents of the root
+// and writing the file "out" to the second mount. The process "exit" exits
+// without reading the root it fetched. Other processes are declined.
+type testService struct {
+	UnimplementedExecutorServer
+	req *RunRequest
+}
+
+func (s *testService) Run(stream Executor_RunServer) error {
+	msg, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	s.req = msg.GetRun()
+	if s.req.Args[0] == "exit" {
+		if err := stream.Send(&ServerMessage{Message: &ServerMessage_Started{Started: &Started{}}}); err != nil {
+			return err
+		}
+		if err := stream.Send(&ServerMessage{Message: &ServerMessage_Fetch{Fetch: &FetchMount{Index: 0}}}); err != nil {
+			return err
+		}
+		return stream.Send(&ServerMessage{Message: &ServerMessage_Exit{Exit: &Exit{}}})
+	}
+	if s.req.Args[0] != "true" {
+		return status.Error(codes.Unimplemented, "declined")
+	}
+	if err := stream.Send(&ServerMessage{Message: &ServerMessage_Started{Started: &Started{}}}); err != nil {
+		return err
+	}
+	if err := stream.Send(&ServerMessage{Message: &ServerMessage_Fetch{Fetch: &FetchMount{Index: 0}}}); err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		buf.Write(msg.GetMount().Data)
+		if msg.GetMount().EOF {
+			break
+		}
+	}
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&ServerMessage{Message: &ServerMessage_Output{Output: &Output{Fd: 1, Data: []byte(hdr.Name + "\n")}}}); err != nil {
+			return err
+		}
+	}
+
+	diff := &bytes.Buffer{}
+	tw := tar.NewWriter(diff)
+	for name, dt := range map[string]string{"out": "result", ".wh.old": ""} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(dt)), Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(dt)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := stream.Send(&ServerMessage{Message: &ServerMessage_Diff{Diff: &MountData{Index: 1, Data: diff.Bytes(), EOF: true}}}); err != nil {
+		return err
+	}
+	return stream.Send(&ServerMessage{Message: &ServerMessage_Exit{Exit: &Exit{Code: 3}}})
+}
+
+func TestRun(t *testing.T) {
+	tmpdir := t.TempDir()
+	sock := filepath.Join(tmpdir, "executor.sock")
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	svc := &testService{}
+	RegisterExecutorServer(srv, svc)
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	rootDir := filepath.Join(tmpdir, "root")
+	require.NoError(t, os.MkdirAll(rootDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(rootDir, "foo"), []byte("foo"), 0644))
+	outDir := filepath.Join(tmpdir, "out")
+	require.NoError(t, os.MkdirAll(outDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outDir, "old"), []byte("old"), 0644))
+
+	local := &localExecutor{}
+	e, err := New(Opt{Address: "unix://" + sock}, local)
+	require.NoError(t, err)
+
+	stdout := &bytesWriteCloser{}
+	root := executor.Mount{Src: &bindMountable{dir: rootDir}, Readonly: true}
+	mounts := []executor.Mount{{Src: &bindMountable{dir: outDir}, Dest: "/out"}}
+	started := make(chan struct{})
+	err = e.Run(context.TODO(), "", root, mounts, executor.ProcessInfo{
+		Meta:   executor.Meta{Args: []string{"true"}, Env: []string{"HTTP_PROXY=http://proxy:3128"}, Cwd: "/"},
+		Stdout: stdout,
+	}, started)
+	var exitErr *gatewayapi.ExitError
+	require.True(t, errors.As(err, &exitErr))
+	require.Equal(t, uint32(3), exitErr.ExitCode)
+	<-started
+
+	require.Equal(t, 0, local.runs)
+	require.Equal(t, "/", svc.req.Mounts[0].Dest)
+	require.Equal(t, "/out", svc.req.Mounts[1].Dest)
+	require.Equal(t, []string{"HTTP_PROXY=http://proxy:3128"}, svc.req.Env)
+	require.Contains(t, stdout.String(), "foo\n")
+
+	dt, err := ioutil.ReadFile(filepath.Join(outDir, "out"))
+	require.NoError(t, err)
+	require.Equal(t, "result", string(dt))
+	_, err = os.Stat(filepath.Join(outDir, "old"))
+	require.True(t, os.IsNotExist(err))
+
+	// declined processes run locally
+	err = e.Run(context.TODO(), "", root, mounts, executor.ProcessInfo{
+		Meta: executor.Meta{Args: []string{"false"}},
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, local.runs)
+
+	// secrets are never sent to the service
+	secret := executor.Mount{Src: &bindMountable{dir: outDir}, Dest: "/run/secrets/token", Readonly: true, MountType: pb.MountType_SECRET}
+	err = e.Run(context.TODO(), "", root, append(mounts, secret), executor.ProcessInfo{
+		Meta: executor.Meta{Args: []string{"true"}},
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, local.runs)
+}
+
+func TestRunExitBeforeUpload(t *testing.T) {
+	tmpdir := t.TempDir()
+	sock := filepath.Join(tmpdir, "executor.sock")
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	RegisterExecutorServer(srv, &testService{})
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	rootDir := filepath.Join(tmpdir, "root")
+	require.NoError(t, os.MkdirAll(rootDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(rootDir, "foo"), bytes.Repeat([]byte("foo"), 4*1024*1024), 0644))
+
+	local := &localExecutor{}
+	e, err := New(Opt{Address: "unix://" + sock}, local)
+	require.NoError(t, err)
+
+	// the upload fails once the service has ended the stream, which doesn't
+	// fail the process that has already exited
+	root := executor.Mount{Src: &bindMountable{dir: rootDir}, Readonly: true}
+	for i := 0; i < 5; i++ {
+		err = e.Run(context.TODO(), "", root, nil, executor.ProcessInfo{
+			Meta: executor.Meta{Args: []string{"exit"}},
+		}, nil)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 0, local.runs)
+}
+
+func TestNewRequiresTLS(t *testing.T) {
+	_, err := New(Opt{Address: "tcp://executor.example.com:8443"}, &localExecutor{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "requires tls")
+
+	_, err = New(Opt{Address: "tcp://executor.example.com:8443", TLS: &tls.Config{}}, &localExecutor{})
+	require.NoError(t, err)
+}
+
+type bytesWriteCloser struct {
+	bytes.Buffer
+}
+
+func (*bytesWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,245 @@
+package runcexecutor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containerd/containerd/archive"
+	"github.com/containerd/containerd/mount"
+	runc "github.com/containerd/go-runc"
+	"github.com/moby/buildkit/executor"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/buildkit/util/overlay"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// checkpointer checkpoints a process periodically with CRIU so that a new
+// run of the process with the same checkpoint key continues from the latest
+// checkpoint, e.g. after the daemon was restarted. The checkpoint contains
+// the state of the process and the changes to the writable root filesystem,
+// read from the overlayfs upperdir. The key is the cache key of the step, so
+// the root filesystem of the new run has the same contents as the one the
+// changes were made to. Processes with other writable mounts, e.g. cache
+// mounts, are not checkpointed as their contents can be shared with other
+// processes. Neither are processes with secret or SSH mounts, as the dump of
+// the process would contain the secrets and the agent connections can't be
+// restored.
+type checkpointer struct {
+	w   *runcExecutor
+	dir string
+	// rootFSPath is the root filesystem of the process, empty if it is
+	// read-only
+	rootFSPath string
+	rootMount  []mount.Mount
+	upperdir   string
+	userxattr  bool
+	stopped    chan struct{}
+}
+
+// restoreError is returned if the process could not be restored from the
+// checkpoint, in which case it is run again from the start
+type restoreError struct {
+	error
+}
+
+func (e *restoreError) Unwrap() error {
+	return e.error
+}
+
+// checkpointMaxAge is the time after the last checkpoint that the checkpoints
+// of processes that weren't run again are removed in
+const checkpointMaxAge = 24 * time.Hour
+
+func (w *runcExecutor) checkpointer(root executor.Mount, rootMount []mount.Mount, mounts []executor.Mount, process executor.ProcessInfo, rootFSPath string) *checkpointer {
+	if w.checkpointEvery <= 0 || process.Meta.CheckpointKey == "" || process.Meta.Tty || process.Stdin != nil {
+		return nil
+	}
+	for _, m := range mounts {
+		if !m.Readonly || m.MountType == pb.MountType_SECRET || m.MountType == pb.MountType_SSH {
+			return nil
+		}
+	}
+	c := &checkpointer{
+		w:       w,
+		dir:     filepath.Join(w.root, "checkpoints", digest.FromString(process.Meta.CheckpointKey).Hex()),
+		stopped: make(chan struct{}),
+	}
+	if !root.Readonly {
+		// walking the whole root filesystem on every interval is too
+		// expensive, so only overlay roots are checkpointed
+		upperdir, userxattr, ok := overlay.Upperdir(rootMount)
+		if !ok {
+			return nil
+		}
+		c.rootFSPath = rootFSPath
+		c.rootMount = rootMount
+		c.upperdir = upperdir
+		c.userxattr = userxattr
+	}
+	return c
+}
+
+func (c *checkpointer) imagePath() string {
+	return filepath.Join(c.dir, "criu")
+}
+
+// restoreFS applies the changes of the latest checkpoint to the root
+// filesystem. It returns false if there is no checkpoint.
+func (c *checkpointer) restoreFS(ctx context.Context) (bool, error) {
+	if _, err := os.Stat(c.imagePath()); err != nil {
+		return false, nil
+	}
+	bklog.G(ctx).Infof("restoring process from checkpoint %s", c.dir)
+	if c.rootFSPath == "" {
+		return true, nil
+	}
+	if err := c.applyRootFS(ctx); err != nil {
+		os.RemoveAll(c.dir)
+		return false, errors.Wrapf(err, "failed to restore root filesystem from checkpoint %s", c.dir)
+	}
+	return true, nil
+}
+
+// resetFS discards the changes of the checkpoint that were applied to the
+// root filesystem by restoreFS, after the process failed to be restored. The
+// root filesystem of a step starts with an empty upperdir, so it is cleared
+// while the overlay is unmounted. The checkpoint is removed.
+func (c *checkpointer) resetFS(ctx context.Context) error {
+	if err := os.RemoveAll(c.dir); err != nil {
+		return errors.WithStack(err)
+	}
+	if c.rootFSPath == "" {
+		return nil
+	}
+	if err := mount.Unmount(c.rootFSPath, 0); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(c.upperdir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(c.upperdir, e.Name())); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return mount.All(c.rootMount, c.rootFSPath)
+}
+
+func (c *checkpointer) applyRootFS(ctx context.Context) error {
+	f, err := os.Open(filepath.Join(c.dir, "rootfs.diff.tar"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+	_, err = archive.Apply(ctx, c.rootFSPath, f)
+	return err
+}
+
+// run checkpoints the container id on every interval until ended is closed
+func (c *checkpointer) run(ctx context.Context, id string, ended <-chan struct{}) {
+	defer close(c.stopped)
+	ticker := time.NewTicker(c.w.checkpointEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ended:
+			return
+		case <-ticker.C:
+			start := time.Now()
+			if err := c.checkpoint(ctx, id); err != nil {
+				bklog.G(ctx).Warnf("failed to checkpoint %s: %v", id, err)
+				continue
+			}
+			bklog.G(ctx).Debugf("checkpointed %s in %s", id, time.Since(start))
+		}
+	}
+}
+
+// checkpoint writes a new checkpoint next to the current one and replaces it
+// when it is complete. The container is paused while the changes to the root
+// filesystem and the process are dumped, so that they are consistent.
+func (c *checkpointer) checkpoint(ctx context.Context, id string) (err error) {
+	tmp := c.dir + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.MkdirAll(tmp, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(tmp)
+		}
+	}()
+
+	if err := c.w.runc.Pause(ctx, id); err != nil {
+		return err
+	}
+	defer func() {
+		// the container is running already if the checkpoint succeeded
+		c.w.runc.Resume(context.TODO(), id)
+	}()
+
+	if c.rootFSPath != "" {
+		f, err := os.Create(filepath.Join(tmp, "rootfs.diff.tar"))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = overlay.WriteUpperdir(ctx, f, c.upperdir, c.rootFSPath, c.userxattr)
+		if err1 := f.Close(); err == nil {
+			err = err1
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to write root filesystem")
+		}
+	}
+
+	if err := c.w.runc.Checkpoint(ctx, id, &runc.CheckpointOpts{
+		ImagePath: filepath.Join(tmp, "criu"),
+		WorkDir:   filepath.Join(tmp, "work"),
+	}, runc.LeaveRunning); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(c.dir); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp, c.dir))
+}
+
+// finish removes the checkpoint once the process has completed. The
+// checkpoint is kept if the run was canceled.
+func (c *checkpointer) finish(ctx context.Context) {
+	<-c.stopped
+	if ctx.Err() != nil {
+		bklog.G(ctx).Infof("keeping checkpoint %s of canceled process", c.dir)
+		return
+	}
+	os.RemoveAll(c.dir + ".tmp")
+	os.RemoveAll(c.dir)
+	gcCheckpoints(ctx, filepath.Dir(c.dir), checkpointMaxAge)
+}
+
+// gcCheckpoints removes the checkpoints in dir that weren't updated in maxAge,
+// e.g. of canceled processes whose steps weren't run again
+func gcCheckpoints(ctx context.Context, dir string, maxAge time.Duration) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if time.Since(e.ModTime()) < maxAge {
+			continue
+		}
+		bklog.G(ctx).Debugf("removing expired checkpoint %s", e.Name())
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			bklog.G(ctx).Warnf("failed to remove expired checkpoint %s: %v", e.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package runcexecutor
+
+import (
+	"archive/tar"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/mount"
+	runc "github.com/containerd/go-runc"
+	"github.com/moby/buildkit/executor"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpointer(t *testing.T) {
+	w := &runcExecutor{root: t.TempDir()}
+	ro := executor.Mount{Readonly: true}
+	process := executor.ProcessInfo{Meta: executor.Meta{CheckpointKey: "sha256:abc"}}
+	require.Nil(t, w.checkpointer(ro, nil, nil, process, "/rootfs"))
+
+	w.checkpointEvery = time.Minute
+	c := w.checkpointer(ro, nil, nil, process, "/rootfs")
+	require.NotNil(t, c)
+	require.Empty(t, c.rootFSPath)
+	require.Equal(t, c.dir, w.checkpointer(ro, nil, nil, process, "/rootfs").dir)
+
+	require.Nil(t, w.checkpointer(ro, nil, []executor.Mount{{Dest: "/cache"}}, process, "/rootfs"))
+	require.NotNil(t, w.checkpointer(ro, nil, []executor.Mount{{Dest: "/src", Readonly: true}}, process, "/rootfs"))
+	require.Nil(t, w.checkpointer(ro, nil, nil, executor.ProcessInfo{}, "/rootfs"))
+
+	// the dumps would contain the secrets and agent connections
+	require.Nil(t, w.checkpointer(ro, nil, []executor.Mount{{Dest: "/run/secrets/foo", Readonly: true, MountType: pb.MountType_SECRET}}, process, "/rootfs"))
+	require.Nil(t, w.checkpointer(ro, nil, []executor.Mount{{Dest: "/run/buildkit/ssh_agent.0", Readonly: true, MountType: pb.MountType_SSH}}, process, "/rootfs"))
+
+	// the changes to writable roots are only read from overlay upperdirs
+	require.Nil(t, w.checkpointer(executor.Mount{}, []mount.Mount{{Type: "bind", Source: "/s/1/fs", Options: []string{"rbind"}}}, nil, process, "/rootfs"))
+}
+
+func TestCheckpointRestoreFS(t *testing.T) {
+	ctx := context.TODO()
+	tmpdir := t.TempDir()
+	w := &runcExecutor{root: filepath.Join(tmpdir, "executor"), checkpointEvery: time.Minute}
+
+	rootfs := filepath.Join(tmpdir, "rootfs")
+	require.NoError(t, os.MkdirAll(filepath.Join(rootfs, "src"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(rootfs, "src", "main.c"), []byte("source"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(rootfs, "input"), []byte("input"), 0644))
+
+	c := w.checkpointer(executor.Mount{Readonly: true}, nil, nil, executor.ProcessInfo{Meta: executor.Meta{CheckpointKey: "sha256:abc"}}, rootfs)
+	c.rootFSPath = rootfs
+	ok, err := c.restoreFS(ctx)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// a checkpoint as written by checkpoint, without the process dump
+	require.NoError(t, os.MkdirAll(c.imagePath(), 0700))
+	f, err := os.Create(filepath.Join(c.dir, "rootfs.diff.tar"))
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "src/main.o", Mode: 0644, Size: 6, Typeflag: tar.TypeReg}))
+	_, err = tw.Write([]byte("object"))
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: ".wh.input", Typeflag: tar.TypeReg}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	// the changes are applied to the root filesystem of the step's inputs
+	ok, err = c.restoreFS(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	dt, err := ioutil.ReadFile(filepath.Join(rootfs, "src", "main.o"))
+	require.NoError(t, err)
+	require.Equal(t, "object", string(dt))
+	dt, err = ioutil.ReadFile(filepath.Join(rootfs, "src", "main.c"))
+	require.NoError(t, err)
+	require.Equal(t, "source", string(dt))
+	_, err = os.Stat(filepath.Join(rootfs, "input"))
+	require.True(t, os.IsNotExist(err))
+
+	close(c.stopped)
+	c.finish(ctx)
+	_, err = os.Stat(c.dir)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestGCCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"old", "new"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, name, "criu"), 0700))
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "old"), old, old))
+
+	gcCheckpoints(context.TODO(), dir, time.Hour)
+	_, err := os.Stat(filepath.Join(dir, "old"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "new"))
+	require.NoError(t, err)
+}
+
+func TestRestoreError(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("restoring checkpoints is only supported on linux")
+	}
+	tmpdir := t.TempDir()
+	bundle := filepath.Join(tmpdir, "bundle")
+	require.NoError(t, os.MkdirAll(bundle, 0700))
+
+	// fake runc that restores the process if RESTORED is set, which exits
+	// with 2
+	runcPath := filepath.Join(tmpdir, "runc")
+	require.NoError(t, ioutil.WriteFile(runcPath, []byte(`#!/bin/sh
+while [ $# -gt 0 ]; do
+	if [ "$1" = "--pid-file" ]; then pidfile=$2; fi
+	shift
+done
+if [ -n "$RESTORED" ]; then echo 1 > "$pidfile"; exit 2; fi
+echo "criu failed" >&2
+exit 1
+`), 0755))
+	w := &runcExecutor{runc: &runc.Runc{Command: runcPath}}
+
+	err := w.restore(context.TODO(), "test", bundle, filepath.Join(tmpdir, "criu"), executor.ProcessInfo{})
+	var rerr *restoreError
+	require.True(t, errors.As(err, &rerr), "%+v", err)
+
+	// failures of the restored process are returned as they are
+	t.Setenv("RESTORED", "1")
+	err = w.restore(context.TODO(), "test", bundle, filepath.Join(tmpdir, "criu"), executor.ProcessInfo{})
+	require.Error(t, err)
+	require.False(t, errors.As(err, &rerr))
+	var exitErr *runc.ExitError
+	require.True(t, errors.As(err, &exitErr))
+	require.Equal(t, 2, exitErr.Status)
+}
+
+func TestCheckpointResetFS(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+	ctx := context.TODO()
+	tmpdir := t.TempDir()
+	for _, d := range []string{"lower", "upper", "work", "rootfs"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(tmpdir, d), 0755))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpdir, "lower", "input"), []byte("input"), 0644))
+	rootMount := []mount.Mount{{
+		Type:    "overlay",
+		Source:  "overlay",
+		Options: []string{"lowerdir=" + filepath.Join(tmpdir, "lower"), "upperdir=" + filepath.Join(tmpdir, "upper"), "workdir=" + filepath.Join(tmpdir, "work")},
+	}}
+	rootfs := filepath.Join(tmpdir, "rootfs")
+	if err := mount.All(rootMount, rootfs); err != nil {
+		t.Skipf("overlay not supported: %v", err)
+	}
+	defer mount.Unmount(rootfs, 0)
+
+	w := &runcExecutor{root: filepath.Join(tmpdir, "executor"), checkpointEvery: time.Minute}
+	c := w.checkpointer(executor.Mount{}, rootMount, nil, executor.ProcessInfo{Meta: executor.Meta{CheckpointKey: "sha256:abc"}}, rootfs)
+	require.NotNil(t, c)
+	require.NoError(t, os.MkdirAll(c.imagePath(), 0700))
+
+	// changes of the checkpoint applied before the restore failed
+	require.NoError(t, ioutil.WriteFile(filepath.Join(rootfs, "output"), []byte("output"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(rootfs, "input")))
+
+	require.NoError(t, c.resetFS(ctx))
+	_, err := os.Stat(filepath.Join(rootfs, "output"))
+	require.True(t, os.IsNotExist(err))
+	dt, err := ioutil.ReadFile(filepath.Join(rootfs, "input"))
+	require.NoError(t, err)
+	require.Equal(t, "input", string(dt))
+	_, err = os.Stat(c.dir)
+	require.True(t, os.IsNotExist(err))
+}
@@ -48,6 +48,9 @@ type Opt struct {
 	OOMScoreAdj     *int
 	ApparmorProfile string
 	TracingSocket   string
+	// CheckpointInterval is the interval processes with a checkpoint key are
+	// checkpointed in with CRIU. 0 disables checkpointing.
+	CheckpointInterval time.Duration
 }
 
 var defaultCommandCandidates = []string{"buildkit-runc", "runc"}
@@ -67,6 +70,7 @@ type runcExecutor struct {
 	mu               sync.Mutex
 	apparmorProfile  string
 	tracingSocket    string
+	checkpointEvery  time.Duration
 }
 
 func New(opt Opt, networkProviders map[pb.NetMode]network.Provider) (executor.Executor, error) {
@@ -105,6 +109,7 @@ func New(opt Opt, networkProviders map[pb.NetMode]network.Provider) (executor.Ex
 	// clean up old hosts/resolv.conf file. ignore errors
 	os.RemoveAll(filepath.Join(root, "hosts"))
 	os.RemoveAll(filepath.Join(root, "resolv.conf"))
+	gcCheckpoints(context.TODO(), filepath.Join(root, "checkpoints"), checkpointMaxAge)
 
 	runtime := &runc.Runc{
 		Command:   cmd,
@@ -131,6 +136,7 @@ func New(opt Opt, networkProviders map[pb.NetMode]network.Provider) (executor.Ex
 		running:          make(map[string]chan error),
 		apparmorProfile:  opt.ApparmorProfile,
 		tracingSocket:    opt.TracingSocket,
+		checkpointEvery:  opt.CheckpointInterval,
 	}
 	return w, nil
 }
@@ -220,12 +226,21 @@ func (w *runcExecutor) Run(ctx context.Context, id string, root executor.Mount,
 	}
 	defer mount.Unmount(rootFSPath, 0)
 
+	ck := w.checkpointer(root, rootMount, mounts, process, rootFSPath)
+	restore := false
+	if ck != nil {
+		if restore, err = ck.restoreFS(ctx); err != nil {
+			return err
+		}
+	}
+
 	defer executor.MountStubsCleaner(rootFSPath, mounts)()
 
 	uid, gid, sgids, err := oci.GetUser(rootFSPath, meta.User)
 	if err != nil {
 		return err
 	}
+	sgids = append(sgids, meta.AdditionalGids...)
 
 	f, err := os.Create(filepath.Join(bundle, "config.json"))
 	if err != nil {
@@ -271,14 +286,20 @@ func (w *runcExecutor) Run(ctx context.Context, id string, root executor.Mount,
 		spec.Root.Readonly = true
 	}
 
-	newp, err := fs.RootPath(rootFSPath, meta.Cwd)
-	if err != nil {
-		return errors.Wrapf(err, "working dir %s points to invalid target", newp)
-	}
-	if _, err := os.Stat(newp); err != nil {
-		if err := idtools.MkdirAllAndChown(newp, 0755, identity); err != nil {
-			return errors.Wrapf(err, "failed to create working directory %s", newp)
+	mkdirCwd := func() error {
+		newp, err := fs.RootPath(rootFSPath, meta.Cwd)
+		if err != nil {
+			return errors.Wrapf(err, "working dir %s points to invalid target", newp)
+		}
+		if _, err := os.Stat(newp); err != nil {
+			if err := idtools.MkdirAllAndChown(newp, 0755, identity); err != nil {
+				return errors.Wrapf(err, "failed to create working directory %s", newp)
+			}
 		}
+		return nil
+	}
+	if err := mkdirCwd(); err != nil {
+		return err
 	}
 
 	spec.Process.Terminal = meta.Tty
@@ -333,9 +354,29 @@ func (w *runcExecutor) Run(ctx context.Context, id string, root executor.Mount,
 		})
 	}
 
-	err = w.run(runCtx, id, bundle, process)
+	if ck != nil {
+		go ck.run(runCtx, id, ended)
+	}
+	oomCounter := oci.NewOOMCounter(w.cgroupParent)
+	if restore {
+		err = w.restore(runCtx, id, bundle, ck.imagePath(), process)
+		var rerr *restoreError
+		if errors.As(err, &rerr) {
+			bklog.G(ctx).Warnf("failed to restore %s from checkpoint, running it again: %v", id, err)
+			if err = ck.resetFS(ctx); err == nil {
+				if err = mkdirCwd(); err == nil {
+					err = w.run(runCtx, id, bundle, process)
+				}
+			}
+		}
+	} else {
+		err = w.run(runCtx, id, bundle, process)
+	}
 	close(ended)
-	return exitError(ctx, err)
+	if ck != nil {
+		ck.finish(ctx)
+	}
+	return oomCounter.WithCode(exitError(ctx, err))
 }
 
 func exitError(ctx context.Context, err error) error {
@@ -411,7 +452,7 @@ func (w *runcExecutor) Exec(ctx context.Context, id string, process executor.Pro
 		spec.Process.User = specs.User{
 			UID:            uid,
 			GID:            gid,
-			AdditionalGids: sgids,
+			AdditionalGids: append(sgids, process.Meta.AdditionalGids...),
 		}
 	}
 
@@ -26,6 +26,10 @@ func (w *runcExecutor) run(ctx context.Context, id, bundle string, process execu
 	return err
 }
 
+func (w *runcExecutor) restore(ctx context.Context, id, bundle, imagePath string, process executor.ProcessInfo) error {
+	return &restoreError{errors.New("restoring checkpoints is only supported on linux")}
+}
+
 func (w *runcExecutor) exec(ctx context.Context, id, bundle string, specsProcess *specs.Process, process executor.ProcessInfo) error {
 	if process.Meta.Tty {
 		return unsupportedConsoleError
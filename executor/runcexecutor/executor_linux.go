@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"os"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -33,6 +34,30 @@ func (w *runcExecutor) run(ctx context.Context, id, bundle string, process execu
 	})
 }
 
+// restore restores the process from the checkpoint at imagePath and waits
+// for it to exit. A restoreError is returned if the process wasn't restored.
+func (w *runcExecutor) restore(ctx context.Context, id, bundle, imagePath string, process executor.ProcessInfo) error {
+	// runc writes the pid file once the process is restored
+	pidFile := filepath.Join(bundle, "restore.pid")
+	err := w.callWithIO(ctx, id, bundle, process, func(ctx context.Context, started chan<- int, io runc.IO) error {
+		_, err := w.runc.Restore(ctx, id, bundle, &runc.RestoreOpts{
+			CheckpointOpts: runc.CheckpointOpts{
+				ImagePath: imagePath,
+			},
+			IO:      io,
+			PidFile: pidFile,
+			NoPivot: w.noPivot,
+		})
+		return err
+	})
+	if err != nil {
+		if _, serr := os.Stat(pidFile); serr != nil {
+			return &restoreError{err}
+		}
+	}
+	return err
+}
+
 func (w *runcExecutor) exec(ctx context.Context, id, bundle string, specsProcess *specs.Process, process executor.ProcessInfo) error {
 	return w.callWithIO(ctx, id, bundle, process, func(ctx context.Context, started chan<- int, io runc.IO) error {
 		return w.runc.Exec(ctx, id, *specsProcess, &runc.ExecOpts{
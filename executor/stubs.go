@@ -4,11 +4,16 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
 
 	"github.com/containerd/continuity/fs"
 )
 
+// MountStubsCleaner returns a function that removes the stubs of the mount
+// destinations that the runtime creates in dir, with their parent
+// directories that didn't exist before
 func MountStubsCleaner(dir string, mounts []Mount) func() {
 	names := []string{"/etc/resolv.conf", "/etc/hosts"}
 
@@ -28,21 +33,34 @@ func MountStubsCleaner(dir string, mounts []Mount) func() {
 			continue
 		}
 
-		_, err = os.Lstat(realPath)
-		if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		for {
+			_, err = os.Lstat(realPath)
+			if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, syscall.ENOTDIR) {
+				break
+			}
 			paths = append(paths, realPath)
+			realPath = filepath.Dir(realPath)
+			if realPath == dir || !strings.HasPrefix(realPath, dir) {
+				break
+			}
 		}
 	}
 
+	// parents are removed after the stubs of all the mounts in them
+	sort.Slice(paths, func(i, j int) bool {
+		return len(paths[i]) > len(paths[j])
+	})
+
 	return func() {
 		for _, p := range paths {
 			st, err := os.Lstat(p)
 			if err != nil {
 				continue
 			}
-			if st.Size() != 0 {
+			if !st.IsDir() && st.Size() != 0 {
 				continue
 			}
+			// directories that aren't empty fail to be removed
 			os.Remove(p)
 		}
 	}
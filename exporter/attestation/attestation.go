@@ -0,0 +1,118 @@
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MediaTypeInToto is the media type of in-toto statement layers of
+	// attestation manifests
+	MediaTypeInToto = "application/vnd.in-toto+json"
+	// StatementType is the type of in-toto statements
+	StatementType = "https://in-toto.io/Statement/v0.1"
+	// PredicateTypeSPDX is the predicate type of SPDX SBOM documents
+	PredicateTypeSPDX = "https://spdx.dev/Document"
+
+	// AnnotationPredicateType is set on statement layers to their predicate type
+	AnnotationPredicateType = "in-toto.io/predicate-type"
+	// AnnotationReferenceType is set on the index descriptor of attestation
+	// manifests
+	AnnotationReferenceType = "vnd.docker.reference.type"
+	// AnnotationReferenceDigest is the digest of the image manifest an
+	// attestation manifest refers to
+	AnnotationReferenceDigest = "vnd.docker.reference.digest"
+	// ReferenceTypeAttestation is the value of AnnotationReferenceType for
+	// attestation manifests
+	ReferenceTypeAttestation = "attestation-manifest"
+)
+
+// Statement is an in-toto statement
+type Statement struct {
+	Type          string          `json:"_type"`
+	PredicateType string          `json:"predicateType"`
+	Subject       []Subject       `json:"subject"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// Subject is an artifact a statement is about
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Scanner generates an SBOM for a root filesystem
+type Scanner interface {
+	// Scan returns the SBOM for the root filesystem mounted at root as an
+	// in-toto predicate
+	Scan(ctx context.Context, root string) (predicateType string, predicate []byte, err error)
+}
+
+// RootPlaceholder is replaced by the path of the scanned root filesystem in
+// the args of CommandScanner
+const RootPlaceholder = "{root}"
+
+// CommandScanner runs a command that writes the SBOM of a root filesystem
+// as JSON to stdout. The command is run sandboxed as nobody without network
+// and with only PATH, HOME and TMPDIR set, so files of the root filesystem
+// that aren't world-readable are left out of the SBOM.
+type CommandScanner struct {
+	// Args are the command and its arguments. RootPlaceholder is replaced
+	// by the path of the root filesystem.
+	Args []string
+	// PredicateType is the in-toto predicate type of the command output
+	PredicateType string
+}
+
+// DefaultSBOMScanner generates SPDX documents with syft
+var DefaultSBOMScanner Scanner = &CommandScanner{
+	Args:          []string{"syft", "dir:" + RootPlaceholder, "--output", "spdx-json", "--quiet"},
+	PredicateType: PredicateTypeSPDX,
+}
+
+func (s *CommandScanner) Scan(ctx context.Context, root string) (string, []byte, error) {
+	if len(s.Args) == 0 {
+		return "", nil, errors.New("no sbom scanner command configured")
+	}
+	args := make([]string, len(s.Args))
+	for i, a := range s.Args {
+		args[i] = strings.ReplaceAll(a, RootPlaceholder, root)
+	}
+	p, err := exec.LookPath(args[0])
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "sbom scanner %s not available", args[0])
+	}
+	home, err := ioutil.TempDir("", "buildkit-sbom-home")
+	if err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+	defer os.RemoveAll(home)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p, args[1:]...)
+	cmd.Dir = home
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + home, "TMPDIR=" + home}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := sandbox(cmd, home); err != nil {
+		return "", nil, err
+	}
+	if err := cmd.Run(); err != nil {
+		return "", nil, errors.Wrapf(err, "sbom scanner %s failed: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	if !json.Valid(stdout.Bytes()) {
+		return "", nil, errors.Errorf("sbom scanner %s returned invalid JSON", args[0])
+	}
+	predicateType := s.PredicateType
+	if predicateType == "" {
+		predicateType = PredicateTypeSPDX
+	}
+	return predicateType, stdout.Bytes(), nil
+}
@@ -0,0 +1,59 @@
+package attestation
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandScanner(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("requires root on linux")
+	}
+	t.Setenv("BUILDKIT_TEST_SECRET", "secret")
+
+	s := &CommandScanner{
+		Args:          []string{"sh", "-c", `echo "{\"root\": \"$0\", \"uid\": \"$(id -u)\", \"secret\": \"$BUILDKIT_TEST_SECRET\", \"links\": \"$(tail -n +3 /proc/net/dev | cut -d: -f1 | tr -d ' \n')\"}"`, RootPlaceholder},
+		PredicateType: "https://example.com/sbom",
+	}
+	root := t.TempDir()
+	// readable by nobody
+	require.NoError(t, os.Chmod(filepath.Dir(root), 0755))
+	require.NoError(t, os.Chmod(root, 0755))
+	pt, dt, err := s.Scan(context.TODO(), root)
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/sbom", pt)
+	var v struct {
+		Root   string `json:"root"`
+		UID    string `json:"uid"`
+		Secret string `json:"secret"`
+		Links  string `json:"links"`
+	}
+	require.NoError(t, json.Unmarshal(dt, &v))
+	require.Equal(t, root, v.Root)
+
+	// the scanner is sandboxed
+	require.Equal(t, "65534", v.UID)
+	require.Equal(t, "", v.Secret)
+	require.Equal(t, "lo", v.Links)
+
+	s = &CommandScanner{Args: []string{"sh", "-c", "echo not json"}}
+	_, _, err = s.Scan(context.TODO(), root)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid JSON")
+
+	s = &CommandScanner{Args: []string{"sh", "-c", "echo broken >&2; exit 1"}}
+	_, _, err = s.Scan(context.TODO(), root)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "broken")
+
+	s = &CommandScanner{Args: []string{"buildkit-no-such-scanner"}}
+	_, _, err = s.Scan(context.TODO(), root)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not available")
+}
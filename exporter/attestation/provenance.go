@@ -0,0 +1,77 @@
+package attestation
+
+import (
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+const (
+	// PredicateTypeSLSAProvenance is the predicate type of SLSA provenance
+	PredicateTypeSLSAProvenance = "https://slsa.dev/provenance/v0.2"
+	// BuildTypeBuildKit is the build type of provenance created by BuildKit
+	BuildTypeBuildKit = "https://mobyproject.org/buildkit@v1"
+)
+
+// ProvenancePredicate is a SLSA provenance predicate describing a build
+type ProvenancePredicate struct {
+	Builder     ProvenanceBuilder      `json:"builder"`
+	BuildType   string                 `json:"buildType"`
+	Invocation  ProvenanceInvocation   `json:"invocation"`
+	BuildConfig *ProvenanceBuildConfig `json:"buildConfig,omitempty"`
+	Metadata    *ProvenanceMetadata    `json:"metadata,omitempty"`
+	Materials   []ProvenanceMaterial   `json:"materials,omitempty"`
+}
+
+// ProvenanceBuilder identifies the builder of an artifact
+type ProvenanceBuilder struct {
+	ID string `json:"id"`
+}
+
+// ProvenanceInvocation describes how the build was started
+type ProvenanceInvocation struct {
+	Parameters ProvenanceParameters `json:"parameters"`
+}
+
+// ProvenanceParameters are the parameters of the solve request
+type ProvenanceParameters struct {
+	// Frontend is the frontend of the build, empty for LLB builds
+	Frontend string `json:"frontend,omitempty"`
+	// Args are the frontend options, e.g. build args
+	Args map[string]string `json:"args,omitempty"`
+	// Locals are the names of the local sources of the build
+	Locals []string `json:"locals,omitempty"`
+}
+
+// ProvenanceBuildConfig describes the solve graph of the build
+type ProvenanceBuildConfig struct {
+	Steps []ProvenanceStep `json:"llbDefinition,omitempty"`
+}
+
+// ProvenanceStep is a vertex of the solve graph
+type ProvenanceStep struct {
+	ID     digest.Digest   `json:"id"`
+	Op     string          `json:"op"`
+	Inputs []digest.Digest `json:"inputs,omitempty"`
+}
+
+// ProvenanceMetadata contains timestamps and completeness claims
+type ProvenanceMetadata struct {
+	BuildStartedOn  *time.Time             `json:"buildStartedOn,omitempty"`
+	BuildFinishedOn *time.Time             `json:"buildFinishedOn,omitempty"`
+	Completeness    ProvenanceCompleteness `json:"completeness"`
+	Reproducible    bool                   `json:"reproducible"`
+}
+
+// ProvenanceCompleteness tells which parts of the provenance are complete
+type ProvenanceCompleteness struct {
+	Parameters  bool `json:"parameters"`
+	Environment bool `json:"environment"`
+	Materials   bool `json:"materials"`
+}
+
+// ProvenanceMaterial is a source of the build
+type ProvenanceMaterial struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
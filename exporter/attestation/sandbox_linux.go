@@ -0,0 +1,29 @@
+package attestation
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// sandboxID is the user and group the scanner runs as, nobody on most
+// distributions
+const sandboxID = 65534
+
+// sandbox runs cmd as nobody in new network, pid, ipc and uts namespaces,
+// so that a scanner exploited by the scanned content can't reach the
+// network, other processes or the files of the daemon. home is made
+// writable for the scanner.
+func sandbox(cmd *exec.Cmd, home string) error {
+	if err := os.Chown(home, sandboxID, sandboxID); err != nil {
+		return errors.WithStack(err)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWNET | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		Credential: &syscall.Credential{Uid: sandboxID, Gid: sandboxID},
+		Pdeathsig:  syscall.SIGKILL,
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+// +build !linux
+
+package attestation
+
+import (
+	"os/exec"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+func sandbox(cmd *exec.Cmd, home string) error {
+	return errors.Errorf("sbom scanners can't be sandboxed on %s", runtime.GOOS)
+}
@@ -0,0 +1,57 @@
+package containerimage
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	keyAnnotationPrefix         = "annotation."
+	keyAnnotationManifestPrefix = "annotation-manifest."
+	keyAnnotationIndexPrefix    = "annotation-index."
+)
+
+// Annotations are the OCI annotations set on the exported image manifests and
+// index
+type Annotations struct {
+	Manifest map[string]string
+	Index    map[string]string
+}
+
+// ParseAnnotations parses the annotation attrs of the image exporters.
+// "annotation.<key>" and "annotation-manifest.<key>" set manifest
+// annotations, "annotation-index.<key>" sets index annotations. The attrs
+// that aren't annotations are returned.
+func ParseAnnotations(opt map[string]string) (Annotations, map[string]string, error) {
+	var a Annotations
+	rest := make(map[string]string, len(opt))
+	for k, v := range opt {
+		var m *map[string]string
+		var key string
+		switch {
+		case strings.HasPrefix(k, keyAnnotationManifestPrefix):
+			m, key = &a.Manifest, strings.TrimPrefix(k, keyAnnotationManifestPrefix)
+		case strings.HasPrefix(k, keyAnnotationIndexPrefix):
+			m, key = &a.Index, strings.TrimPrefix(k, keyAnnotationIndexPrefix)
+		case strings.HasPrefix(k, keyAnnotationPrefix):
+			m, key = &a.Manifest, strings.TrimPrefix(k, keyAnnotationPrefix)
+		default:
+			rest[k] = v
+			continue
+		}
+		if key == "" {
+			return Annotations{}, nil, errors.Errorf("missing annotation key in %q", k)
+		}
+		if *m == nil {
+			*m = map[string]string{}
+		}
+		(*m)[key] = v
+	}
+	return a, rest, nil
+}
+
+// IsEmpty returns true if no annotations are set
+func (a Annotations) IsEmpty() bool {
+	return len(a.Manifest) == 0 && len(a.Index) == 0
+}
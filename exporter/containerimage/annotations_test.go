@@ -0,0 +1,33 @@
+package containerimage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAnnotations(t *testing.T) {
+	a, rest, err := ParseAnnotations(map[string]string{
+		"name": "docker.io/library/foo",
+		"annotation.org.opencontainers.image.title":         "foo",
+		"annotation-manifest.com.example.manifest":          "m",
+		"annotation-index.org.opencontainers.image.created": "2021-01-01T00:00:00Z",
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"name": "docker.io/library/foo"}, rest)
+	require.Equal(t, map[string]string{
+		"org.opencontainers.image.title": "foo",
+		"com.example.manifest":           "m",
+	}, a.Manifest)
+	require.Equal(t, map[string]string{
+		"org.opencontainers.image.created": "2021-01-01T00:00:00Z",
+	}, a.Index)
+	require.False(t, a.IsEmpty())
+
+	a, _, err = ParseAnnotations(map[string]string{"push": "true"})
+	require.NoError(t, err)
+	require.True(t, a.IsEmpty())
+
+	_, _, err = ParseAnnotations(map[string]string{"annotation-index.": "foo"})
+	require.Error(t, err)
+}
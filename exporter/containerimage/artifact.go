@@ -0,0 +1,154 @@
+package containerimage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/util/compression"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	manifestTypeImage    = "image"
+	manifestTypeArtifact = "artifact"
+)
+
+// Artifact selects exporting the result as an OCI artifact that isn't a
+// runnable image
+type Artifact struct {
+	// Type is the artifactType of the manifest
+	Type string
+	// Manifest is set by manifest-type=artifact. The OCI artifact manifest
+	// was removed from the image spec 1.1, so artifacts are always written as
+	// image manifests with artifactType as the spec describes instead.
+	Manifest bool
+}
+
+func (a Artifact) IsEmpty() bool {
+	return a.Type == ""
+}
+
+// Validate checks the artifact settings against the other exporter attrs
+func (a Artifact) Validate(oci, wasm bool, attest Attestations, configPatch ConfigPatch, squash bool) error {
+	if a.IsEmpty() {
+		if a.Manifest {
+			return errors.Errorf("%s=%s requires %s", keyManifestType, manifestTypeArtifact, keyArtifactType)
+		}
+		return nil
+	}
+	if !oci {
+		return errors.Errorf("artifacts are only supported with OCI media types")
+	}
+	if wasm {
+		return errors.Errorf("%s and %s can't be combined", keyArtifactType, keyWasm)
+	}
+	if !attest.IsEmpty() {
+		return errors.Errorf("attestations are not supported for artifacts")
+	}
+	if !configPatch.IsEmpty() {
+		return errors.Errorf("image config attrs are not supported for artifacts")
+	}
+	if squash {
+		return errors.Errorf("%s is not supported for artifacts", keySquash)
+	}
+	return nil
+}
+
+// ParseManifestType parses the manifest-type exporter attr and returns true
+// for manifest-type=artifact
+func ParseManifestType(v string) (bool, error) {
+	switch v {
+	case "", manifestTypeImage:
+		return false, nil
+	case manifestTypeArtifact:
+		return true, nil
+	default:
+		return false, errors.Errorf("invalid value %q for %s, expected %s or %s", v, keyManifestType, manifestTypeImage, manifestTypeArtifact)
+	}
+}
+
+// CommitArtifact writes an image manifest with the layers of the result and
+// the artifactType of artifact. The manifest gets the empty config, as the
+// result isn't a runnable image.
+func (ic *ImageWriter) CommitArtifact(ctx context.Context, inp exporter.Source, artifact Artifact, comp compression.Config, annotations map[string]string, epoch *time.Time, sessionID string) (*ocispecs.Descriptor, error) {
+	if len(inp.Refs) > 0 {
+		return nil, errors.Errorf("artifact export does not support multiple results")
+	}
+	if comp.Type == compression.Nydus {
+		return nil, errors.Errorf("artifact export does not support %s compression", comp.Type)
+	}
+
+	remotes, err := ic.exportLayers(ctx, comp, epoch, false, session.NewGroup(sessionID), inp.Ref)
+	if err != nil {
+		return nil, err
+	}
+	var layers []ocispecs.Descriptor
+	labels := map[string]string{}
+	for _, desc := range remotes[0].Descriptors {
+		desc = exportedLayerDescriptor(desc, true)
+		layers = append(layers, desc)
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.%d", len(labels))] = desc.Digest.String()
+	}
+
+	config := []byte("{}")
+	configDesc := ocispecs.Descriptor{
+		Digest:    digest.FromBytes(config),
+		Size:      int64(len(config)),
+		MediaType: exptypes.MediaTypeEmptyJSON,
+	}
+	if err := content.WriteBlob(ctx, ic.opt.ContentStore, configDesc.Digest.String(), bytes.NewReader(config), configDesc); err != nil {
+		return nil, errors.Wrap(err, "error writing config blob")
+	}
+	labels[fmt.Sprintf("containerd.io/gc.ref.content.%d", len(labels))] = configDesc.Digest.String()
+	if layers == nil {
+		// the image spec requires at least one layer
+		layers = []ocispecs.Descriptor{configDesc}
+	}
+	mediaType := ocispecs.MediaTypeImageManifest
+	mfst := struct {
+		// MediaType is reserved in the OCI spec but
+		// excluded from go types.
+		MediaType string `json:"mediaType,omitempty"`
+		// ArtifactType was added in OCI 1.1
+		ArtifactType string `json:"artifactType,omitempty"`
+
+		ocispecs.Manifest
+	}{
+		MediaType:    mediaType,
+		ArtifactType: artifact.Type,
+		Manifest: ocispecs.Manifest{
+			Versioned: specs.Versioned{
+				SchemaVersion: 2,
+			},
+			Config:      configDesc,
+			Layers:      layers,
+			Annotations: annotations,
+		},
+	}
+
+	mfstJSON, err := json.MarshalIndent(mfst, "", "   ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal manifest")
+	}
+	mfstDesc := ocispecs.Descriptor{
+		Digest:    digest.FromBytes(mfstJSON),
+		Size:      int64(len(mfstJSON)),
+		MediaType: mediaType,
+	}
+	mfstDone := oneOffProgress(ctx, "exporting artifact manifest "+mfstDesc.Digest.String())
+	if err := content.WriteBlob(ctx, ic.opt.ContentStore, mfstDesc.Digest.String(), bytes.NewReader(mfstJSON), mfstDesc, content.WithLabels(labels)); err != nil {
+		return nil, mfstDone(errors.Wrapf(err, "error writing manifest blob %s", mfstDesc.Digest))
+	}
+	mfstDone(nil)
+	return &mfstDesc, nil
+}
@@ -0,0 +1,79 @@
+package containerimage
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/util/compression"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitArtifact(t *testing.T) {
+	ctx := context.TODO()
+	cs, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+	ic := &ImageWriter{opt: WriterOpt{ContentStore: cs}}
+
+	annotations := map[string]string{"org.opencontainers.image.title": "bundle"}
+	desc, err := ic.CommitArtifact(ctx, exporter.Source{}, Artifact{Type: "application/vnd.example.bundle"}, compression.New(compression.Default), annotations, nil, "")
+	require.NoError(t, err)
+	require.Equal(t, ocispecs.MediaTypeImageManifest, desc.MediaType)
+
+	dt, err := content.ReadBlob(ctx, cs, *desc)
+	require.NoError(t, err)
+	var mfst struct {
+		ArtifactType string `json:"artifactType"`
+		ocispecs.Manifest
+	}
+	require.NoError(t, json.Unmarshal(dt, &mfst))
+	require.Equal(t, "application/vnd.example.bundle", mfst.ArtifactType)
+	require.Equal(t, exptypes.MediaTypeEmptyJSON, mfst.Config.MediaType)
+	require.Equal(t, annotations, mfst.Annotations)
+	// results without layers get the empty descriptor as layer
+	require.Len(t, mfst.Layers, 1)
+	require.Equal(t, mfst.Config.Digest, mfst.Layers[0].Digest)
+
+	dt, err = content.ReadBlob(ctx, cs, mfst.Config)
+	require.NoError(t, err)
+	require.Equal(t, "{}", string(dt))
+
+	// manifest-type=artifact writes an image manifest with artifactType too
+	desc, err = ic.CommitArtifact(ctx, exporter.Source{}, Artifact{Type: "application/vnd.example.bundle", Manifest: true}, compression.New(compression.Default), nil, nil, "")
+	require.NoError(t, err)
+	require.Equal(t, ocispecs.MediaTypeImageManifest, desc.MediaType)
+
+	dt, err = content.ReadBlob(ctx, cs, *desc)
+	require.NoError(t, err)
+	var amfst map[string]interface{}
+	require.NoError(t, json.Unmarshal(dt, &amfst))
+	require.Equal(t, ocispecs.MediaTypeImageManifest, amfst["mediaType"])
+	require.Equal(t, "application/vnd.example.bundle", amfst["artifactType"])
+	_, ok := amfst["config"]
+	require.True(t, ok)
+	_, ok = amfst["blobs"]
+	require.False(t, ok)
+}
+
+func TestArtifactValidate(t *testing.T) {
+	require.NoError(t, Artifact{}.Validate(false, true, Attestations{SBOM: true}, ConfigPatch{}, true))
+	require.Error(t, Artifact{Manifest: true}.Validate(true, false, Attestations{}, ConfigPatch{}, false))
+
+	a := Artifact{Type: "application/vnd.example.bundle"}
+	require.NoError(t, a.Validate(true, false, Attestations{}, ConfigPatch{}, false))
+	require.Error(t, a.Validate(false, false, Attestations{}, ConfigPatch{}, false))
+	require.Error(t, a.Validate(true, true, Attestations{}, ConfigPatch{}, false))
+	require.Error(t, a.Validate(true, false, Attestations{Provenance: true}, ConfigPatch{}, false))
+	require.Error(t, a.Validate(true, false, Attestations{}, ConfigPatch{}, true))
+
+	_, err := ParseManifestType("foo")
+	require.Error(t, err)
+	b, err := ParseManifestType(manifestTypeArtifact)
+	require.NoError(t, err)
+	require.True(t, b)
+}
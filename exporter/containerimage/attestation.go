@@ -0,0 +1,380 @@
+package containerimage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/exporter/attestation"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/snapshot"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/util/filemanifest"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// Attestations selects the attestations attached to the image manifests
+type Attestations struct {
+	SBOM       bool
+	Provenance bool
+	// FileManifest attaches the file manifest of the layers of the image,
+	// see the filemanifest package
+	FileManifest bool
+}
+
+func (a Attestations) IsEmpty() bool {
+	return !a.SBOM && !a.Provenance && !a.FileManifest
+}
+
+// commitAttestationManifest writes an attestation manifest for the image
+// manifest target. The SBOM is generated by scanning the root filesystem
+// of ref, provenance is the SLSA provenance predicate of the build. remote
+// has the layers of target.
+func (ic *ImageWriter) commitAttestationManifest(ctx context.Context, ref cache.ImmutableRef, remote *solver.Remote, target ocispecs.Descriptor, attest Attestations, provenance []byte, sessionID string) (*ocispecs.Descriptor, error) {
+	var layers []ocispecs.Descriptor
+	if attest.SBOM {
+		predicateType, predicate, err := ic.scanRef(ctx, ref, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		desc, err := ic.writeStatement(ctx, target, predicateType, predicate)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, *desc)
+	}
+	if attest.Provenance {
+		if len(provenance) == 0 {
+			return nil, errors.New("no provenance available for the build")
+		}
+		desc, err := ic.writeStatement(ctx, target, attestation.PredicateTypeSLSAProvenance, provenance)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, *desc)
+	}
+	if attest.FileManifest {
+		predicate, err := ic.fileManifest(ctx, remote, target)
+		if err != nil {
+			return nil, err
+		}
+		desc, err := ic.writeStatement(ctx, target, filemanifest.PredicateType, predicate)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, *desc)
+	}
+
+	return ic.commitReferrerManifest(ctx, target, layers, attestation.ReferenceTypeAttestation, "exporting attestation manifest ")
+}
+
+// commitReferrerManifest writes a manifest with platform unknown/unknown
+// containing layers that refers to the image manifest target with the
+// reference type annotations
+func (ic *ImageWriter) commitReferrerManifest(ctx context.Context, target ocispecs.Descriptor, layers []ocispecs.Descriptor, referenceType, progressPrefix string) (*ocispecs.Descriptor, error) {
+	diffIDs := make([]digest.Digest, 0, len(layers))
+	for _, l := range layers {
+		diffIDs = append(diffIDs, l.Digest)
+	}
+
+	config, err := json.Marshal(ocispecs.Image{
+		Architecture: "unknown",
+		OS:           "unknown",
+		RootFS: ocispecs.RootFS{
+			Type:    "layers",
+			DiffIDs: diffIDs,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal referrer config")
+	}
+	configDesc := ocispecs.Descriptor{
+		Digest:    digest.FromBytes(config),
+		Size:      int64(len(config)),
+		MediaType: ocispecs.MediaTypeImageConfig,
+	}
+	if err := content.WriteBlob(ctx, ic.opt.ContentStore, configDesc.Digest.String(), bytes.NewReader(config), configDesc); err != nil {
+		return nil, errors.Wrap(err, "error writing config blob")
+	}
+
+	mfst := struct {
+		// MediaType is reserved in the OCI spec but
+		// excluded from go types.
+		MediaType string `json:"mediaType,omitempty"`
+
+		ocispecs.Manifest
+	}{
+		MediaType: ocispecs.MediaTypeImageManifest,
+		Manifest: ocispecs.Manifest{
+			Versioned: specs.Versioned{
+				SchemaVersion: 2,
+			},
+			Config: configDesc,
+			Layers: layers,
+		},
+	}
+
+	mfstJSON, err := json.MarshalIndent(mfst, "", "   ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal manifest")
+	}
+
+	mfstDigest := digest.FromBytes(mfstJSON)
+	mfstDesc := ocispecs.Descriptor{
+		Digest:    mfstDigest,
+		Size:      int64(len(mfstJSON)),
+		MediaType: ocispecs.MediaTypeImageManifest,
+	}
+	labels := map[string]string{
+		"containerd.io/gc.ref.content.0": configDesc.Digest.String(),
+	}
+	for i, l := range layers {
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.%d", i+1)] = l.Digest.String()
+	}
+	mfstDone := oneOffProgress(ctx, progressPrefix+mfstDigest.String())
+	if err := content.WriteBlob(ctx, ic.opt.ContentStore, mfstDigest.String(), bytes.NewReader(mfstJSON), mfstDesc, content.WithLabels(labels)); err != nil {
+		return nil, mfstDone(errors.Wrapf(err, "error writing manifest blob %s", mfstDigest))
+	}
+	mfstDone(nil)
+
+	mfstDesc.Platform = &ocispecs.Platform{
+		Architecture: "unknown",
+		OS:           "unknown",
+	}
+	mfstDesc.Annotations = map[string]string{
+		attestation.AnnotationReferenceType:   referenceType,
+		attestation.AnnotationReferenceDigest: target.Digest.String(),
+	}
+	return &mfstDesc, nil
+}
+
+// writeStatement writes an in-toto statement about the image manifest target
+func (ic *ImageWriter) writeStatement(ctx context.Context, target ocispecs.Descriptor, predicateType string, predicate []byte) (*ocispecs.Descriptor, error) {
+	stmt, err := json.Marshal(attestation.Statement{
+		Type:          attestation.StatementType,
+		PredicateType: predicateType,
+		Subject: []attestation.Subject{{
+			Name:   "_",
+			Digest: map[string]string{target.Digest.Algorithm().String(): target.Digest.Hex()},
+		}},
+		Predicate: predicate,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal attestation statement")
+	}
+	desc := ocispecs.Descriptor{
+		Digest:    digest.FromBytes(stmt),
+		Size:      int64(len(stmt)),
+		MediaType: attestation.MediaTypeInToto,
+		Annotations: map[string]string{
+			attestation.AnnotationPredicateType: predicateType,
+		},
+	}
+	if err := content.WriteBlob(ctx, ic.opt.ContentStore, desc.Digest.String(), bytes.NewReader(stmt), desc); err != nil {
+		return nil, errors.Wrap(err, "error writing attestation blob")
+	}
+	return &desc, nil
+}
+
+// fileManifest lists the files of the layers of the image manifest target
+func (ic *ImageWriter) fileManifest(ctx context.Context, remote *solver.Remote, target ocispecs.Descriptor) (_ []byte, err error) {
+	done := oneOffProgress(ctx, "generating file manifest")
+	defer func() {
+		done(err)
+	}()
+
+	// the layers are read from the content store, lazy layers of base
+	// images are pulled first
+	if unlazier, ok := remote.Provider.(cache.Unlazier); ok {
+		if err := unlazier.Unlazy(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	dt, err := content.ReadBlob(ctx, ic.opt.ContentStore, target)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read image manifest")
+	}
+	var mfst ocispecs.Manifest
+	if err := json.Unmarshal(dt, &mfst); err != nil {
+		return nil, errors.Wrap(err, "failed to parse image manifest")
+	}
+	m, err := filemanifest.FromLayers(ctx, ic.opt.ContentStore, mfst.Layers)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+func (ic *ImageWriter) scanRef(ctx context.Context, ref cache.ImmutableRef, sessionID string) (_ string, _ []byte, err error) {
+	scanner := ic.opt.SBOMScanner
+	if scanner == nil {
+		scanner = attestation.DefaultSBOMScanner
+	}
+
+	done := oneOffProgress(ctx, "generating sbom")
+	defer func() {
+		done(err)
+	}()
+
+	if ref == nil {
+		// scratch result
+		dir, err := ioutil.TempDir("", "buildkit-sbom")
+		if err != nil {
+			return "", nil, err
+		}
+		defer os.RemoveAll(dir)
+		// readable by the sandboxed scanner
+		if err := os.Chmod(dir, 0755); err != nil {
+			return "", nil, err
+		}
+		return scanner.Scan(ctx, dir)
+	}
+
+	mount, err := ref.Mount(ctx, true, session.NewGroup(sessionID))
+	if err != nil {
+		return "", nil, err
+	}
+	lm := snapshot.LocalMounter(mount)
+	root, err := lm.Mount()
+	if err != nil {
+		return "", nil, err
+	}
+	defer lm.Unmount()
+
+	return scanner.Scan(ctx, root)
+}
+
+// imagePlatform returns the platform of an image config, defaulting to the
+// platform of the daemon for empty configs
+func imagePlatform(config []byte) (ocispecs.Platform, error) {
+	if len(config) == 0 {
+		return platforms.DefaultSpec(), nil
+	}
+	var img struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant,omitempty"`
+	}
+	if err := json.Unmarshal(config, &img); err != nil {
+		return ocispecs.Platform{}, errors.Wrap(err, "failed to parse image config")
+	}
+	if img.OS == "" || img.Architecture == "" {
+		return platforms.DefaultSpec(), nil
+	}
+	return platforms.Normalize(ocispecs.Platform{
+		OS:           img.OS,
+		Architecture: img.Architecture,
+		Variant:      img.Variant,
+	}), nil
+}
+
+// SplitReferrers removes the attestation manifests from the index desc and
+// returns the index of the images and the attestation manifests rewritten as
+// referrers of their image manifest, with the subject and the in-toto
+// artifactType set. They are pushed separately for registries that don't
+// accept attestation manifests in an index, see push.PushReferrers.
+func (ic *ImageWriter) SplitReferrers(ctx context.Context, desc ocispecs.Descriptor) (*ocispecs.Descriptor, []ocispecs.Descriptor, error) {
+	dt, err := content.ReadBlob(ctx, ic.opt.ContentStore, desc)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read index")
+	}
+	var idx ocispecs.Index
+	if err := json.Unmarshal(dt, &idx); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse index")
+	}
+
+	subjects := map[digest.Digest]ocispecs.Descriptor{}
+	for _, m := range idx.Manifests {
+		if m.Annotations[attestation.AnnotationReferenceType] != attestation.ReferenceTypeAttestation {
+			subjects[m.Digest] = m
+		}
+	}
+	var manifests, referrers []ocispecs.Descriptor
+	for _, m := range idx.Manifests {
+		if m.Annotations[attestation.AnnotationReferenceType] != attestation.ReferenceTypeAttestation {
+			manifests = append(manifests, m)
+			continue
+		}
+		subject, ok := subjects[digest.Digest(m.Annotations[attestation.AnnotationReferenceDigest])]
+		if !ok {
+			return nil, nil, errors.Errorf("attestation manifest %s refers to a manifest not in the index", m.Digest)
+		}
+		r, err := ic.commitReferrer(ctx, m, subject)
+		if err != nil {
+			return nil, nil, err
+		}
+		referrers = append(referrers, *r)
+	}
+	if len(referrers) == 0 {
+		return &desc, nil, nil
+	}
+
+	idxDesc, err := ic.commitIndex(ctx, manifests, true, idx.Annotations)
+	if err != nil {
+		return nil, nil, err
+	}
+	idxDesc.Annotations = desc.Annotations
+	return idxDesc, referrers, nil
+}
+
+// commitReferrer writes the manifest desc with subject as its subject
+func (ic *ImageWriter) commitReferrer(ctx context.Context, desc, subject ocispecs.Descriptor) (*ocispecs.Descriptor, error) {
+	dt, err := content.ReadBlob(ctx, ic.opt.ContentStore, desc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read attestation manifest %s", desc.Digest)
+	}
+	var mfst ocispecs.Manifest
+	if err := json.Unmarshal(dt, &mfst); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse attestation manifest %s", desc.Digest)
+	}
+
+	referrer := struct {
+		// MediaType is reserved in the OCI spec but
+		// excluded from go types.
+		MediaType string `json:"mediaType,omitempty"`
+		// ArtifactType and Subject were added in OCI 1.1
+		ArtifactType string               `json:"artifactType,omitempty"`
+		Subject      *ocispecs.Descriptor `json:"subject,omitempty"`
+
+		ocispecs.Manifest
+	}{
+		MediaType:    ocispecs.MediaTypeImageManifest,
+		ArtifactType: attestation.MediaTypeInToto,
+		Subject: &ocispecs.Descriptor{
+			MediaType: subject.MediaType,
+			Digest:    subject.Digest,
+			Size:      subject.Size,
+		},
+		Manifest: mfst,
+	}
+	mfstJSON, err := json.MarshalIndent(referrer, "", "   ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal manifest")
+	}
+	mfstDesc := ocispecs.Descriptor{
+		Digest:      digest.FromBytes(mfstJSON),
+		Size:        int64(len(mfstJSON)),
+		MediaType:   ocispecs.MediaTypeImageManifest,
+		Annotations: desc.Annotations,
+	}
+	labels := map[string]string{
+		"containerd.io/gc.ref.content.0": mfst.Config.Digest.String(),
+	}
+	for i, l := range mfst.Layers {
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.%d", i+1)] = l.Digest.String()
+	}
+	if err := content.WriteBlob(ctx, ic.opt.ContentStore, mfstDesc.Digest.String(), bytes.NewReader(mfstJSON), mfstDesc, content.WithLabels(labels)); err != nil {
+		return nil, errors.Wrapf(err, "error writing manifest blob %s", mfstDesc.Digest)
+	}
+	return &mfstDesc, nil
+}
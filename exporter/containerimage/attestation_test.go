@@ -0,0 +1,200 @@
+package containerimage
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/exporter/attestation"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/util/filemanifest"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+type testScanner struct {
+	root string
+}
+
+func (s *testScanner) Scan(ctx context.Context, root string) (string, []byte, error) {
+	s.root = root
+	return "https://example.com/sbom", []byte(`{"packages":[]}`), nil
+}
+
+func TestCommitAttestationManifest(t *testing.T) {
+	ctx := context.TODO()
+	cs, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	scanner := &testScanner{}
+	ic := &ImageWriter{opt: WriterOpt{ContentStore: cs, SBOMScanner: scanner}}
+
+	target := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageManifest,
+		Digest:    digest.FromString("manifest"),
+		Size:      8,
+	}
+	provenance := []byte(`{"buildType":"https://mobyproject.org/buildkit@v1"}`)
+	desc, err := ic.commitAttestationManifest(ctx, nil, nil, target, Attestations{SBOM: true, Provenance: true}, provenance, "")
+	require.NoError(t, err)
+	require.NotEmpty(t, scanner.root)
+
+	require.Equal(t, ocispecs.MediaTypeImageManifest, desc.MediaType)
+	require.Equal(t, "unknown", desc.Platform.OS)
+	require.Equal(t, attestation.ReferenceTypeAttestation, desc.Annotations[attestation.AnnotationReferenceType])
+	require.Equal(t, target.Digest.String(), desc.Annotations[attestation.AnnotationReferenceDigest])
+
+	dt, err := content.ReadBlob(ctx, cs, *desc)
+	require.NoError(t, err)
+	var mfst ocispecs.Manifest
+	require.NoError(t, json.Unmarshal(dt, &mfst))
+	require.Equal(t, 2, len(mfst.Layers))
+	require.Equal(t, attestation.MediaTypeInToto, mfst.Layers[0].MediaType)
+	require.Equal(t, "https://example.com/sbom", mfst.Layers[0].Annotations[attestation.AnnotationPredicateType])
+
+	dt, err = content.ReadBlob(ctx, cs, mfst.Layers[0])
+	require.NoError(t, err)
+	var stmt attestation.Statement
+	require.NoError(t, json.Unmarshal(dt, &stmt))
+	require.Equal(t, attestation.StatementType, stmt.Type)
+	require.Equal(t, "https://example.com/sbom", stmt.PredicateType)
+	require.Equal(t, 1, len(stmt.Subject))
+	require.Equal(t, target.Digest.Hex(), stmt.Subject[0].Digest["sha256"])
+	require.JSONEq(t, `{"packages":[]}`, string(stmt.Predicate))
+
+	require.Equal(t, attestation.PredicateTypeSLSAProvenance, mfst.Layers[1].Annotations[attestation.AnnotationPredicateType])
+	dt, err = content.ReadBlob(ctx, cs, mfst.Layers[1])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(dt, &stmt))
+	require.Equal(t, attestation.PredicateTypeSLSAProvenance, stmt.PredicateType)
+	require.JSONEq(t, string(provenance), string(stmt.Predicate))
+
+	_, err = ic.commitAttestationManifest(ctx, nil, nil, target, Attestations{Provenance: true}, nil, "")
+	require.Error(t, err)
+}
+
+func TestImagePlatform(t *testing.T) {
+	p, err := imagePlatform(nil)
+	require.NoError(t, err)
+	require.Equal(t, platforms.DefaultSpec(), p)
+
+	p, err = imagePlatform([]byte(`{"os":"linux","architecture":"arm64","variant":"v8"}`))
+	require.NoError(t, err)
+	require.Equal(t, "linux", p.OS)
+	require.Equal(t, "arm64", p.Architecture)
+
+	_, err = imagePlatform([]byte(`{`))
+	require.Error(t, err)
+}
+
+func TestSplitReferrers(t *testing.T) {
+	ctx := context.TODO()
+	cs, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	ic := &ImageWriter{opt: WriterOpt{ContentStore: cs, SBOMScanner: &testScanner{}}}
+
+	target := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageManifest,
+		Digest:    digest.FromString("manifest"),
+		Size:      8,
+		Platform:  &ocispecs.Platform{OS: "linux", Architecture: "amd64"},
+	}
+	attDesc, err := ic.commitAttestationManifest(ctx, nil, nil, target, Attestations{SBOM: true}, nil, "")
+	require.NoError(t, err)
+	idxDesc, err := ic.commitIndex(ctx, []ocispecs.Descriptor{target, *attDesc}, true, nil)
+	require.NoError(t, err)
+	idxDesc.Annotations = map[string]string{"config.digest": "sha256:abc"}
+
+	desc, referrers, err := ic.SplitReferrers(ctx, *idxDesc)
+	require.NoError(t, err)
+	require.NotEqual(t, idxDesc.Digest, desc.Digest)
+	require.Equal(t, idxDesc.Annotations, desc.Annotations)
+
+	dt, err := content.ReadBlob(ctx, cs, *desc)
+	require.NoError(t, err)
+	var idx ocispecs.Index
+	require.NoError(t, json.Unmarshal(dt, &idx))
+	require.Equal(t, 1, len(idx.Manifests))
+	require.Equal(t, target.Digest, idx.Manifests[0].Digest)
+
+	require.Equal(t, 1, len(referrers))
+	require.Equal(t, target.Digest.String(), referrers[0].Annotations[attestation.AnnotationReferenceDigest])
+	dt, err = content.ReadBlob(ctx, cs, referrers[0])
+	require.NoError(t, err)
+	var mfst struct {
+		ArtifactType string               `json:"artifactType"`
+		Subject      *ocispecs.Descriptor `json:"subject"`
+		ocispecs.Manifest
+	}
+	require.NoError(t, json.Unmarshal(dt, &mfst))
+	require.Equal(t, attestation.MediaTypeInToto, mfst.ArtifactType)
+	require.Equal(t, target.Digest, mfst.Subject.Digest)
+	require.Equal(t, target.Size, mfst.Subject.Size)
+	require.Nil(t, mfst.Subject.Platform)
+	require.Equal(t, 1, len(mfst.Layers))
+
+	// indexes without attestations are unchanged
+	split, referrers, err := ic.SplitReferrers(ctx, *desc)
+	require.NoError(t, err)
+	require.Empty(t, referrers)
+	require.Equal(t, desc.Digest, split.Digest)
+}
+
+// lazyProvider writes its layer to the content store when it is unlazied,
+// like the providers of the lazy layers of base images
+type lazyProvider struct {
+	content.Provider
+	cs    content.Store
+	layer []byte
+	desc  ocispecs.Descriptor
+}
+
+func (p *lazyProvider) Unlazy(ctx context.Context) error {
+	return content.WriteBlob(ctx, p.cs, p.desc.Digest.String(), bytes.NewReader(p.layer), p.desc)
+}
+
+func TestFileManifestLazyLayers(t *testing.T) {
+	ctx := context.TODO()
+	cs, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+	ic := &ImageWriter{opt: WriterOpt{ContentStore: cs}}
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "foo", Mode: 0644, Size: 3, Typeflag: tar.TypeReg}))
+	_, err = tw.Write([]byte("bar"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	layer := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageLayer,
+		Digest:    digest.FromBytes(buf.Bytes()),
+		Size:      int64(buf.Len()),
+	}
+
+	dt, err := json.Marshal(ocispecs.Manifest{Layers: []ocispecs.Descriptor{layer}})
+	require.NoError(t, err)
+	target := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(dt),
+		Size:      int64(len(dt)),
+	}
+	require.NoError(t, content.WriteBlob(ctx, cs, target.Digest.String(), bytes.NewReader(dt), target))
+
+	remote := &solver.Remote{
+		Descriptors: []ocispecs.Descriptor{layer},
+		Provider:    &lazyProvider{Provider: cs, cs: cs, layer: buf.Bytes(), desc: layer},
+	}
+	dt, err = ic.fileManifest(ctx, remote, target)
+	require.NoError(t, err)
+	var m filemanifest.Manifest
+	require.NoError(t, json.Unmarshal(dt, &m))
+	require.Equal(t, 1, len(m.Files))
+	require.Equal(t, "/foo", m.Files[0].Path)
+}
@@ -0,0 +1,215 @@
+package containerimage
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/google/shlex"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyConfigPrefix       = "config."
+	keyConfigUser         = "config.user"
+	keyConfigWorkingDir   = "config.workingdir"
+	keyConfigEntrypoint   = "config.entrypoint"
+	keyConfigCmd          = "config.cmd"
+	keyConfigStopSignal   = "config.stopsignal"
+	keyConfigLabelsPrefix = "config.labels."
+	keyConfigEnvPrefix    = "config.env."
+)
+
+// ConfigPatch are the changes to the image config set with the "config.*"
+// attrs of the image exporters. Nil fields are left unchanged.
+type ConfigPatch struct {
+	User       *string
+	WorkingDir *string
+	StopSignal *string
+	Entrypoint []string
+	Cmd        []string
+	Labels     map[string]string
+	Env        map[string]string
+}
+
+// ParseConfigPatch parses the config attrs of the image exporters.
+// "config.user", "config.workingdir" and "config.stopsignal" replace the
+// values of the config, "config.entrypoint" and "config.cmd" are parsed as a
+// JSON array or split like a shell command line, "config.labels.<key>" and
+// "config.env.<key>" add or replace a label or an environment variable. The
+// attrs that aren't config attrs are returned.
+func ParseConfigPatch(opt map[string]string) (ConfigPatch, map[string]string, error) {
+	var p ConfigPatch
+	rest := make(map[string]string, len(opt))
+	for k, v := range opt {
+		if !strings.HasPrefix(k, keyConfigPrefix) {
+			rest[k] = v
+			continue
+		}
+		v := v
+		switch {
+		case k == keyConfigUser:
+			p.User = &v
+		case k == keyConfigWorkingDir:
+			p.WorkingDir = &v
+		case k == keyConfigStopSignal:
+			p.StopSignal = &v
+		case k == keyConfigEntrypoint:
+			args, err := parseConfigArgs(k, v)
+			if err != nil {
+				return ConfigPatch{}, nil, err
+			}
+			p.Entrypoint = args
+		case k == keyConfigCmd:
+			args, err := parseConfigArgs(k, v)
+			if err != nil {
+				return ConfigPatch{}, nil, err
+			}
+			p.Cmd = args
+		case strings.HasPrefix(k, keyConfigLabelsPrefix):
+			key := strings.TrimPrefix(k, keyConfigLabelsPrefix)
+			if key == "" {
+				return ConfigPatch{}, nil, errors.Errorf("missing label key in %q", k)
+			}
+			if p.Labels == nil {
+				p.Labels = map[string]string{}
+			}
+			p.Labels[key] = v
+		case strings.HasPrefix(k, keyConfigEnvPrefix):
+			key := strings.TrimPrefix(k, keyConfigEnvPrefix)
+			if key == "" || strings.Contains(key, "=") {
+				return ConfigPatch{}, nil, errors.Errorf("invalid environment variable name in %q", k)
+			}
+			if p.Env == nil {
+				p.Env = map[string]string{}
+			}
+			p.Env[key] = v
+		default:
+			return ConfigPatch{}, nil, errors.Errorf("unsupported image config attr %q", k)
+		}
+	}
+	return p, rest, nil
+}
+
+func parseConfigArgs(k, v string) ([]string, error) {
+	args := []string{}
+	if strings.HasPrefix(strings.TrimSpace(v), "[") {
+		if err := json.Unmarshal([]byte(v), &args); err != nil {
+			return nil, errors.Wrapf(err, "invalid JSON array specified for %s", k)
+		}
+		return args, nil
+	}
+	parsed, err := shlex.Split(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid value specified for %s", k)
+	}
+	return append(args, parsed...), nil
+}
+
+// IsEmpty returns true if the patch doesn't change the config
+func (p ConfigPatch) IsEmpty() bool {
+	return p.User == nil && p.WorkingDir == nil && p.StopSignal == nil && p.Entrypoint == nil && p.Cmd == nil && len(p.Labels) == 0 && len(p.Env) == 0
+}
+
+// apply returns the image config dt with the changes of the patch. Fields of
+// the config that aren't patched are kept as they are.
+func (p ConfigPatch) apply(dt []byte) ([]byte, error) {
+	if p.IsEmpty() {
+		return dt, nil
+	}
+	img := map[string]json.RawMessage{}
+	if err := json.Unmarshal(dt, &img); err != nil {
+		return nil, errors.Wrap(err, "failed to parse image config for patch")
+	}
+	config := map[string]json.RawMessage{}
+	if v, ok := img["config"]; ok && string(v) != "null" {
+		if err := json.Unmarshal(v, &config); err != nil {
+			return nil, errors.Wrap(err, "failed to parse image config for patch")
+		}
+	}
+
+	set := func(k string, v interface{}) error {
+		dt, err := json.Marshal(v)
+		if err != nil {
+			return errors.Wrapf(err, "failed to marshal %s", k)
+		}
+		config[k] = dt
+		return nil
+	}
+	for k, v := range map[string]*string{"User": p.User, "WorkingDir": p.WorkingDir, "StopSignal": p.StopSignal} {
+		if v != nil {
+			if err := set(k, *v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for k, v := range map[string][]string{"Entrypoint": p.Entrypoint, "Cmd": p.Cmd} {
+		if v != nil {
+			if err := set(k, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(p.Labels) > 0 {
+		labels := map[string]string{}
+		if v, ok := config["Labels"]; ok {
+			if err := json.Unmarshal(v, &labels); err != nil {
+				return nil, errors.Wrap(err, "failed to parse labels of image config")
+			}
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		for k, v := range p.Labels {
+			labels[k] = v
+		}
+		if err := set("Labels", labels); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.Env) > 0 {
+		var env []string
+		if v, ok := config["Env"]; ok {
+			if err := json.Unmarshal(v, &env); err != nil {
+				return nil, errors.Wrap(err, "failed to parse env of image config")
+			}
+		}
+		if err := set("Env", patchEnv(env, p.Env)); err != nil {
+			return nil, err
+		}
+	}
+
+	dt, err := json.Marshal(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal image config")
+	}
+	img["config"] = dt
+	dt, err = json.Marshal(img)
+	return dt, errors.Wrap(err, "failed to marshal config after patch")
+}
+
+// patchEnv replaces the variables of env that are set in m and appends the
+// others in sorted order
+func patchEnv(env []string, m map[string]string) []string {
+	out := make([]string, 0, len(env)+len(m))
+	done := map[string]struct{}{}
+	for _, e := range env {
+		k := strings.SplitN(e, "=", 2)[0]
+		if v, ok := m[k]; ok {
+			e = k + "=" + v
+			done[k] = struct{}{}
+		}
+		out = append(out, e)
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if _, ok := done[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		out = append(out, k+"="+m[k])
+	}
+	return out
+}
@@ -0,0 +1,78 @@
+package containerimage
+
+import (
+	"encoding/json"
+	"testing"
+
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfigPatch(t *testing.T) {
+	p, rest, err := ParseConfigPatch(map[string]string{
+		"name":                             "docker.io/library/foo",
+		"config.user":                      "1000",
+		"config.entrypoint":                `["/bin/app", "--flag"]`,
+		"config.cmd":                       `serve --port "80 80"`,
+		"config.labels.org.example.vendor": "example",
+		"config.env.FOO":                   "bar",
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"name": "docker.io/library/foo"}, rest)
+	require.Equal(t, "1000", *p.User)
+	require.Nil(t, p.WorkingDir)
+	require.Equal(t, []string{"/bin/app", "--flag"}, p.Entrypoint)
+	require.Equal(t, []string{"serve", "--port", "80 80"}, p.Cmd)
+	require.Equal(t, map[string]string{"org.example.vendor": "example"}, p.Labels)
+	require.Equal(t, map[string]string{"FOO": "bar"}, p.Env)
+	require.False(t, p.IsEmpty())
+
+	p, _, err = ParseConfigPatch(map[string]string{"config.cmd": ""})
+	require.NoError(t, err)
+	require.Equal(t, []string{}, p.Cmd)
+
+	p, _, err = ParseConfigPatch(map[string]string{"push": "true"})
+	require.NoError(t, err)
+	require.True(t, p.IsEmpty())
+
+	for _, k := range []string{"config.labels.", "config.env.", "config.env.A=B", "config.volumes"} {
+		_, _, err = ParseConfigPatch(map[string]string{k: "foo"})
+		require.Error(t, err, k)
+	}
+	_, _, err = ParseConfigPatch(map[string]string{"config.entrypoint": `["/bin/app"`})
+	require.Error(t, err)
+}
+
+func TestApplyConfigPatch(t *testing.T) {
+	dt := []byte(`{"architecture":"amd64","os":"linux","config":{"User":"root","Env":["PATH=/usr/bin","FOO=old"],"Labels":{"a":"1"},"Cmd":["sh"],"ExposedPorts":{"80/tcp":{}}}}`)
+
+	same, err := ConfigPatch{}.apply(dt)
+	require.NoError(t, err)
+	require.Equal(t, dt, same)
+
+	user := "1000"
+	dt, err = ConfigPatch{
+		User:       &user,
+		Entrypoint: []string{"/bin/app"},
+		Cmd:        []string{},
+		Labels:     map[string]string{"b": "2"},
+		Env:        map[string]string{"FOO": "new", "BAZ": "x", "BAR": "y"},
+	}.apply(dt)
+	require.NoError(t, err)
+
+	var img ocispecs.Image
+	require.NoError(t, json.Unmarshal(dt, &img))
+	require.Equal(t, "amd64", img.Architecture)
+	require.Equal(t, "1000", img.Config.User)
+	require.Equal(t, []string{"/bin/app"}, img.Config.Entrypoint)
+	require.Equal(t, []string{}, img.Config.Cmd)
+	require.Equal(t, map[string]string{"a": "1", "b": "2"}, img.Config.Labels)
+	require.Equal(t, []string{"PATH=/usr/bin", "FOO=new", "BAR=y", "BAZ=x"}, img.Config.Env)
+	require.Contains(t, img.Config.ExposedPorts, "80/tcp")
+
+	dt, err = ConfigPatch{Labels: map[string]string{"a": "1"}}.apply([]byte(`{"architecture":"amd64","os":"linux"}`))
+	require.NoError(t, err)
+	img = ocispecs.Image{}
+	require.NoError(t, json.Unmarshal(dt, &img))
+	require.Equal(t, map[string]string{"a": "1"}, img.Config.Labels)
+}
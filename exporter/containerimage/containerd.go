@@ -0,0 +1,188 @@
+package containerimage
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/defaults"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/identifiers"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/leases"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/moby/buildkit/util/contentutil"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+const (
+	keyContainerdAddress   = "containerd.address"
+	keyContainerdNamespace = "containerd.namespace"
+	keyNamespaces          = "namespaces"
+
+	defaultContainerdNamespace = "default"
+)
+
+// remoteContainerd is a containerd instance that images are exported to over
+// its gRPC API, e.g. when buildkitd doesn't share the content store with the
+// runtime of the node
+type remoteContainerd struct {
+	// address is unix:///path or tcp://host:port, see parseContainerdAddress
+	address   string
+	namespace string
+}
+
+// parseContainerdAddress returns the address of containerd.address with the
+// scheme, unix:// if v is a plain socket path
+func parseContainerdAddress(v string) (string, error) {
+	addr := v
+	if !strings.Contains(addr, "://") {
+		addr = "unix://" + addr
+	}
+	for _, scheme := range []string{"unix://", "tcp://"} {
+		if strings.HasPrefix(addr, scheme) && len(addr) > len(scheme) {
+			return addr, nil
+		}
+	}
+	return "", errors.Errorf("invalid value %q for %s, the address needs to be unix:///path or tcp://host:port", v, keyContainerdAddress)
+}
+
+// containerdAddressAllowed returns if images may be exported to the
+// containerd instance at address
+func (opt Opt) containerdAddressAllowed(address string) bool {
+	for _, a := range opt.ContainerdAddresses {
+		if a, err := parseContainerdAddress(a); err == nil && a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// containerdNamespaceAllowed returns if images may be created in the other
+// namespace ns of the containerd of the worker
+func (opt Opt) containerdNamespaceAllowed(ns string) bool {
+	for _, n := range opt.ContainerdNamespaces {
+		if n == ns {
+			return true
+		}
+	}
+	return false
+}
+
+// dial connects to the containerd instance. containerd.New always dials a
+// unix socket and prepends unix:// to the address itself.
+func (rc *remoteContainerd) dial() (*containerd.Client, error) {
+	if path := strings.TrimPrefix(rc.address, "unix://"); path != rc.address {
+		return containerd.New(path)
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, strings.TrimPrefix(rc.address, "tcp://"),
+		grpc.WithBlock(),
+		grpc.WithInsecure(),
+		grpc.FailOnNonTempDialError(true),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", addr)
+		}),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(defaults.DefaultMaxRecvMsgSize)),
+		grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(defaults.DefaultMaxSendMsgSize)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return containerd.NewWithConn(conn)
+}
+
+// export copies desc and all its children from provider to the content store
+// of the containerd instance and names the image with names there
+func (rc *remoteContainerd) export(ctx context.Context, provider content.Provider, desc ocispecs.Descriptor, names []string) (err error) {
+	done := oneOffProgress(ctx, "exporting to containerd "+rc.address)
+	defer func() {
+		done(err)
+	}()
+
+	client, err := rc.dial()
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to containerd at %s", rc.address)
+	}
+	defer client.Close()
+
+	return exportToNamespace(ctx, client, rc.namespace, provider, desc, names, "")
+}
+
+// exportToNamespace copies desc and all its children from provider to the
+// content store of client in namespace ns and names the image with names
+// there. The image is unpacked into snapshotter if it isn't empty.
+func exportToNamespace(ctx context.Context, client *containerd.Client, ns string, provider content.Provider, desc ocispecs.Descriptor, names []string, snapshotter string) error {
+	// the context holds the lease and namespace of the worker, which are
+	// unknown in other namespaces
+	ctx = namespaces.WithNamespace(ctx, ns)
+	l, err := client.LeasesService().Create(ctx, leases.WithRandomID(), leases.WithExpiration(time.Hour))
+	if err != nil {
+		return errors.Wrap(err, "failed to create lease")
+	}
+	defer client.LeasesService().Delete(namespaces.WithNamespace(context.TODO(), ns), l)
+	ctx = leases.WithLease(ctx, l.ID)
+
+	cs := client.ContentStore()
+	handler := images.Handlers(
+		images.HandlerFunc(func(ctx context.Context, desc ocispecs.Descriptor) ([]ocispecs.Descriptor, error) {
+			return nil, contentutil.Copy(ctx, cs, provider, desc, "", nil)
+		}),
+		// children are referenced by labels so they aren't garbage
+		// collected once the lease is removed
+		images.SetChildrenLabels(cs, images.ChildrenHandler(provider)),
+	)
+	if err := images.Dispatch(ctx, handler, nil, desc); err != nil {
+		return errors.Wrap(err, "failed to copy image content")
+	}
+
+	is := client.ImageService()
+	for _, name := range names {
+		img := images.Image{
+			Name:      name,
+			Target:    desc,
+			CreatedAt: time.Now(),
+		}
+		if _, err := is.Update(ctx, img); err != nil {
+			if !errors.Is(err, errdefs.ErrNotFound) {
+				return err
+			}
+			if _, err := is.Create(ctx, img); err != nil {
+				return err
+			}
+		}
+		if snapshotter != "" {
+			// the GC label of the snapshots is set on the config, which is
+			// the same for all names
+			if err := containerd.NewImage(client, img).Unpack(ctx, snapshotter); err != nil {
+				return errors.Wrapf(err, "failed to unpack %s", name)
+			}
+			snapshotter = ""
+		}
+	}
+	return nil
+}
+
+// parseNamespaces parses the comma separated containerd namespaces of the
+// namespaces attr
+func parseNamespaces(v string) ([]string, error) {
+	var nss []string
+	for _, ns := range strings.Split(v, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" {
+			continue
+		}
+		if err := identifiers.Validate(ns); err != nil {
+			return nil, errors.Wrapf(err, "invalid value %q for %s", v, keyNamespaces)
+		}
+		nss = append(nss, ns)
+	}
+	return nss, nil
+}
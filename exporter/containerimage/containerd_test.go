@@ -0,0 +1,211 @@
+package containerimage
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	contentapi "github.com/containerd/containerd/api/services/content/v1"
+	imagesapi "github.com/containerd/containerd/api/services/images/v1"
+	leasesapi "github.com/containerd/containerd/api/services/leases/v1"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/services/content/contentserver"
+	ptypes "github.com/gogo/protobuf/types"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestParseContainerdAddress(t *testing.T) {
+	for v, expected := range map[string]string{
+		"/run/containerd/containerd.sock":        "unix:///run/containerd/containerd.sock",
+		"unix:///run/containerd/containerd.sock": "unix:///run/containerd/containerd.sock",
+		"tcp://10.0.0.1:5000":                    "tcp://10.0.0.1:5000",
+	} {
+		addr, err := parseContainerdAddress(v)
+		require.NoError(t, err, v)
+		require.Equal(t, expected, addr, v)
+	}
+	for _, v := range []string{"", "unix://", "http://10.0.0.1:5000"} {
+		_, err := parseContainerdAddress(v)
+		require.Error(t, err, v)
+	}
+
+	opt := Opt{ContainerdAddresses: []string{"/run/containerd/containerd.sock"}}
+	require.True(t, opt.containerdAddressAllowed("unix:///run/containerd/containerd.sock"))
+	require.False(t, opt.containerdAddressAllowed("unix:///run/other.sock"))
+	require.False(t, Opt{}.containerdAddressAllowed("unix:///run/containerd/containerd.sock"))
+}
+
+func TestContainerdNamespaceAllowed(t *testing.T) {
+	opt := Opt{ContainerdNamespaces: []string{"k8s.io"}}
+	require.True(t, opt.containerdNamespaceAllowed("k8s.io"))
+	require.False(t, opt.containerdNamespaceAllowed("default"))
+	require.False(t, Opt{}.containerdNamespaceAllowed("k8s.io"))
+}
+
+func TestRemoteContainerdExport(t *testing.T) {
+	tmpdir := t.TempDir()
+	ls := &memLabelStore{labels: map[digest.Digest]map[string]string{}}
+	cs, err := local.NewLabeledStore(filepath.Join(tmpdir, "content"), ls)
+	require.NoError(t, err)
+	images := &testImagesServer{images: map[string]imagesapi.Image{}}
+
+	srv := grpc.NewServer()
+	contentapi.RegisterContentServer(srv, contentserver.New(cs))
+	imagesapi.RegisterImagesServer(srv, images)
+	leasesapi.RegisterLeasesServer(srv, &testLeasesServer{})
+	defer srv.Stop()
+
+	unixListener, err := net.Listen("unix", filepath.Join(tmpdir, "containerd.sock"))
+	require.NoError(t, err)
+	go srv.Serve(unixListener)
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(tcpListener)
+
+	provider := &bytesProvider{blobs: map[digest.Digest][]byte{}}
+	layer := provider.add(ocispecs.MediaTypeImageLayerGzip, []byte("layer"))
+	config := provider.add(ocispecs.MediaTypeImageConfig, []byte("{}"))
+	manifest := provider.add(ocispecs.MediaTypeImageManifest, []byte(`{"schemaVersion":2,"config":{"mediaType":"`+config.MediaType+`","digest":"`+config.Digest.String()+`","size":2},"layers":[{"mediaType":"`+layer.MediaType+`","digest":"`+layer.Digest.String()+`","size":5}]}`))
+
+	for _, addr := range []string{"unix://" + unixListener.Addr().String(), "tcp://" + tcpListener.Addr().String()} {
+		rc := &remoteContainerd{address: addr, namespace: "k8s.io"}
+		require.NoError(t, rc.export(context.TODO(), provider, manifest, []string{"example.com/img:latest"}), addr)
+	}
+
+	for _, desc := range []ocispecs.Descriptor{manifest, config, layer} {
+		_, err := cs.Info(context.TODO(), desc.Digest)
+		require.NoError(t, err)
+	}
+	// the blobs of the image are referenced from the manifest
+	info, err := cs.Info(context.TODO(), manifest.Digest)
+	require.NoError(t, err)
+	require.Equal(t, config.Digest.String(), info.Labels["containerd.io/gc.ref.content.config"])
+	require.Equal(t, layer.Digest.String(), info.Labels["containerd.io/gc.ref.content.l.0"])
+
+	img, ok := images.images["k8s.io/example.com/img:latest"]
+	require.True(t, ok)
+	require.Equal(t, manifest.Digest, img.Target.Digest)
+}
+
+type bytesProvider struct {
+	blobs map[digest.Digest][]byte
+}
+
+func (p *bytesProvider) add(mediaType string, dt []byte) ocispecs.Descriptor {
+	desc := ocispecs.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(dt), Size: int64(len(dt))}
+	p.blobs[desc.Digest] = dt
+	return desc
+}
+
+func (p *bytesProvider) ReaderAt(ctx context.Context, desc ocispecs.Descriptor) (content.ReaderAt, error) {
+	dt, ok := p.blobs[desc.Digest]
+	if !ok {
+		return nil, errdefs.ErrNotFound
+	}
+	return &bytesReaderAt{Reader: bytes.NewReader(dt)}, nil
+}
+
+type bytesReaderAt struct {
+	*bytes.Reader
+}
+
+func (r *bytesReaderAt) Close() error {
+	return nil
+}
+
+type memLabelStore struct {
+	mu     sync.Mutex
+	labels map[digest.Digest]map[string]string
+}
+
+func (s *memLabelStore) Get(dgst digest.Digest) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.labels[dgst], nil
+}
+
+func (s *memLabelStore) Set(dgst digest.Digest, labels map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.labels[dgst] = labels
+	return nil
+}
+
+func (s *memLabelStore) Update(dgst digest.Digest, update map[string]string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	labels := s.labels[dgst]
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for k, v := range update {
+		if v == "" {
+			delete(labels, k)
+		} else {
+			labels[k] = v
+		}
+	}
+	s.labels[dgst] = labels
+	return labels, nil
+}
+
+type testLeasesServer struct {
+	leasesapi.UnimplementedLeasesServer
+}
+
+func (s *testLeasesServer) Create(ctx context.Context, req *leasesapi.CreateRequest) (*leasesapi.CreateResponse, error) {
+	return &leasesapi.CreateResponse{Lease: &leasesapi.Lease{ID: req.ID, Labels: req.Labels}}, nil
+}
+
+func (s *testLeasesServer) Delete(ctx context.Context, req *leasesapi.DeleteRequest) (*ptypes.Empty, error) {
+	return &ptypes.Empty{}, nil
+}
+
+// testImagesServer stores the images by namespace and name
+type testImagesServer struct {
+	imagesapi.UnimplementedImagesServer
+	mu     sync.Mutex
+	images map[string]imagesapi.Image
+}
+
+func (s *testImagesServer) key(ctx context.Context, name string) (string, error) {
+	ns, err := namespaces.NamespaceRequired(ctx)
+	if err != nil {
+		return "", errdefs.ToGRPC(err)
+	}
+	return ns + "/" + name, nil
+}
+
+func (s *testImagesServer) Create(ctx context.Context, req *imagesapi.CreateImageRequest) (*imagesapi.CreateImageResponse, error) {
+	k, err := s.key(ctx, req.Image.Name)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.images[k] = req.Image
+	return &imagesapi.CreateImageResponse{Image: req.Image}, nil
+}
+
+func (s *testImagesServer) Update(ctx context.Context, req *imagesapi.UpdateImageRequest) (*imagesapi.UpdateImageResponse, error) {
+	k, err := s.key(ctx, req.Image.Name)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.images[k]; !ok {
+		return nil, errdefs.ToGRPC(errdefs.ErrNotFound)
+	}
+	s.images[k] = req.Image
+	return &imagesapi.UpdateImageResponse{Image: req.Image}, nil
+}
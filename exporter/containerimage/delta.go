@@ -0,0 +1,318 @@
+package containerimage
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	ctdcompression "github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/exporter/attestation"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/util/delta"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// AnnotationDeltaBase is set on deltas to the digest of the layer of the
+	// previous image the delta applies to
+	AnnotationDeltaBase = "io.buildkit.delta.base"
+	// AnnotationDeltaTarget is set on deltas to the digest of the layer the
+	// delta recreates
+	AnnotationDeltaTarget = "io.buildkit.delta.target"
+	// ReferenceTypeLayerDelta is the value of the reference type annotation of
+	// the manifests containing the deltas of an image manifest
+	ReferenceTypeLayerDelta = "layer-delta-manifest"
+)
+
+// CommitDeltas adds manifests with the deltas of the layers of the image desc
+// from the layers of the previous image base to the image. Deltas are
+// computed for the changed layers of the manifests of the same platform, see
+// pairLayers, and only added if they are smaller than the layer. The image is
+// returned unchanged if there are no deltas.
+func (ic *ImageWriter) CommitDeltas(ctx context.Context, desc, base ocispecs.Descriptor) (*ocispecs.Descriptor, error) {
+	cs := ic.opt.ContentStore
+
+	var manifests []ocispecs.Descriptor
+	var idxAnnotations map[string]string
+	switch desc.MediaType {
+	case ocispecs.MediaTypeImageIndex:
+		dt, err := content.ReadBlob(ctx, cs, desc)
+		if err != nil {
+			return nil, err
+		}
+		var idx ocispecs.Index
+		if err := json.Unmarshal(dt, &idx); err != nil {
+			return nil, errors.Wrap(err, "failed to parse index")
+		}
+		manifests = idx.Manifests
+		idxAnnotations = idx.Annotations
+	case ocispecs.MediaTypeImageManifest:
+		mfst, err := readManifest(ctx, cs, desc)
+		if err != nil {
+			return nil, err
+		}
+		config, err := content.ReadBlob(ctx, cs, mfst.Config)
+		if err != nil {
+			return nil, err
+		}
+		p, err := imagePlatform(config)
+		if err != nil {
+			return nil, err
+		}
+		m := ocispecs.Descriptor{
+			MediaType: desc.MediaType,
+			Digest:    desc.Digest,
+			Size:      desc.Size,
+			Platform:  &p,
+		}
+		manifests = []ocispecs.Descriptor{m}
+	default:
+		return nil, errors.Errorf("layer deltas are only supported with OCI media types")
+	}
+
+	var deltaManifests []ocispecs.Descriptor
+	for _, m := range manifests {
+		if _, ok := m.Annotations[attestation.AnnotationReferenceType]; ok || m.Platform == nil {
+			continue
+		}
+		baseMfst, err := images.Manifest(ctx, cs, base, platforms.Only(*m.Platform))
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		mfst, err := readManifest(ctx, cs, m)
+		if err != nil {
+			return nil, err
+		}
+		pairs, err := pairLayers(ctx, cs, &baseMfst, mfst)
+		if err != nil {
+			return nil, err
+		}
+		var deltas []ocispecs.Descriptor
+		for _, p := range pairs {
+			d, err := ic.writeLayerDelta(ctx, p[0], p[1])
+			if err != nil {
+				return nil, err
+			}
+			if d != nil {
+				deltas = append(deltas, *d)
+			}
+		}
+		if len(deltas) == 0 {
+			continue
+		}
+		d, err := ic.commitReferrerManifest(ctx, m, deltas, ReferenceTypeLayerDelta, "exporting layer delta manifest ")
+		if err != nil {
+			return nil, err
+		}
+		deltaManifests = append(deltaManifests, *d)
+	}
+	if len(deltaManifests) == 0 {
+		return &desc, nil
+	}
+
+	idxDesc, err := ic.commitIndex(ctx, append(manifests, deltaManifests...), true, idxAnnotations)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := desc.Annotations[exptypes.ExporterConfigDigestKey]; ok {
+		idxDesc.Annotations = map[string]string{
+			exptypes.ExporterConfigDigestKey: v,
+		}
+	}
+	return idxDesc, nil
+}
+
+// writeLayerDelta writes the delta of the uncompressed layer target from the
+// uncompressed layer base. It returns nil if one of the layers isn't in the
+// content store or the delta isn't smaller than target.
+func (ic *ImageWriter) writeLayerDelta(ctx context.Context, base, target ocispecs.Descriptor) (_ *ocispecs.Descriptor, err error) {
+	cs := ic.opt.ContentStore
+	for _, desc := range []ocispecs.Descriptor{base, target} {
+		if _, err := cs.Info(ctx, desc.Digest); err != nil {
+			if errdefs.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	}
+
+	done := oneOffProgress(ctx, "computing layer delta "+target.Digest.String())
+	defer func() {
+		done(err)
+	}()
+
+	// the base layer is read at random offsets, so it is decompressed into a
+	// temporary file
+	f, err := ioutil.TempFile(ic.opt.TempDir, "delta-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	baseSize, err := copyUncompressed(ctx, cs, f, base)
+	if err != nil {
+		return nil, err
+	}
+
+	ra, err := cs.ReaderAt(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	defer ra.Close()
+	r, err := ctdcompression.DecompressStream(io.NewSectionReader(ra, 0, ra.Size()))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	ref := "delta-" + base.Digest.String() + "-" + target.Digest.String()
+	w, err := content.OpenWriter(ctx, cs, content.WithRef(ref))
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+	if err := w.Truncate(0); err != nil { // Old written data possibly remains
+		return nil, err
+	}
+	gw := gzip.NewWriter(w)
+	if err := delta.Diff(gw, f, baseSize, r); err != nil {
+		return nil, errors.Wrapf(err, "failed to compute delta of %s", target.Digest)
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	st, err := w.Status()
+	if err != nil {
+		return nil, err
+	}
+	if st.Offset >= target.Size {
+		return nil, cs.Abort(ctx, ref)
+	}
+	dgst := w.Digest()
+	if err := w.Commit(ctx, st.Offset, dgst); err != nil && !errdefs.IsAlreadyExists(err) {
+		return nil, err
+	}
+	return &ocispecs.Descriptor{
+		MediaType: exptypes.MediaTypeLayerDelta,
+		Digest:    dgst,
+		Size:      st.Offset,
+		Annotations: map[string]string{
+			AnnotationDeltaBase:   base.Digest.String(),
+			AnnotationDeltaTarget: target.Digest.String(),
+		},
+	}, nil
+}
+
+// pairLayers returns the changed layers of mfst paired with the layers of
+// base they replace. Layers with a diffID of base are unchanged. A changed
+// layer is paired with the replaced layer of base that was created by the
+// same build step, as recorded in the history of the image configs. Layers
+// without a match get no delta.
+func pairLayers(ctx context.Context, cs content.Provider, base, mfst *ocispecs.Manifest) ([][2]ocispecs.Descriptor, error) {
+	baseDiffIDs, baseSteps, err := layerSteps(ctx, cs, base)
+	if err != nil {
+		return nil, err
+	}
+	diffIDs, steps, err := layerSteps(ctx, cs, mfst)
+	if err != nil {
+		return nil, err
+	}
+	if baseDiffIDs == nil || diffIDs == nil {
+		return nil, nil
+	}
+
+	kept := map[digest.Digest]struct{}{}
+	for _, d := range diffIDs {
+		kept[d] = struct{}{}
+	}
+	replaced := map[string]int{}
+	for i := len(base.Layers) - 1; i >= 0; i-- {
+		if _, ok := kept[baseDiffIDs[i]]; ok || baseSteps[i] == "" {
+			continue
+		}
+		replaced[baseSteps[i]] = i
+	}
+
+	unchanged := map[digest.Digest]struct{}{}
+	for _, d := range baseDiffIDs {
+		unchanged[d] = struct{}{}
+	}
+	var pairs [][2]ocispecs.Descriptor
+	for i, l := range mfst.Layers {
+		if _, ok := unchanged[diffIDs[i]]; ok || steps[i] == "" {
+			continue
+		}
+		j, ok := replaced[steps[i]]
+		if !ok {
+			continue
+		}
+		delete(replaced, steps[i])
+		pairs = append(pairs, [2]ocispecs.Descriptor{base.Layers[j], l})
+	}
+	return pairs, nil
+}
+
+// layerSteps returns the diffIDs of the layers of mfst and the build steps
+// that created them. nil is returned if the config doesn't describe every
+// layer.
+func layerSteps(ctx context.Context, cs content.Provider, mfst *ocispecs.Manifest) ([]digest.Digest, []string, error) {
+	dt, err := content.ReadBlob(ctx, cs, mfst.Config)
+	if err != nil {
+		return nil, nil, err
+	}
+	var img ocispecs.Image
+	if err := json.Unmarshal(dt, &img); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse image config")
+	}
+	if len(img.RootFS.DiffIDs) != len(mfst.Layers) {
+		return nil, nil, nil
+	}
+	var steps []string
+	for _, h := range img.History {
+		if !h.EmptyLayer {
+			steps = append(steps, h.CreatedBy)
+		}
+	}
+	if len(steps) != len(mfst.Layers) {
+		return nil, nil, nil
+	}
+	return img.RootFS.DiffIDs, steps, nil
+}
+
+func copyUncompressed(ctx context.Context, cs content.Provider, w io.Writer, desc ocispecs.Descriptor) (int64, error) {
+	ra, err := cs.ReaderAt(ctx, desc)
+	if err != nil {
+		return 0, err
+	}
+	defer ra.Close()
+	r, err := ctdcompression.DecompressStream(io.NewSectionReader(ra, 0, ra.Size()))
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return io.Copy(w, r)
+}
+
+func readManifest(ctx context.Context, cs content.Provider, desc ocispecs.Descriptor) (*ocispecs.Manifest, error) {
+	dt, err := content.ReadBlob(ctx, cs, desc)
+	if err != nil {
+		return nil, err
+	}
+	var mfst ocispecs.Manifest
+	if err := json.Unmarshal(dt, &mfst); err != nil {
+		return nil, errors.Wrap(err, "failed to parse manifest")
+	}
+	return &mfst, nil
+}
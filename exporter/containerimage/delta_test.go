@@ -0,0 +1,123 @@
+package containerimage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/moby/buildkit/exporter/attestation"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/util/delta"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitDeltas(t *testing.T) {
+	ctx := context.TODO()
+	cs, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+	ic := &ImageWriter{opt: WriterOpt{ContentStore: cs}}
+
+	writeBlob := func(mediaType string, dt []byte) ocispecs.Descriptor {
+		desc := ocispecs.Descriptor{
+			MediaType: mediaType,
+			Digest:    digest.FromBytes(dt),
+			Size:      int64(len(dt)),
+		}
+		err := content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(dt), desc)
+		require.NoError(t, err)
+		return desc
+	}
+	gzipBytes := func(dt []byte) []byte {
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		_, err := gw.Write(dt)
+		require.NoError(t, err)
+		require.NoError(t, gw.Close())
+		return buf.Bytes()
+	}
+	// layers are the pairs of the step creating the layer and its content
+	writeImage := func(layers ...interface{}) ocispecs.Descriptor {
+		img := ocispecs.Image{OS: "linux", Architecture: "amd64"}
+		mfst := ocispecs.Manifest{}
+		mfst.SchemaVersion = 2
+		for i := 0; i < len(layers); i += 2 {
+			l := layers[i+1].([]byte)
+			img.RootFS.DiffIDs = append(img.RootFS.DiffIDs, digest.FromBytes(l))
+			img.History = append(img.History, ocispecs.History{CreatedBy: layers[i].(string)})
+			mfst.Layers = append(mfst.Layers, writeBlob(ocispecs.MediaTypeImageLayerGzip, gzipBytes(l)))
+		}
+		config, err := json.Marshal(img)
+		require.NoError(t, err)
+		mfst.Config = writeBlob(ocispecs.MediaTypeImageConfig, config)
+		dt, err := json.Marshal(mfst)
+		require.NoError(t, err)
+		return writeBlob(ocispecs.MediaTypeImageManifest, dt)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	shared := make([]byte, 1024)
+	rnd.Read(shared)
+	old := make([]byte, 64*1024)
+	rnd.Read(old)
+	changed := append(append([]byte{}, old[:32*1024]...), []byte("changed")...)
+	changed = append(changed, old[32*1024:]...)
+
+	base := writeImage("COPY shared", shared, "RUN build", old)
+	// a new layer before the changed one must not shift the pairing
+	inserted := []byte("inserted")
+	target := writeImage("COPY shared", shared, "RUN setup", inserted, "RUN build", changed)
+
+	desc, err := ic.CommitDeltas(ctx, target, base)
+	require.NoError(t, err)
+	require.Equal(t, ocispecs.MediaTypeImageIndex, desc.MediaType)
+
+	dt, err := content.ReadBlob(ctx, cs, *desc)
+	require.NoError(t, err)
+	var idx ocispecs.Index
+	require.NoError(t, json.Unmarshal(dt, &idx))
+	require.Len(t, idx.Manifests, 2)
+	require.Equal(t, target.Digest, idx.Manifests[0].Digest)
+	require.Equal(t, "linux", idx.Manifests[0].Platform.OS)
+	require.Equal(t, ReferenceTypeLayerDelta, idx.Manifests[1].Annotations[attestation.AnnotationReferenceType])
+	require.Equal(t, target.Digest.String(), idx.Manifests[1].Annotations[attestation.AnnotationReferenceDigest])
+
+	baseMfst, err := readManifest(ctx, cs, base)
+	require.NoError(t, err)
+	targetMfst, err := readManifest(ctx, cs, target)
+	require.NoError(t, err)
+	deltaMfst, err := readManifest(ctx, cs, idx.Manifests[1])
+	require.NoError(t, err)
+	require.Len(t, deltaMfst.Layers, 1)
+	d := deltaMfst.Layers[0]
+	require.Equal(t, exptypes.MediaTypeLayerDelta, d.MediaType)
+	require.Equal(t, baseMfst.Layers[1].Digest.String(), d.Annotations[AnnotationDeltaBase])
+	require.Equal(t, targetMfst.Layers[2].Digest.String(), d.Annotations[AnnotationDeltaTarget])
+	require.Less(t, d.Size, targetMfst.Layers[2].Size)
+
+	// the delta recreates the uncompressed layer from the old one
+	deltaBlob, err := content.ReadBlob(ctx, cs, d)
+	require.NoError(t, err)
+	gr, err := gzip.NewReader(bytes.NewReader(deltaBlob))
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	err = delta.Apply(out, bytes.NewReader(old), gr)
+	require.NoError(t, err)
+	require.Equal(t, changed, out.Bytes())
+
+	// unchanged images get no deltas
+	desc, err = ic.CommitDeltas(ctx, base, base)
+	require.NoError(t, err)
+	require.Equal(t, base.Digest, desc.Digest)
+
+	// layers of different steps are not paired
+	desc, err = ic.CommitDeltas(ctx, writeImage("COPY shared", shared, "RUN other", changed), base)
+	require.NoError(t, err)
+	require.Equal(t, ocispecs.MediaTypeImageManifest, desc.MediaType)
+}
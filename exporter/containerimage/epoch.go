@@ -0,0 +1,22 @@
+package containerimage
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ParseSourceDateEpoch parses the value of SOURCE_DATE_EPOCH, the number of
+// seconds since the Unix epoch.
+func ParseSourceDateEpoch(v string) (*time.Time, error) {
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid SOURCE_DATE_EPOCH %q", v)
+	}
+	if sec < 0 {
+		return nil, errors.Errorf("invalid SOURCE_DATE_EPOCH %q: negative timestamp", v)
+	}
+	tm := time.Unix(sec, 0).UTC()
+	return &tm, nil
+}
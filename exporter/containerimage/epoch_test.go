@@ -0,0 +1,19 @@
+package containerimage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSourceDateEpoch(t *testing.T) {
+	tm, err := ParseSourceDateEpoch("1000000000")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2001, time.September, 9, 1, 46, 40, 0, time.UTC), *tm)
+
+	_, err = ParseSourceDateEpoch("yesterday")
+	require.Error(t, err)
+	_, err = ParseSourceDateEpoch("-1")
+	require.Error(t, err)
+}
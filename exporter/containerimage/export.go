@@ -2,11 +2,13 @@ package containerimage
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/images"
@@ -14,6 +16,7 @@ import (
 	"github.com/containerd/containerd/platforms"
 	"github.com/containerd/containerd/remotes/docker"
 	"github.com/containerd/containerd/rootfs"
+	"github.com/docker/go-units"
 	"github.com/moby/buildkit/cache"
 	"github.com/moby/buildkit/exporter"
 	"github.com/moby/buildkit/exporter/containerimage/exptypes"
@@ -35,11 +38,31 @@ const (
 	keyPushByDigest     = "push-by-digest"
 	keyInsecure         = "registry.insecure"
 	keyUnpack           = "unpack"
+	keyUnpackSnapshot   = "unpack-snapshotter"
 	keyDanglingPrefix   = "dangling-name-prefix"
 	keyNameCanonical    = "name-canonical"
 	keyLayerCompression = "compression"
 	keyForceCompression = "force-compression"
+	keyCompressionLevel = "compression-level"
 	ociTypes            = "oci-mediatypes"
+	keyWasm             = "wasm"
+	keyWasmModule       = "wasm-module"
+	keyAttestSBOM       = "attest:sbom"
+	keyAttestProvenance = "attest:provenance"
+	keyAttestFiles      = "attest:file-manifest"
+	keyAttestReferrers  = "attest:referrers"
+	keySign             = "sign"
+	keySignKey          = "sign-key"
+	keyPushAttempts     = "push-attempts"
+	keyPushTimeout      = "push-layer-timeout"
+	keyPushConcurrency  = "push-concurrency"
+	keyPushChunkSize    = "push-chunk-size"
+	keySquash           = "squash"
+	keySquashFrom       = "squash-from"
+	keyKeepBlobsFor     = "keep-blobs-for"
+	keyDelta            = "delta"
+	keyArtifactType     = "artifact-type"
+	keyManifestType     = "manifest-type"
 )
 
 type Opt struct {
@@ -48,6 +71,25 @@ type Opt struct {
 	Images         images.Store
 	RegistryHosts  docker.RegistryHosts
 	LeaseManager   leases.Manager
+	// Push are the defaults of the push attrs
+	Push push.Opt
+	// UnpackSnapshotter returns the snapshotter of name for unpacking images
+	// into a snapshotter other than the one of ImageWriter. Nil if the worker
+	// has no other snapshotters.
+	UnpackSnapshotter func(name string) (snapshot.Snapshotter, error)
+	// Containerd is the client of the containerd instance of Images for
+	// exporting to other namespaces than Namespace. Nil if the worker doesn't
+	// use containerd.
+	Containerd *containerd.Client
+	Namespace  string
+	// ContainerdAddresses are the addresses of the containerd instances
+	// images may be exported to with containerd.address. Exporting to other
+	// containerd instances is denied if empty.
+	ContainerdAddresses []string
+	// ContainerdNamespaces are the other namespaces of Containerd images may
+	// be created in with namespaces. Exporting to other namespaces is denied
+	// if empty.
+	ContainerdNamespaces []string
 }
 
 type imageExporter struct {
@@ -66,9 +108,35 @@ func New(opt Opt) (exporter.Exporter, error) {
 func (e *imageExporter) Resolve(ctx context.Context, opt map[string]string) (exporter.ExporterInstance, error) {
 	i := &imageExporterInstance{
 		imageExporter:    e,
-		layerCompression: compression.Default,
+		layerCompression: compression.New(compression.Default),
+		pushOpt:          e.opt.Push,
 	}
 
+	annotations, opt, err := ParseAnnotations(opt)
+	if err != nil {
+		return nil, err
+	}
+	i.annotations = annotations
+
+	configPatch, opt, err := ParseConfigPatch(opt)
+	if err != nil {
+		return nil, err
+	}
+	i.configPatch = configPatch
+
+	targets, opt, err := parseTargetOpts(opt)
+	if err != nil {
+		return nil, err
+	}
+	i.targets = targets
+
+	sizeBudget, opt, err := ParseSizeBudget(opt)
+	if err != nil {
+		return nil, err
+	}
+	i.sizeBudget = sizeBudget
+
+	var ot *bool
 	for k, v := range opt {
 		switch k {
 		case keyImageName:
@@ -113,16 +181,19 @@ func (e *imageExporter) Resolve(ctx context.Context, opt map[string]string) (exp
 				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
 			}
 			i.unpack = b
+		case keyUnpackSnapshot:
+			i.unpackSnapshotter = v
 		case ociTypes:
+			ot = new(bool)
 			if v == "" {
-				i.ociTypes = true
+				*ot = true
 				continue
 			}
 			b, err := strconv.ParseBool(v)
 			if err != nil {
 				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
 			}
-			i.ociTypes = b
+			*ot = b
 		case keyDanglingPrefix:
 			i.danglingPrefix = v
 		case keyNameCanonical:
@@ -136,24 +207,184 @@ func (e *imageExporter) Resolve(ctx context.Context, opt map[string]string) (exp
 			}
 			i.nameCanonical = b
 		case keyLayerCompression:
-			switch v {
-			case "gzip":
-				i.layerCompression = compression.Gzip
-			case "uncompressed":
-				i.layerCompression = compression.Uncompressed
-			default:
-				return nil, errors.Errorf("unsupported layer compression type: %v", v)
+			c, err := compression.Parse(v)
+			if err != nil {
+				return nil, err
 			}
+			i.layerCompression.Type = c
 		case keyForceCompression:
 			if v == "" {
-				i.forceCompression = true
+				i.layerCompression.Force = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.layerCompression.Force = b
+		case keyCompressionLevel:
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-int value specified for %s", k)
+			}
+			i.layerCompression.Level = &n
+		case keyWasm:
+			if v == "" {
+				i.wasm = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.wasm = b
+		case exptypes.OptKeySourceDateEpoch:
+			epoch, err := ParseSourceDateEpoch(v)
+			if err != nil {
+				return nil, err
+			}
+			i.epoch = epoch
+		case keySquash:
+			if v == "" {
+				i.squash = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.squash = b
+		case keySquashFrom:
+			// the exporter doesn't know the stages of the frontend
+			return nil, errors.Errorf("%s is not supported, use %s to squash all layers", keySquashFrom, keySquash)
+		case keyWasmModule:
+			i.wasmModule = v
+		case keyAttestSBOM:
+			if v == "" {
+				i.attest.SBOM = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.attest.SBOM = b
+		case keyAttestProvenance:
+			if v == "" {
+				i.attest.Provenance = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.attest.Provenance = b
+		case keyAttestFiles:
+			if v == "" {
+				i.attest.FileManifest = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.attest.FileManifest = b
+		case keyAttestReferrers:
+			if v == "" {
+				i.attestReferrers = true
 				continue
 			}
 			b, err := strconv.ParseBool(v)
 			if err != nil {
 				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
 			}
-			i.forceCompression = b
+			i.attestReferrers = b
+		case keySign:
+			if v == "" {
+				i.sign = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.sign = b
+		case keySignKey:
+			i.signKey = v
+		case keyContainerdAddress:
+			if i.containerd == nil {
+				i.containerd = &remoteContainerd{namespace: defaultContainerdNamespace}
+			}
+			addr, err := parseContainerdAddress(v)
+			if err != nil {
+				return nil, err
+			}
+			i.containerd.address = addr
+		case keyContainerdNamespace:
+			if i.containerd == nil {
+				i.containerd = &remoteContainerd{namespace: defaultContainerdNamespace}
+			}
+			i.containerd.namespace = v
+		case keyNamespaces:
+			nss, err := parseNamespaces(v)
+			if err != nil {
+				return nil, err
+			}
+			i.namespaces = nss
+		case keyPlatforms:
+			ps, err := ParsePlatforms(v)
+			if err != nil {
+				return nil, err
+			}
+			i.platforms = ps
+		case keyPushAttempts:
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, errors.Errorf("invalid value %q for %s, expected a positive number", v, k)
+			}
+			i.pushOpt.Retry.Attempts = n
+		case keyPushTimeout:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid duration specified for %s", k)
+			}
+			i.pushOpt.Retry.Timeout = d
+		case keyPushConcurrency:
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, errors.Errorf("invalid value %q for %s, expected a positive number", v, k)
+			}
+			i.pushOpt.Concurrency = n
+		case keyArtifactType:
+			i.artifact.Type = v
+		case keyManifestType:
+			b, err := ParseManifestType(v)
+			if err != nil {
+				return nil, err
+			}
+			i.artifact.Manifest = b
+		case keyDelta:
+			if v == "" {
+				i.delta = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.delta = b
+		case keyKeepBlobsFor:
+			d, err := ParseKeepBlobsFor(v)
+			if err != nil {
+				return nil, err
+			}
+			i.keepBlobsFor = d
+		case keyPushChunkSize:
+			n, err := units.RAMInBytes(v)
+			if err != nil || n < 0 {
+				return nil, errors.Errorf("invalid value %q for %s, expected a size", v, k)
+			}
+			i.pushOpt.ChunkSize = n
 		default:
 			if i.meta == nil {
 				i.meta = make(map[string][]byte)
@@ -161,6 +392,19 @@ func (e *imageExporter) Resolve(ctx context.Context, opt map[string]string) (exp
 			i.meta[k] = []byte(v)
 		}
 	}
+	if ot == nil {
+		// zstd layers only have an OCI media type and annotations,
+		// attestations, layer deltas and artifacts are only exported in
+		// OCI manifests
+		i.ociTypes = i.layerCompression.Type.OnlySupportOCITypes() || !i.annotations.IsEmpty() || !i.attest.IsEmpty() || i.delta || !i.artifact.IsEmpty()
+	} else if !*ot && i.layerCompression.Type.OnlySupportOCITypes() {
+		return nil, errors.Errorf("%s compression requires %s", i.layerCompression.Type, ociTypes)
+	} else {
+		i.ociTypes = *ot
+	}
+	if i.sign && !pushesAny(i.push, i.targets) {
+		return nil, errors.Errorf("%s requires %s", keySign, keyPush)
+	}
 	return i, nil
 }
 
@@ -174,9 +418,40 @@ type imageExporterInstance struct {
 	ociTypes         bool
 	nameCanonical    bool
 	danglingPrefix   string
-	layerCompression compression.Type
-	forceCompression bool
-	meta             map[string][]byte
+	layerCompression compression.Config
+	annotations      Annotations
+	configPatch      ConfigPatch
+	targets          map[string]*targetOpts
+	epoch            *time.Time
+	squash           bool
+	wasm             bool
+	wasmModule       string
+	attest           Attestations
+	// attestReferrers pushes the attestation manifests as referrers of the
+	// image manifests instead of adding them to the index
+	attestReferrers bool
+	sign            bool
+	signKey         string
+	containerd      *remoteContainerd
+	pushOpt         push.Opt
+	platforms       []ocispecs.Platform
+	meta            map[string][]byte
+	// unpackSnapshotter is the name of the snapshotter the image is
+	// unpacked into, empty for the snapshotter of the worker
+	unpackSnapshotter string
+	// namespaces are other containerd namespaces of the worker the image is
+	// created in
+	namespaces []string
+	// keepBlobsFor is how long the exported content is kept after the
+	// export, 0 if it can be garbage collected when it isn't referenced
+	keepBlobsFor time.Duration
+	// delta adds the deltas of the layers from the layers of the previous
+	// image with the same name to the image
+	delta bool
+	// artifact exports the result as an artifact instead of an image
+	artifact Artifact
+	// sizeBudget is checked before the image is named or pushed
+	sizeBudget SizeBudget
 }
 
 func (e *imageExporterInstance) Name() string {
@@ -191,26 +466,135 @@ func (e *imageExporterInstance) Export(ctx context.Context, src exporter.Source,
 		src.Metadata[k] = v
 	}
 
+	src, err := FilterPlatforms(src, e.platforms)
+	if err != nil {
+		return nil, err
+	}
+
 	ctx, done, err := leaseutil.WithLease(ctx, e.opt.LeaseManager, leaseutil.MakeTemporary)
 	if err != nil {
 		return nil, err
 	}
 	defer done(context.TODO())
 
-	desc, err := e.opt.ImageWriter.Commit(ctx, src, e.ociTypes, e.layerCompression, e.forceCompression, sessionID)
+	if e.wasmModule != "" && !e.wasm {
+		return nil, errors.Errorf("%s requires %s=true", keyWasmModule, keyWasm)
+	}
+	if e.containerd != nil && e.containerd.address == "" {
+		return nil, errors.Errorf("%s requires %s", keyContainerdNamespace, keyContainerdAddress)
+	}
+	if e.containerd != nil && e.targetName == "" {
+		return nil, errors.Errorf("%s requires %s", keyContainerdAddress, keyImageName)
+	}
+	if e.containerd != nil && !e.opt.containerdAddressAllowed(e.containerd.address) {
+		return nil, errors.Errorf("exporting to containerd at %s is not allowed by the worker config", e.containerd.address)
+	}
+	if len(e.namespaces) > 0 && (e.opt.Containerd == nil || e.opt.Images == nil) {
+		return nil, errors.Errorf("%s is only supported by the containerd worker", keyNamespaces)
+	}
+	if len(e.namespaces) > 0 && e.targetName == "" && e.danglingPrefix == "" {
+		return nil, errors.Errorf("%s requires %s", keyNamespaces, keyImageName)
+	}
+	for _, ns := range e.namespaces {
+		if ns != e.opt.Namespace && !e.opt.containerdNamespaceAllowed(ns) {
+			return nil, errors.Errorf("exporting to namespace %s is not allowed by the worker config", ns)
+		}
+	}
+	if e.unpackSnapshotter != "" && !e.unpack {
+		return nil, errors.Errorf("%s requires %s=true", keyUnpackSnapshot, keyUnpack)
+	}
+	if e.wasm && e.unpack {
+		return nil, errors.Errorf("wasm artifacts can't be unpacked")
+	}
+	if e.wasm && !e.configPatch.IsEmpty() {
+		return nil, errors.Errorf("image config attrs are not supported for wasm artifacts")
+	}
+	if e.wasm && e.squash {
+		return nil, errors.Errorf("%s is not supported for wasm artifacts", keySquash)
+	}
+	if e.wasm && !e.attest.IsEmpty() {
+		return nil, errors.Errorf("attestations are not supported for wasm artifacts")
+	}
+	if e.wasm && e.delta {
+		return nil, errors.Errorf("%s is not supported for wasm artifacts", keyDelta)
+	}
+	if err := e.artifact.Validate(e.ociTypes, e.wasm, e.attest, e.configPatch, e.squash); err != nil {
+		return nil, err
+	}
+	if !e.artifact.IsEmpty() && (e.unpack || e.delta) {
+		return nil, errors.Errorf("%s and %s are not supported for artifacts", keyUnpack, keyDelta)
+	}
+	if e.layerCompression.Type == compression.Nydus && (e.unpack || e.delta) {
+		// the layers of nydus images are only mounted by nydus-snapshotter
+		return nil, errors.Errorf("%s and %s are not supported with %s compression", keyUnpack, keyDelta, compression.Nydus)
+	}
+	if e.attestReferrers && (e.attest.IsEmpty() || !pushesAny(e.push, e.targets)) {
+		return nil, errors.Errorf("%s requires attestations and push=true", keyAttestReferrers)
+	}
+	if e.delta && e.opt.Images == nil {
+		return nil, errors.Errorf("%s is only supported by the containerd worker", keyDelta)
+	}
+
+	if n, ok := src.Metadata["image.name"]; e.targetName == "*" && ok {
+		e.targetName = string(n)
+	}
+	if e.delta && (e.targetName == "" || e.targetName == "*") {
+		return nil, errors.Errorf("%s requires %s", keyDelta, keyImageName)
+	}
+
+	var desc *ocispecs.Descriptor
+	switch {
+	case e.wasm:
+		desc, err = e.opt.ImageWriter.CommitWasm(ctx, src, e.wasmModule, sessionID)
+	case !e.artifact.IsEmpty():
+		desc, err = e.opt.ImageWriter.CommitArtifact(ctx, src, e.artifact, e.layerCompression, e.annotations.Manifest, e.epoch, sessionID)
+	default:
+		desc, err = e.opt.ImageWriter.Commit(ctx, src, sessionID, CommitOpts{
+			OCITypes:     e.ociTypes,
+			Compression:  e.layerCompression,
+			Annotations:  e.annotations,
+			ConfigPatch:  e.configPatch,
+			Epoch:        e.epoch,
+			Squash:       e.squash,
+			Attestations: e.attest,
+		})
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	defer func() {
-		e.opt.ImageWriter.ContentStore().Delete(context.TODO(), desc.Digest)
-	}()
+	var referrers []ocispecs.Descriptor
+	if e.attestReferrers {
+		desc, referrers, err = e.opt.ImageWriter.SplitReferrers(ctx, *desc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.delta {
+		desc, err = e.commitDeltas(ctx, *desc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.keepBlobsFor > 0 {
+		if err := KeepBlobs(ctx, e.opt.LeaseManager, *desc, e.keepBlobsFor); err != nil {
+			return nil, err
+		}
+	} else {
+		defer func() {
+			e.opt.ImageWriter.ContentStore().Delete(context.TODO(), desc.Digest)
+		}()
+	}
 
 	resp := make(map[string]string)
 
-	if n, ok := src.Metadata["image.name"]; e.targetName == "*" && ok {
-		e.targetName = string(n)
+	sizes, err := e.sizeBudget.Check(ctx, e.opt.ImageWriter.ContentStore(), *desc)
+	if err != nil {
+		return nil, err
 	}
+	resp[exptypes.ExporterImageSizesKey] = sizes
 
 	nameCanonical := e.nameCanonical
 	if e.targetName == "" && e.danglingPrefix != "" {
@@ -220,7 +604,12 @@ func (e *imageExporterInstance) Export(ctx context.Context, src exporter.Source,
 
 	if e.targetName != "" {
 		targetNames := strings.Split(e.targetName, ",")
+		if err := validateTargetOpts(e.targets, targetNames); err != nil {
+			return nil, err
+		}
+		var containerdNames, imageNames, referrersMethods []string
 		for _, targetName := range targetNames {
+			doPush, pushByDigest, insecure := e.targets[targetName].apply(e.push, e.pushByDigest, e.insecure)
 			if e.opt.Images != nil {
 				tagDone := oneOffProgress(ctx, "naming to "+targetName)
 				img := images.Image{
@@ -233,6 +622,7 @@ func (e *imageExporterInstance) Export(ctx context.Context, src exporter.Source,
 				}
 				for _, sfx := range sfx {
 					img.Name = targetName + sfx
+					imageNames = append(imageNames, img.Name)
 					if _, err := e.opt.Images.Update(ctx, img); err != nil {
 						if !errors.Is(err, errdefs.ErrNotFound) {
 							return nil, tagDone(err)
@@ -251,38 +641,52 @@ func (e *imageExporterInstance) Export(ctx context.Context, src exporter.Source,
 					}
 				}
 			}
-			if e.push {
-				annotations := map[digest.Digest]map[string]string{}
-				mprovider := contentutil.NewMultiProvider(e.opt.ImageWriter.ContentStore())
-				if src.Ref != nil {
-					remote, err := src.Ref.GetRemote(ctx, false, e.layerCompression, e.forceCompression, session.NewGroup(sessionID))
+			if e.containerd != nil {
+				containerdNames = append(containerdNames, targetName)
+				if nameCanonical {
+					containerdNames = append(containerdNames, targetName+"@"+desc.Digest.String())
+				}
+			}
+			if doPush {
+				mprovider, annotations, err := e.contentProvider(ctx, src, sessionID)
+				if err != nil {
+					return nil, err
+				}
+				if err := push.Push(ctx, e.opt.SessionManager, sessionID, mprovider, e.opt.ImageWriter.ContentStore(), desc.Digest, targetName, insecure, e.opt.RegistryHosts, pushByDigest, annotations, e.pushOpt); err != nil {
+					return nil, err
+				}
+				if len(referrers) > 0 {
+					method, err := push.PushReferrers(ctx, e.opt.SessionManager, sessionID, e.opt.ImageWriter.ContentStore(), e.opt.RegistryHosts, targetName, insecure, referrers, e.pushOpt)
 					if err != nil {
 						return nil, err
 					}
-					for _, desc := range remote.Descriptors {
-						mprovider.Add(desc.Digest, remote.Provider)
-						addAnnotations(annotations, desc)
-					}
+					referrersMethods = append(referrersMethods, method)
 				}
-				if len(src.Refs) > 0 {
-					for _, r := range src.Refs {
-						remote, err := r.GetRemote(ctx, false, e.layerCompression, e.forceCompression, session.NewGroup(sessionID))
-						if err != nil {
-							return nil, err
-						}
-						for _, desc := range remote.Descriptors {
-							mprovider.Add(desc.Digest, remote.Provider)
-							addAnnotations(annotations, desc)
-						}
+				if e.sign {
+					if err := push.Sign(ctx, e.opt.SessionManager, sessionID, e.opt.ImageWriter.ContentStore(), e.opt.RegistryHosts, desc.Digest, targetName, insecure, e.signKey, e.pushOpt); err != nil {
+						return nil, err
 					}
 				}
-
-				if err := push.Push(ctx, e.opt.SessionManager, sessionID, mprovider, e.opt.ImageWriter.ContentStore(), desc.Digest, targetName, e.insecure, e.opt.RegistryHosts, e.pushByDigest, annotations); err != nil {
-					return nil, err
-				}
+			}
+		}
+		if len(e.namespaces) > 0 {
+			if err := e.exportToNamespaces(ctx, src, sessionID, *desc, imageNames); err != nil {
+				return nil, err
+			}
+		}
+		if e.containerd != nil {
+			mprovider, _, err := e.contentProvider(ctx, src, sessionID)
+			if err != nil {
+				return nil, err
+			}
+			if err := e.containerd.export(ctx, mprovider, *desc, containerdNames); err != nil {
+				return nil, err
 			}
 		}
 		resp["image.name"] = e.targetName
+		if len(referrersMethods) > 0 {
+			resp[exptypes.ExporterAttestationPushMethodKey] = strings.Join(referrersMethods, ",")
+		}
 	}
 
 	resp[exptypes.ExporterImageDigestKey] = desc.Digest.String()
@@ -292,6 +696,80 @@ func (e *imageExporterInstance) Export(ctx context.Context, src exporter.Source,
 	return resp, nil
 }
 
+// commitDeltas adds the deltas of the layers of the image desc from the
+// previous image with the first name of the export to the image
+func (e *imageExporterInstance) commitDeltas(ctx context.Context, desc ocispecs.Descriptor) (*ocispecs.Descriptor, error) {
+	name := strings.Split(e.targetName, ",")[0]
+	img, err := e.opt.Images.Get(ctx, name)
+	if err != nil {
+		if errors.Is(err, errdefs.ErrNotFound) {
+			// first build of the image
+			return &desc, nil
+		}
+		return nil, err
+	}
+	if img.Target.Digest == desc.Digest {
+		return &desc, nil
+	}
+	return e.opt.ImageWriter.CommitDeltas(ctx, desc, img.Target)
+}
+
+// exportToNamespaces creates the image with names in the other containerd
+// namespaces of the worker
+func (e *imageExporterInstance) exportToNamespaces(ctx context.Context, src exporter.Source, sessionID string, desc ocispecs.Descriptor, names []string) error {
+	mprovider, _, err := e.contentProvider(ctx, src, sessionID)
+	if err != nil {
+		return err
+	}
+	var snapshotter string
+	if e.unpack {
+		snapshotter = e.unpackSnapshotter
+		if snapshotter == "" {
+			snapshotter = e.opt.ImageWriter.Snapshotter().Name()
+		}
+	}
+	for _, ns := range e.namespaces {
+		if ns == e.opt.Namespace {
+			continue
+		}
+		done := oneOffProgress(ctx, "exporting to namespace "+ns)
+		if err := done(exportToNamespace(ctx, e.opt.Containerd, ns, mprovider, desc, names, snapshotter)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contentProvider returns a provider for the blobs of the exported image and
+// the annotations of its layers
+func (e *imageExporterInstance) contentProvider(ctx context.Context, src exporter.Source, sessionID string) (*contentutil.MultiProvider, map[digest.Digest]map[string]string, error) {
+	annotations := map[digest.Digest]map[string]string{}
+	mprovider := contentutil.NewMultiProvider(e.opt.ImageWriter.ContentStore())
+	if src.Ref != nil && !e.wasm {
+		remote, err := src.Ref.GetRemote(ctx, false, e.layerCompression, session.NewGroup(sessionID))
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, desc := range remote.Descriptors {
+			mprovider.Add(desc.Digest, remote.Provider)
+			addAnnotations(annotations, desc)
+		}
+	}
+	if len(src.Refs) > 0 {
+		for _, r := range src.Refs {
+			remote, err := r.GetRemote(ctx, false, e.layerCompression, session.NewGroup(sessionID))
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, desc := range remote.Descriptors {
+				mprovider.Add(desc.Digest, remote.Provider)
+				addAnnotations(annotations, desc)
+			}
+		}
+	}
+	return mprovider, annotations, nil
+}
+
 func (e *imageExporterInstance) unpackImage(ctx context.Context, img images.Image, src exporter.Source, s session.Group) (err0 error) {
 	unpackDone := oneOffProgress(ctx, "unpacking to "+img.Name)
 	defer func() {
@@ -303,6 +781,14 @@ func (e *imageExporterInstance) unpackImage(ctx context.Context, img images.Imag
 		applier      = e.opt.ImageWriter.Applier()
 		snapshotter  = e.opt.ImageWriter.Snapshotter()
 	)
+	if name := e.unpackSnapshotter; name != "" && name != snapshotter.Name() {
+		if e.opt.UnpackSnapshotter == nil {
+			return errors.Errorf("unpacking into snapshotter %s is not supported by this worker, it only supports %s", name, snapshotter.Name())
+		}
+		if snapshotter, err0 = e.opt.UnpackSnapshotter(name); err0 != nil {
+			return errors.Wrapf(err0, "failed to get snapshotter %s", name)
+		}
+	}
 
 	// fetch manifest by default platform
 	manifest, err := images.Manifest(ctx, contentStore, img.Target, platforms.Default())
@@ -319,7 +805,7 @@ func (e *imageExporterInstance) unpackImage(ctx context.Context, img images.Imag
 		}
 	}
 
-	remote, err := topLayerRef.GetRemote(ctx, true, e.layerCompression, e.forceCompression, s)
+	remote, err := topLayerRef.GetRemote(ctx, true, e.layerCompression, s)
 	if err != nil {
 		return err
 	}
@@ -331,7 +817,14 @@ func (e *imageExporterInstance) unpackImage(ctx context.Context, img images.Imag
 		}
 	}
 
-	layers, err := getLayers(ctx, remote.Descriptors, manifest)
+	var layers []rootfs.Layer
+	if e.epoch != nil || e.squash {
+		// the layers were rewritten or squashed, so the blobs of the ref
+		// aren't part of the image
+		layers, err = getManifestLayers(ctx, contentStore, manifest)
+	} else {
+		layers, err = getLayers(ctx, remote.Descriptors, manifest)
+	}
 	if err != nil {
 		return err
 	}
@@ -373,6 +866,35 @@ func getLayers(ctx context.Context, descs []ocispecs.Descriptor, manifest ocispe
 			Digest:    digest.Digest(desc.Annotations["containerd.io/uncompressed"]),
 		}
 		layers[i].Blob = manifest.Layers[i]
+		if desc.Digest != manifest.Layers[i].Digest {
+			// the manifest may reference the blob of another platform with
+			// the same diffID, see dedupeLayers
+			layers[i].Blob = desc
+		}
+	}
+	return layers, nil
+}
+
+func getManifestLayers(ctx context.Context, provider content.Provider, manifest ocispecs.Manifest) ([]rootfs.Layer, error) {
+	dt, err := content.ReadBlob(ctx, provider, manifest.Config)
+	if err != nil {
+		return nil, err
+	}
+	var img ocispecs.Image
+	if err := json.Unmarshal(dt, &img); err != nil {
+		return nil, errors.Wrap(err, "failed to parse image config")
+	}
+	if len(img.RootFS.DiffIDs) != len(manifest.Layers) {
+		return nil, errors.Errorf("mismatched image rootfs and manifest layers")
+	}
+
+	layers := make([]rootfs.Layer, len(manifest.Layers))
+	for i, desc := range manifest.Layers {
+		layers[i].Diff = ocispecs.Descriptor{
+			MediaType: ocispecs.MediaTypeImageLayer,
+			Digest:    img.RootFS.DiffIDs[i],
+		}
+		layers[i].Blob = desc
 	}
 	return layers, nil
 }
@@ -6,12 +6,38 @@ import (
 )
 
 const (
-	ExporterConfigDigestKey      = "config.digest"
-	ExporterImageDigestKey       = "containerimage.digest"
-	ExporterImageConfigKey       = "containerimage.config"
-	ExporterImageConfigDigestKey = "containerimage.config.digest"
-	ExporterInlineCache          = "containerimage.inlinecache"
-	ExporterPlatformsKey         = "refs.platforms"
+	ExporterConfigDigestKey       = "config.digest"
+	ExporterImageDigestKey        = "containerimage.digest"
+	ExporterImageConfigKey        = "containerimage.config"
+	ExporterImageConfigDigestKey  = "containerimage.config.digest"
+	ExporterInlineCache           = "containerimage.inlinecache"
+	ExporterPlatformsKey          = "refs.platforms"
+	ExporterProvenanceKey         = "attestation.provenance"
+	ExporterOCILayoutManifestsKey = "oci.layout.manifests"
+	// ExporterImageSizesKey is the JSON of the sizes of the exported images
+	// and their layers
+	ExporterImageSizesKey = "containerimage.sizes"
+	// ExporterAttestationPushMethodKey is the comma separated methods the
+	// attestations were pushed to the registries of the image names with,
+	// "referrers" or "tag"
+	ExporterAttestationPushMethodKey = "attestation.push-method"
+)
+
+// OptKeySourceDateEpoch is the attr of the image exporters setting the
+// SOURCE_DATE_EPOCH used for the timestamps of the exported image
+const OptKeySourceDateEpoch = "source-date-epoch"
+
+const (
+	// MediaTypeWasmConfig is the config media type of wasm module artifacts
+	MediaTypeWasmConfig = "application/vnd.wasm.config.v1+json"
+	// MediaTypeWasmLayer is the media type of the wasm module layer
+	MediaTypeWasmLayer = "application/vnd.wasm.content.layer.v1+wasm"
+	// MediaTypeLayerDelta is the media type of the gzip compressed deltas of
+	// uncompressed layers, see util/delta for the format
+	MediaTypeLayerDelta = "application/vnd.buildkit.layer.delta.v1+gzip"
+	// MediaTypeEmptyJSON is the media type of the empty config of artifacts
+	// exported as image manifests
+	MediaTypeEmptyJSON = "application/vnd.oci.empty.v1+json"
 )
 
 const EmptyGZLayer = digest.Digest("sha256:4f4fb700ef54461cfa02571ae0db9a0dc1e0cdb5577484a6d75e68dc38e8acc1")
@@ -0,0 +1,40 @@
+package containerimage
+
+import (
+	"context"
+	"time"
+
+	"github.com/containerd/containerd/leases"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// ParseKeepBlobsFor parses the duration of the keep-blobs-for attr
+func ParseKeepBlobsFor(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, errors.Errorf("invalid value %q for %s, expected a positive duration", v, keyKeepBlobsFor)
+	}
+	return d, nil
+}
+
+// KeepBlobs adds desc to a lease that expires after d, so that the exported
+// manifests, configs and layers referenced by desc aren't garbage collected
+// before, e.g. for following pushes of the image.
+func KeepBlobs(ctx context.Context, lm leases.Manager, desc ocispecs.Descriptor, d time.Duration) error {
+	// WithLabels replaces the labels, so it has to come before WithExpiration
+	l, err := lm.Create(ctx, leases.WithRandomID(), leases.WithLabels(map[string]string{
+		"buildkit/lease.exported": desc.Digest.String(),
+	}), leases.WithExpiration(d))
+	if err != nil {
+		return errors.Wrap(err, "failed to create lease for exported content")
+	}
+	if err := lm.AddResource(ctx, l, leases.Resource{
+		ID:   desc.Digest.String(),
+		Type: "content",
+	}); err != nil {
+		lm.Delete(context.TODO(), l)
+		return errors.Wrapf(err, "failed to add %s to lease", desc.Digest)
+	}
+	return nil
+}
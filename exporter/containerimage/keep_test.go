@@ -0,0 +1,82 @@
+package containerimage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/errdefs"
+	ctdmetadata "github.com/containerd/containerd/metadata"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/snapshots"
+	"github.com/moby/buildkit/util/leaseutil"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestParseKeepBlobsFor(t *testing.T) {
+	d, err := ParseKeepBlobsFor("2h")
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Hour, d)
+
+	for _, v := range []string{"0s", "-1h", "1", "foo"} {
+		_, err = ParseKeepBlobsFor(v)
+		require.Error(t, err, v)
+	}
+}
+
+func TestKeepBlobs(t *testing.T) {
+	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
+
+	tmpdir, err := ioutil.TempDir("", "keepblobs")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	store, err := local.NewStore(tmpdir)
+	require.NoError(t, err)
+	db, err := bolt.Open(filepath.Join(tmpdir, "containerdmeta.db"), 0644, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	mdb := ctdmetadata.NewDB(db, store, map[string]snapshots.Snapshotter{})
+	require.NoError(t, mdb.Init(context.TODO()))
+	lm := ctdmetadata.NewLeaseManager(mdb)
+	cs := mdb.ContentStore()
+
+	write := func(dt []byte) ocispecs.Descriptor {
+		desc := ocispecs.Descriptor{
+			MediaType: ocispecs.MediaTypeImageManifest,
+			Digest:    digest.FromBytes(dt),
+			Size:      int64(len(dt)),
+		}
+		ctx, done, err := leaseutil.WithLease(ctx, lm, leaseutil.MakeTemporary)
+		require.NoError(t, err)
+		defer done(ctx)
+		require.NoError(t, content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(dt), desc))
+		return desc
+	}
+
+	kept := write([]byte("kept"))
+	require.NoError(t, KeepBlobs(ctx, lm, kept, time.Hour))
+	released := write([]byte("released"))
+
+	_, err = mdb.GarbageCollect(ctx)
+	require.NoError(t, err)
+
+	_, err = cs.Info(ctx, kept.Digest)
+	require.NoError(t, err)
+	_, err = cs.Info(ctx, released.Digest)
+	require.True(t, errdefs.IsNotFound(err))
+
+	ls, err := lm.List(ctx, "labels.\"buildkit/lease.exported\"=="+kept.Digest.String())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(ls))
+	require.Contains(t, ls[0].Labels, "containerd.io/gc.expire")
+}
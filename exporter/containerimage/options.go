@@ -0,0 +1,68 @@
+package containerimage
+
+import (
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+)
+
+// CommonOptions are the attributes the image exporter shares with the oci
+// and docker exporters
+var CommonOptions = []exporter.Option{
+	{Key: keyLayerCompression, Type: "string", Values: []string{"uncompressed", "gzip", "zstd", "zstd:chunked", "estargz", "nydus"}, Description: "compression type of the layers"},
+	{Key: keyForceCompression, Type: "bool", Description: "recompress existing layers that don't match the compression type"},
+	{Key: keyCompressionLevel, Type: "int", Description: "compression level of the layers created for the export, 0-9 for gzip and estargz, 1-22 for zstd and zstd:chunked"},
+	{Key: ociTypes, Type: "bool", Description: "use OCI media types in the manifests"},
+	{Key: keyAnnotationPrefix + "<key>", Type: "string", Description: "add an annotation to the image manifest"},
+	{Key: keyAnnotationManifestPrefix + "<key>", Type: "string", Description: "add an annotation to the image manifest"},
+	{Key: keyAnnotationIndexPrefix + "<key>", Type: "string", Description: "add an annotation to the image index"},
+	{Key: keyConfigUser, Type: "string", Description: "set the user of the image config"},
+	{Key: keyConfigWorkingDir, Type: "string", Description: "set the working directory of the image config"},
+	{Key: keyConfigEntrypoint, Type: "string", Description: "set the entrypoint of the image config as JSON array or command line"},
+	{Key: keyConfigCmd, Type: "string", Description: "set the command of the image config as JSON array or command line"},
+	{Key: keyConfigStopSignal, Type: "string", Description: "set the stop signal of the image config"},
+	{Key: keyConfigLabelsPrefix + "<key>", Type: "string", Description: "set a label of the image config"},
+	{Key: keyConfigEnvPrefix + "<key>", Type: "string", Description: "set an environment variable of the image config"},
+	{Key: keySquash, Type: "bool", Description: "squash the layers of the image into a single layer"},
+	{Key: exptypes.OptKeySourceDateEpoch, Type: "int", Description: "clamp timestamps of the image to the Unix time"},
+	{Key: keyWasm, Type: "bool", Description: "export a WebAssembly module artifact"},
+	{Key: keyWasmModule, Type: "string", Description: "path of the WebAssembly module in the result"},
+	{Key: keyAttestSBOM, Type: "bool", Description: "attach an SBOM attestation"},
+	{Key: keyAttestProvenance, Type: "bool", Description: "attach a SLSA provenance attestation"},
+	{Key: keyAttestFiles, Type: "bool", Description: "attach a manifest of the files of every layer and of the root filesystem"},
+	{Key: keyPlatforms, Type: "string", Description: "comma separated platforms of the result to export"},
+	{Key: keyKeepBlobsFor, Type: "duration", Description: "keep the exported content in the content store of the worker for the duration"},
+	{Key: keyArtifactType, Type: "string", Description: "export the result as an artifact with the artifactType instead of a runnable image"},
+	{Key: keyMaxSize, Type: "size", Description: "maximum compressed size of the config and layers of every image, e.g. 500MiB"},
+	{Key: keyMaxLayerSize, Type: "size", Description: "maximum compressed size of every layer"},
+	{Key: keyMaxSizeMode, Type: "string", Values: []string{maxSizeModeError, maxSizeModeWarn}, Description: "fail the export or only warn when max-size or max-layer-size are exceeded"},
+}
+
+var imageOptions = append([]exporter.Option{
+	{Key: keyImageName, Type: "string", Description: "comma separated image names"},
+	{Key: keyPush, Type: "bool", Description: "push the image to the registry"},
+	{Key: keyPushByDigest, Type: "bool", Description: "push the image without a tag"},
+	{Key: keyInsecure, Type: "bool", Description: "push to an insecure HTTP registry"},
+	{Key: keyPush + ".<name>", Type: "bool", Description: "override push for one of the names"},
+	{Key: keyPushByDigest + ".<name>", Type: "bool", Description: "override push-by-digest for one of the names"},
+	{Key: keyInsecure + ".<name>", Type: "bool", Description: "override registry.insecure for one of the names"},
+	{Key: keyPushAttempts, Type: "int", Description: "maximum number of attempts of the push requests"},
+	{Key: keyPushTimeout, Type: "duration", Description: "timeout of every attempt to push a layer"},
+	{Key: keyPushConcurrency, Type: "int", Description: "maximum number of parallel blob uploads of the push"},
+	{Key: keyPushChunkSize, Type: "size", Description: "maximum size of the requests a layer is uploaded with, e.g. 64MiB"},
+	{Key: keyUnpack, Type: "bool", Description: "unpack the image after creation"},
+	{Key: keyUnpackSnapshot, Type: "string", Description: "name of the snapshotter to unpack the image into, defaults to the snapshotter of the worker"},
+	{Key: keyDanglingPrefix, Type: "string", Description: "name the image <value>@<digest>"},
+	{Key: keyNameCanonical, Type: "bool", Description: "add an additional canonical name <name>@<digest>"},
+	{Key: keySign, Type: "bool", Description: "sign the pushed image with a session provided key"},
+	{Key: keyAttestReferrers, Type: "bool", Description: "push the attestations as referrers of the images, listed in the index tagged sha256-<digest> for registries without the referrers API"},
+	{Key: keySignKey, Type: "string", Description: "ID of the signing key"},
+	{Key: keyContainerdAddress, Type: "string", Description: "address of a containerd instance to export the image to"},
+	{Key: keyContainerdNamespace, Type: "string", Description: "namespace of the image in the containerd instance"},
+	{Key: keyNamespaces, Type: "string", Description: "comma separated containerd namespaces of the worker to also create the image in"},
+	{Key: keyManifestType, Type: "string", Values: []string{manifestTypeImage, manifestTypeArtifact}, Description: "manifest of artifacts, artifacts always use an image manifest with artifactType as the OCI artifact manifest was removed from the image spec 1.1"},
+	{Key: keyDelta, Type: "bool", Description: "add deltas of the layers from the previous image with the same name"},
+}, CommonOptions...)
+
+func (e *imageExporter) Options() []exporter.Option {
+	return imageOptions
+}
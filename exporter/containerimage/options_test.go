@@ -0,0 +1,126 @@
+package containerimage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/util/push"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionsResolve(t *testing.T) {
+	// every described option must be accepted by Resolve and not end up in
+	// the image metadata
+	opt := map[string]string{}
+	for _, o := range imageOptions {
+		k := strings.NewReplacer("<key>", "org.example", "<name>", "example.com/img").Replace(o.Key)
+		switch {
+		case o.Key == keyPlatforms:
+			opt[k] = "linux/amd64,linux/arm64"
+		case len(o.Values) > 0:
+			opt[k] = o.Values[0]
+		case o.Type == "bool":
+			opt[k] = "true"
+		case o.Type == "int":
+			opt[k] = "1"
+		case o.Type == "duration":
+			opt[k] = "1s"
+		case o.Type == "size":
+			opt[k] = "16MiB"
+		default:
+			opt[k] = "v"
+		}
+	}
+	opt[keyImageName] = "example.com/img"
+
+	e := &imageExporter{}
+	inst, err := e.Resolve(context.TODO(), opt)
+	require.NoError(t, err)
+	require.Empty(t, inst.(*imageExporterInstance).meta)
+}
+
+func TestResolvePushOpt(t *testing.T) {
+	e := &imageExporter{opt: Opt{Push: push.Opt{Concurrency: 2, ChunkSize: 1 << 20}}}
+	inst, err := e.Resolve(context.TODO(), map[string]string{keyPushChunkSize: "64MiB"})
+	require.NoError(t, err)
+	require.Equal(t, push.Opt{Concurrency: 2, ChunkSize: 64 << 20}, inst.(*imageExporterInstance).pushOpt)
+
+	for _, v := range []string{"0", "-1", "foo"} {
+		_, err = e.Resolve(context.TODO(), map[string]string{keyPushConcurrency: v})
+		require.Error(t, err, v)
+	}
+}
+
+func TestResolveSign(t *testing.T) {
+	e := &imageExporter{}
+	inst, err := e.Resolve(context.TODO(), map[string]string{keyPush: "true", keySign: "true"})
+	require.NoError(t, err)
+	require.True(t, inst.(*imageExporterInstance).sign)
+
+	// only the pushed names are signed
+	inst, err = e.Resolve(context.TODO(), map[string]string{keyPush + ".localhost:5000/x:latest": "true", keySign: "true"})
+	require.NoError(t, err)
+	require.True(t, inst.(*imageExporterInstance).sign)
+
+	// the signature is pushed next to the image
+	_, err = e.Resolve(context.TODO(), map[string]string{keySign: "true"})
+	require.EqualError(t, err, "sign requires push")
+	_, err = e.Resolve(context.TODO(), map[string]string{keyPush + ".localhost:5000/x:latest": "false", keySign: "true"})
+	require.EqualError(t, err, "sign requires push")
+}
+
+func TestResolveSquashFrom(t *testing.T) {
+	e := &imageExporter{}
+	_, err := e.Resolve(context.TODO(), map[string]string{keySquashFrom: "base"})
+	require.EqualError(t, err, "squash-from is not supported, use squash to squash all layers")
+}
+
+func TestResolveContainerd(t *testing.T) {
+	e := &imageExporter{}
+	inst, err := e.Resolve(context.TODO(), map[string]string{keyContainerdAddress: "/run/containerd/containerd.sock"})
+	require.NoError(t, err)
+	require.Equal(t, &remoteContainerd{address: "unix:///run/containerd/containerd.sock", namespace: defaultContainerdNamespace}, inst.(*imageExporterInstance).containerd)
+
+	_, err = e.Resolve(context.TODO(), map[string]string{keyContainerdAddress: "http://10.0.0.1"})
+	require.Error(t, err)
+
+	inst, err = e.Resolve(context.TODO(), map[string]string{keyContainerdNamespace: "k8s.io"})
+	require.NoError(t, err)
+	require.Equal(t, &remoteContainerd{namespace: "k8s.io"}, inst.(*imageExporterInstance).containerd)
+}
+
+func TestResolveUnpackSnapshotter(t *testing.T) {
+	e := &imageExporter{}
+	inst, err := e.Resolve(context.TODO(), map[string]string{keyUnpack: "true", keyUnpackSnapshot: "stargz"})
+	require.NoError(t, err)
+	require.True(t, inst.(*imageExporterInstance).unpack)
+	require.Equal(t, "stargz", inst.(*imageExporterInstance).unpackSnapshotter)
+}
+
+func TestResolveNamespaces(t *testing.T) {
+	e := &imageExporter{}
+	inst, err := e.Resolve(context.TODO(), map[string]string{keyNamespaces: "default, k8s.io"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"default", "k8s.io"}, inst.(*imageExporterInstance).namespaces)
+
+	_, err = e.Resolve(context.TODO(), map[string]string{keyNamespaces: "default,k8s io"})
+	require.Error(t, err)
+}
+
+func TestResolveOCITypes(t *testing.T) {
+	e := &imageExporter{}
+	inst, err := e.Resolve(context.TODO(), map[string]string{keyLayerCompression: "zstd"})
+	require.NoError(t, err)
+	require.True(t, inst.(*imageExporterInstance).ociTypes)
+
+	inst, err = e.Resolve(context.TODO(), map[string]string{keyLayerCompression: "gzip", ociTypes: "false"})
+	require.NoError(t, err)
+	require.False(t, inst.(*imageExporterInstance).ociTypes)
+
+	// zstd layers have no docker media type
+	for _, c := range []string{"zstd", "zstd:chunked", "estargz"} {
+		_, err = e.Resolve(context.TODO(), map[string]string{keyLayerCompression: c, ociTypes: "false"})
+		require.EqualError(t, err, c+" compression requires oci-mediatypes")
+	}
+}
@@ -0,0 +1,131 @@
+package containerimage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const keyPlatforms = "platforms"
+
+// ParsePlatforms parses the comma separated platforms of the platforms attr
+// of the image exporters
+func ParsePlatforms(v string) ([]ocispecs.Platform, error) {
+	var ps []ocispecs.Platform
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		p, err := platforms.Parse(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid platform %q for %s", s, keyPlatforms)
+		}
+		ps = append(ps, platforms.Normalize(p))
+	}
+	if len(ps) == 0 {
+		return nil, errors.Errorf("no platforms specified for %s", keyPlatforms)
+	}
+	return ps, nil
+}
+
+// FilterPlatforms returns src with only the results for the platforms ps. An
+// error is returned if src has no result for one of the platforms.
+func FilterPlatforms(src exporter.Source, ps []ocispecs.Platform) (exporter.Source, error) {
+	if len(ps) == 0 {
+		return src, nil
+	}
+	if len(src.Refs) == 0 {
+		p, err := imagePlatform(src.Metadata[exptypes.ExporterImageConfigKey])
+		if err != nil {
+			return src, err
+		}
+		for _, want := range ps {
+			if !platforms.NewMatcher(want).Match(p) {
+				return src, errors.Errorf("result has no platform %s, only %s", platforms.Format(want), platforms.Format(p))
+			}
+		}
+		return src, nil
+	}
+
+	dt, ok := src.Metadata[exptypes.ExporterPlatformsKey]
+	if !ok {
+		return src, errors.Errorf("unable to filter multiple refs, missing platforms mapping")
+	}
+	var all exptypes.Platforms
+	if err := json.Unmarshal(dt, &all); err != nil {
+		return src, errors.Wrapf(err, "failed to parse platforms passed to exporter")
+	}
+
+	var filtered exptypes.Platforms
+	refs := map[string]cache.ImmutableRef{}
+	for _, want := range ps {
+		m := platforms.NewMatcher(want)
+		found := false
+		for _, p := range all.Platforms {
+			if _, ok := refs[p.ID]; ok || !m.Match(p.Platform) {
+				continue
+			}
+			r, ok := src.Refs[p.ID]
+			if !ok {
+				return src, errors.Errorf("failed to find ref for ID %s", p.ID)
+			}
+			refs[p.ID] = r
+			filtered.Platforms = append(filtered.Platforms, p)
+			found = true
+			break
+		}
+		if !found {
+			return src, errors.Errorf("result has no platform %s", platforms.Format(want))
+		}
+	}
+
+	dt, err := json.Marshal(filtered)
+	if err != nil {
+		return src, errors.Wrap(err, "failed to marshal platforms")
+	}
+	out := exporter.Source{
+		Refs:     refs,
+		Metadata: make(map[string][]byte, len(src.Metadata)),
+	}
+	for k, v := range src.Metadata {
+		out.Metadata[k] = v
+	}
+	out.Metadata[exptypes.ExporterPlatformsKey] = dt
+	return out, nil
+}
+
+// SinglePlatform turns a result with refs for a single platform into a
+// single ref result
+func SinglePlatform(src exporter.Source) exporter.Source {
+	if len(src.Refs) != 1 {
+		return src
+	}
+	var id string
+	for k := range src.Refs {
+		id = k
+	}
+	out := exporter.Source{
+		Ref:      src.Refs[id],
+		Metadata: make(map[string][]byte, len(src.Metadata)),
+	}
+	for k, v := range src.Metadata {
+		out.Metadata[k] = v
+	}
+	delete(out.Metadata, exptypes.ExporterPlatformsKey)
+	for _, k := range []string{exptypes.ExporterImageConfigKey, exptypes.ExporterInlineCache} {
+		if v, ok := src.Metadata[fmt.Sprintf("%s/%s", k, id)]; ok {
+			out.Metadata[k] = v
+		} else {
+			delete(out.Metadata, k)
+		}
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package containerimage
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePlatforms(t *testing.T) {
+	ps, err := ParsePlatforms("linux/amd64, linux/arm64")
+	require.NoError(t, err)
+	require.Equal(t, []ocispecs.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64"},
+	}, ps)
+
+	_, err = ParsePlatforms("")
+	require.Error(t, err)
+	_, err = ParsePlatforms("linux/amd64,foo/bar/baz/qux")
+	require.Error(t, err)
+}
+
+func TestFilterPlatforms(t *testing.T) {
+	all := exptypes.Platforms{Platforms: []exptypes.Platform{
+		{ID: "linux/amd64", Platform: ocispecs.Platform{OS: "linux", Architecture: "amd64"}},
+		{ID: "linux/arm64", Platform: ocispecs.Platform{OS: "linux", Architecture: "arm64"}},
+		{ID: "linux/s390x", Platform: ocispecs.Platform{OS: "linux", Architecture: "s390x"}},
+	}}
+	dt, err := json.Marshal(all)
+	require.NoError(t, err)
+	src := exporter.Source{
+		Refs: map[string]cache.ImmutableRef{
+			"linux/amd64": nil,
+			"linux/arm64": nil,
+			"linux/s390x": nil,
+		},
+		Metadata: map[string][]byte{
+			exptypes.ExporterPlatformsKey:                    dt,
+			exptypes.ExporterImageConfigKey + "/linux/arm64": []byte(`{"architecture":"arm64"}`),
+		},
+	}
+
+	out, err := FilterPlatforms(src, []ocispecs.Platform{{OS: "linux", Architecture: "s390x"}, {OS: "linux", Architecture: "arm64", Variant: "v8"}})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(out.Refs))
+	var p exptypes.Platforms
+	require.NoError(t, json.Unmarshal(out.Metadata[exptypes.ExporterPlatformsKey], &p))
+	require.Equal(t, []exptypes.Platform{all.Platforms[2], all.Platforms[1]}, p.Platforms)
+	// the source is not modified
+	require.Equal(t, 3, len(src.Refs))
+	require.Equal(t, dt, src.Metadata[exptypes.ExporterPlatformsKey])
+
+	_, err = FilterPlatforms(src, []ocispecs.Platform{{OS: "windows", Architecture: "amd64"}})
+	require.Error(t, err)
+
+	out, err = FilterPlatforms(src, []ocispecs.Platform{{OS: "linux", Architecture: "arm64"}})
+	require.NoError(t, err)
+	out = SinglePlatform(out)
+	require.Nil(t, out.Refs)
+	require.Equal(t, `{"architecture":"arm64"}`, string(out.Metadata[exptypes.ExporterImageConfigKey]))
+	require.Nil(t, out.Metadata[exptypes.ExporterPlatformsKey])
+
+	single := exporter.Source{Metadata: map[string][]byte{
+		exptypes.ExporterImageConfigKey: []byte(`{"os":"linux","architecture":"amd64"}`),
+	}}
+	_, err = FilterPlatforms(single, []ocispecs.Platform{{OS: "linux", Architecture: "amd64"}})
+	require.NoError(t, err)
+	_, err = FilterPlatforms(single, []ocispecs.Platform{{OS: "linux", Architecture: "arm64"}})
+	require.Error(t, err)
+}
@@ -0,0 +1,172 @@
+package containerimage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/docker/go-units"
+	"github.com/moby/buildkit/exporter/attestation"
+	"github.com/moby/buildkit/util/progress/logs"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyMaxSize      = "max-size"
+	keyMaxLayerSize = "max-layer-size"
+	keyMaxSizeMode  = "max-size-mode"
+
+	maxSizeModeError = "error"
+	maxSizeModeWarn  = "warn"
+)
+
+// SizeBudget limits the sizes of the exported images and their layers. The
+// sizes are the compressed sizes that are pushed and pulled.
+type SizeBudget struct {
+	// MaxSize is the maximum size of the config and layers of an image, 0
+	// doesn't limit the size
+	MaxSize int64
+	// MaxLayerSize is the maximum size of a layer, 0 doesn't limit the size
+	MaxLayerSize int64
+	// Warn reports exceeded budgets as warnings instead of failing the export
+	Warn bool
+}
+
+// ParseSizeBudget parses the size budget attrs of the image exporters and
+// returns the other attrs
+func ParseSizeBudget(opt map[string]string) (SizeBudget, map[string]string, error) {
+	var b SizeBudget
+	rest := make(map[string]string, len(opt))
+	for k, v := range opt {
+		switch k {
+		case keyMaxSize, keyMaxLayerSize:
+			n, err := units.RAMInBytes(v)
+			if err != nil || n <= 0 {
+				return b, nil, errors.Errorf("invalid value %q for %s, expected a size", v, k)
+			}
+			if k == keyMaxSize {
+				b.MaxSize = n
+			} else {
+				b.MaxLayerSize = n
+			}
+		case keyMaxSizeMode:
+			switch v {
+			case "", maxSizeModeError:
+				b.Warn = false
+			case maxSizeModeWarn:
+				b.Warn = true
+			default:
+				return b, nil, errors.Errorf("invalid value %q for %s, expected %s or %s", v, k, maxSizeModeError, maxSizeModeWarn)
+			}
+		default:
+			rest[k] = v
+		}
+	}
+	return b, rest, nil
+}
+
+// LayerSize is the size of a layer of an exported image
+type LayerSize struct {
+	Digest    digest.Digest `json:"digest"`
+	MediaType string        `json:"mediaType"`
+	Size      int64         `json:"size"`
+}
+
+// ImageSize is the size of an exported image with the sizes of its layers
+type ImageSize struct {
+	// Platform is empty for images without platform, e.g. artifacts
+	Platform string      `json:"platform,omitempty"`
+	Size     int64       `json:"size"`
+	Layers   []LayerSize `json:"layers"`
+}
+
+// ImageSizes returns the sizes of the images of desc. Attestation and other
+// referrer manifests are not included.
+func ImageSizes(ctx context.Context, cs content.Provider, desc ocispecs.Descriptor) ([]ImageSize, error) {
+	manifests := []ocispecs.Descriptor{desc}
+	switch desc.MediaType {
+	case ocispecs.MediaTypeImageIndex, images.MediaTypeDockerSchema2ManifestList:
+		dt, err := content.ReadBlob(ctx, cs, desc)
+		if err != nil {
+			return nil, err
+		}
+		var idx ocispecs.Index
+		if err := json.Unmarshal(dt, &idx); err != nil {
+			return nil, errors.Wrap(err, "failed to parse index")
+		}
+		manifests = idx.Manifests
+	}
+
+	var sizes []ImageSize
+	for _, m := range manifests {
+		if _, ok := m.Annotations[attestation.AnnotationReferenceType]; ok {
+			continue
+		}
+		dt, err := content.ReadBlob(ctx, cs, m)
+		if err != nil {
+			return nil, err
+		}
+		var mfst struct {
+			Config ocispecs.Descriptor   `json:"config"`
+			Layers []ocispecs.Descriptor `json:"layers"`
+		}
+		if err := json.Unmarshal(dt, &mfst); err != nil {
+			return nil, errors.Wrap(err, "failed to parse manifest")
+		}
+		s := ImageSize{Size: mfst.Config.Size, Layers: []LayerSize{}}
+		if m.Platform != nil {
+			s.Platform = platforms.Format(*m.Platform)
+		}
+		for _, l := range mfst.Layers {
+			s.Layers = append(s.Layers, LayerSize{Digest: l.Digest, MediaType: l.MediaType, Size: l.Size})
+			s.Size += l.Size
+		}
+		sizes = append(sizes, s)
+	}
+	return sizes, nil
+}
+
+// Check returns the sizes of the images of desc as JSON for the exporter
+// response. An error is returned for exceeded budgets unless b.Warn is set,
+// then they are reported as warnings in the progress.
+func (b SizeBudget) Check(ctx context.Context, cs content.Provider, desc ocispecs.Descriptor) (string, error) {
+	sizes, err := ImageSizes(ctx, cs, desc)
+	if err != nil {
+		return "", err
+	}
+	var exceeded []string
+	for _, s := range sizes {
+		name := "image"
+		if s.Platform != "" {
+			name = "image " + s.Platform
+		}
+		if b.MaxSize > 0 && s.Size > b.MaxSize {
+			exceeded = append(exceeded, fmt.Sprintf("%s size %s exceeds %s %s", name, units.BytesSize(float64(s.Size)), keyMaxSize, units.BytesSize(float64(b.MaxSize))))
+		}
+		for _, l := range s.Layers {
+			if b.MaxLayerSize > 0 && l.Size > b.MaxLayerSize {
+				exceeded = append(exceeded, fmt.Sprintf("%s layer %s size %s exceeds %s %s", name, l.Digest, units.BytesSize(float64(l.Size)), keyMaxLayerSize, units.BytesSize(float64(b.MaxLayerSize))))
+			}
+		}
+	}
+	if len(exceeded) > 0 {
+		if !b.Warn {
+			return "", errors.Errorf("size budget exceeded: %s", strings.Join(exceeded, ", "))
+		}
+		logWarning := logs.LoggerFromContext(ctx)
+		for _, msg := range exceeded {
+			logWarning([]byte("WARNING: " + msg + "\n"))
+		}
+	}
+	dt, err := json.Marshal(sizes)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(dt), nil
+}
@@ -0,0 +1,109 @@
+package containerimage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/moby/buildkit/exporter/attestation"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSizeBudget(t *testing.T) {
+	b, rest, err := ParseSizeBudget(map[string]string{
+		keyMaxSize:      "1GiB",
+		keyMaxLayerSize: "100MB",
+		keyMaxSizeMode:  maxSizeModeWarn,
+		keyImageName:    "foo",
+	})
+	require.NoError(t, err)
+	require.Equal(t, SizeBudget{MaxSize: 1 << 30, MaxLayerSize: 100 << 20, Warn: true}, b)
+	require.Equal(t, map[string]string{keyImageName: "foo"}, rest)
+
+	for _, opt := range []map[string]string{
+		{keyMaxSize: "0"},
+		{keyMaxLayerSize: "foo"},
+		{keyMaxSizeMode: "ignore"},
+	} {
+		_, _, err := ParseSizeBudget(opt)
+		require.Error(t, err, opt)
+	}
+}
+
+func TestSizeBudgetCheck(t *testing.T) {
+	ctx := context.TODO()
+	cs, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	writeBlob := func(mediaType string, dt []byte) ocispecs.Descriptor {
+		desc := ocispecs.Descriptor{
+			MediaType: mediaType,
+			Digest:    digest.FromBytes(dt),
+			Size:      int64(len(dt)),
+		}
+		err := content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(dt), desc)
+		require.NoError(t, err)
+		return desc
+	}
+	writeJSON := func(mediaType string, v interface{}) ocispecs.Descriptor {
+		dt, err := json.Marshal(v)
+		require.NoError(t, err)
+		return writeBlob(mediaType, dt)
+	}
+
+	mfst := ocispecs.Manifest{
+		Config: writeBlob(ocispecs.MediaTypeImageConfig, []byte("{}")),
+		Layers: []ocispecs.Descriptor{
+			writeBlob(ocispecs.MediaTypeImageLayerGzip, bytes.Repeat([]byte{1}, 100)),
+			writeBlob(ocispecs.MediaTypeImageLayerGzip, bytes.Repeat([]byte{2}, 300)),
+		},
+	}
+	mfst.SchemaVersion = 2
+	mdesc := writeJSON(ocispecs.MediaTypeImageManifest, mfst)
+	mdesc.Platform = &ocispecs.Platform{OS: "linux", Architecture: "arm64"}
+	att := writeJSON(ocispecs.MediaTypeImageManifest, ocispecs.Manifest{Config: mfst.Config})
+	att.Annotations = map[string]string{attestation.AnnotationReferenceType: attestation.ReferenceTypeAttestation}
+	idx := ocispecs.Index{Manifests: []ocispecs.Descriptor{mdesc, att}}
+	idx.SchemaVersion = 2
+	desc := writeJSON(ocispecs.MediaTypeImageIndex, idx)
+
+	sizes, err := ImageSizes(ctx, cs, desc)
+	require.NoError(t, err)
+	require.Equal(t, []ImageSize{{
+		Platform: "linux/arm64",
+		Size:     402,
+		Layers: []LayerSize{
+			{Digest: mfst.Layers[0].Digest, MediaType: ocispecs.MediaTypeImageLayerGzip, Size: 100},
+			{Digest: mfst.Layers[1].Digest, MediaType: ocispecs.MediaTypeImageLayerGzip, Size: 300},
+		},
+	}}, sizes)
+
+	dt, err := SizeBudget{}.Check(ctx, cs, desc)
+	require.NoError(t, err)
+	var resp []ImageSize
+	require.NoError(t, json.Unmarshal([]byte(dt), &resp))
+	require.Equal(t, sizes, resp)
+
+	_, err = SizeBudget{MaxSize: 402, MaxLayerSize: 300}.Check(ctx, cs, desc)
+	require.NoError(t, err)
+
+	_, err = SizeBudget{MaxLayerSize: 200}.Check(ctx, cs, desc)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "image linux/arm64 layer "+mfst.Layers[1].Digest.String())
+
+	_, err = SizeBudget{MaxSize: 400}.Check(ctx, cs, desc)
+	require.EqualError(t, err, "size budget exceeded: image linux/arm64 size 402B exceeds max-size 400B")
+
+	_, err = SizeBudget{MaxSize: 400, Warn: true}.Check(ctx, cs, desc)
+	require.NoError(t, err)
+
+	// single platform images
+	mdesc.Platform = nil
+	_, err = SizeBudget{MaxSize: 400}.Check(ctx, cs, mdesc)
+	require.EqualError(t, err, "size budget exceeded: image size 402B exceeds max-size 400B")
+}
@@ -0,0 +1,108 @@
+package containerimage
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// targetOpts are the push settings of a single image name, overriding the
+// settings of the exporter
+type targetOpts struct {
+	push         *bool
+	pushByDigest *bool
+	insecure     *bool
+}
+
+// parseTargetOpts parses the per-name push attrs of the image exporter:
+// "push.<name>", "push-by-digest.<name>" and "registry.insecure.<name>".
+// The attrs that aren't per-name settings are returned.
+func parseTargetOpts(opt map[string]string) (map[string]*targetOpts, map[string]string, error) {
+	targets := map[string]*targetOpts{}
+	rest := make(map[string]string, len(opt))
+	for k, v := range opt {
+		var name string
+		var field func(*targetOpts) **bool
+		switch {
+		case strings.HasPrefix(k, keyPushByDigest+"."):
+			name, field = strings.TrimPrefix(k, keyPushByDigest+"."), func(t *targetOpts) **bool { return &t.pushByDigest }
+		case strings.HasPrefix(k, keyPush+"."):
+			name, field = strings.TrimPrefix(k, keyPush+"."), func(t *targetOpts) **bool { return &t.push }
+		case strings.HasPrefix(k, keyInsecure+"."):
+			name, field = strings.TrimPrefix(k, keyInsecure+"."), func(t *targetOpts) **bool { return &t.insecure }
+		default:
+			rest[k] = v
+			continue
+		}
+		if name == "" {
+			return nil, nil, errors.Errorf("missing image name in %s", k)
+		}
+		b := true
+		if v != "" {
+			var err error
+			b, err = strconv.ParseBool(v)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+		}
+		t, ok := targets[name]
+		if !ok {
+			t = &targetOpts{}
+			targets[name] = t
+		}
+		*field(t) = &b
+	}
+	return targets, rest, nil
+}
+
+// validateTargetOpts checks that all per-name settings refer to an exported
+// name
+func validateTargetOpts(targets map[string]*targetOpts, names []string) error {
+	m := make(map[string]struct{}, len(names))
+	for _, n := range names {
+		m[n] = struct{}{}
+	}
+	var unknown []string
+	for n := range targets {
+		if _, ok := m[n]; !ok {
+			unknown = append(unknown, n)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return errors.Errorf("push settings for %s don't match any exported name", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func (t *targetOpts) apply(push, pushByDigest, insecure bool) (bool, bool, bool) {
+	if t == nil {
+		return push, pushByDigest, insecure
+	}
+	if t.push != nil {
+		push = *t.push
+	}
+	if t.pushByDigest != nil {
+		pushByDigest = *t.pushByDigest
+	}
+	if t.insecure != nil {
+		insecure = *t.insecure
+	}
+	return push, pushByDigest, insecure
+}
+
+// pushesAny returns true if push is set or any name is pushed by its
+// per-name setting
+func pushesAny(push bool, targets map[string]*targetOpts) bool {
+	if push {
+		return true
+	}
+	for _, t := range targets {
+		if t.push != nil && *t.push {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package containerimage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTargetOpts(t *testing.T) {
+	targets, rest, err := parseTargetOpts(map[string]string{
+		"name":                              "a.example.com/x,b.example.com/x",
+		"push":                              "true",
+		"registry.insecure":                 "false",
+		"registry.insecure.b.example.com/x": "true",
+		"push-by-digest.a.example.com/x":    "",
+		"push.localhost:5000/x:latest":      "false",
+		"annotation.org.opencontainers.foo": "bar",
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"name":                              "a.example.com/x,b.example.com/x",
+		"push":                              "true",
+		"registry.insecure":                 "false",
+		"annotation.org.opencontainers.foo": "bar",
+	}, rest)
+	require.Len(t, targets, 3)
+
+	push, byDigest, insecure := targets["b.example.com/x"].apply(true, false, false)
+	require.Equal(t, []bool{true, false, true}, []bool{push, byDigest, insecure})
+	push, byDigest, insecure = targets["a.example.com/x"].apply(true, false, false)
+	require.Equal(t, []bool{true, true, false}, []bool{push, byDigest, insecure})
+	push, byDigest, insecure = targets["localhost:5000/x:latest"].apply(true, false, false)
+	require.Equal(t, []bool{false, false, false}, []bool{push, byDigest, insecure})
+	push, byDigest, insecure = targets["c.example.com/x"].apply(true, true, true)
+	require.Equal(t, []bool{true, true, true}, []bool{push, byDigest, insecure})
+
+	require.NoError(t, validateTargetOpts(targets, []string{"a.example.com/x", "b.example.com/x", "localhost:5000/x:latest"}))
+	err = validateTargetOpts(targets, []string{"a.example.com/x"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "b.example.com/x, localhost:5000/x:latest")
+
+	_, _, err = parseTargetOpts(map[string]string{"registry.insecure.a.example.com/x": "maybe"})
+	require.Error(t, err)
+	_, _, err = parseTargetOpts(map[string]string{"push.": "true"})
+	require.Error(t, err)
+}
@@ -0,0 +1,180 @@
+package containerimage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/continuity/fs"
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/snapshot"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// CommitWasm writes an OCI artifact for a wasm module in the build result.
+// module is the path of the module in the result. If empty, the result must
+// contain exactly one .wasm file.
+func (ic *ImageWriter) CommitWasm(ctx context.Context, inp exporter.Source, module string, sessionID string) (*ocispecs.Descriptor, error) {
+	if len(inp.Refs) > 0 {
+		return nil, errors.Errorf("wasm export does not support multiple results")
+	}
+	if inp.Ref == nil {
+		return nil, errors.Errorf("wasm export requires a build result containing a .wasm module")
+	}
+
+	mount, err := inp.Ref.Mount(ctx, true, session.NewGroup(sessionID))
+	if err != nil {
+		return nil, err
+	}
+	lm := snapshot.LocalMounter(mount)
+	root, err := lm.Mount()
+	if err != nil {
+		return nil, err
+	}
+	defer lm.Unmount()
+
+	p, err := findWasmModule(root, module)
+	if err != nil {
+		return nil, err
+	}
+
+	layerDesc, err := ic.writeWasmModule(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	config := []byte("{}")
+	configDesc := ocispecs.Descriptor{
+		Digest:    digest.FromBytes(config),
+		Size:      int64(len(config)),
+		MediaType: exptypes.MediaTypeWasmConfig,
+	}
+	if err := content.WriteBlob(ctx, ic.opt.ContentStore, configDesc.Digest.String(), bytes.NewReader(config), configDesc); err != nil {
+		return nil, errors.Wrap(err, "error writing config blob")
+	}
+
+	mfst := struct {
+		// MediaType is reserved in the OCI spec but
+		// excluded from go types.
+		MediaType string `json:"mediaType,omitempty"`
+
+		ocispecs.Manifest
+	}{
+		MediaType: ocispecs.MediaTypeImageManifest,
+		Manifest: ocispecs.Manifest{
+			Versioned: specs.Versioned{
+				SchemaVersion: 2,
+			},
+			Config: configDesc,
+			Layers: []ocispecs.Descriptor{*layerDesc},
+		},
+	}
+	mfstJSON, err := json.MarshalIndent(mfst, "", "   ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal manifest")
+	}
+	mfstDesc := ocispecs.Descriptor{
+		Digest:    digest.FromBytes(mfstJSON),
+		Size:      int64(len(mfstJSON)),
+		MediaType: ocispecs.MediaTypeImageManifest,
+	}
+	mfstDone := oneOffProgress(ctx, "exporting wasm manifest "+mfstDesc.Digest.String())
+	labels := map[string]string{
+		"containerd.io/gc.ref.content.0": configDesc.Digest.String(),
+		"containerd.io/gc.ref.content.1": layerDesc.Digest.String(),
+	}
+	if err := content.WriteBlob(ctx, ic.opt.ContentStore, mfstDesc.Digest.String(), bytes.NewReader(mfstJSON), mfstDesc, content.WithLabels(labels)); err != nil {
+		return nil, mfstDone(errors.Wrapf(err, "error writing manifest blob %s", mfstDesc.Digest))
+	}
+	mfstDone(nil)
+
+	mfstDesc.Annotations = map[string]string{
+		exptypes.ExporterConfigDigestKey: configDesc.Digest.String(),
+	}
+	return &mfstDesc, nil
+}
+
+func (ic *ImageWriter) writeWasmModule(ctx context.Context, p string) (*ocispecs.Descriptor, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dgstr := digest.Canonical.Digester()
+	size, err := io.Copy(dgstr.Hash(), f)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	desc := ocispecs.Descriptor{
+		Digest:    dgstr.Digest(),
+		Size:      size,
+		MediaType: exptypes.MediaTypeWasmLayer,
+		Annotations: map[string]string{
+			ocispecs.AnnotationTitle: filepath.Base(p),
+		},
+	}
+	done := oneOffProgress(ctx, "exporting wasm module "+desc.Digest.String())
+	if err := content.WriteBlob(ctx, ic.opt.ContentStore, desc.Digest.String(), f, desc); err != nil {
+		return nil, done(errors.Wrap(err, "error writing wasm module blob"))
+	}
+	done(nil)
+	return &desc, nil
+}
+
+func findWasmModule(root, module string) (string, error) {
+	if module != "" {
+		p, err := fs.RootPath(root, module)
+		if err != nil {
+			return "", err
+		}
+		fi, err := os.Stat(p)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to find wasm module %s", module)
+		}
+		if !fi.Mode().IsRegular() {
+			return "", errors.Errorf("wasm module %s is not a regular file", module)
+		}
+		return p, nil
+	}
+
+	var found []string
+	if err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() && strings.HasSuffix(fi.Name(), ".wasm") {
+			found = append(found, p)
+		}
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	switch len(found) {
+	case 0:
+		return "", errors.Errorf("no .wasm module found in the build result")
+	case 1:
+		return found[0], nil
+	default:
+		rel := make([]string, 0, len(found))
+		for _, p := range found {
+			r, _ := filepath.Rel(root, p)
+			rel = append(rel, "/"+r)
+		}
+		return "", errors.Errorf("multiple .wasm modules found in the build result, select one with wasm-module: %s", strings.Join(rel, ", "))
+	}
+}
@@ -0,0 +1,40 @@
+package containerimage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindWasmModule(t *testing.T) {
+	root, err := ioutil.TempDir("", "wasmtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	_, err = findWasmModule(root, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no .wasm module")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "out"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "out/app.wasm"), []byte("\x00asm"), 0644))
+
+	p, err := findWasmModule(root, "")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, "out/app.wasm"), p)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "lib.wasm"), []byte("\x00asm"), 0644))
+	_, err = findWasmModule(root, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "/lib.wasm, /out/app.wasm")
+
+	p, err = findWasmModule(root, "/out/app.wasm")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, "out/app.wasm"), p)
+
+	_, err = findWasmModule(root, "out")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not a regular file")
+}
@@ -19,11 +19,13 @@ import (
 	"github.com/containerd/containerd/platforms"
 	"github.com/moby/buildkit/cache"
 	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/attestation"
 	"github.com/moby/buildkit/exporter/containerimage/exptypes"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/snapshot"
 	"github.com/moby/buildkit/solver"
 	"github.com/moby/buildkit/util/compression"
+	"github.com/moby/buildkit/util/contentutil"
 	"github.com/moby/buildkit/util/progress"
 	"github.com/moby/buildkit/util/system"
 	digest "github.com/opencontainers/go-digest"
@@ -38,6 +40,13 @@ type WriterOpt struct {
 	ContentStore content.Store
 	Applier      diff.Applier
 	Differ       diff.Comparer
+	// SBOMScanner generates the SBOMs of SBOM attestations. If nil,
+	// attestation.DefaultSBOMScanner is used.
+	SBOMScanner attestation.Scanner
+	// TempDir is the directory of the temporary files of the writer, e.g.
+	// the decompressed base layers of layer deltas. If empty, the default
+	// directory for temporary files is used.
+	TempDir string
 }
 
 func NewImageWriter(opt WriterOpt) (*ImageWriter, error) {
@@ -48,27 +57,73 @@ type ImageWriter struct {
 	opt WriterOpt
 }
 
-func (ic *ImageWriter) Commit(ctx context.Context, inp exporter.Source, oci bool, compressionType compression.Type, forceCompression bool, sessionID string) (*ocispecs.Descriptor, error) {
+// CommitOpts are the options of the image written by ImageWriter.Commit
+type CommitOpts struct {
+	// OCITypes writes OCI media types instead of Docker media types
+	OCITypes    bool
+	Compression compression.Config
+	Annotations Annotations
+	ConfigPatch ConfigPatch
+	// Epoch rewrites the timestamps of the layers and the config, if set
+	Epoch *time.Time
+	// Squash writes the layers of each platform as a single layer
+	Squash       bool
+	Attestations Attestations
+}
+
+func (ic *ImageWriter) Commit(ctx context.Context, inp exporter.Source, sessionID string, opts CommitOpts) (*ocispecs.Descriptor, error) {
 	platformsBytes, ok := inp.Metadata[exptypes.ExporterPlatformsKey]
 
 	if len(inp.Refs) > 0 && !ok {
 		return nil, errors.Errorf("unable to export multiple refs, missing platforms mapping")
 	}
 
+	if !opts.OCITypes && !opts.Annotations.IsEmpty() {
+		return nil, errors.Errorf("annotations are only supported with OCI media types")
+	}
+	if !opts.OCITypes && !opts.Attestations.IsEmpty() {
+		return nil, errors.Errorf("attestations are only supported with OCI media types")
+	}
+
 	if len(inp.Refs) == 0 {
-		remotes, err := ic.exportLayers(ctx, compressionType, forceCompression, session.NewGroup(sessionID), inp.Ref)
+		if len(opts.Annotations.Index) > 0 && opts.Attestations.IsEmpty() {
+			return nil, errors.Errorf("index annotations require a multi-platform image or attestations")
+		}
+		remotes, err := ic.exportLayers(ctx, opts.Compression, opts.Epoch, opts.Squash, session.NewGroup(sessionID), inp.Ref)
+		if err != nil {
+			return nil, err
+		}
+		mfstDesc, configDesc, err := ic.commitDistributionManifest(ctx, inp.Ref, inp.Metadata[exptypes.ExporterImageConfigKey], &remotes[0], opts.OCITypes, inp.Metadata[exptypes.ExporterInlineCache], opts.Annotations.Manifest, opts.ConfigPatch, opts.Epoch, opts.Squash)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Attestations.IsEmpty() {
+			if mfstDesc.Annotations == nil {
+				mfstDesc.Annotations = make(map[string]string)
+			}
+			mfstDesc.Annotations[exptypes.ExporterConfigDigestKey] = configDesc.Digest.String()
+			return mfstDesc, nil
+		}
+
+		// attestations are referenced from an index, so the single
+		// platform image is wrapped in one
+		p, err := imagePlatform(inp.Metadata[exptypes.ExporterImageConfigKey])
+		if err != nil {
+			return nil, err
+		}
+		mfstDesc.Platform = &p
+		attDesc, err := ic.commitAttestationManifest(ctx, inp.Ref, &remotes[0], *mfstDesc, opts.Attestations, inp.Metadata[exptypes.ExporterProvenanceKey], sessionID)
 		if err != nil {
 			return nil, err
 		}
-		mfstDesc, configDesc, err := ic.commitDistributionManifest(ctx, inp.Ref, inp.Metadata[exptypes.ExporterImageConfigKey], &remotes[0], oci, inp.Metadata[exptypes.ExporterInlineCache])
+		idxDesc, err := ic.commitIndex(ctx, []ocispecs.Descriptor{*mfstDesc, *attDesc}, opts.OCITypes, opts.Annotations.Index)
 		if err != nil {
 			return nil, err
 		}
-		if mfstDesc.Annotations == nil {
-			mfstDesc.Annotations = make(map[string]string)
+		idxDesc.Annotations = map[string]string{
+			exptypes.ExporterConfigDigestKey: configDesc.Digest.String(),
 		}
-		mfstDesc.Annotations[exptypes.ExporterConfigDigestKey] = configDesc.Digest.String()
-		return mfstDesc, nil
+		return idxDesc, nil
 	}
 
 	var p exptypes.Platforms
@@ -80,18 +135,56 @@ func (ic *ImageWriter) Commit(ctx context.Context, inp exporter.Source, oci bool
 		return nil, errors.Errorf("number of platforms does not match references %d %d", len(p.Platforms), len(inp.Refs))
 	}
 
+	// refs are in platform order so that the deduplicated layers are chosen
+	// deterministically
 	refs := make([]cache.ImmutableRef, 0, len(inp.Refs))
 	remotesMap := make(map[string]int, len(inp.Refs))
-	for id, r := range inp.Refs {
-		remotesMap[id] = len(refs)
+	for _, p := range p.Platforms {
+		r, ok := inp.Refs[p.ID]
+		if !ok {
+			return nil, errors.Errorf("failed to find ref for ID %s", p.ID)
+		}
+		remotesMap[p.ID] = len(refs)
 		refs = append(refs, r)
 	}
 
-	remotes, err := ic.exportLayers(ctx, compressionType, forceCompression, session.NewGroup(sessionID), refs...)
+	remotes, err := ic.exportLayers(ctx, opts.Compression, opts.Epoch, opts.Squash, session.NewGroup(sessionID), refs...)
 	if err != nil {
 		return nil, err
 	}
+	dedupeLayers(remotes)
+
+	var manifests []ocispecs.Descriptor
+	for _, p := range p.Platforms {
+		r, ok := inp.Refs[p.ID]
+		if !ok {
+			return nil, errors.Errorf("failed to find ref for ID %s", p.ID)
+		}
+		config := inp.Metadata[fmt.Sprintf("%s/%s", exptypes.ExporterImageConfigKey, p.ID)]
+
+		desc, _, err := ic.commitDistributionManifest(ctx, r, config, &remotes[remotesMap[p.ID]], opts.OCITypes, inp.Metadata[fmt.Sprintf("%s/%s", exptypes.ExporterInlineCache, p.ID)], opts.Annotations.Manifest, opts.ConfigPatch, opts.Epoch, opts.Squash)
+		if err != nil {
+			return nil, err
+		}
+		dp := p.Platform
+		desc.Platform = &dp
+		manifests = append(manifests, *desc)
+	}
 
+	if !opts.Attestations.IsEmpty() {
+		for i, p := range p.Platforms {
+			attDesc, err := ic.commitAttestationManifest(ctx, inp.Refs[p.ID], &remotes[remotesMap[p.ID]], manifests[i], opts.Attestations, inp.Metadata[exptypes.ExporterProvenanceKey], sessionID)
+			if err != nil {
+				return nil, err
+			}
+			manifests = append(manifests, *attDesc)
+		}
+	}
+
+	return ic.commitIndex(ctx, manifests, opts.OCITypes, opts.Annotations.Index)
+}
+
+func (ic *ImageWriter) commitIndex(ctx context.Context, manifests []ocispecs.Descriptor, oci bool, annotations map[string]string) (*ocispecs.Descriptor, error) {
 	idx := struct {
 		// MediaType is reserved in the OCI spec but
 		// excluded from go types.
@@ -104,6 +197,8 @@ func (ic *ImageWriter) Commit(ctx context.Context, inp exporter.Source, oci bool
 			Versioned: specs.Versioned{
 				SchemaVersion: 2,
 			},
+			Manifests:   manifests,
+			Annotations: annotations,
 		},
 	}
 
@@ -112,22 +207,7 @@ func (ic *ImageWriter) Commit(ctx context.Context, inp exporter.Source, oci bool
 	}
 
 	labels := map[string]string{}
-
-	for i, p := range p.Platforms {
-		r, ok := inp.Refs[p.ID]
-		if !ok {
-			return nil, errors.Errorf("failed to find ref for ID %s", p.ID)
-		}
-		config := inp.Metadata[fmt.Sprintf("%s/%s", exptypes.ExporterImageConfigKey, p.ID)]
-
-		desc, _, err := ic.commitDistributionManifest(ctx, r, config, &remotes[remotesMap[p.ID]], oci, inp.Metadata[fmt.Sprintf("%s/%s", exptypes.ExporterInlineCache, p.ID)])
-		if err != nil {
-			return nil, err
-		}
-		dp := p.Platform
-		desc.Platform = &dp
-		idx.Manifests = append(idx.Manifests, *desc)
-
+	for i, desc := range manifests {
 		labels[fmt.Sprintf("containerd.io/gc.ref.content.%d", i)] = desc.Digest.String()
 	}
 
@@ -152,10 +232,11 @@ func (ic *ImageWriter) Commit(ctx context.Context, inp exporter.Source, oci bool
 	return &idxDesc, nil
 }
 
-func (ic *ImageWriter) exportLayers(ctx context.Context, compressionType compression.Type, forceCompression bool, s session.Group, refs ...cache.ImmutableRef) ([]solver.Remote, error) {
+func (ic *ImageWriter) exportLayers(ctx context.Context, comp compression.Config, epoch *time.Time, squash bool, s session.Group, refs ...cache.ImmutableRef) ([]solver.Remote, error) {
 	span, ctx := tracing.StartSpan(ctx, "export layers", trace.WithAttributes(
-		attribute.String("exportLayers.compressionType", compressionType.String()),
-		attribute.Bool("exportLayers.forceCompression", forceCompression),
+		attribute.String("exportLayers.compressionType", comp.Type.String()),
+		attribute.Bool("exportLayers.forceCompression", comp.Force),
+		attribute.Bool("exportLayers.squash", squash),
 	))
 
 	eg, ctx := errgroup.WithContext(ctx)
@@ -169,10 +250,24 @@ func (ic *ImageWriter) exportLayers(ctx context.Context, compressionType compres
 				return
 			}
 			eg.Go(func() error {
-				remote, err := ref.GetRemote(ctx, true, compressionType, forceCompression, s)
+				var (
+					remote *solver.Remote
+					err    error
+				)
+				if squash {
+					remote, err = ic.squashRemote(ctx, ref, comp, s)
+				} else {
+					remote, err = ref.GetRemote(ctx, true, comp, s)
+				}
 				if err != nil {
 					return err
 				}
+				if epoch != nil {
+					remote, err = ic.rewriteRemoteWithEpoch(ctx, remote, *epoch)
+					if err != nil {
+						return err
+					}
+				}
 				out[i] = *remote
 				return nil
 			})
@@ -184,7 +279,86 @@ func (ic *ImageWriter) exportLayers(ctx context.Context, compressionType compres
 	return out, err
 }
 
-func (ic *ImageWriter) commitDistributionManifest(ctx context.Context, ref cache.ImmutableRef, config []byte, remote *solver.Remote, oci bool, inlineCache []byte) (*ocispecs.Descriptor, *ocispecs.Descriptor, error) {
+// squashRemote returns a remote with a single layer containing the complete
+// filesystem of ref. The layers of ref itself are left unchanged.
+func (ic *ImageWriter) squashRemote(ctx context.Context, ref cache.ImmutableRef, comp compression.Config, s session.Group) (*solver.Remote, error) {
+	desc, err := cache.SquashLayer(ctx, ref, comp, s)
+	if err != nil {
+		return nil, err
+	}
+	return &solver.Remote{
+		Descriptors: []ocispecs.Descriptor{*desc},
+		Provider:    ic.opt.ContentStore,
+	}, nil
+}
+
+// rewriteRemoteWithEpoch returns a remote with the file timestamps of the
+// layers clamped to epoch. The rewritten blobs are written to the content
+// store.
+func (ic *ImageWriter) rewriteRemoteWithEpoch(ctx context.Context, remote *solver.Remote, epoch time.Time) (*solver.Remote, error) {
+	// the layers are read from the content store
+	if unlazier, ok := remote.Provider.(cache.Unlazier); ok {
+		if err := unlazier.Unlazy(ctx); err != nil {
+			return nil, err
+		}
+	}
+	descs := make([]ocispecs.Descriptor, len(remote.Descriptors))
+	for i, desc := range remote.Descriptors {
+		if desc.Digest == exptypes.EmptyGZLayer || images.IsNonDistributable(desc.MediaType) {
+			descs[i] = desc
+			continue
+		}
+		newDesc, err := cache.RewriteLayerTimestamps(ctx, ic.opt.ContentStore, desc, epoch)
+		if err != nil {
+			return nil, err
+		}
+		descs[i] = *newDesc
+	}
+	return &solver.Remote{
+		Descriptors: descs,
+		Provider:    ic.opt.ContentStore,
+	}, nil
+}
+
+// dedupeLayers makes layers with the same diffID point to the same blob in
+// all remotes. Platforms sharing layer content, e.g. from a common stage, may
+// still have different blobs for it when the layers were pulled or compressed
+// separately. Only the first blob is then exported and pushed. Exporters
+// collect the providers of all platforms, so the providers of the remotes
+// aren't updated.
+func dedupeLayers(remotes []solver.Remote) {
+	blobs := map[string]ocispecs.Descriptor{}
+	for _, remote := range remotes {
+		for i, desc := range remote.Descriptors {
+			diffID, ok := desc.Annotations["containerd.io/uncompressed"]
+			if !ok {
+				continue
+			}
+			blob, ok := blobs[diffID]
+			if !ok {
+				blobs[diffID] = desc
+				continue
+			}
+			if blob.Digest == desc.Digest {
+				continue
+			}
+			annotations := make(map[string]string, len(blob.Annotations))
+			for k, v := range blob.Annotations {
+				annotations[k] = v
+			}
+			// keep the creation time used for the history of this platform
+			if v, ok := desc.Annotations["buildkit/createdat"]; ok {
+				annotations["buildkit/createdat"] = v
+			} else {
+				delete(annotations, "buildkit/createdat")
+			}
+			blob.Annotations = annotations
+			remote.Descriptors[i] = blob
+		}
+	}
+}
+
+func (ic *ImageWriter) commitDistributionManifest(ctx context.Context, ref cache.ImmutableRef, config []byte, remote *solver.Remote, oci bool, inlineCache []byte, annotations map[string]string, configPatch ConfigPatch, epoch *time.Time, squash bool) (*ocispecs.Descriptor, *ocispecs.Descriptor, error) {
 	if len(config) == 0 {
 		var err error
 		config, err = emptyImageConfig()
@@ -199,14 +373,26 @@ func (ic *ImageWriter) commitDistributionManifest(ctx context.Context, ref cache
 		}
 	}
 
+	config, err := configPatch.apply(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	history, err := parseHistoryFromConfig(config)
 	if err != nil {
 		return nil, nil, err
 	}
+	if squash {
+		history = squashHistory(history)
+	}
 
-	remote, history = normalizeLayersAndHistory(ctx, remote, history, ref, oci)
+	remote, history = normalizeLayersAndHistory(ctx, remote, history, ref, oci, epoch)
+	remote, history, err = ic.addNydusBootstrap(ctx, remote, history)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	config, err = patchImageConfig(config, remote.Descriptors, history, inlineCache)
+	config, err = patchImageConfig(config, remote.Descriptors, history, inlineCache, epoch)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -240,6 +426,7 @@ func (ic *ImageWriter) commitDistributionManifest(ctx context.Context, ref cache
 				Size:      int64(len(config)),
 				MediaType: configType,
 			},
+			Annotations: annotations,
 		},
 	}
 
@@ -248,18 +435,7 @@ func (ic *ImageWriter) commitDistributionManifest(ctx context.Context, ref cache
 	}
 
 	for i, desc := range remote.Descriptors {
-		// oci supports annotations but don't export internal annotations
-		if oci {
-			delete(desc.Annotations, "containerd.io/uncompressed")
-			delete(desc.Annotations, "buildkit/createdat")
-			for k := range desc.Annotations {
-				if strings.HasPrefix(k, "containerd.io/distribution.source.") {
-					delete(desc.Annotations, k)
-				}
-			}
-		} else {
-			desc.Annotations = nil
-		}
+		desc = exportedLayerDescriptor(desc, oci)
 		mfst.Layers = append(mfst.Layers, desc)
 		labels[fmt.Sprintf("containerd.io/gc.ref.content.%d", i+1)] = desc.Digest.String()
 	}
@@ -300,6 +476,61 @@ func (ic *ImageWriter) commitDistributionManifest(ctx context.Context, ref cache
 	}, &configDesc, nil
 }
 
+// ImageConfig returns the image config of ref for image stores that keep
+// layers by their diffIDs instead of blobs, e.g. the layer store of dockerd.
+// diffIDs are the uncompressed digests of the layers of ref, from the bottom.
+func ImageConfig(ctx context.Context, ref cache.ImmutableRef, config []byte, diffIDs []digest.Digest, configPatch ConfigPatch, epoch *time.Time) ([]byte, error) {
+	if len(config) == 0 {
+		var err error
+		config, err = emptyImageConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config, err := configPatch.apply(config)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := parseHistoryFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// no blobs are created, so the layers are only described by their diffIDs
+	remote := &solver.Remote{}
+	for _, diffID := range diffIDs {
+		remote.Descriptors = append(remote.Descriptors, ocispecs.Descriptor{
+			Digest: diffID,
+			Annotations: map[string]string{
+				"containerd.io/uncompressed": diffID.String(),
+			},
+		})
+	}
+	remote, history = normalizeLayersAndHistory(ctx, remote, history, ref, false, epoch)
+
+	return patchImageConfig(config, remote.Descriptors, history, nil, epoch)
+}
+
+// exportedLayerDescriptor removes the internal annotations from the layer
+// descriptor desc of a manifest
+func exportedLayerDescriptor(desc ocispecs.Descriptor, oci bool) ocispecs.Descriptor {
+	// oci supports annotations but don't export internal annotations
+	if oci {
+		delete(desc.Annotations, "containerd.io/uncompressed")
+		delete(desc.Annotations, "buildkit/createdat")
+		for k := range desc.Annotations {
+			if strings.HasPrefix(k, "containerd.io/distribution.source.") {
+				delete(desc.Annotations, k)
+			}
+		}
+	} else {
+		desc.Annotations = nil
+	}
+	return desc
+}
+
 func (ic *ImageWriter) ContentStore() content.Store {
 	return ic.opt.ContentStore
 }
@@ -346,7 +577,7 @@ func parseHistoryFromConfig(dt []byte) ([]ocispecs.History, error) {
 	return config.History, nil
 }
 
-func patchImageConfig(dt []byte, descs []ocispecs.Descriptor, history []ocispecs.History, cache []byte) ([]byte, error) {
+func patchImageConfig(dt []byte, descs []ocispecs.Descriptor, history []ocispecs.History, cache []byte, epoch *time.Time) ([]byte, error) {
 	m := map[string]json.RawMessage{}
 	if err := json.Unmarshal(dt, &m); err != nil {
 		return nil, errors.Wrap(err, "failed to parse image config for patch")
@@ -369,7 +600,13 @@ func patchImageConfig(dt []byte, descs []ocispecs.Descriptor, history []ocispecs
 	}
 	m["history"] = dt
 
-	if _, ok := m["created"]; !ok {
+	if epoch != nil {
+		dt, err = json.Marshal(epoch)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal creation time")
+		}
+		m["created"] = dt
+	} else if _, ok := m["created"]; !ok {
 		var tm *time.Time
 		for _, h := range history {
 			if h.Created != nil {
@@ -395,7 +632,56 @@ func patchImageConfig(dt []byte, descs []ocispecs.Descriptor, history []ocispecs
 	return dt, errors.Wrap(err, "failed to marshal config after patch")
 }
 
-func normalizeLayersAndHistory(ctx context.Context, remote *solver.Remote, history []ocispecs.History, ref cache.ImmutableRef, oci bool) (*solver.Remote, []ocispecs.History) {
+// squashHistory marks all history items as empty layers. The item for the
+// squashed layer is added from the ref metadata when the history is
+// normalized.
+func squashHistory(history []ocispecs.History) []ocispecs.History {
+	out := make([]ocispecs.History, len(history))
+	for i, h := range history {
+		h.EmptyLayer = true
+		out[i] = h
+	}
+	return out
+}
+
+// addNydusBootstrap adds the bootstrap layer of nydus images to remotes with
+// nydus blob layers
+func (ic *ImageWriter) addNydusBootstrap(ctx context.Context, remote *solver.Remote, history []ocispecs.History) (*solver.Remote, []ocispecs.History, error) {
+	var blobs []ocispecs.Descriptor
+	for _, desc := range remote.Descriptors {
+		if cache.IsNydusBlob(desc) {
+			blobs = append(blobs, desc)
+		}
+	}
+	if len(blobs) == 0 {
+		return remote, history, nil
+	}
+	if len(blobs) != len(remote.Descriptors) {
+		return nil, nil, errors.Errorf("nydus images can't have other layers than nydus blobs")
+	}
+	done := oneOffProgress(ctx, "merging nydus bootstrap")
+	desc, err := cache.MergeNydus(ctx, ic.opt.ContentStore, blobs)
+	if err := done(err); err != nil {
+		return nil, nil, err
+	}
+	provider := contentutil.NewMultiProvider(remote.Provider)
+	provider.Add(desc.Digest, ic.opt.ContentStore)
+	var created *time.Time
+	if len(history) > 0 {
+		created = history[len(history)-1].Created
+	}
+	history = append(history, ocispecs.History{
+		Created:   created,
+		CreatedBy: "nydus bootstrap",
+		Comment:   "buildkit.exporter.image.v0",
+	})
+	return &solver.Remote{
+		Descriptors: append(append([]ocispecs.Descriptor{}, remote.Descriptors...), *desc),
+		Provider:    provider,
+	}, history, nil
+}
+
+func normalizeLayersAndHistory(ctx context.Context, remote *solver.Remote, history []ocispecs.History, ref cache.ImmutableRef, oci bool, epoch *time.Time) (*solver.Remote, []ocispecs.History) {
 	refMeta := getRefMetadata(ref, len(remote.Descriptors))
 
 	var historyLayers int
@@ -478,6 +764,9 @@ func normalizeLayersAndHistory(ctx context.Context, remote *solver.Remote, histo
 			noCreatedTime = true
 			h.Created = created
 		}
+		if epoch != nil && h.Created != nil && h.Created.After(*epoch) {
+			h.Created = epoch
+		}
 		history[i] = h
 	}
 
@@ -0,0 +1,114 @@
+package containerimage
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/util/compression"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupeLayers(t *testing.T) {
+	layer := func(dgst, diffID, createdAt string) ocispecs.Descriptor {
+		desc := ocispecs.Descriptor{
+			MediaType: ocispecs.MediaTypeImageLayerGzip,
+			Digest:    digest.Digest("sha256:" + dgst),
+			Annotations: map[string]string{
+				"containerd.io/uncompressed": "sha256:" + diffID,
+			},
+		}
+		if createdAt != "" {
+			desc.Annotations["buildkit/createdat"] = createdAt
+		}
+		return desc
+	}
+
+	remotes := []solver.Remote{
+		{Descriptors: []ocispecs.Descriptor{layer("a1", "base", "t1"), layer("a2", "amd64", "")}},
+		{Descriptors: []ocispecs.Descriptor{layer("b1", "base", "t2"), layer("b2", "arm64", "t3")}},
+		{Descriptors: []ocispecs.Descriptor{layer("a1", "base", ""), {Digest: "sha256:c2"}}},
+	}
+	dedupeLayers(remotes)
+
+	require.Equal(t, "sha256:a1", string(remotes[0].Descriptors[0].Digest))
+	require.Equal(t, "sha256:a2", string(remotes[0].Descriptors[1].Digest))
+
+	require.Equal(t, "sha256:a1", string(remotes[1].Descriptors[0].Digest))
+	require.Equal(t, "t2", remotes[1].Descriptors[0].Annotations["buildkit/createdat"])
+	require.Equal(t, "t1", remotes[0].Descriptors[0].Annotations["buildkit/createdat"])
+	require.Equal(t, "sha256:b2", string(remotes[1].Descriptors[1].Digest))
+
+	require.Equal(t, "sha256:a1", string(remotes[2].Descriptors[0].Digest))
+	_, ok := remotes[2].Descriptors[0].Annotations["buildkit/createdat"]
+	require.False(t, ok)
+	require.Equal(t, "sha256:c2", string(remotes[2].Descriptors[1].Digest))
+}
+
+func TestSquashHistory(t *testing.T) {
+	history := []ocispecs.History{
+		{CreatedBy: "base"},
+		{CreatedBy: "ENV foo=bar", EmptyLayer: true},
+		{CreatedBy: "RUN make"},
+	}
+	remote := &solver.Remote{
+		Descriptors: []ocispecs.Descriptor{{
+			MediaType: ocispecs.MediaTypeImageLayerGzip,
+			Digest:    digest.Digest("sha256:squashed"),
+		}},
+	}
+
+	remote, out := normalizeLayersAndHistory(context.TODO(), remote, squashHistory(history), nil, true, nil)
+	require.Equal(t, 1, len(remote.Descriptors))
+	require.Equal(t, 4, len(out))
+	for i, h := range history {
+		require.Equal(t, h.CreatedBy, out[i].CreatedBy)
+		require.True(t, out[i].EmptyLayer)
+	}
+	require.False(t, out[3].EmptyLayer)
+	require.False(t, history[0].EmptyLayer)
+}
+
+func TestImageConfig(t *testing.T) {
+	diffIDs := []digest.Digest{"sha256:base", "sha256:app"}
+	config := []byte(`{"architecture":"amd64","os":"linux","history":[{"created_by":"base"},{"created_by":"ENV foo=bar","empty_layer":true}]}`)
+
+	dt, err := ImageConfig(context.TODO(), nil, config, diffIDs, ConfigPatch{}, nil)
+	require.NoError(t, err)
+
+	var img ocispecs.Image
+	require.NoError(t, json.Unmarshal(dt, &img))
+	require.Equal(t, "amd64", img.Architecture)
+	require.Equal(t, diffIDs, img.RootFS.DiffIDs)
+	require.Equal(t, 3, len(img.History))
+	require.Equal(t, "base", img.History[0].CreatedBy)
+	require.True(t, img.History[1].EmptyLayer)
+	require.False(t, img.History[2].EmptyLayer)
+	require.NotNil(t, img.Created)
+}
+
+func TestAddNydusBootstrap(t *testing.T) {
+	ic := &ImageWriter{}
+	gzipLayer := ocispecs.Descriptor{MediaType: ocispecs.MediaTypeImageLayerGzip, Digest: digest.FromString("gzip")}
+	nydusLayer := ocispecs.Descriptor{
+		MediaType:   compression.MediaTypeNydusBlob,
+		Digest:      digest.FromString("nydus"),
+		Annotations: map[string]string{"containerd.io/snapshot/nydus-blob": "true"},
+	}
+
+	// images without nydus blobs have no bootstrap
+	remote := &solver.Remote{Descriptors: []ocispecs.Descriptor{gzipLayer}}
+	history := []ocispecs.History{{CreatedBy: "layer"}}
+	r, h, err := ic.addNydusBootstrap(context.TODO(), remote, history)
+	require.NoError(t, err)
+	require.Equal(t, remote, r)
+	require.Equal(t, history, h)
+
+	// the bootstrap can't describe layers that aren't nydus blobs
+	remote = &solver.Remote{Descriptors: []ocispecs.Descriptor{gzipLayer, nydusLayer}}
+	_, _, err = ic.addNydusBootstrap(context.TODO(), remote, history)
+	require.Error(t, err)
+}
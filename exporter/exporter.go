@@ -15,6 +15,26 @@ type ExporterInstance interface {
 	Export(ctx context.Context, src Source, sessionID string) (map[string]string, error)
 }
 
+// Option describes an attribute accepted by an exporter, for clients that
+// adapt to the exporters of a daemon
+type Option struct {
+	// Key is the attribute key. Keys of prefix attributes contain a
+	// placeholder, e.g. "annotation.<key>".
+	Key string
+	// Type is the type of the value: "bool", "int" or "string"
+	Type string
+	// Values are the allowed values, if limited
+	Values []string
+	// Description is a short description of the attribute
+	Description string
+}
+
+// Describer is implemented by exporters that describe the attributes they
+// accept
+type Describer interface {
+	Options() []Option
+}
+
 type Source struct {
 	Ref      cache.ImmutableRef
 	Refs     map[string]cache.ImmutableRef
@@ -4,9 +4,11 @@ import (
 	"context"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	ctdcompression "github.com/containerd/containerd/archive/compression"
 	"github.com/docker/docker/pkg/idtools"
 	"github.com/moby/buildkit/cache"
 	"github.com/moby/buildkit/exporter"
@@ -14,12 +16,29 @@ import (
 	"github.com/moby/buildkit/session/filesync"
 	"github.com/moby/buildkit/snapshot"
 	"github.com/moby/buildkit/util/progress"
+	"github.com/moby/buildkit/util/progress/logs"
+	"github.com/pkg/errors"
 	"github.com/tonistiigi/fsutil"
 	fstypes "github.com/tonistiigi/fsutil/types"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/time/rate"
 )
 
+const (
+	keyPreserveOwnership = "preserve-ownership"
+	keyPreserveXattrs    = "preserve-xattrs"
+	keyMode              = "mode"
+	keyTarCompression    = "tar-compression"
+	keyVerboseProgress   = "verbose-progress"
+
+	modeFiles = "files"
+	modeTar   = "tar"
+
+	tarCompressionUncompressed = "uncompressed"
+	tarCompressionGzip         = "gzip"
+	tarCompressionZstd         = "zstd"
+)
+
 type Opt struct {
 	SessionManager *session.Manager
 }
@@ -35,11 +54,85 @@ func New(opt Opt) (exporter.Exporter, error) {
 }
 
 func (e *localExporter) Resolve(ctx context.Context, opt map[string]string) (exporter.ExporterInstance, error) {
-	return &localExporterInstance{localExporter: e}, nil
+	li := &localExporterInstance{
+		localExporter:  e,
+		preserveXattrs: true,
+		mode:           modeFiles,
+	}
+	for k, v := range opt {
+		switch k {
+		case keyPreserveOwnership:
+			if v == "" {
+				li.preserveOwnership = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			li.preserveOwnership = b
+		case keyPreserveXattrs:
+			if v == "" {
+				li.preserveXattrs = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			li.preserveXattrs = b
+		case keyMode:
+			switch v {
+			case "", modeFiles:
+				li.mode = modeFiles
+			case modeTar:
+				li.mode = modeTar
+			default:
+				return nil, errors.Errorf("invalid value %q for %s, expected %s or %s", v, k, modeFiles, modeTar)
+			}
+		case keyVerboseProgress:
+			if v == "" {
+				li.verboseProgress = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			li.verboseProgress = b
+		case keyTarCompression:
+			switch v {
+			case "", tarCompressionUncompressed:
+				li.tarCompression = ctdcompression.Uncompressed
+			case tarCompressionGzip:
+				li.tarCompression = ctdcompression.Gzip
+			case tarCompressionZstd:
+				li.tarCompression = ctdcompression.Zstd
+			default:
+				return nil, errors.Errorf("invalid value %q for %s, expected %s, %s or %s", v, k, tarCompressionUncompressed, tarCompressionGzip, tarCompressionZstd)
+			}
+		}
+	}
+	return li, nil
+}
+
+func (e *localExporter) Options() []exporter.Option {
+	return []exporter.Option{
+		{Key: keyPreserveOwnership, Type: "bool", Description: "keep the uid/gid of the files instead of chowning them to the client user"},
+		{Key: keyPreserveXattrs, Type: "bool", Description: "keep the extended attributes of the files"},
+		{Key: keyMode, Type: "string", Description: "write the files to the destination or a tarball of them", Values: []string{modeFiles, modeTar}},
+		{Key: keyTarCompression, Type: "string", Description: "compression of the tarball", Values: []string{tarCompressionUncompressed, tarCompressionGzip, tarCompressionZstd}},
+		{Key: keyVerboseProgress, Type: "bool", Description: "log the path and size of every exported file"},
+	}
 }
 
 type localExporterInstance struct {
 	*localExporter
+	preserveOwnership bool
+	preserveXattrs    bool
+	mode              string
+	tarCompression    ctdcompression.Compression
+	verboseProgress   bool
 }
 
 func (e *localExporterInstance) Name() string {
@@ -47,6 +140,9 @@ func (e *localExporterInstance) Name() string {
 }
 
 func (e *localExporterInstance) Export(ctx context.Context, inp exporter.Source, sessionID string) (map[string]string, error) {
+	if e.mode != modeTar && e.tarCompression != ctdcompression.Uncompressed {
+		return nil, errors.Errorf("%s requires %s=%s", keyTarCompression, keyMode, modeTar)
+	}
 
 	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
@@ -56,58 +152,37 @@ func (e *localExporterInstance) Export(ctx context.Context, inp exporter.Source,
 		return nil, err
 	}
 
+	if e.mode == modeTar {
+		return nil, e.exportTar(ctx, inp, sessionID, caller)
+	}
+
 	isMap := len(inp.Refs) > 0
 
+	var md map[string]string
+	if e.preserveOwnership {
+		md = map[string]string{filesync.KeyPreserveOwnership: "true"}
+	}
+
 	export := func(ctx context.Context, k string, ref cache.ImmutableRef) func() error {
 		return func() error {
-			var src string
-			var err error
-			var idmap *idtools.IdentityMapping
-			if ref == nil {
-				src, err = ioutil.TempDir("", "buildkit")
-				if err != nil {
-					return err
-				}
-				defer os.RemoveAll(src)
-			} else {
-				mount, err := ref.Mount(ctx, true, session.NewGroup(sessionID))
-				if err != nil {
-					return err
-				}
-
-				lm := snapshot.LocalMounter(mount)
-
-				src, err = lm.Mount()
-				if err != nil {
-					return err
-				}
-
-				idmap = mount.IdentityMapping()
-
-				defer lm.Unmount()
+			lbl := "copying files"
+			if isMap {
+				lbl += " " + k
 			}
 
-			walkOpt := &fsutil.WalkOpt{}
+			var files *logs.FileLogger
+			if e.verboseProgress {
+				files = logs.NewFileLogger(ctx, lbl+":")
+				defer files.Close()
+			}
 
-			if idmap != nil {
-				walkOpt.Map = func(p string, st *fstypes.Stat) bool {
-					uid, gid, err := idmap.ToContainer(idtools.Identity{
-						UID: int(st.Uid),
-						GID: int(st.Gid),
-					})
-					if err != nil {
-						return false
-					}
-					st.Uid = uint32(uid)
-					st.Gid = uint32(gid)
-					return true
-				}
+			fs, release, err := e.getFS(ctx, ref, sessionID, files)
+			if err != nil {
+				return err
 			}
+			defer release()
 
-			fs := fsutil.NewFS(src, walkOpt)
-			lbl := "copying files"
 			if isMap {
-				lbl += " " + k
 				fs, err = fsutil.SubDirFS([]fsutil.Dir{{FS: fs, Stat: fstypes.Stat{
 					Mode: uint32(os.ModeDir | 0755),
 					Path: strings.Replace(k, "/", "_", -1),
@@ -118,7 +193,7 @@ func (e *localExporterInstance) Export(ctx context.Context, inp exporter.Source,
 			}
 
 			progress := newProgressHandler(ctx, lbl)
-			if err := filesync.CopyToCaller(ctx, fs, caller, progress); err != nil {
+			if err := filesync.CopyToCaller(ctx, fs, md, caller, progress); err != nil {
 				return err
 			}
 			return nil
@@ -141,6 +216,155 @@ func (e *localExporterInstance) Export(ctx context.Context, inp exporter.Source,
 	return nil, nil
 }
 
+// exportTar sends a single tarball of all the refs of inp to the client
+func (e *localExporterInstance) exportTar(ctx context.Context, inp exporter.Source, sessionID string, caller session.Caller) error {
+	var files *logs.FileLogger
+	if e.verboseProgress {
+		files = logs.NewFileLogger(ctx, "sending tarball:")
+		defer files.Close()
+	}
+
+	var fs fsutil.FS
+	if len(inp.Refs) > 0 {
+		dirs := make([]fsutil.Dir, 0, len(inp.Refs))
+		for k, ref := range inp.Refs {
+			d, release, err := e.getFS(ctx, ref, sessionID, files)
+			if err != nil {
+				return err
+			}
+			defer release()
+			dirs = append(dirs, fsutil.Dir{FS: d, Stat: fstypes.Stat{
+				Mode: uint32(os.ModeDir | 0755),
+				Path: strings.Replace(k, "/", "_", -1),
+			}})
+		}
+		var err error
+		fs, err = fsutil.SubDirFS(dirs)
+		if err != nil {
+			return err
+		}
+	} else {
+		d, release, err := e.getFS(ctx, inp.Ref, sessionID, files)
+		if err != nil {
+			return err
+		}
+		defer release()
+		fs = d
+	}
+
+	w, err := filesync.CopyFileWriter(ctx, map[string]string{filesync.KeyTarName: tarName(e.tarCompression)}, caller)
+	if err != nil {
+		return err
+	}
+	report := oneOffProgress(ctx, "sending tarball")
+	zw, err := ctdcompression.CompressStream(w, e.tarCompression)
+	if err != nil {
+		w.Close()
+		return report(errors.WithStack(err))
+	}
+	if err := fsutil.WriteTar(ctx, fs, zw); err != nil {
+		zw.Close()
+		w.Close()
+		return report(err)
+	}
+	if err := zw.Close(); err != nil {
+		w.Close()
+		return report(errors.WithStack(err))
+	}
+	return report(w.Close())
+}
+
+// getFS returns the files of ref as they are sent to the client. The returned
+// function releases the mount of ref. The sent files are logged to files if
+// it isn't nil.
+func (e *localExporterInstance) getFS(ctx context.Context, ref cache.ImmutableRef, sessionID string, files *logs.FileLogger) (fsutil.FS, func(), error) {
+	var src string
+	var err error
+	var idmap *idtools.IdentityMapping
+	release := func() {}
+	if ref == nil {
+		src, err = ioutil.TempDir("", "buildkit")
+		if err != nil {
+			return nil, nil, err
+		}
+		release = func() { os.RemoveAll(src) }
+	} else {
+		mount, err := ref.Mount(ctx, true, session.NewGroup(sessionID))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		lm := snapshot.LocalMounter(mount)
+
+		src, err = lm.Mount()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		idmap = mount.IdentityMapping()
+
+		release = func() { lm.Unmount() }
+	}
+
+	walkOpt := &fsutil.WalkOpt{}
+
+	if idmap != nil || !e.preserveXattrs || (e.mode == modeTar && !e.preserveOwnership) || files != nil {
+		walkOpt.Map = func(p string, st *fstypes.Stat) bool {
+			if files != nil && os.FileMode(st.Mode).IsRegular() {
+				files.Add(p, st.Size_)
+			}
+			if e.mode == modeTar && !e.preserveOwnership {
+				st.Uid = 0
+				st.Gid = 0
+			} else if idmap != nil {
+				uid, gid, err := idmap.ToContainer(idtools.Identity{
+					UID: int(st.Uid),
+					GID: int(st.Gid),
+				})
+				if err != nil {
+					return false
+				}
+				st.Uid = uint32(uid)
+				st.Gid = uint32(gid)
+			}
+			if !e.preserveXattrs {
+				st.Xattrs = nil
+			}
+			return true
+		}
+	}
+
+	return fsutil.NewFS(src, walkOpt), release, nil
+}
+
+func tarName(c ctdcompression.Compression) string {
+	switch c {
+	case ctdcompression.Gzip:
+		return "out.tar.gz"
+	case ctdcompression.Zstd:
+		return "out.tar.zst"
+	default:
+		return "out.tar"
+	}
+}
+
+func oneOffProgress(ctx context.Context, id string) func(err error) error {
+	pw, _, _ := progress.NewFromContext(ctx)
+	now := time.Now()
+	st := progress.Status{
+		Started: &now,
+	}
+	pw.Write(id, st)
+	return func(err error) error {
+		// TODO: set error on status
+		now := time.Now()
+		st.Completed = &now
+		pw.Write(id, st)
+		pw.Close()
+		return err
+	}
+}
+
 func newProgressHandler(ctx context.Context, id string) func(int, bool) {
 	limiter := rate.NewLimiter(rate.Every(100*time.Millisecond), 1)
 	pw, _, _ := progress.NewFromContext(ctx)
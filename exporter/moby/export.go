@@ -0,0 +1,174 @@
+// Package moby exports images directly into the image and layer stores of
+// dockerd when buildkit is embedded in it without the containerd image
+// store. The layers are registered from the snapshots of the result, so no
+// blobs are compressed and no tarball has to be loaded with `docker load`.
+package moby
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/containerimage"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/session"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyImageName = "name"
+	keyPlatform  = "platform"
+)
+
+// LayerStore is the layer store of the daemon embedding buildkit
+type LayerStore interface {
+	// EnsureLayer registers the snapshot with the key and its parents in the
+	// layer store and returns the diffIDs of the layers, from the bottom
+	EnsureLayer(ctx context.Context, key string) ([]digest.Digest, error)
+}
+
+// ImageStore is the image store of the daemon embedding buildkit
+type ImageStore interface {
+	// Create stores the image config and returns the ID of the image
+	Create(ctx context.Context, config []byte) (digest.Digest, error)
+	// Tag points the reference name to the image
+	Tag(ctx context.Context, name string, id digest.Digest) error
+}
+
+type Opt struct {
+	LayerStore LayerStore
+	ImageStore ImageStore
+	// Platform is the platform of the daemon that is exported from
+	// multi-platform results by default
+	Platform ocispecs.Platform
+}
+
+type mobyExporter struct {
+	opt Opt
+}
+
+func New(opt Opt) (exporter.Exporter, error) {
+	return &mobyExporter{opt: opt}, nil
+}
+
+func (e *mobyExporter) Options() []exporter.Option {
+	return []exporter.Option{
+		{Key: keyImageName, Type: "string", Description: "comma separated image names"},
+		{Key: keyPlatform, Type: "string", Description: "platform of a multi-platform result to export, defaults to the platform of the daemon"},
+		{Key: exptypes.OptKeySourceDateEpoch, Type: "int", Description: "clamp timestamps of the image config to the Unix time"},
+	}
+}
+
+func (e *mobyExporter) Resolve(ctx context.Context, opt map[string]string) (exporter.ExporterInstance, error) {
+	i := &mobyExporterInstance{mobyExporter: e}
+
+	configPatch, opt, err := containerimage.ParseConfigPatch(opt)
+	if err != nil {
+		return nil, err
+	}
+	i.configPatch = configPatch
+
+	for k, v := range opt {
+		switch k {
+		case keyImageName:
+			for _, name := range strings.Split(v, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					i.names = append(i.names, name)
+				}
+			}
+		case keyPlatform:
+			p, err := platforms.Parse(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid platform %q for %s", v, keyPlatform)
+			}
+			p = platforms.Normalize(p)
+			i.platform = &p
+		case exptypes.OptKeySourceDateEpoch:
+			epoch, err := containerimage.ParseSourceDateEpoch(v)
+			if err != nil {
+				return nil, err
+			}
+			i.epoch = epoch
+		default:
+			return nil, errors.Errorf("unknown moby exporter option %s", k)
+		}
+	}
+	return i, nil
+}
+
+type mobyExporterInstance struct {
+	*mobyExporter
+	names       []string
+	platform    *ocispecs.Platform
+	configPatch containerimage.ConfigPatch
+	epoch       *time.Time
+}
+
+func (e *mobyExporterInstance) Name() string {
+	return "exporting to docker image store"
+}
+
+func (e *mobyExporterInstance) Export(ctx context.Context, inp exporter.Source, sessionID string) (map[string]string, error) {
+	inp, err := e.selectPlatform(inp)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffIDs []digest.Digest
+	if inp.Ref != nil {
+		if err := inp.Ref.Extract(ctx, session.NewGroup(sessionID)); err != nil {
+			return nil, err
+		}
+		diffIDs, err = e.opt.LayerStore.EnsureLayer(ctx, inp.Ref.Info().SnapshotID)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to register layers")
+		}
+	}
+
+	config, err := containerimage.ImageConfig(ctx, inp.Ref, inp.Metadata[exptypes.ExporterImageConfigKey], diffIDs, e.configPatch, e.epoch)
+	if err != nil {
+		return nil, err
+	}
+	id, err := e.opt.ImageStore.Create(ctx, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create image")
+	}
+	for _, name := range e.names {
+		if err := e.opt.ImageStore.Tag(ctx, name, id); err != nil {
+			return nil, errors.Wrapf(err, "failed to tag image %s", name)
+		}
+	}
+
+	resp := map[string]string{
+		exptypes.ExporterImageConfigDigestKey: id.String(),
+	}
+	if len(e.names) > 0 {
+		resp["image.name"] = strings.Join(e.names, ",")
+	}
+	return resp, nil
+}
+
+// selectPlatform returns the single platform result of inp that is
+// exported. Multi-platform results are filtered to the platform attr or the
+// platform of the daemon. Single platform results are only checked against
+// an explicit platform attr, so that images for other platforms, e.g. with
+// emulation, can still be exported.
+func (e *mobyExporterInstance) selectPlatform(inp exporter.Source) (exporter.Source, error) {
+	p := e.platform
+	if p == nil {
+		if len(inp.Refs) == 0 {
+			return inp, nil
+		}
+		def := platforms.Normalize(e.opt.Platform)
+		p = &def
+	}
+	inp, err := containerimage.FilterPlatforms(inp, []ocispecs.Platform{*p})
+	if err != nil {
+		return inp, err
+	}
+	return containerimage.SinglePlatform(inp), nil
+}
@@ -0,0 +1,83 @@
+package moby
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportPlatform(t *testing.T) {
+	ctx := context.TODO()
+	is := &imageStore{images: map[digest.Digest][]byte{}, tags: map[string]digest.Digest{}}
+	e, err := New(Opt{
+		ImageStore: is,
+		Platform:   ocispecs.Platform{OS: "linux", Architecture: "amd64"},
+	})
+	require.NoError(t, err)
+
+	ps, err := json.Marshal(exptypes.Platforms{Platforms: []exptypes.Platform{
+		{ID: "linux/amd64", Platform: ocispecs.Platform{OS: "linux", Architecture: "amd64"}},
+		{ID: "linux/arm64", Platform: ocispecs.Platform{OS: "linux", Architecture: "arm64"}},
+	}})
+	require.NoError(t, err)
+	src := exporter.Source{
+		Refs: map[string]cache.ImmutableRef{"linux/amd64": nil, "linux/arm64": nil},
+		Metadata: map[string][]byte{
+			exptypes.ExporterPlatformsKey:                    ps,
+			exptypes.ExporterImageConfigKey + "/linux/amd64": []byte(`{"architecture":"amd64","os":"linux"}`),
+			exptypes.ExporterImageConfigKey + "/linux/arm64": []byte(`{"architecture":"arm64","os":"linux"}`),
+		},
+	}
+
+	export := func(attrs map[string]string) (ocispecs.Image, map[string]string) {
+		inst, err := e.Resolve(ctx, attrs)
+		require.NoError(t, err)
+		resp, err := inst.Export(ctx, src, "")
+		require.NoError(t, err)
+		var img ocispecs.Image
+		require.NoError(t, json.Unmarshal(is.images[digest.Digest(resp[exptypes.ExporterImageConfigDigestKey])], &img))
+		return img, resp
+	}
+
+	// the platform of the daemon is exported by default
+	img, resp := export(map[string]string{"name": "foo:latest,bar"})
+	require.Equal(t, "amd64", img.Architecture)
+	require.Equal(t, "layers", img.RootFS.Type)
+	require.Equal(t, resp[exptypes.ExporterImageConfigDigestKey], is.tags["foo:latest"].String())
+	require.Equal(t, resp[exptypes.ExporterImageConfigDigestKey], is.tags["bar"].String())
+	require.Equal(t, "foo:latest,bar", resp["image.name"])
+
+	img, _ = export(map[string]string{"platform": "linux/arm64"})
+	require.Equal(t, "arm64", img.Architecture)
+
+	inst, err := e.Resolve(ctx, map[string]string{"platform": "linux/s390x"})
+	require.NoError(t, err)
+	_, err = inst.Export(ctx, src, "")
+	require.Error(t, err)
+
+	_, err = e.Resolve(ctx, map[string]string{"push": "true"})
+	require.Error(t, err)
+}
+
+type imageStore struct {
+	images map[digest.Digest][]byte
+	tags   map[string]digest.Digest
+}
+
+func (is *imageStore) Create(ctx context.Context, config []byte) (digest.Digest, error) {
+	id := digest.FromBytes(config)
+	is.images[id] = config
+	return id, nil
+}
+
+func (is *imageStore) Tag(ctx context.Context, name string, id digest.Digest) error {
+	is.tags[name] = id
+	return nil
+}
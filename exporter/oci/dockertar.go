@@ -0,0 +1,148 @@
+package oci
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"io"
+	"path"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/docker/distribution/reference"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyFormat = "format"
+
+	formatOCI    = "oci"
+	formatDocker = "docker"
+)
+
+type dockerManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// writeDockerTar writes the image of the manifest desc to w in the layout of
+// `docker save`. The metadata is written first and the layers in the order
+// they are applied, so that the tarball can be consumed while it is streamed.
+func writeDockerTar(ctx context.Context, provider content.Provider, w io.Writer, desc ocispecs.Descriptor, names []string) error {
+	if !images.IsManifestType(desc.MediaType) {
+		return errors.Errorf("%s=%s requires a single-platform image without attestations", keyFormat, formatDocker)
+	}
+	dt, err := content.ReadBlob(ctx, provider, desc)
+	if err != nil {
+		return errors.Wrap(err, "failed to read image manifest")
+	}
+	var mfst ocispecs.Manifest
+	if err := json.Unmarshal(dt, &mfst); err != nil {
+		return errors.Wrap(err, "failed to parse image manifest")
+	}
+	config, err := content.ReadBlob(ctx, provider, mfst.Config)
+	if err != nil {
+		return errors.Wrap(err, "failed to read image config")
+	}
+
+	m := dockerManifest{
+		Config:   mfst.Config.Digest.Hex() + ".json",
+		RepoTags: []string{},
+	}
+	for _, l := range mfst.Layers {
+		m.Layers = append(m.Layers, path.Join(l.Digest.Hex(), "layer.tar"))
+	}
+	repos := map[string]map[string]string{}
+	for _, name := range names {
+		parsed, err := reference.ParseNormalizedNamed(name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse %s", name)
+		}
+		tagged, ok := parsed.(reference.NamedTagged)
+		if !ok {
+			continue
+		}
+		m.RepoTags = append(m.RepoTags, reference.FamiliarString(tagged))
+		if len(mfst.Layers) > 0 {
+			repo := reference.FamiliarName(tagged)
+			if repos[repo] == nil {
+				repos[repo] = map[string]string{}
+			}
+			repos[repo][tagged.Tag()] = mfst.Layers[len(mfst.Layers)-1].Digest.Hex()
+		}
+	}
+	mdt, err := json.Marshal([]dockerManifest{m})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tw := tar.NewWriter(w)
+	if err := writeTarFile(tw, "manifest.json", mdt); err != nil {
+		return err
+	}
+	if len(repos) > 0 {
+		rdt, err := json.Marshal(repos)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := writeTarFile(tw, "repositories", rdt); err != nil {
+			return err
+		}
+	}
+	if err := writeTarFile(tw, m.Config, config); err != nil {
+		return err
+	}
+	seen := map[string]struct{}{}
+	for i, l := range mfst.Layers {
+		if _, ok := seen[m.Layers[i]]; ok {
+			continue
+		}
+		seen[m.Layers[i]] = struct{}{}
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     path.Dir(m.Layers[i]) + "/",
+			Mode:     0755,
+			Typeflag: tar.TypeDir,
+		}); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := writeTarBlob(ctx, tw, provider, m.Layers[i], l); err != nil {
+			return err
+		}
+	}
+	return errors.WithStack(tw.Close())
+}
+
+func writeTarFile(tw *tar.Writer, name string, dt []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0444,
+		Size:     int64(len(dt)),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	_, err := tw.Write(dt)
+	return errors.WithStack(err)
+}
+
+func writeTarBlob(ctx context.Context, tw *tar.Writer, provider content.Provider, name string, desc ocispecs.Descriptor) error {
+	ra, err := provider.ReaderAt(ctx, desc)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read blob %s", desc.Digest)
+	}
+	defer ra.Close()
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0444,
+		Size:     desc.Size,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := io.Copy(tw, content.NewReader(ra)); err != nil {
+		return errors.Wrapf(err, "failed to copy blob %s", desc.Digest)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDockerTar(t *testing.T) {
+	ctx := context.TODO()
+	cs, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	write := func(mediaType string, dt []byte) ocispecs.Descriptor {
+		desc := ocispecs.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(dt), Size: int64(len(dt))}
+		require.NoError(t, content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(dt), desc))
+		return desc
+	}
+	config := write(ocispecs.MediaTypeImageConfig, []byte(`{"architecture":"amd64","os":"linux"}`))
+	base := write(ocispecs.MediaTypeImageLayerGzip, []byte("base"))
+	top := write(ocispecs.MediaTypeImageLayerGzip, []byte("top"))
+	dt, err := json.Marshal(ocispecs.Manifest{Config: config, Layers: []ocispecs.Descriptor{base, top}})
+	require.NoError(t, err)
+	mfst := write(ocispecs.MediaTypeImageManifest, dt)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeDockerTar(ctx, cs, buf, mfst, []string{"docker.io/library/foo:latest", "example.com/bar:v1"}))
+
+	var names []string
+	files := map[string][]byte{}
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+		if hdr.Typeflag == tar.TypeReg {
+			files[hdr.Name], err = ioutil.ReadAll(tr)
+			require.NoError(t, err)
+		}
+	}
+	// metadata first, then the layers from the bottom up
+	require.Equal(t, []string{
+		"manifest.json",
+		"repositories",
+		config.Digest.Hex() + ".json",
+		base.Digest.Hex() + "/",
+		base.Digest.Hex() + "/layer.tar",
+		top.Digest.Hex() + "/",
+		top.Digest.Hex() + "/layer.tar",
+	}, names)
+
+	var m []dockerManifest
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &m))
+	require.Equal(t, []dockerManifest{{
+		Config:   config.Digest.Hex() + ".json",
+		RepoTags: []string{"foo:latest", "example.com/bar:v1"},
+		Layers:   []string{base.Digest.Hex() + "/layer.tar", top.Digest.Hex() + "/layer.tar"},
+	}}, m)
+
+	var repos map[string]map[string]string
+	require.NoError(t, json.Unmarshal(files["repositories"], &repos))
+	require.Equal(t, map[string]map[string]string{
+		"foo":             {"latest": top.Digest.Hex()},
+		"example.com/bar": {"v1": top.Digest.Hex()},
+	}, repos)
+	require.Equal(t, []byte("top"), files[top.Digest.Hex()+"/layer.tar"])
+
+	idx := write(ocispecs.MediaTypeImageIndex, []byte(`{}`))
+	require.Error(t, writeDockerTar(ctx, cs, ioutil.Discard, idx, nil))
+}
@@ -1,7 +1,9 @@
 package oci
 
 import (
+	"compress/gzip"
 	"context"
+	"io"
 	"strconv"
 	"strings"
 	"time"
@@ -20,6 +22,7 @@ import (
 	"github.com/moby/buildkit/util/grpcerrors"
 	"github.com/moby/buildkit/util/leaseutil"
 	"github.com/moby/buildkit/util/progress"
+	digest "github.com/opencontainers/go-digest"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc/codes"
@@ -34,6 +37,17 @@ const (
 	VariantDocker       = "docker"
 	ociTypes            = "oci-mediatypes"
 	keyForceCompression = "force-compression"
+	keyCompressionLevel = "compression-level"
+	keyWasm             = "wasm"
+	keyWasmModule       = "wasm-module"
+	keyAttestSBOM       = "attest:sbom"
+	keyAttestProvenance = "attest:provenance"
+	keyAttestFiles      = "attest:file-manifest"
+	keyPlatforms        = "platforms"
+	keySquash           = "squash"
+	keySquashFrom       = "squash-from"
+	keyKeepBlobsFor     = "keep-blobs-for"
+	keyArtifactType     = "artifact-type"
 )
 
 type Opt struct {
@@ -56,31 +70,187 @@ func (e *imageExporter) Resolve(ctx context.Context, opt map[string]string) (exp
 	var ot *bool
 	i := &imageExporterInstance{
 		imageExporter:    e,
-		layerCompression: compression.Default,
+		layerCompression: compression.New(compression.Default),
+		tar:              true,
+		layout: layout{
+			attestationManifests: true,
+			nameAnnotations:      true,
+		},
 	}
+	annotations, opt, err := containerimage.ParseAnnotations(opt)
+	if err != nil {
+		return nil, err
+	}
+	i.annotations = annotations
+
+	configPatch, opt, err := containerimage.ParseConfigPatch(opt)
+	if err != nil {
+		return nil, err
+	}
+	i.configPatch = configPatch
+
+	sizeBudget, opt, err := containerimage.ParseSizeBudget(opt)
+	if err != nil {
+		return nil, err
+	}
+	i.sizeBudget = sizeBudget
+
 	for k, v := range opt {
 		switch k {
 		case keyImageName:
 			i.name = v
 		case keyLayerCompression:
+			c, err := compression.Parse(v)
+			if err != nil {
+				return nil, err
+			}
+			i.layerCompression.Type = c
+		case keyForceCompression:
+			if v == "" {
+				i.layerCompression.Force = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.layerCompression.Force = b
+		case keyCompressionLevel:
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-int value specified for %s", k)
+			}
+			i.layerCompression.Level = &n
+		case keyWasm:
+			if v == "" {
+				i.wasm = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.wasm = b
+		case exptypes.OptKeySourceDateEpoch:
+			epoch, err := containerimage.ParseSourceDateEpoch(v)
+			if err != nil {
+				return nil, err
+			}
+			i.epoch = epoch
+		case keySquash:
+			if v == "" {
+				i.squash = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.squash = b
+		case keySquashFrom:
+			// the exporter doesn't know the stages of the frontend
+			return nil, errors.Errorf("%s is not supported, use %s to squash all layers", keySquashFrom, keySquash)
+		case keyWasmModule:
+			i.wasmModule = v
+		case keyAttestSBOM:
+			if v == "" {
+				i.attest.SBOM = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.attest.SBOM = b
+		case keyPlatforms:
+			ps, err := containerimage.ParsePlatforms(v)
+			if err != nil {
+				return nil, err
+			}
+			i.platforms = ps
+		case keyArtifactType:
+			i.artifact.Type = v
+		case keyKeepBlobsFor:
+			d, err := containerimage.ParseKeepBlobsFor(v)
+			if err != nil {
+				return nil, err
+			}
+			i.keepBlobsFor = d
+		case keyAttestProvenance:
+			if v == "" {
+				i.attest.Provenance = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.attest.Provenance = b
+		case keyAttestFiles:
+			if v == "" {
+				i.attest.FileManifest = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.attest.FileManifest = b
+		case keyAttestationManifests:
+			if v == "" {
+				i.layout.attestationManifests = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.layout.attestationManifests = b
+		case keyNameAnnotations:
+			if v == "" {
+				i.layout.nameAnnotations = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.layout.nameAnnotations = b
+		case keyIndexMediaType:
 			switch v {
-			case "gzip":
-				i.layerCompression = compression.Gzip
-			case "uncompressed":
-				i.layerCompression = compression.Uncompressed
+			case indexMediaTypeOCI, indexMediaTypeDocker:
+				i.layout.indexMediaType = v
 			default:
-				return nil, errors.Errorf("unsupported layer compression type: %v", v)
+				return nil, errors.Errorf("invalid value %q for %s, expected %s or %s", v, k, indexMediaTypeOCI, indexMediaTypeDocker)
 			}
-		case keyForceCompression:
+		case keyFormat:
+			switch v {
+			case "", formatOCI:
+				i.format = formatOCI
+			case formatDocker:
+				i.format = formatDocker
+			default:
+				return nil, errors.Errorf("invalid value %q for %s, expected %s or %s", v, k, formatOCI, formatDocker)
+			}
+		case keyTarCompression:
+			switch v {
+			case "", tarCompressionUncompressed:
+				i.layout.gzip = false
+			case tarCompressionGzip:
+				i.layout.gzip = true
+			default:
+				return nil, errors.Errorf("invalid value %q for %s, expected %s or %s", v, k, tarCompressionUncompressed, tarCompressionGzip)
+			}
+		case keyTar:
 			if v == "" {
-				i.forceCompression = true
+				i.tar = true
 				continue
 			}
 			b, err := strconv.ParseBool(v)
 			if err != nil {
 				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
 			}
-			i.forceCompression = b
+			i.tar = b
 		case ociTypes:
 			ot = new(bool)
 			if v == "" {
@@ -100,7 +270,9 @@ func (e *imageExporter) Resolve(ctx context.Context, opt map[string]string) (exp
 		}
 	}
 	if ot == nil {
-		i.ociTypes = e.opt.Variant == VariantOCI
+		i.ociTypes = (e.opt.Variant == VariantOCI && i.format != formatDocker) || i.layerCompression.Type.OnlySupportOCITypes() || !i.annotations.IsEmpty() || !i.attest.IsEmpty() || !i.artifact.IsEmpty()
+	} else if !*ot && i.layerCompression.Type.OnlySupportOCITypes() {
+		return nil, errors.Errorf("%s compression requires %s", i.layerCompression.Type, ociTypes)
 	} else {
 		i.ociTypes = *ot
 	}
@@ -112,8 +284,21 @@ type imageExporterInstance struct {
 	meta             map[string][]byte
 	name             string
 	ociTypes         bool
-	layerCompression compression.Type
-	forceCompression bool
+	layerCompression compression.Config
+	annotations      containerimage.Annotations
+	configPatch      containerimage.ConfigPatch
+	epoch            *time.Time
+	squash           bool
+	wasm             bool
+	wasmModule       string
+	attest           containerimage.Attestations
+	platforms        []ocispecs.Platform
+	layout           layout
+	format           string
+	tar              bool
+	keepBlobsFor     time.Duration
+	artifact         containerimage.Artifact
+	sizeBudget       containerimage.SizeBudget
 }
 
 func (e *imageExporterInstance) Name() string {
@@ -121,9 +306,21 @@ func (e *imageExporterInstance) Name() string {
 }
 
 func (e *imageExporterInstance) Export(ctx context.Context, src exporter.Source, sessionID string) (map[string]string, error) {
+	src, err := containerimage.FilterPlatforms(src, e.platforms)
+	if err != nil {
+		return nil, err
+	}
+	if e.opt.Variant == VariantDocker || e.format == formatDocker {
+		// the docker format has no manifest lists, but a single platform
+		// can be selected from a multi-platform result
+		src = containerimage.SinglePlatform(src)
+	}
 	if e.opt.Variant == VariantDocker && len(src.Refs) > 0 {
 		return nil, errors.Errorf("docker exporter does not currently support exporting manifest lists")
 	}
+	if e.format == formatDocker && len(src.Refs) > 0 {
+		return nil, errors.Errorf("%s=%s does not support exporting manifest lists", keyFormat, formatDocker)
+	}
 
 	if src.Metadata == nil {
 		src.Metadata = make(map[string][]byte)
@@ -138,17 +335,87 @@ func (e *imageExporterInstance) Export(ctx context.Context, src exporter.Source,
 	}
 	defer done(context.TODO())
 
-	desc, err := e.opt.ImageWriter.Commit(ctx, src, e.ociTypes, e.layerCompression, e.forceCompression, sessionID)
+	if e.wasmModule != "" && !e.wasm {
+		return nil, errors.Errorf("%s requires %s=true", keyWasmModule, keyWasm)
+	}
+	if e.wasm && e.opt.Variant == VariantDocker {
+		return nil, errors.Errorf("docker exporter does not support wasm artifacts")
+	}
+	if e.wasm && !e.configPatch.IsEmpty() {
+		return nil, errors.Errorf("image config attrs are not supported for wasm artifacts")
+	}
+	if e.wasm && e.squash {
+		return nil, errors.Errorf("%s is not supported for wasm artifacts", keySquash)
+	}
+	if e.wasm && !e.attest.IsEmpty() {
+		return nil, errors.Errorf("attestations are not supported for wasm artifacts")
+	}
+	if err := e.artifact.Validate(e.ociTypes, e.wasm, e.attest, e.configPatch, e.squash); err != nil {
+		return nil, err
+	}
+	if !e.artifact.IsEmpty() && (e.opt.Variant == VariantDocker || e.format == formatDocker) {
+		return nil, errors.Errorf("the docker format does not support artifacts")
+	}
+	if !e.attest.IsEmpty() && e.opt.Variant == VariantDocker {
+		return nil, errors.Errorf("docker exporter does not support attestations")
+	}
+	if e.opt.Variant == VariantDocker && (e.layout.rewritesIndex() || !e.layout.nameAnnotations) {
+		return nil, errors.Errorf("docker exporter does not support %s, %s and %s", keyAttestationManifests, keyIndexMediaType, keyNameAnnotations)
+	}
+	if e.format == formatDocker {
+		if e.wasm {
+			return nil, errors.Errorf("%s=%s does not support wasm artifacts", keyFormat, formatDocker)
+		}
+		if !e.attest.IsEmpty() {
+			return nil, errors.Errorf("%s=%s does not support attestations", keyFormat, formatDocker)
+		}
+		if e.layout.rewritesIndex() || !e.layout.nameAnnotations {
+			return nil, errors.Errorf("%s=%s does not support %s, %s and %s", keyFormat, formatDocker, keyAttestationManifests, keyIndexMediaType, keyNameAnnotations)
+		}
+	}
+
+	if !e.tar {
+		if e.format == formatDocker {
+			return nil, errors.Errorf("%s=%s requires %s=true", keyFormat, formatDocker, keyTar)
+		}
+		if e.layout.gzip {
+			return nil, errors.Errorf("%s requires %s=true", keyTarCompression, keyTar)
+		}
+	}
+
+	var desc *ocispecs.Descriptor
+	switch {
+	case e.wasm:
+		desc, err = e.opt.ImageWriter.CommitWasm(ctx, src, e.wasmModule, sessionID)
+	case !e.artifact.IsEmpty():
+		desc, err = e.opt.ImageWriter.CommitArtifact(ctx, src, e.artifact, e.layerCompression, e.annotations.Manifest, e.epoch, sessionID)
+	default:
+		desc, err = e.opt.ImageWriter.Commit(ctx, src, sessionID, containerimage.CommitOpts{
+			OCITypes:     e.ociTypes,
+			Compression:  e.layerCompression,
+			Annotations:  e.annotations,
+			ConfigPatch:  e.configPatch,
+			Epoch:        e.epoch,
+			Squash:       e.squash,
+			Attestations: e.attest,
+		})
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		e.opt.ImageWriter.ContentStore().Delete(context.TODO(), desc.Digest)
-	}()
+	if e.keepBlobsFor == 0 {
+		defer func(dgst digest.Digest) {
+			e.opt.ImageWriter.ContentStore().Delete(context.TODO(), dgst)
+		}(desc.Digest)
+	}
 	if desc.Annotations == nil {
 		desc.Annotations = map[string]string{}
 	}
-	desc.Annotations[ocispecs.AnnotationCreated] = time.Now().UTC().Format(time.RFC3339)
+	created := time.Now().UTC()
+	if e.epoch != nil {
+		created = *e.epoch
+	}
+	desc.Annotations[ocispecs.AnnotationCreated] = created.Format(time.RFC3339)
 
 	resp := make(map[string]string)
 	resp[exptypes.ExporterImageDigestKey] = desc.Digest.String()
@@ -156,6 +423,30 @@ func (e *imageExporterInstance) Export(ctx context.Context, src exporter.Source,
 		resp[exptypes.ExporterImageConfigDigestKey] = v
 		delete(desc.Annotations, exptypes.ExporterConfigDigestKey)
 	}
+	sizes, err := e.sizeBudget.Check(ctx, e.opt.ImageWriter.ContentStore(), *desc)
+	if err != nil {
+		return nil, err
+	}
+	resp[exptypes.ExporterImageSizesKey] = sizes
+
+	var attestations []ocispecs.Descriptor
+	if e.layout.rewritesIndex() {
+		desc, attestations, err = e.layout.rewriteIndex(ctx, e.opt.ImageWriter.ContentStore(), *desc)
+		if err != nil {
+			return nil, err
+		}
+		if e.keepBlobsFor == 0 {
+			defer func(dgst digest.Digest) {
+				e.opt.ImageWriter.ContentStore().Delete(context.TODO(), dgst)
+			}(desc.Digest)
+		}
+		resp[exptypes.ExporterImageDigestKey] = desc.Digest.String()
+	}
+	if e.keepBlobsFor > 0 {
+		if err := containerimage.KeepBlobs(ctx, e.opt.LeaseManager, *desc, e.keepBlobsFor); err != nil {
+			return nil, err
+		}
+	}
 
 	if n, ok := src.Metadata["image.name"]; e.name == "*" && ok {
 		e.name = string(n)
@@ -170,7 +461,24 @@ func (e *imageExporterInstance) Export(ctx context.Context, src exporter.Source,
 		resp["image.name"] = strings.Join(names, ",")
 	}
 
-	expOpts := []archiveexporter.ExportOpt{archiveexporter.WithManifest(*desc, names...)}
+	var expOpts []archiveexporter.ExportOpt
+	if e.layout.nameAnnotations || len(names) == 0 {
+		expOpts = append(expOpts, archiveexporter.WithManifest(*desc, names...))
+	} else {
+		for _, name := range names {
+			mc := *desc
+			if mc.Annotations, err = refNameAnnotations(name, desc.Annotations); err != nil {
+				return nil, err
+			}
+			expOpts = append(expOpts, archiveexporter.WithManifest(mc))
+		}
+	}
+	for _, att := range attestations {
+		expOpts = append(expOpts, archiveexporter.WithManifest(att))
+	}
+	// Windows base layers are pulled from their URLs when the tarball is
+	// loaded
+	expOpts = append(expOpts, archiveexporter.WithSkipNonDistributableBlobs())
 	switch e.opt.Variant {
 	case VariantOCI:
 		expOpts = append(expOpts, archiveexporter.WithAllPlatforms(), archiveexporter.WithSkipDockerManifest())
@@ -187,20 +495,16 @@ func (e *imageExporterInstance) Export(ctx context.Context, src exporter.Source,
 		return nil, err
 	}
 
-	w, err := filesync.CopyFileWriter(ctx, resp, caller)
-	if err != nil {
-		return nil, err
-	}
-
 	mprovider := contentutil.NewMultiProvider(e.opt.ImageWriter.ContentStore())
-	if src.Ref != nil {
-		remote, err := src.Ref.GetRemote(ctx, false, e.layerCompression, e.forceCompression, session.NewGroup(sessionID))
+	if src.Ref != nil && !e.wasm {
+		remote, err := src.Ref.GetRemote(ctx, false, e.layerCompression, session.NewGroup(sessionID))
 		if err != nil {
 			return nil, err
 		}
 		// unlazy before tar export as the tar writer does not handle
-		// layer blobs in parallel (whereas unlazy does)
-		if unlazier, ok := remote.Provider.(cache.Unlazier); ok {
+		// layer blobs in parallel (whereas unlazy does). Lazy blobs that
+		// exist in a layout directory already are not pulled.
+		if unlazier, ok := remote.Provider.(cache.Unlazier); ok && e.tar {
 			if err := unlazier.Unlazy(ctx); err != nil {
 				return nil, err
 			}
@@ -211,11 +515,11 @@ func (e *imageExporterInstance) Export(ctx context.Context, src exporter.Source,
 	}
 	if len(src.Refs) > 0 {
 		for _, r := range src.Refs {
-			remote, err := r.GetRemote(ctx, false, e.layerCompression, e.forceCompression, session.NewGroup(sessionID))
+			remote, err := r.GetRemote(ctx, false, e.layerCompression, session.NewGroup(sessionID))
 			if err != nil {
 				return nil, err
 			}
-			if unlazier, ok := remote.Provider.(cache.Unlazier); ok {
+			if unlazier, ok := remote.Provider.(cache.Unlazier); ok && e.tar {
 				if err := unlazier.Unlazy(ctx); err != nil {
 					return nil, err
 				}
@@ -226,14 +530,45 @@ func (e *imageExporterInstance) Export(ctx context.Context, src exporter.Source,
 		}
 	}
 
+	if !e.tar {
+		if err := e.layout.writeLayoutDir(ctx, caller, mprovider, *desc, names, attestations, resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+
+	w, err := filesync.CopyFileWriter(ctx, resp, caller)
+	if err != nil {
+		return nil, err
+	}
+
+	var tw io.WriteCloser = w
+	if e.layout.gzip {
+		tw = gzip.NewWriter(w)
+	}
+
 	report := oneOffProgress(ctx, "sending tarball")
-	if err := archiveexporter.Export(ctx, mprovider, w, expOpts...); err != nil {
+	if e.format == formatDocker {
+		err = writeDockerTar(ctx, mprovider, tw, *desc, names)
+	} else {
+		err = archiveexporter.Export(ctx, mprovider, tw, expOpts...)
+	}
+	if err != nil {
 		w.Close()
 		if grpcerrors.Code(err) == codes.AlreadyExists {
 			return resp, report(nil)
 		}
 		return nil, report(err)
 	}
+	if e.layout.gzip {
+		if err := tw.Close(); err != nil {
+			w.Close()
+			if grpcerrors.Code(err) == codes.AlreadyExists {
+				return resp, report(nil)
+			}
+			return nil, report(err)
+		}
+	}
 	err = w.Close()
 	if grpcerrors.Code(err) == codes.AlreadyExists {
 		return resp, report(nil)
@@ -273,3 +608,26 @@ func normalizedNames(name string) ([]string, error) {
 	}
 	return tagNames, nil
 }
+
+func (e *imageExporter) Options() []exporter.Option {
+	opts := []exporter.Option{
+		{Key: keyImageName, Type: "string", Description: "comma separated image names"},
+	}
+	for _, o := range containerimage.CommonOptions {
+		if e.opt.Variant == VariantDocker && (o.Key == keyWasm || o.Key == keyWasmModule || o.Key == keyAttestSBOM || o.Key == keyAttestProvenance || o.Key == keyAttestFiles || o.Key == keyArtifactType) {
+			continue
+		}
+		opts = append(opts, o)
+	}
+	if e.opt.Variant == VariantOCI {
+		opts = append(opts,
+			exporter.Option{Key: keyAttestationManifests, Type: "bool", Description: "keep the attestation manifests in the image index instead of only listing them in index.json"},
+			exporter.Option{Key: keyIndexMediaType, Type: "string", Description: "media type of the image index", Values: []string{indexMediaTypeOCI, indexMediaTypeDocker}},
+			exporter.Option{Key: keyNameAnnotations, Type: "bool", Description: "add io.containerd.image.name annotations to index.json"},
+		)
+	}
+	opts = append(opts, exporter.Option{Key: keyFormat, Type: "string", Description: "layout of the tarball, docker streams the layout of docker save", Values: []string{formatOCI, formatDocker}})
+	opts = append(opts, exporter.Option{Key: keyTar, Type: "bool", Description: "export a tarball, with false the OCI layout is written to a directory of the client reusing its existing blobs"})
+	opts = append(opts, exporter.Option{Key: keyTarCompression, Type: "string", Description: "compression of the tarball", Values: []string{tarCompressionUncompressed, tarCompressionGzip}})
+	return opts
+}
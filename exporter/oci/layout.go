@@ -0,0 +1,156 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/docker/distribution/reference"
+	"github.com/moby/buildkit/exporter/attestation"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyAttestationManifests = "attestation-manifests"
+	keyIndexMediaType       = "index-mediatype"
+	keyNameAnnotations      = "name-annotations"
+	keyTarCompression       = "tar-compression"
+	keyTar                  = "tar"
+
+	indexMediaTypeOCI    = "oci"
+	indexMediaTypeDocker = "docker"
+
+	tarCompressionUncompressed = "uncompressed"
+	tarCompressionGzip         = "gzip"
+)
+
+// layout are the options for details of the exported OCI layout that some
+// consumers of the tarball are strict about
+type layout struct {
+	// attestationManifests keeps the attestation manifests in the image
+	// index. If false they are only referenced from index.json.
+	attestationManifests bool
+	// indexMediaType overrides the media type of the image index
+	indexMediaType string
+	// nameAnnotations adds the io.containerd.image.name annotations to
+	// index.json
+	nameAnnotations bool
+	gzip            bool
+}
+
+func (l layout) rewritesIndex() bool {
+	return !l.attestationManifests || l.indexMediaType != ""
+}
+
+// rewriteIndex applies the layout options to the image index desc. The
+// rewritten index is written to store and the attestation manifests that
+// were removed from it are returned.
+func (l layout) rewriteIndex(ctx context.Context, store content.Store, desc ocispecs.Descriptor) (*ocispecs.Descriptor, []ocispecs.Descriptor, error) {
+	if !images.IsIndexType(desc.MediaType) {
+		return nil, nil, errors.Errorf("%s and %s require a multi-platform image or attestations", keyIndexMediaType, keyAttestationManifests)
+	}
+	dt, err := content.ReadBlob(ctx, store, desc)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read image index")
+	}
+	idx := map[string]json.RawMessage{}
+	if err := json.Unmarshal(dt, &idx); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse image index")
+	}
+	var manifests []ocispecs.Descriptor
+	if err := json.Unmarshal(idx["manifests"], &manifests); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse manifests of image index")
+	}
+
+	var attestations []ocispecs.Descriptor
+	if !l.attestationManifests {
+		kept := manifests[:0]
+		for _, m := range manifests {
+			if m.Annotations[attestation.AnnotationReferenceType] == attestation.ReferenceTypeAttestation {
+				attestations = append(attestations, m)
+				continue
+			}
+			kept = append(kept, m)
+		}
+		manifests = kept
+		if idx["manifests"], err = json.Marshal(manifests); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to marshal manifests of image index")
+		}
+	}
+
+	mediaType := desc.MediaType
+	switch l.indexMediaType {
+	case indexMediaTypeOCI:
+		mediaType = ocispecs.MediaTypeImageIndex
+	case indexMediaTypeDocker:
+		mediaType = images.MediaTypeDockerSchema2ManifestList
+	}
+	if idx["mediaType"], err = json.Marshal(mediaType); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to marshal media type")
+	}
+
+	dt, err = json.MarshalIndent(idx, "", "   ")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to marshal image index")
+	}
+	out := ocispecs.Descriptor{
+		MediaType:   mediaType,
+		Digest:      digest.FromBytes(dt),
+		Size:        int64(len(dt)),
+		Annotations: desc.Annotations,
+	}
+	labels := map[string]string{}
+	for i, m := range manifests {
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.%d", i)] = m.Digest.String()
+	}
+	if err := content.WriteBlob(ctx, store, out.Digest.String(), bytes.NewReader(dt), out, content.WithLabels(labels)); err != nil {
+		return nil, nil, errors.Wrapf(err, "error writing image index blob %s", out.Digest)
+	}
+	return &out, attestations, nil
+}
+
+// indexManifests returns the entries of index.json for desc named names and
+// the attestation manifests that were removed from its image index
+func (l layout) indexManifests(desc ocispecs.Descriptor, names []string, attestations []ocispecs.Descriptor) ([]ocispecs.Descriptor, error) {
+	var manifests []ocispecs.Descriptor
+	if len(names) == 0 {
+		manifests = append(manifests, desc)
+	}
+	for _, name := range names {
+		annotations, err := refNameAnnotations(name, desc.Annotations)
+		if err != nil {
+			return nil, err
+		}
+		if l.nameAnnotations {
+			annotations[images.AnnotationImageName] = name
+		}
+		mc := desc
+		mc.Annotations = annotations
+		manifests = append(manifests, mc)
+	}
+	return append(manifests, attestations...), nil
+}
+
+// refNameAnnotations returns the annotations naming desc with the tag of
+// name in index.json without the io.containerd.image.name annotation
+func refNameAnnotations(name string, base map[string]string) (map[string]string, error) {
+	parsed, err := reference.ParseNormalizedNamed(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", name)
+	}
+	refName := parsed.String()
+	if tagged, ok := parsed.(reference.Tagged); ok {
+		refName = tagged.Tag()
+	}
+	annotations := map[string]string{}
+	for k, v := range base {
+		annotations[k] = v
+	}
+	annotations[ocispecs.AnnotationRefName] = refName
+	return annotations, nil
+}
@@ -0,0 +1,75 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/images"
+	"github.com/moby/buildkit/exporter/attestation"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteIndex(t *testing.T) {
+	ctx := context.TODO()
+	cs, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	img := ocispecs.Descriptor{MediaType: ocispecs.MediaTypeImageManifest, Digest: digest.FromString("image"), Size: 5, Platform: &ocispecs.Platform{OS: "linux", Architecture: "amd64"}}
+	att := ocispecs.Descriptor{MediaType: ocispecs.MediaTypeImageManifest, Digest: digest.FromString("att"), Size: 3, Annotations: map[string]string{
+		attestation.AnnotationReferenceType:   attestation.ReferenceTypeAttestation,
+		attestation.AnnotationReferenceDigest: img.Digest.String(),
+	}}
+	dt, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     ocispecs.MediaTypeImageIndex,
+		"manifests":     []ocispecs.Descriptor{img, att},
+		"annotations":   map[string]string{"foo": "bar"},
+	})
+	require.NoError(t, err)
+	desc := ocispecs.Descriptor{MediaType: ocispecs.MediaTypeImageIndex, Digest: digest.FromBytes(dt), Size: int64(len(dt))}
+	require.NoError(t, content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(dt), desc))
+
+	out, attestations, err := layout{attestationManifests: true, indexMediaType: indexMediaTypeDocker}.rewriteIndex(ctx, cs, desc)
+	require.NoError(t, err)
+	require.Empty(t, attestations)
+	require.Equal(t, images.MediaTypeDockerSchema2ManifestList, out.MediaType)
+	idx := readIndex(t, cs, *out)
+	require.Equal(t, images.MediaTypeDockerSchema2ManifestList, idx.MediaType)
+	require.Equal(t, 2, len(idx.Manifests))
+
+	out, attestations, err = layout{}.rewriteIndex(ctx, cs, desc)
+	require.NoError(t, err)
+	require.Equal(t, []ocispecs.Descriptor{att}, attestations)
+	require.Equal(t, ocispecs.MediaTypeImageIndex, out.MediaType)
+	idx = readIndex(t, cs, *out)
+	require.Equal(t, []ocispecs.Descriptor{img}, idx.Manifests)
+	require.Equal(t, map[string]string{"foo": "bar"}, idx.Annotations)
+
+	_, _, err = layout{}.rewriteIndex(ctx, cs, img)
+	require.Error(t, err)
+}
+
+func TestRefNameAnnotations(t *testing.T) {
+	a, err := refNameAnnotations("docker.io/library/foo:v1", map[string]string{"foo": "bar"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"foo": "bar", ocispecs.AnnotationRefName: "v1"}, a)
+}
+
+type index struct {
+	MediaType string `json:"mediaType"`
+	ocispecs.Index
+}
+
+func readIndex(t *testing.T, cs content.Store, desc ocispecs.Descriptor) index {
+	dt, err := content.ReadBlob(context.TODO(), cs, desc)
+	require.NoError(t, err)
+	var idx index
+	require.NoError(t, json.Unmarshal(dt, &idx))
+	return idx
+}
@@ -0,0 +1,62 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/session"
+	sessioncontent "github.com/moby/buildkit/session/content"
+	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/buildkit/util/contentutil"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// writeLayoutDir copies the blobs of the manifests to the OCI layout
+// directory of the client. The client reports the blobs that exist in the
+// directory already so only the new blobs are transferred. The entries for
+// index.json are returned in resp for the client to add them.
+func (l layout) writeLayoutDir(ctx context.Context, caller session.Caller, provider content.Provider, desc ocispecs.Descriptor, names []string, attestations []ocispecs.Descriptor, resp map[string]string) error {
+	manifests, err := l.indexManifests(desc, names, attestations)
+	if err != nil {
+		return err
+	}
+	dt, err := json.Marshal(manifests)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal index manifests")
+	}
+
+	store := &reuseCounter{Ingester: sessioncontent.NewCallerStore(caller, sessioncontent.ExportStoreID)}
+	report := oneOffProgress(ctx, "sending layout")
+	for _, m := range append([]ocispecs.Descriptor{desc}, attestations...) {
+		if err := contentutil.CopyChain(ctx, store, provider, m); err != nil {
+			return report(errors.Wrap(err, "failed to copy blobs to layout directory"))
+		}
+	}
+	bklog.G(ctx).Debugf("copied %d blobs to layout directory, %d existed already", store.written, store.existing)
+
+	resp[exptypes.ExporterOCILayoutManifestsKey] = string(dt)
+	return report(nil)
+}
+
+// reuseCounter counts the blobs that are written to Ingester and the ones that
+// exist already
+type reuseCounter struct {
+	content.Ingester
+	written  int64
+	existing int64
+}
+
+func (c *reuseCounter) Writer(ctx context.Context, opts ...content.WriterOpt) (content.Writer, error) {
+	w, err := c.Ingester.Writer(ctx, opts...)
+	if errdefs.IsAlreadyExists(err) {
+		atomic.AddInt64(&c.existing, 1)
+	} else if err == nil {
+		atomic.AddInt64(&c.written, 1)
+	}
+	return w, err
+}
@@ -0,0 +1,104 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/images"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/session"
+	sessioncontent "github.com/moby/buildkit/session/content"
+	"github.com/moby/buildkit/session/testutil"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestWriteLayoutDir(t *testing.T) {
+	ctx := context.TODO()
+	src, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+	destDir := t.TempDir()
+	dest, err := local.NewStore(destDir)
+	require.NoError(t, err)
+
+	write := func(cs content.Store, mediaType string, dt []byte) ocispecs.Descriptor {
+		desc := ocispecs.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(dt), Size: int64(len(dt))}
+		require.NoError(t, content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(dt), desc))
+		return desc
+	}
+	config := write(src, ocispecs.MediaTypeImageConfig, []byte(`{"architecture":"amd64","os":"linux"}`))
+	base := write(src, ocispecs.MediaTypeImageLayerGzip, []byte("base"))
+	top := write(src, ocispecs.MediaTypeImageLayerGzip, []byte("top"))
+	dt, err := json.Marshal(ocispecs.Manifest{Config: config, Layers: []ocispecs.Descriptor{base, top}})
+	require.NoError(t, err)
+	mfst := write(src, ocispecs.MediaTypeImageManifest, dt)
+
+	// the base layer was exported before
+	write(dest, base.MediaType, []byte("base"))
+	basePath := filepath.Join(destDir, "blobs", "sha256", base.Digest.Hex())
+	baseInfo, err := os.Stat(basePath)
+	require.NoError(t, err)
+
+	s, err := session.NewSession(ctx, "foo", "bar")
+	require.NoError(t, err)
+	s.Allow(sessioncontent.NewAttachable(map[string]content.Store{sessioncontent.ExportStoreID: dest}))
+	m, err := session.NewManager()
+	require.NoError(t, err)
+	dialer := session.Dialer(testutil.TestStream(testutil.Handler(m.HandleConn)))
+
+	resp := map[string]string{}
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		return s.Run(ctx, dialer)
+	})
+	eg.Go(func() error {
+		defer s.Close()
+		caller, err := m.Get(ctx, s.ID(), false)
+		if err != nil {
+			return err
+		}
+		return layout{nameAnnotations: true}.writeLayoutDir(ctx, caller, src, mfst, []string{"docker.io/library/foo:latest"}, nil, resp)
+	})
+	require.NoError(t, eg.Wait())
+
+	for _, desc := range []ocispecs.Descriptor{config, base, top, mfst} {
+		_, err := dest.Info(context.TODO(), desc.Digest)
+		require.NoError(t, err)
+	}
+	fi, err := os.Stat(basePath)
+	require.NoError(t, err)
+	require.True(t, os.SameFile(baseInfo, fi))
+
+	var manifests []ocispecs.Descriptor
+	require.NoError(t, json.Unmarshal([]byte(resp[exptypes.ExporterOCILayoutManifestsKey]), &manifests))
+	require.Equal(t, 1, len(manifests))
+	require.Equal(t, mfst.Digest, manifests[0].Digest)
+	require.Equal(t, map[string]string{
+		images.AnnotationImageName: "docker.io/library/foo:latest",
+		ocispecs.AnnotationRefName: "latest",
+	}, manifests[0].Annotations)
+}
+
+func TestIndexManifests(t *testing.T) {
+	img := ocispecs.Descriptor{MediaType: ocispecs.MediaTypeImageIndex, Digest: digest.FromString("image"), Size: 5}
+	att := ocispecs.Descriptor{MediaType: ocispecs.MediaTypeImageManifest, Digest: digest.FromString("att"), Size: 3}
+
+	manifests, err := layout{}.indexManifests(img, nil, []ocispecs.Descriptor{att})
+	require.NoError(t, err)
+	require.Equal(t, []ocispecs.Descriptor{img, att}, manifests)
+
+	manifests, err = layout{}.indexManifests(img, []string{"docker.io/library/foo:v1", "example.com/bar:v2"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(manifests))
+	require.Equal(t, map[string]string{ocispecs.AnnotationRefName: "v1"}, manifests[0].Annotations)
+	require.Equal(t, map[string]string{ocispecs.AnnotationRefName: "v2"}, manifests[1].Annotations)
+	require.Nil(t, img.Annotations)
+}
@@ -0,0 +1,336 @@
+// Package outputpolicy verifies the results of builds against the rules of
+// the daemon before they are exported, so that e.g. images with private keys
+// are never pushed.
+package outputpolicy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/containerd/continuity/fs"
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/snapshot"
+	"github.com/moby/buildkit/solver/errdefs"
+	"github.com/pkg/errors"
+)
+
+// maxReportedPaths is the number of denied paths reported per rule and result
+const maxReportedPaths = 10
+
+// CacheExporter is the exporter type of the rules that apply to the build
+// cache of results exported to remote caches
+const CacheExporter = "cache"
+
+// Rule denies results that contain paths or exceed a size
+type Rule struct {
+	// Name identifies the rule in reports
+	Name string
+	// DenyPaths are patterns of paths that must not exist in any layer of
+	// the result. Patterns with a slash are matched against the absolute
+	// path, e.g. /root/.ssh, other patterns against the base name, e.g.
+	// *.pem. The contents of denied directories are not reported.
+	DenyPaths []string
+	// MaxSize is the size in bytes the files of the layers of the result
+	// must not exceed, 0 doesn't limit the size. Files that several layers
+	// change are counted for each layer.
+	MaxSize int64
+	// Exporters are the types of the exporters the rule applies to, e.g.
+	// image or CacheExporter, all exporters if empty
+	Exporters []string
+}
+
+// Validate returns an error for invalid patterns
+func (r Rule) Validate() error {
+	for _, p := range r.DenyPaths {
+		if strings.Contains(p, "/") && !strings.HasPrefix(p, "/") {
+			return errors.Errorf("deny path %q of output policy %s is not absolute", p, r.Name)
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return errors.Wrapf(err, "invalid deny path %q of output policy %s", p, r.Name)
+		}
+	}
+	if r.MaxSize < 0 {
+		return errors.Errorf("invalid max size %d of output policy %s", r.MaxSize, r.Name)
+	}
+	return nil
+}
+
+// Policy is the set of rules of the daemon
+type Policy struct {
+	Rules []Rule
+}
+
+// ForExporter returns the policy of the rules that apply to the exporter
+// type, nil if there are none
+func (p *Policy) ForExporter(typ string) *Policy {
+	if p == nil {
+		return nil
+	}
+	var rules []Rule
+	for _, r := range p.Rules {
+		if len(r.Exporters) == 0 || contains(r.Exporters, typ) {
+			rules = append(rules, r)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return &Policy{Rules: rules}
+}
+
+// Violation is a rule violated by a result
+type Violation struct {
+	Rule string
+	// Result is the key of the result in multi-platform results, e.g. the
+	// platform, empty for single results
+	Result string
+	// Paths are the first denied paths
+	Paths []string
+	// DeniedPaths is the number of all denied paths
+	DeniedPaths int
+	// Size is set to the size of results exceeding the MaxSize of the rule
+	Size    int64
+	MaxSize int64
+}
+
+// ViolationError is returned for results that violate the policy. Its
+// message is the report of the violations.
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("output violates policy:")
+	for _, v := range e.Violations {
+		prefix := fmt.Sprintf("\n  %s", v.Rule)
+		if v.Result != "" {
+			prefix += fmt.Sprintf(" (%s)", v.Result)
+		}
+		if v.MaxSize > 0 && v.Size > v.MaxSize {
+			fmt.Fprintf(&sb, "%s: size %d bytes exceeds %d bytes", prefix, v.Size, v.MaxSize)
+		}
+		if v.DeniedPaths > 0 {
+			fmt.Fprintf(&sb, "%s: denied paths %s", prefix, strings.Join(v.Paths, ", "))
+			if n := v.DeniedPaths - len(v.Paths); n > 0 {
+				fmt.Fprintf(&sb, " and %d more", n)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// Verify returns a ViolationError if the refs of src violate the policy
+func (p *Policy) Verify(ctx context.Context, src exporter.Source, sessionID string) error {
+	refs := map[string]cache.ImmutableRef{}
+	if src.Ref != nil {
+		refs[""] = src.Ref
+	}
+	for k, ref := range src.Refs {
+		if ref != nil {
+			refs[k] = ref
+		}
+	}
+	keys := make([]string, 0, len(refs))
+	for k := range refs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var violations []Violation
+	for _, k := range keys {
+		v, err := p.verifyRef(ctx, refs[k], sessionID)
+		if err != nil {
+			return err
+		}
+		for i := range v {
+			v[i].Result = k
+		}
+		violations = append(violations, v...)
+	}
+	if len(violations) > 0 {
+		return errdefs.WithCode(&ViolationError{Violations: violations}, errdefs.CodePolicyDenied)
+	}
+	return nil
+}
+
+// verifyRef verifies the diffs of the layers of ref that the build created.
+// The layers of the base image were pulled and are skipped, only the top one
+// is mounted as the lower directory of the first layer of the build. Paths
+// that are removed by a later layer are still in the exported layers.
+func (p *Policy) verifyRef(ctx context.Context, ref cache.ImmutableRef, sessionID string) ([]Violation, error) {
+	var layers []cache.ImmutableRef
+	for r := ref; r != nil; r = r.Parent() {
+		if r != ref {
+			defer r.Release(context.TODO())
+		}
+		layers = append([]cache.ImmutableRef{r}, layers...)
+	}
+	base := 0
+	for base < len(layers) && cache.IsImageLayer(layers[base]) {
+		base++
+	}
+	if base == len(layers) {
+		return nil, nil
+	}
+
+	var unmounts []func() error
+	defer func() {
+		for _, unmount := range unmounts {
+			unmount()
+		}
+	}()
+	mount := func(l cache.ImmutableRef) (string, error) {
+		m, err := l.Mount(ctx, true, session.NewGroup(sessionID))
+		if err != nil {
+			return "", err
+		}
+		lm := snapshot.LocalMounter(m)
+		root, err := lm.Mount()
+		if err != nil {
+			return "", err
+		}
+		unmounts = append(unmounts, lm.Unmount)
+		return root, nil
+	}
+	var lower string
+	if base > 0 {
+		root, err := mount(layers[base-1])
+		if err != nil {
+			return nil, err
+		}
+		lower = root
+	}
+	roots := make([]string, 0, len(layers)-base)
+	for _, l := range layers[base:] {
+		root, err := mount(l)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, root)
+	}
+	return p.VerifyLayers(ctx, lower, roots)
+}
+
+// VerifyDir returns the violations of the policy by the root filesystem in
+// the directory root
+func (p *Policy) VerifyDir(root string) ([]Violation, error) {
+	return p.VerifyLayers(context.TODO(), "", []string{root})
+}
+
+// VerifyLayers returns the violations of the policy by the layers of a root
+// filesystem. roots are the directories of the root filesystem after each
+// layer, from the bottom layer, and lower is the directory of the layers
+// below that aren't verified, empty if there are none. The paths that each
+// layer adds or modifies are verified, and the size is the size of the files
+// of all the layers.
+func (p *Policy) VerifyLayers(ctx context.Context, lower string, roots []string) ([]Violation, error) {
+	violations := make([]Violation, len(p.Rules))
+	// denied are the reported paths of each rule, paths that several layers
+	// change are reported once
+	denied := make([]map[string]struct{}, len(p.Rules))
+	for i := range denied {
+		denied[i] = map[string]struct{}{}
+	}
+	var size int64
+
+	for i, root := range roots {
+		if i > 0 {
+			lower = roots[i-1]
+		}
+		err := fs.Changes(ctx, lower, root, func(kind fs.ChangeKind, name string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if kind != fs.ChangeKindAdd && kind != fs.ChangeKindModify {
+				return nil
+			}
+			if fi.Mode().IsRegular() {
+				size += fi.Size()
+			}
+			name = filepath.ToSlash(name)
+			for i, r := range p.Rules {
+				// the contents of denied directories aren't reported.
+				// Changes are walked in lexical order so directories
+				// precede their contents.
+				if deniedParent(denied[i], name) {
+					continue
+				}
+				if !matchAny(r.DenyPaths, name) {
+					continue
+				}
+				if _, ok := denied[i][name]; ok {
+					continue
+				}
+				denied[i][name] = struct{}{}
+				v := &violations[i]
+				if len(v.Paths) < maxReportedPaths {
+					v.Paths = append(v.Paths, name)
+				}
+				v.DeniedPaths++
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var out []Violation
+	for i, r := range p.Rules {
+		v := violations[i]
+		v.Rule = r.Name
+		if r.MaxSize > 0 && size > r.MaxSize {
+			v.Size = size
+			v.MaxSize = r.MaxSize
+		}
+		if v.DeniedPaths > 0 || v.MaxSize > 0 {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// matchAny returns whether p or one of its parent directories matches one of
+// the patterns, so that files added to a denied directory that isn't changed
+// by the layer are denied too
+func matchAny(patterns []string, p string) bool {
+	for ; p != "/" && p != "."; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			name := p
+			if !strings.Contains(pattern, "/") {
+				name = path.Base(p)
+			}
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deniedParent returns whether a parent directory of p is denied
+func deniedParent(denied map[string]struct{}, p string) bool {
+	for p = path.Dir(p); p != "/" && p != "."; p = path.Dir(p) {
+		if _, ok := denied[p]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(l []string, v string) bool {
+	for _, s := range l {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
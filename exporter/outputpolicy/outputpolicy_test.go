@@ -0,0 +1,125 @@
+package outputpolicy
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyDir(t *testing.T) {
+	t.Parallel()
+	root, err := ioutil.TempDir("", "outputpolicy")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	for _, f := range []string{"root/.ssh/id_rsa", "root/.ssh/known_hosts", "etc/ssl/server.pem", "usr/bin/apk", "app/main"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, filepath.Dir(f)), 0700))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, f), []byte("0123456789"), 0600))
+	}
+	for i := 0; i < maxReportedPaths+2; i++ {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, "app", "key"+strconv.Itoa(i)+".pem"), []byte("0123456789"), 0600))
+	}
+
+	p := &Policy{Rules: []Rule{
+		{Name: "secrets", DenyPaths: []string{"/root/.ssh", "*.pem"}},
+		{Name: "package-managers", DenyPaths: []string{"/usr/bin/apt", "/usr/bin/apk"}, MaxSize: 1000},
+		{Name: "size", MaxSize: 170},
+	}}
+	for _, r := range p.Rules {
+		require.NoError(t, r.Validate())
+	}
+	violations, err := p.VerifyDir(root)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(violations))
+
+	require.Equal(t, "secrets", violations[0].Rule)
+	// the contents of denied directories are not reported
+	require.Equal(t, maxReportedPaths, len(violations[0].Paths))
+	require.Equal(t, "/app/key0.pem", violations[0].Paths[0])
+	require.Equal(t, maxReportedPaths+4, violations[0].DeniedPaths)
+	require.Equal(t, int64(0), violations[0].MaxSize)
+
+	require.Equal(t, "package-managers", violations[1].Rule)
+	require.Equal(t, []string{"/usr/bin/apk"}, violations[1].Paths)
+	require.Equal(t, int64(0), violations[1].MaxSize)
+
+	p.Rules[2].MaxSize = 160
+	violations, err = p.VerifyDir(root)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(violations))
+	require.Equal(t, "size", violations[2].Rule)
+	require.Equal(t, int64(170), violations[2].Size)
+
+	require.EqualError(t, &ViolationError{Violations: violations[1:]}, "output violates policy:\n  package-managers: denied paths /usr/bin/apk\n  size: size 170 bytes exceeds 160 bytes")
+}
+
+func TestVerifyLayers(t *testing.T) {
+	t.Parallel()
+	mtime := time.Unix(1600000000, 123)
+	writeLayer := func(files map[string]string) string {
+		root := t.TempDir()
+		for f, dt := range files {
+			require.NoError(t, os.MkdirAll(filepath.Join(root, filepath.Dir(f)), 0700))
+			require.NoError(t, ioutil.WriteFile(filepath.Join(root, f), []byte(dt), 0600))
+			require.NoError(t, os.Chtimes(filepath.Join(root, f), mtime, mtime))
+		}
+		return root
+	}
+	roots := []string{
+		writeLayer(map[string]string{"app/main": "0123456789"}),
+		writeLayer(map[string]string{"app/main": "0123456789", "root/.ssh/id_rsa": "0123456789"}),
+		// the key is removed but it's still in the layer before
+		writeLayer(map[string]string{"app/main": "01234567890123456789", "root/.ssh/known_hosts": "0123456789"}),
+	}
+
+	p := &Policy{Rules: []Rule{
+		{Name: "secrets", DenyPaths: []string{"/root/.ssh"}},
+		{Name: "size", MaxSize: 40},
+	}}
+	violations, err := p.VerifyLayers(context.TODO(), "", roots)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(violations))
+	require.Equal(t, "secrets", violations[0].Rule)
+	// the paths that several layers change are reported once
+	require.Equal(t, []string{"/root/.ssh"}, violations[0].Paths)
+	require.Equal(t, 1, violations[0].DeniedPaths)
+	// the unchanged files of a layer aren't counted
+	require.Equal(t, "size", violations[1].Rule)
+	require.Equal(t, int64(50), violations[1].Size)
+
+	violations, err = p.VerifyLayers(context.TODO(), "", roots[:1])
+	require.NoError(t, err)
+	require.Equal(t, 0, len(violations))
+
+	// the files of the layers below lower, e.g. of the base image, aren't
+	// counted, files added to their denied directories are denied
+	violations, err = p.VerifyLayers(context.TODO(), roots[1], roots[2:])
+	require.NoError(t, err)
+	require.Equal(t, 1, len(violations))
+	require.Equal(t, "secrets", violations[0].Rule)
+	require.Equal(t, []string{"/root/.ssh/known_hosts"}, violations[0].Paths)
+}
+
+func TestForExporter(t *testing.T) {
+	t.Parallel()
+	var p *Policy
+	require.Nil(t, p.ForExporter("image"))
+
+	p = &Policy{Rules: []Rule{
+		{Name: "all", MaxSize: 1},
+		{Name: "push", MaxSize: 1, Exporters: []string{"image", "registry"}},
+	}}
+	require.Equal(t, 2, len(p.ForExporter("image").Rules))
+	require.Equal(t, "all", p.ForExporter("local").Rules[0].Name)
+	require.Nil(t, (&Policy{Rules: p.Rules[1:]}).ForExporter("local"))
+	require.Equal(t, "all", p.ForExporter(CacheExporter).Rules[0].Name)
+
+	require.Error(t, Rule{DenyPaths: []string{"root/.ssh"}}.Validate())
+	require.Error(t, Rule{DenyPaths: []string{"[a-"}}.Validate())
+}
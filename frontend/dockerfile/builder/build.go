@@ -18,13 +18,14 @@ import (
 	"github.com/moby/buildkit/client/llb"
 	"github.com/moby/buildkit/exporter/containerimage/exptypes"
 	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
-	"github.com/moby/buildkit/frontend/dockerfile/dockerignore"
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
 	"github.com/moby/buildkit/frontend/dockerfile/parser"
 	"github.com/moby/buildkit/frontend/gateway/client"
 	gwpb "github.com/moby/buildkit/frontend/gateway/pb"
 	"github.com/moby/buildkit/solver/errdefs"
 	"github.com/moby/buildkit/solver/pb"
 	"github.com/moby/buildkit/util/apicaps"
+	"github.com/moby/buildkit/util/system"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
@@ -40,8 +41,14 @@ const (
 	keyCacheNS                 = "build-arg:BUILDKIT_CACHE_MOUNT_NS"
 	defaultDockerfileName      = "Dockerfile"
 	dockerignoreFilename       = ".dockerignore"
+	defaultContainerfileName   = "Containerfile"
+	containerignoreFilename    = ".containerignore"
 	buildArgPrefix             = "build-arg:"
 	labelPrefix                = "label:"
+	sshKnownHostsPrefix        = "ssh-known-hosts:"
+	defaultPathPrefix          = "default-path:"
+	defaultShellPrefix         = "default-shell:"
+	fallbackRefPrefix          = "fallback-ref:"
 	keyNoCache                 = "no-cache"
 	keyTargetPlatform          = "platform"
 	keyMultiPlatform           = "multi-platform"
@@ -56,6 +63,11 @@ const (
 	keySyntax                  = "build-arg:BUILDKIT_SYNTAX"
 	keyMultiPlatformArg        = "build-arg:BUILDKIT_MULTI_PLATFORM"
 	keyHostname                = "hostname"
+	keyCompat                  = "compat"
+	keyVerboseProgress         = "verbose-progress"
+	keyIgnoreFile              = "ignorefile"
+	ignoreFilePrefix           = "ignorefile:"
+	namedContextPrefix         = "context:"
 )
 
 var httpPrefix = regexp.MustCompile(`^https?://`)
@@ -90,6 +102,11 @@ func Build(ctx context.Context, c client.Client) (*client.Result, error) {
 		defaultBuildPlatform = workers[0].Platforms[0]
 	}
 
+	defaults, err := parseDefaults(opts, c.BuildOpts().Workers)
+	if err != nil {
+		return nil, err
+	}
+
 	buildPlatforms := []ocispecs.Platform{defaultBuildPlatform}
 	targetPlatforms := []*ocispecs.Platform{nil}
 	if v := opts[keyTargetPlatform]; v != "" {
@@ -115,10 +132,33 @@ func Build(ctx context.Context, c client.Client) (*client.Result, error) {
 		return nil, err
 	}
 
+	containerfileCompat, err := parseCompat(opts[keyCompat])
+	if err != nil {
+		return nil, err
+	}
+
+	var verboseProgress bool
+	if v := opts[keyVerboseProgress]; v != "" {
+		verboseProgress, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.Errorf("invalid boolean value %s for %s", v, keyVerboseProgress)
+		}
+	}
+
 	filename := opts[keyFilename]
 	if filename == "" {
 		filename = defaultDockerfileName
+		if containerfileCompat {
+			filename = defaultContainerfileName
+		}
+	}
+	fallbackFilenames := dockerfileFallbacks(filename, containerfileCompat)
+
+	ignoreFilenames := []string{dockerignoreFilename}
+	if containerfileCompat {
+		ignoreFilenames = []string{containerignoreFilename, dockerignoreFilename}
 	}
+	extraIgnoreFilenames := parseIgnoreFiles(opts, localNameContext)
 
 	var ignoreCache []string
 	if v, ok := opts[keyNoCache]; ok {
@@ -132,11 +172,7 @@ func Build(ctx context.Context, c client.Client) (*client.Result, error) {
 	name := "load build definition from " + filename
 
 	filenames := []string{filename, filename + ".dockerignore"}
-
-	// dockerfile is also supported casing moby/moby#10858
-	if path.Base(filename) == defaultDockerfileName {
-		filenames = append(filenames, path.Join(path.Dir(filename), strings.ToLower(defaultDockerfileName)))
-	}
+	filenames = append(filenames, fallbackFilenames...)
 
 	src := llb.Local(localNameDockerfile,
 		llb.FollowPaths(filenames),
@@ -239,6 +275,10 @@ func Build(ctx context.Context, c client.Client) (*client.Result, error) {
 		}
 	}
 
+	if isNotLocalContext && len(extraIgnoreFilenames) > 0 {
+		return nil, errors.Errorf("ignore files %s can only be used with a local or git build context", strings.Join(extraIgnoreFilenames, ", "))
+	}
+
 	def, err := src.Marshal(ctx, marshalOpts...)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to marshal local source")
@@ -250,6 +290,8 @@ func Build(ctx context.Context, c client.Client) (*client.Result, error) {
 	var dtDockerfile []byte
 	var dtDockerignore []byte
 	var dtDockerignoreDefault []byte
+	var dockerignoreDefaultName string
+	extraIgnoreFiles := make([]ignoreFile, len(extraIgnoreFilenames))
 	eg.Go(func() error {
 		res, err := c.Solve(ctx2, client.SolveRequest{
 			Definition: def.ToPB(),
@@ -268,13 +310,14 @@ func Build(ctx context.Context, c client.Client) (*client.Result, error) {
 		})
 		if err != nil {
 			fallback := false
-			if path.Base(filename) == defaultDockerfileName {
+			for _, name := range fallbackFilenames {
 				var err1 error
 				dtDockerfile, err1 = ref.ReadFile(ctx2, client.ReadRequest{
-					Filename: path.Join(path.Dir(filename), strings.ToLower(defaultDockerfileName)),
+					Filename: name,
 				})
 				if err1 == nil {
 					fallback = true
+					break
 				}
 			}
 			if !fallback {
@@ -293,16 +336,16 @@ func Build(ctx context.Context, c client.Client) (*client.Result, error) {
 		}
 		return nil
 	})
-	var excludes []string
 	if !isNotLocalContext {
 		eg.Go(func() error {
 			dockerignoreState := buildContext
 			if dockerignoreState == nil {
+				names := append(append([]string{}, ignoreFilenames...), extraIgnoreFilenames...)
 				st := llb.Local(localNameContext,
 					llb.SessionID(c.BuildOpts().SessionID),
-					llb.FollowPaths([]string{dockerignoreFilename}),
-					llb.SharedKeyHint(localNameContext+"-"+dockerignoreFilename),
-					dockerfile2llb.WithInternalName("load "+dockerignoreFilename),
+					llb.FollowPaths(names),
+					llb.SharedKeyHint(localNameContext+"-"+strings.Join(names, "-")),
+					dockerfile2llb.WithInternalName("load "+strings.Join(names, ", ")),
 					llb.Differ(llb.DiffNone, false),
 				)
 				dockerignoreState = &st
@@ -321,11 +364,26 @@ func Build(ctx context.Context, c client.Client) (*client.Result, error) {
 			if err != nil {
 				return err
 			}
-			dtDockerignoreDefault, err = ref.ReadFile(ctx2, client.ReadRequest{
-				Filename: dockerignoreFilename,
-			})
-			if err != nil {
-				return nil
+			for _, name := range ignoreFilenames {
+				dt, err := ref.ReadFile(ctx2, client.ReadRequest{
+					Filename: name,
+				})
+				if err == nil {
+					dtDockerignoreDefault = dt
+					dockerignoreDefaultName = name
+					break
+				}
+			}
+			for i, name := range extraIgnoreFilenames {
+				dt, err := ref.ReadFile(ctx2, client.ReadRequest{
+					Filename: name,
+				})
+				if err != nil {
+					return errors.Wrapf(err, "failed to read ignore file %s", name)
+				}
+				if extraIgnoreFiles[i], err = parseIgnoreFile(name, dt); err != nil {
+					return err
+				}
 			}
 			return nil
 		})
@@ -335,15 +393,23 @@ func Build(ctx context.Context, c client.Client) (*client.Result, error) {
 		return nil, err
 	}
 
+	// the ignore file next to the Dockerfile replaces the one of the context,
+	// the additional ignore files are applied after it
+	var ignoreFiles []ignoreFile
+	dockerignoreName := filename + ".dockerignore"
 	if dtDockerignore == nil {
 		dtDockerignore = dtDockerignoreDefault
+		dockerignoreName = dockerignoreDefaultName
 	}
 	if dtDockerignore != nil {
-		excludes, err = dockerignore.ReadAll(bytes.NewBuffer(dtDockerignore))
+		f, err := parseIgnoreFile(dockerignoreName, dtDockerignore)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to parse dockerignore")
+			return nil, err
 		}
+		ignoreFiles = append(ignoreFiles, f)
 	}
+	ignoreFiles = append(ignoreFiles, extraIgnoreFiles...)
+	excludes := ignorePatterns(ignoreFiles)
 
 	if _, ok := opts["cmdline"]; !ok {
 		if cmdline, ok := opts[keySyntax]; ok {
@@ -366,7 +432,32 @@ func Build(ctx context.Context, c client.Client) (*client.Result, error) {
 		return nil, capsError
 	}
 
-	if res, ok, err := checkSubRequest(ctx, opts); ok {
+	localContexts, err := loadLocalContexts(ctx, c, opts, ignoreFilenames, marshalOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if res, ok, err := checkSubRequest(ctx, c, opts, dtDockerfile, dockerfile2llb.ConvertOpt{
+		Target:           opts[keyTarget],
+		MetaResolver:     c,
+		BuildArgs:        filter(opts, buildArgPrefix),
+		TargetPlatform:   targetPlatforms[0],
+		BuildPlatforms:   buildPlatforms,
+		ImageResolveMode: resolveMode,
+		LLBCaps:          &caps,
+		Defaults:         defaults,
+		LocalContexts:    localContexts,
+	}, ignoreContext{
+		localName:   localNameContext,
+		state:       buildContext,
+		files:       ignoreFiles,
+		marshalOpts: marshalOpts,
+	}); ok {
+		err = wrapUnsupported(err)
+		var el *parser.ErrorLocation
+		if errors.As(err, &el) {
+			err = wrapSource(err, sourceMap, el.Location)
+		}
 		return res, err
 	}
 
@@ -397,31 +488,38 @@ func Build(ctx context.Context, c client.Client) (*client.Result, error) {
 		func(i int, tp *ocispecs.Platform) {
 			eg.Go(func() (err error) {
 				defer func() {
+					err = wrapUnsupported(err)
 					var el *parser.ErrorLocation
 					if errors.As(err, &el) {
 						err = wrapSource(err, sourceMap, el.Location)
 					}
 				}()
 				st, img, err := dockerfile2llb.Dockerfile2LLB(ctx, dtDockerfile, dockerfile2llb.ConvertOpt{
-					Target:            opts[keyTarget],
-					MetaResolver:      c,
-					BuildArgs:         filter(opts, buildArgPrefix),
-					Labels:            filter(opts, labelPrefix),
-					CacheIDNamespace:  opts[keyCacheNS],
-					SessionID:         c.BuildOpts().SessionID,
-					BuildContext:      buildContext,
-					Excludes:          excludes,
-					IgnoreCache:       ignoreCache,
-					TargetPlatform:    tp,
-					BuildPlatforms:    buildPlatforms,
-					ImageResolveMode:  resolveMode,
-					PrefixPlatform:    exportMap,
-					ExtraHosts:        extraHosts,
-					ForceNetMode:      defaultNetMode,
-					OverrideCopyImage: opts[keyOverrideCopyImage],
-					LLBCaps:           &caps,
-					SourceMap:         sourceMap,
-					Hostname:          opts[keyHostname],
+					Target:              opts[keyTarget],
+					MetaResolver:        c,
+					BuildArgs:           filter(opts, buildArgPrefix),
+					Labels:              filter(opts, labelPrefix),
+					CacheIDNamespace:    opts[keyCacheNS],
+					SessionID:           c.BuildOpts().SessionID,
+					BuildContext:        buildContext,
+					Excludes:            excludes,
+					IgnoreCache:         ignoreCache,
+					TargetPlatform:      tp,
+					BuildPlatforms:      buildPlatforms,
+					ImageResolveMode:    resolveMode,
+					PrefixPlatform:      exportMap,
+					ExtraHosts:          extraHosts,
+					ForceNetMode:        defaultNetMode,
+					OverrideCopyImage:   opts[keyOverrideCopyImage],
+					LLBCaps:             &caps,
+					SourceMap:           sourceMap,
+					Hostname:            opts[keyHostname],
+					SSHKnownHosts:       filter(opts, sshKnownHostsPrefix),
+					Defaults:            defaults,
+					FallbackRefs:        parseFallbackRefs(filter(opts, fallbackRefPrefix)),
+					ContainerfileCompat: containerfileCompat,
+					VerboseProgress:     verboseProgress,
+					LocalContexts:       localContexts,
 				})
 
 				if err != nil {
@@ -557,6 +655,42 @@ func filter(opt map[string]string, key string) map[string]string {
 	return m
 }
 
+// parseFallbackRefs parses the comma separated equivalent references of the
+// fallback-ref:<image> options
+func parseFallbackRefs(m map[string]string) map[string][]string {
+	out := make(map[string][]string, len(m))
+	for k, v := range m {
+		for _, ref := range strings.Split(v, ",") {
+			if ref = strings.TrimSpace(ref); ref != "" {
+				out[k] = append(out[k], ref)
+			}
+		}
+	}
+	return out
+}
+
+// parseDefaults returns the default PATH and shell per OS advertised by the
+// worker, overridden by the default-path:<os> and default-shell:<os> options.
+// The shell is a JSON array, e.g. ["/bin/bash", "-c"].
+func parseDefaults(opts map[string]string, workers []client.WorkerInfo) (system.Defaults, error) {
+	var defaults system.Defaults
+	if len(workers) > 0 {
+		defaults = system.DefaultsFromLabels(workers[0].Labels)
+	}
+	o := system.Defaults{
+		PathEnv: filter(opts, defaultPathPrefix),
+		Shell:   map[string][]string{},
+	}
+	for os, v := range filter(opts, defaultShellPrefix) {
+		var shell []string
+		if err := json.Unmarshal([]byte(v), &shell); err != nil {
+			return defaults, errors.Wrapf(err, "failed to parse %s%s, expected a JSON array", defaultShellPrefix, os)
+		}
+		o.Shell[os] = shell
+	}
+	return defaults.Merge(o), nil
+}
+
 func detectGitContext(ref, gitContext string) (*llb.State, bool) {
 	found := false
 	if httpPrefix.MatchString(ref) && gitURLPathWithFragmentSuffix.MatchString(ref) {
@@ -665,6 +799,35 @@ func parseExtraHosts(v string) ([]llb.HostIP, error) {
 	return out, nil
 }
 
+// parseCompat parses the compatibility mode of the frontend. Only
+// "containerfile" is supported, for Containerfiles written for Podman and
+// Buildah.
+func parseCompat(v string) (bool, error) {
+	switch v {
+	case "":
+		return false, nil
+	case "containerfile":
+		return true, nil
+	default:
+		return false, errors.Errorf("invalid compat mode %s", v)
+	}
+}
+
+// dockerfileFallbacks returns the files read if filename doesn't exist
+func dockerfileFallbacks(filename string, containerfileCompat bool) []string {
+	dir, base := path.Dir(filename), path.Base(filename)
+	var names []string
+	if containerfileCompat && base == defaultContainerfileName {
+		names = append(names, path.Join(dir, defaultDockerfileName))
+		base = defaultDockerfileName
+	}
+	// dockerfile is also supported casing moby/moby#10858
+	if base == defaultDockerfileName {
+		names = append(names, path.Join(dir, strings.ToLower(defaultDockerfileName)))
+	}
+	return names
+}
+
 func parseNetMode(v string) (pb.NetMode, error) {
 	if v == "" {
 		return llb.NetModeSandbox, nil
@@ -705,6 +868,16 @@ func scopeToSubDir(c *llb.State, fileop bool, dir string) *llb.State {
 	return &bc
 }
 
+// wrapUnsupported marks errors for Dockerfile features that need a newer
+// frontend with a typed error so that clients can suggest an upgrade
+func wrapUnsupported(err error) error {
+	var ue *instructions.UnsupportedFeatureError
+	if errors.As(err, &ue) {
+		return (&errdefs.Instruction{Name: ue.Feature, MinSyntax: ue.MinSyntax}).WrapError(err)
+	}
+	return err
+}
+
 func wrapSource(err error, sm *llb.SourceMap, ranges []parser.Range) error {
 	if sm == nil {
 		return err
@@ -0,0 +1,246 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerignore"
+	"github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/moby/buildkit/frontend/subrequests/ignoredfiles"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// ignoreFile is a parsed ignore file of the build context
+type ignoreFile struct {
+	name     string
+	patterns []string
+}
+
+// ignoreContext is the build context the ignore files are applied to
+type ignoreContext struct {
+	localName   string
+	state       *llb.State // nil for the local context
+	files       []ignoreFile
+	marshalOpts []llb.ConstraintsOpt
+}
+
+// parseIgnoreFiles returns the additional ignore files of the local context
+// localName. The ignorefile:<name> option takes precedence over ignorefile.
+func parseIgnoreFiles(opts map[string]string, localName string) []string {
+	v, ok := opts[ignoreFilePrefix+localName]
+	if !ok {
+		v = opts[keyIgnoreFile]
+	}
+	var names []string
+	for _, name := range strings.Split(v, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func parseIgnoreFile(name string, dt []byte) (ignoreFile, error) {
+	patterns, err := dockerignore.ReadAll(bytes.NewBuffer(dt))
+	if err != nil {
+		return ignoreFile{}, errors.Wrapf(err, "failed to parse %s", name)
+	}
+	return ignoreFile{name: name, patterns: patterns}, nil
+}
+
+// loadLocalContexts returns the named local contexts set with
+// context:<name>=local:<local name> options. Every local context is loaded
+// with its own ignore files, the first of ignoreFilenames that exists and
+// the ignorefile:<local name> files.
+func loadLocalContexts(ctx context.Context, c client.Client, opts map[string]string, ignoreFilenames []string, marshalOpts []llb.ConstraintsOpt) (map[string]llb.State, error) {
+	var mu sync.Mutex
+	contexts := map[string]llb.State{}
+	eg, ctx := errgroup.WithContext(ctx)
+	for k, v := range opts {
+		if !strings.HasPrefix(k, namedContextPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(k, namedContextPrefix)
+		if !strings.HasPrefix(v, "local:") {
+			return nil, errors.Errorf("invalid context %s=%s, only local:<name> contexts are supported", name, v)
+		}
+		localName := strings.TrimPrefix(v, "local:")
+		eg.Go(func() error {
+			files, err := loadIgnoreFiles(ctx, c, localName, ignoreFilenames, parseIgnoreFiles(opts, localName), marshalOpts)
+			if err != nil {
+				return errors.Wrapf(err, "failed to load context %s", name)
+			}
+			st := llb.Local(localName,
+				llb.SessionID(c.BuildOpts().SessionID),
+				llb.ExcludePatterns(ignorePatterns(files)),
+				llb.SharedKeyHint(localName),
+				dockerfile2llb.WithInternalName("load build context "+name),
+			)
+			mu.Lock()
+			contexts[name] = st
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return contexts, nil
+}
+
+// loadIgnoreFiles reads the first of defaultNames that exists and the
+// extraNames ignore files of the local context localName
+func loadIgnoreFiles(ctx context.Context, c client.Client, localName string, defaultNames, extraNames []string, marshalOpts []llb.ConstraintsOpt) ([]ignoreFile, error) {
+	names := append(append([]string{}, defaultNames...), extraNames...)
+	st := llb.Local(localName,
+		llb.SessionID(c.BuildOpts().SessionID),
+		llb.FollowPaths(names),
+		llb.SharedKeyHint(localName+"-"+strings.Join(names, "-")),
+		dockerfile2llb.WithInternalName("load "+strings.Join(names, ", ")),
+		llb.Differ(llb.DiffNone, false),
+	)
+	def, err := st.Marshal(ctx, marshalOpts...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.Solve(ctx, client.SolveRequest{
+		Definition: def.ToPB(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ref, err := res.SingleRef()
+	if err != nil {
+		return nil, err
+	}
+	var files []ignoreFile
+	for _, name := range defaultNames {
+		dt, err := ref.ReadFile(ctx, client.ReadRequest{
+			Filename: name,
+		})
+		if err != nil {
+			continue
+		}
+		f, err := parseIgnoreFile(name, dt)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		break
+	}
+	for _, name := range extraNames {
+		dt, err := ref.ReadFile(ctx, client.ReadRequest{
+			Filename: name,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read ignore file %s", name)
+		}
+		f, err := parseIgnoreFile(name, dt)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// ignorePatterns combines the patterns of the ignore files. The patterns are
+// evaluated in order, so the patterns of later files, including "!" patterns,
+// override the earlier ones.
+func ignorePatterns(files []ignoreFile) []string {
+	var excludes []string
+	for _, f := range files {
+		excludes = append(excludes, f.patterns...)
+	}
+	return excludes
+}
+
+// listIgnoredFiles walks the whole build context and returns the files that
+// are excluded by the ignore files
+func listIgnoredFiles(ctx context.Context, c client.Client, ic ignoreContext) (*ignoredfiles.Result, error) {
+	st := ic.state
+	if st == nil {
+		bc := llb.Local(ic.localName,
+			llb.SessionID(c.BuildOpts().SessionID),
+			llb.SharedKeyHint(ic.localName),
+			dockerfile2llb.WithInternalName("load build context"),
+		)
+		st = &bc
+	}
+	def, err := st.Marshal(ctx, ic.marshalOpts...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.Solve(ctx, client.SolveRequest{
+		Definition: def.ToPB(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ref, err := res.SingleRef()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ignoredfiles.Result{
+		Files: []ignoredfiles.File{},
+	}
+	var sources []string
+	for _, f := range ic.files {
+		out.IgnoreFiles = append(out.IgnoreFiles, f.name)
+		for range f.patterns {
+			sources = append(sources, f.name)
+		}
+	}
+	excludes := ignorePatterns(ic.files)
+	if len(excludes) == 0 {
+		return out, nil
+	}
+	m, err := dockerignore.NewMatcher(excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		stats, err := ref.ReadDir(ctx, client.ReadDirRequest{
+			Path: dir,
+		})
+		if err != nil {
+			return err
+		}
+		for _, st := range stats {
+			p := path.Join(dir, st.Path)
+			idx, excluded, err := m.Match(p)
+			if err != nil {
+				return err
+			}
+			if excluded {
+				out.Files = append(out.Files, ignoredfiles.File{
+					Path:       p,
+					Pattern:    excludes[idx],
+					IgnoreFile: sources[idx],
+				})
+			}
+			// the contents of excluded directories are only listed if they
+			// may be included again
+			if os.FileMode(st.Mode).IsDir() && (!excluded || m.Exclusions()) {
+				if err := walk(p); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk("."); err != nil {
+		return nil, errors.Wrap(err, "failed to list build context")
+	}
+	return out, nil
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"encoding/json"
 
+	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
 	"github.com/moby/buildkit/frontend/gateway/client"
 	"github.com/moby/buildkit/frontend/subrequests"
+	"github.com/moby/buildkit/frontend/subrequests/ignoredfiles"
+	"github.com/moby/buildkit/frontend/subrequests/resolvedconfig"
 	"github.com/moby/buildkit/solver/errdefs"
 )
 
-func checkSubRequest(ctx context.Context, opts map[string]string) (*client.Result, bool, error) {
+func checkSubRequest(ctx context.Context, c client.Client, opts map[string]string, dt []byte, convertOpt dockerfile2llb.ConvertOpt, ic ignoreContext) (*client.Result, bool, error) {
 	req, ok := opts["requestid"]
 	if !ok {
 		return nil, false, nil
@@ -18,6 +21,20 @@ func checkSubRequest(ctx context.Context, opts map[string]string) (*client.Resul
 	case subrequests.RequestSubrequestsDescribe:
 		res, err := describe()
 		return res, true, err
+	case resolvedconfig.RequestResolvedConfig:
+		cfg, err := dockerfile2llb.Dockerfile2ResolvedConfig(ctx, dt, convertOpt)
+		if err != nil {
+			return nil, true, err
+		}
+		res, err := cfg.ToResult()
+		return res, true, err
+	case ignoredfiles.RequestIgnoredFiles:
+		r, err := listIgnoredFiles(ctx, c, ic)
+		if err != nil {
+			return nil, true, err
+		}
+		res, err := r.ToResult()
+		return res, true, err
 	default:
 		return nil, true, errdefs.NewUnsupportedSubrequestError(req)
 	}
@@ -26,6 +43,8 @@ func checkSubRequest(ctx context.Context, opts map[string]string) (*client.Resul
 func describe() (*client.Result, error) {
 	all := []subrequests.Request{
 		subrequests.SubrequestsDescribeDefinition,
+		resolvedconfig.SubrequestsResolvedConfigDefinition,
+		ignoredfiles.SubrequestsIgnoredFilesDefinition,
 	}
 	dt, err := json.MarshalIndent(all, "  ", "")
 	if err != nil {
@@ -0,0 +1,100 @@
+package dockerfile2llb
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/solver/pb"
+)
+
+// Containerfile compatibility mode makes Containerfiles written for Podman
+// and Buildah build without edits:
+//
+// - the "z", "Z" and "relabel" mount options are accepted and ignored
+// - secret mounts are required unless they set required=false
+// - VOLUME creates the directories of the volumes and RUN discards the
+//   changes it makes to them, like the classic Docker builder and
+//   "buildah build --compat-volumes"
+
+// dispatchVolumeDirs creates the directories of the volumes declared by c
+// and records them for the RUN commands of the stage. It returns true if a
+// layer was added.
+func dispatchVolumeDirs(d *dispatchState, c *instructions.VolumeCommand, opt dispatchOpt) (bool, error) {
+	if !useFileOp(opt.buildArgValues, opt.llbCaps) {
+		return false, nil
+	}
+	if d.volumes == nil {
+		d.volumes = map[string]struct{}{}
+	}
+	mkdirOpt := []llb.MkdirOption{llb.WithParents(true)}
+	if user := d.image.Config.User; user != "" {
+		mkdirOpt = append(mkdirOpt, llb.WithUser(user))
+	}
+	var fa *llb.FileAction
+	for _, v := range c.Volumes {
+		p := path.Join("/", filepath.ToSlash(v))
+		if p == "/" {
+			continue
+		}
+		if fa == nil {
+			fa = llb.Mkdir(p, 0755, mkdirOpt...)
+		} else {
+			fa = fa.Mkdir(p, 0755, mkdirOpt...)
+		}
+		d.volumes[p] = struct{}{}
+	}
+	if fa == nil {
+		return false, nil
+	}
+	platform := opt.targetPlatform
+	if d.platform != nil {
+		platform = *d.platform
+	}
+	env, err := d.state.Env(context.TODO())
+	if err != nil {
+		return false, err
+	}
+	d.state = d.state.File(fa,
+		llb.WithCustomName(prefixCommand(d, uppercaseCmd(processCmdEnv(opt.shlex, c.String(), env)), d.prefixPlatform, &platform)),
+		location(opt.sourceMap, c.Location()),
+	)
+	return true, nil
+}
+
+// dispatchVolumeMounts mounts a copy of every volume of the stage so that
+// the changes c makes to the volumes are discarded
+func dispatchVolumeMounts(d *dispatchState, c *instructions.RunCommand, opt dispatchOpt) ([]llb.RunOption, error) {
+	if len(d.volumes) == 0 {
+		return nil, nil
+	}
+	targets := map[string]struct{}{}
+	dir, err := d.state.GetDir(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range instructions.GetMounts(c) {
+		targets[path.Join("/", dir, filepath.ToSlash(m.Target))] = struct{}{}
+	}
+
+	volumes := make([]string, 0, len(d.volumes))
+	for v := range d.volumes {
+		if _, ok := targets[v]; !ok {
+			volumes = append(volumes, v)
+		}
+	}
+	sort.Strings(volumes)
+
+	var out []llb.RunOption
+	for _, v := range volumes {
+		mountOpts := []llb.MountOption{llb.SourcePath(v)}
+		if opt.llbCaps.Supports(pb.CapExecMountBindReadWriteNoOuput) == nil {
+			mountOpts = append(mountOpts, llb.ForceNoOutput)
+		}
+		out = append(out, llb.AddMount(v, d.state, mountOpts...))
+	}
+	return out, nil
+}
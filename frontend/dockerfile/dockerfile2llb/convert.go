@@ -27,6 +27,7 @@ import (
 	"github.com/moby/buildkit/util/suggest"
 	"github.com/moby/buildkit/util/system"
 	"github.com/moby/sys/signal"
+	digest "github.com/opencontainers/go-digest"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
@@ -64,11 +65,75 @@ type ConvertOpt struct {
 	ContextLocalName  string
 	SourceMap         *llb.SourceMap
 	Hostname          string
+	// SSHKnownHosts are known_hosts lines with pinned host keys, keyed by
+	// ssh mount ID
+	SSHKnownHosts map[string]string
+	// Defaults overrides the PATH and shell used per OS when the image
+	// config doesn't set them
+	Defaults system.Defaults
+	// FallbackRefs are equivalent references, e.g. mirror repositories, tried
+	// in order if a base image can't be resolved, keyed by image name
+	FallbackRefs map[string][]string
+	// ContainerfileCompat enables the Podman and Buildah behaviors
+	// Containerfiles may rely on, see compat.go
+	ContainerfileCompat bool
+	// VerboseProgress logs every file of the build context that is
+	// transferred
+	VerboseProgress bool
+	// LocalContexts are named local contexts that stages and COPY --from
+	// refer to by name instead of an image
+	LocalContexts map[string]llb.State
 }
 
 func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State, *Image, error) {
+	if opt.MetaResolver == nil {
+		opt.MetaResolver = imagemetaresolver.Default()
+	}
+
+	res, err := dispatchStages(ctx, dt, opt, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	target := res.target
+
+	if len(opt.Labels) != 0 && target.image.Config.Labels == nil {
+		target.image.Config.Labels = make(map[string]string, len(opt.Labels))
+	}
+	for k, v := range opt.Labels {
+		target.image.Config.Labels[k] = v
+	}
+
+	defaults := []llb.ConstraintsOpt{
+		llb.Platform(res.platformOpt.targetPlatform),
+	}
+	if opt.LLBCaps != nil {
+		defaults = append(defaults, llb.WithCaps(*opt.LLBCaps))
+	}
+	st := target.state.SetMarshalDefaults(defaults...)
+
+	if !res.platformOpt.implicitTarget {
+		target.image.OS = res.platformOpt.targetPlatform.OS
+		target.image.Architecture = res.platformOpt.targetPlatform.Architecture
+		target.image.Variant = res.platformOpt.targetPlatform.Variant
+	}
+
+	return &st, &target.image, nil
+}
+
+// dispatchResult is the result of dispatching the stages of a Dockerfile
+type dispatchResult struct {
+	target      *dispatchState
+	states      *dispatchStates
+	metaArgs    []instructions.KeyValuePairOptional
+	platformOpt *platformOpt
+}
+
+// dispatchStages parses the Dockerfile and dispatches the stages the target
+// depends on, or every stage if allStages is set. Base image configs are
+// only resolved if opt.MetaResolver is set.
+func dispatchStages(ctx context.Context, dt []byte, opt ConvertOpt, allStages bool) (*dispatchResult, error) {
 	if len(dt) == 0 {
-		return nil, nil, errors.Errorf("the Dockerfile cannot be empty")
+		return nil, errors.Errorf("the Dockerfile cannot be empty")
 	}
 
 	if opt.ContextLocalName == "" {
@@ -84,14 +149,14 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 
 	dockerfile, err := parser.Parse(bytes.NewReader(dt))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	proxyEnv := proxyEnvFromBuildArgs(opt.BuildArgs)
 
 	stages, metaArgs, err := instructions.Parse(dockerfile.AST)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	shlex := shell.NewLex(dockerfile.EscapeToken)
@@ -106,9 +171,6 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 	}
 
 	metaResolver := opt.MetaResolver
-	if metaResolver == nil {
-		metaResolver = imagemetaresolver.Default()
-	}
 
 	allDispatchStates := newDispatchStates()
 
@@ -116,10 +178,10 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 	for i, st := range stages {
 		name, err := shlex.ProcessWordWithMap(st.BaseName, metaArgsToMap(optMetaArgs))
 		if err != nil {
-			return nil, nil, parser.WithLocation(err, st.Location)
+			return nil, parser.WithLocation(err, st.Location)
 		}
 		if name == "" {
-			return nil, nil, parser.WithLocation(errors.Errorf("base name (%s) should not be blank", st.BaseName), st.Location)
+			return nil, parser.WithLocation(errors.Errorf("base name (%s) should not be blank", st.BaseName), st.Location)
 		}
 		st.BaseName = name
 
@@ -138,19 +200,19 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 		if v := st.Platform; v != "" {
 			v, err := shlex.ProcessWordWithMap(v, metaArgsToMap(optMetaArgs))
 			if err != nil {
-				return nil, nil, parser.WithLocation(errors.Wrapf(err, "failed to process arguments for platform %s", v), st.Location)
+				return nil, parser.WithLocation(errors.Wrapf(err, "failed to process arguments for platform %s", v), st.Location)
 			}
 
 			p, err := platforms.Parse(v)
 			if err != nil {
-				return nil, nil, parser.WithLocation(errors.Wrapf(err, "failed to parse platform %s", v), st.Location)
+				return nil, parser.WithLocation(errors.Wrapf(err, "failed to parse platform %s", v), st.Location)
 			}
 			ds.platform = &p
 		}
 		allDispatchStates.addState(ds)
 
 		total := 0
-		if ds.stage.BaseName != emptyImageName && ds.base == nil {
+		if _, ok := opt.LocalContexts[ds.stage.BaseName]; !ok && ds.stage.BaseName != emptyImageName && ds.base == nil {
 			total = 1
 		}
 		for _, cmd := range ds.stage.Commands {
@@ -185,7 +247,7 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 		var ok bool
 		target, ok = allDispatchStates.findStateByName(opt.Target)
 		if !ok {
-			return nil, nil, errors.Errorf("target stage %s could not be found", opt.Target)
+			return nil, errors.Errorf("target stage %s could not be found", opt.Target)
 		}
 	}
 
@@ -195,7 +257,7 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 		for i, cmd := range d.stage.Commands {
 			newCmd, err := toCommand(cmd, allDispatchStates)
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
 			d.commands[i] = newCmd
 			for _, src := range newCmd.sources {
@@ -210,7 +272,7 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 	}
 
 	if has, state := hasCircularDependency(allDispatchStates.states); has {
-		return nil, nil, errors.Errorf("circular dependency detected on stage: %s", state.stageName)
+		return nil, errors.Errorf("circular dependency detected on stage: %s", state.stageName)
 	}
 
 	if len(allDispatchStates.states) == 1 {
@@ -226,12 +288,17 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 
 	eg, ctx := errgroup.WithContext(ctx)
 	for i, d := range allDispatchStates.states {
-		reachable := isReachable(target, d)
+		reachable := allStages || isReachable(target, d)
 		// resolve image config for every stage
 		if d.base == nil {
 			if d.stage.BaseName == emptyImageName {
 				d.state = llb.Scratch()
-				d.image = emptyImage(platformOpt.targetPlatform)
+				d.image = emptyImage(platformOpt.targetPlatform, opt.Defaults)
+				continue
+			}
+			if st, ok := opt.LocalContexts[d.stage.BaseName]; ok {
+				d.state = st
+				d.image = emptyImage(platformOpt.targetPlatform, opt.Defaults)
 				continue
 			}
 			func(i int, d *dispatchState) {
@@ -251,6 +318,10 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 						platform = &platformOpt.targetPlatform
 					}
 					d.stage.BaseName = reference.TagNameOnly(ref).String()
+					fallbacks, err := fallbackRefs(opt.FallbackRefs, d.stage.BaseName)
+					if err != nil {
+						return err
+					}
 					var isScratch bool
 					if metaResolver != nil && reachable {
 						prefix := "["
@@ -258,11 +329,24 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 							prefix += platforms.Format(*platform) + " "
 						}
 						prefix += "internal]"
-						dgst, dt, err := metaResolver.ResolveImageConfig(ctx, d.stage.BaseName, llb.ResolveImageConfigOpt{
-							Platform:    platform,
-							ResolveMode: opt.ImageResolveMode.String(),
-							LogName:     fmt.Sprintf("%s load metadata for %s", prefix, d.stage.BaseName),
-						})
+						var dgst digest.Digest
+						var dt []byte
+						// try the equivalent refs in order until one resolves
+						for i, r := range append([]reference.Named{ref}, fallbacks...) {
+							name := reference.TagNameOnly(r).String()
+							dgst, dt, err = metaResolver.ResolveImageConfig(ctx, name, llb.ResolveImageConfigOpt{
+								Platform:    platform,
+								ResolveMode: opt.ImageResolveMode.String(),
+								LogName:     fmt.Sprintf("%s load metadata for %s", prefix, name),
+							})
+							if err == nil {
+								if i > 0 {
+									fallbacks = append(append([]reference.Named{ref}, fallbacks[:i-1]...), fallbacks[i:]...)
+									ref = r
+								}
+								break
+							}
+						}
 						if err != nil {
 							return suggest.WrapError(errors.Wrap(err, origName), origName, append(allStageNames, commonImageNames()...), true)
 						}
@@ -282,6 +366,11 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 							if err != nil {
 								return err
 							}
+							for i, r := range fallbacks {
+								if fallbacks[i], err = reference.WithDigest(r, dgst); err != nil {
+									return err
+								}
+							}
 						}
 						d.stage.BaseName = ref.String()
 						if len(img.RootFS.DiffIDs) == 0 {
@@ -302,6 +391,7 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 							dfCmd(d.stage.SourceCode),
 							llb.Platform(*platform),
 							opt.ImageResolveMode,
+							llb.WithFallbackRefs(refStrings(fallbacks)...),
 							llb.WithCustomName(prefixCommand(d, "FROM "+d.stage.BaseName, opt.PrefixPlatform, platform)),
 							location(opt.SourceMap, d.stage.Location),
 						)
@@ -314,20 +404,26 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 	}
 
 	if err := eg.Wait(); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	buildContext := &mutableOutput{}
 	ctxPaths := map[string]struct{}{}
 
 	for _, d := range allDispatchStates.states {
-		if !isReachable(target, d) {
+		if !allStages && !isReachable(target, d) {
 			continue
 		}
 		if d.base != nil {
 			d.state = d.base.state
 			d.platform = d.base.platform
 			d.image = clone(d.base.image)
+			for v := range d.base.volumes {
+				if d.volumes == nil {
+					d.volumes = map[string]struct{}{}
+				}
+				d.volumes[v] = struct{}{}
+			}
 		}
 
 		// make sure that PATH is always set
@@ -336,7 +432,7 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 			if d.platform != nil {
 				os = d.platform.OS
 			}
-			d.image.Config.Env = append(d.image.Config.Env, "PATH="+system.DefaultPathEnv(os))
+			d.image.Config.Env = append(d.image.Config.Env, "PATH="+opt.Defaults.DefaultPathEnv(os))
 		}
 
 		// initialize base metadata from image conf
@@ -349,44 +445,47 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 		}
 		if d.image.Config.WorkingDir != "" {
 			if err = dispatchWorkdir(d, &instructions.WorkdirCommand{Path: d.image.Config.WorkingDir}, false, nil); err != nil {
-				return nil, nil, parser.WithLocation(err, d.stage.Location)
+				return nil, parser.WithLocation(err, d.stage.Location)
 			}
 		}
 		if d.image.Config.User != "" {
 			if err = dispatchUser(d, &instructions.UserCommand{User: d.image.Config.User}, false); err != nil {
-				return nil, nil, parser.WithLocation(err, d.stage.Location)
+				return nil, parser.WithLocation(err, d.stage.Location)
 			}
 		}
 		d.state = d.state.Network(opt.ForceNetMode)
 
 		opt := dispatchOpt{
-			allDispatchStates: allDispatchStates,
-			metaArgs:          optMetaArgs,
-			buildArgValues:    opt.BuildArgs,
-			shlex:             shlex,
-			sessionID:         opt.SessionID,
-			buildContext:      llb.NewState(buildContext),
-			proxyEnv:          proxyEnv,
-			cacheIDNamespace:  opt.CacheIDNamespace,
-			buildPlatforms:    platformOpt.buildPlatforms,
-			targetPlatform:    platformOpt.targetPlatform,
-			extraHosts:        opt.ExtraHosts,
-			copyImage:         opt.OverrideCopyImage,
-			llbCaps:           opt.LLBCaps,
-			sourceMap:         opt.SourceMap,
+			allDispatchStates:   allDispatchStates,
+			metaArgs:            optMetaArgs,
+			buildArgValues:      opt.BuildArgs,
+			shlex:               shlex,
+			sessionID:           opt.SessionID,
+			buildContext:        llb.NewState(buildContext),
+			proxyEnv:            proxyEnv,
+			cacheIDNamespace:    opt.CacheIDNamespace,
+			buildPlatforms:      platformOpt.buildPlatforms,
+			targetPlatform:      platformOpt.targetPlatform,
+			extraHosts:          opt.ExtraHosts,
+			copyImage:           opt.OverrideCopyImage,
+			llbCaps:             opt.LLBCaps,
+			sourceMap:           opt.SourceMap,
+			sshKnownHosts:       opt.SSHKnownHosts,
+			defaults:            opt.Defaults,
+			containerfileCompat: opt.ContainerfileCompat,
 		}
 		if opt.copyImage == "" {
 			opt.copyImage = DefaultCopyImage
 		}
 
 		if err = dispatchOnBuildTriggers(d, d.image.Config.OnBuild, opt); err != nil {
-			return nil, nil, parser.WithLocation(err, d.stage.Location)
+			return nil, parser.WithLocation(err, d.stage.Location)
 		}
 		d.image.Config.OnBuild = nil
 
 		for _, cmd := range d.commands {
 			if err := dispatch(d, cmd, opt); err != nil {
-				return nil, nil, parser.WithLocation(err, cmd.Location())
+				return nil, parser.WithLocation(err, cmd.Location())
 			}
 		}
 
@@ -395,13 +494,6 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 		}
 	}
 
-	if len(opt.Labels) != 0 && target.image.Config.Labels == nil {
-		target.image.Config.Labels = make(map[string]string, len(opt.Labels))
-	}
-	for k, v := range opt.Labels {
-		target.image.Config.Labels[k] = v
-	}
-
 	opts := []llb.LocalOption{
 		llb.SessionID(opt.SessionID),
 		llb.ExcludePatterns(opt.Excludes),
@@ -411,6 +503,9 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 	if includePatterns := normalizeContextPaths(ctxPaths); includePatterns != nil {
 		opts = append(opts, llb.FollowPaths(includePatterns))
 	}
+	if opt.VerboseProgress {
+		opts = append(opts, llb.VerboseProgress())
+	}
 
 	bc := llb.Local(opt.ContextLocalName, opts...)
 	if opt.BuildContext != nil {
@@ -418,21 +513,12 @@ func Dockerfile2LLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State,
 	}
 	buildContext.Output = bc.Output()
 
-	defaults := []llb.ConstraintsOpt{
-		llb.Platform(platformOpt.targetPlatform),
-	}
-	if opt.LLBCaps != nil {
-		defaults = append(defaults, llb.WithCaps(*opt.LLBCaps))
-	}
-	st := target.state.SetMarshalDefaults(defaults...)
-
-	if !platformOpt.implicitTarget {
-		target.image.OS = platformOpt.targetPlatform.OS
-		target.image.Architecture = platformOpt.targetPlatform.Architecture
-		target.image.Variant = platformOpt.targetPlatform.Variant
-	}
-
-	return &st, &target.image, nil
+	return &dispatchResult{
+		target:      target,
+		states:      allDispatchStates,
+		metaArgs:    optMetaArgs,
+		platformOpt: platformOpt,
+	}, nil
 }
 
 func metaArgsToMap(metaArgs []instructions.KeyValuePairOptional) map[string]string {
@@ -478,20 +564,23 @@ func toCommand(ic instructions.Command, allDispatchStates *dispatchStates) (comm
 }
 
 type dispatchOpt struct {
-	allDispatchStates *dispatchStates
-	metaArgs          []instructions.KeyValuePairOptional
-	buildArgValues    map[string]string
-	shlex             *shell.Lex
-	sessionID         string
-	buildContext      llb.State
-	proxyEnv          *llb.ProxyEnv
-	cacheIDNamespace  string
-	targetPlatform    ocispecs.Platform
-	buildPlatforms    []ocispecs.Platform
-	extraHosts        []llb.HostIP
-	copyImage         string
-	llbCaps           *apicaps.CapSet
-	sourceMap         *llb.SourceMap
+	allDispatchStates   *dispatchStates
+	metaArgs            []instructions.KeyValuePairOptional
+	buildArgValues      map[string]string
+	shlex               *shell.Lex
+	sessionID           string
+	buildContext        llb.State
+	proxyEnv            *llb.ProxyEnv
+	cacheIDNamespace    string
+	targetPlatform      ocispecs.Platform
+	buildPlatforms      []ocispecs.Platform
+	extraHosts          []llb.HostIP
+	copyImage           string
+	llbCaps             *apicaps.CapSet
+	sourceMap           *llb.SourceMap
+	sshKnownHosts       map[string]string
+	defaults            system.Defaults
+	containerfileCompat bool
 }
 
 func dispatch(d *dispatchState, cmd command, opt dispatchOpt) error {
@@ -532,9 +621,9 @@ func dispatch(d *dispatchState, cmd command, opt dispatchOpt) error {
 	case *instructions.OnbuildCommand:
 		err = dispatchOnbuild(d, c)
 	case *instructions.CmdCommand:
-		err = dispatchCmd(d, c)
+		err = dispatchCmd(d, c, opt)
 	case *instructions.EntrypointCommand:
-		err = dispatchEntrypoint(d, c)
+		err = dispatchEntrypoint(d, c, opt)
 	case *instructions.HealthCheckCommand:
 		err = dispatchHealthcheck(d, c)
 	case *instructions.ExposeCommand:
@@ -542,7 +631,7 @@ func dispatch(d *dispatchState, cmd command, opt dispatchOpt) error {
 	case *instructions.UserCommand:
 		err = dispatchUser(d, c, true)
 	case *instructions.VolumeCommand:
-		err = dispatchVolume(d, c)
+		err = dispatchVolume(d, c, opt)
 	case *instructions.StopSignalCommand:
 		err = dispatchStopSignal(d, c)
 	case *instructions.ShellCommand:
@@ -582,6 +671,9 @@ type dispatchState struct {
 	cmdIndex       int
 	cmdTotal       int
 	prefixPlatform bool
+	// volumes are the paths declared with VOLUME in Containerfile
+	// compatibility mode
+	volumes map[string]struct{}
 }
 
 type dispatchStates struct {
@@ -718,7 +810,7 @@ func dispatchRun(d *dispatchState, c *instructions.RunCommand, proxy *llb.ProxyE
 		}
 	}
 	if c.PrependShell {
-		args = withShell(d.image, args)
+		args = withShell(d.image, args, dopt.defaults)
 	}
 
 	env, err := d.state.Env(context.TODO())
@@ -726,9 +818,15 @@ func dispatchRun(d *dispatchState, c *instructions.RunCommand, proxy *llb.ProxyE
 		return err
 	}
 	opt = append(opt, llb.Args(args), dfCmd(c), location(dopt.sourceMap, c.Location()))
-	if d.ignoreCache {
+	if d.ignoreCache || instructions.GetNoCache(c) {
 		opt = append(opt, llb.IgnoreCache)
 	}
+	if ttl := instructions.GetCacheTTL(c); ttl > 0 {
+		if dopt.llbCaps != nil && dopt.llbCaps.Supports(pb.CapMetaCacheTTL) != nil {
+			return errors.Wrap(dopt.llbCaps.Supports(pb.CapMetaCacheTTL), "cache-ttl is not supported")
+		}
+		opt = append(opt, llb.CacheTTL(ttl))
+	}
 	if proxy != nil {
 		opt = append(opt, llb.WithProxy(*proxy))
 	}
@@ -739,6 +837,14 @@ func dispatchRun(d *dispatchState, c *instructions.RunCommand, proxy *llb.ProxyE
 	}
 	opt = append(opt, runMounts...)
 
+	if dopt.containerfileCompat {
+		volumeMounts, err := dispatchVolumeMounts(d, c, dopt)
+		if err != nil {
+			return err
+		}
+		opt = append(opt, volumeMounts...)
+	}
+
 	securityOpt, err := dispatchRunSecurity(c)
 	if err != nil {
 		return err
@@ -1080,10 +1186,10 @@ func dispatchOnbuild(d *dispatchState, c *instructions.OnbuildCommand) error {
 	return nil
 }
 
-func dispatchCmd(d *dispatchState, c *instructions.CmdCommand) error {
+func dispatchCmd(d *dispatchState, c *instructions.CmdCommand, opt dispatchOpt) error {
 	var args []string = c.CmdLine
 	if c.PrependShell {
-		args = withShell(d.image, args)
+		args = withShell(d.image, args, opt.defaults)
 	}
 	d.image.Config.Cmd = args
 	d.image.Config.ArgsEscaped = true
@@ -1091,10 +1197,10 @@ func dispatchCmd(d *dispatchState, c *instructions.CmdCommand) error {
 	return commitToHistory(&d.image, fmt.Sprintf("CMD %q", args), false, nil)
 }
 
-func dispatchEntrypoint(d *dispatchState, c *instructions.EntrypointCommand) error {
+func dispatchEntrypoint(d *dispatchState, c *instructions.EntrypointCommand, opt dispatchOpt) error {
 	var args []string = c.CmdLine
 	if c.PrependShell {
-		args = withShell(d.image, args)
+		args = withShell(d.image, args, opt.defaults)
 	}
 	d.image.Config.Entrypoint = args
 	if !d.cmdSet {
@@ -1153,7 +1259,7 @@ func dispatchUser(d *dispatchState, c *instructions.UserCommand, commit bool) er
 	return nil
 }
 
-func dispatchVolume(d *dispatchState, c *instructions.VolumeCommand) error {
+func dispatchVolume(d *dispatchState, c *instructions.VolumeCommand, opt dispatchOpt) error {
 	if d.image.Config.Volumes == nil {
 		d.image.Config.Volumes = map[string]struct{}{}
 	}
@@ -1163,7 +1269,15 @@ func dispatchVolume(d *dispatchState, c *instructions.VolumeCommand) error {
 		}
 		d.image.Config.Volumes[v] = struct{}{}
 	}
-	return commitToHistory(&d.image, fmt.Sprintf("VOLUME %v", c.Volumes), false, nil)
+	withLayer := false
+	if opt.containerfileCompat {
+		var err error
+		withLayer, err = dispatchVolumeDirs(d, c, opt)
+		if err != nil {
+			return err
+		}
+	}
+	return commitToHistory(&d.image, fmt.Sprintf("VOLUME %v", c.Volumes), withLayer, nil)
 }
 
 func dispatchStopSignal(d *dispatchState, c *instructions.StopSignalCommand) error {
@@ -1450,12 +1564,12 @@ type mutableOutput struct {
 	llb.Output
 }
 
-func withShell(img Image, args []string) []string {
+func withShell(img Image, args []string, defaults system.Defaults) []string {
 	var shell []string
 	if len(img.Config.Shell) > 0 {
 		shell = append([]string{}, img.Config.Shell...)
 	} else {
-		shell = defaultShell(img.OS)
+		shell = defaults.DefaultShell(img.OS)
 	}
 	return append(shell, strings.Join(args, " "))
 }
@@ -1555,3 +1669,33 @@ func commonImageNames() []string {
 	}
 	return out
 }
+
+// fallbackRefs returns the equivalent references configured for a base image
+func fallbackRefs(m map[string][]string, name string) ([]reference.Named, error) {
+	var out []reference.Named
+	for k, refs := range m {
+		kr, err := reference.ParseNormalizedNamed(k)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid fallback image name %s", k)
+		}
+		if reference.TagNameOnly(kr).String() != name {
+			continue
+		}
+		for _, v := range refs {
+			r, err := reference.ParseNormalizedNamed(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid fallback ref %s for %s", v, k)
+			}
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func refStrings(refs []reference.Named) []string {
+	out := make([]string, 0, len(refs))
+	for _, r := range refs {
+		out = append(out, r.String())
+	}
+	return out
+}
@@ -82,9 +82,20 @@ func setCacheUIDGID(m *instructions.Mount, st llb.State, fileop bool) llb.State
 
 func dispatchRunMounts(d *dispatchState, c *instructions.RunCommand, sources []*dispatchState, opt dispatchOpt) ([]llb.RunOption, error) {
 	var out []llb.RunOption
+	var knownHosts []string
 	mounts := instructions.GetMounts(c)
 
 	for i, mount := range mounts {
+		if mount.Relabel != "" && !opt.containerfileCompat {
+			// mounts are never relabeled, Containerfiles may request it for
+			// Podman
+			return nil, errors.Errorf("mount option relabel is only supported in Containerfile compatibility mode")
+		}
+		if mount.Type == instructions.MountTypeSecret && mount.Required == nil && opt.containerfileCompat {
+			// Podman and Buildah fail the build if a secret is missing
+			required := true
+			mount.Required = &required
+		}
 		if mount.From == "" && mount.Type == instructions.MountTypeCache {
 			mount.From = emptyImageName
 		}
@@ -111,6 +122,11 @@ func dispatchRunMounts(d *dispatchState, c *instructions.RunCommand, sources []*
 				return nil, err
 			}
 			out = append(out, ssh)
+			lines, err := sshKnownHosts(mount, opt.sshKnownHosts)
+			if err != nil {
+				return nil, err
+			}
+			knownHosts = append(knownHosts, lines...)
 			continue
 		}
 		if mount.ReadOnly {
@@ -157,5 +173,13 @@ func dispatchRunMounts(d *dispatchState, c *instructions.RunCommand, sources []*
 			d.ctxPaths[path.Join("/", filepath.ToSlash(mount.Source))] = struct{}{}
 		}
 	}
+
+	if len(knownHosts) > 0 {
+		kh, err := dispatchSSHKnownHosts(knownHosts, opt)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, kh)
+	}
 	return out, nil
 }
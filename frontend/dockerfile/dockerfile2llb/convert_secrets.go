@@ -28,7 +28,7 @@ func dispatchSecret(m *instructions.Mount) (llb.RunOption, error) {
 
 	opts := []llb.SecretOption{llb.SecretID(id)}
 
-	if !m.Required {
+	if m.Required == nil || !*m.Required {
 		opts = append(opts, llb.SecretOptional)
 	}
 
@@ -1,6 +1,8 @@
 package dockerfile2llb
 
 import (
+	"strings"
+
 	"github.com/moby/buildkit/client/llb"
 	"github.com/moby/buildkit/frontend/dockerfile/instructions"
 	"github.com/pkg/errors"
@@ -16,7 +18,7 @@ func dispatchSSH(m *instructions.Mount) (llb.RunOption, error) {
 		opts = append(opts, llb.SSHSocketTarget(m.Target))
 	}
 
-	if !m.Required {
+	if m.Required == nil || !*m.Required {
 		opts = append(opts, llb.SSHOptional)
 	}
 
@@ -38,3 +40,45 @@ func dispatchSSH(m *instructions.Mount) (llb.RunOption, error) {
 
 	return llb.AddSSHSocket(opts...), nil
 }
+
+// sshKnownHostsPath is the system-wide known_hosts file read by OpenSSH for
+// every user
+const sshKnownHostsPath = "/etc/ssh/ssh_known_hosts"
+
+// sshKnownHosts returns the pinned host keys of an ssh mount, from both the
+// frontend options and the mount options
+func sshKnownHosts(m *instructions.Mount, knownHosts map[string]string) ([]string, error) {
+	id := m.CacheID
+	if id == "" {
+		id = "default"
+	}
+	var lines []string
+	for _, v := range append([]string{knownHosts[id]}, m.KnownHosts...) {
+		for _, l := range strings.Split(v, "\n") {
+			l = strings.TrimSpace(l)
+			if l == "" || strings.HasPrefix(l, "#") {
+				continue
+			}
+			fields := strings.Fields(l)
+			if strings.HasPrefix(fields[0], "@") {
+				fields = fields[1:]
+			}
+			if len(fields) < 3 {
+				return nil, errors.Errorf("invalid known_hosts entry %q for ssh %s, expected \"<hosts> <keytype> <key>\"", l, id)
+			}
+			lines = append(lines, l)
+		}
+	}
+	return lines, nil
+}
+
+// dispatchSSHKnownHosts mounts a known_hosts file with the pinned host keys
+// of all ssh mounts of a step
+func dispatchSSHKnownHosts(lines []string, opt dispatchOpt) (llb.RunOption, error) {
+	if !useFileOp(opt.buildArgValues, opt.llbCaps) {
+		return nil, errors.Errorf("ssh known hosts are not supported by the daemon")
+	}
+	dt := []byte(strings.Join(lines, "\n") + "\n")
+	st := llb.Scratch().File(llb.Mkfile("/ssh_known_hosts", 0644, dt), WithInternalName("ssh known hosts"))
+	return llb.AddMount(sshKnownHostsPath, st, llb.SourcePath("/ssh_known_hosts"), llb.Readonly), nil
+}
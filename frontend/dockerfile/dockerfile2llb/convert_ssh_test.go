@@ -0,0 +1,35 @@
+package dockerfile2llb
+
+import (
+	"testing"
+
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSHKnownHosts(t *testing.T) {
+	opt := map[string]string{
+		"default": "# pinned keys\ngithub.com ssh-ed25519 AAAA1\n\n@cert-authority *.example.com ssh-rsa AAAA2\n",
+		"other":   "gitlab.com ssh-rsa AAAA3",
+	}
+
+	lines, err := sshKnownHosts(&instructions.Mount{Type: instructions.MountTypeSSH, KnownHosts: []string{"bitbucket.org ssh-rsa AAAA4"}}, opt)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"github.com ssh-ed25519 AAAA1",
+		"@cert-authority *.example.com ssh-rsa AAAA2",
+		"bitbucket.org ssh-rsa AAAA4",
+	}, lines)
+
+	lines, err = sshKnownHosts(&instructions.Mount{Type: instructions.MountTypeSSH, CacheID: "other"}, opt)
+	require.NoError(t, err)
+	require.Equal(t, []string{"gitlab.com ssh-rsa AAAA3"}, lines)
+
+	lines, err = sshKnownHosts(&instructions.Mount{Type: instructions.MountTypeSSH, CacheID: "none"}, opt)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(lines))
+
+	_, err = sshKnownHosts(&instructions.Mount{Type: instructions.MountTypeSSH, KnownHosts: []string{"github.com AAAA1"}}, opt)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid known_hosts entry")
+}
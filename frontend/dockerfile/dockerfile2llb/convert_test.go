@@ -1,11 +1,21 @@
 package dockerfile2llb
 
 import (
+	"context"
+	"encoding/json"
+	"strings"
 	"testing"
 
+	"github.com/moby/buildkit/client/llb"
 	"github.com/moby/buildkit/frontend/dockerfile/instructions"
 	"github.com/moby/buildkit/frontend/dockerfile/shell"
+	"github.com/moby/buildkit/solver/pb"
+	apicapspb "github.com/moby/buildkit/util/apicaps/pb"
 	"github.com/moby/buildkit/util/appcontext"
+	"github.com/moby/buildkit/util/system"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -80,6 +90,68 @@ COPY --from=0 f2 /
 	assert.Error(t, err)
 }
 
+func TestDockerfileDefaults(t *testing.T) {
+	t.Parallel()
+	df := `FROM scratch
+CMD echo hello
+`
+	_, img, err := Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{
+		Defaults: system.Defaults{
+			PathEnv: map[string]string{"linux": "/busybox"},
+			Shell:   map[string][]string{"linux": {"/busybox/sh", "-c"}},
+		},
+		TargetPlatform: &ocispecs.Platform{OS: "linux", Architecture: "amd64"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"PATH=/busybox"}, img.Config.Env)
+	assert.Equal(t, []string{"/busybox/sh", "-c", "echo hello"}, img.Config.Cmd)
+}
+
+type fallbackResolver struct {
+	fail string
+}
+
+func (r *fallbackResolver) ResolveImageConfig(ctx context.Context, ref string, opt llb.ResolveImageConfigOpt) (digest.Digest, []byte, error) {
+	if ref == r.fail {
+		return "", nil, errors.Errorf("failed to resolve %s", ref)
+	}
+	img := Image{}
+	img.RootFS.Type = "layers"
+	img.RootFS.DiffIDs = []digest.Digest{digest.FromBytes([]byte("layer"))}
+	dt, err := json.Marshal(img)
+	return digest.FromBytes([]byte("config")), dt, err
+}
+
+func TestDockerfileFallbackRefs(t *testing.T) {
+	t.Parallel()
+	df := `FROM alpine
+RUN true
+`
+	dgst := digest.FromBytes([]byte("config"))
+	st, _, err := Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{
+		MetaResolver: &fallbackResolver{fail: "docker.io/library/alpine:latest"},
+		FallbackRefs: map[string][]string{
+			"alpine": {"mirror.example.com/alpine"},
+		},
+	})
+	assert.NoError(t, err)
+
+	def, err := st.Marshal(appcontext.Context())
+	assert.NoError(t, err)
+
+	var found bool
+	for _, dt := range def.Def {
+		var op pb.Op
+		assert.NoError(t, op.Unmarshal(dt))
+		if src := op.GetSource(); src != nil && strings.HasPrefix(src.Identifier, "docker-image://") {
+			found = true
+			assert.Equal(t, "docker-image://mirror.example.com/alpine@"+dgst.String(), src.Identifier)
+			assert.Equal(t, "docker.io/library/alpine@"+dgst.String(), src.Attrs[pb.AttrImageFallbackRefs])
+		}
+	}
+	assert.True(t, found)
+}
+
 func TestAddEnv(t *testing.T) {
 	// k exists in env as key
 	// override = true
@@ -188,3 +260,216 @@ COPY --from=stage1 f2 /sub/
 	_, _, err = Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{})
 	assert.EqualError(t, err, "circular dependency detected on stage: stage0")
 }
+
+func TestDockerfileContainerfileCompat(t *testing.T) {
+	t.Parallel()
+	df := `FROM scratch
+VOLUME /data
+RUN --mount=type=bind,target=/src,z touch /data/foo
+`
+	_, _, err := Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "relabel is only supported in Containerfile compatibility mode")
+
+	caps := pb.Caps.CapSet(pb.Caps.All())
+	st, _, err := Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{
+		LLBCaps:             &caps,
+		ContainerfileCompat: true,
+	})
+	assert.NoError(t, err)
+
+	def, err := st.Marshal(appcontext.Context())
+	assert.NoError(t, err)
+
+	var mkdir, mount bool
+	for _, dt := range def.Def {
+		var op pb.Op
+		assert.NoError(t, op.Unmarshal(dt))
+		if f := op.GetFile(); f != nil {
+			for _, a := range f.Actions {
+				if m := a.GetMkdir(); m != nil && m.Path == "/data" {
+					mkdir = true
+				}
+			}
+		}
+		if e := op.GetExec(); e != nil {
+			for _, m := range e.Mounts {
+				if m.Dest == "/data" {
+					mount = true
+					assert.Equal(t, "/data", m.Selector)
+					assert.Equal(t, pb.SkipOutput, m.Output)
+				}
+			}
+		}
+	}
+	assert.True(t, mkdir)
+	assert.True(t, mount)
+}
+
+func TestDockerfileContainerfileCompatSecrets(t *testing.T) {
+	t.Parallel()
+	df := `FROM scratch
+RUN --mount=type=secret,id=foo --mount=type=secret,id=bar,required=false true
+`
+	optional := func(compat bool) map[string]bool {
+		caps := pb.Caps.CapSet(pb.Caps.All())
+		st, _, err := Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{
+			LLBCaps:             &caps,
+			ContainerfileCompat: compat,
+		})
+		assert.NoError(t, err)
+
+		def, err := st.Marshal(appcontext.Context())
+		assert.NoError(t, err)
+
+		out := map[string]bool{}
+		for _, dt := range def.Def {
+			var op pb.Op
+			assert.NoError(t, op.Unmarshal(dt))
+			if e := op.GetExec(); e != nil {
+				for _, m := range e.Mounts {
+					if m.SecretOpt != nil {
+						out[m.SecretOpt.ID] = m.SecretOpt.Optional
+					}
+				}
+			}
+		}
+		return out
+	}
+	assert.Equal(t, map[string]bool{"foo": true, "bar": true}, optional(false))
+	// secrets are required by default in compatibility mode
+	assert.Equal(t, map[string]bool{"foo": false, "bar": true}, optional(true))
+}
+
+func TestDockerfileRunNoCache(t *testing.T) {
+	t.Parallel()
+	df := `FROM scratch
+RUN --no-cache date > /a
+RUN cat /a
+`
+	st, _, err := Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{})
+	assert.NoError(t, err)
+
+	def, err := st.Marshal(appcontext.Context())
+	assert.NoError(t, err)
+
+	ignored := map[string]bool{}
+	for dgst, md := range def.Metadata {
+		for _, dt := range def.Def {
+			if digest.FromBytes(dt) != dgst {
+				continue
+			}
+			var op pb.Op
+			assert.NoError(t, op.Unmarshal(dt))
+			if e := op.GetExec(); e != nil {
+				ignored[strings.Join(e.Meta.Args, " ")] = md.IgnoreCache
+			}
+		}
+	}
+	assert.Equal(t, 2, len(ignored))
+	assert.True(t, ignored["/bin/sh -c date > /a"])
+	assert.False(t, ignored["/bin/sh -c cat /a"])
+}
+
+func TestDockerfileRunCacheTTL(t *testing.T) {
+	t.Parallel()
+	df := `FROM scratch
+RUN --cache-ttl=24h apt-get update
+RUN apt-get install -y curl
+`
+	st, _, err := Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{})
+	assert.NoError(t, err)
+
+	def, err := st.Marshal(appcontext.Context())
+	assert.NoError(t, err)
+
+	ttls := map[string]int64{}
+	for dgst, md := range def.Metadata {
+		for _, dt := range def.Def {
+			if digest.FromBytes(dt) != dgst {
+				continue
+			}
+			var op pb.Op
+			assert.NoError(t, op.Unmarshal(dt))
+			if e := op.GetExec(); e != nil {
+				ttls[strings.Join(e.Meta.Args, " ")] = md.CacheTtl
+			}
+		}
+	}
+	assert.Equal(t, 2, len(ttls))
+	assert.Equal(t, int64(86400), ttls["/bin/sh -c apt-get update"])
+	assert.Equal(t, int64(0), ttls["/bin/sh -c apt-get install -y curl"])
+}
+
+func TestDockerfileRunCacheTTLUnsupported(t *testing.T) {
+	t.Parallel()
+	df := `FROM scratch
+RUN --cache-ttl=24h apt-get update
+`
+	var all []apicapspb.APICap
+	for _, c := range pb.Caps.All() {
+		if c.ID != string(pb.CapMetaCacheTTL) {
+			all = append(all, c)
+		}
+	}
+	caps := pb.Caps.CapSet(all)
+	_, _, err := Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{
+		LLBCaps: &caps,
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cache-ttl is not supported")
+}
+
+func TestDockerfileLocalContexts(t *testing.T) {
+	t.Parallel()
+	df := `FROM foo AS base
+RUN cat /a
+
+FROM scratch
+COPY --from=foo /b /b
+`
+	st, _, err := Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{
+		LocalContexts: map[string]llb.State{
+			"foo": llb.Local("foo-local", llb.ExcludePatterns([]string{"*.tmp"})),
+		},
+		Target: "base",
+	})
+	assert.NoError(t, err)
+
+	def, err := st.Marshal(appcontext.Context())
+	assert.NoError(t, err)
+
+	var locals, images []string
+	for _, dt := range def.Def {
+		var op pb.Op
+		assert.NoError(t, op.Unmarshal(dt))
+		if src := op.GetSource(); src != nil {
+			if strings.HasPrefix(src.Identifier, "local://") {
+				locals = append(locals, src.Identifier)
+				assert.Equal(t, `["*.tmp"]`, src.Attrs[pb.AttrExcludePatterns])
+			} else {
+				images = append(images, src.Identifier)
+			}
+		}
+	}
+	assert.Equal(t, []string{"local://foo-local"}, locals)
+	assert.Equal(t, 0, len(images))
+
+	st, _, err = Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{
+		LocalContexts: map[string]llb.State{
+			"foo": llb.Local("foo-local"),
+		},
+	})
+	assert.NoError(t, err)
+	def, err = st.Marshal(appcontext.Context())
+	assert.NoError(t, err)
+	locals = nil
+	for _, dt := range def.Def {
+		var op pb.Op
+		assert.NoError(t, op.Unmarshal(dt))
+		if src := op.GetSource(); src != nil && strings.HasPrefix(src.Identifier, "local://") {
+			locals = append(locals, src.Identifier)
+		}
+	}
+	assert.Equal(t, []string{"local://foo-local"}, locals)
+}
@@ -1,8 +0,0 @@
-package dockerfile2llb
-
-func defaultShell(os string) []string {
-	if os == "windows" {
-		return []string{"cmd", "/S", "/C"}
-	}
-	return []string{"/bin/sh", "-c"}
-}
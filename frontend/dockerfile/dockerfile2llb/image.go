@@ -64,7 +64,7 @@ func clone(src Image) Image {
 	return img
 }
 
-func emptyImage(platform ocispecs.Platform) Image {
+func emptyImage(platform ocispecs.Platform, defaults system.Defaults) Image {
 	img := Image{
 		Image: ocispecs.Image{
 			Architecture: platform.Architecture,
@@ -74,6 +74,6 @@ func emptyImage(platform ocispecs.Platform) Image {
 	}
 	img.RootFS.Type = "layers"
 	img.Config.WorkingDir = "/"
-	img.Config.Env = []string{"PATH=" + system.DefaultPathEnv(platform.OS)}
+	img.Config.Env = []string{"PATH=" + defaults.DefaultPathEnv(platform.OS)}
 	return img
 }
@@ -0,0 +1,59 @@
+package dockerfile2llb
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/moby/buildkit/frontend/dockerfile/shell"
+)
+
+// BaseImages returns the frontend image of the syntax directive of the
+// Dockerfile dt and the images its stages are based on, with the meta args
+// expanded with buildArgs. Stages based on other stages or scratch and base
+// names that don't expand to an image, e.g. because they use the platform
+// args, are skipped.
+func BaseImages(dt []byte, buildArgs map[string]string) (syntax string, images []string, err error) {
+	syntax, _, _, _ = DetectSyntax(bytes.NewReader(dt))
+
+	dockerfile, err := parser.Parse(bytes.NewReader(dt))
+	if err != nil {
+		return "", nil, err
+	}
+	stages, metaArgs, err := instructions.Parse(dockerfile.AST)
+	if err != nil {
+		return "", nil, err
+	}
+
+	shlex := shell.NewLex(dockerfile.EscapeToken)
+	var optMetaArgs []instructions.KeyValuePairOptional
+	for _, cmd := range metaArgs {
+		for _, metaArg := range cmd.Args {
+			if metaArg.Value != nil {
+				*metaArg.Value, _ = shlex.ProcessWordWithMap(*metaArg.Value, metaArgsToMap(optMetaArgs))
+			}
+			optMetaArgs = append(optMetaArgs, setKVValue(metaArg, buildArgs))
+		}
+	}
+
+	stageNames := map[string]struct{}{}
+	seen := map[string]struct{}{}
+	for _, st := range stages {
+		name, err := shlex.ProcessWordWithMap(st.BaseName, metaArgsToMap(optMetaArgs))
+		if err != nil {
+			return "", nil, parser.WithLocation(err, st.Location)
+		}
+		_, isStage := stageNames[strings.ToLower(name)]
+		_, isSeen := seen[name]
+		if st.Name != "" {
+			stageNames[st.Name] = struct{}{}
+		}
+		if name == "" || name == emptyImageName || isStage || isSeen {
+			continue
+		}
+		seen[name] = struct{}{}
+		images = append(images, name)
+	}
+	return syntax, images, nil
+}
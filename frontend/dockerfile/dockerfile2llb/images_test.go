@@ -0,0 +1,33 @@
+package dockerfile2llb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaseImages(t *testing.T) {
+	dt := []byte(`# syntax=docker/dockerfile:1.4
+ARG GO_VERSION=1.19
+ARG DISTRO
+FROM golang:${GO_VERSION} AS build
+FROM build AS test
+FROM --platform=$BUILDPLATFORM tonistiigi/xx AS xx
+FROM scratch AS empty
+FROM ${DISTRO}
+FROM golang:${GO_VERSION}
+`)
+	syntax, images, err := BaseImages(dt, nil)
+	require.NoError(t, err)
+	require.Equal(t, "docker/dockerfile:1.4", syntax)
+	require.Equal(t, []string{"golang:1.19", "tonistiigi/xx"}, images)
+
+	_, images, err = BaseImages(dt, map[string]string{"GO_VERSION": "1.20", "DISTRO": "alpine:3.17"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"golang:1.20", "tonistiigi/xx", "alpine:3.17"}, images)
+
+	syntax, images, err = BaseImages([]byte("FROM busybox\n"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "", syntax)
+	require.Equal(t, []string{"busybox"}, images)
+}
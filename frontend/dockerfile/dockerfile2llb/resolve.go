@@ -0,0 +1,70 @@
+package dockerfile2llb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/frontend/subrequests/resolvedconfig"
+	"github.com/moby/buildkit/util/redact"
+)
+
+// Dockerfile2ResolvedConfig returns the build args and environment of every
+// stage of the Dockerfile after ARG and ENV substitution, as seen by the
+// build steps. The environment of base images is only included if
+// opt.MetaResolver is set. Values that may contain secrets are masked.
+func Dockerfile2ResolvedConfig(ctx context.Context, dt []byte, opt ConvertOpt) (*resolvedconfig.Config, error) {
+	res, err := dispatchStages(ctx, dt, opt, true)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &resolvedconfig.Config{
+		Target:   opt.Target,
+		Platform: platforms.Format(res.platformOpt.targetPlatform),
+	}
+	for _, arg := range res.metaArgs {
+		cfg.Args = append(cfg.Args, newVar(arg.Key, arg.Value))
+	}
+	sort.Slice(cfg.Args, func(i, j int) bool {
+		return cfg.Args[i].Key < cfg.Args[j].Key
+	})
+
+	for i, d := range res.states.states {
+		if d.unregistered {
+			continue
+		}
+		st := resolvedconfig.Stage{
+			Name:     d.stage.Name,
+			Base:     d.stage.BaseName,
+			Platform: cfg.Platform,
+		}
+		if st.Name == "" {
+			st.Name = fmt.Sprintf("stage-%d", i)
+		}
+		if d.platform != nil {
+			st.Platform = platforms.Format(*d.platform)
+		}
+		for _, arg := range d.buildArgs {
+			st.Args = append(st.Args, newVar(arg.Key, arg.Value))
+		}
+		for _, env := range d.image.Config.Env {
+			k, v := parseKeyValue(env)
+			st.Env = append(st.Env, newVar(k, &v))
+		}
+		cfg.Stages = append(cfg.Stages, st)
+	}
+	return cfg, nil
+}
+
+func newVar(k string, v *string) resolvedconfig.Var {
+	out := resolvedconfig.Var{Key: k}
+	if v == nil {
+		return out
+	}
+	s, masked := redact.Value(k, *v)
+	out.Value = &s
+	out.Masked = masked
+	return out
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
 	gateway "github.com/moby/buildkit/frontend/gateway/client"
 	"github.com/moby/buildkit/frontend/subrequests"
+	"github.com/moby/buildkit/frontend/subrequests/ignoredfiles"
 	"github.com/moby/buildkit/identity"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/session/upload/uploadprovider"
@@ -68,6 +69,7 @@ var allTests = []integration.Test{
 	testUser,
 	testCacheReleased,
 	testDockerignore,
+	testDockerignoreExtraFiles,
 	testDockerignoreInvalid,
 	testDockerfileFromGit,
 	testMultiStageImplicitFrom,
@@ -2814,6 +2816,112 @@ Dockerfile
 	require.Equal(t, "bay-contents", string(dt))
 }
 
+func testDockerignoreExtraFiles(t *testing.T, sb integration.Sandbox) {
+	f := getFrontend(t, sb)
+
+	dockerfile := []byte(`
+FROM scratch
+COPY . .
+`)
+
+	dir, err := tmpdir(
+		fstest.CreateFile("Dockerfile", dockerfile, 0600),
+		fstest.CreateFile("foo", []byte(`foo-contents`), 0600),
+		fstest.CreateFile("bar", []byte(`bar-contents`), 0600),
+		fstest.CreateFile("baz", []byte(`baz-contents`), 0600),
+		fstest.CreateFile(".dockerignore", []byte("ba*\n.dockerignore*\n"), 0600),
+		fstest.CreateFile(".dockerignore.ci", []byte("foo\n!baz\n"), 0600),
+	)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c, err := client.New(sb.Context(), sb.Address())
+	require.NoError(t, err)
+	defer c.Close()
+
+	destDir, err := ioutil.TempDir("", "buildkit")
+	require.NoError(t, err)
+	defer os.RemoveAll(destDir)
+
+	_, err = f.Solve(sb.Context(), c, client.SolveOpt{
+		FrontendAttrs: map[string]string{
+			"ignorefile": ".dockerignore.ci",
+		},
+		Exports: []client.ExportEntry{
+			{
+				Type:      client.ExporterLocal,
+				OutputDir: destDir,
+			},
+		},
+		LocalDirs: map[string]string{
+			builder.DefaultLocalNameDockerfile: dir,
+			builder.DefaultLocalNameContext:    dir,
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	for _, name := range []string{"foo", "bar", ".dockerignore", ".dockerignore.ci"} {
+		_, err = os.Stat(filepath.Join(destDir, name))
+		require.Error(t, err)
+		require.True(t, errors.Is(err, os.ErrNotExist))
+	}
+
+	dt, err := ioutil.ReadFile(filepath.Join(destDir, "baz"))
+	require.NoError(t, err)
+	require.Equal(t, "baz-contents", string(dt))
+
+	_, err = f.Solve(sb.Context(), c, client.SolveOpt{
+		FrontendAttrs: map[string]string{
+			"ignorefile": ".dockerignore.notexist",
+		},
+		LocalDirs: map[string]string{
+			builder.DefaultLocalNameDockerfile: dir,
+			builder.DefaultLocalNameContext:    dir,
+		},
+	}, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), ".dockerignore.notexist")
+
+	if _, ok := f.(*clientFrontend); !ok {
+		// the subrequest is sent to the builtin frontend, only run it once
+		return
+	}
+
+	frontend := func(ctx context.Context, c gateway.Client) (*gateway.Result, error) {
+		res, err := c.Solve(ctx, gateway.SolveRequest{
+			FrontendOpt: map[string]string{
+				"requestid":     "frontend.ignoredfiles",
+				"frontend.caps": "moby.buildkit.frontend.subrequests",
+				"ignorefile":    ".dockerignore.ci",
+			},
+			Frontend: "dockerfile.v0",
+		})
+		if err != nil {
+			return nil, err
+		}
+		var ignored ignoredfiles.Result
+		if err := json.Unmarshal(res.Metadata["result.json"], &ignored); err != nil {
+			return nil, err
+		}
+		require.Equal(t, []string{".dockerignore", ".dockerignore.ci"}, ignored.IgnoreFiles)
+		require.Equal(t, []ignoredfiles.File{
+			{Path: ".dockerignore", Pattern: ".dockerignore*", IgnoreFile: ".dockerignore"},
+			{Path: ".dockerignore.ci", Pattern: ".dockerignore*", IgnoreFile: ".dockerignore"},
+			{Path: "bar", Pattern: "ba*", IgnoreFile: ".dockerignore"},
+			{Path: "foo", Pattern: "foo", IgnoreFile: ".dockerignore.ci"},
+		}, ignored.Files)
+		return nil, nil
+	}
+
+	_, err = c.Build(sb.Context(), client.SolveOpt{
+		LocalDirs: map[string]string{
+			builder.DefaultLocalNameDockerfile: dir,
+			builder.DefaultLocalNameContext:    dir,
+		},
+	}, "", frontend, nil)
+	require.NoError(t, err)
+}
+
 func testDockerignoreInvalid(t *testing.T, sb integration.Sandbox) {
 	f := getFrontend(t, sb)
 
@@ -0,0 +1,67 @@
+package dockerignore
+
+import (
+	"github.com/docker/docker/pkg/fileutils"
+)
+
+// Matcher finds the pattern that decides whether a path is excluded. Like in
+// the build context transfer, the patterns are evaluated in order and the last
+// pattern matching the path or one of its parent directories wins.
+type Matcher struct {
+	patterns   []matcherPattern
+	exclusions bool
+}
+
+type matcherPattern struct {
+	pm        *fileutils.PatternMatcher
+	exclusion bool
+}
+
+// NewMatcher returns a Matcher for the patterns returned by ReadAll
+func NewMatcher(patterns []string) (*Matcher, error) {
+	m := &Matcher{
+		patterns: make([]matcherPattern, 0, len(patterns)),
+	}
+	for _, p := range patterns {
+		// every pattern is matched on its own so that the matching one is
+		// known, "!" patterns are matched without the prefix
+		exclusion := len(p) > 0 && p[0] == '!'
+		if exclusion {
+			if _, err := fileutils.NewPatternMatcher([]string{p}); err != nil {
+				return nil, err
+			}
+			p = p[1:]
+			m.exclusions = true
+		}
+		pm, err := fileutils.NewPatternMatcher([]string{p})
+		if err != nil {
+			return nil, err
+		}
+		m.patterns = append(m.patterns, matcherPattern{pm: pm, exclusion: exclusion})
+	}
+	return m, nil
+}
+
+// Match returns the index of the last pattern matching p, or -1 if no pattern
+// matches, and whether p is excluded from the context.
+func (m *Matcher) Match(p string) (int, bool, error) {
+	idx := -1
+	for i, mp := range m.patterns {
+		ok, err := mp.pm.Matches(p)
+		if err != nil {
+			return -1, false, err
+		}
+		if ok {
+			idx = i
+		}
+	}
+	if idx == -1 {
+		return -1, false, nil
+	}
+	return idx, !m.patterns[idx].exclusion, nil
+}
+
+// Exclusions returns true if any of the patterns re-includes paths with "!"
+func (m *Matcher) Exclusions() bool {
+	return m.exclusions
+}
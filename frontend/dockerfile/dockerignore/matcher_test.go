@@ -0,0 +1,41 @@
+package dockerignore
+
+import (
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	m, err := NewMatcher([]string{"ba*", "Dockerfile", "!bay", "docs", "!docs/README.md", "bay"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Exclusions() {
+		t.Fatal("Expected exclusions")
+	}
+
+	for _, tc := range []struct {
+		path     string
+		idx      int
+		excluded bool
+	}{
+		{"foo", -1, false},
+		{"bar", 0, true},
+		{"Dockerfile", 1, true},
+		{"bay", 5, true},
+		{"docs/index.md", 3, true},
+		{"docs/README.md", 4, false},
+		{"foo/bar", -1, false},
+	} {
+		idx, excluded, err := m.Match(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if idx != tc.idx || excluded != tc.excluded {
+			t.Fatalf("Expected %s to match pattern %d (excluded %v), got %d (excluded %v)", tc.path, tc.idx, tc.excluded, idx, excluded)
+		}
+	}
+
+	if _, err := NewMatcher([]string{"!"}); err == nil {
+		t.Fatal("Expected error for illegal exclusion pattern")
+	}
+}
@@ -0,0 +1,51 @@
+package instructions
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var cacheTTLKey = "dockerfile/run/cachettl"
+
+func init() {
+	parseRunPreHooks = append(parseRunPreHooks, runCacheTTLPreHook)
+	parseRunPostHooks = append(parseRunPostHooks, runCacheTTLPostHook)
+}
+
+func runCacheTTLPreHook(cmd *RunCommand, req parseRequest) error {
+	st := &cacheTTLState{}
+	st.flag = req.flags.AddString("cache-ttl", "")
+	cmd.setExternalValue(cacheTTLKey, st)
+	return nil
+}
+
+func runCacheTTLPostHook(cmd *RunCommand, req parseRequest) error {
+	st, ok := cmd.getExternalValue(cacheTTLKey).(*cacheTTLState)
+	if !ok {
+		return errors.Errorf("no cachettl state")
+	}
+	if st.flag.Value == "" {
+		return nil
+	}
+	ttl, err := time.ParseDuration(st.flag.Value)
+	if err != nil {
+		return errors.Wrapf(err, "invalid cache-ttl %q", st.flag.Value)
+	}
+	if ttl < time.Second {
+		return errors.Errorf("invalid cache-ttl %q, needs to be at least 1s", st.flag.Value)
+	}
+	st.ttl = ttl
+	return nil
+}
+
+// GetCacheTTL returns the duration after which the cache of the command
+// expires, or 0 if it doesn't expire
+func GetCacheTTL(cmd *RunCommand) time.Duration {
+	return cmd.getExternalValue(cacheTTLKey).(*cacheTTLState).ttl
+}
+
+type cacheTTLState struct {
+	flag *Flag
+	ttl  time.Duration
+}
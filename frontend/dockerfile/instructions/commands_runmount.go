@@ -39,6 +39,7 @@ type mountsKeyT string
 var mountsKey = mountsKeyT("dockerfile/run/mounts")
 
 func init() {
+	registerFeature("run --mount", "docker/dockerfile:1.2", true)
 	parseRunPreHooks = append(parseRunPreHooks, runMountPreHook)
 	parseRunPostHooks = append(parseRunPostHooks, runMountPostHook)
 }
@@ -125,10 +126,19 @@ type Mount struct {
 	ReadOnly     bool
 	CacheID      string
 	CacheSharing string
-	Required     bool
+	// Required is nil if the mount doesn't set it. Secrets and ssh sockets
+	// are optional by default and required by default in Containerfile
+	// compatibility mode.
+	Required *bool
 	Mode         *uint64
 	UID          *uint64
 	GID          *uint64
+	// KnownHosts are known_hosts lines with the pinned host keys for ssh
+	// mounts
+	KnownHosts []string
+	// Relabel is the SELinux relabeling requested with the Podman specific
+	// "z", "Z" or "relabel" options
+	Relabel string
 }
 
 func parseMount(value string, expander SingleWordExpander) (*Mount, error) {
@@ -141,6 +151,9 @@ func parseMount(value string, expander SingleWordExpander) (*Mount, error) {
 	m := &Mount{Type: MountTypeBind}
 
 	roAuto := true
+	// requiredType is the type the required option is validated for. It is
+	// empty if the type is only known once the values are expanded.
+	requiredType := m.Type
 
 	for _, field := range fields {
 		parts := strings.SplitN(field, "=", 2)
@@ -157,12 +170,17 @@ func parseMount(value string, expander SingleWordExpander) (*Mount, error) {
 				roAuto = false
 				continue
 			case "required":
-				if m.Type == "secret" || m.Type == "ssh" {
-					m.Required = true
-					continue
+				required := true
+				m.Required = &required
+				continue
+			case "z":
+				// "z" and "Z" are case sensitive
+				if parts[0] == "Z" {
+					m.Relabel = "private"
 				} else {
-					return nil, errors.Errorf("unexpected key '%s' for mount type '%s'", key, m.Type)
+					m.Relabel = "shared"
 				}
+				continue
 			}
 		}
 
@@ -186,6 +204,12 @@ func parseMount(value string, expander SingleWordExpander) (*Mount, error) {
 			}
 		} else {
 			// if we don't have an expander, defer evaluation to later
+			if key == "type" {
+				requiredType = ""
+				if !strings.Contains(value, "$") {
+					requiredType = strings.ToLower(value)
+				}
+			}
 			continue
 		}
 
@@ -195,6 +219,7 @@ func parseMount(value string, expander SingleWordExpander) (*Mount, error) {
 				return nil, suggest.WrapError(errors.Errorf("unsupported mount type %q", value), value, allMountTypes(), true)
 			}
 			m.Type = strings.ToLower(value)
+			requiredType = m.Type
 		case "from":
 			m.From = value
 		case "source", "src":
@@ -215,15 +240,11 @@ func parseMount(value string, expander SingleWordExpander) (*Mount, error) {
 			m.ReadOnly = !rw
 			roAuto = false
 		case "required":
-			if m.Type == "secret" || m.Type == "ssh" {
-				v, err := strconv.ParseBool(value)
-				if err != nil {
-					return nil, errors.Errorf("invalid value for %s: %s", key, value)
-				}
-				m.Required = v
-			} else {
-				return nil, errors.Errorf("unexpected key '%s' for mount type '%s'", key, m.Type)
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, errors.Errorf("invalid value for %s: %s", key, value)
 			}
+			m.Required = &v
 		case "id":
 			m.CacheID = value
 		case "sharing":
@@ -249,9 +270,16 @@ func parseMount(value string, expander SingleWordExpander) (*Mount, error) {
 				return nil, errors.Errorf("invalid value %s for gid", value)
 			}
 			m.GID = &gid
+		case "knownhosts":
+			m.KnownHosts = append(m.KnownHosts, value)
+		case "relabel":
+			if value != "shared" && value != "private" {
+				return nil, errors.Errorf("unsupported relabel value %q", value)
+			}
+			m.Relabel = value
 		default:
 			allKeys := []string{
-				"type", "from", "source", "target", "readonly", "id", "sharing", "required", "mode", "uid", "gid", "src", "dst", "ro", "rw", "readwrite",
+				"type", "from", "source", "target", "readonly", "id", "sharing", "required", "mode", "uid", "gid", "src", "dst", "ro", "rw", "readwrite", "knownhosts", "relabel",
 			}
 			return nil, suggest.WrapError(errors.Errorf("unexpected key '%s' in '%s'", key, field), key, allKeys, true)
 		}
@@ -271,6 +299,14 @@ func parseMount(value string, expander SingleWordExpander) (*Mount, error) {
 		return nil, errors.Errorf("gid not allowed for %q type mounts", m.Type)
 	}
 
+	if m.Required != nil && requiredType != "" && requiredType != MountTypeSecret && requiredType != MountTypeSSH {
+		return nil, errors.Errorf("unexpected key 'required' for mount type '%s'", requiredType)
+	}
+
+	if len(m.KnownHosts) > 0 && m.Type != MountTypeSSH {
+		return nil, errors.Errorf("knownhosts not allowed for %q type mounts", m.Type)
+	}
+
 	if roAuto {
 		if m.Type == MountTypeCache || m.Type == MountTypeTmpfs {
 			m.ReadOnly = false
@@ -24,6 +24,7 @@ func isValidNetwork(value string) bool {
 var networkKey = "dockerfile/run/network"
 
 func init() {
+	registerFeature("run --network", "docker/dockerfile:1.3", true)
 	parseRunPreHooks = append(parseRunPreHooks, runNetworkPreHook)
 	parseRunPostHooks = append(parseRunPostHooks, runNetworkPostHook)
 }
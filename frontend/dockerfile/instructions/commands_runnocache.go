@@ -0,0 +1,39 @@
+package instructions
+
+import (
+	"github.com/pkg/errors"
+)
+
+var noCacheKey = "dockerfile/run/nocache"
+
+func init() {
+	parseRunPreHooks = append(parseRunPreHooks, runNoCachePreHook)
+	parseRunPostHooks = append(parseRunPostHooks, runNoCachePostHook)
+}
+
+func runNoCachePreHook(cmd *RunCommand, req parseRequest) error {
+	st := &noCacheState{}
+	st.flag = req.flags.AddBool("no-cache", false)
+	cmd.setExternalValue(noCacheKey, st)
+	return nil
+}
+
+func runNoCachePostHook(cmd *RunCommand, req parseRequest) error {
+	st, ok := cmd.getExternalValue(noCacheKey).(*noCacheState)
+	if !ok {
+		return errors.Errorf("no nocache state")
+	}
+	st.noCache = st.flag.IsTrue()
+	return nil
+}
+
+// GetNoCache returns true if the command always runs instead of using the
+// build cache
+func GetNoCache(cmd *RunCommand) bool {
+	return cmd.getExternalValue(noCacheKey).(*noCacheState).noCache
+}
+
+type noCacheState struct {
+	flag    *Flag
+	noCache bool
+}
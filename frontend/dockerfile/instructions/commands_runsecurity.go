@@ -24,6 +24,7 @@ func isValidSecurity(value string) bool {
 var securityKey = "dockerfile/run/security"
 
 func init() {
+	registerFeature("run --security", "docker/dockerfile:1.3-labs", true)
 	parseRunPreHooks = append(parseRunPreHooks, runSecurityPreHook)
 	parseRunPostHooks = append(parseRunPostHooks, runSecurityPostHook)
 }
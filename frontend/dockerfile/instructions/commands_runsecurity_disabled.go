@@ -0,0 +1,7 @@
+// +build !dfrunsecurity
+
+package instructions
+
+func init() {
+	registerFeature("run --security", "docker/dockerfile:1.3-labs", false)
+}
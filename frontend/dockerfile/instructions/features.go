@@ -0,0 +1,75 @@
+package instructions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// feature is an instruction flag that was added in a later frontend release
+type feature struct {
+	// minSyntax is the first frontend image supporting the flag
+	minSyntax string
+	// enabled is false if this frontend was built without the flag, e.g.
+	// without the labs features
+	enabled bool
+}
+
+// features are the registered flags, keyed by "<instruction> --<flag>" in
+// lowercase. The files of the flags register them, disabled flags are
+// registered by the files built without them, so that users are pointed at
+// an upgrade when they use a flag this frontend doesn't know.
+var features = map[string]feature{}
+
+func registerFeature(key, minSyntax string, enabled bool) {
+	features[key] = feature{minSyntax: minSyntax, enabled: enabled}
+}
+
+func init() {
+	registerFeature("copy --chmod", "docker/dockerfile:1.2", true)
+	registerFeature("add --chmod", "docker/dockerfile:1.2", true)
+}
+
+// UnsupportedFeatureError is returned when an instruction or flag is not
+// supported by this frontend but is by a newer version of it
+type UnsupportedFeatureError struct {
+	// Feature is the instruction, optionally followed by the flag, e.g.
+	// "RUN --security"
+	Feature string
+	// MinSyntax is the first frontend image that supports the feature
+	MinSyntax string
+	error
+}
+
+func (e *UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("%s requires %s or later, set \"# syntax=%s\" on the first line of the Dockerfile: %v", e.Feature, e.MinSyntax, e.MinSyntax, e.error)
+}
+
+func (e *UnsupportedFeatureError) Unwrap() error {
+	return e.error
+}
+
+// UnknownFlag represents an error occurring when an instruction flag is not
+// defined
+type UnknownFlag struct {
+	Flag string
+}
+
+func (e *UnknownFlag) Error() string {
+	return fmt.Sprintf("unknown flag: %s", e.Flag)
+}
+
+// withUpgradeHint turns errors for unknown flags into UnsupportedFeatureError
+// if the flag is registered as disabled
+func withUpgradeHint(instruction string, err error) error {
+	var uf *UnknownFlag
+	if !errors.As(err, &uf) {
+		return err
+	}
+	f, ok := features[strings.ToLower(instruction)+" --"+uf.Flag]
+	if !ok || f.enabled {
+		return err
+	}
+	return &UnsupportedFeatureError{Feature: strings.ToUpper(instruction) + " --" + uf.Flag, MinSyntax: f.minSyntax, error: err}
+}
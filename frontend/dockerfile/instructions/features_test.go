@@ -0,0 +1,46 @@
+package instructions
+
+import (
+	"testing"
+
+	"github.com/moby/buildkit/util/suggest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithUpgradeHint(t *testing.T) {
+	registerFeature("run --labs-test", "docker/dockerfile:1.9-labs", false)
+	defer delete(features, "run --labs-test")
+
+	err := withUpgradeHint("run", suggest.WrapError(&UnknownFlag{Flag: "labs-test"}, "labs-test", []string{"mount", "network"}, true))
+	var ue *UnsupportedFeatureError
+	require.True(t, errors.As(err, &ue))
+	require.Equal(t, "RUN --labs-test", ue.Feature)
+	require.Equal(t, "docker/dockerfile:1.9-labs", ue.MinSyntax)
+	require.Contains(t, err.Error(), `set "# syntax=docker/dockerfile:1.9-labs"`)
+	require.Contains(t, err.Error(), "unknown flag: labs-test")
+
+	var uf *UnknownFlag
+	require.True(t, errors.As(err, &uf))
+
+	// flags of this frontend are never unknown
+	err = withUpgradeHint("run", &UnknownFlag{Flag: "mount"})
+	require.False(t, errors.As(err, &ue))
+
+	err = withUpgradeHint("run", &UnknownFlag{Flag: "foo"})
+	require.False(t, errors.As(err, &ue))
+	require.EqualError(t, err, "unknown flag: foo")
+
+	err = withUpgradeHint("copy", errors.New("other"))
+	require.False(t, errors.As(err, &ue))
+
+	require.NoError(t, withUpgradeHint("run", nil))
+}
+
+func TestFeatures(t *testing.T) {
+	for key, f := range features {
+		require.Contains(t, key, " --")
+		require.NotEmpty(t, f.minSyntax, key)
+	}
+	require.True(t, features["run --mount"].enabled)
+}
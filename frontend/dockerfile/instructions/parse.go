@@ -61,7 +61,7 @@ func newParseRequestFromNode(node *parser.Node) parseRequest {
 // ParseInstruction converts an AST to a typed instruction (either a command or a build stage beginning when encountering a `FROM` statement)
 func ParseInstruction(node *parser.Node) (v interface{}, err error) {
 	defer func() {
-		err = parser.WithLocation(err, node.Location())
+		err = parser.WithLocation(withUpgradeHint(node.Value, err), node.Location())
 	}()
 	req := newParseRequestFromNode(node)
 	switch strings.ToLower(node.Value) {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/moby/buildkit/frontend/dockerfile/command"
 	"github.com/moby/buildkit/frontend/dockerfile/parser"
@@ -239,3 +240,106 @@ func TestRunCmdFlagsUsed(t *testing.T) {
 	require.IsType(t, c, &RunCommand{})
 	require.Equal(t, []string{"mount"}, c.(*RunCommand).FlagsUsed)
 }
+
+func TestRunMountSSHKnownHosts(t *testing.T) {
+	expand := func(word string) (string, error) {
+		return strings.Replace(word, "$KEY", "github.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl", 1), nil
+	}
+	m, err := parseMount(`type=ssh,"knownhosts=$KEY",knownhosts=gitlab.com ssh-rsa AAAA`, expand)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(m.KnownHosts))
+	require.True(t, strings.HasPrefix(m.KnownHosts[0], "github.com ssh-ed25519 "))
+	require.Equal(t, "gitlab.com ssh-rsa AAAA", m.KnownHosts[1])
+
+	_, err = parseMount("type=secret,knownhosts=gitlab.com ssh-rsa AAAA", expand)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "knownhosts not allowed")
+}
+
+func TestRunMountRequiredAndRelabel(t *testing.T) {
+	expand := func(word string) (string, error) {
+		return word, nil
+	}
+	// mounts are parsed before and after the expansion of the values
+	for _, ex := range []SingleWordExpander{nil, expand} {
+		m, err := parseMount("type=secret,id=foo,required,z", ex)
+		require.NoError(t, err)
+		require.True(t, *m.Required)
+		require.Equal(t, "shared", m.Relabel)
+
+		_, err = parseMount("required,type=bind,target=/src", ex)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unexpected key 'required'")
+	}
+
+	m, err := parseMount("type=secret,id=foo", expand)
+	require.NoError(t, err)
+	require.Nil(t, m.Required)
+
+	m, err = parseMount("type=ssh,required=false", expand)
+	require.NoError(t, err)
+	require.False(t, *m.Required)
+
+	// the type isn't known before the expansion
+	_, err = parseMount("type=$TYPE,required", nil)
+	require.NoError(t, err)
+
+	m, err = parseMount("type=bind,target=/src,Z", expand)
+	require.NoError(t, err)
+	require.Equal(t, "private", m.Relabel)
+
+	m, err = parseMount("type=cache,target=/cache,relabel=shared", expand)
+	require.NoError(t, err)
+	require.Equal(t, "shared", m.Relabel)
+
+	_, err = parseMount("type=bind,target=/src,relabel=foo", expand)
+	require.Error(t, err)
+
+	_, err = parseMount("type=bind,target=/src,required", expand)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unexpected key 'required'")
+}
+
+func TestRunNoCache(t *testing.T) {
+	for dockerfile, expected := range map[string]bool{
+		"RUN echo hello":                  false,
+		"RUN --no-cache echo hello":       true,
+		"RUN --no-cache=true echo hello":  true,
+		"RUN --no-cache=false echo hello": false,
+	} {
+		ast, err := parser.Parse(strings.NewReader(dockerfile))
+		require.NoError(t, err)
+
+		c, err := ParseInstruction(ast.AST.Children[0])
+		require.NoError(t, err)
+		require.Equal(t, expected, GetNoCache(c.(*RunCommand)), dockerfile)
+	}
+}
+
+func TestRunCacheTTL(t *testing.T) {
+	for dockerfile, expected := range map[string]time.Duration{
+		"RUN apt-get update":                 0,
+		"RUN --cache-ttl=24h apt-get update": 24 * time.Hour,
+		"RUN --cache-ttl=90m apt-get update": 90 * time.Minute,
+	} {
+		ast, err := parser.Parse(strings.NewReader(dockerfile))
+		require.NoError(t, err)
+
+		c, err := ParseInstruction(ast.AST.Children[0])
+		require.NoError(t, err)
+		require.Equal(t, expected, GetCacheTTL(c.(*RunCommand)), dockerfile)
+	}
+
+	for _, dockerfile := range []string{
+		"RUN --cache-ttl=1 apt-get update",
+		"RUN --cache-ttl=-1h apt-get update",
+		"RUN --cache-ttl=1ms apt-get update",
+	} {
+		ast, err := parser.Parse(strings.NewReader(dockerfile))
+		require.NoError(t, err)
+
+		_, err = ParseInstruction(ast.AST.Children[0])
+		require.Error(t, err, dockerfile)
+		require.Contains(t, err.Error(), "invalid cache-ttl", dockerfile)
+	}
+}
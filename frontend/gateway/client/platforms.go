@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// PlatformResult is the result of building a single platform of a
+// PlatformMatrix
+type PlatformResult struct {
+	Ref Reference
+	// ImageConfig is the JSON image config for the platform, optional
+	ImageConfig []byte
+	// InlineCache is the inline cache metadata for the platform, optional
+	InlineCache []byte
+}
+
+// PlatformBuildFunc builds the result for one platform
+type PlatformBuildFunc func(ctx context.Context, p ocispecs.Platform) (*PlatformResult, error)
+
+// BuildPlatforms calls f for every platform of the matrix in parallel and
+// assembles the results. A matrix with multiple platforms, or any matrix if
+// multiPlatform is set, produces a result with a ref per platform and the
+// platform mapping read by the image exporters. Otherwise the single platform
+// is returned as the default ref. An empty matrix builds the default platform.
+func BuildPlatforms(ctx context.Context, m llb.PlatformMatrix, multiPlatform bool, f PlatformBuildFunc) (*Result, error) {
+	if len(m) == 0 {
+		m = llb.PlatformMatrix{platforms.DefaultSpec()}
+	}
+	multiPlatform = multiPlatform || len(m) > 1
+
+	results := make([]*PlatformResult, len(m))
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, p := range m {
+		func(i int, p ocispecs.Platform) {
+			eg.Go(func() error {
+				r, err := f(ctx, p)
+				if err != nil {
+					return errors.Wrapf(err, "failed to build for %s", platforms.Format(p))
+				}
+				if r == nil {
+					return errors.Errorf("no result for %s", platforms.Format(p))
+				}
+				results[i] = r
+				return nil
+			})
+		}(i, p)
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	res := NewResult()
+	if !multiPlatform {
+		r := results[0]
+		res.SetRef(r.Ref)
+		if r.ImageConfig != nil {
+			res.AddMeta(exptypes.ExporterImageConfigKey, r.ImageConfig)
+		}
+		if r.InlineCache != nil {
+			res.AddMeta(exptypes.ExporterInlineCache, r.InlineCache)
+		}
+		return res, nil
+	}
+
+	expPlatforms := &exptypes.Platforms{
+		Platforms: make([]exptypes.Platform, len(m)),
+	}
+	for i, r := range results {
+		k := m.Key(i)
+		res.AddRef(k, r.Ref)
+		if r.ImageConfig != nil {
+			res.AddMeta(fmt.Sprintf("%s/%s", exptypes.ExporterImageConfigKey, k), r.ImageConfig)
+		}
+		if r.InlineCache != nil {
+			res.AddMeta(fmt.Sprintf("%s/%s", exptypes.ExporterInlineCache, k), r.InlineCache)
+		}
+		expPlatforms.Platforms[i] = exptypes.Platform{
+			ID:       k,
+			Platform: m[i],
+		}
+	}
+	dt, err := json.Marshal(expPlatforms)
+	if err != nil {
+		return nil, err
+	}
+	res.AddMeta(exptypes.ExporterPlatformsKey, dt)
+	return res, nil
+}
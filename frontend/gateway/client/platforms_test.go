@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildPlatforms(t *testing.T) {
+	m, err := llb.ParsePlatformMatrix("linux/amd64,linux/arm64")
+	require.NoError(t, err)
+
+	f := func(ctx context.Context, p ocispecs.Platform) (*PlatformResult, error) {
+		return &PlatformResult{ImageConfig: []byte(p.Architecture)}, nil
+	}
+
+	res, err := BuildPlatforms(context.TODO(), m, false, f)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res.Refs))
+	require.Equal(t, "arm64", string(res.Metadata[exptypes.ExporterImageConfigKey+"/linux/arm64"]))
+
+	var p exptypes.Platforms
+	require.NoError(t, json.Unmarshal(res.Metadata[exptypes.ExporterPlatformsKey], &p))
+	require.Equal(t, 2, len(p.Platforms))
+	require.Equal(t, "linux/amd64", p.Platforms[0].ID)
+	require.Equal(t, "arm64", p.Platforms[1].Platform.Architecture)
+
+	res, err = BuildPlatforms(context.TODO(), m[:1], false, f)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(res.Refs))
+	require.Equal(t, "amd64", string(res.Metadata[exptypes.ExporterImageConfigKey]))
+	require.Nil(t, res.Metadata[exptypes.ExporterPlatformsKey])
+
+	res, err = BuildPlatforms(context.TODO(), m[:1], true, f)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res.Refs))
+	require.NotNil(t, res.Metadata[exptypes.ExporterPlatformsKey])
+
+	_, err = BuildPlatforms(context.TODO(), m, false, func(ctx context.Context, p ocispecs.Platform) (*PlatformResult, error) {
+		if p.Architecture == "arm64" {
+			return nil, errors.New("unsupported")
+		}
+		return &PlatformResult{}, nil
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to build for linux/arm64: unsupported")
+}
@@ -55,6 +55,7 @@ func NewContainer(ctx context.Context, w worker.Worker, sm *session.Manager, g s
 		id:       req.ContainerID,
 		netMode:  req.NetMode,
 		platform: platform,
+		defaults: utilsystem.DefaultsFromLabels(w.Labels()),
 		executor: w.Executor(),
 		errGroup: eg,
 		ctx:      ctx,
@@ -263,6 +264,7 @@ func PrepareMounts(ctx context.Context, mm *mounts.MountManager, cm cache.Manage
 			mws.Dest = dest
 			mws.Readonly = m.Readonly
 			mws.Selector = m.Selector
+			mws.MountType = m.MountType
 			p.Mounts = append(p.Mounts, mws)
 		}
 	}
@@ -279,6 +281,7 @@ type gatewayContainer struct {
 	id       string
 	netMode  opspb.NetMode
 	platform opspb.Platform
+	defaults utilsystem.Defaults
 	rootFS   executor.Mount
 	mounts   []executor.Mount
 	executor executor.Executor
@@ -310,7 +313,7 @@ func (gwCtr *gatewayContainer) Start(ctx context.Context, req client.StartReques
 	if procInfo.Meta.Cwd == "" {
 		procInfo.Meta.Cwd = "/"
 	}
-	procInfo.Meta.Env = addDefaultEnvvar(procInfo.Meta.Env, "PATH", utilsystem.DefaultPathEnv(gwCtr.platform.OS))
+	procInfo.Meta.Env = addDefaultEnvvar(procInfo.Meta.Env, "PATH", gwCtr.defaults.DefaultPathEnv(gwCtr.platform.OS))
 	if req.Tty {
 		procInfo.Meta.Env = addDefaultEnvvar(procInfo.Meta.Env, "TERM", "xterm")
 	}
@@ -265,6 +265,9 @@ func (gf *gatewayFrontend) Solve(ctx context.Context, llbBridge frontend.Fronten
 		lbf.mu.Lock()
 		if lbf.err == nil {
 			lbf.result = nil
+			if !errdefs.IsCanceled(err) {
+				err = errdefs.WithCode(err, errdefs.CodeFrontendCrash)
+			}
 			lbf.err = err
 		}
 		lbf.mu.Unlock()
@@ -529,7 +532,7 @@ func (lbf *llbBridgeForwarder) wrapSolveError(solveErr error) error {
 		}
 		subject = sce.ToSubject()
 	}
-	return errdefs.WithSolveError(solveErr, subject, inputIDs, mountIDs)
+	return errdefs.WithSolveError(llberrdefs.WithErrorCode(solveErr), subject, inputIDs, mountIDs)
 }
 
 func (lbf *llbBridgeForwarder) registerResultIDs(results ...solver.Result) (ids []string, err error) {
@@ -0,0 +1,57 @@
+package ignoredfiles
+
+import (
+	"encoding/json"
+
+	"github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/moby/buildkit/frontend/subrequests"
+)
+
+const RequestIgnoredFiles = "frontend.ignoredfiles"
+
+var SubrequestsIgnoredFilesDefinition = subrequests.Request{
+	Name:        RequestIgnoredFiles,
+	Version:     "1.0.0",
+	Type:        subrequests.TypeRPC,
+	Description: "List the files of the build context that are excluded by the ignore files and the pattern excluding them",
+	Opts: []subrequests.Named{
+		{
+			Name:        "ignorefile",
+			Description: "Comma separated additional ignore files of the build context",
+		},
+		{
+			Name:        "ignorefile:*",
+			Description: "Comma separated additional ignore files of the named local context",
+		},
+	},
+	Metadata: []subrequests.Named{
+		{
+			Name: "result.json",
+		},
+	},
+}
+
+// Result lists the ignore files in the order their patterns are evaluated and
+// the excluded files of the build context
+type Result struct {
+	IgnoreFiles []string `json:"ignoreFiles,omitempty"`
+	Files       []File   `json:"files"`
+}
+
+// File is an excluded file or directory. Pattern is the last pattern matching
+// the path and IgnoreFile the file the pattern was read from.
+type File struct {
+	Path       string `json:"path"`
+	Pattern    string `json:"pattern"`
+	IgnoreFile string `json:"ignoreFile"`
+}
+
+func (r Result) ToResult() (*client.Result, error) {
+	res := client.NewResult()
+	dt, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	res.AddMeta("result.json", dt)
+	return res, nil
+}
@@ -0,0 +1,68 @@
+package resolvedconfig
+
+import (
+	"encoding/json"
+
+	"github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/moby/buildkit/frontend/subrequests"
+)
+
+const RequestResolvedConfig = "frontend.resolvedconfig"
+
+var SubrequestsResolvedConfigDefinition = subrequests.Request{
+	Name:        RequestResolvedConfig,
+	Version:     "1.0.0",
+	Type:        subrequests.TypeRPC,
+	Description: "Show the build args and environment of every stage after ARG and ENV substitution",
+	Opts: []subrequests.Named{
+		{
+			Name:        "target",
+			Description: "Stage to mark as the build target",
+		},
+		{
+			Name:        "build-arg:*",
+			Description: "Build arguments used for the substitution",
+		},
+	},
+	Metadata: []subrequests.Named{
+		{
+			Name: "result.json",
+		},
+	},
+}
+
+// Config is the resolved configuration of a build
+type Config struct {
+	Target   string  `json:"target,omitempty"`
+	Platform string  `json:"platform"`
+	Args     []Var   `json:"args,omitempty"`
+	Stages   []Stage `json:"stages"`
+}
+
+// Stage is the resolved configuration of a single build stage
+type Stage struct {
+	Name     string `json:"name"`
+	Base     string `json:"base"`
+	Platform string `json:"platform,omitempty"`
+	Args     []Var  `json:"args,omitempty"`
+	Env      []Var  `json:"env,omitempty"`
+}
+
+// Var is a build arg or environment variable. Value is nil for build args
+// without a value. Masked is set if the value was hidden because it may
+// contain a secret.
+type Var struct {
+	Key    string  `json:"key"`
+	Value  *string `json:"value,omitempty"`
+	Masked bool    `json:"masked,omitempty"`
+}
+
+func (c Config) ToResult() (*client.Result, error) {
+	res := client.NewResult()
+	dt, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	res.AddMeta("result.json", dt)
+	return res, nil
+}
@@ -0,0 +1,239 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerignore"
+	"github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/moby/buildkit/frontend/targets"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	DefaultLocalNameContext   = "context"
+	DefaultLocalNameBuildfile = "dockerfile"
+	keyTarget                 = "target"
+	keyFilename               = "filename"
+	buildArgPrefix            = "build-arg:"
+	labelPrefix               = "label:"
+	dockerignoreFilename      = ".dockerignore"
+)
+
+// Build builds the targets of a build file. A single target is returned as
+// the result ref, multiple targets as refs keyed by target name with the
+// platforms of their images.
+func Build(ctx context.Context, c client.Client) (*client.Result, error) {
+	opts := c.BuildOpts().Opts
+	caps := c.BuildOpts().LLBCaps
+	marshalOpts := []llb.ConstraintsOpt{llb.WithCaps(caps)}
+
+	filename := opts[keyFilename]
+	if filename == "" {
+		filename = targets.DefaultFilename
+	}
+
+	src := llb.Local(DefaultLocalNameBuildfile,
+		llb.FollowPaths([]string{filename}),
+		llb.SessionID(c.BuildOpts().SessionID),
+		llb.SharedKeyHint(DefaultLocalNameBuildfile),
+		dockerfile2llb.WithInternalName("load build definition from "+filename),
+		llb.Differ(llb.DiffNone, false),
+	)
+	dt, err := readFile(ctx, c, src, filename, marshalOpts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", filename)
+	}
+
+	f, err := targets.Parse(bytes.NewReader(dt))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", filename)
+	}
+	dtDockerfile, err := f.Dockerfile()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", filename)
+	}
+
+	var excludes []string
+	ignoreSrc := llb.Local(DefaultLocalNameContext,
+		llb.SessionID(c.BuildOpts().SessionID),
+		llb.FollowPaths([]string{dockerignoreFilename}),
+		llb.SharedKeyHint(DefaultLocalNameContext+"-"+dockerignoreFilename),
+		dockerfile2llb.WithInternalName("load "+dockerignoreFilename),
+		llb.Differ(llb.DiffNone, false),
+	)
+	if dt, err := readFile(ctx, c, ignoreSrc, dockerignoreFilename, marshalOpts); err == nil {
+		excludes, err = dockerignore.ReadAll(bytes.NewBuffer(dt))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse dockerignore")
+		}
+	}
+
+	requested := []string{f.Targets[0].Name}
+	if v := opts[keyTarget]; v != "" {
+		requested = strings.Split(v, ",")
+	}
+	order, err := f.Order(requested...)
+	if err != nil {
+		return nil, err
+	}
+	isRequested := map[string]bool{}
+	for _, name := range requested {
+		isRequested[name] = true
+	}
+
+	convert := func(ctx context.Context, t *targets.Target) (*llb.Definition, *dockerfile2llb.Image, error) {
+		st, img, err := dockerfile2llb.Dockerfile2LLB(ctx, dtDockerfile, dockerfile2llb.ConvertOpt{
+			Target:       t.StageName(),
+			MetaResolver: c,
+			BuildArgs:    filter(opts, buildArgPrefix),
+			Labels:       filter(opts, labelPrefix),
+			SessionID:    c.BuildOpts().SessionID,
+			Excludes:     excludes,
+			LLBCaps:      &caps,
+		})
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to convert target %s", t.Name)
+		}
+		def, err := st.Marshal(ctx)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to marshal LLB definition")
+		}
+		return def, img, nil
+	}
+
+	expPlatforms := &exptypes.Platforms{
+		Platforms: make([]exptypes.Platform, len(requested)),
+	}
+	res := client.NewResult()
+
+	// The requested targets and their dependencies are solved concurrently
+	// in the same build so shared steps are solved once. Dependencies are
+	// evaluated even if the targets don't use their results.
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, name := range order {
+		if isRequested[name] {
+			continue
+		}
+		func(name string) {
+			eg.Go(func() error {
+				def, _, err := convert(ctx, f.Target(name))
+				if err != nil {
+					return err
+				}
+				if _, err := c.Solve(ctx, client.SolveRequest{
+					Definition: def.ToPB(),
+					Evaluate:   true,
+				}); err != nil {
+					return errors.Wrapf(err, "failed to build target %s", name)
+				}
+				return nil
+			})
+		}(name)
+	}
+	for i, name := range requested {
+		func(i int, name string) {
+			eg.Go(func() error {
+				t := f.Target(name)
+				def, img, err := convert(ctx, t)
+				if err != nil {
+					return err
+				}
+				r, err := c.Solve(ctx, client.SolveRequest{
+					Definition: def.ToPB(),
+				})
+				if err != nil {
+					return errors.Wrapf(err, "failed to build target %s", name)
+				}
+				ref, err := r.SingleRef()
+				if err != nil {
+					return err
+				}
+
+				var config []byte
+				if len(t.Artifacts) == 0 {
+					config, err = json.Marshal(img)
+					if err != nil {
+						return errors.Wrapf(err, "failed to marshal image config")
+					}
+				}
+				if len(requested) == 1 {
+					if config != nil {
+						res.AddMeta(exptypes.ExporterImageConfigKey, config)
+					}
+					res.SetRef(ref)
+					return nil
+				}
+
+				p := platforms.DefaultSpec()
+				if img != nil && img.OS != "" {
+					p = ocispecs.Platform{
+						OS:           img.OS,
+						Architecture: img.Architecture,
+						Variant:      img.Variant,
+					}
+				}
+				if config != nil {
+					res.AddMeta(fmt.Sprintf("%s/%s", exptypes.ExporterImageConfigKey, name), config)
+				}
+				res.AddRef(name, ref)
+				expPlatforms.Platforms[i] = exptypes.Platform{
+					ID:       name,
+					Platform: p,
+				}
+				return nil
+			})
+		}(i, name)
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	if len(requested) > 1 {
+		dt, err := json.Marshal(expPlatforms)
+		if err != nil {
+			return nil, err
+		}
+		res.AddMeta(exptypes.ExporterPlatformsKey, dt)
+	}
+	return res, nil
+}
+
+func readFile(ctx context.Context, c client.Client, st llb.State, filename string, opts []llb.ConstraintsOpt) ([]byte, error) {
+	def, err := st.Marshal(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.Solve(ctx, client.SolveRequest{
+		Definition: def.ToPB(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ref, err := res.SingleRef()
+	if err != nil {
+		return nil, err
+	}
+	return ref.ReadFile(ctx, client.ReadRequest{
+		Filename: filename,
+	})
+}
+
+func filter(opt map[string]string, key string) map[string]string {
+	m := map[string]string{}
+	for k, v := range opt {
+		if strings.HasPrefix(k, key) {
+			m[strings.TrimPrefix(k, key)] = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,140 @@
+package targets
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const artifactsSuffix = ".artifacts"
+
+// StageName returns the name of the Dockerfile stage holding the result of
+// the target. For targets with artifacts this only contains the artifacts.
+func (t *Target) StageName() string {
+	if len(t.Artifacts) > 0 {
+		return t.Name + artifactsSuffix
+	}
+	return t.Name
+}
+
+// Dockerfile converts the build file to a multi-stage Dockerfile with a stage
+// for every target. Use StageName to select the stage of a target.
+func (f *File) Dockerfile() ([]byte, error) {
+	order, err := f.Order(targetNames(f.Targets)...)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	for _, a := range f.Args {
+		fmt.Fprintln(buf, a.Text)
+	}
+	for _, name := range order {
+		if err := f.writeTarget(buf, f.Target(name)); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *File) writeTarget(buf *bytes.Buffer, t *Target) error {
+	fmt.Fprintln(buf)
+
+	instructions := t.Instructions
+	if len(instructions) > 0 && instructionName(instructions[0]) == "FROM" {
+		fields := strings.Fields(instructions[0].Text)
+		if len(fields) > 2 && strings.EqualFold(fields[len(fields)-2], "AS") {
+			return errors.Errorf("line %d: stage names are not allowed, the target name %q is used", instructions[0].Line, t.Name)
+		}
+		for i, fld := range fields[1:] {
+			if name, p, ok := splitRef(fld); ok {
+				if p != "" {
+					return errors.Errorf("line %d: FROM must reference a target without a path", instructions[0].Line)
+				}
+				ref := f.Target(name)
+				if ref == nil {
+					return errors.Errorf("line %d: reference to undefined target %q", instructions[0].Line, name)
+				}
+				fields[i+1] = ref.StageName()
+			}
+		}
+		fmt.Fprintf(buf, "%s AS %s\n", strings.Join(fields, " "), t.Name)
+		instructions = instructions[1:]
+	} else {
+		if len(t.Deps) == 0 {
+			return errors.Errorf("line %d: target %q needs a FROM instruction or a dependency to use as base", t.Line, t.Name)
+		}
+		base := f.Target(t.Deps[0])
+		if base == nil {
+			return errors.Errorf("line %d: dependency on undefined target %q", t.Line, t.Deps[0])
+		}
+		fmt.Fprintf(buf, "FROM %s AS %s\n", base.StageName(), t.Name)
+	}
+
+	for _, l := range instructions {
+		switch instructionName(l) {
+		case "FROM":
+			return errors.Errorf("line %d: FROM is only allowed as the first instruction of a target", l.Line)
+		case "COPY":
+			text, err := f.rewriteCopy(l)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(buf, text)
+		default:
+			fmt.Fprintln(buf, l.Text)
+		}
+	}
+
+	if len(t.Artifacts) > 0 {
+		fmt.Fprintf(buf, "\nFROM scratch AS %s\n", t.StageName())
+		for _, a := range t.Artifacts {
+			fmt.Fprintf(buf, "COPY --from=%s %s %s\n", t.Name, a.Src, a.Dest)
+		}
+	}
+	return nil
+}
+
+// rewriteCopy replaces "+target/path" sources with --from=<stage>
+func (f *File) rewriteCopy(l Line) (string, error) {
+	fields := strings.Fields(strings.ReplaceAll(l.Text, "\\\n", " "))
+	from := ""
+	for i, fld := range fields[1:] {
+		name, p, ok := splitRef(fld)
+		if !ok {
+			continue
+		}
+		t := f.Target(name)
+		if t == nil {
+			return "", errors.Errorf("line %d: reference to undefined target %q", l.Line, name)
+		}
+		if from != "" && from != t.StageName() {
+			return "", errors.Errorf("line %d: COPY can only reference a single target", l.Line)
+		}
+		from = t.StageName()
+		if p == "" {
+			p = "/"
+		}
+		fields[i+1] = p
+	}
+	if from == "" {
+		return l.Text, nil
+	}
+	for _, fld := range fields[1:] {
+		if strings.HasPrefix(fld, "--from=") {
+			return "", errors.Errorf("line %d: COPY can't combine --from with a target reference", l.Line)
+		}
+	}
+	out := append([]string{fields[0], "--from=" + from}, fields[1:]...)
+	return strings.Join(out, " "), nil
+}
+
+func instructionName(l Line) string {
+	fields := strings.Fields(l.Text)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,254 @@
+package targets
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultFilename is the name of the build file read by the frontend
+const DefaultFilename = "Buildfile"
+
+var validTargetName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// File is a parsed build file
+type File struct {
+	// Args are global ARG instructions available to all targets
+	Args    []Line
+	Targets []*Target
+}
+
+// Target is a named build target
+type Target struct {
+	Name string
+	// Deps are built before the target. If the target has no FROM instruction
+	// the first dependency is used as its base.
+	Deps         []string
+	Instructions []Line
+	Artifacts    []Artifact
+	Line         int
+}
+
+// Artifact is a path exported by a target instead of its full filesystem
+type Artifact struct {
+	Src  string
+	Dest string
+	Line int
+}
+
+// Line is a Dockerfile instruction with its position in the build file
+type Line struct {
+	Text string
+	Line int
+}
+
+// Target returns the target with name or nil
+func (f *File) Target(name string) *Target {
+	for _, t := range f.Targets {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Parse reads a build file. Targets are declared at the start of a line as
+// "name: dep1 dep2" followed by indented Dockerfile instructions and ARTIFACT
+// declarations.
+func Parse(r io.Reader) (*File, error) {
+	f := &File{}
+	var cur *Target
+	var continued *Line
+
+	s := bufio.NewScanner(r)
+	lineno := 0
+	for s.Scan() {
+		lineno++
+		raw := s.Text()
+		text := strings.TrimSpace(raw)
+
+		if continued != nil {
+			if strings.HasPrefix(text, "#") {
+				continue
+			}
+			continued.Text += "\n" + raw
+			if !strings.HasSuffix(text, "\\") {
+				continued = nil
+			}
+			continue
+		}
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if raw[0] != ' ' && raw[0] != '\t' {
+			if strings.HasPrefix(strings.ToUpper(text), "ARG ") {
+				if cur != nil {
+					return nil, errors.Errorf("line %d: global ARG must be declared before the first target", lineno)
+				}
+				f.Args = append(f.Args, Line{Text: text, Line: lineno})
+				continue
+			}
+			t, err := parseTargetDecl(text, lineno)
+			if err != nil {
+				return nil, err
+			}
+			if f.Target(t.Name) != nil {
+				return nil, errors.Errorf("line %d: target %q is declared twice", lineno, t.Name)
+			}
+			f.Targets = append(f.Targets, t)
+			cur = t
+			continue
+		}
+
+		if cur == nil {
+			return nil, errors.Errorf("line %d: instruction outside of a target", lineno)
+		}
+
+		fields := strings.Fields(text)
+		if strings.EqualFold(fields[0], "ARTIFACT") {
+			a, err := parseArtifact(fields[1:], lineno)
+			if err != nil {
+				return nil, err
+			}
+			cur.Artifacts = append(cur.Artifacts, a)
+			continue
+		}
+
+		cur.Instructions = append(cur.Instructions, Line{Text: text, Line: lineno})
+		if strings.HasSuffix(text, "\\") {
+			continued = &cur.Instructions[len(cur.Instructions)-1]
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(f.Targets) == 0 {
+		return nil, errors.New("build file does not declare any targets")
+	}
+
+	for _, t := range f.Targets {
+		for _, d := range t.Deps {
+			if f.Target(d) == nil {
+				return nil, errors.Errorf("line %d: target %q depends on undefined target %q", t.Line, t.Name, d)
+			}
+		}
+	}
+	if _, err := f.Order(targetNames(f.Targets)...); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseTargetDecl(text string, lineno int) (*Target, error) {
+	parts := strings.SplitN(text, ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.Errorf("line %d: expected target declaration \"name: [deps...]\", got %q", lineno, text)
+	}
+	t := &Target{
+		Name: strings.TrimSpace(parts[0]),
+		Line: lineno,
+	}
+	if !validTargetName.MatchString(t.Name) {
+		return nil, errors.Errorf("line %d: invalid target name %q, must match %s", lineno, t.Name, validTargetName)
+	}
+	for _, d := range strings.Fields(parts[1]) {
+		t.Deps = append(t.Deps, strings.TrimPrefix(d, "+"))
+	}
+	return t, nil
+}
+
+func parseArtifact(args []string, lineno int) (Artifact, error) {
+	switch len(args) {
+	case 1:
+		return Artifact{Src: args[0], Dest: "/", Line: lineno}, nil
+	case 2:
+		return Artifact{Src: args[0], Dest: args[1], Line: lineno}, nil
+	default:
+		return Artifact{}, errors.Errorf("line %d: ARTIFACT requires a source and an optional destination", lineno)
+	}
+}
+
+// Order returns the names of the targets and all of their dependencies,
+// with every target following its dependencies
+func (f *File) Order(names ...string) ([]string, error) {
+	var out []string
+	state := map[string]int{} // 1: visiting, 2: done
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return errors.Errorf("dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		t := f.Target(name)
+		if t == nil {
+			return errors.Errorf("target %q is not defined", name)
+		}
+		state[name] = 1
+		for _, d := range t.Deps {
+			if err := visit(d, append(path, name)); err != nil {
+				return err
+			}
+		}
+		for _, d := range t.refs() {
+			if err := visit(d, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		out = append(out, name)
+		return nil
+	}
+	for _, n := range names {
+		if err := visit(n, nil); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// refs returns the targets referenced with +name in the instructions
+func (t *Target) refs() []string {
+	var out []string
+	for _, l := range t.Instructions {
+		fields := strings.Fields(l.Text)
+		if cmd := strings.ToUpper(fields[0]); cmd != "FROM" && cmd != "COPY" {
+			continue
+		}
+		for _, f := range fields[1:] {
+			if name, _, ok := splitRef(f); ok {
+				out = append(out, name)
+			}
+		}
+	}
+	return out
+}
+
+// splitRef splits a "+target/path" reference
+func splitRef(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, "+") {
+		return "", "", false
+	}
+	parts := strings.SplitN(s[1:], "/", 2)
+	if !validTargetName.MatchString(parts[0]) {
+		return "", "", false
+	}
+	if len(parts) == 1 {
+		return parts[0], "", true
+	}
+	return parts[0], "/" + parts[1], true
+}
+
+func targetNames(targets []*Target) []string {
+	out := make([]string, 0, len(targets))
+	for _, t := range targets {
+		out = append(out, t.Name)
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package targets
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testBuildfile = `
+ARG GO_VERSION=1.16
+
+# shared base for all targets
+base:
+	FROM golang:${GO_VERSION}-alpine
+	WORKDIR /src
+	COPY go.mod go.sum ./
+	RUN go mod download
+
+build: base
+	COPY . .
+	RUN go build -o /out/app \
+	  ./cmd/app
+	ARTIFACT /out/app
+
+test: base
+	COPY . .
+	RUN go test ./...
+
+image: test
+	FROM alpine
+	COPY +build/app /usr/bin/app
+	ENTRYPOINT ["/usr/bin/app"]
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(testBuildfile))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(f.Args))
+	require.Equal(t, 4, len(f.Targets))
+
+	build := f.Target("build")
+	require.NotNil(t, build)
+	require.Equal(t, []string{"base"}, build.Deps)
+	require.Equal(t, 2, len(build.Instructions))
+	require.Equal(t, "RUN go build -o /out/app \\\n\t  ./cmd/app", build.Instructions[1].Text)
+	require.Equal(t, []Artifact{{Src: "/out/app", Dest: "/", Line: 15}}, build.Artifacts)
+	require.Equal(t, "build.artifacts", build.StageName())
+
+	order, err := f.Order("image")
+	require.NoError(t, err)
+	require.Equal(t, []string{"base", "test", "build", "image"}, order)
+}
+
+func TestDockerfile(t *testing.T) {
+	f, err := Parse(strings.NewReader(testBuildfile))
+	require.NoError(t, err)
+
+	dt, err := f.Dockerfile()
+	require.NoError(t, err)
+
+	out := string(dt)
+	require.True(t, strings.HasPrefix(out, "ARG GO_VERSION=1.16\n"))
+	require.Contains(t, out, "FROM golang:${GO_VERSION}-alpine AS base\n")
+	require.Contains(t, out, "FROM base AS build\n")
+	require.Contains(t, out, "FROM scratch AS build.artifacts\nCOPY --from=build /out/app /\n")
+	require.Contains(t, out, "FROM alpine AS image\nCOPY --from=build.artifacts /app /usr/bin/app\n")
+	require.Less(t, strings.Index(out, "AS build.artifacts"), strings.Index(out, "AS image"))
+
+	// targets with artifacts are referenced by their artifacts stage
+	f, err = Parse(strings.NewReader(testBuildfile + "\nrelease:\n\tFROM +build\n\nrelease2: build\n\tLABEL a=b\n"))
+	require.NoError(t, err)
+	dt, err = f.Dockerfile()
+	require.NoError(t, err)
+	out = string(dt)
+	require.Contains(t, out, "FROM build.artifacts AS release\n")
+	require.Contains(t, out, "FROM build.artifacts AS release2\n")
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		dt  string
+		err string
+	}{
+		{"", "does not declare any targets"},
+		{"\tRUN true\n", "outside of a target"},
+		{"a:\n\tFROM alpine\na:\n\tFROM alpine\n", "declared twice"},
+		{"a: b\n\tRUN true\n", "undefined target"},
+		{"a: b\nb: a\n", "dependency cycle"},
+		{"a:\n\tFROM alpine\n\tCOPY +a/foo /\n", "dependency cycle"},
+		{"Foo:\n\tFROM alpine\n", "invalid target name"},
+		{"a:\n\tFROM alpine\n\tARTIFACT\n", "ARTIFACT requires"},
+	} {
+		_, err := Parse(strings.NewReader(tc.dt))
+		require.Error(t, err, tc.dt)
+		require.Contains(t, err.Error(), tc.err)
+	}
+
+	for _, tc := range []struct {
+		dt  string
+		err string
+	}{
+		{"a:\n\tRUN true\n", "needs a FROM instruction"},
+		{"a:\n\tFROM alpine AS foo\n", "stage names are not allowed"},
+		{"a:\n\tFROM alpine\n\tFROM busybox\n", "only allowed as the first instruction"},
+		{"a:\n\tFROM alpine\nb:\n\tFROM alpine\nc:\n\tFROM alpine\n\tCOPY +a/x +b/y /\n", "single target"},
+	} {
+		f, err := Parse(strings.NewReader(tc.dt))
+		require.NoError(t, err, tc.dt)
+		_, err = f.Dockerfile()
+		require.Error(t, err, tc.dt)
+		require.Contains(t, err.Error(), tc.err)
+	}
+}
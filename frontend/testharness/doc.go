@@ -0,0 +1,18 @@
+// Package testharness runs an in-process single-node BuildKit daemon for the
+// integration tests of frontends. The daemon has a runc worker with the
+// native snapshotter and keeps its state in a temporary directory, so tests
+// don't require dockerd, a buildkitd binary or privileged containers.
+//
+//	h, err := testharness.New(ctx, testharness.Opt{
+//		Frontends: map[string]gwclient.BuildFunc{"myfrontend": mybuilder.Build},
+//	})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer h.Close()
+//
+//	_, err = h.Client.Solve(ctx, nil, client.SolveOpt{Frontend: "myfrontend"}, nil)
+//
+// The API of the package is stable, unlike the internal test utilities of
+// BuildKit that frontends used to copy.
+package testharness
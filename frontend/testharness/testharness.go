@@ -0,0 +1,226 @@
+// +build linux
+
+package testharness
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/containerd/containerd/snapshots/native"
+	"github.com/moby/buildkit/cache/remotecache"
+	inlineremotecache "github.com/moby/buildkit/cache/remotecache/inline"
+	localremotecache "github.com/moby/buildkit/cache/remotecache/local"
+	registryremotecache "github.com/moby/buildkit/cache/remotecache/registry"
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/control"
+	"github.com/moby/buildkit/executor/oci"
+	"github.com/moby/buildkit/frontend"
+	dockerfile "github.com/moby/buildkit/frontend/dockerfile/builder"
+	"github.com/moby/buildkit/frontend/gateway"
+	gwclient "github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/moby/buildkit/frontend/gateway/forwarder"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/solver/bboltcachestorage"
+	"github.com/moby/buildkit/util/grpcerrors"
+	"github.com/moby/buildkit/util/network/netproviders"
+	"github.com/moby/buildkit/util/resolver"
+	"github.com/moby/buildkit/worker"
+	"github.com/moby/buildkit/worker/base"
+	"github.com/moby/buildkit/worker/runc"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// Opt configures the daemon of a Harness
+type Opt struct {
+	// Root is the state directory of the daemon. A temporary directory is
+	// created and removed on Close if empty.
+	Root string
+	// Frontends are the frontends of the daemon by name, in addition to the
+	// builtin dockerfile.v0 and gateway.v0 frontends. They let tests solve
+	// the frontend under test without building and pushing its image first.
+	Frontends map[string]gwclient.BuildFunc
+	// Registries configures the registries of the daemon, e.g. mirrors or
+	// a local registry of the test
+	Registries map[string]resolver.RegistryConfig
+	// Runc is the runc binary, buildkit-runc or runc in $PATH if empty
+	Runc string
+	// NoProcessSandbox runs the processes of exec ops without a PID
+	// namespace, as required by some rootless environments
+	NoProcessSandbox bool
+}
+
+// Harness is a running in-process daemon
+type Harness struct {
+	// Client is connected to the daemon
+	Client *client.Client
+	// Root is the state directory of the daemon
+	Root string
+
+	server  *grpc.Server
+	cleanup []func() error
+}
+
+// Available returns an error if the daemon can't be run on the host, so
+// that tests can be skipped
+func Available() error {
+	for _, cmd := range []string{"buildkit-runc", "runc"} {
+		if _, err := exec.LookPath(cmd); err == nil {
+			return nil
+		}
+	}
+	return errors.New("testharness requires runc or buildkit-runc in $PATH")
+}
+
+// New starts a daemon and connects the client of the Harness to it. The
+// daemon runs rootless if the process isn't run as root, e.g. in a user
+// namespace of rootlesskit.
+func New(ctx context.Context, opt Opt) (_ *Harness, err error) {
+	h := &Harness{Root: opt.Root}
+	defer func() {
+		if err != nil {
+			h.Close()
+		}
+	}()
+
+	if h.Root == "" {
+		h.Root, err = ioutil.TempDir("", "buildkit-testharness")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		root := h.Root
+		h.cleanup = append(h.cleanup, func() error { return os.RemoveAll(root) })
+	}
+	if h.Root, err = filepath.Abs(h.Root); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	wc, sm, err := h.newWorkerController(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	w, err := wc.GetDefault()
+	if err != nil {
+		return nil, err
+	}
+
+	frontends := map[string]frontend.Frontend{
+		"dockerfile.v0": forwarder.NewGatewayForwarder(wc, dockerfile.Build),
+		"gateway.v0":    gateway.NewGatewayFrontend(wc),
+	}
+	for name, f := range opt.Frontends {
+		frontends[name] = forwarder.NewGatewayForwarder(wc, f)
+	}
+
+	cacheStorage, err := bboltcachestorage.NewStore(filepath.Join(h.Root, "cache.db"))
+	if err != nil {
+		return nil, err
+	}
+	h.cleanup = append(h.cleanup, cacheStorage.Close)
+
+	hosts := resolver.NewRegistryConfig(opt.Registries)
+	controller, err := control.NewController(control.Opt{
+		SessionManager:   sm,
+		WorkerController: wc,
+		Frontends:        frontends,
+		ResolveCacheExporterFuncs: map[string]remotecache.ResolveCacheExporterFunc{
+			"registry": registryremotecache.ResolveCacheExporterFunc(sm, hosts),
+			"local":    localremotecache.ResolveCacheExporterFunc(sm),
+			"inline":   inlineremotecache.ResolveCacheExporterFunc(),
+		},
+		ResolveCacheImporterFuncs: map[string]remotecache.ResolveCacheImporterFunc{
+			"registry": registryremotecache.ResolveCacheImporterFunc(sm, w.ContentStore(), hosts),
+			"local":    localremotecache.ResolveCacheImporterFunc(sm),
+		},
+		CacheKeyStorage: cacheStorage,
+		RegistryHosts:   hosts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	h.cleanup = append(h.cleanup, controller.Close)
+
+	h.server = grpc.NewServer(grpc.UnaryInterceptor(grpcerrors.UnaryServerInterceptor), grpc.StreamInterceptor(grpcerrors.StreamServerInterceptor))
+	if err := controller.Register(h.server); err != nil {
+		return nil, err
+	}
+
+	// the socket isn't created in the root as its path may exceed the
+	// length limit of unix sockets
+	sockDir, err := ioutil.TempDir("", "buildkit-testharness-sock")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	h.cleanup = append(h.cleanup, func() error { return os.RemoveAll(sockDir) })
+	sock := filepath.Join(sockDir, "buildkitd.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	go h.server.Serve(l)
+
+	h.Client, err = client.New(ctx, "unix://"+sock)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Harness) newWorkerController(ctx context.Context, opt Opt) (*worker.Controller, *session.Manager, error) {
+	sm, err := session.NewManager()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	snFactory := runc.SnapshotterFactory{
+		Name: "native",
+		New:  native.NewSnapshotter,
+	}
+	processMode := oci.ProcessSandbox
+	if opt.NoProcessSandbox {
+		processMode = oci.NoProcessSandbox
+	}
+	rootless := os.Geteuid() != 0
+	wopt, err := runc.NewWorkerOpt(h.Root, snFactory, rootless, processMode, nil, nil, netproviders.Opt{Mode: "host"}, nil, opt.Runc, "", nil, "", 0, false, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	wopt.RegistryHosts = resolver.NewRegistryConfig(opt.Registries)
+
+	w, err := base.NewWorker(ctx, wopt)
+	if err != nil {
+		wopt.MetadataStore.Close()
+		return nil, nil, err
+	}
+	// closing the cache manager also closes the metadata database
+	h.cleanup = append(h.cleanup, w.CacheMgr.Close)
+	wc := &worker.Controller{}
+	if err := wc.Add(w); err != nil {
+		return nil, nil, err
+	}
+	return wc, sm, nil
+}
+
+// Close stops the daemon, closes its databases and removes its temporary
+// directories
+func (h *Harness) Close() error {
+	var rerr error
+	if h.Client != nil {
+		if err := h.Client.Close(); err != nil && rerr == nil {
+			rerr = err
+		}
+	}
+	if h.server != nil {
+		h.server.Stop()
+	}
+	for i := len(h.cleanup) - 1; i >= 0; i-- {
+		if err := h.cleanup[i](); err != nil && rerr == nil {
+			rerr = err
+		}
+	}
+	return rerr
+}
@@ -0,0 +1,57 @@
+// +build linux
+
+package testharness
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/client/llb"
+	gwclient "github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarness(t *testing.T) {
+	if err := Available(); err != nil {
+		t.Skip(err.Error())
+	}
+	ctx := context.TODO()
+
+	build := func(ctx context.Context, c gwclient.Client) (*gwclient.Result, error) {
+		def, err := llb.Scratch().File(llb.Mkfile("foo", 0600, []byte(c.BuildOpts().Opts["contents"]))).Marshal(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.Solve(ctx, gwclient.SolveRequest{Definition: def.ToPB()})
+	}
+	h, err := New(ctx, Opt{Frontends: map[string]gwclient.BuildFunc{"test": build}})
+	require.NoError(t, err)
+	defer h.Close()
+
+	destDir, err := ioutil.TempDir("", "buildkit")
+	require.NoError(t, err)
+	defer os.RemoveAll(destDir)
+
+	_, err = h.Client.Solve(ctx, nil, client.SolveOpt{
+		Frontend:      "test",
+		FrontendAttrs: map[string]string{"contents": "bar"},
+		Exports: []client.ExportEntry{{
+			Type:      client.ExporterLocal,
+			OutputDir: destDir,
+		}},
+	}, nil)
+	require.NoError(t, err)
+
+	dt, err := ioutil.ReadFile(filepath.Join(destDir, "foo"))
+	require.NoError(t, err)
+	require.Equal(t, "bar", string(dt))
+
+	root := h.Root
+	require.NoError(t, h.Close())
+	_, err = os.Stat(root)
+	require.True(t, os.IsNotExist(err))
+}
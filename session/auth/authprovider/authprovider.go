@@ -28,16 +28,45 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-func NewDockerAuthProvider(stderr io.Writer) session.Attachable {
-	return &authProvider{
+// DockerAuthProviderOpt is an option for NewDockerAuthProvider
+type DockerAuthProviderOpt func(*authProvider)
+
+// WithHostConfig makes the provider use cfg instead of the default docker
+// config for the credentials of the registry host. This allows using
+// different credentials for targets like the cache and the image registry.
+func WithHostConfig(host string, cfg *configfile.ConfigFile) DockerAuthProviderOpt {
+	return func(ap *authProvider) {
+		ap.hostConfigs[hostConfigKey(host)] = cfg
+	}
+}
+
+// hostConfigKey returns the key of the host configs for host. Docker Hub is
+// requested as registry-1.docker.io but configured as docker.io or
+// index.docker.io.
+func hostConfigKey(host string) string {
+	switch host {
+	case "docker.io", "index.docker.io", "registry-1.docker.io", "https://index.docker.io/v1/":
+		return "docker.io"
+	}
+	return host
+}
+
+func NewDockerAuthProvider(stderr io.Writer, opts ...DockerAuthProviderOpt) session.Attachable {
+	ap := &authProvider{
 		config:      config.LoadDefaultConfigFile(stderr),
+		hostConfigs: map[string]*configfile.ConfigFile{},
 		seeds:       &tokenSeeds{dir: config.Dir()},
 		loggerCache: map[string]struct{}{},
 	}
+	for _, o := range opts {
+		o(ap)
+	}
+	return ap
 }
 
 type authProvider struct {
 	config      *configfile.ConfigFile
+	hostConfigs map[string]*configfile.ConfigFile
 	seeds       *tokenSeeds
 	logger      progresswriter.Logger
 	loggerCache map[string]struct{}
@@ -122,7 +151,11 @@ func (ap *authProvider) credentials(host string) (*auth.CredentialsResponse, err
 	if host == "registry-1.docker.io" {
 		host = "https://index.docker.io/v1/"
 	}
-	ac, err := ap.config.GetAuthConfig(host)
+	cfg := ap.config
+	if c, ok := ap.hostConfigs[hostConfigKey(host)]; ok {
+		cfg = c
+	}
+	ac, err := cfg.GetAuthConfig(host)
 	if err != nil {
 		return nil, err
 	}
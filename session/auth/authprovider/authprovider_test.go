@@ -0,0 +1,25 @@
+package authprovider
+
+import (
+	"testing"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostConfigDockerHub(t *testing.T) {
+	cfg := configfile.New("")
+	cfg.AuthConfigs = map[string]types.AuthConfig{
+		"https://index.docker.io/v1/": {Username: "hub", Password: "secret"},
+	}
+	for _, host := range []string{"docker.io", "index.docker.io"} {
+		ap := NewDockerAuthProvider(nil, WithHostConfig(host, cfg)).(*authProvider)
+		ap.config = configfile.New("")
+
+		res, err := ap.credentials("registry-1.docker.io")
+		require.NoError(t, err)
+		require.Equal(t, "hub", res.Username, host)
+		require.Equal(t, "secret", res.Secret, host)
+	}
+}
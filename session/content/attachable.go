@@ -18,6 +18,11 @@ import (
 // GRPCHeaderID is a gRPC header for store ID
 const GRPCHeaderID = "buildkit-attachable-store-id"
 
+// ExportStoreID is the ID of the store of the client that image exporters
+// write an OCI layout directory to. Blobs that exist in the store already are
+// not transferred again.
+const ExportStoreID = "export"
+
 type attachableContentStore struct {
 	stores map[string]content.Store
 }
@@ -5,6 +5,7 @@ import (
 	"context"
 	io "io"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/moby/buildkit/util/bklog"
@@ -98,13 +99,16 @@ func recvDiffCopy(ds grpc.ClientStream, dest string, cu CacheUpdater, progress p
 	}))
 }
 
-func syncTargetDiffCopy(ds grpc.ServerStream, dest string) error {
+func syncTargetDiffCopy(ds grpc.ServerStream, dest string, preserveOwnership bool) error {
 	if err := os.MkdirAll(dest, 0700); err != nil {
 		return errors.Wrapf(err, "failed to create synctarget dest dir %s", dest)
 	}
 	return errors.WithStack(fsutil.Receive(ds.Context(), ds, dest, fsutil.ReceiveOpt{
 		Merge: true,
 		Filter: func() func(string, *fstypes.Stat) bool {
+			if preserveOwnership {
+				return nil
+			}
 			uid := os.Getuid()
 			gid := os.Getgid()
 			return func(p string, st *fstypes.Stat) bool {
@@ -116,6 +120,22 @@ func syncTargetDiffCopy(ds grpc.ServerStream, dest string) error {
 	}))
 }
 
+func syncTargetTarFile(ds grpc.ServerStream, dest, name string) (err error) {
+	if err := os.MkdirAll(dest, 0700); err != nil {
+		return errors.Wrapf(err, "failed to create synctarget dest dir %s", dest)
+	}
+	f, err := os.Create(filepath.Join(dest, filepath.Base(name)))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err1 := f.Close(); err == nil {
+			err = errors.WithStack(err1)
+		}
+	}()
+	return writeTargetFile(ds, f)
+}
+
 func writeTargetFile(ds grpc.ServerStream, wc io.WriteCloser) error {
 	for {
 		bm := BytesMessage{}
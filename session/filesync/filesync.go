@@ -24,6 +24,13 @@ const (
 	keyFollowPaths        = "followpaths"
 	keyDirName            = "dir-name"
 	keyExporterMetaPrefix = "exporter-md-"
+
+	// KeyTarName is the exporter metadata key of the name of the file in
+	// the target directory that a tar stream is written to
+	KeyTarName = "local.tar-name"
+	// KeyPreserveOwnership is the exporter metadata key that makes the
+	// target directory keep the uid/gid of the copied files
+	KeyPreserveOwnership = "local.preserve-ownership"
 )
 
 type fsSyncProvider struct {
@@ -257,13 +264,6 @@ func (sp *fsSyncTarget) Register(server *grpc.Server) {
 }
 
 func (sp *fsSyncTarget) DiffCopy(stream FileSend_DiffCopyServer) (err error) {
-	if sp.outdir != "" {
-		return syncTargetDiffCopy(stream, sp.outdir)
-	}
-
-	if sp.f == nil {
-		return errors.New("empty outfile and outdir")
-	}
 	opts, _ := metadata.FromIncomingContext(stream.Context()) // if no metadata continue with empty object
 	md := map[string]string{}
 	for k, v := range opts {
@@ -271,6 +271,17 @@ func (sp *fsSyncTarget) DiffCopy(stream FileSend_DiffCopyServer) (err error) {
 			md[strings.TrimPrefix(k, keyExporterMetaPrefix)] = strings.Join(v, ",")
 		}
 	}
+
+	if sp.outdir != "" {
+		if name := md[KeyTarName]; name != "" {
+			return syncTargetTarFile(stream, sp.outdir, name)
+		}
+		return syncTargetDiffCopy(stream, sp.outdir, md[KeyPreserveOwnership] == "true")
+	}
+
+	if sp.f == nil {
+		return errors.New("empty outfile and outdir")
+	}
 	wc, err := sp.f(md)
 	if err != nil {
 		return err
@@ -287,7 +298,7 @@ func (sp *fsSyncTarget) DiffCopy(stream FileSend_DiffCopyServer) (err error) {
 	return writeTargetFile(stream, wc)
 }
 
-func CopyToCaller(ctx context.Context, fs fsutil.FS, c session.Caller, progress func(int, bool)) error {
+func CopyToCaller(ctx context.Context, fs fsutil.FS, md map[string]string, c session.Caller, progress func(int, bool)) error {
 	method := session.MethodURL(_FileSend_serviceDesc.ServiceName, "diffcopy")
 	if !c.Supports(method) {
 		return errors.Errorf("method %s not supported by the client", method)
@@ -295,6 +306,13 @@ func CopyToCaller(ctx context.Context, fs fsutil.FS, c session.Caller, progress
 
 	client := NewFileSendClient(c.Conn())
 
+	opts := make(map[string][]string, len(md))
+	for k, v := range md {
+		opts[keyExporterMetaPrefix+k] = []string{v}
+	}
+
+	ctx = metadata.NewOutgoingContext(ctx, opts)
+
 	cc, err := client.DiffCopy(ctx)
 	if err != nil {
 		return errors.WithStack(err)
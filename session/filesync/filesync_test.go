@@ -72,3 +72,53 @@ func TestFileSyncIncludePatterns(t *testing.T) {
 	err = g.Wait()
 	require.NoError(t, err)
 }
+
+func TestCopyFileWriterTarName(t *testing.T) {
+	ctx := context.TODO()
+	t.Parallel()
+	destDir := t.TempDir()
+
+	s, err := session.NewSession(ctx, "foo", "bar")
+	require.NoError(t, err)
+
+	m, err := session.NewManager()
+	require.NoError(t, err)
+
+	s.Allow(NewFSSyncTargetDir(destDir))
+
+	dialer := session.Dialer(testutil.TestStream(testutil.Handler(m.HandleConn)))
+
+	g, ctx := errgroup.WithContext(context.Background())
+
+	g.Go(func() error {
+		return s.Run(ctx, dialer)
+	})
+
+	g.Go(func() (reterr error) {
+		c, err := m.Get(ctx, s.ID(), false)
+		if err != nil {
+			return err
+		}
+		// the name can't escape the target directory
+		w, err := CopyFileWriter(ctx, map[string]string{KeyTarName: "../out.tar"}, c)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte("tarball")); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+
+		dt, err := ioutil.ReadFile(filepath.Join(destDir, "out.tar"))
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, "tarball", string(dt))
+		return s.Close()
+	})
+
+	err = g.Wait()
+	require.NoError(t, err)
+}
@@ -0,0 +1,3 @@
+package sign
+
+//go:generate protoc --gogoslick_out=plugins=grpc:. sign.proto
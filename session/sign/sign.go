@@ -0,0 +1,41 @@
+package sign
+
+import (
+	"context"
+
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/util/grpcerrors"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+)
+
+var ErrNotFound = errors.Errorf("not found")
+
+// Sign asks a session of the group to sign payload with the key keyID. The
+// key is resolved by the client, so keyID may name a local key file as well
+// as a key held by a KMS.
+func Sign(ctx context.Context, sm *session.Manager, g session.Group, keyID string, payload []byte) ([]byte, error) {
+	var sig []byte
+	err := sm.Any(ctx, g, func(ctx context.Context, _ string, c session.Caller) error {
+		client := NewSignerClient(c.Conn())
+		resp, err := client.Sign(ctx, &SignRequest{
+			KeyID:   keyID,
+			Payload: payload,
+		})
+		if err != nil {
+			if code := grpcerrors.Code(err); code == codes.Unimplemented || code == codes.NotFound {
+				return errors.Wrapf(ErrNotFound, "signing key %s", keyID)
+			}
+			return err
+		}
+		sig = resp.Signature
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) == 0 {
+		return nil, errors.Errorf("no session provided signing key %s", keyID)
+	}
+	return sig, nil
+}
@@ -0,0 +1,118 @@
+package signprovider
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/sign"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Source is a PEM encoded private key used for signing
+type Source struct {
+	ID       string
+	FilePath string
+}
+
+// NewSignProvider returns a session attachable that signs payloads with
+// unencrypted ECDSA, RSA or Ed25519 private keys
+func NewSignProvider(srcs []Source) (session.Attachable, error) {
+	m := map[string]crypto.Signer{}
+	for _, src := range srcs {
+		if src.ID == "" {
+			return nil, errors.Errorf("signing key missing ID")
+		}
+		if src.FilePath == "" {
+			src.FilePath = src.ID
+		}
+		dt, err := ioutil.ReadFile(src.FilePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read signing key %s", src.FilePath)
+		}
+		key, err := ParsePrivateKey(dt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid signing key %s", src.FilePath)
+		}
+		m[src.ID] = key
+	}
+	return FromMap(m), nil
+}
+
+// FromMap returns a session attachable that signs payloads with the keys of m
+func FromMap(m map[string]crypto.Signer) session.Attachable {
+	return &signProvider{keys: m}
+}
+
+type signProvider struct {
+	keys map[string]crypto.Signer
+}
+
+func (sp *signProvider) Register(server *grpc.Server) {
+	sign.RegisterSignerServer(server, sp)
+}
+
+func (sp *signProvider) Sign(ctx context.Context, req *sign.SignRequest) (*sign.SignResponse, error) {
+	key, ok := sp.keys[req.KeyID]
+	if !ok && req.KeyID == "" && len(sp.keys) == 1 {
+		for _, k := range sp.keys {
+			key, ok = k, true
+		}
+	}
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "signing key %s not found", req.KeyID)
+	}
+
+	var (
+		sig []byte
+		err error
+	)
+	if _, ok := key.Public().(ed25519.PublicKey); ok {
+		sig, err = key.Sign(rand.Reader, req.Payload, crypto.Hash(0))
+	} else {
+		dgst := sha256.Sum256(req.Payload)
+		sig, err = key.Sign(rand.Reader, dgst[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign payload")
+	}
+	return &sign.SignResponse{Signature: sig}, nil
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS #8, EC or PKCS #1 private key
+func ParsePrivateKey(dt []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(dt)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	if x509.IsEncryptedPEMBlock(block) { //nolint:staticcheck
+		return nil, errors.New("encrypted private keys are not supported")
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, errors.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
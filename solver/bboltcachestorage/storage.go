@@ -41,6 +41,12 @@ func NewStore(dbPath string) (*Store, error) {
 	return &Store{db: db}, nil
 }
 
+// Close closes the database file. No other method should be called after
+// Close.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
 func (s *Store) Exists(id string) bool {
 	exists := false
 	err := s.db.View(func(tx *bolt.Tx) error {
@@ -1,6 +1,10 @@
 package solver
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
 	digest "github.com/opencontainers/go-digest"
@@ -52,6 +56,24 @@ func (ck *CacheKey) Output() Index {
 	return ck.output
 }
 
+// mergeIDs adds the IDs of other in the cache managers ck isn't known to
+func (ck *CacheKey) mergeIDs(other *CacheKey) {
+	other.mu.RLock()
+	ids := make(map[*cacheManager]string, len(other.ids))
+	for cm, id := range other.ids {
+		ids[cm] = id
+	}
+	other.mu.RUnlock()
+
+	ck.mu.Lock()
+	defer ck.mu.Unlock()
+	for cm, id := range ids {
+		if _, ok := ck.ids[cm]; !ok {
+			ck.ids[cm] = id
+		}
+	}
+}
+
 func (ck *CacheKey) clone() *CacheKey {
 	nk := &CacheKey{
 		ID:     ck.ID,
@@ -64,3 +86,42 @@ func (ck *CacheKey) clone() *CacheKey {
 	}
 	return nk
 }
+
+// contentDigest returns a digest of the key and its dependencies. Unlike the
+// ID, it doesn't depend on the cache manager the key was loaded from, and
+// dependencies on the content of inputs are keys of the content digest, so
+// it changes when the content of an input changes.
+func (ck *CacheKey) contentDigest(memo map[*CacheKey]digest.Digest) digest.Digest {
+	if dgst, ok := memo[ck]; ok {
+		return dgst
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s@%d", ck.Digest(), ck.Output())
+	for i, deps := range ck.Deps() {
+		dgsts := make([]string, 0, len(deps))
+		for _, d := range deps {
+			dgsts = append(dgsts, fmt.Sprintf("%s:%s", d.CacheKey.contentDigest(memo), d.Selector))
+		}
+		sort.Strings(dgsts)
+		fmt.Fprintf(&b, "\n%d=%s", i, strings.Join(dgsts, ","))
+	}
+	dgst := digest.FromString(b.String())
+	memo[ck] = dgst
+	return dgst
+}
+
+type execCacheKeyKey struct{}
+
+func withExecCacheKey(ctx context.Context, keys []*CacheKey) context.Context {
+	if len(keys) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, execCacheKeyKey{}, keys[0].contentDigest(map[*CacheKey]digest.Digest{}))
+}
+
+// ExecCacheKeyOf returns the content based digest of the cache key of the
+// vertex that is executed with ctx, empty if the vertex has no cache key
+func ExecCacheKeyOf(ctx context.Context) digest.Digest {
+	dgst, _ := ctx.Value(execCacheKeyKey{}).(digest.Digest)
+	return dgst
+}
@@ -35,11 +35,28 @@ func NewCacheManager(ctx context.Context, id string, storage CacheKeyStorage, re
 type cacheManager struct {
 	mu sync.RWMutex
 	id string
+	// priority ranks the records of imported caches, see SetCachePriority
+	priority int
 
 	backend CacheKeyStorage
 	results CacheResultStorage
 }
 
+// SetCachePriority sets the priority of the records of an imported cache
+// manager. When the imported caches have records for the same key, the
+// records of the cache with the highest priority are used, then the newest
+// ones. Records of the local cache are always ranked by their creation time.
+func SetCachePriority(cm CacheManager, priority int) {
+	switch cm := cm.(type) {
+	case *cacheManager:
+		cm.priority = priority
+	case *combinedCacheManager:
+		for _, c := range cm.cms {
+			SetCachePriority(c, priority)
+		}
+	}
+}
+
 func (c *cacheManager) ReleaseUnreferenced() error {
 	return c.backend.Walk(func(id string) error {
 		return c.backend.WalkResults(id, func(cr CacheResult) error {
@@ -46,9 +46,17 @@ func (cm *combinedCacheManager) Query(inp []CacheKeyWithSelector, inputIndex Ind
 				}
 				mu.Lock()
 				for _, r := range recs {
-					if _, ok := keys[r.ID]; !ok || c == cm.main {
-						keys[r.ID] = r
+					// keys with the same ID from several caches are merged so
+					// that the records of all of them are considered
+					if k, ok := keys[r.ID]; ok {
+						if c == cm.main {
+							r.mergeIDs(k)
+						} else {
+							k.mergeIDs(r)
+							continue
+						}
 					}
+					keys[r.ID] = r
 				}
 				mu.Unlock()
 				return nil
@@ -118,10 +126,10 @@ func (cm *combinedCacheManager) Records(ck *CacheKey) ([]*CacheRecord, error) {
 				}
 				mu.Lock()
 				for _, rec := range recs {
-					if _, ok := records[rec.ID]; !ok || c == cm.main {
-						if c == cm.main {
-							rec.Priority = 1
-						}
+					if c == cm.main {
+						rec.Priority = 1
+					}
+					if prev, ok := records[rec.ID]; !ok || preferCacheManager(c, prev.cacheManager, cm.main) {
 						records[rec.ID] = rec
 					}
 				}
@@ -141,3 +149,16 @@ func (cm *combinedCacheManager) Records(ck *CacheKey) ([]*CacheRecord, error) {
 	}
 	return out, nil
 }
+
+// preferCacheManager returns whether the record of a is used instead of the
+// record of b with the same ID. The order doesn't depend on which of the
+// caches returned the record first.
+func preferCacheManager(a, b *cacheManager, main CacheManager) bool {
+	if a == main || b == main {
+		return a == main
+	}
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	return a.ID() < b.ID()
+}
@@ -0,0 +1,67 @@
+package errdefs
+
+import (
+	"github.com/containerd/typeurl"
+	"github.com/moby/buildkit/util/grpcerrors"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	typeurl.Register((*ErrorCode)(nil), "github.com/moby/buildkit", "errdefs.ErrorCode+json")
+}
+
+// Codes of the classes of build failures. They are part of the API and don't
+// change, unlike the messages of the errors.
+const (
+	// CodeRegistryAuth is a registry rejecting the credentials of a pull or
+	// push, or missing credentials
+	CodeRegistryAuth = "registry-auth"
+	// CodeNetwork is a failed connection, DNS lookup or timeout of a request
+	CodeNetwork = "network"
+	// CodeOOM is a build step killed by the out-of-memory killer
+	CodeOOM = "oom"
+	// CodeDiskFull is a write failing because the disk or the quota is full
+	CodeDiskFull = "disk-full"
+	// CodeFrontendCrash is a frontend exiting without returning a result
+	CodeFrontendCrash = "frontend-crash"
+	// CodePolicyDenied is a policy of the daemon rejecting the build or its
+	// result
+	CodePolicyDenied = "policy-denied"
+)
+
+// CodedError is an error with the code of its class of failure, see
+// WithCode
+type CodedError struct {
+	ErrorCode
+	error
+}
+
+func (e *CodedError) Unwrap() error {
+	return e.error
+}
+
+func (e *CodedError) ToProto() grpcerrors.TypedErrorProto {
+	return &e.ErrorCode
+}
+
+// WithCode returns err with code, unless err already has a code
+func WithCode(err error, code string) error {
+	if err == nil || GetCode(err) != "" {
+		return err
+	}
+	return &CodedError{ErrorCode: ErrorCode{Code: code}, error: err}
+}
+
+// GetCode returns the code of err, empty if the class of the failure is
+// unknown
+func GetCode(err error) string {
+	var ce *CodedError
+	if errors.As(err, &ce) {
+		return ce.Code
+	}
+	return ""
+}
+
+func (v *ErrorCode) WrapError(err error) error {
+	return &CodedError{error: err, ErrorCode: *v}
+}
@@ -181,6 +181,54 @@ func (m *Subrequest) GetName() string {
 	return ""
 }
 
+type Instruction struct {
+	// Name is the instruction or flag, e.g. "RUN --security"
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// MinSyntax is the first frontend image that supports it
+	MinSyntax            string   `protobuf:"bytes,2,opt,name=minSyntax,proto3" json:"minSyntax,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Instruction) Reset()         { *m = Instruction{} }
+func (m *Instruction) String() string { return proto.CompactTextString(m) }
+func (*Instruction) ProtoMessage()    {}
+func (*Instruction) Descriptor() ([]byte, []int) {
+	return fileDescriptor_689dc58a5060aff5, []int{4}
+}
+func (m *Instruction) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Instruction.Unmarshal(m, b)
+}
+func (m *Instruction) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Instruction.Marshal(b, m, deterministic)
+}
+func (m *Instruction) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Instruction.Merge(m, src)
+}
+func (m *Instruction) XXX_Size() int {
+	return xxx_messageInfo_Instruction.Size(m)
+}
+func (m *Instruction) XXX_DiscardUnknown() {
+	xxx_messageInfo_Instruction.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Instruction proto.InternalMessageInfo
+
+func (m *Instruction) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Instruction) GetMinSyntax() string {
+	if m != nil {
+		return m.MinSyntax
+	}
+	return ""
+}
+
 type Solve struct {
 	InputIDs []string `protobuf:"bytes,1,rep,name=inputIDs,proto3" json:"inputIDs,omitempty"`
 	MountIDs []string `protobuf:"bytes,2,rep,name=mountIDs,proto3" json:"mountIDs,omitempty"`
@@ -198,7 +246,7 @@ func (m *Solve) Reset()         { *m = Solve{} }
 func (m *Solve) String() string { return proto.CompactTextString(m) }
 func (*Solve) ProtoMessage()    {}
 func (*Solve) Descriptor() ([]byte, []int) {
-	return fileDescriptor_689dc58a5060aff5, []int{4}
+	return fileDescriptor_689dc58a5060aff5, []int{5}
 }
 func (m *Solve) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Solve.Unmarshal(m, b)
@@ -294,7 +342,7 @@ func (m *FileAction) Reset()         { *m = FileAction{} }
 func (m *FileAction) String() string { return proto.CompactTextString(m) }
 func (*FileAction) ProtoMessage()    {}
 func (*FileAction) Descriptor() ([]byte, []int) {
-	return fileDescriptor_689dc58a5060aff5, []int{5}
+	return fileDescriptor_689dc58a5060aff5, []int{6}
 }
 func (m *FileAction) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_FileAction.Unmarshal(m, b)
@@ -333,7 +381,7 @@ func (m *ContentCache) Reset()         { *m = ContentCache{} }
 func (m *ContentCache) String() string { return proto.CompactTextString(m) }
 func (*ContentCache) ProtoMessage()    {}
 func (*ContentCache) Descriptor() ([]byte, []int) {
-	return fileDescriptor_689dc58a5060aff5, []int{6}
+	return fileDescriptor_689dc58a5060aff5, []int{7}
 }
 func (m *ContentCache) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ContentCache.Unmarshal(m, b)
@@ -360,40 +408,84 @@ func (m *ContentCache) GetIndex() int64 {
 	return 0
 }
 
+type ErrorCode struct {
+	// Code is the stable class of the failure, e.g. "registry-auth"
+	Code                 string   `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ErrorCode) Reset()         { *m = ErrorCode{} }
+func (m *ErrorCode) String() string { return proto.CompactTextString(m) }
+func (*ErrorCode) ProtoMessage()    {}
+func (*ErrorCode) Descriptor() ([]byte, []int) {
+	return fileDescriptor_689dc58a5060aff5, []int{8}
+}
+func (m *ErrorCode) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ErrorCode.Unmarshal(m, b)
+}
+func (m *ErrorCode) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ErrorCode.Marshal(b, m, deterministic)
+}
+func (m *ErrorCode) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ErrorCode.Merge(m, src)
+}
+func (m *ErrorCode) XXX_Size() int {
+	return xxx_messageInfo_ErrorCode.Size(m)
+}
+func (m *ErrorCode) XXX_DiscardUnknown() {
+	xxx_messageInfo_ErrorCode.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ErrorCode proto.InternalMessageInfo
+
+func (m *ErrorCode) GetCode() string {
+	if m != nil {
+		return m.Code
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*Vertex)(nil), "errdefs.Vertex")
 	proto.RegisterType((*Source)(nil), "errdefs.Source")
 	proto.RegisterType((*FrontendCap)(nil), "errdefs.FrontendCap")
 	proto.RegisterType((*Subrequest)(nil), "errdefs.Subrequest")
+	proto.RegisterType((*Instruction)(nil), "errdefs.Instruction")
 	proto.RegisterType((*Solve)(nil), "errdefs.Solve")
 	proto.RegisterType((*FileAction)(nil), "errdefs.FileAction")
 	proto.RegisterType((*ContentCache)(nil), "errdefs.ContentCache")
+	proto.RegisterType((*ErrorCode)(nil), "errdefs.ErrorCode")
 }
 
 func init() { proto.RegisterFile("errdefs.proto", fileDescriptor_689dc58a5060aff5) }
 
 var fileDescriptor_689dc58a5060aff5 = []byte{
-	// 348 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x91, 0xcd, 0x8e, 0xd3, 0x30,
-	0x14, 0x85, 0x27, 0xbf, 0x43, 0x6e, 0x81, 0x85, 0x81, 0x51, 0x34, 0xab, 0x8c, 0xc5, 0xa2, 0x48,
-	0x90, 0x48, 0xc3, 0x13, 0x40, 0xd1, 0x68, 0x66, 0x55, 0xc9, 0x95, 0xd8, 0xc7, 0xc9, 0x4d, 0x6b,
-	0x48, 0x6c, 0xe3, 0xd8, 0xa8, 0xbc, 0x1b, 0x0f, 0x87, 0xe2, 0xa4, 0x65, 0x16, 0xdd, 0xe5, 0xe4,
-	0xfb, 0x7c, 0xed, 0x63, 0xc3, 0x2b, 0x34, 0xa6, 0xc5, 0x6e, 0x2c, 0xb5, 0x51, 0x56, 0x91, 0xeb,
-	0x25, 0xde, 0x7e, 0xdc, 0x0b, 0x7b, 0x70, 0xbc, 0x6c, 0xd4, 0x50, 0x0d, 0x8a, 0xff, 0xa9, 0xb8,
-	0x13, 0x7d, 0xfb, 0x53, 0xd8, 0x6a, 0x54, 0xfd, 0x6f, 0x34, 0x95, 0xe6, 0x95, 0xd2, 0xcb, 0x32,
-	0x5a, 0x40, 0xfa, 0x1d, 0x8d, 0xc5, 0x23, 0xb9, 0x81, 0xb4, 0x15, 0x7b, 0x1c, 0x6d, 0x1e, 0x14,
-	0xc1, 0x3a, 0x63, 0x4b, 0xa2, 0x5b, 0x48, 0x77, 0xca, 0x99, 0x06, 0x09, 0x85, 0x58, 0xc8, 0x4e,
-	0x79, 0xbe, 0xba, 0x7f, 0x5d, 0x6a, 0x5e, 0xce, 0xe4, 0x49, 0x76, 0x8a, 0x79, 0x46, 0xee, 0x20,
-	0x35, 0xb5, 0xdc, 0xe3, 0x98, 0x87, 0x45, 0xb4, 0x5e, 0xdd, 0x67, 0x93, 0xc5, 0xa6, 0x3f, 0x6c,
-	0x01, 0xf4, 0x0e, 0x56, 0x0f, 0x46, 0x49, 0x8b, 0xb2, 0xdd, 0xd4, 0x9a, 0x10, 0x88, 0x65, 0x3d,
-	0xe0, 0xb2, 0xab, 0xff, 0xa6, 0x05, 0xc0, 0xce, 0x71, 0x83, 0xbf, 0x1c, 0x8e, 0xf6, 0xa2, 0xf1,
-	0x37, 0x80, 0x64, 0x37, 0xf5, 0x21, 0xb7, 0xf0, 0x42, 0x48, 0xed, 0xec, 0xd3, 0xb7, 0x31, 0x0f,
-	0x8a, 0x68, 0x9d, 0xb1, 0x73, 0x9e, 0xd8, 0xa0, 0x9c, 0xf4, 0x2c, 0x9c, 0xd9, 0x29, 0x93, 0x1b,
-	0x08, 0x95, 0xce, 0x23, 0xdf, 0x25, 0x9d, 0x4e, 0xb9, 0xd5, 0x2c, 0x54, 0x9a, 0x7c, 0x80, 0xb8,
-	0x13, 0x3d, 0xe6, 0xb1, 0x27, 0x6f, 0xca, 0xd3, 0x35, 0x3f, 0x88, 0x1e, 0xbf, 0x34, 0x56, 0x28,
-	0xf9, 0x78, 0xc5, 0xbc, 0x42, 0x3e, 0x41, 0xd2, 0xd4, 0xcd, 0x01, 0xf3, 0xc4, 0xbb, 0xef, 0xce,
-	0xee, 0xc6, 0xd7, 0xb3, 0x9b, 0x09, 0x3e, 0x5e, 0xb1, 0xd9, 0xfa, 0x9a, 0xc1, 0xf5, 0xe8, 0xf8,
-	0x0f, 0x6c, 0x2c, 0xa5, 0x00, 0xff, 0xe7, 0x91, 0xb7, 0x90, 0x08, 0xd9, 0xe2, 0xd1, 0x37, 0x8c,
-	0xd8, 0x1c, 0xe8, 0x7b, 0x78, 0xf9, 0x7c, 0xce, 0x65, 0x8b, 0xa7, 0xfe, 0x1d, 0x3f, 0xff, 0x0b,
-	0x00, 0x00, 0xff, 0xff, 0x1e, 0xfa, 0x9c, 0x6f, 0x0f, 0x02, 0x00, 0x00,
+	// 392 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x92, 0x5d, 0x6f, 0xd3, 0x30,
+	0x14, 0x86, 0xd7, 0xb4, 0xcd, 0xc8, 0x29, 0x70, 0x61, 0x60, 0x8a, 0x26, 0x24, 0x32, 0x8b, 0x8b,
+	0x22, 0x41, 0x22, 0x8d, 0x1f, 0x80, 0xa0, 0x30, 0xad, 0x57, 0x93, 0x5c, 0x89, 0xfb, 0x7c, 0x9c,
+	0x76, 0x86, 0xc6, 0xc7, 0xf8, 0x03, 0x75, 0xff, 0x8d, 0x1f, 0x87, 0xec, 0x64, 0x1d, 0x17, 0xe3,
+	0xce, 0xaf, 0x9f, 0x27, 0x4e, 0xce, 0x1b, 0xc3, 0x33, 0x34, 0xa6, 0xc3, 0xad, 0x2d, 0xb5, 0x21,
+	0x47, 0xec, 0x74, 0x8c, 0xe7, 0xef, 0x77, 0xd2, 0xdd, 0xfa, 0xa6, 0x6c, 0xa9, 0xaf, 0x7a, 0x6a,
+	0xee, 0xaa, 0xc6, 0xcb, 0x7d, 0xf7, 0x53, 0xba, 0xca, 0xd2, 0xfe, 0x37, 0x9a, 0x4a, 0x37, 0x15,
+	0xe9, 0xf1, 0x31, 0x5e, 0x40, 0xfa, 0x1d, 0x8d, 0xc3, 0x03, 0x3b, 0x83, 0xb4, 0x93, 0x3b, 0xb4,
+	0x2e, 0x9f, 0x14, 0x93, 0x65, 0x26, 0xc6, 0xc4, 0x6f, 0x20, 0xdd, 0x90, 0x37, 0x2d, 0x32, 0x0e,
+	0x33, 0xa9, 0xb6, 0x14, 0xf9, 0xe2, 0xf2, 0x79, 0xa9, 0x9b, 0x72, 0x20, 0x6b, 0xb5, 0x25, 0x11,
+	0x19, 0xbb, 0x80, 0xd4, 0xd4, 0x6a, 0x87, 0x36, 0x4f, 0x8a, 0xe9, 0x72, 0x71, 0x99, 0x05, 0x4b,
+	0x84, 0x1d, 0x31, 0x02, 0x7e, 0x01, 0x8b, 0x2b, 0x43, 0xca, 0xa1, 0xea, 0x56, 0xb5, 0x66, 0x0c,
+	0x66, 0xaa, 0xee, 0x71, 0x7c, 0x6b, 0x5c, 0xf3, 0x02, 0x60, 0xe3, 0x1b, 0x83, 0xbf, 0x3c, 0x5a,
+	0xf7, 0xa8, 0xf1, 0x09, 0x16, 0x6b, 0x65, 0x9d, 0xf1, 0xad, 0x93, 0xa4, 0x1e, 0x53, 0xd8, 0x6b,
+	0xc8, 0x7a, 0xa9, 0x36, 0x77, 0xca, 0xd5, 0x87, 0x3c, 0x89, 0xe0, 0x61, 0x83, 0xff, 0x99, 0xc0,
+	0x7c, 0x13, 0x0a, 0x61, 0xe7, 0xf0, 0x44, 0x2a, 0xed, 0xdd, 0xfa, 0xab, 0xcd, 0x27, 0xc5, 0x74,
+	0x99, 0x89, 0x63, 0x0e, 0xac, 0x27, 0xaf, 0x22, 0x4b, 0x06, 0x76, 0x9f, 0xd9, 0x19, 0x24, 0xa4,
+	0xf3, 0x69, 0x2c, 0x23, 0x0d, 0x63, 0xde, 0x68, 0x91, 0x90, 0x66, 0xef, 0x60, 0xb6, 0x95, 0x7b,
+	0xcc, 0x67, 0x91, 0xbc, 0x28, 0xef, 0xff, 0xd3, 0x95, 0xdc, 0xe3, 0xe7, 0xf8, 0xb9, 0xd7, 0x27,
+	0x22, 0x2a, 0xec, 0x03, 0xcc, 0xdb, 0xba, 0xbd, 0xc5, 0x7c, 0x1e, 0xdd, 0x57, 0x47, 0x77, 0x15,
+	0xfb, 0x71, 0xab, 0x00, 0xaf, 0x4f, 0xc4, 0x60, 0x7d, 0xc9, 0xe0, 0xd4, 0xfa, 0xe6, 0x07, 0xb6,
+	0x8e, 0x73, 0x80, 0x87, 0xf3, 0xd8, 0x4b, 0x98, 0x4b, 0xd5, 0xe1, 0x21, 0xce, 0x3f, 0x15, 0x43,
+	0xe0, 0x6f, 0xe1, 0xe9, 0xbf, 0xe7, 0xfc, 0xc7, 0x7a, 0x03, 0xd9, 0x37, 0x63, 0xc8, 0xac, 0xa8,
+	0xc3, 0xd0, 0x63, 0x4b, 0xdd, 0xb1, 0xc7, 0xb0, 0x6e, 0xd2, 0x78, 0x53, 0x3e, 0xfe, 0x1d, 0x00,
+	0x1b, 0xd4, 0xa6, 0x0d, 0x71, 0x02, 0x00, 0x00,
 }
@@ -0,0 +1,44 @@
+package errdefs
+
+import (
+	fmt "fmt"
+
+	"github.com/containerd/typeurl"
+	"github.com/moby/buildkit/util/grpcerrors"
+)
+
+func init() {
+	typeurl.Register((*Instruction)(nil), "github.com/moby/buildkit", "errdefs.Instruction+json")
+}
+
+type UnsupportedInstructionError struct {
+	Instruction
+	error
+}
+
+func (e *UnsupportedInstructionError) Error() string {
+	if e.error != nil {
+		return e.error.Error()
+	}
+	msg := fmt.Sprintf("unsupported instruction %s", e.Instruction.Name)
+	if e.Instruction.MinSyntax != "" {
+		msg += fmt.Sprintf(", requires %s or later", e.Instruction.MinSyntax)
+	}
+	return msg
+}
+
+func (e *UnsupportedInstructionError) Unwrap() error {
+	return e.error
+}
+
+func (e *UnsupportedInstructionError) ToProto() grpcerrors.TypedErrorProto {
+	return &e.Instruction
+}
+
+func NewUnsupportedInstructionError(name, minSyntax string) error {
+	return &UnsupportedInstructionError{Instruction: Instruction{Name: name, MinSyntax: minSyntax}}
+}
+
+func (v *Instruction) WrapError(err error) error {
+	return &UnsupportedInstructionError{error: err, Instruction: *v}
+}
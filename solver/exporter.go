@@ -100,9 +100,11 @@ func (e *exporter) ExportTo(ctx context.Context, t CacheExporterTarget, opt Cach
 			return nil, err
 		}
 
-		remote, err = cm.results.LoadRemote(ctx, res, opt.Session)
-		if err != nil {
-			return nil, err
+		if !opt.ConvertAll {
+			remote, err = cm.results.LoadRemote(ctx, res, opt.Session)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		if remote == nil && opt.Mode != CacheExportModeRemoteOnly {
@@ -188,13 +190,31 @@ func (e *exporter) ExportTo(ctx context.Context, t CacheExporterTarget, opt Cach
 func getBestResult(records []*CacheRecord) *CacheRecord {
 	var rec *CacheRecord
 	for _, r := range records {
-		if rec == nil || rec.CreatedAt.Before(r.CreatedAt) || (rec.CreatedAt.Equal(r.CreatedAt) && rec.Priority < r.Priority) {
+		if rec == nil || isBetterResult(r, rec) {
 			rec = r
 		}
 	}
 	return rec
 }
 
+// isBetterResult returns whether a is used instead of b. Records of imported
+// caches are ranked by the priority of the imports first, then the newest
+// record wins. Records of the local cache win ties.
+func isBetterResult(a, b *CacheRecord) bool {
+	if a.Priority == 0 && b.Priority == 0 {
+		if pa, pb := a.importPriority(), b.importPriority(); pa != pb {
+			return pa > pb
+		}
+	}
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return a.ID < b.ID
+}
+
 type mergedExporter struct {
 	exporters []CacheExporter
 }
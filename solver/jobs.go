@@ -3,6 +3,7 @@ package solver
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -18,6 +19,15 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// logReplayTail is the number of log chunks of every vertex that are
+// replayed to status readers attaching to a running job
+const logReplayTail = 100
+
+func isLogProgress(p *progress.Progress) bool {
+	_, ok := p.Sys.(client.VertexLog)
+	return ok
+}
+
 // ResolveOpFunc finds an Op implementation for a Vertex
 type ResolveOpFunc func(Vertex, Builder) (Op, error)
 
@@ -54,6 +64,7 @@ type state struct {
 	vtx          Vertex
 	clientVertex client.Vertex
 	origDigest   digest.Digest // original LLB digest. TODO: probably better to use string ID so this isn't needed
+	pin          string        // resolved reference of a PinProvider op
 
 	mu    sync.Mutex
 	op    *sharedOp
@@ -237,6 +248,7 @@ type Job struct {
 
 	progressCloser func()
 	SessionID      string
+	createdAt      time.Time
 }
 
 type SolverOpt struct {
@@ -441,11 +453,12 @@ func (jl *Solver) NewJob(id string) (*Job, error) {
 	_, span := trace.NewNoopTracerProvider().Tracer("").Start(ctx, "")
 	j := &Job{
 		list:           jl,
-		pr:             progress.NewMultiReader(pr),
+		pr:             progress.NewMultiReader(pr, progress.WithLogTail(logReplayTail, isLogProgress)),
 		pw:             pw,
 		progressCloser: progressCloser,
 		span:           span,
 		id:             id,
+		createdAt:      time.Now(),
 	}
 	jl.jobs[id] = j
 
@@ -482,6 +495,20 @@ func (jl *Solver) Get(id string) (*Job, error) {
 	}
 }
 
+// Jobs returns all jobs currently known to the solver
+func (jl *Solver) Jobs() []*Job {
+	jl.mu.RLock()
+	defer jl.mu.RUnlock()
+	jobs := make([]*Job, 0, len(jl.jobs))
+	for _, j := range jl.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].createdAt.Before(jobs[k].createdAt)
+	})
+	return jobs
+}
+
 // called with solver lock
 func (jl *Solver) deleteIfUnreferenced(k digest.Digest, st *state) {
 	if len(st.jobs) == 0 && len(st.parents) == 0 {
@@ -495,6 +522,14 @@ func (jl *Solver) deleteIfUnreferenced(k digest.Digest, st *state) {
 	}
 }
 
+func (j *Job) ID() string {
+	return j.id
+}
+
+func (j *Job) CreatedAt() time.Time {
+	return j.createdAt
+}
+
 func (j *Job) Build(ctx context.Context, e Edge) (CachedResult, error) {
 	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
 		j.span = span
@@ -538,6 +573,23 @@ func (j *Job) Discard() error {
 	return nil
 }
 
+// Pins returns the resolved references of the ops of the job that implement
+// PinProvider by their original LLB digest
+func (j *Job) Pins() map[digest.Digest]string {
+	j.list.mu.Lock()
+	defer j.list.mu.Unlock()
+
+	pins := map[digest.Digest]string{}
+	for _, st := range j.list.actives {
+		st.mu.Lock()
+		if _, ok := st.jobs[j]; ok && st.pin != "" {
+			pins[st.origDigest] = st.pin
+		}
+		st.mu.Unlock()
+	}
+	return pins
+}
+
 func (j *Job) InContext(ctx context.Context, f func(context.Context, session.Group) error) error {
 	return f(progress.WithProgress(ctx, j.pw), session.NewGroup(j.SessionID))
 }
@@ -737,6 +789,10 @@ func (s *sharedOp) CacheMap(ctx context.Context, index int) (resp *cacheMapResp,
 			}()
 		}
 		res, done, err := op.CacheMap(ctx, s.st, len(s.cacheRes))
+		if err == nil {
+			res = withCacheTTL(res, s.st.vtx.Options().CacheTTL, time.Now())
+			s.updatePin(op)
+		}
 		complete := true
 		if err != nil {
 			select {
@@ -769,6 +825,19 @@ func (s *sharedOp) CacheMap(ctx context.Context, index int) (resp *cacheMapResp,
 	return &cacheMapResp{CacheMap: res.([]*CacheMap)[index], complete: s.cacheDone}, nil
 }
 
+// withCacheTTL returns cm with a digest that is unique for the time window
+// of duration ttl that now falls into, so that the cache of the op expires
+// at the end of the window
+func withCacheTTL(cm *CacheMap, ttl time.Duration, now time.Time) *CacheMap {
+	if cm == nil || ttl <= 0 {
+		return cm
+	}
+	out := *cm
+	window := now.UnixNano() / int64(ttl)
+	out.Digest = digest.FromBytes([]byte(fmt.Sprintf("%s:ttl:%d:%d", cm.Digest, int64(ttl), window)))
+	return &out
+}
+
 func (s *sharedOp) Exec(ctx context.Context, inputs []Result) (outputs []Result, exporters []ExportableCacheKey, err error) {
 	defer func() {
 		err = errdefs.WithOp(err, s.st.vtx.Sys())
@@ -837,6 +906,19 @@ func (s *sharedOp) Exec(ctx context.Context, inputs []Result) (outputs []Result,
 	return unwrapShared(r.execRes), r.execExporters, nil
 }
 
+// updatePin records the resolved reference of op if it is a PinProvider
+func (s *sharedOp) updatePin(op Op) {
+	p, ok := op.(PinProvider)
+	if !ok {
+		return
+	}
+	if pin := p.Pin(); pin != "" {
+		s.st.mu.Lock()
+		s.st.pin = pin
+		s.st.mu.Unlock()
+	}
+}
+
 func (s *sharedOp) getOp() (Op, error) {
 	s.opOnce.Do(func() {
 		s.subBuilder = s.st.builder()
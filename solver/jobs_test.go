@@ -1,6 +1,7 @@
 package solver
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -9,6 +10,7 @@ import (
 	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/client/llb"
 	"github.com/moby/buildkit/util/testutil/integration"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
 )
@@ -104,3 +106,61 @@ func (*parallelismSetterUnlimited) UpdateConfigFile(in string) string {
 }
 
 var maxParallelismUnlimited integration.ConfigUpdater = &parallelismSetterUnlimited{}
+
+func TestCacheTTL(t *testing.T) {
+	t.Parallel()
+
+	cm := &CacheMap{Digest: digest.FromString("op")}
+	require.Equal(t, cm, withCacheTTL(cm, 0, time.Now()))
+
+	ttl := 24 * time.Hour
+	day := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	morning := withCacheTTL(cm, ttl, day.Add(time.Hour))
+	evening := withCacheTTL(cm, ttl, day.Add(23*time.Hour))
+	next := withCacheTTL(cm, ttl, day.Add(25*time.Hour))
+
+	require.NotEqual(t, cm.Digest, morning.Digest)
+	require.Equal(t, morning.Digest, evening.Digest)
+	require.NotEqual(t, morning.Digest, next.Digest)
+	require.NotEqual(t, morning.Digest, withCacheTTL(cm, time.Hour, day.Add(time.Hour)).Digest)
+	require.Equal(t, digest.FromString("op"), cm.Digest)
+}
+
+func TestJobPins(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	s := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+	})
+	defer s.Close()
+
+	j0, err := s.NewJob("job0")
+	require.NoError(t, err)
+	defer j0.Discard()
+
+	v0 := &vertexPinned{vertex: vtx(vtxOpt{name: "v0", value: "result0"}), pin: "pin0"}
+	v1 := vtx(vtxOpt{name: "v1", value: "result1", inputs: []Edge{{Vertex: v0}}})
+
+	_, err = j0.Build(ctx, Edge{Vertex: v1})
+	require.NoError(t, err)
+	require.Equal(t, map[digest.Digest]string{v0.Digest(): "pin0"}, j0.Pins())
+
+	j1, err := s.NewJob("job1")
+	require.NoError(t, err)
+	defer j1.Discard()
+	require.Equal(t, map[digest.Digest]string{}, j1.Pins())
+}
+
+type vertexPinned struct {
+	*vertex
+	pin string
+}
+
+func (v *vertexPinned) Sys() interface{} {
+	return v
+}
+
+func (v *vertexPinned) Pin() string {
+	return v.pin
+}
@@ -3,6 +3,7 @@ package llbsolver
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,6 +21,7 @@ import (
 	"github.com/moby/buildkit/solver/pb"
 	"github.com/moby/buildkit/util/bklog"
 	"github.com/moby/buildkit/util/flightcontrol"
+	"github.com/moby/buildkit/util/optionstatus"
 	"github.com/moby/buildkit/worker"
 	digest "github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
@@ -34,6 +36,7 @@ type llbBridge struct {
 	cms                       map[string]solver.CacheManager
 	cmsMu                     sync.Mutex
 	sm                        *session.Manager
+	experimentalOptions       bool
 }
 
 func (b *llbBridge) loadResult(ctx context.Context, def *pb.Definition, cacheImports []gw.CacheOptionsEntry) (solver.CachedResult, error) {
@@ -51,10 +54,14 @@ func (b *llbBridge) loadResult(ctx context.Context, def *pb.Definition, cacheImp
 		if err != nil {
 			return nil, err
 		}
+		priority, err := cachePriority(im)
+		if err != nil {
+			return nil, err
+		}
 		b.cmsMu.Lock()
 		var cm solver.CacheManager
 		if prevCm, ok := b.cms[cmID]; !ok {
-			func(cmID string, im gw.CacheOptionsEntry) {
+			func(cmID string, im gw.CacheOptionsEntry, priority int) {
 				cm = newLazyCacheManager(cmID, func() (solver.CacheManager, error) {
 					var cmNew solver.CacheManager
 					if err := inBuilderContext(context.TODO(), b.builder, "importing cache manifest from "+cmID, "", func(ctx context.Context, g session.Group) error {
@@ -67,14 +74,18 @@ func (b *llbBridge) loadResult(ctx context.Context, def *pb.Definition, cacheImp
 							return err
 						}
 						cmNew, err = ci.Resolve(ctx, desc, cmID, w)
-						return err
+						if err != nil {
+							return err
+						}
+						solver.SetCachePriority(cmNew, priority)
+						return nil
 					}); err != nil {
 						bklog.G(ctx).Debugf("error while importing cache manifest from cmId=%s: %v", cmID, err)
 						return nil, err
 					}
 					return cmNew, nil
 				})
-			}(cmID, im)
+			}(cmID, im, priority)
 			b.cms[cmID] = cm
 		} else {
 			cm = prevCm
@@ -84,7 +95,12 @@ func (b *llbBridge) loadResult(ctx context.Context, def *pb.Definition, cacheImp
 	}
 	dpc := &detectPrunedCacheID{}
 
-	edge, err := Load(def, dpc.Load, ValidateEntitlements(ent), WithCacheSources(cms), NormalizeRuntimePlatforms(), WithValidateCaps())
+	templates, err := loadMountTemplates(b.builder)
+	if err != nil {
+		return nil, err
+	}
+
+	edge, err := loadScoped(def, mountTemplatesScope(templates), dpc.Load, ValidateEntitlements(ent), WithCacheSources(cms), NormalizeRuntimePlatforms(), WithValidateCaps())
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to load LLB")
 	}
@@ -114,6 +130,7 @@ func (b *llbBridge) Solve(ctx context.Context, req frontend.SolveRequest, sid st
 	}
 
 	if req.Definition != nil && req.Definition.Def != nil {
+		addProvenance(b.builder, req.Definition)
 		res = &frontend.Result{Ref: newResultProxy(b, req)}
 		if req.Evaluate {
 			_, err := res.Ref.Result(ctx)
@@ -124,6 +141,16 @@ func (b *llbBridge) Solve(ctx context.Context, req frontend.SolveRequest, sid st
 		if !ok {
 			return nil, errors.Errorf("invalid frontend: %s", req.Frontend)
 		}
+		// checked here so that the sub-solves of frontends are checked too
+		warnings, err := optionstatus.Check(optionstatus.Frontend(req.Frontend), req.FrontendOpt, b.experimentalOptions)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range warnings {
+			if err := logWarning(ctx, b.builder, w.String()); err != nil {
+				return nil, err
+			}
+		}
 		res, err = f.Solve(ctx, b, req.FrontendOpt, req.FrontendInputs, sid, b.sm)
 		if err != nil {
 			return nil, err
@@ -335,6 +362,22 @@ func newLazyCacheManager(id string, fn func() (solver.CacheManager, error)) solv
 	return lcm
 }
 
+// attrCachePriority is the attr of cache imports ranking their records when
+// several imports have records for the same step, see solver.SetCachePriority
+const attrCachePriority = "priority"
+
+func cachePriority(im gw.CacheOptionsEntry) (int, error) {
+	v, ok := im.Attrs[attrCachePriority]
+	if !ok || v == "" {
+		return 0, nil
+	}
+	p, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s of %s cache import", attrCachePriority, im.Type)
+	}
+	return p, nil
+}
+
 func cmKey(im gw.CacheOptionsEntry) (string, error) {
 	if im.Type == "registry" && im.Attrs["ref"] != "" {
 		return im.Attrs["ref"], nil
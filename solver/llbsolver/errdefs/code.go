@@ -0,0 +1,59 @@
+package errdefs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/containerd/containerd/remotes/docker"
+	remoteserrors "github.com/containerd/containerd/remotes/errors"
+	serrdefs "github.com/moby/buildkit/solver/errdefs"
+	"github.com/pkg/errors"
+)
+
+// WithErrorCode returns err with the code of its class of failure if it's
+// known, see solver/errdefs.GetCode. Out-of-memory kills are coded by the
+// executors, see executor/oci.OOMCounter.
+func WithErrorCode(err error) error {
+	if err == nil || serrdefs.GetCode(err) != "" {
+		return err
+	}
+	if code := errorCode(err); code != "" {
+		return serrdefs.WithCode(err, code)
+	}
+	return err
+}
+
+func errorCode(err error) string {
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) {
+		return serrdefs.CodeDiskFull
+	}
+	if errors.Is(err, docker.ErrInvalidAuthorization) {
+		return serrdefs.CodeRegistryAuth
+	}
+	var statusErr remoteserrors.ErrUnexpectedStatus
+	if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden) {
+		return serrdefs.CodeRegistryAuth
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && !isTLSError(err) {
+		return serrdefs.CodeNetwork
+	}
+	return ""
+}
+
+// isTLSError returns true if err is a failed TLS handshake or certificate
+// verification. They are returned wrapped in net.Error by the HTTP client
+// but are configuration errors that retrying doesn't fix.
+func isTLSError(err error) bool {
+	var (
+		unknownAuthorityErr x509.UnknownAuthorityError
+		certInvalidErr      x509.CertificateInvalidError
+		hostnameErr         x509.HostnameError
+		systemRootsErr      x509.SystemRootsError
+		recordHeaderErr     tls.RecordHeaderError
+	)
+	return errors.As(err, &unknownAuthorityErr) || errors.As(err, &certInvalidErr) || errors.As(err, &hostnameErr) || errors.As(err, &systemRootsErr) || errors.As(err, &recordHeaderErr)
+}
@@ -0,0 +1,51 @@
+package errdefs
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/containerd/containerd/remotes/docker"
+	remoteserrors "github.com/containerd/containerd/remotes/errors"
+	gatewayapi "github.com/moby/buildkit/frontend/gateway/pb"
+	serrdefs "github.com/moby/buildkit/solver/errdefs"
+	"github.com/moby/buildkit/util/grpcerrors"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithErrorCode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code string
+	}{
+		{errors.New("foo"), ""},
+		{&os.PathError{Op: "write", Path: "/foo", Err: syscall.ENOSPC}, serrdefs.CodeDiskFull},
+		{errors.Wrap(docker.ErrInvalidAuthorization, "failed to fetch oauth token"), serrdefs.CodeRegistryAuth},
+		{errors.Wrap(remoteserrors.ErrUnexpectedStatus{Status: "403 Forbidden", StatusCode: 403}, "failed to push"), serrdefs.CodeRegistryAuth},
+		{remoteserrors.ErrUnexpectedStatus{Status: "500 Internal Server Error", StatusCode: 500}, ""},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, serrdefs.CodeNetwork},
+		{&url.Error{Op: "Get", URL: "https://example.com/v2/", Err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}}, serrdefs.CodeNetwork},
+		{&url.Error{Op: "Get", URL: "https://example.com/v2/", Err: x509.UnknownAuthorityError{}}, ""},
+		{&url.Error{Op: "Get", URL: "https://example.com/v2/", Err: x509.HostnameError{Host: "example.com", Certificate: &x509.Certificate{}}}, ""},
+		// processes killed with SIGKILL aren't necessarily out of memory
+		{&ExecError{error: &gatewayapi.ExitError{ExitCode: 137}}, ""},
+		{&ExecError{error: serrdefs.WithCode(&gatewayapi.ExitError{ExitCode: 137}, serrdefs.CodeOOM)}, serrdefs.CodeOOM},
+		{&gatewayapi.ExitError{ExitCode: 1}, ""},
+		// codes set at the source aren't replaced
+		{serrdefs.WithCode(&net.DNSError{Err: "no such host"}, serrdefs.CodeFrontendCrash), serrdefs.CodeFrontendCrash},
+	} {
+		require.Equal(t, tc.code, serrdefs.GetCode(WithErrorCode(tc.err)), "%v", tc.err)
+	}
+	require.NoError(t, WithErrorCode(nil))
+}
+
+func TestErrorCodeGRPC(t *testing.T) {
+	err := WithErrorCode(errors.Wrap(syscall.ENOSPC, "failed to copy"))
+	err = grpcerrors.FromGRPC(grpcerrors.ToGRPC(err))
+	require.Equal(t, serrdefs.CodeDiskFull, serrdefs.GetCode(err))
+	require.Contains(t, err.Error(), "failed to copy")
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/moby/buildkit/snapshot"
 	"github.com/moby/buildkit/solver/llbsolver/ops/fileoptypes"
 	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/bklog"
 	"github.com/pkg/errors"
 	copy "github.com/tonistiigi/fsutil/copy"
 )
@@ -253,6 +254,9 @@ func cleanPath(s string) string {
 }
 
 type Backend struct {
+	// Previous is set to copy incrementally from the result of an earlier
+	// execution of the same copy
+	Previous *PreviousCopy
 }
 
 func (fb *Backend) Mkdir(ctx context.Context, m, user, group fileoptypes.Mount, action pb.FileActionMkDir) error {
@@ -323,6 +327,21 @@ func (fb *Backend) Copy(ctx context.Context, m1, m2, user, group fileoptypes.Mou
 		return errors.Errorf("invalid mount type %T", m2)
 	}
 
+	u, err := readUser(action.Owner, user, group)
+	if err != nil {
+		return err
+	}
+
+	if fb.Previous != nil && IncrementalCopySupported(action) {
+		err := fb.Previous.copy(ctx, mnt1, mnt2, action, u, mnt2.m.IdentityMapping())
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, errNotIncremental) {
+			bklog.G(ctx).Debugf("falling back to complete copy: %v", err)
+		}
+	}
+
 	lm := snapshot.LocalMounter(mnt1.m)
 	src, err := lm.Mount()
 	if err != nil {
@@ -337,10 +356,5 @@ func (fb *Backend) Copy(ctx context.Context, m1, m2, user, group fileoptypes.Mou
 	}
 	defer lm2.Unmount()
 
-	u, err := readUser(action.Owner, user, group)
-	if err != nil {
-		return err
-	}
-
 	return docopy(ctx, src, dest, action, u, mnt2.m.IdentityMapping())
 }
@@ -0,0 +1,93 @@
+package file
+
+import (
+	"strings"
+
+	"github.com/containerd/containerd/mount"
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/pkg/errors"
+)
+
+// PreviousCopy is the source and the output of an earlier execution of the
+// same copy action. On filesystems with reflinks, e.g. btrfs and xfs,
+// Backend.Copy only copies the files whose content checksums changed in the
+// source and clones the others from Dest. On other filesystems it runs a
+// complete copy.
+type PreviousCopy struct {
+	Src  cache.ImmutableRef
+	Dest cache.ImmutableRef
+}
+
+var errNotIncremental = errors.New("copy can't be executed incrementally")
+
+// IncrementalCopySupported returns true for copies of whole directories that
+// can be executed incrementally
+func IncrementalCopySupported(action pb.FileActionCopy) bool {
+	return action.DirCopyContents &&
+		!action.AttemptUnpackDockerCompatibility &&
+		len(action.IncludePatterns) == 0 &&
+		len(action.ExcludePatterns) == 0
+}
+
+// writableLayout returns the directory that the changes to a writable mount
+// are written to and the mounts of its read-only lower layers. lower is
+// empty if the changes are written to the mounted directory itself.
+func writableLayout(mounts []mount.Mount) (upper string, lower []mount.Mount, ok bool) {
+	if len(mounts) != 1 {
+		return "", nil, false
+	}
+	m := mounts[0]
+	switch m.Type {
+	case "bind", "rbind":
+		return m.Source, nil, true
+	case "overlay":
+		var lowerdirs string
+		var opts []string
+		for _, o := range m.Options {
+			switch {
+			case strings.HasPrefix(o, "upperdir="):
+				upper = strings.TrimPrefix(o, "upperdir=")
+			case strings.HasPrefix(o, "lowerdir="):
+				lowerdirs = strings.TrimPrefix(o, "lowerdir=")
+			case strings.HasPrefix(o, "workdir="):
+			default:
+				opts = append(opts, o)
+			}
+		}
+		if upper == "" || lowerdirs == "" {
+			return "", nil, false
+		}
+		if !strings.Contains(lowerdirs, ":") {
+			return upper, []mount.Mount{{Type: "bind", Source: lowerdirs, Options: []string{"ro", "rbind"}}}, true
+		}
+		return upper, []mount.Mount{{Type: "overlay", Source: "overlay", Options: append(opts, "lowerdir="+lowerdirs)}}, true
+	default:
+		return "", nil, false
+	}
+}
+
+// topLayer returns the directory with the files of the top layer of a
+// read-only mount
+func topLayer(mounts []mount.Mount) (string, bool) {
+	if len(mounts) != 1 {
+		return "", false
+	}
+	m := mounts[0]
+	switch m.Type {
+	case "bind", "rbind":
+		return m.Source, true
+	case "overlay":
+		for _, o := range m.Options {
+			if strings.HasPrefix(o, "upperdir=") {
+				return strings.TrimPrefix(o, "upperdir="), true
+			}
+		}
+		for _, o := range m.Options {
+			if strings.HasPrefix(o, "lowerdir=") {
+				return strings.SplitN(strings.TrimPrefix(o, "lowerdir="), ":", 2)[0], true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,443 @@
+package file
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/containerd/continuity/sysx"
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/moby/buildkit/cache/contenthash"
+	"github.com/moby/buildkit/snapshot"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/bklog"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	copy "github.com/tonistiigi/fsutil/copy"
+	"golang.org/x/sys/unix"
+)
+
+// copy executes action incrementally. The directory tree of the source is
+// recreated in the upper directory of dest. Regular files whose checksum
+// didn't change since the previous copy are cloned from its output, so their
+// data isn't copied, the other files are copied. The files are never shared
+// with the previous output, which is an immutable cache record. Only
+// checksums that were already computed for the cache keys are compared.
+// errNotIncremental is returned if the copy can't be executed this way, also
+// on filesystems without reflinks, where every file would be copied anyway.
+// The caller then runs a complete copy, which replaces everything written so
+// far.
+func (p *PreviousCopy) copy(ctx context.Context, src, dest *Mount, action pb.FileActionCopy, u *copy.User, idmap *idtools.IdentityMapping) error {
+	if src.ir == nil {
+		return errNotIncremental
+	}
+
+	destMounts, release, err := dest.m.Mount()
+	if err != nil {
+		return err
+	}
+	if release != nil {
+		defer release()
+	}
+	upper, lower, ok := writableLayout(destMounts)
+	if !ok {
+		return errNotIncremental
+	}
+
+	prevMountable, err := p.Dest.Mount(ctx, true, nil)
+	if err != nil {
+		return err
+	}
+	prevMounts, prevRelease, err := prevMountable.Mount()
+	if err != nil {
+		return err
+	}
+	if prevRelease != nil {
+		defer prevRelease()
+	}
+	prevTop, ok := topLayer(prevMounts)
+	if !ok || !reflinkSupported(upper, prevTop) {
+		return errNotIncremental
+	}
+
+	lm := snapshot.LocalMounter(src.m)
+	srcRoot, err := lm.Mount()
+	if err != nil {
+		return err
+	}
+	defer lm.Unmount()
+
+	srcPath := cleanPath(action.Src)
+	if action.AllowWildcard {
+		m, err := copy.ResolveWildcards(srcRoot, srcPath, action.FollowSymlink)
+		if err != nil {
+			return err
+		}
+		if len(m) != 1 {
+			return errNotIncremental
+		}
+		srcPath = m[0]
+	}
+	srcPath = filepath.Join("/", srcPath)
+	srcDir := filepath.Join(srcRoot, srcPath)
+	if fi, err := os.Lstat(srcDir); err != nil || !fi.IsDir() {
+		return errNotIncremental
+	}
+
+	lowerRoot := upper
+	if len(lower) > 0 {
+		lm := snapshot.LocalMounterWithMounts(lower)
+		lowerRoot, err = lm.Mount()
+		if err != nil {
+			return err
+		}
+		defer lm.Unmount()
+	}
+
+	cur, err := contenthash.FileChecksums(ctx, src.ir, srcPath)
+	if err != nil {
+		return err
+	}
+	prev, err := contenthash.FileChecksums(ctx, p.Src, srcPath)
+	if err != nil {
+		return err
+	}
+
+	ch, err := mapUserToChowner(u, idmap)
+	if err != nil {
+		return err
+	}
+	c := &incrementalCopier{
+		upper:   upper,
+		lower:   lowerRoot,
+		prevTop: prevTop,
+		cur:     cur,
+		prev:    prev,
+		chown:   ch,
+		utime:   timestampToTime(action.Timestamp),
+		inodes:  map[uint64]string{},
+	}
+	if m := int(action.Mode); m != -1 {
+		c.mode = &m
+	}
+
+	destPath := filepath.Join("/", action.Dest)
+	if !action.CreateDestPath {
+		if _, err := c.lstat(filepath.Dir(destPath)); err != nil {
+			return errNotIncremental
+		}
+	}
+	if err := c.mkdirAll(destPath); err != nil {
+		return err
+	}
+	if err := c.copyDir(ctx, srcDir, "", destPath); err != nil {
+		return err
+	}
+	bklog.G(ctx).Debugf("incremental copy of %s: %d files cloned, %d copied", action.Src, c.cloned, c.copied)
+	return nil
+}
+
+type incrementalCopier struct {
+	upper   string
+	lower   string
+	prevTop string
+	cur     map[string]digest.Digest
+	prev    map[string]digest.Digest
+	chown   copy.Chowner
+	utime   *time.Time
+	mode    *int
+	inodes  map[uint64]string
+	cloned  int
+	copied  int
+}
+
+// lstat returns the file info of p in the destination, written either in
+// this copy or in the lower layers
+func (c *incrementalCopier) lstat(p string) (os.FileInfo, error) {
+	fi, err := os.Lstat(filepath.Join(c.upper, p))
+	if err == nil || c.lower == c.upper || !os.IsNotExist(err) {
+		return fi, err
+	}
+	return os.Lstat(filepath.Join(c.lower, p))
+}
+
+// mkdirAll creates the destination directory and its parents. Directories of
+// the lower layers are copied up with their metadata.
+func (c *incrementalCopier) mkdirAll(p string) error {
+	if p == "/" {
+		return nil
+	}
+	if err := c.mkdirAll(filepath.Dir(p)); err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(filepath.Join(c.upper, p)); err == nil {
+		if !fi.IsDir() {
+			return errNotIncremental
+		}
+		return nil
+	}
+	target := filepath.Join(c.upper, p)
+	fi, err := os.Lstat(filepath.Join(c.lower, p))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Mkdir(target, 0755); err != nil {
+			return err
+		}
+		if err := copy.Chown(target, nil, c.chown); err != nil {
+			return err
+		}
+		return copy.Utimes(target, c.utime)
+	}
+	if !fi.IsDir() {
+		return errNotIncremental
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+	if err := os.Mkdir(target, fi.Mode()&os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Lchown(target, int(st.Uid), int(st.Gid)); err != nil {
+		return err
+	}
+	if err := os.Chmod(target, fi.Mode()); err != nil {
+		return err
+	}
+	copyXAttrs(target, filepath.Join(c.lower, p))
+	return utimesFrom(target, st)
+}
+
+func (c *incrementalCopier) copyDir(ctx context.Context, src, rel, target string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	fis, err := ioutil.ReadDir(src)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", src)
+	}
+	for _, fi := range fis {
+		childSrc := filepath.Join(src, fi.Name())
+		childRel := path.Join(rel, fi.Name())
+		childTarget := filepath.Join(target, fi.Name())
+		dst := filepath.Join(c.upper, childTarget)
+
+		existing, err := c.lstat(childTarget)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if existing != nil && existing.IsDir() != fi.IsDir() {
+			return errNotIncremental
+		}
+
+		switch {
+		case fi.IsDir():
+			if _, err := os.Lstat(dst); os.IsNotExist(err) {
+				if err := os.Mkdir(dst, fi.Mode()&os.ModePerm); err != nil {
+					return err
+				}
+			}
+			if err := c.copyDir(ctx, childSrc, childRel, childTarget); err != nil {
+				return err
+			}
+		case fi.Mode()&os.ModeType == 0:
+			if err := removeFile(dst); err != nil {
+				return err
+			}
+			ino, isLink := copy.GetLinkInfo(fi)
+			if first, ok := c.inodes[ino]; isLink && ok {
+				if err := os.Link(first, dst); err != nil {
+					return errors.Wrap(err, "failed to create hard link")
+				}
+				continue
+			}
+			if isLink {
+				c.inodes[ino] = dst
+			}
+			ok, err := c.clonePrevious(fi, childRel, childTarget)
+			if err != nil {
+				return err
+			}
+			if ok {
+				c.cloned++
+			} else {
+				if err := copyFile(childSrc, dst); err != nil {
+					return err
+				}
+				c.copied++
+			}
+		case fi.Mode()&os.ModeSymlink != 0:
+			if err := removeFile(dst); err != nil {
+				return err
+			}
+			link, err := os.Readlink(childSrc)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read link: %s", childSrc)
+			}
+			if err := os.Symlink(link, dst); err != nil {
+				return errors.Wrapf(err, "failed to create symlink: %s", dst)
+			}
+		default:
+			return errNotIncremental
+		}
+
+		if err := c.copyFileInfo(fi, dst); err != nil {
+			return err
+		}
+		copyXAttrs(dst, childSrc)
+	}
+	return nil
+}
+
+// clonePrevious clones the file from the output of the previous copy if its
+// checksum is unchanged and the filesystem supports reflinks. The clone
+// shares the data of the previous file until either is written.
+func (c *incrementalCopier) clonePrevious(fi os.FileInfo, rel, target string) (bool, error) {
+	dgst, ok := c.cur[rel]
+	if !ok || c.prev[rel] != dgst {
+		return false, nil
+	}
+	prevPath := filepath.Join(c.prevTop, target)
+	pfi, err := os.Lstat(prevPath)
+	if err != nil || !pfi.Mode().IsRegular() || pfi.Size() != fi.Size() {
+		return false, nil
+	}
+	return cloneFile(prevPath, filepath.Join(c.upper, target))
+}
+
+func (c *incrementalCopier) fileMode(fi os.FileInfo) os.FileMode {
+	m := fi.Mode()
+	if c.mode != nil {
+		m = (m & ^os.FileMode(0777)) | os.FileMode(*c.mode&0777)
+	}
+	return m
+}
+
+// copyFileInfo sets the same metadata as a complete copy
+func (c *incrementalCopier) copyFileInfo(fi os.FileInfo, p string) error {
+	st := fi.Sys().(*syscall.Stat_t)
+	if err := copy.Chown(p, &copy.User{UID: int(st.Uid), GID: int(st.Gid)}, c.chown); err != nil {
+		return errors.Wrapf(err, "failed to chown %s", p)
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		if err := os.Chmod(p, c.fileMode(fi)); err != nil {
+			return errors.Wrapf(err, "failed to chmod %s", p)
+		}
+	}
+	if c.utime != nil {
+		return copy.Utimes(p, c.utime)
+	}
+	return utimesFrom(p, st)
+}
+
+func utimesFrom(p string, st *syscall.Stat_t) error {
+	timespec := []unix.Timespec{unix.Timespec(copy.StatAtime(st)), unix.Timespec(copy.StatMtime(st))}
+	if err := unix.UtimesNanoAt(unix.AT_FDCWD, p, timespec, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return errors.Wrapf(err, "failed to utime %s", p)
+	}
+	return nil
+}
+
+func removeFile(p string) error {
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+var (
+	reflinksMu sync.Mutex
+	// reflinks records the reflink support of the filesystems by device
+	reflinks = map[uint64]bool{}
+)
+
+// reflinkSupported returns true if files of prev can be cloned to dir.
+// Reflinks can't cross filesystems. The support of a filesystem is detected
+// once, by cloning a probe file next to dir, so that the contents of dir
+// aren't changed.
+func reflinkSupported(dir, prev string) bool {
+	var st, pst unix.Stat_t
+	if err := unix.Stat(dir, &st); err != nil {
+		return false
+	}
+	if err := unix.Stat(prev, &pst); err != nil || st.Dev != pst.Dev {
+		return false
+	}
+	reflinksMu.Lock()
+	defer reflinksMu.Unlock()
+	if ok, found := reflinks[uint64(st.Dev)]; found {
+		return ok
+	}
+	ok := probeReflink(filepath.Dir(dir))
+	reflinks[uint64(st.Dev)] = ok
+	return ok
+}
+
+func probeReflink(dir string) bool {
+	f, err := ioutil.TempFile(dir, ".reflink-probe")
+	if err != nil {
+		return false
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write([]byte("probe")); err != nil {
+		return false
+	}
+	ok, err := cloneFile(f.Name(), f.Name()+".clone")
+	os.Remove(f.Name() + ".clone")
+	return ok && err == nil
+}
+
+// cloneFile creates dst as a reflink of src. false is returned if the
+// filesystem doesn't support reflinks.
+func cloneFile(src, dst string) (bool, error) {
+	s, err := os.Open(src)
+	if err != nil {
+		return false, nil
+	}
+	defer s.Close()
+	d, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to open target %s", dst)
+	}
+	if err := unix.IoctlFileClone(int(d.Fd()), int(s.Fd())); err != nil {
+		d.Close()
+		return false, removeFile(dst)
+	}
+	return true, d.Close()
+}
+
+func copyFile(src, dst string) error {
+	s, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open source %s", src)
+	}
+	defer s.Close()
+	d, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open target %s", dst)
+	}
+	if _, err := io.Copy(d, s); err != nil {
+		d.Close()
+		return errors.Wrapf(err, "failed to copy %s", src)
+	}
+	return d.Close()
+}
+
+// copyXAttrs ignores errors like the complete copy
+func copyXAttrs(dst, src string) {
+	keys, err := sysx.LListxattr(src)
+	if err != nil {
+		return
+	}
+	for _, k := range keys {
+		if v, err := sysx.LGetxattr(src, k); err == nil {
+			sysx.LSetxattr(dst, k, v, 0)
+		}
+	}
+}
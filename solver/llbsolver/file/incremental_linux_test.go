@@ -0,0 +1,186 @@
+package file
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/moby/buildkit/solver/pb"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+	copy "github.com/tonistiigi/fsutil/copy"
+)
+
+func TestIncrementalCopyDoesNotShareFiles(t *testing.T) {
+	t.Parallel()
+	src, prevTop, upper := t.TempDir(), t.TempDir(), t.TempDir()
+
+	for _, dir := range []string{src, prevTop} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "dest"), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "dest", "unchanged"), []byte("unchanged"), 0644))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(src, "dest", "changed"), []byte("new"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(prevTop, "dest", "changed"), []byte("old"), 0644))
+
+	c := &incrementalCopier{
+		upper:   upper,
+		lower:   upper,
+		prevTop: prevTop,
+		cur:     map[string]digest.Digest{"unchanged": digest.FromString("unchanged"), "changed": digest.FromString("new")},
+		prev:    map[string]digest.Digest{"unchanged": digest.FromString("unchanged"), "changed": digest.FromString("old")},
+		inodes:  map[uint64]string{},
+	}
+	require.NoError(t, c.mkdirAll("/dest"))
+	require.NoError(t, c.copyDir(context.TODO(), filepath.Join(src, "dest"), "", "/dest"))
+	require.Equal(t, 2, c.cloned+c.copied)
+
+	for name, expected := range map[string]string{"unchanged": "unchanged", "changed": "new"} {
+		dt, err := ioutil.ReadFile(filepath.Join(upper, "dest", name))
+		require.NoError(t, err)
+		require.Equal(t, expected, string(dt))
+	}
+
+	// writing to the new output doesn't change the previous output
+	p := filepath.Join(upper, "dest", "unchanged")
+	fi, err := os.Stat(p)
+	require.NoError(t, err)
+	pfi, err := os.Stat(filepath.Join(prevTop, "dest", "unchanged"))
+	require.NoError(t, err)
+	require.NotEqual(t, pfi.Sys().(*syscall.Stat_t).Ino, fi.Sys().(*syscall.Stat_t).Ino)
+	require.NoError(t, ioutil.WriteFile(p, []byte("modified"), 0644))
+	require.NoError(t, os.Chmod(p, 0600))
+	dt, err := ioutil.ReadFile(filepath.Join(prevTop, "dest", "unchanged"))
+	require.NoError(t, err)
+	require.Equal(t, "unchanged", string(dt))
+	pfi, err = os.Stat(filepath.Join(prevTop, "dest", "unchanged"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0644), pfi.Mode().Perm())
+}
+
+type fileMeta struct {
+	mode  os.FileMode
+	uid   uint32
+	gid   uint32
+	mtime int64
+	data  string
+}
+
+func readTree(t *testing.T, root string) map[string]fileMeta {
+	files := map[string]fileMeta{}
+	require.NoError(t, filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || p == root {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		require.NoError(t, err)
+		st := fi.Sys().(*syscall.Stat_t)
+		m := fileMeta{mode: fi.Mode(), uid: st.Uid, gid: st.Gid, mtime: fi.ModTime().UnixNano()}
+		switch {
+		case fi.Mode().IsRegular():
+			dt, err := ioutil.ReadFile(p)
+			require.NoError(t, err)
+			m.data = string(dt)
+		case fi.Mode()&os.ModeSymlink != 0:
+			m.data, err = os.Readlink(p)
+			require.NoError(t, err)
+		}
+		files[rel] = m
+		return nil
+	}))
+	return files
+}
+
+// TestIncrementalCopyMatchesCopy compares the incremental copy with the
+// complete copy of the same action
+func TestIncrementalCopyMatchesCopy(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to chown files")
+	}
+	t.Parallel()
+
+	src := t.TempDir()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "dir", "sub"), 0750))
+	for name, owner := range map[string]int{"dir/a": 1000, "dir/sub/b": 0, "dir/sub/c": 1001} {
+		p := filepath.Join(src, name)
+		require.NoError(t, ioutil.WriteFile(p, []byte(name), 0640))
+		require.NoError(t, os.Lchown(p, owner, owner+1))
+		require.NoError(t, os.Chtimes(p, mtime, mtime))
+	}
+	require.NoError(t, os.Symlink("a", filepath.Join(src, "dir", "link")))
+	require.NoError(t, os.Lchown(filepath.Join(src, "dir", "sub"), 1002, 1003))
+	require.NoError(t, os.Chtimes(filepath.Join(src, "dir", "sub"), mtime, mtime))
+
+	idmap := idtools.NewIDMappingsFromMaps(
+		[]idtools.IDMap{{ContainerID: 0, HostID: 100000, Size: 65536}},
+		[]idtools.IDMap{{ContainerID: 0, HostID: 100000, Size: 65536}},
+	)
+	for _, tc := range []struct {
+		name      string
+		user      *copy.User
+		idmap     *idtools.IdentityMapping
+		timestamp int64
+	}{
+		{name: "default", timestamp: -1},
+		{name: "chown", user: &copy.User{UID: 1234, GID: 5678}, timestamp: -1},
+		{name: "idmap", idmap: idmap, timestamp: -1},
+		{name: "chown-idmap", user: &copy.User{UID: 1, GID: 2}, idmap: idmap, timestamp: -1},
+		{name: "timestamp", timestamp: mtime.Add(time.Hour).UnixNano()},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			action := pb.FileActionCopy{
+				Src:             "/dir",
+				Dest:            "/dest",
+				DirCopyContents: true,
+				CreateDestPath:  true,
+				Mode:            -1,
+				Timestamp:       tc.timestamp,
+			}
+			complete := t.TempDir()
+			require.NoError(t, docopy(context.TODO(), src, complete, action, tc.user, tc.idmap))
+
+			upper := t.TempDir()
+			ch, err := mapUserToChowner(tc.user, tc.idmap)
+			require.NoError(t, err)
+			c := &incrementalCopier{
+				upper:   upper,
+				lower:   upper,
+				prevTop: t.TempDir(),
+				chown:   ch,
+				utime:   timestampToTime(action.Timestamp),
+				inodes:  map[uint64]string{},
+			}
+			require.NoError(t, c.mkdirAll("/dest"))
+			require.NoError(t, c.copyDir(context.TODO(), filepath.Join(src, "dir"), "", "/dest"))
+
+			expected := readTree(t, filepath.Join(complete, "dest"))
+			require.Equal(t, 5, len(expected))
+			require.Equal(t, expected, readTree(t, filepath.Join(upper, "dest")))
+		})
+	}
+}
+
+func TestReflinkProbe(t *testing.T) {
+	t.Parallel()
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "fs")
+	require.NoError(t, os.Mkdir(dir, 0755))
+
+	ok := reflinkSupported(dir, dir)
+	require.Equal(t, ok, reflinkSupported(dir, dir))
+	// the probe doesn't leave files behind
+	fis, err := ioutil.ReadDir(parent)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(fis))
+	fis, err = ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(fis))
+
+	require.False(t, reflinkSupported(dir, "/nonexistent"))
+}
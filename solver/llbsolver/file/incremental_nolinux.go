@@ -0,0 +1,15 @@
+// +build !linux
+
+package file
+
+import (
+	"context"
+
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/moby/buildkit/solver/pb"
+	copy "github.com/tonistiigi/fsutil/copy"
+)
+
+func (p *PreviousCopy) copy(ctx context.Context, src, dest *Mount, action pb.FileActionCopy, u *copy.User, idmap *idtools.IdentityMapping) error {
+	return errNotIncremental
+}
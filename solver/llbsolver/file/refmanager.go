@@ -30,10 +30,10 @@ func (rm *RefManager) Prepare(ctx context.Context, ref fileoptypes.Ref, readonly
 		if err != nil {
 			return nil, err
 		}
-		return &Mount{m: m, readonly: readonly}, nil
+		return &Mount{m: m, ir: ir, readonly: readonly}, nil
 	}
 
-	mr, err := rm.cm.New(ctx, ir, g, cache.WithDescription("fileop target"), cache.CachePolicyRetain)
+	mr, err := rm.cm.New(ctx, ir, g, cache.WithDescription("fileop target"), cache.WithOrigin(cache.OpTypeFile, ""), cache.CachePolicyRetain)
 	if err != nil {
 		return nil, err
 	}
@@ -70,6 +70,7 @@ func (rm *RefManager) Commit(ctx context.Context, mount fileoptypes.Mount) (file
 type Mount struct {
 	m        snapshot.Mountable
 	mr       cache.MutableRef
+	ir       cache.ImmutableRef
 	readonly bool
 }
 
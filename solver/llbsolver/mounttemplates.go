@@ -0,0 +1,73 @@
+package llbsolver
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/moby/buildkit/frontend"
+	"github.com/moby/buildkit/solver"
+	"github.com/pkg/errors"
+)
+
+// FrontendOptMountTemplates is the frontend attr of a solve that requests the
+// worker mount templates with the comma separated names to be mounted into
+// its build steps
+const FrontendOptMountTemplates = "mount-templates"
+
+const keyMountTemplates = "llb.mounttemplates"
+
+func parseMountTemplates(opt map[string]string) []string {
+	var names []string
+	for _, name := range strings.Split(opt[FrontendOptMountTemplates], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// mountTemplatesScope returns the scope of the vertexes of a solve that
+// requests the mount templates names. The vertexes of solves that request
+// different templates aren't shared, as the templates are resolved for the
+// solves of a vertex.
+func mountTemplatesScope(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	names = append([]string{}, names...)
+	sort.Strings(names)
+	return keyMountTemplates + "=" + strings.Join(names, ",")
+}
+
+// MountTemplates returns the names of the mount templates requested by the
+// solves that load vertexes with b
+func MountTemplates(b frontend.FrontendLLBBridge) ([]string, error) {
+	lb, ok := b.(*llbBridge)
+	if !ok {
+		return nil, nil
+	}
+	return loadMountTemplates(lb.builder)
+}
+
+func loadMountTemplates(b solver.Builder) ([]string, error) {
+	var names []string
+	seen := map[string]struct{}{}
+	err := b.EachValue(context.TODO(), keyMountTemplates, func(v interface{}) error {
+		requested, ok := v.([]string)
+		if !ok {
+			return errors.Errorf("invalid mount templates %T", v)
+		}
+		for _, name := range requested {
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				names = append(names, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
@@ -0,0 +1,47 @@
+package llbsolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moby/buildkit/solver"
+	"github.com/stretchr/testify/require"
+)
+
+type valuesBuilder struct {
+	solver.Builder
+	values map[string][]interface{}
+}
+
+func (b *valuesBuilder) EachValue(ctx context.Context, key string, fn func(interface{}) error) error {
+	for _, v := range b.values[key] {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestMountTemplates(t *testing.T) {
+	t.Parallel()
+
+	require.Nil(t, parseMountTemplates(map[string]string{}))
+	require.Equal(t, []string{"ca", "pip"}, parseMountTemplates(map[string]string{FrontendOptMountTemplates: "ca, pip,"}))
+
+	// vertexes shared by two solves get the templates of both
+	b := &valuesBuilder{values: map[string][]interface{}{
+		keyMountTemplates: {[]string{"ca", "pip"}, []string{"apt", "ca"}},
+	}}
+	names, err := MountTemplates(&llbBridge{builder: b})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ca", "pip", "apt"}, names)
+
+	names, err = MountTemplates(nil)
+	require.NoError(t, err)
+	require.Nil(t, names)
+
+	// the vertexes of solves are shared if they request the same templates
+	require.Equal(t, "", mountTemplatesScope(nil))
+	require.Equal(t, mountTemplatesScope([]string{"pip", "ca"}), mountTemplatesScope([]string{"ca", "pip"}))
+	require.NotEqual(t, mountTemplatesScope([]string{"ca"}), mountTemplatesScope([]string{"ca", "pip"}))
+}
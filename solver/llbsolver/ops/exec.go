@@ -10,6 +10,7 @@ import (
 	"path"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/containerd/containerd/platforms"
 	"github.com/moby/buildkit/cache"
@@ -23,6 +24,7 @@ import (
 	"github.com/moby/buildkit/solver/llbsolver/mounts"
 	"github.com/moby/buildkit/solver/pb"
 	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/buildkit/util/mountusage"
 	"github.com/moby/buildkit/util/progress/logs"
 	utilsystem "github.com/moby/buildkit/util/system"
 	"github.com/moby/buildkit/worker"
@@ -43,22 +45,39 @@ type execOp struct {
 	platform    *pb.Platform
 	numInputs   int
 	parallelism *semaphore.Weighted
+	vtx         digest.Digest
+	name        string
+	// ttlInputs are the inputs with a cache TTL
+	ttlInputs map[int]struct{}
+	// mountTemplates are the worker mount templates of the solves of the
+	// op. They are part of the cache key with the digests of their contents.
+	mountTemplates []executor.MountTemplate
 }
 
-func NewExecOp(v solver.Vertex, op *pb.Op_Exec, platform *pb.Platform, cm cache.Manager, parallelism *semaphore.Weighted, sm *session.Manager, md *metadata.Store, exec executor.Executor, w worker.Worker) (solver.Op, error) {
+func NewExecOp(v solver.Vertex, op *pb.Op_Exec, platform *pb.Platform, cm cache.Manager, parallelism *semaphore.Weighted, sm *session.Manager, md *metadata.Store, exec executor.Executor, mountTemplates []executor.MountTemplate, w worker.Worker) (solver.Op, error) {
 	if err := llbsolver.ValidateOp(&pb.Op{Op: op}); err != nil {
 		return nil, err
 	}
 	name := fmt.Sprintf("exec %s", strings.Join(op.Exec.Meta.Args, " "))
+	ttlInputs := map[int]struct{}{}
+	for i, inp := range v.Inputs() {
+		if inp.Vertex.Options().CacheTTL > 0 {
+			ttlInputs[i] = struct{}{}
+		}
+	}
 	return &execOp{
-		op:          op.Exec,
-		mm:          mounts.NewMountManager(name, cm, sm, md),
-		cm:          cm,
-		exec:        exec,
-		numInputs:   len(v.Inputs()),
-		w:           w,
-		platform:    platform,
-		parallelism: parallelism,
+		op:             op.Exec,
+		mm:             mounts.NewMountManager(name, cm, sm, md),
+		cm:             cm,
+		exec:           exec,
+		numInputs:      len(v.Inputs()),
+		w:              w,
+		platform:       platform,
+		parallelism:    parallelism,
+		vtx:            v.Digest(),
+		name:           v.Name(),
+		ttlInputs:      ttlInputs,
+		mountTemplates: mountTemplates,
 	}, nil
 }
 
@@ -116,18 +135,39 @@ func (e *execOp) CacheMap(ctx context.Context, g session.Group, index int) (*sol
 		op.Mounts = nil
 	}
 
+	var currentOS string
+	if e.platform != nil {
+		currentOS = e.platform.OS
+	}
+
+	var templates []string
+	for _, t := range e.mountTemplates {
+		dgst, err := t.Digest()
+		if err != nil {
+			return nil, false, err
+		}
+		templates = append(templates, t.Name+":"+t.Dest+":"+dgst.String())
+		for _, env := range t.Env {
+			templates = append(templates, t.Name+":env:"+env)
+		}
+	}
+
 	dt, err := json.Marshal(struct {
-		Type    string
-		Exec    *pb.ExecOp
-		OS      string
-		Arch    string
-		Variant string `json:",omitempty"`
+		Type           string
+		Exec           *pb.ExecOp
+		OS             string
+		Arch           string
+		Variant        string   `json:",omitempty"`
+		MountTemplates []string `json:",omitempty"`
+		DefaultPath    string   `json:",omitempty"`
 	}{
-		Type:    execCacheType,
-		Exec:    &op,
-		OS:      p.OS,
-		Arch:    p.Architecture,
-		Variant: p.Variant,
+		Type:           execCacheType,
+		Exec:           &op,
+		OS:             p.OS,
+		Arch:           p.Architecture,
+		Variant:        p.Variant,
+		MountTemplates: templates,
+		DefaultPath:    cacheDefaultPath(op.Meta.Env, e.w.Labels(), currentOS),
 	})
 	if err != nil {
 		return nil, false, err
@@ -155,7 +195,10 @@ func (e *execOp) CacheMap(ctx context.Context, g session.Group, index int) (*sol
 			}
 			cm.Deps[i].Selector = digest.FromBytes(bytes.Join(dgsts, []byte{0}))
 		}
-		if !dep.NoContentBasedHash {
+		// the cache keys of inputs with a TTL change with every window, so
+		// the op is cached by their contents too to keep its cache if they
+		// didn't change
+		if _, ok := e.ttlInputs[i]; !dep.NoContentBasedHash || ok {
 			cm.Deps[i].ComputeDigestFunc = llbsolver.NewContentHashFunc(toSelectors(dedupePaths(dep.Selectors)))
 		}
 		cm.Deps[i].PreprocessFunc = llbsolver.UnlazyResultFunc
@@ -233,6 +276,22 @@ func addDefaultEnvvar(env []string, k, v string) []string {
 	return append(env, k+"="+v)
 }
 
+// cacheDefaultPath returns the default PATH of the worker that is added to env
+// if it has no PATH and the default differs from the built-in one. Keys of
+// execs using the built-in default don't change.
+func cacheDefaultPath(env []string, labels map[string]string, os string) string {
+	for _, e := range env {
+		if strings.HasPrefix(e, "PATH=") {
+			return ""
+		}
+	}
+	p := utilsystem.DefaultsFromLabels(labels).DefaultPathEnv(os)
+	if p == utilsystem.DefaultPathEnv(os) {
+		return ""
+	}
+	return p
+}
+
 func (e *execOp) Exec(ctx context.Context, g session.Group, inputs []solver.Result) (results []solver.Result, err error) {
 	refs := make([]*worker.WorkerRef, len(inputs))
 	for i, inp := range inputs {
@@ -243,9 +302,10 @@ func (e *execOp) Exec(ctx context.Context, g session.Group, inputs []solver.Resu
 		}
 	}
 
+	var dumps *coreDumps
 	p, err := gateway.PrepareMounts(ctx, e.mm, e.cm, g, e.op.Meta.Cwd, e.op.Mounts, refs, func(m *pb.Mount, ref cache.ImmutableRef) (cache.MutableRef, error) {
 		desc := fmt.Sprintf("mount %s from exec %s", m.Dest, strings.Join(e.op.Meta.Args, " "))
-		return e.cm.New(ctx, ref, g, cache.WithDescription(desc))
+		return e.cm.New(ctx, ref, g, cache.WithDescription(desc), cache.WithOrigin(cache.OpTypeExec, ""))
 	})
 	defer func() {
 		if err != nil {
@@ -273,8 +333,16 @@ func (e *execOp) Exec(ctx context.Context, g session.Group, inputs []solver.Resu
 					execMounts[active.MountIndex] = worker.NewWorkerRefResult(ref, e.w)
 				}
 			}
+			// the core dumps are kept after the mounts of the op
+			res, cerr := dumps.result(ctx, e.w)
+			if cerr != nil {
+				err = errors.Wrapf(err, "error committing core dumps: %s", cerr)
+			} else if res != nil {
+				execMounts = append(execMounts, res)
+			}
 			err = errdefs.WithExecError(err, execInputs, execMounts)
 		} else {
+			dumps.release()
 			// Only release actives if err is nil.
 			for i := len(p.Actives) - 1; i >= 0; i-- { // call in LIFO order
 				p.Actives[i].Ref.Release(context.TODO())
@@ -309,6 +377,21 @@ func (e *execOp) Exec(ctx context.Context, g session.Group, inputs []solver.Resu
 		bklog.G(ctx).Warn(err.Error()) // TODO: remove this with pull support
 	}
 
+	for _, t := range e.mountTemplates {
+		p.Mounts = append(p.Mounts, t.Mount())
+	}
+
+	if e.op.Meta.CoreDumpSize > 0 {
+		desc := fmt.Sprintf("core dumps from exec %s", strings.Join(e.op.Meta.Args, " "))
+		dumps, err = newCoreDumps(ctx, e.cm, g, e.op.Meta.Cwd, desc)
+		if err != nil {
+			return nil, err
+		}
+		if m, ok := dumps.mount(); ok {
+			p.Mounts = append(p.Mounts, m)
+		}
+	}
+
 	meta := executor.Meta{
 		Args:           e.op.Meta.Args,
 		Env:            e.op.Meta.Env,
@@ -319,6 +402,8 @@ func (e *execOp) Exec(ctx context.Context, g session.Group, inputs []solver.Resu
 		ExtraHosts:     extraHosts,
 		NetMode:        e.op.Network,
 		SecurityMode:   e.op.Security,
+		CoreDumpSize:   e.op.Meta.CoreDumpSize,
+		CheckpointKey:  solver.ExecCacheKeyOf(ctx).String(),
 	}
 
 	if e.op.Meta.ProxyEnv != nil {
@@ -328,18 +413,51 @@ func (e *execOp) Exec(ctx context.Context, g session.Group, inputs []solver.Resu
 	if e.platform != nil {
 		currentOS = e.platform.OS
 	}
-	meta.Env = addDefaultEnvvar(meta.Env, "PATH", utilsystem.DefaultPathEnv(currentOS))
+	meta.Env = addDefaultEnvvar(meta.Env, "PATH", utilsystem.DefaultsFromLabels(e.w.Labels()).DefaultPathEnv(currentOS))
+	for _, t := range e.mountTemplates {
+		for _, env := range t.Env {
+			parts := strings.SplitN(env, "=", 2)
+			if len(parts) == 2 {
+				meta.Env = addDefaultEnvvar(meta.Env, parts[0], parts[1])
+			}
+		}
+	}
+
+	done := mountusage.Default.Register(e.usageStep(g, p))
+	defer done()
 
 	stdout, stderr := logs.NewLogStreams(ctx, os.Getenv("BUILDKIT_DEBUG_EXEC_OUTPUT") == "1")
 	defer stdout.Close()
 	defer stderr.Close()
 
-	execErr := e.exec.Run(ctx, "", p.Root, p.Mounts, executor.ProcessInfo{
-		Meta:   meta,
-		Stdin:  nil,
-		Stdout: stdout,
-		Stderr: stderr,
-	}, nil)
+	var outputs []cache.MutableRef
+	for _, out := range p.OutputRefs {
+		if mutable, ok := out.Ref.(cache.MutableRef); ok {
+			outputs = append(outputs, mutable)
+		}
+	}
+	start := time.Now()
+	execErr := cache.LimitSize(ctx, outputs, func(ctx context.Context) error {
+		return e.exec.Run(ctx, "", p.Root, p.Mounts, executor.ProcessInfo{
+			Meta:   meta,
+			Stdin:  nil,
+			Stdout: stdout,
+			Stderr: stderr,
+		}, nil)
+	})
+	done()
+	var sizeErr *cache.RecordSizeError
+	if errors.As(execErr, &sizeErr) {
+		return nil, execErr
+	}
+	if execErr != nil && dumps != nil {
+		msg, err := dumps.describe(ctx, append([]executor.Mount{p.Root}, p.Mounts...), execErr, start)
+		if err != nil {
+			bklog.G(ctx).Warnf("failed to look up core dumps: %v", err)
+		} else if msg != "" {
+			fmt.Fprintln(stderr, msg)
+		}
+	}
 
 	for i, out := range p.OutputRefs {
 		if mutable, ok := out.Ref.(cache.MutableRef); ok {
@@ -357,6 +475,38 @@ func (e *execOp) Exec(ctx context.Context, g session.Group, inputs []solver.Resu
 	return results, errors.Wrapf(execErr, "process %q did not complete successfully", strings.Join(e.op.Meta.Args, " "))
 }
 
+// usageStep returns the writable mounts of p for the debug listing of the
+// disk usage of the running steps
+func (e *execOp) usageStep(g session.Group, p gateway.PreparedMounts) mountusage.Step {
+	s := mountusage.Step{
+		Vertex: e.vtx,
+		Name:   e.name,
+	}
+	if g != nil {
+		iter := g.SessionIterator()
+		for id := iter.NextSession(); id != ""; id = iter.NextSession() {
+			s.Sessions = append(s.Sessions, id)
+		}
+	}
+	add := func(ref cache.MutableRef, idx int) {
+		m := e.op.Mounts[idx]
+		s.Mounts = append(s.Mounts, mountusage.Mount{
+			Ref:  ref,
+			Dest: m.Dest,
+			Type: strings.ToLower(m.MountType.String()),
+		})
+	}
+	for _, o := range p.OutputRefs {
+		if mutable, ok := o.Ref.(cache.MutableRef); ok {
+			add(mutable, o.MountIndex)
+		}
+	}
+	for _, a := range p.Actives {
+		add(a.Ref, a.MountIndex)
+	}
+	return s
+}
+
 func proxyEnvList(p *pb.ProxyEnv) []string {
 	out := []string{}
 	if v := p.HttpProxy; v != "" {
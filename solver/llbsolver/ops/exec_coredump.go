@@ -0,0 +1,246 @@
+package ops
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containerd/continuity/fs"
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/executor"
+	gatewayapi "github.com/moby/buildkit/frontend/gateway/pb"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/snapshot"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/worker"
+	"github.com/pkg/errors"
+)
+
+const corePatternPath = "/proc/sys/kernel/core_pattern"
+
+// coreDumpSignals are the signals that dump the core of a process by default
+var coreDumpSignals = map[uint32]struct{}{
+	3:  {}, // SIGQUIT
+	4:  {}, // SIGILL
+	5:  {}, // SIGTRAP
+	6:  {}, // SIGABRT
+	7:  {}, // SIGBUS
+	8:  {}, // SIGFPE
+	11: {}, // SIGSEGV
+	24: {}, // SIGXCPU
+	25: {}, // SIGXFSZ
+	31: {}, // SIGSYS
+}
+
+// coreDumps captures the core dumps of the processes of an exec. The kernel
+// resolves the core_pattern of the host in the mount namespace of the
+// crashing process, so dumps with an absolute pattern are written to a
+// scratch mount at the directory of the pattern, which is kept as the last
+// mount of the exec error if a dump was written. Dumps with a relative
+// pattern are written to the working directory in the mounts of the exec.
+type coreDumps struct {
+	pattern string
+	// dir is the directory of the dumps in the container
+	dir string
+	// ref is the scratch mount at dir, if any
+	ref cache.MutableRef
+	// written is set if describe found dumps in ref
+	written bool
+	g       session.Group
+}
+
+func newCoreDumps(ctx context.Context, cm cache.Manager, g session.Group, cwd, desc string) (*coreDumps, error) {
+	dt, err := ioutil.ReadFile(corePatternPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "core dumps enabled, but the core pattern could not be read")
+	}
+	d := parseCorePattern(strings.TrimSpace(string(dt)), cwd)
+	if d.pipe() || d.dir == "/" || !path.IsAbs(d.pattern) {
+		return d, nil
+	}
+	d.g = g
+	d.ref, err = cm.New(ctx, nil, g, cache.WithDescription(desc))
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func parseCorePattern(pattern, cwd string) *coreDumps {
+	if pattern == "" {
+		pattern = "core"
+	}
+	if strings.HasPrefix(pattern, "|") {
+		return &coreDumps{pattern: pattern}
+	}
+	dir := path.Join("/", cwd)
+	if path.IsAbs(pattern) {
+		dir = path.Dir(pattern)
+	}
+	return &coreDumps{pattern: pattern, dir: dir}
+}
+
+func (d *coreDumps) pipe() bool {
+	return strings.HasPrefix(d.pattern, "|")
+}
+
+// mount returns the scratch mount of the dumps if the exec needs one
+func (d *coreDumps) mount() (executor.Mount, bool) {
+	if d == nil || d.ref == nil {
+		return executor.Mount{}, false
+	}
+	return executor.Mount{Src: d, Dest: d.dir}, true
+}
+
+// Mount mounts the scratch mount of the dumps
+func (d *coreDumps) Mount(ctx context.Context, readonly bool) (snapshot.Mountable, error) {
+	return d.ref.Mount(ctx, readonly, d.g)
+}
+
+// describe returns the message for the failed exec that ended with execErr
+// at the dumps written since start, or an empty string if there are none
+func (d *coreDumps) describe(ctx context.Context, mounts []executor.Mount, execErr error, start time.Time) (string, error) {
+	if d.pipe() {
+		var exitErr *gatewayapi.ExitError
+		if !errors.As(execErr, &exitErr) || exitErr.ExitCode <= 128 {
+			return "", nil
+		}
+		if _, ok := coreDumpSignals[exitErr.ExitCode-128]; !ok {
+			return "", nil
+		}
+		return fmt.Sprintf("core dumps are handled by %q on the host and can't be captured in the build", strings.TrimPrefix(d.pattern, "|")), nil
+	}
+	files, err := d.find(ctx, mounts, start)
+	if err != nil || len(files) == 0 {
+		return "", err
+	}
+	where := "in the mounts of the failed step"
+	if d.ref != nil {
+		d.written = true
+		where = "in the core dump mount of the failed step"
+	}
+	return fmt.Sprintf("core dumps were written to %s %s", strings.Join(files, ", "), where), nil
+}
+
+// find returns the paths of the dumps written since start
+func (d *coreDumps) find(ctx context.Context, mounts []executor.Mount, start time.Time) ([]string, error) {
+	m, sub := d.source(mounts)
+	if m == nil {
+		return nil, nil
+	}
+	mountable, err := m.Mount(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	lm := snapshot.LocalMounter(mountable)
+	root, err := lm.Mount()
+	if err != nil {
+		return nil, err
+	}
+	defer lm.Unmount()
+
+	dir, err := fs.RootPath(root, sub)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, corePatternGlob(path.Base(d.pattern))))
+	if err != nil {
+		return nil, err
+	}
+	// file times come from the coarse clock of the kernel, which may lag
+	// behind start
+	start = start.Add(-time.Second)
+	var files []string
+	for _, p := range matches {
+		fi, err := os.Lstat(p)
+		if err != nil || !fi.Mode().IsRegular() || fi.ModTime().Before(start) {
+			continue
+		}
+		files = append(files, path.Join(d.dir, filepath.Base(p)))
+	}
+	return files, nil
+}
+
+// source returns the mount that d.dir is in and the path of d.dir in it
+func (d *coreDumps) source(mounts []executor.Mount) (executor.Mountable, string) {
+	if d.ref != nil {
+		return d, "/"
+	}
+	var src *executor.Mount
+	for i, m := range mounts {
+		dest := path.Join("/", m.Dest)
+		if dest != "/" && d.dir != dest && !strings.HasPrefix(d.dir, dest+"/") {
+			continue
+		}
+		if src == nil || len(dest) >= len(path.Join("/", src.Dest)) {
+			src = &mounts[i]
+		}
+	}
+	if src == nil || src.Src == nil {
+		return nil, ""
+	}
+	rel := strings.TrimPrefix(d.dir, path.Join("/", src.Dest))
+	return src.Src, path.Join("/", src.Selector, rel)
+}
+
+// result commits the scratch mount of the dumps if any were written to it, to
+// be kept in the exec error. Otherwise the scratch mount is released.
+func (d *coreDumps) result(ctx context.Context, w worker.Worker) (solver.Result, error) {
+	if d == nil || d.ref == nil {
+		return nil, nil
+	}
+	if !d.written {
+		return nil, d.release()
+	}
+	mref := d.ref
+	d.ref = nil
+	ref, err := mref.Commit(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error committing %s", mref.ID())
+	}
+	return worker.NewWorkerRefResult(ref, w), nil
+}
+
+func (d *coreDumps) release() error {
+	if d == nil || d.ref == nil {
+		return nil
+	}
+	err := d.ref.Release(context.TODO())
+	d.ref = nil
+	return err
+}
+
+// corePatternGlob returns the glob of the file names of the core pattern
+// template p. The specifiers of the template match any text, which includes
+// the pid that the kernel appends if core_uses_pid is set.
+func corePatternGlob(p string) string {
+	var sb strings.Builder
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '%':
+			if i+1 < len(p) && p[i+1] == '%' {
+				sb.WriteByte('%')
+				i++
+				continue
+			}
+			i++
+			if !strings.HasSuffix(sb.String(), "*") {
+				sb.WriteByte('*')
+			}
+		case '*', '?', '[', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	if !strings.HasSuffix(sb.String(), "*") {
+		sb.WriteString("*")
+	}
+	return sb.String()
+}
@@ -1,8 +1,19 @@
 package ops
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/containerd/containerd/mount"
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/moby/buildkit/executor"
+	gatewayapi "github.com/moby/buildkit/frontend/gateway/pb"
+	"github.com/moby/buildkit/snapshot"
+	utilsystem "github.com/moby/buildkit/util/system"
 	"github.com/stretchr/testify/require"
 )
 
@@ -25,3 +36,83 @@ func TestDedupPaths(t *testing.T) {
 	res = dedupePaths([]string{"foo/bar/baz", "foo/bara", "foo/bar/bax", "foo/bar"})
 	require.Equal(t, []string{"foo/bar", "foo/bara"}, res)
 }
+
+func TestParseCorePattern(t *testing.T) {
+	d := parseCorePattern("", "src")
+	require.Equal(t, "core", d.pattern)
+	require.Equal(t, "/src", d.dir)
+	d = parseCorePattern("/tmp/cores/core.%e", "/src")
+	require.Equal(t, "/tmp/cores", d.dir)
+	d = parseCorePattern("|/usr/lib/systemd/systemd-coredump %P", "/")
+	require.True(t, d.pipe())
+}
+
+func TestCorePatternGlob(t *testing.T) {
+	require.Equal(t, "core*", corePatternGlob("core"))
+	require.Equal(t, "core.*.*", corePatternGlob("core.%e.%p"))
+	require.Equal(t, "core%*", corePatternGlob("core%%"))
+	require.Equal(t, `core\[*`, corePatternGlob("core[%t"))
+}
+
+func TestDescribeCoreDumps(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub/dir"), 0755))
+	old := filepath.Join(src, "sub/dir/core.1")
+	require.NoError(t, ioutil.WriteFile(old, []byte("old"), 0644))
+	start := time.Now()
+	require.NoError(t, os.Chtimes(old, start.Add(-time.Hour), start.Add(-time.Hour)))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(src, "sub/dir/core.2"), []byte("dump"), 0644))
+
+	mounts := []executor.Mount{
+		{Src: bindMountable(root)},
+		{Src: bindMountable(src), Dest: "/src", Selector: "sub"},
+	}
+	execErr := &gatewayapi.ExitError{ExitCode: 139}
+
+	msg, err := parseCorePattern("core.%p", "/src/dir").describe(context.TODO(), mounts, execErr, start)
+	require.NoError(t, err)
+	require.Equal(t, "core dumps were written to /src/dir/core.2 in the mounts of the failed step", msg)
+
+	// nothing is reported if no dump was written
+	msg, err = parseCorePattern("core.%p", "/").describe(context.TODO(), mounts, execErr, start)
+	require.NoError(t, err)
+	require.Equal(t, "", msg)
+
+	// pipes are only reported for processes killed by a signal that dumps
+	// core
+	d := parseCorePattern("|/usr/lib/systemd/systemd-coredump %P", "/")
+	msg, err = d.describe(context.TODO(), mounts, execErr, start)
+	require.NoError(t, err)
+	require.Contains(t, msg, "can't be captured")
+	msg, err = d.describe(context.TODO(), mounts, &gatewayapi.ExitError{ExitCode: 1}, start)
+	require.NoError(t, err)
+	require.Equal(t, "", msg)
+}
+
+type bindMountable string
+
+func (m bindMountable) Mount(ctx context.Context, readonly bool) (snapshot.Mountable, error) {
+	return bindMount(m), nil
+}
+
+type bindMount string
+
+func (m bindMount) Mount() ([]mount.Mount, func() error, error) {
+	return []mount.Mount{{Type: "bind", Source: string(m), Options: []string{"rbind"}}}, func() error { return nil }, nil
+}
+
+func (m bindMount) IdentityMapping() *idtools.IdentityMapping {
+	return nil
+}
+
+func TestCacheDefaultPath(t *testing.T) {
+	labels := map[string]string{utilsystem.LabelDefaultPathPrefix + "linux": "/custom/bin"}
+	require.Equal(t, "/custom/bin", cacheDefaultPath([]string{"FOO=bar"}, labels, "linux"))
+	require.Equal(t, "", cacheDefaultPath([]string{"PATH=/bin"}, labels, "linux"))
+
+	// the built-in default keeps the existing cache keys
+	require.Equal(t, "", cacheDefaultPath(nil, nil, "linux"))
+	require.Equal(t, "", cacheDefaultPath(nil, map[string]string{utilsystem.LabelDefaultPathPrefix + "linux": utilsystem.DefaultPathEnv("linux")}, "linux"))
+}
@@ -19,20 +19,27 @@ import (
 	"github.com/moby/buildkit/solver/llbsolver/file"
 	"github.com/moby/buildkit/solver/llbsolver/ops/fileoptypes"
 	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/bklog"
 	"github.com/moby/buildkit/util/flightcontrol"
 	"github.com/moby/buildkit/worker"
 	digest "github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
 )
 
-const fileCacheType = "buildkit.file.v0"
+const (
+	fileCacheType        = "buildkit.file.v0"
+	incrementalCopyIndex = "fileop.copy:"
+)
 
 type fileOp struct {
 	op          *pb.FileOp
 	md          *metadata.Store
+	cm          cache.Manager
 	w           worker.Worker
+	backend     *file.Backend
 	solver      *FileOpSolver
 	numInputs   int
 	parallelism *semaphore.Weighted
@@ -42,12 +49,15 @@ func NewFileOp(v solver.Vertex, op *pb.Op_File, cm cache.Manager, parallelism *s
 	if err := llbsolver.ValidateOp(&pb.Op{Op: op}); err != nil {
 		return nil, err
 	}
+	backend := &file.Backend{}
 	return &fileOp{
 		op:          op.File,
 		md:          md,
+		cm:          cm,
 		numInputs:   len(v.Inputs()),
 		w:           w,
-		solver:      NewFileOpSolver(w, &file.Backend{}, file.NewRefManager(cm)),
+		backend:     backend,
+		solver:      NewFileOpSolver(w, backend, file.NewRefManager(cm)),
 		parallelism: parallelism,
 	}, nil
 }
@@ -169,6 +179,18 @@ func (f *fileOp) Exec(ctx context.Context, g session.Group, inputs []solver.Resu
 		inpRefs = append(inpRefs, workerRef.ImmutableRef)
 	}
 
+	key, src := f.incrementalCopyKey(inpRefs)
+	if key != "" {
+		if prev := f.loadPreviousCopy(ctx, key); prev != nil {
+			defer prev.Src.Release(context.TODO())
+			defer prev.Dest.Release(context.TODO())
+			f.backend.Previous = prev
+			defer func() {
+				f.backend.Previous = nil
+			}()
+		}
+	}
+
 	outs, err := f.solver.Solve(ctx, inpRefs, f.op.Actions, g)
 	if err != nil {
 		return nil, err
@@ -179,9 +201,89 @@ func (f *fileOp) Exec(ctx context.Context, g session.Group, inputs []solver.Resu
 		outResults = append(outResults, worker.NewWorkerRefResult(out.(cache.ImmutableRef), f.w))
 	}
 
+	if key != "" && len(outs) == 1 {
+		if err := setPreviousCopy(outs[0].(cache.ImmutableRef).Metadata(), key, src.ID()); err != nil {
+			bklog.G(ctx).Warnf("failed to record copy result: %v", err)
+		}
+	}
+
 	return outResults, nil
 }
 
+// incrementalCopyKey returns the key that the results of a single copy action
+// are recorded with so that a later execution of the same copy with changed
+// inputs can reuse the unchanged files. It also returns the source of the copy.
+func (f *fileOp) incrementalCopyKey(inputs []fileoptypes.Ref) (string, cache.ImmutableRef) {
+	if len(f.op.Actions) != 1 {
+		return "", nil
+	}
+	action := f.op.Actions[0]
+	cp, ok := action.Action.(*pb.FileAction_Copy)
+	if !ok || action.Output != 0 {
+		return "", nil
+	}
+	if !file.IncrementalCopySupported(*cp.Copy) {
+		return "", nil
+	}
+	if action.Input < 0 || int(action.Input) >= len(inputs) || action.SecondaryInput < 0 || int(action.SecondaryInput) >= len(inputs) {
+		return "", nil
+	}
+	src, ok := inputs[action.SecondaryInput].(cache.ImmutableRef)
+	if !ok || src == nil {
+		return "", nil
+	}
+	dt, err := f.op.Marshal()
+	if err != nil {
+		return "", nil
+	}
+	return incrementalCopyIndex + digest.FromBytes(dt).String(), src
+}
+
+// loadPreviousCopy returns the source and the output of the most recent
+// execution of the copy recorded with key that is still in the cache
+func (f *fileOp) loadPreviousCopy(ctx context.Context, key string) *file.PreviousCopy {
+	sis, err := f.md.Search(key)
+	if err != nil {
+		return nil
+	}
+	sort.Slice(sis, func(i, j int) bool {
+		return cache.GetCreatedAt(sis[i]).After(cache.GetCreatedAt(sis[j]))
+	})
+	for _, si := range sis {
+		v := si.Get(key)
+		if v == nil {
+			continue
+		}
+		var srcID string
+		if err := v.Unmarshal(&srcID); err != nil {
+			continue
+		}
+		dest, err := f.cm.Get(ctx, si.ID(), cache.NoUpdateLastUsed)
+		if err != nil {
+			continue
+		}
+		src, err := f.cm.Get(ctx, srcID, cache.NoUpdateLastUsed)
+		if err != nil {
+			dest.Release(context.TODO())
+			continue
+		}
+		return &file.PreviousCopy{Src: src, Dest: dest}
+	}
+	return nil
+}
+
+func setPreviousCopy(si *metadata.StorageItem, key, srcID string) error {
+	v, err := metadata.NewValue(srcID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create previous copy value")
+	}
+	v.Index = key
+	si.Queue(func(b *bolt.Bucket) error {
+		return si.SetValue(b, key, v)
+	})
+	return si.Commit()
+}
+
 func (f *fileOp) Acquire(ctx context.Context) (solver.ReleaseFunc, error) {
 	if f.parallelism == nil {
 		return func() {}, nil
@@ -85,6 +85,17 @@ func (s *sourceOp) CacheMap(ctx context.Context, g session.Group, index int) (*s
 	}, done, nil
 }
 
+// Pin returns the resolved reference of the source
+func (s *sourceOp) Pin() string {
+	s.mu.Lock()
+	src := s.src
+	s.mu.Unlock()
+	if p, ok := src.(solver.PinProvider); ok {
+		return p.Pin()
+	}
+	return ""
+}
+
 func (s *sourceOp) Exec(ctx context.Context, g session.Group, _ []solver.Result) (outputs []solver.Result, err error) {
 	src, err := s.instance(ctx)
 	if err != nil {
@@ -0,0 +1,222 @@
+package llbsolver
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/reference"
+	"github.com/moby/buildkit/exporter/attestation"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/source"
+	"github.com/moby/buildkit/util/redact"
+	digest "github.com/opencontainers/go-digest"
+)
+
+const keyProvenance = "llb.provenance"
+
+// provenanceCollector records the sources and steps of the definitions
+// solved by a job
+type provenanceCollector struct {
+	mu       sync.Mutex
+	started  time.Time
+	frontend string
+	args     map[string]string
+	locals   map[string]struct{}
+	sources  map[digest.Digest]source.Identifier
+	// pins are the resolved references of the sources
+	pins  map[digest.Digest]string
+	steps map[digest.Digest]attestation.ProvenanceStep
+}
+
+func newProvenanceCollector(frontend string, args map[string]string) *provenanceCollector {
+	return &provenanceCollector{
+		started:  time.Now(),
+		frontend: frontend,
+		args:     redact.Map(args),
+		locals:   map[string]struct{}{},
+		sources:  map[digest.Digest]source.Identifier{},
+		pins:     map[digest.Digest]string{},
+		steps:    map[digest.Digest]attestation.ProvenanceStep{},
+	}
+}
+
+func (c *provenanceCollector) addDefinition(def *pb.Definition) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, dt := range def.Def {
+		var op pb.Op
+		if err := (&op).Unmarshal(dt); err != nil {
+			continue
+		}
+		dgst := digest.FromBytes(dt)
+		step := attestation.ProvenanceStep{ID: dgst}
+		for _, in := range op.Inputs {
+			step.Inputs = append(step.Inputs, in.Digest)
+		}
+		switch o := op.Op.(type) {
+		case *pb.Op_Exec:
+			step.Op = "exec"
+		case *pb.Op_File:
+			step.Op = "file"
+		case *pb.Op_Build:
+			step.Op = "build"
+		case *pb.Op_Source:
+			step.Op = "source"
+			c.addSource(dgst, o)
+		default:
+			// the last vertex only selects the result
+			continue
+		}
+		c.steps[dgst] = step
+	}
+}
+
+func (c *provenanceCollector) addSource(dgst digest.Digest, op *pb.Op_Source) {
+	id, err := source.FromLLB(op, nil)
+	if err != nil {
+		return
+	}
+	if id, ok := id.(*source.LocalIdentifier); ok {
+		c.locals[id.Name] = struct{}{}
+		return
+	}
+	c.sources[dgst] = id
+}
+
+// addPins records the references the sources were resolved to by the
+// digests of their ops
+func (c *provenanceCollector) addPins(pins map[digest.Digest]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for dgst, pin := range pins {
+		if _, ok := c.sources[dgst]; ok {
+			c.pins[dgst] = pin
+		}
+	}
+}
+
+// material returns the material of the source id that was resolved to pin,
+// false if the source isn't recorded
+func material(id source.Identifier, pin string) (attestation.ProvenanceMaterial, bool) {
+	var m attestation.ProvenanceMaterial
+	switch id := id.(type) {
+	case *source.ImageIdentifier:
+		ref := id.Reference
+		if pinned, err := reference.Parse(pin); err == nil {
+			// the pin is the ref the image was pulled from, which is one of
+			// the fallback refs if the reference couldn't be pulled
+			ref = pinned
+		}
+		m.URI = source.DockerImageScheme + "://" + ref.Locator
+		if obj := ref.Object; obj != "" && !strings.HasPrefix(obj, "@") {
+			m.URI += ":" + strings.SplitN(obj, "@", 2)[0]
+		}
+		if dgst := ref.Digest(); dgst != "" {
+			m.Digest = map[string]string{dgst.Algorithm().String(): dgst.Hex()}
+		}
+	case *source.GitIdentifier:
+		m.URI = redactURL(id.Remote)
+		if id.Ref != "" {
+			m.URI += "#" + id.Ref
+		}
+		if pin != "" {
+			alg := "sha1"
+			if len(pin) == 64 {
+				alg = "sha256"
+			}
+			m.Digest = map[string]string{alg: pin}
+		}
+	case *source.HTTPIdentifier:
+		m.URI = redactURL(id.URL)
+		if id.Checksum != "" {
+			m.Digest = map[string]string{id.Checksum.Algorithm().String(): id.Checksum.Hex()}
+		}
+	default:
+		return m, false
+	}
+	return m, true
+}
+
+// predicate returns the provenance of the build
+func (c *provenanceCollector) predicate() *attestation.ProvenancePredicate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	finished := time.Now()
+	p := &attestation.ProvenancePredicate{
+		BuildType: attestation.BuildTypeBuildKit,
+		Invocation: attestation.ProvenanceInvocation{
+			Parameters: attestation.ProvenanceParameters{
+				Frontend: c.frontend,
+				Args:     c.args,
+			},
+		},
+		Metadata: &attestation.ProvenanceMetadata{
+			BuildStartedOn:  &c.started,
+			BuildFinishedOn: &finished,
+		},
+	}
+	for name := range c.locals {
+		p.Invocation.Parameters.Locals = append(p.Invocation.Parameters.Locals, name)
+	}
+	sort.Strings(p.Invocation.Parameters.Locals)
+
+	materials := map[string]attestation.ProvenanceMaterial{}
+	for dgst, id := range c.sources {
+		m, ok := material(id, c.pins[dgst])
+		if !ok {
+			continue
+		}
+		key := m.URI
+		for alg, v := range m.Digest {
+			key += "@" + alg + ":" + v
+		}
+		materials[key] = m
+	}
+	keys := make([]string, 0, len(materials))
+	for k := range materials {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p.Materials = append(p.Materials, materials[k])
+	}
+
+	if len(c.steps) > 0 {
+		p.BuildConfig = &attestation.ProvenanceBuildConfig{}
+		for _, s := range c.steps {
+			p.BuildConfig.Steps = append(p.BuildConfig.Steps, s)
+		}
+		sort.Slice(p.BuildConfig.Steps, func(i, j int) bool {
+			return p.BuildConfig.Steps[i].ID < p.BuildConfig.Steps[j].ID
+		})
+	}
+	return p
+}
+
+// addProvenance records def in the provenance collectors of the jobs of b
+func addProvenance(b solver.Builder, def *pb.Definition) {
+	b.EachValue(context.TODO(), keyProvenance, func(v interface{}) error {
+		if c, ok := v.(*provenanceCollector); ok {
+			c.addDefinition(def)
+		}
+		return nil
+	})
+}
+
+// redactURL removes credentials from URLs of sources
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	u.User = nil
+	return u.String()
+}
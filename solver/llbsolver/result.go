@@ -82,13 +82,13 @@ func NewContentHashFunc(selectors []Selector) solver.ResultBasedCacheFunc {
 	}
 }
 
-func workerRefConverter(g session.Group) func(ctx context.Context, res solver.Result) (*solver.Remote, error) {
+func workerRefConverter(comp compression.Config, g session.Group) func(ctx context.Context, res solver.Result) (*solver.Remote, error) {
 	return func(ctx context.Context, res solver.Result) (*solver.Remote, error) {
 		ref, ok := res.Sys().(*worker.WorkerRef)
 		if !ok {
 			return nil, errors.Errorf("invalid result: %T", res.Sys())
 		}
 
-		return ref.GetRemote(ctx, true, compression.Default, false, g)
+		return ref.GetRemote(ctx, true, comp, g)
 	}
 }
@@ -2,7 +2,9 @@ package llbsolver
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,12 +14,16 @@ import (
 	controlgateway "github.com/moby/buildkit/control/gateway"
 	"github.com/moby/buildkit/exporter"
 	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/exporter/outputpolicy"
 	"github.com/moby/buildkit/frontend"
 	"github.com/moby/buildkit/frontend/gateway"
+	"github.com/moby/buildkit/identity"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/solver/errdefs"
 	"github.com/moby/buildkit/util/compression"
 	"github.com/moby/buildkit/util/entitlements"
+	"github.com/moby/buildkit/util/optionstatus"
 	"github.com/moby/buildkit/util/progress"
 	"github.com/moby/buildkit/worker"
 	digest "github.com/opencontainers/go-digest"
@@ -28,9 +34,22 @@ import (
 const keyEntitlements = "llb.entitlements"
 
 type ExporterRequest struct {
-	Exporter        exporter.ExporterInstance
-	CacheExporter   remotecache.Exporter
-	CacheExportMode solver.CacheExportMode
+	Exporter       exporter.ExporterInstance
+	CacheExporters []RemoteCacheExporter
+	// OutputPolicy is verified on the result before it is exported, nil
+	// doesn't verify the result
+	OutputPolicy *outputpolicy.Policy
+	// CachePolicy is verified on the result before its build cache is
+	// exported to CacheExporters, nil doesn't verify the result
+	CachePolicy *outputpolicy.Policy
+}
+
+// RemoteCacheExporter is a cache exporter of a build with its export mode
+// and the compression of the layer blobs created for the export
+type RemoteCacheExporter struct {
+	remotecache.Exporter
+	solver.CacheExportMode
+	Compression compression.Config
 }
 
 // ResolveWorkerFunc returns default worker for the temporary default non-distributed use cases
@@ -46,9 +65,10 @@ type Solver struct {
 	gatewayForwarder          *controlgateway.GatewayForwarder
 	sm                        *session.Manager
 	entitlements              []string
+	experimentalOptions       bool
 }
 
-func New(wc *worker.Controller, f map[string]frontend.Frontend, cache solver.CacheManager, resolveCI map[string]remotecache.ResolveCacheImporterFunc, gatewayForwarder *controlgateway.GatewayForwarder, sm *session.Manager, ents []string) (*Solver, error) {
+func New(wc *worker.Controller, f map[string]frontend.Frontend, cache solver.CacheManager, resolveCI map[string]remotecache.ResolveCacheImporterFunc, gatewayForwarder *controlgateway.GatewayForwarder, sm *session.Manager, ents []string, experimentalOptions bool) (*Solver, error) {
 	s := &Solver{
 		workerController:          wc,
 		resolveWorker:             defaultResolver(wc),
@@ -58,6 +78,7 @@ func New(wc *worker.Controller, f map[string]frontend.Frontend, cache solver.Cac
 		gatewayForwarder:          gatewayForwarder,
 		sm:                        sm,
 		entitlements:              ents,
+		experimentalOptions:       experimentalOptions,
 	}
 
 	s.solver = solver.NewSolver(solver.SolverOpt{
@@ -86,10 +107,11 @@ func (s *Solver) Bridge(b solver.Builder) frontend.FrontendLLBBridge {
 		resolveCacheImporterFuncs: s.resolveCacheImporterFuncs,
 		cms:                       map[string]solver.CacheManager{},
 		sm:                        s.sm,
+		experimentalOptions:       s.experimentalOptions,
 	}
 }
 
-func (s *Solver) Solve(ctx context.Context, id string, sessionID string, req frontend.SolveRequest, exp ExporterRequest, ent []entitlements.Entitlement) (*client.SolveResponse, error) {
+func (s *Solver) Solve(ctx context.Context, id string, sessionID string, req frontend.SolveRequest, exp ExporterRequest, ent []entitlements.Entitlement, warnings []optionstatus.Warning) (*client.SolveResponse, error) {
 	j, err := s.solver.NewJob(id)
 	if err != nil {
 		return nil, err
@@ -97,12 +119,29 @@ func (s *Solver) Solve(ctx context.Context, id string, sessionID string, req fro
 
 	defer j.Discard()
 
+	for _, w := range warnings {
+		if err := logWarning(ctx, j, w.String()); err != nil {
+			return nil, err
+		}
+	}
+
 	set, err := entitlements.WhiteList(ent, supportedEntitlements(s.entitlements))
 	if err != nil {
-		return nil, err
+		return nil, errdefs.WithCode(err, errdefs.CodePolicyDenied)
 	}
 	j.SetValue(keyEntitlements, set)
 
+	args := make(map[string]string, len(req.FrontendOpt))
+	for k, v := range req.FrontendOpt {
+		args[k] = v
+	}
+	provenance := newProvenanceCollector(req.Frontend, args)
+	j.SetValue(keyProvenance, provenance)
+
+	if names := parseMountTemplates(req.FrontendOpt); len(names) > 0 {
+		j.SetValue(keyMountTemplates, names)
+	}
+
 	j.SessionID = sessionID
 
 	var res *frontend.Result
@@ -162,6 +201,12 @@ func (s *Solver) Solve(ctx context.Context, id string, sessionID string, req fro
 		if inp.Metadata == nil {
 			inp.Metadata = make(map[string][]byte)
 		}
+		provenance.addPins(j.Pins())
+		dt, err := json.Marshal(provenance.predicate())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal provenance")
+		}
+		inp.Metadata[exptypes.ExporterProvenanceKey] = dt
 		if res := res.Ref; res != nil {
 			r, err := res.Result(ctx)
 			if err != nil {
@@ -173,7 +218,7 @@ func (s *Solver) Solve(ctx context.Context, id string, sessionID string, req fro
 			}
 			inp.Ref = workerRef.ImmutableRef
 
-			dt, err := inlineCache(ctx, exp.CacheExporter, r, session.NewGroup(sessionID))
+			dt, err := inlineCache(ctx, exp.CacheExporters, r, session.NewGroup(sessionID))
 			if err != nil {
 				return nil, err
 			}
@@ -197,7 +242,7 @@ func (s *Solver) Solve(ctx context.Context, id string, sessionID string, req fro
 					}
 					m[k] = workerRef.ImmutableRef
 
-					dt, err := inlineCache(ctx, exp.CacheExporter, r, session.NewGroup(sessionID))
+					dt, err := inlineCache(ctx, exp.CacheExporters, r, session.NewGroup(sessionID))
 					if err != nil {
 						return nil, err
 					}
@@ -209,6 +254,14 @@ func (s *Solver) Solve(ctx context.Context, id string, sessionID string, req fro
 			inp.Refs = m
 		}
 
+		if p := exp.OutputPolicy; p != nil {
+			if err := inBuilderContext(ctx, j, "verifying output policy", "", func(ctx context.Context, _ session.Group) error {
+				return p.Verify(ctx, inp, j.SessionID)
+			}); err != nil {
+				return nil, err
+			}
+		}
+
 		if err := inBuilderContext(ctx, j, e.Name(), "", func(ctx context.Context, _ session.Group) error {
 			exporterResponse, err = e.Export(ctx, inp, j.SessionID)
 			return err
@@ -218,28 +271,61 @@ func (s *Solver) Solve(ctx context.Context, id string, sessionID string, req fro
 	}
 
 	g := session.NewGroup(j.SessionID)
-	var cacheExporterResponse map[string]string
-	if e := exp.CacheExporter; e != nil {
+	cacheExporterResponse := make(map[string]string)
+	if p := exp.CachePolicy; p != nil && len(exp.CacheExporters) > 0 {
+		if err := inBuilderContext(ctx, j, "verifying output policy of cache", "", func(ctx context.Context, _ session.Group) error {
+			src, err := resultSource(ctx, res)
+			if err != nil {
+				return err
+			}
+			return p.Verify(ctx, src, j.SessionID)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if len(exp.CacheExporters) > 0 {
 		if err := inBuilderContext(ctx, j, "exporting cache", "", func(ctx context.Context, _ session.Group) error {
+			// the chains are collected one exporter after another because the
+			// cache key exporters keep state per target. The layer blobs are
+			// only created by the first exporter that needs them.
 			prepareDone := oneOffProgress(ctx, "preparing build cache for export")
-			if err := res.EachRef(func(res solver.ResultProxy) error {
-				r, err := res.Result(ctx)
-				if err != nil {
+			for _, e := range exp.CacheExporters {
+				if err := res.EachRef(func(res solver.ResultProxy) error {
+					r, err := res.Result(ctx)
+					if err != nil {
+						return err
+					}
+					// all keys have same export chain so exporting others is not needed
+					_, err = r.CacheKeys()[0].Exporter.ExportTo(ctx, e.Exporter, solver.CacheExportOpt{
+						Convert: workerRefConverter(e.Compression, g),
+						Mode:    e.CacheExportMode,
+						Session: g,
+						// the existing blobs are reused unless they have to
+						// be recompressed
+						ConvertAll: e.Compression.Force,
+					})
 					return err
+				}); err != nil {
+					return prepareDone(err)
 				}
-				// all keys have same export chain so exporting others is not needed
-				_, err = r.CacheKeys()[0].Exporter.ExportTo(ctx, e, solver.CacheExportOpt{
-					Convert: workerRefConverter(g),
-					Mode:    exp.CacheExportMode,
-					Session: g,
+			}
+			prepareDone(nil)
+
+			resps := make([]map[string]string, len(exp.CacheExporters))
+			eg, ctx := errgroup.WithContext(ctx)
+			for i, e := range exp.CacheExporters {
+				i, e := i, e
+				eg.Go(func() error {
+					resp, err := e.Finalize(ctx)
+					resps[i] = resp
+					return err
 				})
+			}
+			if err := eg.Wait(); err != nil {
 				return err
-			}); err != nil {
-				return prepareDone(err)
 			}
-			prepareDone(nil)
-			cacheExporterResponse, err = e.Finalize(ctx)
-			return err
+			cacheExporterResponse = mergeCacheExporterResponses(resps)
+			return nil
 		}); err != nil {
 			return nil, err
 		}
@@ -265,16 +351,43 @@ func (s *Solver) Solve(ctx context.Context, id string, sessionID string, req fro
 	}, nil
 }
 
-func inlineCache(ctx context.Context, e remotecache.Exporter, res solver.CachedResult, g session.Group) ([]byte, error) {
-	if efl, ok := e.(interface {
-		ExportForLayers([]digest.Digest) ([]byte, error)
-	}); ok {
+// mergeCacheExporterResponses merges the Finalize responses of the cache
+// exporters. Keys returned by more than one exporter are keyed by the index
+// of the exporter, e.g. cache.manifest/1, so that no response is lost.
+func mergeCacheExporterResponses(resps []map[string]string) map[string]string {
+	counts := map[string]int{}
+	for _, resp := range resps {
+		for k := range resp {
+			counts[k]++
+		}
+	}
+	merged := make(map[string]string)
+	for i, resp := range resps {
+		for k, v := range resp {
+			if counts[k] > 1 {
+				k = k + "/" + strconv.Itoa(i)
+			}
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func inlineCache(ctx context.Context, exporters []RemoteCacheExporter, res solver.CachedResult, g session.Group) ([]byte, error) {
+	for _, e := range exporters {
+		efl, ok := e.Exporter.(interface {
+			remotecache.Exporter
+			ExportForLayers([]digest.Digest) ([]byte, error)
+		})
+		if !ok {
+			continue
+		}
 		workerRef, ok := res.Sys().(*worker.WorkerRef)
 		if !ok {
 			return nil, errors.Errorf("invalid reference: %T", res.Sys())
 		}
 
-		remote, err := workerRef.GetRemote(ctx, true, compression.Default, false, g)
+		remote, err := workerRef.GetRemote(ctx, true, e.Compression, g)
 		if err != nil || remote == nil {
 			return nil, nil
 		}
@@ -284,8 +397,8 @@ func inlineCache(ctx context.Context, e remotecache.Exporter, res solver.CachedR
 			digests = append(digests, desc.Digest)
 		}
 
-		if _, err := res.CacheKeys()[0].Exporter.ExportTo(ctx, e, solver.CacheExportOpt{
-			Convert: workerRefConverter(g),
+		if _, err := res.CacheKeys()[0].Exporter.ExportTo(ctx, efl, solver.CacheExportOpt{
+			Convert: workerRefConverter(e.Compression, g),
 			Mode:    solver.CacheExportModeMin,
 			Session: g,
 		}); err != nil {
@@ -297,6 +410,10 @@ func inlineCache(ctx context.Context, e remotecache.Exporter, res solver.CachedR
 	return nil, nil
 }
 
+func (s *Solver) Jobs() []*solver.Job {
+	return s.solver.Jobs()
+}
+
 func (s *Solver) Status(ctx context.Context, id string, statusChan chan *client.SolveStatus) error {
 	j, err := s.solver.Get(id)
 	if err != nil {
@@ -326,6 +443,38 @@ func allWorkers(wc *worker.Controller) func(func(w worker.Worker) error) error {
 	}
 }
 
+// resultSource returns the refs of res
+func resultSource(ctx context.Context, res *frontend.Result) (exporter.Source, error) {
+	var src exporter.Source
+	ref := func(res solver.ResultProxy) (cache.ImmutableRef, error) {
+		if res == nil {
+			return nil, nil
+		}
+		r, err := res.Result(ctx)
+		if err != nil {
+			return nil, err
+		}
+		workerRef, ok := r.Sys().(*worker.WorkerRef)
+		if !ok {
+			return nil, errors.Errorf("invalid reference: %T", r.Sys())
+		}
+		return workerRef.ImmutableRef, nil
+	}
+	var err error
+	if src.Ref, err = ref(res.Ref); err != nil {
+		return src, err
+	}
+	if res.Refs != nil {
+		src.Refs = make(map[string]cache.ImmutableRef, len(res.Refs))
+		for k, res := range res.Refs {
+			if src.Refs[k], err = ref(res); err != nil {
+				return src, err
+			}
+		}
+	}
+	return src, nil
+}
+
 func oneOffProgress(ctx context.Context, id string) func(err error) error {
 	pw, _, _ := progress.NewFromContext(ctx)
 	now := time.Now()
@@ -361,6 +510,19 @@ func inBuilderContext(ctx context.Context, b solver.Builder, name, id string, f
 	})
 }
 
+// logWarning writes msg to the progress of the build as a log that doesn't
+// belong to a vertex, see client.VertexLog
+func logWarning(ctx context.Context, b solver.Builder, msg string) error {
+	return b.InContext(ctx, func(ctx context.Context, _ session.Group) error {
+		pw, _, _ := progress.NewFromContext(ctx, progress.WithMetadata("vertex", digest.Digest("")))
+		defer pw.Close()
+		return pw.Write(identity.NewID(), client.VertexLog{
+			Stream: 2,
+			Data:   []byte("WARNING: " + msg + "\n"),
+		})
+	})
+}
+
 func notifyStarted(ctx context.Context, v *client.Vertex, cached bool) {
 	pw, _, _ := progress.NewFromContext(ctx)
 	defer pw.Close()
@@ -0,0 +1,26 @@
+package llbsolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeCacheExporterResponses(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, map[string]string{
+		"cache.manifest": "a",
+	}, mergeCacheExporterResponses([]map[string]string{{"cache.manifest": "a"}}))
+
+	require.Equal(t, map[string]string{
+		"cache.manifest/0":           "a",
+		"cache.manifest/1":           "b",
+		"cache.manifest/local:store": "b",
+		"cache.manifest/2":           "c",
+	}, mergeCacheExporterResponses([]map[string]string{
+		{"cache.manifest": "a"},
+		{"cache.manifest": "b", "cache.manifest/local:store": "b"},
+		{"cache.manifest": "c"},
+	}))
+}
@@ -0,0 +1,222 @@
+package llbsolver
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/source"
+	"github.com/moby/buildkit/util/apicaps"
+	"github.com/moby/buildkit/util/entitlements"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Severity is the severity of a validation diagnostic
+type Severity string
+
+const (
+	// SeverityError is used for problems that make the solve fail
+	SeverityError Severity = "error"
+	// SeverityWarning is used for problems that don't fail the solve, e.g.
+	// unused ops
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a problem found when validating a definition. Vertex is
+// empty for problems of the whole definition.
+type Diagnostic struct {
+	Vertex   digest.Digest
+	Severity Severity
+	Message  string
+}
+
+// ValidateOpt configures the checks of ValidateDefinition
+type ValidateOpt struct {
+	// Entitlements are the entitlements granted to the build
+	Entitlements entitlements.Set
+	// Platforms are the platforms exec ops can run on. Platforms aren't
+	// checked if empty.
+	Platforms []ocispecs.Platform
+}
+
+// ValidateDefinition checks a marshaled LLB definition without solving it.
+// Unlike Load it doesn't stop at the first problem and returns all of them.
+func ValidateDefinition(def *pb.Definition, opt ValidateOpt) []Diagnostic {
+	var out []Diagnostic
+	addErr := func(dgst digest.Digest, format string, args ...interface{}) {
+		out = append(out, Diagnostic{Vertex: dgst, Severity: SeverityError, Message: fmt.Sprintf(format, args...)})
+	}
+	addWarn := func(dgst digest.Digest, format string, args ...interface{}) {
+		out = append(out, Diagnostic{Vertex: dgst, Severity: SeverityWarning, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if def == nil || len(def.Def) == 0 {
+		addErr("", "invalid empty definition")
+		return out
+	}
+
+	allOps := make(map[digest.Digest]*pb.Op, len(def.Def))
+	var last digest.Digest
+	for _, dt := range def.Def {
+		dgst := digest.FromBytes(dt)
+		var op pb.Op
+		if err := (&op).Unmarshal(dt); err != nil {
+			addErr(dgst, "failed to parse llb proto op: %v", err)
+			continue
+		}
+		if _, ok := allOps[dgst]; ok {
+			addWarn(dgst, "duplicate op in definition")
+		}
+		allOps[dgst] = &op
+		last = dgst
+	}
+	if len(out) > 0 {
+		return out
+	}
+	if len(allOps) < 2 {
+		addErr("", "invalid LLB with %d vertexes", len(allOps))
+		return out
+	}
+	lastOp := allOps[last]
+	if len(lastOp.Inputs) == 0 {
+		addErr(last, "invalid LLB with no inputs on last vertex")
+		return out
+	}
+
+	caps := pb.Caps.CapSet(pb.Caps.All())
+	validateCaps := func(dgst digest.Digest) {
+		var ids []string
+		for c := range def.Metadata[dgst].Caps {
+			ids = append(ids, string(c))
+		}
+		sort.Strings(ids)
+		for _, c := range ids {
+			if err := caps.Supports(apicaps.CapID(c)); err != nil {
+				addErr(dgst, "%v", err)
+			}
+		}
+	}
+	validateCaps(last)
+	used := map[digest.Digest]struct{}{last: {}}
+
+	var validate func(dgst digest.Digest)
+	validate = func(dgst digest.Digest) {
+		if _, ok := used[dgst]; ok {
+			return
+		}
+		used[dgst] = struct{}{}
+		op := allOps[dgst]
+
+		if err := ValidateOp(op); err != nil {
+			addErr(dgst, "%v", err)
+		} else {
+			validateOpFields(dgst, op, opt, addErr)
+		}
+
+		md := def.Metadata[dgst]
+		if err := ValidateEntitlements(opt.Entitlements)(op, &md, &solver.VertexOptions{}); err != nil {
+			addErr(dgst, "%v", err)
+		}
+		validateCaps(dgst)
+
+		for i, in := range op.Inputs {
+			if _, ok := allOps[in.Digest]; !ok {
+				addErr(dgst, "invalid missing input %d digest %s", i, in.Digest)
+				continue
+			}
+			validate(in.Digest)
+		}
+	}
+	for i, in := range lastOp.Inputs {
+		if _, ok := allOps[in.Digest]; !ok {
+			addErr(last, "invalid missing input %d digest %s", i, in.Digest)
+			continue
+		}
+		validate(in.Digest)
+	}
+
+	var unused, unknown []string
+	for dgst := range allOps {
+		if _, ok := used[dgst]; !ok {
+			unused = append(unused, string(dgst))
+		}
+	}
+	for dgst := range def.Metadata {
+		if _, ok := allOps[dgst]; !ok {
+			unknown = append(unknown, string(dgst))
+		}
+	}
+	sort.Strings(unused)
+	sort.Strings(unknown)
+	for _, dgst := range unused {
+		addWarn(digest.Digest(dgst), "op is not used by the definition")
+	}
+	for _, dgst := range unknown {
+		addWarn(digest.Digest(dgst), "metadata for unknown op")
+	}
+
+	return out
+}
+
+func validateOpFields(dgst digest.Digest, op *pb.Op, opt ValidateOpt, addErr func(digest.Digest, string, ...interface{})) {
+	switch o := op.Op.(type) {
+	case *pb.Op_Source:
+		if _, err := source.FromLLB(o, nil); err != nil {
+			addErr(dgst, "invalid source: %v", err)
+		}
+	case *pb.Op_Exec:
+		for _, m := range o.Exec.Mounts {
+			if m.Input != pb.Empty && (m.Input < 0 || int(m.Input) >= len(op.Inputs)) {
+				addErr(dgst, "invalid input index %d for mount %s", m.Input, m.Dest)
+			}
+		}
+		for _, h := range o.Exec.Meta.ExtraHosts {
+			if net.ParseIP(h.IP) == nil {
+				addErr(dgst, "failed to parse IP %s for host %s", h.IP, h.Host)
+			}
+		}
+	}
+	if p := op.Platform; p != nil && len(opt.Platforms) > 0 {
+		if _, ok := op.Op.(*pb.Op_Exec); ok {
+			pp := platforms.Normalize(ocispecs.Platform{OS: p.OS, Architecture: p.Architecture, Variant: p.Variant})
+			matcher := platforms.Only(pp)
+			var supported bool
+			for _, wp := range opt.Platforms {
+				if matcher.Match(wp) {
+					supported = true
+					break
+				}
+			}
+			if !supported {
+				addErr(dgst, "no worker supports running on platform %s", platforms.Format(pp))
+			}
+		}
+	}
+}
+
+// Validate checks def against the capabilities of the solver, the platforms
+// of its workers and the entitlements allowed for the build.
+func (s *Solver) Validate(def *pb.Definition, ent []entitlements.Entitlement) ([]Diagnostic, error) {
+	var out []Diagnostic
+	set, err := entitlements.WhiteList(ent, supportedEntitlements(s.entitlements))
+	if err != nil {
+		out = append(out, Diagnostic{Severity: SeverityError, Message: err.Error()})
+		set = entitlements.Set{}
+	}
+	workers, err := s.workerController.List()
+	if err != nil {
+		return nil, err
+	}
+	var ps []ocispecs.Platform
+	for _, w := range workers {
+		ps = append(ps, w.Platforms(false)...)
+	}
+	return append(out, ValidateDefinition(def, ValidateOpt{
+		Entitlements: set,
+		Platforms:    ps,
+	})...), nil
+}
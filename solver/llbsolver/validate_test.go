@@ -0,0 +1,75 @@
+package llbsolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/apicaps"
+	"github.com/moby/buildkit/util/entitlements"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDefinition(t *testing.T) {
+	t.Parallel()
+
+	linux := []ocispecs.Platform{{OS: "linux", Architecture: "amd64"}}
+
+	st := llb.Image("alpine").Run(llb.Shlex("true")).Root()
+	def, err := st.Marshal(context.TODO(), llb.LinuxAmd64)
+	require.NoError(t, err)
+	diags := ValidateDefinition(def.ToPB(), ValidateOpt{Platforms: linux})
+	require.Len(t, diags, 0)
+
+	diags = ValidateDefinition(&pb.Definition{}, ValidateOpt{})
+	require.Len(t, diags, 1)
+	require.Equal(t, SeverityError, diags[0].Severity)
+
+	// entitlements
+	st = llb.Image("alpine").Run(llb.Shlex("true"), llb.Network(llb.NetModeHost)).Root()
+	def, err = st.Marshal(context.TODO(), llb.LinuxAmd64)
+	require.NoError(t, err)
+	diags = ValidateDefinition(def.ToPB(), ValidateOpt{Platforms: linux})
+	require.Len(t, diags, 1)
+	require.Contains(t, diags[0].Message, "network.host is not allowed")
+	diags = ValidateDefinition(def.ToPB(), ValidateOpt{
+		Platforms:    linux,
+		Entitlements: entitlements.Set{entitlements.EntitlementNetworkHost: struct{}{}},
+	})
+	require.Len(t, diags, 0)
+
+	// platforms
+	st = llb.Image("alpine").Run(llb.Shlex("true")).Root()
+	def, err = st.Marshal(context.TODO(), llb.LinuxS390x)
+	require.NoError(t, err)
+	diags = ValidateDefinition(def.ToPB(), ValidateOpt{Platforms: linux})
+	require.Len(t, diags, 1)
+	require.Contains(t, diags[0].Message, "linux/s390x")
+
+	// caps and unused ops, all problems are reported
+	def, err = st.Marshal(context.TODO(), llb.LinuxAmd64)
+	require.NoError(t, err)
+	other, err := llb.Image("busybox").Marshal(context.TODO())
+	require.NoError(t, err)
+	pdef := def.ToPB()
+	for dgst, md := range pdef.Metadata {
+		md.Caps = map[apicaps.CapID]bool{"exec.meta.unknown": true}
+		pdef.Metadata[dgst] = md
+	}
+	pdef.Def = append([][]byte{other.Def[0]}, pdef.Def...)
+	diags = ValidateDefinition(pdef, ValidateOpt{Platforms: linux})
+	var errs, warns int
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			require.Contains(t, d.Message, "exec.meta.unknown")
+			errs++
+		} else {
+			require.Contains(t, d.Message, "not used")
+			warns++
+		}
+	}
+	require.Equal(t, 3, errs)
+	require.Equal(t, 1, warns)
+}
@@ -3,9 +3,11 @@ package llbsolver
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/containerd/containerd/platforms"
 	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/solver/errdefs"
 	"github.com/moby/buildkit/solver/pb"
 	"github.com/moby/buildkit/source"
 	"github.com/moby/buildkit/util/entitlements"
@@ -101,13 +103,13 @@ func ValidateEntitlements(ent entitlements.Set) LoadOpt {
 		case *pb.Op_Exec:
 			if op.Exec.Network == pb.NetMode_HOST {
 				if !ent.Allowed(entitlements.EntitlementNetworkHost) {
-					return errors.Errorf("%s is not allowed", entitlements.EntitlementNetworkHost)
+					return errdefs.WithCode(errors.Errorf("%s is not allowed", entitlements.EntitlementNetworkHost), errdefs.CodePolicyDenied)
 				}
 			}
 
 			if op.Exec.Security == pb.SecurityMode_INSECURE {
 				if !ent.Allowed(entitlements.EntitlementSecurityInsecure) {
-					return errors.Errorf("%s is not allowed", entitlements.EntitlementSecurityInsecure)
+					return errdefs.WithCode(errors.Errorf("%s is not allowed", entitlements.EntitlementSecurityInsecure), errdefs.CodePolicyDenied)
 				}
 			}
 		}
@@ -144,9 +146,19 @@ func (dpc *detectPrunedCacheID) Load(op *pb.Op, md *pb.OpMetadata, opt *solver.V
 }
 
 func Load(def *pb.Definition, opts ...LoadOpt) (solver.Edge, error) {
+	return loadScoped(def, "", opts...)
+}
+
+// loadScoped is Load with the digests of the vertexes derived from scope if
+// it is set, so that they are only shared by the solves of the same scope
+func loadScoped(def *pb.Definition, scope string, opts ...LoadOpt) (solver.Edge, error) {
 	return loadLLB(def, func(dgst digest.Digest, pbOp *pb.Op, load func(digest.Digest) (solver.Vertex, error)) (solver.Vertex, error) {
 		opMetadata := def.Metadata[dgst]
-		vtx, err := newVertex(dgst, pbOp, &opMetadata, load, opts...)
+		vtxDigest := dgst
+		if scope != "" {
+			vtxDigest = digest.FromString(dgst.String() + "\x00" + scope)
+		}
+		vtx, err := newVertex(vtxDigest, pbOp, &opMetadata, load, opts...)
 		if err != nil {
 			return nil, err
 		}
@@ -162,6 +174,9 @@ func newVertex(dgst digest.Digest, op *pb.Op, opMeta *pb.OpMetadata, load func(d
 		if opMeta.ExportCache != nil {
 			opt.ExportCache = &opMeta.ExportCache.Value
 		}
+		if opMeta.CacheTtl > 0 {
+			opt.CacheTTL = time.Duration(opMeta.CacheTtl) * time.Second
+		}
 	}
 	for _, fn := range opts {
 		if err := fn(op, opMeta, &opt); err != nil {
@@ -287,6 +302,9 @@ func ValidateOp(op *pb.Op) error {
 		if len(op.Exec.Mounts) == 0 {
 			return errors.Errorf("invalid exec op with no mounts")
 		}
+		if op.Exec.Meta.CoreDumpSize < 0 {
+			return errors.Errorf("invalid exec op with negative core dump size")
+		}
 
 		isRoot := false
 		for _, m := range op.Exec.Mounts {
@@ -12,6 +12,7 @@ const AttrIncludePatterns = "local.includepattern"
 const AttrFollowPaths = "local.followpaths"
 const AttrExcludePatterns = "local.excludepatterns"
 const AttrSharedKeyHint = "local.sharedkeyhint"
+const AttrLocalVerboseProgress = "local.verboseprogress"
 
 const AttrLLBDefinitionFilename = "llbbuild.filename"
 
@@ -26,6 +27,7 @@ const AttrImageResolveModeDefault = "default"
 const AttrImageResolveModeForcePull = "pull"
 const AttrImageResolveModePreferLocal = "local"
 const AttrImageRecordType = "image.recordtype"
+const AttrImageFallbackRefs = "image.fallbackrefs"
 
 const AttrLocalDiffer = "local.differ"
 const AttrLocalDifferNone = "none"
@@ -11,6 +11,7 @@ var Caps apicaps.CapList
 const (
 	CapSourceImage                apicaps.CapID = "source.image"
 	CapSourceImageResolveMode     apicaps.CapID = "source.image.resolvemode"
+	CapSourceImageFallbackRefs    apicaps.CapID = "source.image.fallbackrefs"
 	CapSourceLocal                apicaps.CapID = "source.local"
 	CapSourceLocalUnique          apicaps.CapID = "source.local.unique"
 	CapSourceLocalSessionID       apicaps.CapID = "source.local.sessionid"
@@ -40,6 +41,7 @@ const (
 	CapExecMetaNetwork               apicaps.CapID = "exec.meta.network"
 	CapExecMetaSecurity              apicaps.CapID = "exec.meta.security"
 	CapExecMetaSetsDefaultPath       apicaps.CapID = "exec.meta.setsdefaultpath"
+	CapExecMetaCoreDump              apicaps.CapID = "exec.meta.coredump"
 	CapExecMountBind                 apicaps.CapID = "exec.mount.bind"
 	CapExecMountBindReadWriteNoOuput apicaps.CapID = "exec.mount.bind.readwrite-nooutput"
 	CapExecMountCache                apicaps.CapID = "exec.mount.cache"
@@ -62,8 +64,13 @@ const (
 	CapMetaIgnoreCache apicaps.CapID = "meta.ignorecache"
 	CapMetaDescription apicaps.CapID = "meta.description"
 	CapMetaExportCache apicaps.CapID = "meta.exportcache"
+	CapMetaCacheTTL    apicaps.CapID = "meta.cachettl"
 
 	CapRemoteCacheGHA apicaps.CapID = "cache.gha"
+
+	// CapExporterLocalTar is set by daemons whose local exporter supports
+	// mode=tar. Older daemons ignore the mode and write the files.
+	CapExporterLocalTar apicaps.CapID = "exporter.local.tar"
 )
 
 func init() {
@@ -80,6 +87,12 @@ func init() {
 		Status:  apicaps.CapStatusExperimental,
 	})
 
+	Caps.Init(apicaps.Cap{
+		ID:      CapSourceImageFallbackRefs,
+		Enabled: true,
+		Status:  apicaps.CapStatusExperimental,
+	})
+
 	Caps.Init(apicaps.Cap{
 		ID:      CapSourceLocal,
 		Enabled: true,
@@ -224,6 +237,12 @@ func init() {
 		Status:  apicaps.CapStatusExperimental,
 	})
 
+	Caps.Init(apicaps.Cap{
+		ID:      CapExecMetaCoreDump,
+		Enabled: true,
+		Status:  apicaps.CapStatusExperimental,
+	})
+
 	Caps.Init(apicaps.Cap{
 		ID:      CapExecMetaSecurity,
 		Enabled: true,
@@ -342,9 +361,21 @@ func init() {
 		Status:  apicaps.CapStatusExperimental,
 	})
 
+	Caps.Init(apicaps.Cap{
+		ID:      CapMetaCacheTTL,
+		Enabled: true,
+		Status:  apicaps.CapStatusExperimental,
+	})
+
 	Caps.Init(apicaps.Cap{
 		ID:      CapRemoteCacheGHA,
 		Enabled: true,
 		Status:  apicaps.CapStatusExperimental,
 	})
+
+	Caps.Init(apicaps.Cap{
+		ID:      CapExporterLocalTar,
+		Enabled: true,
+		Status:  apicaps.CapStatusExperimental,
+	})
 }
@@ -461,13 +461,14 @@ func (m *ExecOp) GetSecurity() SecurityMode {
 // Meta is unrelated to LLB metadata.
 // FIXME: rename (ExecContext? ExecArgs?)
 type Meta struct {
-	Args       []string  `protobuf:"bytes,1,rep,name=args,proto3" json:"args,omitempty"`
-	Env        []string  `protobuf:"bytes,2,rep,name=env,proto3" json:"env,omitempty"`
-	Cwd        string    `protobuf:"bytes,3,opt,name=cwd,proto3" json:"cwd,omitempty"`
-	User       string    `protobuf:"bytes,4,opt,name=user,proto3" json:"user,omitempty"`
-	ProxyEnv   *ProxyEnv `protobuf:"bytes,5,opt,name=proxy_env,json=proxyEnv,proto3" json:"proxy_env,omitempty"`
-	ExtraHosts []*HostIP `protobuf:"bytes,6,rep,name=extraHosts,proto3" json:"extraHosts,omitempty"`
-	Hostname   string    `protobuf:"bytes,7,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	Args         []string  `protobuf:"bytes,1,rep,name=args,proto3" json:"args,omitempty"`
+	Env          []string  `protobuf:"bytes,2,rep,name=env,proto3" json:"env,omitempty"`
+	Cwd          string    `protobuf:"bytes,3,opt,name=cwd,proto3" json:"cwd,omitempty"`
+	User         string    `protobuf:"bytes,4,opt,name=user,proto3" json:"user,omitempty"`
+	ProxyEnv     *ProxyEnv `protobuf:"bytes,5,opt,name=proxy_env,json=proxyEnv,proto3" json:"proxy_env,omitempty"`
+	ExtraHosts   []*HostIP `protobuf:"bytes,6,rep,name=extraHosts,proto3" json:"extraHosts,omitempty"`
+	Hostname     string    `protobuf:"bytes,7,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	CoreDumpSize int64     `protobuf:"varint,8,opt,name=coreDumpSize,proto3" json:"coreDumpSize,omitempty"`
 }
 
 func (m *Meta) Reset()         { *m = Meta{} }
@@ -548,6 +549,13 @@ func (m *Meta) GetHostname() string {
 	return ""
 }
 
+func (m *Meta) GetCoreDumpSize() int64 {
+	if m != nil {
+		return m.CoreDumpSize
+	}
+	return 0
+}
+
 // Mount specifies how to mount an input Op as a filesystem.
 type Mount struct {
 	Input     InputIndex  `protobuf:"varint,1,opt,name=input,proto3,customtype=InputIndex" json:"input"`
@@ -1011,6 +1019,10 @@ type OpMetadata struct {
 	// WorkerConstraint worker_constraint = 3;
 	ExportCache *ExportCache                                         `protobuf:"bytes,4,opt,name=export_cache,json=exportCache,proto3" json:"export_cache,omitempty"`
 	Caps        map[github_com_moby_buildkit_util_apicaps.CapID]bool `protobuf:"bytes,5,rep,name=caps,proto3,castkey=github.com/moby/buildkit/util/apicaps.CapID" json:"caps" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"`
+	// cache_ttl is the duration in seconds after which the cache of this Op
+	// expires. The cache keys of the Op change with every time window of
+	// this duration.
+	CacheTtl int64 `protobuf:"varint,6,opt,name=cache_ttl,json=cacheTtl,proto3" json:"cache_ttl,omitempty"`
 }
 
 func (m *OpMetadata) Reset()         { *m = OpMetadata{} }
@@ -1070,6 +1082,13 @@ func (m *OpMetadata) GetCaps() map[github_com_moby_buildkit_util_apicaps.CapID]b
 	return nil
 }
 
+func (m *OpMetadata) GetCacheTtl() int64 {
+	if m != nil {
+		return m.CacheTtl
+	}
+	return 0
+}
+
 // Source is a source mapping description for a file
 type Source struct {
 	Locations map[string]*Locations `protobuf:"bytes,1,rep,name=locations,proto3" json:"locations,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
@@ -2358,149 +2377,151 @@ func init() {
 func init() { proto.RegisterFile("ops.proto", fileDescriptor_8de16154b2733812) }
 
 var fileDescriptor_8de16154b2733812 = []byte{
-	// 2267 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x58, 0xcd, 0x6e, 0x1c, 0xc7,
-	0xf1, 0xe7, 0x7e, 0xef, 0xd6, 0x2e, 0xa9, 0xfd, 0xb7, 0x65, 0x7b, 0xcd, 0xbf, 0x42, 0xd2, 0x63,
-	0xc7, 0xa0, 0x28, 0x69, 0x09, 0xd0, 0x80, 0x65, 0x18, 0x41, 0x10, 0xee, 0x87, 0xc0, 0xb5, 0x25,
-	0x2e, 0xd1, 0x2b, 0xc9, 0xb9, 0x09, 0xc3, 0xd9, 0x26, 0x39, 0xe0, 0xec, 0xf4, 0xa0, 0xa7, 0x57,
-	0xe2, 0x5e, 0x72, 0xf0, 0x13, 0x18, 0x08, 0x90, 0x5b, 0x12, 0xe4, 0x1d, 0x72, 0xcd, 0x31, 0x80,
-	0x8f, 0x3e, 0xe4, 0x60, 0xe4, 0xe0, 0x04, 0xd2, 0x3d, 0x4f, 0x90, 0x00, 0x41, 0x55, 0xf7, 0x7c,
-	0x2c, 0x45, 0x41, 0x12, 0x12, 0xe4, 0x34, 0xdd, 0x55, 0xbf, 0xaa, 0xae, 0xae, 0xaa, 0xae, 0xae,
-	0x1e, 0x68, 0xc8, 0x28, 0xee, 0x46, 0x4a, 0x6a, 0xc9, 0x8a, 0xd1, 0xf1, 0xfa, 0x9d, 0x53, 0x5f,
-	0x9f, 0xcd, 0x8f, 0xbb, 0x9e, 0x9c, 0xed, 0x9e, 0xca, 0x53, 0xb9, 0x4b, 0xac, 0xe3, 0xf9, 0x09,
-	0xcd, 0x68, 0x42, 0x23, 0x23, 0xe2, 0xfc, 0xa1, 0x08, 0xc5, 0x71, 0xc4, 0x3e, 0x84, 0xaa, 0x1f,
-	0x46, 0x73, 0x1d, 0x77, 0x0a, 0x5b, 0xa5, 0xed, 0xe6, 0x5e, 0xa3, 0x1b, 0x1d, 0x77, 0x47, 0x48,
-	0xe1, 0x96, 0xc1, 0xb6, 0xa0, 0x2c, 0x2e, 0x84, 0xd7, 0x29, 0x6e, 0x15, 0xb6, 0x9b, 0x7b, 0x80,
-	0x80, 0xe1, 0x85, 0xf0, 0xc6, 0xd1, 0xc1, 0x0a, 0x27, 0x0e, 0xfb, 0x04, 0xaa, 0xb1, 0x9c, 0x2b,
-	0x4f, 0x74, 0x4a, 0x84, 0x69, 0x21, 0x66, 0x42, 0x14, 0x42, 0x59, 0x2e, 0x6a, 0x3a, 0xf1, 0x03,
-	0xd1, 0x29, 0x67, 0x9a, 0xee, 0xf9, 0x81, 0xc1, 0x10, 0x87, 0x7d, 0x04, 0x95, 0xe3, 0xb9, 0x1f,
-	0x4c, 0x3b, 0x15, 0x82, 0x34, 0x11, 0xd2, 0x43, 0x02, 0x61, 0x0c, 0x8f, 0x6d, 0x43, 0x3d, 0x0a,
-	0x5c, 0x7d, 0x22, 0xd5, 0xac, 0x03, 0xd9, 0x82, 0x47, 0x96, 0xc6, 0x53, 0x2e, 0xbb, 0x0b, 0x4d,
-	0x4f, 0x86, 0xb1, 0x56, 0xae, 0x1f, 0xea, 0xb8, 0xd3, 0x24, 0xf0, 0xbb, 0x08, 0xfe, 0x5a, 0xaa,
-	0x73, 0xa1, 0xfa, 0x19, 0x93, 0xe7, 0x91, 0xbd, 0x32, 0x14, 0x65, 0xe4, 0xfc, 0xa6, 0x00, 0xf5,
-	0x44, 0x2b, 0x73, 0xa0, 0xb5, 0xaf, 0xbc, 0x33, 0x5f, 0x0b, 0x4f, 0xcf, 0x95, 0xe8, 0x14, 0xb6,
-	0x0a, 0xdb, 0x0d, 0xbe, 0x44, 0x63, 0x6b, 0x50, 0x1c, 0x4f, 0xc8, 0x51, 0x0d, 0x5e, 0x1c, 0x4f,
-	0x58, 0x07, 0x6a, 0x8f, 0x5d, 0xe5, 0xbb, 0xa1, 0x26, 0xcf, 0x34, 0x78, 0x32, 0x65, 0x37, 0xa0,
-	0x31, 0x9e, 0x3c, 0x16, 0x2a, 0xf6, 0x65, 0x48, 0xfe, 0x68, 0xf0, 0x8c, 0xc0, 0x36, 0x00, 0xc6,
-	0x93, 0x7b, 0xc2, 0x45, 0xa5, 0x71, 0xa7, 0xb2, 0x55, 0xda, 0x6e, 0xf0, 0x1c, 0xc5, 0xf9, 0x15,
-	0x54, 0x28, 0x46, 0xec, 0x4b, 0xa8, 0x4e, 0xfd, 0x53, 0x11, 0x6b, 0x63, 0x4e, 0x6f, 0xef, 0xbb,
-	0x1f, 0x37, 0x57, 0xfe, 0xfa, 0xe3, 0xe6, 0x4e, 0x2e, 0x19, 0x64, 0x24, 0x42, 0x4f, 0x86, 0xda,
-	0xf5, 0x43, 0xa1, 0xe2, 0xdd, 0x53, 0x79, 0xc7, 0x88, 0x74, 0x07, 0xf4, 0xe1, 0x56, 0x03, 0xbb,
-	0x09, 0x15, 0x3f, 0x9c, 0x8a, 0x0b, 0xb2, 0xbf, 0xd4, 0x7b, 0xc7, 0xaa, 0x6a, 0x8e, 0xe7, 0x3a,
-	0x9a, 0xeb, 0x11, 0xb2, 0xb8, 0x41, 0x38, 0xbf, 0x2b, 0x40, 0xd5, 0xe4, 0x00, 0xbb, 0x01, 0xe5,
-	0x99, 0xd0, 0x2e, 0xad, 0xdf, 0xdc, 0xab, 0xa3, 0x6f, 0x1f, 0x08, 0xed, 0x72, 0xa2, 0x62, 0x7a,
-	0xcd, 0xe4, 0x1c, 0x7d, 0x5f, 0xcc, 0xd2, 0xeb, 0x01, 0x52, 0xb8, 0x65, 0xb0, 0x9f, 0x42, 0x2d,
-	0x14, 0xfa, 0x99, 0x54, 0xe7, 0xe4, 0xa3, 0x35, 0x13, 0xf4, 0x43, 0xa1, 0x1f, 0xc8, 0xa9, 0xe0,
-	0x09, 0x8f, 0xdd, 0x86, 0x7a, 0x2c, 0xbc, 0xb9, 0xf2, 0xf5, 0x82, 0xfc, 0xb5, 0xb6, 0xd7, 0xa6,
-	0x2c, 0xb3, 0x34, 0x02, 0xa7, 0x08, 0xe7, 0xcf, 0x05, 0x28, 0xa3, 0x19, 0x8c, 0x41, 0xd9, 0x55,
-	0xa7, 0x26, 0xbb, 0x1b, 0x9c, 0xc6, 0xac, 0x0d, 0x25, 0x11, 0x3e, 0x25, 0x8b, 0x1a, 0x1c, 0x87,
-	0x48, 0xf1, 0x9e, 0x4d, 0x6d, 0x8c, 0x70, 0x88, 0x72, 0xf3, 0x58, 0x28, 0x1b, 0x1a, 0x1a, 0xb3,
-	0x9b, 0xd0, 0x88, 0x94, 0xbc, 0x58, 0x3c, 0x41, 0xe9, 0x4a, 0x2e, 0xf1, 0x90, 0x38, 0x0c, 0x9f,
-	0xf2, 0x7a, 0x64, 0x47, 0x6c, 0x07, 0x40, 0x5c, 0x68, 0xe5, 0x1e, 0xc8, 0x58, 0xc7, 0x9d, 0x2a,
-	0xed, 0x9d, 0xf2, 0x1d, 0x09, 0xa3, 0x23, 0x9e, 0xe3, 0xb2, 0x75, 0xa8, 0x9f, 0xc9, 0x58, 0x87,
-	0xee, 0x4c, 0x74, 0x6a, 0xb4, 0x5c, 0x3a, 0x77, 0xfe, 0x51, 0x84, 0x0a, 0xb9, 0x8b, 0x6d, 0x63,
-	0x74, 0xa2, 0xb9, 0x09, 0x74, 0xa9, 0xc7, 0x6c, 0x74, 0x80, 0xf2, 0x20, 0x0d, 0x0e, 0xe6, 0xc4,
-	0x3a, 0x7a, 0x2a, 0x10, 0x9e, 0x96, 0xca, 0xa6, 0x62, 0x3a, 0xc7, 0x6d, 0x4d, 0x31, 0x5b, 0xcc,
-	0x4e, 0x69, 0xcc, 0x6e, 0x41, 0x55, 0x52, 0x88, 0x69, 0xb3, 0xaf, 0x08, 0xbc, 0x85, 0xa0, 0x72,
-	0x25, 0xdc, 0xa9, 0x0c, 0x83, 0x05, 0xb9, 0xa0, 0xce, 0xd3, 0x39, 0xbb, 0x05, 0x0d, 0x8a, 0xe9,
-	0xc3, 0x45, 0x24, 0x3a, 0x55, 0x8a, 0xd1, 0x6a, 0x1a, 0x6f, 0x24, 0xf2, 0x8c, 0x8f, 0x87, 0xd8,
-	0x73, 0xbd, 0x33, 0x31, 0x8e, 0x74, 0xe7, 0x7a, 0xe6, 0xcb, 0xbe, 0xa5, 0xf1, 0x94, 0x8b, 0x6a,
-	0x63, 0xe1, 0x29, 0xa1, 0x11, 0xfa, 0x2e, 0x41, 0x57, 0x6d, 0xe8, 0x0d, 0x91, 0x67, 0x7c, 0xe6,
-	0x40, 0x75, 0x32, 0x39, 0x40, 0xe4, 0x7b, 0x59, 0x91, 0x31, 0x14, 0x6e, 0x39, 0x66, 0x0f, 0xf1,
-	0x3c, 0xd0, 0xa3, 0x41, 0xe7, 0x7d, 0xe3, 0xa0, 0x64, 0xee, 0x8c, 0xa0, 0x9e, 0x98, 0x80, 0xa7,
-	0x79, 0x34, 0xb0, 0xe7, 0xbc, 0x38, 0x1a, 0xb0, 0x3b, 0x50, 0x8b, 0xcf, 0x5c, 0xe5, 0x87, 0xa7,
-	0xe4, 0xd7, 0xb5, 0xbd, 0x77, 0x52, 0x8b, 0x27, 0x86, 0x8e, 0xab, 0x24, 0x18, 0x47, 0x42, 0x23,
-	0x35, 0xf1, 0x25, 0x5d, 0x6d, 0x28, 0xcd, 0xfd, 0x29, 0xe9, 0x59, 0xe5, 0x38, 0x44, 0xca, 0xa9,
-	0x6f, 0x72, 0x70, 0x95, 0xe3, 0x10, 0x83, 0x35, 0x93, 0x53, 0x53, 0x2e, 0x57, 0x39, 0x8d, 0xd1,
-	0x76, 0x19, 0x69, 0x5f, 0x86, 0x6e, 0x90, 0xf8, 0x3f, 0x99, 0x3b, 0x41, 0xb2, 0xf7, 0xff, 0xc9,
-	0x6a, 0xbf, 0x2e, 0x40, 0x3d, 0xa9, 0xf1, 0x58, 0xb0, 0xfc, 0xa9, 0x08, 0xb5, 0x7f, 0xe2, 0x0b,
-	0x65, 0x17, 0xce, 0x51, 0xd8, 0x1d, 0xa8, 0xb8, 0x5a, 0xab, 0xa4, 0x0c, 0xbc, 0x9f, 0xbf, 0x20,
-	0xba, 0xfb, 0xc8, 0x19, 0x86, 0x5a, 0x2d, 0xb8, 0x41, 0xad, 0x7f, 0x0e, 0x90, 0x11, 0xd1, 0xd6,
-	0x73, 0xb1, 0xb0, 0x5a, 0x71, 0xc8, 0xae, 0x43, 0xe5, 0xa9, 0x1b, 0xcc, 0x85, 0xcd, 0x6f, 0x33,
-	0xf9, 0xa2, 0xf8, 0x79, 0xc1, 0xf9, 0x53, 0x11, 0x6a, 0xf6, 0xc2, 0x60, 0xb7, 0xa1, 0x46, 0x17,
-	0x86, 0xb5, 0xe8, 0xea, 0x43, 0x93, 0x40, 0xd8, 0x6e, 0x7a, 0x13, 0xe6, 0x6c, 0xb4, 0xaa, 0xcc,
-	0x8d, 0x68, 0x6d, 0xcc, 0xee, 0xc5, 0xd2, 0x54, 0x9c, 0xd8, 0x2b, 0x6f, 0x0d, 0xd1, 0x03, 0x71,
-	0xe2, 0x87, 0x3e, 0xfa, 0x87, 0x23, 0x8b, 0xdd, 0x4e, 0x76, 0x5d, 0x26, 0x8d, 0xef, 0xe5, 0x35,
-	0xbe, 0xbc, 0xe9, 0x11, 0x34, 0x73, 0xcb, 0x5c, 0xb1, 0xeb, 0x8f, 0xf3, 0xbb, 0xb6, 0x4b, 0x92,
-	0x3a, 0x73, 0x5f, 0x67, 0x5e, 0xf8, 0x0f, 0xfc, 0xf7, 0x19, 0x40, 0xa6, 0xf2, 0xcd, 0x8b, 0x8e,
-	0xf3, 0x4d, 0x09, 0x60, 0x1c, 0x61, 0xc9, 0x9d, 0xba, 0x54, 0xf7, 0x5b, 0xfe, 0x69, 0x28, 0x95,
-	0x78, 0x42, 0xc7, 0x98, 0xe4, 0xeb, 0xbc, 0x69, 0x68, 0x74, 0x62, 0xd8, 0x3e, 0x34, 0xa7, 0x22,
-	0xf6, 0x94, 0x4f, 0x09, 0x65, 0x9d, 0xbe, 0x89, 0x7b, 0xca, 0xf4, 0x74, 0x07, 0x19, 0xc2, 0xf8,
-	0x2a, 0x2f, 0xc3, 0xf6, 0xa0, 0x25, 0x2e, 0x22, 0xa9, 0xb4, 0x5d, 0xc5, 0xf4, 0x15, 0xd7, 0x4c,
-	0x87, 0x82, 0x74, 0x5a, 0x89, 0x37, 0x45, 0x36, 0x61, 0x2e, 0x94, 0x3d, 0x37, 0x32, 0x97, 0x6a,
-	0x73, 0xaf, 0x73, 0x69, 0xbd, 0xbe, 0x1b, 0x19, 0xa7, 0xf5, 0x3e, 0xc5, 0xbd, 0x7e, 0xf3, 0xb7,
-	0xcd, 0x5b, 0xb9, 0x9b, 0x74, 0x26, 0x8f, 0x17, 0xbb, 0x94, 0x2f, 0xe7, 0xbe, 0xde, 0x9d, 0x6b,
-	0x3f, 0xd8, 0x75, 0x23, 0x1f, 0xd5, 0xa1, 0xe0, 0x68, 0xc0, 0x49, 0xf5, 0xfa, 0xcf, 0xa1, 0x7d,
-	0xd9, 0xee, 0xb7, 0x89, 0xc1, 0xfa, 0x5d, 0x68, 0xa4, 0x76, 0xbc, 0x4e, 0xb0, 0x9e, 0x0f, 0xde,
-	0x1f, 0x0b, 0x50, 0x35, 0xa7, 0x8a, 0xdd, 0x85, 0x46, 0x20, 0x3d, 0x17, 0x0d, 0x48, 0x5a, 0xbb,
-	0x0f, 0xb2, 0x43, 0xd7, 0xbd, 0x9f, 0xf0, 0x8c, 0x57, 0x33, 0x2c, 0x26, 0x99, 0x1f, 0x9e, 0xc8,
-	0xe4, 0x14, 0xac, 0x65, 0x42, 0xa3, 0xf0, 0x44, 0x72, 0xc3, 0x5c, 0xff, 0x0a, 0xd6, 0x96, 0x55,
-	0x5c, 0x61, 0xe7, 0x47, 0xcb, 0xe9, 0x4a, 0x35, 0x3b, 0x15, 0xca, 0x9b, 0x7d, 0x17, 0x1a, 0x29,
-	0x9d, 0xed, 0xbc, 0x6c, 0x78, 0x2b, 0x2f, 0x99, 0xb3, 0xd5, 0x09, 0x00, 0x32, 0xd3, 0xb0, 0x58,
-	0x61, 0x0f, 0x49, 0xf7, 0xa8, 0x31, 0x23, 0x9d, 0xd3, 0xbd, 0xe7, 0x6a, 0x97, 0x4c, 0x69, 0x71,
-	0x1a, 0xb3, 0x2e, 0xc0, 0x34, 0x3d, 0xb0, 0xaf, 0x38, 0xc6, 0x39, 0x84, 0x33, 0x86, 0x7a, 0x62,
-	0x04, 0xdb, 0x82, 0x66, 0x6c, 0x57, 0xc6, 0x8e, 0x09, 0x97, 0xab, 0xf0, 0x3c, 0x09, 0x3b, 0x1f,
-	0xe5, 0x86, 0xa7, 0x62, 0xa9, 0xf3, 0xe1, 0x48, 0xe1, 0x96, 0xe1, 0x7c, 0x0d, 0x15, 0x22, 0xe0,
-	0x31, 0x8b, 0xb5, 0xab, 0xb4, 0x6d, 0xa2, 0x4c, 0x53, 0x21, 0x63, 0x5a, 0xb6, 0x57, 0xc6, 0x44,
-	0xe4, 0x06, 0xc0, 0x3e, 0xc6, 0xd6, 0x65, 0x6a, 0x3d, 0x7a, 0x15, 0x0e, 0xd9, 0xce, 0xcf, 0xa0,
-	0x9e, 0x90, 0x71, 0xe7, 0xf7, 0xfd, 0x50, 0x58, 0x13, 0x69, 0x8c, 0xcd, 0x67, 0xff, 0xcc, 0x55,
-	0xae, 0xa7, 0x85, 0x69, 0x11, 0x2a, 0x3c, 0x23, 0x38, 0x1f, 0x41, 0x33, 0x77, 0x7a, 0x30, 0xdd,
-	0x1e, 0x53, 0x18, 0xcd, 0x19, 0x36, 0x13, 0xe7, 0xf7, 0xd8, 0x1a, 0x27, 0xdd, 0xce, 0x4f, 0x00,
-	0xce, 0xb4, 0x8e, 0x9e, 0x50, 0xfb, 0x63, 0x7d, 0xdf, 0x40, 0x0a, 0x21, 0xd8, 0x26, 0x34, 0x71,
-	0x12, 0x5b, 0xbe, 0xc9, 0x77, 0x92, 0x88, 0x0d, 0xe0, 0xff, 0xa1, 0x71, 0x92, 0x8a, 0x97, 0x6c,
-	0xe8, 0x12, 0xe9, 0x0f, 0xa0, 0x1e, 0x4a, 0xcb, 0x33, 0xdd, 0x58, 0x2d, 0x94, 0xa9, 0x9c, 0x1b,
-	0x04, 0x96, 0x57, 0x31, 0x72, 0x6e, 0x10, 0x10, 0xd3, 0xb9, 0x05, 0xff, 0xf7, 0x52, 0x93, 0xcf,
-	0xde, 0x83, 0xea, 0x89, 0x1f, 0x68, 0xba, 0x11, 0xb0, 0xfb, 0xb3, 0x33, 0xe7, 0x5f, 0x05, 0x80,
-	0x2c, 0xec, 0x98, 0xcc, 0x58, 0xda, 0x11, 0xd3, 0x32, 0xa5, 0x3c, 0x80, 0xfa, 0xcc, 0x16, 0x09,
-	0x1b, 0xd0, 0x1b, 0xcb, 0xa9, 0xd2, 0x4d, 0x6a, 0x88, 0x29, 0x1f, 0x7b, 0xb6, 0x7c, 0xbc, 0x4d,
-	0x23, 0x9e, 0xae, 0x40, 0x5d, 0x4c, 0xfe, 0x41, 0x05, 0xd9, 0x29, 0xe4, 0x96, 0xb3, 0xfe, 0x15,
-	0xac, 0x2e, 0x2d, 0xf9, 0x86, 0x17, 0x46, 0x56, 0xec, 0xf2, 0x47, 0xf0, 0x36, 0x54, 0x4d, 0x67,
-	0x8a, 0xf9, 0x82, 0x23, 0xab, 0x86, 0xc6, 0xd4, 0x4e, 0x1c, 0x25, 0xcf, 0x9a, 0xd1, 0x91, 0xb3,
-	0x07, 0x55, 0xf3, 0x6e, 0x63, 0xdb, 0x50, 0x73, 0x3d, 0x73, 0x56, 0x73, 0xf5, 0x02, 0x99, 0xfb,
-	0x44, 0xe6, 0x09, 0xdb, 0xf9, 0x4b, 0x11, 0x20, 0xa3, 0xbf, 0x45, 0x3b, 0xfb, 0x05, 0xac, 0xc5,
-	0xc2, 0x93, 0xe1, 0xd4, 0x55, 0x0b, 0xe2, 0xda, 0xf7, 0xc9, 0x55, 0x22, 0x97, 0x90, 0xb9, 0xd6,
-	0xb6, 0xf4, 0xfa, 0xd6, 0x76, 0x1b, 0xca, 0x9e, 0x8c, 0x16, 0xf6, 0x16, 0x61, 0xcb, 0x1b, 0xe9,
-	0xcb, 0x68, 0x81, 0xaf, 0x54, 0x44, 0xb0, 0x2e, 0x54, 0x67, 0xe7, 0xf4, 0x92, 0x35, 0xaf, 0x80,
-	0xeb, 0xcb, 0xd8, 0x07, 0xe7, 0x38, 0xc6, 0x77, 0xaf, 0x41, 0xb1, 0x5b, 0x50, 0x99, 0x9d, 0x4f,
-	0x7d, 0x45, 0x4d, 0x71, 0xd3, 0xb4, 0x8d, 0x79, 0xf8, 0xc0, 0x57, 0xf8, 0xba, 0x25, 0x0c, 0x73,
-	0xa0, 0xa8, 0x66, 0xf4, 0x10, 0x68, 0x9a, 0x27, 0x4e, 0xce, 0x9b, 0xb3, 0x83, 0x15, 0x5e, 0x54,
-	0xb3, 0x5e, 0x1d, 0xaa, 0xc6, 0xaf, 0xce, 0x3f, 0x4b, 0xb0, 0xb6, 0x6c, 0x25, 0xe6, 0x41, 0xac,
-	0xbc, 0x24, 0x0f, 0x62, 0xe5, 0xa5, 0x5d, 0x7f, 0x31, 0xd7, 0xf5, 0x3b, 0x50, 0x91, 0xcf, 0x42,
-	0xa1, 0xf2, 0x4f, 0xf6, 0xfe, 0x99, 0x7c, 0x16, 0x62, 0x0f, 0x6b, 0x58, 0x4b, 0x2d, 0x61, 0xc5,
-	0xb6, 0x84, 0x1f, 0xc3, 0xea, 0x89, 0x0c, 0x02, 0xf9, 0x6c, 0xb2, 0x98, 0x05, 0x7e, 0x78, 0x6e,
-	0xfb, 0xc2, 0x65, 0x22, 0xdb, 0x86, 0x6b, 0x53, 0x5f, 0xa1, 0x39, 0x7d, 0x19, 0x6a, 0x11, 0xd2,
-	0x23, 0x08, 0x71, 0x97, 0xc9, 0xec, 0x4b, 0xd8, 0x72, 0xb5, 0x16, 0xb3, 0x48, 0x3f, 0x0a, 0x23,
-	0xd7, 0x3b, 0x1f, 0x48, 0x8f, 0xce, 0xec, 0x2c, 0x72, 0xb5, 0x7f, 0xec, 0x07, 0xf8, 0xde, 0xab,
-	0x91, 0xe8, 0x6b, 0x71, 0xec, 0x13, 0x58, 0xf3, 0x94, 0x70, 0xb5, 0x18, 0x88, 0x58, 0x1f, 0xb9,
-	0xfa, 0xac, 0x53, 0x27, 0xc9, 0x4b, 0x54, 0xdc, 0x83, 0x8b, 0xd6, 0x7e, 0xed, 0x07, 0x53, 0xcf,
-	0x55, 0xd3, 0x4e, 0xc3, 0xec, 0x61, 0x89, 0xc8, 0xba, 0xc0, 0x88, 0x30, 0x9c, 0x45, 0x7a, 0x91,
-	0x42, 0x81, 0xa0, 0x57, 0x70, 0xb0, 0xaa, 0x6a, 0x7f, 0x26, 0x62, 0xed, 0xce, 0x22, 0xfa, 0xd5,
-	0x50, 0xe2, 0x19, 0x81, 0xdd, 0x84, 0xb6, 0x1f, 0x7a, 0xc1, 0x7c, 0x2a, 0x9e, 0x44, 0xb8, 0x11,
-	0x15, 0xc6, 0x9d, 0x16, 0xd5, 0xa0, 0x6b, 0x96, 0x7e, 0x64, 0xc9, 0x08, 0x15, 0x17, 0x97, 0xa0,
-	0xab, 0x06, 0x6a, 0xe9, 0x09, 0xd4, 0xf9, 0xb6, 0x00, 0xed, 0xcb, 0x89, 0x87, 0x61, 0x8b, 0x70,
-	0xf3, 0xf6, 0x08, 0xe3, 0x38, 0x0d, 0x65, 0x31, 0x17, 0xca, 0xe4, 0x52, 0x2c, 0xe5, 0x2e, 0xc5,
-	0x34, 0x2d, 0xca, 0xaf, 0x4e, 0x8b, 0xa5, 0x8d, 0x56, 0x2e, 0x6d, 0xd4, 0xf9, 0x6d, 0x01, 0xae,
-	0x5d, 0x4a, 0xee, 0x37, 0xb6, 0x68, 0x0b, 0x9a, 0x33, 0xf7, 0x5c, 0x1c, 0xb9, 0x8a, 0x52, 0xa6,
-	0x64, 0xba, 0xc6, 0x1c, 0xe9, 0xbf, 0x60, 0x5f, 0x08, 0xad, 0xfc, 0x89, 0xba, 0xd2, 0xb6, 0x24,
-	0x41, 0x0e, 0xa5, 0xbe, 0x27, 0xe7, 0xf6, 0xc2, 0x4d, 0x12, 0x24, 0x21, 0xbe, 0x9c, 0x46, 0xa5,
-	0x2b, 0xd2, 0xc8, 0x39, 0x84, 0x7a, 0x62, 0x20, 0xdb, 0xb4, 0x7f, 0x15, 0x0a, 0xd9, 0xdf, 0xad,
-	0x47, 0xb1, 0x50, 0x68, 0xbb, 0xf9, 0xc5, 0xf0, 0x21, 0x54, 0x4e, 0x95, 0x9c, 0x47, 0xb6, 0x62,
-	0x2f, 0x21, 0x0c, 0xc7, 0x99, 0x40, 0xcd, 0x52, 0xd8, 0x0e, 0x54, 0x8f, 0x17, 0x87, 0x49, 0xbf,
-	0x63, 0xcb, 0x05, 0xce, 0xa7, 0x16, 0x81, 0x35, 0xc8, 0x20, 0xd8, 0x75, 0x28, 0x1f, 0x2f, 0x46,
-	0x03, 0xf3, 0x06, 0xc4, 0x4a, 0x86, 0xb3, 0x5e, 0xd5, 0x18, 0xe4, 0xdc, 0x87, 0x56, 0x5e, 0x0e,
-	0x9d, 0x92, 0xeb, 0xa3, 0x68, 0x9c, 0x95, 0xec, 0xe2, 0x6b, 0x4a, 0xf6, 0xce, 0x36, 0xd4, 0xec,
-	0xff, 0x1b, 0xd6, 0x80, 0xca, 0xa3, 0xc3, 0xc9, 0xf0, 0x61, 0x7b, 0x85, 0xd5, 0xa1, 0x7c, 0x30,
-	0x9e, 0x3c, 0x6c, 0x17, 0x70, 0x74, 0x38, 0x3e, 0x1c, 0xb6, 0x8b, 0x3b, 0x37, 0xa1, 0x95, 0xff,
-	0x83, 0xc3, 0x9a, 0x50, 0x9b, 0xec, 0x1f, 0x0e, 0x7a, 0xe3, 0x5f, 0xb6, 0x57, 0x58, 0x0b, 0xea,
-	0xa3, 0xc3, 0xc9, 0xb0, 0xff, 0x88, 0x0f, 0xdb, 0x85, 0x9d, 0x5f, 0x40, 0x23, 0xfd, 0x91, 0x80,
-	0x1a, 0x7a, 0xa3, 0xc3, 0x41, 0x7b, 0x85, 0x01, 0x54, 0x27, 0xc3, 0x3e, 0x1f, 0xa2, 0xde, 0x1a,
-	0x94, 0x26, 0x93, 0x83, 0x76, 0x11, 0x57, 0xed, 0xef, 0xf7, 0x0f, 0x86, 0xed, 0x12, 0x0e, 0x1f,
-	0x3e, 0x38, 0xba, 0x37, 0x69, 0x97, 0x77, 0x3e, 0x83, 0x6b, 0x97, 0x1e, 0xeb, 0x24, 0x7d, 0xb0,
-	0xcf, 0x87, 0xa8, 0xa9, 0x09, 0xb5, 0x23, 0x3e, 0x7a, 0xbc, 0xff, 0x70, 0xd8, 0x2e, 0x20, 0xe3,
-	0xfe, 0xb8, 0xff, 0xd5, 0x70, 0xd0, 0x2e, 0xf6, 0x6e, 0x7c, 0xf7, 0x7c, 0xa3, 0xf0, 0xfd, 0xf3,
-	0x8d, 0xc2, 0x0f, 0xcf, 0x37, 0x0a, 0x7f, 0x7f, 0xbe, 0x51, 0xf8, 0xf6, 0xc5, 0xc6, 0xca, 0xf7,
-	0x2f, 0x36, 0x56, 0x7e, 0x78, 0xb1, 0xb1, 0x72, 0x5c, 0xa5, 0xff, 0xa9, 0x9f, 0xfe, 0x3b, 0x00,
-	0x00, 0xff, 0xff, 0x3a, 0xd6, 0xef, 0x88, 0x8f, 0x15, 0x00, 0x00,
+	// 2295 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xbc, 0x58, 0x4f, 0x6f, 0x1c, 0xb7,
+	0x15, 0xd7, 0xce, 0xfe, 0x7f, 0xbb, 0x92, 0xb7, 0x8c, 0x93, 0x4c, 0x14, 0x57, 0x52, 0xc6, 0x6e,
+	0x20, 0xcb, 0xf6, 0x0a, 0x50, 0x80, 0x38, 0x08, 0x8a, 0xa2, 0xda, 0x3f, 0x86, 0x36, 0xb6, 0xb5,
+	0x02, 0x57, 0xb6, 0x7b, 0x33, 0x46, 0x33, 0x94, 0x34, 0xd0, 0xec, 0x70, 0xc0, 0xe1, 0xda, 0xda,
+	0x1e, 0x7a, 0xe8, 0x27, 0x08, 0x50, 0xa0, 0xb7, 0x36, 0xe8, 0x77, 0xe8, 0xb5, 0xf7, 0x1c, 0x73,
+	0xe8, 0x21, 0xe8, 0x21, 0x2d, 0xec, 0x53, 0x2f, 0xfd, 0x04, 0x2d, 0x50, 0x3c, 0x92, 0xf3, 0x67,
+	0x25, 0xbb, 0xb6, 0xd1, 0xa2, 0xa7, 0x21, 0x7f, 0xef, 0xc7, 0xc7, 0xc7, 0xc7, 0xc7, 0xc7, 0xc7,
+	0x81, 0x26, 0x8f, 0x93, 0x6e, 0x2c, 0xb8, 0xe4, 0xc4, 0x8a, 0x8f, 0x56, 0xef, 0x9c, 0x04, 0xf2,
+	0x74, 0x76, 0xd4, 0xf5, 0xf8, 0x74, 0xfb, 0x84, 0x9f, 0xf0, 0x6d, 0x25, 0x3a, 0x9a, 0x1d, 0xab,
+	0x9e, 0xea, 0xa8, 0x96, 0x1e, 0xe2, 0xfc, 0xc1, 0x02, 0x6b, 0x1c, 0x93, 0x4f, 0xa0, 0x16, 0x44,
+	0xf1, 0x4c, 0x26, 0x76, 0x69, 0xa3, 0xbc, 0xd9, 0xda, 0x69, 0x76, 0xe3, 0xa3, 0xee, 0x08, 0x11,
+	0x6a, 0x04, 0x64, 0x03, 0x2a, 0xec, 0x9c, 0x79, 0xb6, 0xb5, 0x51, 0xda, 0x6c, 0xed, 0x00, 0x12,
+	0x86, 0xe7, 0xcc, 0x1b, 0xc7, 0x7b, 0x4b, 0x54, 0x49, 0xc8, 0xa7, 0x50, 0x4b, 0xf8, 0x4c, 0x78,
+	0xcc, 0x2e, 0x2b, 0x4e, 0x1b, 0x39, 0x13, 0x85, 0x28, 0x96, 0x91, 0xa2, 0xa6, 0xe3, 0x20, 0x64,
+	0x76, 0x25, 0xd7, 0x74, 0x2f, 0x08, 0x35, 0x47, 0x49, 0xc8, 0x75, 0xa8, 0x1e, 0xcd, 0x82, 0xd0,
+	0xb7, 0xab, 0x8a, 0xd2, 0x42, 0x4a, 0x0f, 0x01, 0xc5, 0xd1, 0x32, 0xb2, 0x09, 0x8d, 0x38, 0x74,
+	0xe5, 0x31, 0x17, 0x53, 0x1b, 0xf2, 0x09, 0x0f, 0x0c, 0x46, 0x33, 0x29, 0xb9, 0x0b, 0x2d, 0x8f,
+	0x47, 0x89, 0x14, 0x6e, 0x10, 0xc9, 0xc4, 0x6e, 0x29, 0xf2, 0xfb, 0x48, 0x7e, 0xc2, 0xc5, 0x19,
+	0x13, 0xfd, 0x5c, 0x48, 0x8b, 0xcc, 0x5e, 0x05, 0x2c, 0x1e, 0x3b, 0xbf, 0x2d, 0x41, 0x23, 0xd5,
+	0x4a, 0x1c, 0x68, 0xef, 0x0a, 0xef, 0x34, 0x90, 0xcc, 0x93, 0x33, 0xc1, 0xec, 0xd2, 0x46, 0x69,
+	0xb3, 0x49, 0x17, 0x30, 0xb2, 0x02, 0xd6, 0x78, 0xa2, 0x1c, 0xd5, 0xa4, 0xd6, 0x78, 0x42, 0x6c,
+	0xa8, 0x3f, 0x76, 0x45, 0xe0, 0x46, 0x52, 0x79, 0xa6, 0x49, 0xd3, 0x2e, 0xb9, 0x06, 0xcd, 0xf1,
+	0xe4, 0x31, 0x13, 0x49, 0xc0, 0x23, 0xe5, 0x8f, 0x26, 0xcd, 0x01, 0xb2, 0x06, 0x30, 0x9e, 0xdc,
+	0x63, 0x2e, 0x2a, 0x4d, 0xec, 0xea, 0x46, 0x79, 0xb3, 0x49, 0x0b, 0x88, 0xf3, 0x2b, 0xa8, 0xaa,
+	0x3d, 0x22, 0x5f, 0x41, 0xcd, 0x0f, 0x4e, 0x58, 0x22, 0xb5, 0x39, 0xbd, 0x9d, 0x6f, 0x7f, 0x58,
+	0x5f, 0xfa, 0xcb, 0x0f, 0xeb, 0x5b, 0x85, 0x60, 0xe0, 0x31, 0x8b, 0x3c, 0x1e, 0x49, 0x37, 0x88,
+	0x98, 0x48, 0xb6, 0x4f, 0xf8, 0x1d, 0x3d, 0xa4, 0x3b, 0x50, 0x1f, 0x6a, 0x34, 0x90, 0x9b, 0x50,
+	0x0d, 0x22, 0x9f, 0x9d, 0x2b, 0xfb, 0xcb, 0xbd, 0xf7, 0x8c, 0xaa, 0xd6, 0x78, 0x26, 0xe3, 0x99,
+	0x1c, 0xa1, 0x88, 0x6a, 0x86, 0xf3, 0xfb, 0x12, 0xd4, 0x74, 0x0c, 0x90, 0x6b, 0x50, 0x99, 0x32,
+	0xe9, 0xaa, 0xf9, 0x5b, 0x3b, 0x0d, 0xf4, 0xed, 0x43, 0x26, 0x5d, 0xaa, 0x50, 0x0c, 0xaf, 0x29,
+	0x9f, 0xa1, 0xef, 0xad, 0x3c, 0xbc, 0x1e, 0x22, 0x42, 0x8d, 0x80, 0xfc, 0x04, 0xea, 0x11, 0x93,
+	0xcf, 0xb9, 0x38, 0x53, 0x3e, 0x5a, 0xd1, 0x9b, 0xbe, 0xcf, 0xe4, 0x43, 0xee, 0x33, 0x9a, 0xca,
+	0xc8, 0x6d, 0x68, 0x24, 0xcc, 0x9b, 0x89, 0x40, 0xce, 0x95, 0xbf, 0x56, 0x76, 0x3a, 0x2a, 0xca,
+	0x0c, 0xa6, 0xc8, 0x19, 0xc3, 0xf9, 0x7b, 0x09, 0x2a, 0x68, 0x06, 0x21, 0x50, 0x71, 0xc5, 0x89,
+	0x8e, 0xee, 0x26, 0x55, 0x6d, 0xd2, 0x81, 0x32, 0x8b, 0x9e, 0x29, 0x8b, 0x9a, 0x14, 0x9b, 0x88,
+	0x78, 0xcf, 0x7d, 0xb3, 0x47, 0xd8, 0xc4, 0x71, 0xb3, 0x84, 0x09, 0xb3, 0x35, 0xaa, 0x4d, 0x6e,
+	0x42, 0x33, 0x16, 0xfc, 0x7c, 0xfe, 0x14, 0x47, 0x57, 0x0b, 0x81, 0x87, 0xe0, 0x30, 0x7a, 0x46,
+	0x1b, 0xb1, 0x69, 0x91, 0x2d, 0x00, 0x76, 0x2e, 0x85, 0xbb, 0xc7, 0x13, 0x99, 0xd8, 0xb5, 0x8d,
+	0x72, 0x1a, 0xef, 0x08, 0x8c, 0x0e, 0x68, 0x41, 0x4a, 0x56, 0xa1, 0x71, 0xca, 0x13, 0x19, 0xb9,
+	0x53, 0x66, 0xd7, 0xd5, 0x74, 0x59, 0x1f, 0x83, 0xce, 0xe3, 0x82, 0x0d, 0x66, 0xd3, 0x78, 0x12,
+	0xfc, 0x92, 0xd9, 0x0d, 0xdc, 0x1a, 0xba, 0x80, 0x39, 0xff, 0xb0, 0xa0, 0xaa, 0x5c, 0x4a, 0x36,
+	0x71, 0x07, 0xe3, 0x99, 0x0e, 0x86, 0x72, 0x8f, 0x98, 0x1d, 0x84, 0x51, 0x54, 0xdc, 0x40, 0x8c,
+	0x9b, 0x55, 0xf4, 0x66, 0xc8, 0x3c, 0xc9, 0x85, 0x09, 0xd7, 0xac, 0x8f, 0x4b, 0xf7, 0x31, 0xa2,
+	0xb4, 0x37, 0x54, 0x9b, 0xdc, 0x82, 0x1a, 0x57, 0x61, 0x60, 0x57, 0x5e, 0x1f, 0x1c, 0x86, 0x82,
+	0xca, 0x05, 0x73, 0x7d, 0x1e, 0x85, 0x73, 0xe5, 0xa6, 0x06, 0xcd, 0xfa, 0xe4, 0x16, 0x34, 0xd5,
+	0xbe, 0x1f, 0xce, 0x63, 0x66, 0xd7, 0xd4, 0x3e, 0x2e, 0x67, 0x31, 0x81, 0x20, 0xcd, 0xe5, 0x78,
+	0xd0, 0x3d, 0xd7, 0x3b, 0x65, 0xe3, 0x58, 0xda, 0x57, 0x73, 0x7f, 0xf7, 0x0d, 0x46, 0x33, 0x29,
+	0xaa, 0x4d, 0x98, 0x27, 0x98, 0x44, 0xea, 0xfb, 0x8a, 0xba, 0x6c, 0xc2, 0x43, 0x83, 0x34, 0x97,
+	0x13, 0x07, 0x6a, 0x93, 0xc9, 0x1e, 0x32, 0x3f, 0xc8, 0x13, 0x91, 0x46, 0xa8, 0x91, 0xe8, 0x35,
+	0x24, 0xb3, 0x50, 0x8e, 0x06, 0xf6, 0x87, 0xda, 0x41, 0x69, 0xdf, 0x19, 0x41, 0x23, 0x35, 0x01,
+	0x4f, 0xfc, 0x68, 0x60, 0x72, 0x81, 0x35, 0x1a, 0x90, 0x3b, 0x50, 0x4f, 0x4e, 0x5d, 0x11, 0x44,
+	0x27, 0xca, 0xaf, 0x2b, 0x3b, 0xef, 0x65, 0x16, 0x4f, 0x34, 0x8e, 0xb3, 0xa4, 0x1c, 0x87, 0x43,
+	0x33, 0x33, 0xf1, 0x92, 0xae, 0x0e, 0x94, 0x67, 0x81, 0xaf, 0xf4, 0x2c, 0x53, 0x6c, 0x22, 0x72,
+	0x12, 0xe8, 0x38, 0x5d, 0xa6, 0xd8, 0xc4, 0xcd, 0x9a, 0x72, 0x5f, 0xa7, 0xd4, 0x65, 0xaa, 0xda,
+	0x68, 0x3b, 0x8f, 0x65, 0xc0, 0x23, 0x37, 0x4c, 0xfd, 0x9f, 0xf6, 0x9d, 0x30, 0x5d, 0xfb, 0xff,
+	0x65, 0xb6, 0xdf, 0x94, 0xa0, 0x91, 0xde, 0x03, 0x98, 0xd4, 0x02, 0x9f, 0x45, 0x32, 0x38, 0x0e,
+	0x98, 0x30, 0x13, 0x17, 0x10, 0x72, 0x07, 0xaa, 0xae, 0x94, 0x22, 0x4d, 0x15, 0x1f, 0x16, 0x2f,
+	0x91, 0xee, 0x2e, 0x4a, 0x86, 0x91, 0x14, 0x73, 0xaa, 0x59, 0xab, 0x5f, 0x00, 0xe4, 0x20, 0xda,
+	0x7a, 0xc6, 0xe6, 0x46, 0x2b, 0x36, 0xc9, 0x55, 0xa8, 0x3e, 0x73, 0xc3, 0x19, 0x33, 0xf1, 0xad,
+	0x3b, 0x5f, 0x5a, 0x5f, 0x94, 0x9c, 0x3f, 0x59, 0x50, 0x37, 0x97, 0x0a, 0xb9, 0x0d, 0x75, 0x75,
+	0xa9, 0x30, 0xf1, 0x1f, 0x0e, 0x4d, 0x4a, 0x21, 0xdb, 0xd9, 0x6d, 0x59, 0xb0, 0xd1, 0xa8, 0xd2,
+	0xb7, 0xa6, 0xb1, 0x31, 0xbf, 0x3b, 0xcb, 0x3e, 0x3b, 0x36, 0xd7, 0xe2, 0x0a, 0xb2, 0x07, 0xec,
+	0x38, 0x88, 0x02, 0xf4, 0x0f, 0x45, 0x11, 0xb9, 0x9d, 0xae, 0xba, 0xa2, 0x34, 0x7e, 0x50, 0xd4,
+	0x78, 0x79, 0xd1, 0x23, 0x68, 0x15, 0xa6, 0x79, 0xc5, 0xaa, 0x6f, 0x14, 0x57, 0x6d, 0xa6, 0x54,
+	0xea, 0xd4, 0xb0, 0x82, 0x17, 0xfe, 0x0b, 0xff, 0x7d, 0x0e, 0x90, 0xab, 0x7c, 0xfb, 0xa4, 0xe3,
+	0x7c, 0x53, 0x06, 0x18, 0xc7, 0x98, 0x96, 0x7d, 0x57, 0xdd, 0x0d, 0xed, 0xe0, 0x24, 0xe2, 0x82,
+	0x3d, 0x55, 0xc7, 0x58, 0x8d, 0x6f, 0xd0, 0x96, 0xc6, 0xd4, 0x89, 0x21, 0xbb, 0xd0, 0xf2, 0x59,
+	0xe2, 0x89, 0x40, 0x05, 0x94, 0x71, 0xfa, 0x3a, 0xae, 0x29, 0xd7, 0xd3, 0x1d, 0xe4, 0x0c, 0xed,
+	0xab, 0xe2, 0x18, 0xb2, 0x03, 0x6d, 0x76, 0x1e, 0x73, 0x21, 0xcd, 0x2c, 0xba, 0xf6, 0xb8, 0xa2,
+	0xab, 0x18, 0xc4, 0xd5, 0x4c, 0xb4, 0xc5, 0xf2, 0x0e, 0x71, 0xa1, 0xe2, 0xb9, 0xb1, 0xbe, 0x78,
+	0x5b, 0x3b, 0xf6, 0x85, 0xf9, 0xfa, 0x6e, 0xac, 0x9d, 0xd6, 0xfb, 0x0c, 0xd7, 0xfa, 0xeb, 0xbf,
+	0xae, 0xdf, 0x2a, 0xdc, 0xb6, 0x53, 0x7e, 0x34, 0xdf, 0x56, 0xf1, 0x72, 0x16, 0xc8, 0xed, 0x99,
+	0x0c, 0xc2, 0x6d, 0x37, 0x0e, 0x50, 0x1d, 0x0e, 0x1c, 0x0d, 0xa8, 0x52, 0x4d, 0x3e, 0x86, 0xa6,
+	0xb2, 0xe7, 0xa9, 0x94, 0xa1, 0xca, 0x83, 0x65, 0x93, 0xcd, 0x0e, 0x65, 0xb8, 0xfa, 0x33, 0xe8,
+	0x5c, 0x5c, 0xd4, 0xbb, 0x6c, 0xd0, 0xea, 0x5d, 0x68, 0x66, 0x46, 0xbe, 0x69, 0x60, 0xa3, 0xb8,
+	0xb3, 0x7f, 0x2c, 0x41, 0x4d, 0x1f, 0x39, 0x72, 0x17, 0x9a, 0x21, 0xf7, 0x5c, 0x34, 0x20, 0xad,
+	0x0d, 0x3f, 0xca, 0x4f, 0x64, 0xf7, 0x41, 0x2a, 0xd3, 0x2e, 0xcf, 0xb9, 0x18, 0x81, 0x41, 0x74,
+	0xcc, 0xd3, 0x23, 0xb2, 0x92, 0x0f, 0x1a, 0x45, 0xc7, 0x9c, 0x6a, 0xe1, 0xea, 0x7d, 0x58, 0x59,
+	0x54, 0xf1, 0x0a, 0x3b, 0xaf, 0x2f, 0xc6, 0xb2, 0x4a, 0xe8, 0xd9, 0xa0, 0xa2, 0xd9, 0x77, 0xa1,
+	0x99, 0xe1, 0x64, 0xeb, 0xb2, 0xe1, 0xed, 0xe2, 0xc8, 0x82, 0xad, 0x4e, 0x08, 0x90, 0x9b, 0x86,
+	0x99, 0x0c, 0x8b, 0x50, 0x75, 0x11, 0x6b, 0x33, 0xb2, 0xbe, 0xba, 0x14, 0x5d, 0xe9, 0x2a, 0x53,
+	0xda, 0x54, 0xb5, 0x49, 0x17, 0xc0, 0xcf, 0x4e, 0xf3, 0x6b, 0xce, 0x78, 0x81, 0xe1, 0x8c, 0xa1,
+	0x91, 0x1a, 0x41, 0x36, 0xa0, 0x95, 0x98, 0x99, 0xb1, 0xe4, 0xc2, 0xe9, 0xaa, 0xb4, 0x08, 0x61,
+	0xe9, 0x24, 0xdc, 0xe8, 0x84, 0x2d, 0x94, 0x4e, 0x14, 0x11, 0x6a, 0x04, 0xce, 0x13, 0xa8, 0x2a,
+	0x00, 0xcf, 0x60, 0x22, 0x5d, 0x21, 0x4d, 0x15, 0xa6, 0xab, 0x12, 0x9e, 0xa8, 0x69, 0x7b, 0x15,
+	0x8c, 0x52, 0xaa, 0x09, 0xe4, 0x06, 0xd6, 0x3e, 0xbe, 0x6d, 0xbd, 0x96, 0x87, 0x62, 0xe7, 0xa7,
+	0xd0, 0x48, 0x61, 0x5c, 0xf9, 0x83, 0x20, 0x62, 0xc6, 0x44, 0xd5, 0xc6, 0xea, 0xb5, 0x7f, 0xea,
+	0x0a, 0xd7, 0x93, 0x4c, 0xd7, 0x0f, 0x55, 0x9a, 0x03, 0xce, 0x75, 0x68, 0x15, 0x8e, 0x16, 0x86,
+	0xdb, 0x63, 0xb5, 0x8d, 0xfa, 0x80, 0xeb, 0x8e, 0xf3, 0x0d, 0xd6, 0xd6, 0x69, 0xb9, 0xf4, 0x63,
+	0x80, 0x53, 0x29, 0xe3, 0xa7, 0xaa, 0x7e, 0x32, 0xbe, 0x6f, 0x22, 0xa2, 0x18, 0x64, 0x1d, 0x5a,
+	0xd8, 0x49, 0x8c, 0x5c, 0xc7, 0xbb, 0x1a, 0x91, 0x68, 0xc2, 0xc7, 0xd0, 0x3c, 0xce, 0x86, 0x97,
+	0xcd, 0xd6, 0xa5, 0xa3, 0x3f, 0x82, 0x46, 0xc4, 0x8d, 0x4c, 0x97, 0x73, 0xf5, 0x88, 0x67, 0xe3,
+	0xdc, 0x30, 0x34, 0xb2, 0xaa, 0x1e, 0xe7, 0x86, 0xa1, 0x12, 0x3a, 0xb7, 0xe0, 0x47, 0x97, 0x5e,
+	0x09, 0xe4, 0x03, 0xa8, 0x1d, 0x07, 0xa1, 0x54, 0xd7, 0x05, 0x96, 0x8f, 0xa6, 0xe7, 0xfc, 0xab,
+	0x04, 0x90, 0x6f, 0x3b, 0xe9, 0xe8, 0xbc, 0x8f, 0x9c, 0xb6, 0xce, 0xf3, 0x21, 0x34, 0xa6, 0x26,
+	0x83, 0x98, 0x0d, 0xbd, 0xb6, 0x18, 0x2a, 0xdd, 0x34, 0xc1, 0xe8, 0xdc, 0xb2, 0x63, 0x72, 0xcb,
+	0xbb, 0x54, 0xf2, 0xd9, 0x0c, 0xaa, 0xc4, 0x29, 0xbe, 0xc8, 0x20, 0x3f, 0x85, 0xd4, 0x48, 0x56,
+	0xef, 0xc3, 0xf2, 0xc2, 0x94, 0x6f, 0x79, 0x9b, 0xe4, 0x99, 0xb0, 0x78, 0x04, 0x6f, 0x43, 0x4d,
+	0x97, 0xb6, 0x18, 0x2f, 0xd8, 0x32, 0x6a, 0x54, 0x5b, 0xd5, 0x1a, 0x07, 0xe9, 0xbb, 0x68, 0x74,
+	0xe0, 0xec, 0x40, 0x4d, 0x3f, 0xfc, 0xc8, 0x26, 0xd4, 0x5d, 0x4f, 0x9f, 0xd5, 0x42, 0xbe, 0x40,
+	0xe1, 0xae, 0x82, 0x69, 0x2a, 0x76, 0xfe, 0x6c, 0x01, 0xe4, 0xf8, 0x3b, 0xd4, 0xba, 0x5f, 0xc2,
+	0x4a, 0xc2, 0x3c, 0x1e, 0xf9, 0xae, 0x98, 0x2b, 0xa9, 0x6d, 0xbd, 0x76, 0xc8, 0x05, 0x66, 0xa1,
+	0xee, 0x2d, 0xbf, 0xb9, 0xee, 0xdd, 0x84, 0x8a, 0xc7, 0xe3, 0xb9, 0xb9, 0x62, 0xc8, 0xe2, 0x42,
+	0xfa, 0x3c, 0x9e, 0xe3, 0x33, 0x17, 0x19, 0xa4, 0x0b, 0xb5, 0xe9, 0x99, 0x7a, 0x0a, 0xeb, 0x67,
+	0xc4, 0xd5, 0x45, 0xee, 0xc3, 0x33, 0x6c, 0xe3, 0xc3, 0x59, 0xb3, 0xc8, 0x2d, 0xa8, 0x4e, 0xcf,
+	0xfc, 0x40, 0xa8, 0x9b, 0xa2, 0xa5, 0x6b, 0xca, 0x22, 0x7d, 0x10, 0x08, 0x7c, 0x1e, 0x2b, 0x0e,
+	0x71, 0xc0, 0x12, 0x53, 0xf5, 0x92, 0x68, 0xed, 0x74, 0x16, 0x99, 0x74, 0xba, 0xb7, 0x44, 0x2d,
+	0x31, 0xed, 0x35, 0xa0, 0xa6, 0xfd, 0xea, 0xfc, 0xb3, 0x0c, 0x2b, 0x8b, 0x56, 0x62, 0x1c, 0x24,
+	0xc2, 0x4b, 0xe3, 0x20, 0x11, 0x5e, 0xf6, 0x24, 0xb0, 0x0a, 0x4f, 0x02, 0x07, 0xaa, 0xfc, 0x79,
+	0xc4, 0x44, 0xf1, 0xcd, 0xdf, 0x3f, 0xe5, 0xcf, 0x23, 0x2c, 0x70, 0xb5, 0x68, 0xa1, 0x5e, 0xac,
+	0x9a, 0x7a, 0xf1, 0x06, 0x2c, 0x1f, 0xf3, 0x30, 0xe4, 0xcf, 0x27, 0xf3, 0x69, 0x18, 0x44, 0x67,
+	0xa6, 0x68, 0x5c, 0x04, 0xc9, 0x26, 0x5c, 0xf1, 0x03, 0x81, 0xe6, 0xf4, 0x79, 0x24, 0x59, 0xa4,
+	0x5e, 0x51, 0xc8, 0xbb, 0x08, 0x93, 0xaf, 0x60, 0xc3, 0x95, 0x92, 0x4d, 0x63, 0xf9, 0x28, 0x8a,
+	0x5d, 0xef, 0x6c, 0xc0, 0x3d, 0x75, 0x66, 0xa7, 0xb1, 0x2b, 0x83, 0xa3, 0x20, 0xc4, 0x07, 0x63,
+	0x5d, 0x0d, 0x7d, 0x23, 0x8f, 0x7c, 0x0a, 0x2b, 0x9e, 0x60, 0xae, 0x64, 0x03, 0x96, 0xc8, 0x03,
+	0x57, 0x9e, 0xaa, 0x07, 0x57, 0x83, 0x5e, 0x40, 0x71, 0x0d, 0x2e, 0x5a, 0xfb, 0x24, 0x08, 0x7d,
+	0xcf, 0x15, 0xbe, 0xdd, 0xd4, 0x6b, 0x58, 0x00, 0x49, 0x17, 0x88, 0x02, 0x86, 0xd3, 0x58, 0xce,
+	0x33, 0x2a, 0x28, 0xea, 0x2b, 0x24, 0x98, 0x55, 0x65, 0x30, 0x65, 0x89, 0x74, 0xa7, 0xb1, 0xfa,
+	0x57, 0x51, 0xa6, 0x39, 0x40, 0x6e, 0x42, 0x27, 0x88, 0xbc, 0x70, 0xe6, 0xb3, 0xa7, 0x31, 0x2e,
+	0x44, 0x44, 0x89, 0xdd, 0x56, 0x39, 0xe8, 0x8a, 0xc1, 0x0f, 0x0c, 0x8c, 0x54, 0x76, 0x7e, 0x81,
+	0xba, 0xac, 0xa9, 0xec, 0x7c, 0x81, 0xea, 0x7c, 0x5d, 0x82, 0xce, 0xc5, 0xc0, 0xc3, 0x6d, 0x8b,
+	0x71, 0xf1, 0xe6, 0x08, 0x63, 0x3b, 0xdb, 0x4a, 0xab, 0xb0, 0x95, 0xe9, 0xa5, 0x58, 0x2e, 0x5c,
+	0x8a, 0x59, 0x58, 0x54, 0x5e, 0x1f, 0x16, 0x0b, 0x0b, 0xad, 0x5e, 0x58, 0xa8, 0xf3, 0xbb, 0x12,
+	0x5c, 0xb9, 0x10, 0xdc, 0x6f, 0x6d, 0xd1, 0x06, 0xb4, 0xa6, 0xee, 0x19, 0x3b, 0x70, 0x85, 0x0a,
+	0x99, 0xb2, 0x2e, 0x29, 0x0b, 0xd0, 0xff, 0xc0, 0xbe, 0x08, 0xda, 0xc5, 0x13, 0xf5, 0x4a, 0xdb,
+	0xd2, 0x00, 0xd9, 0xe7, 0xf2, 0x1e, 0x9f, 0x99, 0x0b, 0xb7, 0x41, 0x17, 0xc1, 0xcb, 0x61, 0x54,
+	0x7e, 0x45, 0x18, 0x39, 0xfb, 0xd0, 0x48, 0x0d, 0x24, 0xeb, 0xe6, 0xb7, 0x44, 0x29, 0xff, 0x3d,
+	0xf6, 0x28, 0x61, 0x02, 0x6d, 0x57, 0x02, 0xf2, 0x09, 0x54, 0x4f, 0x04, 0x9f, 0xc5, 0xb6, 0x75,
+	0x99, 0xa1, 0x25, 0xce, 0x04, 0xea, 0x06, 0x21, 0x5b, 0x50, 0x3b, 0x9a, 0xef, 0xa7, 0xf5, 0x8e,
+	0x49, 0x17, 0xd8, 0xf7, 0x0d, 0x03, 0x73, 0x90, 0x66, 0x90, 0xab, 0x50, 0x39, 0x9a, 0x8f, 0x06,
+	0xfa, 0x81, 0x88, 0x99, 0x0c, 0x7b, 0xbd, 0x9a, 0x36, 0xc8, 0x79, 0x00, 0xed, 0xe2, 0x38, 0x74,
+	0x4a, 0xa1, 0x8e, 0x52, 0xed, 0x3c, 0x65, 0x5b, 0x6f, 0x48, 0xd9, 0x5b, 0x9b, 0x50, 0x37, 0x3f,
+	0x80, 0x48, 0x13, 0xaa, 0x8f, 0xf6, 0x27, 0xc3, 0xc3, 0xce, 0x12, 0x69, 0x40, 0x65, 0x6f, 0x3c,
+	0x39, 0xec, 0x94, 0xb0, 0xb5, 0x3f, 0xde, 0x1f, 0x76, 0xac, 0xad, 0x9b, 0xd0, 0x2e, 0xfe, 0x02,
+	0x22, 0x2d, 0xa8, 0x4f, 0x76, 0xf7, 0x07, 0xbd, 0xf1, 0x2f, 0x3a, 0x4b, 0xa4, 0x0d, 0x8d, 0xd1,
+	0xfe, 0x64, 0xd8, 0x7f, 0x44, 0x87, 0x9d, 0xd2, 0xd6, 0xcf, 0xa1, 0x99, 0xfd, 0x65, 0x40, 0x0d,
+	0xbd, 0xd1, 0xfe, 0xa0, 0xb3, 0x44, 0x00, 0x6a, 0x93, 0x61, 0x9f, 0x0e, 0x51, 0x6f, 0x1d, 0xca,
+	0x93, 0xc9, 0x5e, 0xc7, 0xc2, 0x59, 0xfb, 0xbb, 0xfd, 0xbd, 0x61, 0xa7, 0x8c, 0xcd, 0xc3, 0x87,
+	0x07, 0xf7, 0x26, 0x9d, 0xca, 0xd6, 0xe7, 0x70, 0xe5, 0xc2, 0x4b, 0x5e, 0x8d, 0xde, 0xdb, 0xa5,
+	0x43, 0xd4, 0xd4, 0x82, 0xfa, 0x01, 0x1d, 0x3d, 0xde, 0x3d, 0x1c, 0x76, 0x4a, 0x28, 0x78, 0x30,
+	0xee, 0xdf, 0x1f, 0x0e, 0x3a, 0x56, 0xef, 0xda, 0xb7, 0x2f, 0xd6, 0x4a, 0xdf, 0xbd, 0x58, 0x2b,
+	0x7d, 0xff, 0x62, 0xad, 0xf4, 0xb7, 0x17, 0x6b, 0xa5, 0xaf, 0x5f, 0xae, 0x2d, 0x7d, 0xf7, 0x72,
+	0x6d, 0xe9, 0xfb, 0x97, 0x6b, 0x4b, 0x47, 0x35, 0xf5, 0x43, 0xf6, 0xb3, 0x7f, 0x0f, 0x00, 0xc9,
+	0x8a, 0xc0, 0xf2, 0xd0, 0x15, 0x00, 0x00,
 }
 
 func (m *Op) Marshal() (dAtA []byte, err error) {
@@ -2831,6 +2852,11 @@ func (m *Meta) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.CoreDumpSize != 0 {
+		i = encodeVarintOps(dAtA, i, uint64(m.CoreDumpSize))
+		i--
+		dAtA[i] = 0x40
+	}
 	if len(m.Hostname) > 0 {
 		i -= len(m.Hostname)
 		copy(dAtA[i:], m.Hostname)
@@ -3354,6 +3380,11 @@ func (m *OpMetadata) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.CacheTtl != 0 {
+		i = encodeVarintOps(dAtA, i, uint64(m.CacheTtl))
+		i--
+		dAtA[i] = 0x30
+	}
 	if len(m.Caps) > 0 {
 		keysForCaps := make([]string, 0, len(m.Caps))
 		for k := range m.Caps {
@@ -4755,6 +4786,9 @@ func (m *Meta) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovOps(uint64(l))
 	}
+	if m.CoreDumpSize != 0 {
+		n += 1 + sovOps(uint64(m.CoreDumpSize))
+	}
 	return n
 }
 
@@ -4968,6 +5002,9 @@ func (m *OpMetadata) Size() (n int) {
 			n += mapEntrySize + 1 + sovOps(uint64(mapEntrySize))
 		}
 	}
+	if m.CacheTtl != 0 {
+		n += 1 + sovOps(uint64(m.CacheTtl))
+	}
 	return n
 }
 
@@ -6491,6 +6528,25 @@ func (m *Meta) Unmarshal(dAtA []byte) error {
 			}
 			m.Hostname = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CoreDumpSize", wireType)
+			}
+			m.CoreDumpSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowOps
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.CoreDumpSize |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipOps(dAtA[iNdEx:])
@@ -8228,6 +8284,25 @@ func (m *OpMetadata) Unmarshal(dAtA []byte) error {
 			}
 			m.Caps[github_com_moby_buildkit_util_apicaps.CapID(mapkey)] = mapvalue
 			iNdEx = postIndex
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CacheTtl", wireType)
+			}
+			m.CacheTtl = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowOps
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.CacheTtl |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipOps(dAtA[iNdEx:])
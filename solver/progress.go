@@ -51,6 +51,8 @@ func (j *Job) Status(ctx context.Context, ch chan *client.SolveStatus) error {
 					Timestamp: p.Timestamp,
 					Started:   v.Started,
 					Completed: v.Completed,
+					Host:      v.Host,
+					Retries:   int64(v.Retries),
 				}
 				ss.Statuses = append(ss.Statuses, vs)
 			case client.VertexLog:
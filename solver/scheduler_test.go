@@ -1117,6 +1117,56 @@ func TestSlowCache(t *testing.T) {
 
 }
 
+// TestExecCacheKey validates that the cache key passed to the executed op
+// depends on the content of the inputs and not only on their vertexes
+func TestExecCacheKey(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	build := func(inputValue string) digest.Digest {
+		l := NewSolver(SolverOpt{
+			ResolveOpFunc: testOpResolver,
+		})
+		defer l.Close()
+
+		j, err := l.NewJob("j0")
+		require.NoError(t, err)
+		defer j.Discard()
+
+		var key digest.Digest
+		g := Edge{
+			Vertex: vtx(vtxOpt{
+				name:         "v0",
+				cacheKeySeed: "seed0",
+				value:        "result0",
+				execPreFunc: func(ctx context.Context) error {
+					key = ExecCacheKeyOf(ctx)
+					return nil
+				},
+				inputs: []Edge{
+					{Vertex: vtx(vtxOpt{
+						name:         "v1",
+						cacheKeySeed: "seed1",
+						value:        inputValue,
+					})},
+				},
+				slowCacheCompute: map[int]ResultBasedCacheFunc{
+					0: digestFromResult,
+				},
+			}),
+		}
+		res, err := j.Build(ctx, g)
+		require.NoError(t, err)
+		require.Equal(t, unwrap(res), "result0")
+		require.NotEmpty(t, key)
+		return key
+	}
+
+	k1 := build("content1")
+	require.Equal(t, k1, build("content1"))
+	require.NotEqual(t, k1, build("content2"))
+}
+
 // TestParallelInputs validates that inputs are processed in parallel
 func TestParallelInputs(t *testing.T) {
 	t.Parallel()
@@ -1427,6 +1477,52 @@ func TestMultipleCacheSources(t *testing.T) {
 	j1 = nil
 }
 
+func TestCacheSourcesPriority(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	build := func(cm CacheManager, value string, cacheSource CacheManager) string {
+		l := NewSolver(SolverOpt{
+			ResolveOpFunc: testOpResolver,
+			DefaultCache:  cm,
+		})
+		defer l.Close()
+
+		j, err := l.NewJob("j")
+		require.NoError(t, err)
+		defer j.Discard()
+
+		res, err := j.Build(ctx, Edge{
+			Vertex: vtx(vtxOpt{
+				name:         "v0",
+				cacheKeySeed: "seed0",
+				value:        value,
+				cacheSource:  cacheSource,
+			}),
+		})
+		require.NoError(t, err)
+		return unwrap(res)
+	}
+
+	// e.g. the caches of the main branch and of a feature branch
+	cmMain := NewInMemoryCacheManager()
+	cmBranch := NewInMemoryCacheManager()
+	require.Equal(t, "result-main", build(cmMain, "result-main", nil))
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, "result-branch", build(cmBranch, "result-branch", nil))
+
+	// the newest record is used by default
+	imports := NewCombinedCacheManager([]CacheManager{cmMain, cmBranch}, nil)
+	for i := 0; i < 5; i++ {
+		require.Equal(t, "result-branch", build(NewInMemoryCacheManager(), "no-cache", imports))
+	}
+
+	SetCachePriority(cmMain, 1)
+	for i := 0; i < 5; i++ {
+		require.Equal(t, "result-main", build(NewInMemoryCacheManager(), "no-cache", imports))
+	}
+}
+
 func TestRepeatBuildWithIgnoreCache(t *testing.T) {
 	t.Parallel()
 	ctx := context.TODO()
@@ -2177,6 +2273,69 @@ func TestCacheExporting(t *testing.T) {
 	require.Equal(t, expTarget.records[2].links, 0)
 }
 
+func TestCacheExportingConvertAll(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	// the results have remotes, e.g. blobs of another compression
+	cacheManager := NewCacheManager(ctx, "remotes", NewInMemoryCacheStorage(), &remoteResultStore{NewInMemoryResultStorage()})
+
+	l := NewSolver(SolverOpt{
+		ResolveOpFunc: testOpResolver,
+		DefaultCache:  cacheManager,
+	})
+	defer l.Close()
+
+	j0, err := l.NewJob("j0")
+	require.NoError(t, err)
+
+	defer func() {
+		if j0 != nil {
+			j0.Discard()
+		}
+	}()
+
+	g0 := Edge{
+		Vertex: vtxSum(1, vtxOpt{
+			inputs: []Edge{
+				{Vertex: vtxConst(2, vtxOpt{})},
+				{Vertex: vtxConst(3, vtxOpt{})},
+			},
+		}),
+	}
+
+	res, err := j0.Build(ctx, g0)
+	require.NoError(t, err)
+	require.Equal(t, unwrapInt(res), 6)
+
+	require.NoError(t, j0.Discard())
+	j0 = nil
+
+	for _, convertAll := range []bool{false, true} {
+		var converted int
+		opt := testExporterOpts(true)
+		convert := opt.Convert
+		opt.Convert = func(ctx context.Context, res Result) (*Remote, error) {
+			converted++
+			return convert(ctx, res)
+		}
+		opt.ConvertAll = convertAll
+
+		expTarget := newTestExporterTarget()
+		_, err = res.CacheKeys()[0].Exporter.ExportTo(ctx, expTarget, opt)
+		require.NoError(t, err)
+
+		expTarget.normalize()
+		require.Equal(t, len(expTarget.records), 3)
+		require.Equal(t, expTarget.records[0].results, 1)
+		if convertAll {
+			require.Equal(t, 1, converted)
+		} else {
+			require.Equal(t, 0, converted)
+		}
+	}
+}
+
 func TestCacheExportingModeMin(t *testing.T) {
 	t.Parallel()
 	ctx := context.TODO()
@@ -3719,6 +3878,17 @@ func digestFromResult(ctx context.Context, res Result, _ session.Group) (digest.
 	return digest.FromBytes([]byte(unwrap(res))), nil
 }
 
+// remoteResultStore loads a remote for every result
+type remoteResultStore struct {
+	CacheResultStorage
+}
+
+func (s *remoteResultStore) LoadRemote(ctx context.Context, res CacheResult, _ session.Group) (*Remote, error) {
+	return &Remote{Descriptors: []ocispecs.Descriptor{{
+		Annotations: map[string]string{"value": "existing"},
+	}}}, nil
+}
+
 func testExporterOpts(all bool) CacheExportOpt {
 	mode := CacheExportModeMin
 	if all {
@@ -53,6 +53,9 @@ type VertexOptions struct {
 	CacheSources []CacheManager
 	Description  map[string]string // text values with no special meaning for solver
 	ExportCache  *bool
+	// CacheTTL makes the cache keys of the vertex change with every time
+	// window of this duration
+	CacheTTL time.Duration
 	// WorkerConstraint
 }
 
@@ -98,6 +101,9 @@ type CacheExportOpt struct {
 	Mode CacheExportMode
 	// Session is the session group to client (for auth credentials etc)
 	Session session.Group
+	// ConvertAll converts all the exported results with Convert instead of
+	// exporting their existing remotes, e.g. to recompress their blobs
+	ConvertAll bool
 }
 
 // CacheExporter can export the artifacts of the build chain
@@ -153,6 +159,14 @@ type Op interface {
 	Acquire(ctx context.Context) (release ReleaseFunc, err error)
 }
 
+// PinProvider is implemented by ops that resolve the reference in their
+// definition to the version they use, e.g. an image tag to a digest
+type PinProvider interface {
+	// Pin returns the resolved reference, or an empty string if the op hasn't
+	// resolved it
+	Pin() string
+}
+
 type ResultBasedCacheFunc func(context.Context, Result, session.Group) (digest.Digest, error)
 type PreprocessFunc func(context.Context, Result, session.Group) error
 
@@ -210,6 +224,13 @@ type CacheRecord struct {
 	key          *CacheKey
 }
 
+func (r *CacheRecord) importPriority() int {
+	if r.cacheManager == nil {
+		return 0
+	}
+	return r.cacheManager.priority
+}
+
 // CacheManager determines if there is a result that matches the cache keys
 // generated during the build that could be reused instead of fully
 // reevaluating the vertex and its inputs. There can be multiple cache
@@ -15,6 +15,7 @@ import (
 	ctdlabels "github.com/containerd/containerd/labels"
 	"github.com/containerd/containerd/leases"
 	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/reference"
 	"github.com/containerd/containerd/remotes/docker"
 	"github.com/containerd/containerd/snapshots"
 	"github.com/moby/buildkit/cache"
@@ -24,6 +25,8 @@ import (
 	"github.com/moby/buildkit/solver"
 	"github.com/moby/buildkit/solver/errdefs"
 	"github.com/moby/buildkit/source"
+	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/buildkit/util/contentutil"
 	"github.com/moby/buildkit/util/flightcontrol"
 	"github.com/moby/buildkit/util/imageutil"
 	"github.com/moby/buildkit/util/leaseutil"
@@ -193,12 +196,7 @@ func (p *puller) CacheKey(ctx context.Context, g session.Group, index int) (cach
 		p.releaseTmpLeases = done
 		defer imageutil.AddLease(done)
 
-		resolveProgressDone := oneOffProgress(ctx, "resolve "+p.Src.String())
-		defer func() {
-			resolveProgressDone(err)
-		}()
-
-		p.manifest, err = p.PullManifests(ctx)
+		p.manifest, err = p.pullManifests(ctx, g)
 		if err != nil {
 			return nil, err
 		}
@@ -238,10 +236,11 @@ func (p *puller) CacheKey(ctx context.Context, g session.Group, index int) (cach
 				labels[layersKey] = strings.TrimSuffix(layers, ",")
 
 				p.descHandlers[desc.Digest] = &cache.DescHandler{
-					Provider:       p.manifest.Provider,
+					Provider:       p.layerProvider(p.manifest.Provider),
 					Progress:       progressController,
 					SnapshotLabels: labels,
 					Ref:            p.manifest.Ref,
+					Annotations:    desc.Annotations,
 				}
 			}
 		}
@@ -277,6 +276,103 @@ func (p *puller) CacheKey(ctx context.Context, g session.Group, index int) (cach
 	return p.configKey, cacheOpts, cacheDone, nil
 }
 
+// pullManifests resolves the image, trying the fallback refs in order if the
+// reference can't be pulled. The puller switches to the resolved ref so that
+// the layers are fetched from the same registry.
+func (p *puller) pullManifests(ctx context.Context, g session.Group) (*pull.PulledManifests, error) {
+	m, err := p.resolveManifests(ctx)
+	for _, ref := range p.id.FallbackRefs {
+		if err == nil || errdefs.IsCanceled(err) {
+			break
+		}
+		bklog.G(ctx).Warnf("failed to resolve %s, trying %s: %v", p.Ref, ref.String(), err)
+		p.Ref = ref.String()
+		p.Puller = &pull.Puller{
+			ContentStore: p.ContentStore,
+			Platform:     p.Platform,
+			Src:          ref,
+			Resolver:     resolver.DefaultPool.GetResolver(p.RegistryHosts, p.Ref, "pull", p.SessionManager, g).WithImageStore(p.ImageStore, p.id.ResolveMode),
+		}
+		m, err = p.resolveManifests(ctx)
+	}
+	return m, err
+}
+
+// layerProvider returns the provider of the layers that falls back to the
+// other refs of the image if a layer can't be pulled from the resolved ref.
+// The refs are equivalent, so the layers have the same digests in them.
+func (p *puller) layerProvider(provider func(session.Group) content.Provider) func(session.Group) content.Provider {
+	var refs []string
+	for _, ref := range append([]reference.Spec{p.id.Reference}, p.id.FallbackRefs...) {
+		if ref.String() != p.Ref {
+			refs = append(refs, ref.String())
+		}
+	}
+	if len(refs) == 0 {
+		return provider
+	}
+	return func(g session.Group) content.Provider {
+		return &fallbackProvider{
+			Provider: provider(g),
+			puller:   p,
+			refs:     refs,
+			g:        g,
+		}
+	}
+}
+
+type fallbackProvider struct {
+	content.Provider
+	puller *puller
+	refs   []string
+	g      session.Group
+}
+
+func (fp *fallbackProvider) ReaderAt(ctx context.Context, desc ocispecs.Descriptor) (content.ReaderAt, error) {
+	ra, err := fp.Provider.ReaderAt(ctx, desc)
+	if err == nil || errdefs.IsCanceled(err) {
+		return ra, err
+	}
+	p := fp.puller
+	for _, ref := range fp.refs {
+		bklog.G(ctx).Warnf("failed to pull %s from %s, trying %s: %v", desc.Digest, p.Ref, ref, err)
+		r := resolver.DefaultPool.GetResolver(p.RegistryHosts, ref, "pull", p.SessionManager, fp.g).WithImageStore(p.ImageStore, p.id.ResolveMode)
+		fetcher, ferr := r.Fetcher(ctx, ref)
+		if ferr != nil {
+			continue
+		}
+		if ra, ferr := contentutil.FromFetcher(fetcher).ReaderAt(ctx, desc); ferr == nil {
+			return ra, nil
+		}
+	}
+	return nil, err
+}
+
+// Pin returns the ref the image was resolved from with the digest of its
+// manifest
+func (p *puller) Pin() string {
+	if p.manifest == nil {
+		return ""
+	}
+	ref, err := reference.Parse(p.manifest.Ref)
+	if err != nil {
+		return ""
+	}
+	pin := ref.Locator
+	if tag := strings.SplitN(ref.Object, "@", 2)[0]; tag != "" {
+		pin += ":" + tag
+	}
+	return pin + "@" + p.manifest.MainManifestDesc.Digest.String()
+}
+
+func (p *puller) resolveManifests(ctx context.Context) (_ *pull.PulledManifests, err error) {
+	resolveProgressDone := oneOffProgress(ctx, "resolve "+p.Src.String())
+	defer func() {
+		resolveProgressDone(err)
+	}()
+	return p.PullManifests(ctx)
+}
+
 func (p *puller) Snapshot(ctx context.Context, g session.Group) (ir cache.ImmutableRef, err error) {
 	p.Puller.Resolver = resolver.DefaultPool.GetResolver(p.RegistryHosts, p.Ref, "pull", p.SessionManager, g).WithImageStore(p.ImageStore, p.id.ResolveMode)
 
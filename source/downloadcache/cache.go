@@ -0,0 +1,325 @@
+// Package downloadcache implements a download cache of the daemon that is
+// shared by the http and git sources of all workers, so that builds fetching
+// the same URL hit the network once.
+package downloadcache
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/locker"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketEntries = []byte("entries")
+
+// DefaultTTL is the TTL of a cache with no TTL set
+const DefaultTTL = 10 * time.Minute
+
+type Opt struct {
+	// Root is the directory the downloads are stored in
+	Root string
+	// TTL is how long downloads and resolved values are used without
+	// revalidating them with the remote
+	TTL time.Duration
+	// MaxSize is the size in bytes the least recently used downloads are
+	// removed above. 0 doesn't limit the size.
+	MaxSize int64
+	// CacheResolved reuses the values of Resolve, e.g. the commits git
+	// branches resolve to, for the TTL. Builds don't see changes of the
+	// remote within the TTL then, so Resolve calls fn every time unless set.
+	CacheResolved bool
+}
+
+// Cache stores downloaded files content-addressed by their digest, so
+// that URLs with the same content share the file, and directories like git
+// mirrors by key. Concurrent downloads of the same key wait for the first
+// one.
+type Cache struct {
+	opt    Opt
+	db     *bolt.DB
+	locker *locker.Locker
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	// inUse counts the users of the entries by key, they are not pruned
+	inUse map[string]int
+}
+
+type entry struct {
+	// Digest of the downloaded file
+	Digest digest.Digest `json:"digest,omitempty"`
+	// Header are the response headers of the download
+	Header map[string]string `json:"header,omitempty"`
+	// Vary are the request headers named by the Vary header of the
+	// response with their values in the request of the download
+	Vary map[string]string `json:"vary,omitempty"`
+	// Value is a resolved value, e.g. the commit of a git ref
+	Value string `json:"value,omitempty"`
+	// Dir is set for directory entries
+	Dir       bool      `json:"dir,omitempty"`
+	Size      int64     `json:"size"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	UsedAt    time.Time `json:"usedAt"`
+}
+
+// New returns the download cache in opt.Root
+func New(opt Opt) (*Cache, error) {
+	if opt.TTL == 0 {
+		opt.TTL = DefaultTTL
+	}
+	for _, d := range []string{"blobs", "dirs", "ingest"} {
+		if err := os.MkdirAll(filepath.Join(opt.Root, d), 0700); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	// downloads interrupted by a restart
+	if err := os.RemoveAll(filepath.Join(opt.Root, "ingest")); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := os.MkdirAll(filepath.Join(opt.Root, "ingest"), 0700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	db, err := bolt.Open(filepath.Join(opt.Root, "downloads.db"), 0600, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c := &Cache{
+		opt:     opt,
+		db:      db,
+		locker:  locker.New(),
+		now:     time.Now,
+		entries: map[string]*entry{},
+		inUse:   map[string]int{},
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketEntries)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var e entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				bklog.L.Warnf("invalid download cache entry %s: %v", k, err)
+				return nil
+			}
+			c.entries[string(k)] = &e
+			return nil
+		})
+	}); err != nil {
+		db.Close()
+		return nil, errors.WithStack(err)
+	}
+	return c, nil
+}
+
+// Close closes the index of the cache
+func (c *Cache) Close() error {
+	return c.db.Close()
+}
+
+// Resolve returns the value of key resolved by fn. With CacheResolved the
+// value is reused for the TTL of the cache and concurrent calls for the same
+// key call fn once.
+func (c *Cache) Resolve(ctx context.Context, key string, fn func(context.Context) (string, error)) (string, error) {
+	if !c.opt.CacheResolved {
+		return fn(ctx)
+	}
+	if e := c.fresh(key); e != nil {
+		return e.Value, nil
+	}
+	c.locker.Lock(key)
+	defer c.locker.Unlock(key)
+	if e := c.fresh(key); e != nil {
+		return e.Value, nil
+	}
+	v, err := fn(ctx)
+	if err != nil {
+		return "", err
+	}
+	now := c.now()
+	if err := c.set(key, &entry{Value: v, FetchedAt: now, UsedAt: now}); err != nil {
+		return "", err
+	}
+	return v, nil
+}
+
+// Dir calls fn with the directory of key, e.g. a git mirror. The calls for
+// the same key are serialized and the directory isn't removed while fn
+// runs. The directory is empty for the first call.
+func (c *Cache) Dir(ctx context.Context, key string, fn func(dir string) error) error {
+	c.locker.Lock(key)
+	defer c.locker.Unlock(key)
+
+	defer c.use(key)()
+
+	dir := c.dirPath(key)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := fn(dir); err != nil {
+		return err
+	}
+	size, err := dirSize(dir)
+	if err != nil {
+		return err
+	}
+	now := c.now()
+	if err := c.set(key, &entry{Dir: true, Size: size, FetchedAt: now, UsedAt: now}); err != nil {
+		return err
+	}
+	return c.prune()
+}
+
+// use marks key in use until the returned function is called, so that it
+// isn't pruned
+func (c *Cache) use(key string) func() {
+	c.mu.Lock()
+	c.inUse[key]++
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		if c.inUse[key]--; c.inUse[key] == 0 {
+			delete(c.inUse, key)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// fresh returns the entry of key if it was fetched within the TTL
+func (c *Cache) fresh(key string) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || c.now().Sub(e.FetchedAt) > c.opt.TTL {
+		return nil
+	}
+	e.UsedAt = c.now()
+	return e
+}
+
+func (c *Cache) get(key string) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[key]
+}
+
+func (c *Cache) set(key string, e *entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.setLocked(key, e)
+}
+
+func (c *Cache) setLocked(key string, e *entry) error {
+	dt, err := json.Marshal(e)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketEntries).Put([]byte(key), dt)
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	c.entries[key] = e
+	return nil
+}
+
+// prune removes the least recently used entries until the cache is within
+// MaxSize. Files are removed with their last entry.
+func (c *Cache) prune() error {
+	if c.opt.MaxSize <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var size int64
+	blobs := map[digest.Digest]int{}
+	keys := make([]string, 0, len(c.entries))
+	for k, e := range c.entries {
+		if e.Digest != "" {
+			if blobs[e.Digest] == 0 {
+				size += e.Size
+			}
+			blobs[e.Digest]++
+		} else {
+			size += e.Size
+		}
+		keys = append(keys, k)
+	}
+	if size <= c.opt.MaxSize {
+		return nil
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].UsedAt.Before(c.entries[keys[j]].UsedAt)
+	})
+
+	var removed []string
+	for _, k := range keys {
+		if size <= c.opt.MaxSize {
+			break
+		}
+		if c.inUse[k] > 0 {
+			continue
+		}
+		e := c.entries[k]
+		switch {
+		case e.Dir:
+			if err := os.RemoveAll(c.dirPath(k)); err != nil {
+				return errors.WithStack(err)
+			}
+			size -= e.Size
+		case e.Digest != "":
+			if blobs[e.Digest]--; blobs[e.Digest] == 0 {
+				// open files of responses that are being read stay valid
+				if err := os.Remove(c.blobPath(e.Digest)); err != nil && !os.IsNotExist(err) {
+					return errors.WithStack(err)
+				}
+				size -= e.Size
+			}
+		}
+		delete(c.entries, k)
+		removed = append(removed, k)
+	}
+	return errors.WithStack(c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketEntries)
+		for _, k := range removed {
+			if err := b.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func (c *Cache) blobPath(dgst digest.Digest) string {
+	return filepath.Join(c.opt.Root, "blobs", dgst.Algorithm().String(), dgst.Hex())
+}
+
+func (c *Cache) dirPath(key string) string {
+	return filepath.Join(c.opt.Root, "dirs", digest.FromString(key).Hex())
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, errors.WithStack(err)
+}
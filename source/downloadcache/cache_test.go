@@ -0,0 +1,308 @@
+package downloadcache
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+	srv, requests := newServer()
+	defer srv.Close()
+	c, clock, cleanup := newCache(t, 0)
+	defer cleanup()
+	client := &http.Client{Transport: c.Transport(http.DefaultTransport)}
+
+	eg, _ := errgroup.WithContext(context.TODO())
+	for i := 0; i < 10; i++ {
+		eg.Go(func() error {
+			dt, err := get(client, srv.URL+"/foo", "")
+			if err != nil {
+				return err
+			}
+			require.Equal(t, "content of /foo", string(dt))
+			return nil
+		})
+	}
+	require.NoError(t, eg.Wait())
+	require.Equal(t, int64(1), atomic.LoadInt64(requests))
+
+	resp, err := client.Head(srv.URL + "/foo")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, `"etag-/foo"`, resp.Header.Get("ETag"))
+	require.Equal(t, int64(1), atomic.LoadInt64(requests))
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/foo", nil)
+	require.NoError(t, err)
+	req.Header.Set("If-None-Match", `"etag-/foo"`)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotModified, resp.StatusCode)
+	require.Equal(t, int64(1), atomic.LoadInt64(requests))
+
+	// stale downloads are revalidated
+	clock.Add(DefaultTTL + time.Second)
+	dt, err := get(client, srv.URL+"/foo", "")
+	require.NoError(t, err)
+	require.Equal(t, "content of /foo", string(dt))
+	require.Equal(t, int64(2), atomic.LoadInt64(requests))
+	dt, err = get(client, srv.URL+"/foo", "")
+	require.NoError(t, err)
+	require.Equal(t, "content of /foo", string(dt))
+	require.Equal(t, int64(2), atomic.LoadInt64(requests))
+
+	// requests with credentials are not cached
+	for i := 0; i < 2; i++ {
+		_, err = get(client, srv.URL+"/foo", "Bearer token")
+		require.NoError(t, err)
+	}
+	require.Equal(t, int64(4), atomic.LoadInt64(requests))
+
+	// error responses are passed on without sending the request again
+	_, err = get(client, srv.URL+"/missing", "")
+	require.Error(t, err)
+	require.Equal(t, int64(5), atomic.LoadInt64(requests))
+}
+
+func TestTransportNotStored(t *testing.T) {
+	t.Parallel()
+	srv, requests := newServer()
+	defer srv.Close()
+	c, _, cleanup := newCache(t, 0)
+	defer cleanup()
+	client := &http.Client{Transport: c.Transport(http.DefaultTransport)}
+
+	var n int64
+	for _, p := range []string{"/private", "/no-store", "/vary-all"} {
+		for i := 0; i < 2; i++ {
+			dt, err := get(client, srv.URL+p, "")
+			require.NoError(t, err)
+			require.Equal(t, "content of "+p, string(dt))
+			n++
+			require.Equal(t, n, atomic.LoadInt64(requests))
+		}
+	}
+	require.Equal(t, 0, len(c.entries))
+}
+
+func TestTransportVary(t *testing.T) {
+	t.Parallel()
+	srv, requests := newServer()
+	defer srv.Close()
+	c, _, cleanup := newCache(t, 0)
+	defer cleanup()
+	client := &http.Client{Transport: c.Transport(http.DefaultTransport)}
+
+	getAs := func(accept string) string {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/vary", nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept", accept)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		dt, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(dt)
+	}
+
+	require.Equal(t, "content of /vary as text/plain", getAs("text/plain"))
+	require.Equal(t, "content of /vary as text/plain", getAs("text/plain"))
+	require.Equal(t, int64(1), atomic.LoadInt64(requests))
+
+	// requests with other values of the headers in Vary are not served the
+	// download of another request
+	require.Equal(t, "content of /vary as application/json", getAs("application/json"))
+	require.Equal(t, int64(2), atomic.LoadInt64(requests))
+	require.Equal(t, "content of /vary as application/json", getAs("application/json"))
+	require.Equal(t, int64(2), atomic.LoadInt64(requests))
+}
+
+func TestPrune(t *testing.T) {
+	t.Parallel()
+	srv, requests := newServer()
+	defer srv.Close()
+	c, clock, cleanup := newCache(t, 40)
+	defer cleanup()
+	client := &http.Client{Transport: c.Transport(http.DefaultTransport)}
+
+	for _, p := range []string{"/foo", "/bar", "/foo"} {
+		_, err := get(client, srv.URL+p, "")
+		require.NoError(t, err)
+		clock.Add(time.Second)
+	}
+	require.Equal(t, int64(2), atomic.LoadInt64(requests))
+
+	_, err := get(client, srv.URL+"/baz", "")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), atomic.LoadInt64(requests))
+
+	// /bar was used least recently
+	_, err = get(client, srv.URL+"/foo", "")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), atomic.LoadInt64(requests))
+	_, err = get(client, srv.URL+"/bar", "")
+	require.NoError(t, err)
+	require.Equal(t, int64(4), atomic.LoadInt64(requests))
+
+	blobs, err := ioutil.ReadDir(filepath.Join(c.opt.Root, "blobs", "sha256"))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(blobs))
+
+	err = c.Dir(context.TODO(), "dir", func(dir string) error {
+		return ioutil.WriteFile(filepath.Join(dir, "foo"), []byte("012345678901234567890123456789"), 0600)
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(c.entries))
+	_, err = os.Stat(filepath.Join(c.dirPath("dir"), "foo"))
+	require.NoError(t, err)
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+	c, clock, cleanup := newCache(t, 0)
+	defer cleanup()
+
+	var calls int64
+	fn := func(ctx context.Context) (string, error) {
+		atomic.AddInt64(&calls, 1)
+		return "value", nil
+	}
+
+	// resolved values are only cached if enabled
+	for i := 0; i < 2; i++ {
+		v, err := c.Resolve(context.TODO(), "key", fn)
+		require.NoError(t, err)
+		require.Equal(t, "value", v)
+	}
+	require.Equal(t, int64(2), calls)
+	calls = 0
+
+	c.opt.CacheResolved = true
+	for i := 0; i < 2; i++ {
+		v, err := c.Resolve(context.TODO(), "key", fn)
+		require.NoError(t, err)
+		require.Equal(t, "value", v)
+	}
+	require.Equal(t, int64(1), calls)
+
+	clock.Add(DefaultTTL + time.Second)
+	v, err := c.Resolve(context.TODO(), "key", fn)
+	require.NoError(t, err)
+	require.Equal(t, "value", v)
+	require.Equal(t, int64(2), calls)
+
+	// entries persist over restarts
+	require.NoError(t, c.Close())
+	c2, err := New(c.opt)
+	require.NoError(t, err)
+	defer c2.Close()
+	c2.now = c.now
+	v, err = c2.Resolve(context.TODO(), "key", fn)
+	require.NoError(t, err)
+	require.Equal(t, "value", v)
+	require.Equal(t, int64(2), calls)
+}
+
+type clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+func newCache(t *testing.T, maxSize int64) (*Cache, *clock, func()) {
+	tmpdir, err := ioutil.TempDir("", "downloadcache")
+	require.NoError(t, err)
+	c, err := New(Opt{Root: tmpdir, MaxSize: maxSize})
+	require.NoError(t, err)
+	clk := &clock{t: time.Now()}
+	c.now = clk.Now
+	return c, clk, func() {
+		c.Close()
+		os.RemoveAll(tmpdir)
+	}
+}
+
+// newServer returns a server that responds with "content of <path>" and
+// counts the requests
+func newServer() (*httptest.Server, *int64) {
+	var requests int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.URL.Path {
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/vary":
+			w.Header().Set("Vary", "Accept")
+			w.Write([]byte("content of " + r.URL.Path + " as " + r.Header.Get("Accept")))
+			return
+		case "/vary-all":
+			w.Header().Set("Vary", "*")
+		}
+		etag := `"etag-` + r.URL.Path + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("content of " + r.URL.Path))
+	}))
+	return srv, &requests
+}
+
+func get(client *http.Client, u, auth string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{resp.StatusCode}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return http.StatusText(e.code)
+}
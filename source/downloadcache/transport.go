@@ -0,0 +1,278 @@
+package downloadcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/moby/buildkit/util/bklog"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// storedHeaders are the response headers kept with the downloads
+var storedHeaders = []string{"Content-Disposition", "Content-Type", "ETag", "Last-Modified"}
+
+// Transport returns a RoundTripper that serves GET requests from the cache.
+// Downloads are revalidated with rt after the TTL of the cache. HEAD
+// requests are answered from downloads within the TTL. Requests with
+// credentials and other methods are passed to rt. Responses marked no-store
+// or private aren't stored and downloads are only served to requests with
+// the same values of the headers named by Vary.
+func (c *Cache) Transport(rt http.RoundTripper) http.RoundTripper {
+	return &transport{c: c, rt: rt}
+}
+
+type transport struct {
+	c  *Cache
+	rt http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cacheable(req) {
+		return t.rt.RoundTrip(req)
+	}
+	key := "http::" + req.URL.String()
+
+	if req.Method == http.MethodHead {
+		if e := t.c.fresh(key); e != nil && e.Digest != "" && e.matches(req) {
+			return response(req, e, nil), nil
+		}
+		return t.rt.RoundTrip(req)
+	}
+
+	defer t.c.use(key)()
+	e, resp, err := t.fetch(req.Context(), key, req)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		// not cacheable, e.g. an error status
+		return resp, nil
+	}
+	if etag := e.Header["ETag"]; etag != "" && matchETag(req.Header.Get("If-None-Match"), etag) {
+		return response(req, e, nil), nil
+	}
+	f, err := os.Open(t.c.blobPath(e.Digest))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return response(req, e, f), nil
+}
+
+// fetch downloads key unless it was fetched within the TTL. Stale downloads
+// are revalidated with their ETag and Last-Modified headers. If the response
+// can't be cached, e.g. for an error status, it is returned instead of an
+// entry so that the request isn't sent twice.
+func (t *transport) fetch(ctx context.Context, key string, req *http.Request) (*entry, *http.Response, error) {
+	t.c.locker.Lock(key)
+	defer t.c.locker.Unlock(key)
+
+	if e := t.c.fresh(key); e != nil && e.Digest != "" && e.matches(req) {
+		return e, nil, nil
+	}
+	stale := t.c.get(key)
+	if stale != nil && !stale.matches(req) {
+		stale = nil
+	}
+
+	ureq := req.Clone(ctx)
+	ureq.Header.Del("If-None-Match")
+	ureq.Header.Del("If-Modified-Since")
+	if stale != nil && stale.Digest != "" {
+		if etag := stale.Header["ETag"]; etag != "" {
+			ureq.Header.Set("If-None-Match", etag)
+		}
+		if lastMod := stale.Header["Last-Modified"]; lastMod != "" {
+			ureq.Header.Set("If-Modified-Since", lastMod)
+		}
+	}
+	resp, err := t.rt.RoundTrip(ureq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := t.c.now()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && stale != nil && stale.Digest != "":
+		resp.Body.Close()
+		e := *stale
+		e.FetchedAt = now
+		e.UsedAt = now
+		if err := t.c.set(key, &e); err != nil {
+			return nil, nil, err
+		}
+		return &e, nil, nil
+	case resp.StatusCode != http.StatusOK, !storable(resp):
+		return nil, resp, nil
+	}
+	defer resp.Body.Close()
+
+	f, err := ioutil.TempFile(filepath.Join(t.c.opt.Root, "ingest"), "")
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), resp.Body)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to download %s", req.URL)
+	}
+	if err := f.Close(); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	e := &entry{
+		Digest:    digest.NewDigest(digest.SHA256, h),
+		Header:    map[string]string{},
+		Size:      n,
+		FetchedAt: now,
+		UsedAt:    now,
+	}
+	for _, k := range storedHeaders {
+		if v := resp.Header.Get(k); v != "" {
+			e.Header[k] = v
+		}
+	}
+	for _, k := range varyHeaders(resp) {
+		if e.Vary == nil {
+			e.Vary = map[string]string{}
+		}
+		e.Vary[k] = req.Header.Get(k)
+	}
+	if err := t.c.commit(key, e, f.Name()); err != nil {
+		return nil, nil, err
+	}
+	if err := t.c.prune(); err != nil {
+		bklog.G(ctx).Warnf("failed to prune download cache: %v", err)
+	}
+	return e, nil, nil
+}
+
+// commit moves the downloaded file p to the blob of e unless it already
+// exists and adds e for key
+func (c *Cache) commit(key string, e *entry, p string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	bp := c.blobPath(e.Digest)
+	if _, err := os.Stat(bp); err != nil {
+		if err := os.MkdirAll(filepath.Dir(bp), 0700); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := os.Rename(p, bp); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return c.setLocked(key, e)
+}
+
+// cacheable returns true for GET and HEAD requests without credentials, so
+// that responses for one client are never served to another
+func cacheable(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if req.URL.User != nil || req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != "" || req.Header.Get("Range") != "" {
+		return false
+	}
+	return req.URL.Scheme == "http" || req.URL.Scheme == "https"
+}
+
+// storable returns false for responses that shared caches must not store:
+// responses marked no-store or private and responses varying on anything
+func storable(resp *http.Response) bool {
+	for _, v := range resp.Header["Cache-Control"] {
+		for _, d := range strings.Split(v, ",") {
+			d = strings.ToLower(strings.TrimSpace(d))
+			if i := strings.IndexAny(d, "= "); i >= 0 {
+				d = d[:i]
+			}
+			if d == "no-store" || d == "private" {
+				return false
+			}
+		}
+	}
+	for _, k := range varyHeaders(resp) {
+		if k == "*" {
+			return false
+		}
+	}
+	return true
+}
+
+// varyHeaders returns the canonical names of the request headers in the
+// Vary header of resp
+func varyHeaders(resp *http.Response) []string {
+	var names []string
+	for _, v := range resp.Header["Vary"] {
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				names = append(names, http.CanonicalHeaderKey(k))
+			}
+		}
+	}
+	return names
+}
+
+// matches returns true if req has the same values of the headers named by
+// Vary as the request the download e was fetched with
+func (e *entry) matches(req *http.Request) bool {
+	for k, v := range e.Vary {
+		if req.Header.Get(k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// response returns a response for the download e with body. Responses
+// without body are not modified responses for GET requests and headers
+// only for HEAD requests.
+func response(req *http.Request, e *entry, body io.ReadCloser) *http.Response {
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Request:    req,
+	}
+	for k, v := range e.Header {
+		resp.Header.Set(k, v)
+	}
+	switch {
+	case body != nil, req.Method == http.MethodHead:
+		resp.StatusCode = http.StatusOK
+		resp.Body = body
+		if body == nil {
+			resp.Body = http.NoBody
+		}
+		resp.ContentLength = e.Size
+		resp.Header.Set("Content-Length", strconv.FormatInt(e.Size, 10))
+	default:
+		resp.StatusCode = http.StatusNotModified
+		resp.Body = http.NoBody
+	}
+	resp.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	return resp
+}
+
+// matchETag returns true if the If-None-Match header h contains etag
+func matchETag(h, etag string) bool {
+	for _, v := range strings.Split(h, ",") {
+		v = strings.TrimSpace(v)
+		if v == etag || v == "*" || strings.TrimPrefix(v, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -16,6 +16,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/moby/buildkit/util/bklog"
 
@@ -29,6 +30,7 @@ import (
 	"github.com/moby/buildkit/snapshot"
 	"github.com/moby/buildkit/solver"
 	"github.com/moby/buildkit/source"
+	"github.com/moby/buildkit/source/downloadcache"
 	"github.com/moby/buildkit/util/progress/logs"
 	"github.com/moby/locker"
 	"github.com/pkg/errors"
@@ -40,14 +42,39 @@ import (
 var validHex = regexp.MustCompile(`^[a-f0-9]{40}$`)
 var defaultBranch = regexp.MustCompile(`refs/heads/(\S+)`)
 
+var (
+	caInfoMu sync.Mutex
+	caInfo   string
+)
+
+// SetCAInfo sets the CA bundle the git CLI verifies https remotes with
+// instead of the CAs of the system
+func SetCAInfo(p string) {
+	caInfoMu.Lock()
+	defer caInfoMu.Unlock()
+	caInfo = p
+}
+
+// getCAInfo returns the CA bundle set with SetCAInfo, empty for the system
+// CAs
+func getCAInfo() string {
+	caInfoMu.Lock()
+	defer caInfoMu.Unlock()
+	return caInfo
+}
+
 type Opt struct {
 	CacheAccessor cache.Accessor
 	MetadataStore *metadata.Store
+	// DownloadCache is shared by the workers of the daemon to resolve refs
+	// and fetch public remotes once, optional
+	DownloadCache *downloadcache.Cache
 }
 
 type gitSource struct {
 	md     *metadata.Store
 	cache  cache.Accessor
+	dc     *downloadcache.Cache
 	locker *locker.Locker
 }
 
@@ -63,6 +90,7 @@ func NewSource(opt Opt) (source.Source, error) {
 	gs := &gitSource{
 		md:     opt.MetadataStore,
 		cache:  opt.CacheAccessor,
+		dc:     opt.DownloadCache,
 		locker: locker.New(),
 	}
 	return gs, nil
@@ -97,7 +125,7 @@ func (gs *gitSource) mountRemote(ctx context.Context, remote string, auth []stri
 
 	initializeRepo := false
 	if remoteRef == nil {
-		remoteRef, err = gs.cache.New(ctx, nil, g, cache.CachePolicyRetain, cache.WithDescription(fmt.Sprintf("shared git repo for %s", redactCredentials(remote))))
+		remoteRef, err = gs.cache.New(ctx, nil, g, cache.CachePolicyRetain, cache.WithDescription(fmt.Sprintf("shared git repo for %s", redactCredentials(remote))), cache.WithOrigin(cache.OpTypeGit, redactCredentials(remote)))
 		if err != nil {
 			return "", nil, errors.Wrapf(err, "failed to create new mutable for %s", redactCredentials(remote))
 		}
@@ -164,8 +192,15 @@ type gitSourceHandler struct {
 	*gitSource
 	src      source.GitIdentifier
 	cacheKey string
-	sm       *session.Manager
-	auth     []string
+	// sha is the commit the ref was resolved to
+	sha  string
+	sm   *session.Manager
+	auth []string
+}
+
+// Pin returns the commit the ref was resolved to
+func (gs *gitSourceHandler) Pin() string {
+	return gs.sha
 }
 
 func (gs *gitSourceHandler) shaToCacheKey(sha string) string {
@@ -313,6 +348,7 @@ func (gs *gitSourceHandler) CacheKey(ctx context.Context, g session.Group, index
 	defer gs.locker.Unlock(remote)
 
 	if ref := gs.src.Ref; ref != "" && isCommitSHA(ref) {
+		gs.sha = ref
 		ref = gs.shaToCacheKey(ref)
 		gs.cacheKey = ref
 		return ref, nil, true, nil
@@ -346,9 +382,12 @@ func (gs *gitSourceHandler) CacheKey(ctx context.Context, g session.Group, index
 		defer unmountKnownHosts()
 	}
 
+	dc := gs.downloadCache()
 	ref := gs.src.Ref
 	if ref == "" {
-		ref, err = getDefaultBranch(ctx, gitDir, "", sock, knownHosts, gs.auth, gs.src.Remote)
+		ref, err = resolve(ctx, dc, "git-head::"+remote, func(ctx context.Context) (string, error) {
+			return getDefaultBranch(ctx, gitDir, "", sock, knownHosts, gs.auth, gs.src.Remote)
+		})
 		if err != nil {
 			return "", nil, false, err
 		}
@@ -356,20 +395,27 @@ func (gs *gitSourceHandler) CacheKey(ctx context.Context, g session.Group, index
 
 	// TODO: should we assume that remote tag is immutable? add a timer?
 
-	buf, err := gitWithinDir(ctx, gitDir, "", sock, knownHosts, gs.auth, "ls-remote", "origin", ref)
-	if err != nil {
-		return "", nil, false, errors.Wrapf(err, "failed to fetch remote %s", redactCredentials(remote))
-	}
-	out := buf.String()
-	idx := strings.Index(out, "\t")
-	if idx == -1 {
-		return "", nil, false, errors.Errorf("repository does not contain ref %s, output: %q", ref, string(out))
-	}
+	sha, err := resolve(ctx, dc, "git-ref::"+remote+"#"+ref, func(ctx context.Context) (string, error) {
+		buf, err := gitWithinDir(ctx, gitDir, "", sock, knownHosts, gs.auth, "ls-remote", "origin", ref)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to fetch remote %s", redactCredentials(remote))
+		}
+		out := buf.String()
+		idx := strings.Index(out, "\t")
+		if idx == -1 {
+			return "", errors.Errorf("repository does not contain ref %s, output: %q", ref, string(out))
+		}
 
-	sha := string(out[:idx])
-	if !isCommitSHA(sha) {
-		return "", nil, false, errors.Errorf("invalid commit sha %q", sha)
+		sha := string(out[:idx])
+		if !isCommitSHA(sha) {
+			return "", errors.Errorf("invalid commit sha %q", sha)
+		}
+		return sha, nil
+	})
+	if err != nil {
+		return "", nil, false, err
 	}
+	gs.sha = sha
 	sha = gs.shaToCacheKey(sha)
 	gs.cacheKey = sha
 	return sha, nil, true, nil
@@ -443,6 +489,14 @@ func (gs *gitSourceHandler) Snapshot(ctx context.Context, g session.Group) (out
 		}
 	}
 
+	if dc := gs.downloadCache(); doFetch && dc != nil {
+		if err := gs.fetchMirror(ctx, dc, gitDir, ref, cacheKey[:40]); err != nil {
+			bklog.G(ctx).Warnf("failed to fetch %s from the download cache: %v", redactCredentials(gs.src.Remote), err)
+		} else {
+			doFetch = false
+		}
+	}
+
 	if doFetch {
 		// make sure no old lock files have leaked
 		os.RemoveAll(filepath.Join(gitDir, "shallow.lock"))
@@ -467,7 +521,7 @@ func (gs *gitSourceHandler) Snapshot(ctx context.Context, g session.Group) (out
 		}
 	}
 
-	checkoutRef, err := gs.cache.New(ctx, nil, g, cache.WithRecordType(client.UsageRecordTypeGitCheckout), cache.WithDescription(fmt.Sprintf("git snapshot for %s#%s", gs.src.Remote, ref)))
+	checkoutRef, err := gs.cache.New(ctx, nil, g, cache.WithRecordType(client.UsageRecordTypeGitCheckout), cache.WithDescription(fmt.Sprintf("git snapshot for %s#%s", gs.src.Remote, ref)), cache.WithOrigin(cache.OpTypeGit, redactCredentials(gs.src.Remote)+"#"+ref))
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create new mutable for %s", redactCredentials(gs.src.Remote))
 	}
@@ -617,6 +671,80 @@ func (gs *gitSourceHandler) Snapshot(ctx context.Context, g session.Group) (out
 	return snap, nil
 }
 
+// downloadCache returns the download cache of the daemon for remotes that
+// are fetched without credentials, so that fetches with the credentials of
+// one client are never shared with another
+func (gs *gitSourceHandler) downloadCache() *downloadcache.Cache {
+	if gs.dc == nil || len(gs.auth) > 0 || gs.src.MountSSHSock != "" {
+		return nil
+	}
+	// scp-like ssh remotes fail to parse
+	u, err := url.Parse(gs.src.Remote)
+	if err != nil || u.User != nil || u.Scheme == "ssh" {
+		return nil
+	}
+	return gs.dc
+}
+
+// fetchMirror fetches the commit sha of ref into gitDir from the mirror of
+// the remote in the download cache. The mirror only fetches from the
+// remote if it doesn't have the commit yet.
+func (gs *gitSourceHandler) fetchMirror(ctx context.Context, dc *downloadcache.Cache, gitDir, ref, sha string) error {
+	return dc.Dir(ctx, "git-mirror::"+gs.src.Remote, func(mirror string) error {
+		if _, err := os.Stat(filepath.Join(mirror, "HEAD")); err != nil {
+			if _, err := gitWithinDir(ctx, mirror, "", "", "", nil, "init", "--bare"); err != nil {
+				return errors.Wrapf(err, "failed to init mirror at %s", mirror)
+			}
+			if _, err := gitWithinDir(ctx, mirror, "", "", "", nil, "remote", "add", "origin", gs.src.Remote); err != nil {
+				return errors.Wrapf(err, "failed add origin repo at %s", mirror)
+			}
+		}
+
+		if _, err := gitWithinDir(ctx, mirror, "", "", "", nil, "cat-file", "-e", sha+"^{commit}"); err != nil {
+			os.RemoveAll(filepath.Join(mirror, "shallow.lock"))
+			args := []string{"fetch"}
+			if !isCommitSHA(ref) {
+				args = append(args, "--depth=1", "--no-tags", "origin", ref)
+			} else {
+				if _, err := os.Lstat(filepath.Join(mirror, "shallow")); err == nil {
+					args = append(args, "--unshallow")
+				}
+				args = append(args, "origin")
+			}
+			if _, err := gitWithinDir(ctx, mirror, "", "", "", nil, args...); err != nil {
+				return errors.Wrapf(err, "failed to fetch remote %s", redactCredentials(gs.src.Remote))
+			}
+			if _, err := gitWithinDir(ctx, mirror, "", "", "", nil, "cat-file", "-e", sha+"^{commit}"); err != nil {
+				return errors.Errorf("remote %s doesn't contain commit %s for %s", redactCredentials(gs.src.Remote), sha, ref)
+			}
+		}
+
+		// the commit is fetched by a ref of the mirror as fetching
+		// unadvertised commits isn't allowed by default
+		mirrorRef := "refs/buildkit/" + sha
+		if _, err := gitWithinDir(ctx, mirror, "", "", "", nil, "update-ref", mirrorRef, sha); err != nil {
+			return err
+		}
+		target := mirrorRef
+		if !isCommitSHA(ref) {
+			target = "tags/" + ref
+		}
+		os.RemoveAll(filepath.Join(gitDir, "shallow.lock"))
+		if _, err := gitWithinDir(ctx, gitDir, "", "", "", nil, "fetch", "--depth=1", "--no-tags", "file://"+mirror, "--force", mirrorRef+":"+target); err != nil {
+			return errors.Wrapf(err, "failed to fetch mirror of %s", redactCredentials(gs.src.Remote))
+		}
+		return nil
+	})
+}
+
+// resolve calls fn through the download cache if dc is set
+func resolve(ctx context.Context, dc *downloadcache.Cache, key string, fn func(context.Context) (string, error)) (string, error) {
+	if dc == nil {
+		return fn(ctx)
+	}
+	return dc.Resolve(ctx, key, fn)
+}
+
 func isCommitSHA(str string) bool {
 	return validHex.MatchString(str)
 }
@@ -660,6 +788,9 @@ func git(ctx context.Context, dir, sshAuthSock, knownHosts string, args ...strin
 		if sshAuthSock != "" {
 			cmd.Env = append(cmd.Env, "SSH_AUTH_SOCK="+sshAuthSock)
 		}
+		if p := getCAInfo(); p != "" {
+			cmd.Env = append(cmd.Env, "GIT_SSL_CAINFO="+p)
+		}
 		// remote git commands spawn helper processes that inherit FDs and don't
 		// handle parent death signal so exec.CommandContext can't be used
 		err := runProcessGroup(ctx, cmd)
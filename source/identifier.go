@@ -92,6 +92,17 @@ func FromLLB(op *pb.Op_Source, platform *pb.Platform) (Identifier, error) {
 					return nil, err
 				}
 				id.RecordType = rt
+			case pb.AttrImageFallbackRefs:
+				for _, v := range strings.Split(v, ",") {
+					if v == "" {
+						continue
+					}
+					ref, err := reference.Parse(v)
+					if err != nil {
+						return nil, errors.Wrapf(err, "invalid fallback ref %s", v)
+					}
+					id.FallbackRefs = append(id.FallbackRefs, ref)
+				}
 			}
 		}
 	}
@@ -147,6 +158,8 @@ func FromLLB(op *pb.Op_Source, platform *pb.Platform) (Identifier, error) {
 				id.FollowPaths = paths
 			case pb.AttrSharedKeyHint:
 				id.SharedKeyHint = v
+			case pb.AttrLocalVerboseProgress:
+				id.VerboseProgress = v == "true"
 			case pb.AttrLocalDiffer:
 				switch v {
 				case pb.AttrLocalDifferMetadata, "":
@@ -197,6 +210,9 @@ type ImageIdentifier struct {
 	Platform    *ocispecs.Platform
 	ResolveMode ResolveMode
 	RecordType  client.UsageRecordType
+	// FallbackRefs are equivalent references, e.g. mirrors, tried in order
+	// if Reference can't be pulled
+	FallbackRefs []reference.Spec
 }
 
 func NewImageIdentifier(str string) (*ImageIdentifier, error) {
@@ -223,6 +239,8 @@ type LocalIdentifier struct {
 	FollowPaths     []string
 	SharedKeyHint   string
 	Differ          fsutil.DiffType
+	// VerboseProgress logs every transferred file
+	VerboseProgress bool
 }
 
 func NewLocalIdentifier(str string) (*LocalIdentifier, error) {
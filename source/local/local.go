@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/moby/buildkit/util/bklog"
@@ -19,6 +20,7 @@ import (
 	"github.com/moby/buildkit/solver"
 	"github.com/moby/buildkit/source"
 	"github.com/moby/buildkit/util/progress"
+	"github.com/moby/buildkit/util/progress/logs"
 	digest "github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 	"github.com/tonistiigi/fsutil"
@@ -127,7 +129,7 @@ func (ls *localSourceHandler) snapshot(ctx context.Context, s session.Group, cal
 	}
 
 	if mutable == nil {
-		m, err := ls.cm.New(ctx, nil, s, cache.CachePolicyRetain, cache.WithRecordType(client.UsageRecordTypeLocalSource), cache.WithDescription(fmt.Sprintf("local source for %s", ls.src.Name)))
+		m, err := ls.cm.New(ctx, nil, s, cache.CachePolicyRetain, cache.WithRecordType(client.UsageRecordTypeLocalSource), cache.WithDescription(fmt.Sprintf("local source for %s", ls.src.Name)), cache.WithOrigin(cache.OpTypeLocal, ls.src.Name))
 		if err != nil {
 			return nil, err
 		}
@@ -170,6 +172,12 @@ func (ls *localSourceHandler) snapshot(ctx context.Context, s session.Group, cal
 		return nil, err
 	}
 
+	cu := &cacheUpdater{CacheContext: cc, idmap: mount.IdentityMapping()}
+	if ls.src.VerboseProgress {
+		cu.files = logs.NewFileLogger(ctx, "transferring "+ls.src.Name+":")
+		defer cu.files.Close()
+	}
+
 	opt := filesync.FSSendRequestOpt{
 		Name:             ls.src.Name,
 		IncludePatterns:  ls.src.IncludePatterns,
@@ -177,7 +185,7 @@ func (ls *localSourceHandler) snapshot(ctx context.Context, s session.Group, cal
 		FollowPaths:      ls.src.FollowPaths,
 		OverrideExcludes: false,
 		DestDir:          dest,
-		CacheUpdater:     &cacheUpdater{cc, mount.IdentityMapping()},
+		CacheUpdater:     cu,
 		ProgressCb:       newProgressHandler(ctx, "transferring "+ls.src.Name+":"),
 		Differ:           ls.src.Differ,
 	}
@@ -274,6 +282,15 @@ func newProgressHandler(ctx context.Context, id string) func(int, bool) {
 type cacheUpdater struct {
 	contenthash.CacheContext
 	idmap *idtools.IdentityMapping
+	// files logs the received files if not nil
+	files *logs.FileLogger
+}
+
+func (cu *cacheUpdater) HandleChange(kind fsutil.ChangeKind, p string, fi os.FileInfo, err error) error {
+	if cu.files != nil && err == nil && kind != fsutil.ChangeKindDelete && fi.Mode().IsRegular() {
+		cu.files.Add(p, fi.Size())
+	}
+	return cu.CacheContext.HandleChange(kind, p, fi, err)
 }
 
 func (cu *cacheUpdater) MarkSupported(bool) {
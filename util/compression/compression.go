@@ -23,23 +23,84 @@ const (
 	// Gzip is used for blob data.
 	Gzip
 
+	// Zstd is used for blob data.
+	Zstd
+
+	// EStargz is used for estargz data.
+	EStargz
+
+	// ZstdChunked is used for zstd:chunked data, zstd with a TOC of the
+	// files for lazy pulling.
+	ZstdChunked
+
+	// Nydus is used for the RAFS blobs of nydus images. The blobs are
+	// created from gzip blobs and the image gets a bootstrap layer.
+	Nydus
+
 	// UnknownCompression means not supported yet.
 	UnknownCompression Type = -1
 )
 
 var Default = Gzip
 
+// MediaTypeImageLayerZstd is the media type of zstd compressed OCI layers.
+// Docker media types don't have a zstd variant.
+const MediaTypeImageLayerZstd = ocispecs.MediaTypeImageLayer + "+zstd"
+
+// MediaTypeNydusBlob is the media type of the RAFS blob layers of nydus
+// images
+const MediaTypeNydusBlob = "application/vnd.oci.image.layer.nydus.blob.v1"
+
+// Parse returns the compression type with the given name
+func Parse(t string) (Type, error) {
+	switch t {
+	case "uncompressed":
+		return Uncompressed, nil
+	case "gzip":
+		return Gzip, nil
+	case "zstd":
+		return Zstd, nil
+	case "estargz":
+		return EStargz, nil
+	case "zstd:chunked":
+		return ZstdChunked, nil
+	case "nydus":
+		return Nydus, nil
+	default:
+		return UnknownCompression, errors.Errorf("unsupported layer compression type: %v", t)
+	}
+}
+
 func (ct Type) String() string {
 	switch ct {
 	case Uncompressed:
 		return "uncompressed"
 	case Gzip:
 		return "gzip"
+	case Zstd:
+		return "zstd"
+	case EStargz:
+		return "estargz"
+	case ZstdChunked:
+		return "zstd:chunked"
+	case Nydus:
+		return "nydus"
 	default:
 		return "unknown"
 	}
 }
 
+// OnlySupportOCITypes returns true if layers of the compression type can
+// only be described with OCI media types.
+func (ct Type) OnlySupportOCITypes() bool {
+	switch ct {
+	case Zstd, EStargz, ZstdChunked, Nydus:
+		return true
+	default:
+		return false
+	}
+}
+
 // DetectLayerMediaType returns media type from existing blob data.
 func DetectLayerMediaType(ctx context.Context, cs content.Store, id digest.Digest, oci bool) (string, error) {
 	ra, err := cs.ReaderAt(ctx, ocispecs.Descriptor{Digest: id})
@@ -64,6 +125,8 @@ func DetectLayerMediaType(ctx context.Context, cs content.Store, id digest.Diges
 			return ocispecs.MediaTypeImageLayerGzip, nil
 		}
 		return images.MediaTypeDockerSchema2LayerGzip, nil
+	case Zstd:
+		return MediaTypeImageLayerZstd, nil
 	default:
 		return "", errors.Errorf("failed to detect layer %v compression type", id)
 	}
@@ -87,6 +150,7 @@ func detectCompressionType(cr io.Reader) (Type, error) {
 
 	for c, m := range map[Type][]byte{
 		Gzip: {0x1F, 0x8B, 0x08},
+		Zstd: {0x28, 0xB5, 0x2F, 0xFD},
 	} {
 		if n < len(m) {
 			continue
@@ -99,21 +163,28 @@ func detectCompressionType(cr io.Reader) (Type, error) {
 }
 
 var toDockerLayerType = map[string]string{
-	ocispecs.MediaTypeImageLayer:                  images.MediaTypeDockerSchema2Layer,
-	images.MediaTypeDockerSchema2Layer:            images.MediaTypeDockerSchema2Layer,
-	ocispecs.MediaTypeImageLayerGzip:              images.MediaTypeDockerSchema2LayerGzip,
-	images.MediaTypeDockerSchema2LayerGzip:        images.MediaTypeDockerSchema2LayerGzip,
-	images.MediaTypeDockerSchema2LayerForeign:     images.MediaTypeDockerSchema2Layer,
-	images.MediaTypeDockerSchema2LayerForeignGzip: images.MediaTypeDockerSchema2LayerGzip,
+	ocispecs.MediaTypeImageLayer:                     images.MediaTypeDockerSchema2Layer,
+	images.MediaTypeDockerSchema2Layer:               images.MediaTypeDockerSchema2Layer,
+	ocispecs.MediaTypeImageLayerGzip:                 images.MediaTypeDockerSchema2LayerGzip,
+	images.MediaTypeDockerSchema2LayerGzip:           images.MediaTypeDockerSchema2LayerGzip,
+	images.MediaTypeDockerSchema2LayerForeign:        images.MediaTypeDockerSchema2LayerForeign,
+	images.MediaTypeDockerSchema2LayerForeignGzip:    images.MediaTypeDockerSchema2LayerForeignGzip,
+	ocispecs.MediaTypeImageLayerNonDistributable:     images.MediaTypeDockerSchema2LayerForeign,
+	ocispecs.MediaTypeImageLayerNonDistributableGzip: images.MediaTypeDockerSchema2LayerForeignGzip,
+	MediaTypeImageLayerZstd:                          MediaTypeImageLayerZstd,
 }
 
 var toOCILayerType = map[string]string{
-	ocispecs.MediaTypeImageLayer:                  ocispecs.MediaTypeImageLayer,
-	images.MediaTypeDockerSchema2Layer:            ocispecs.MediaTypeImageLayer,
-	ocispecs.MediaTypeImageLayerGzip:              ocispecs.MediaTypeImageLayerGzip,
-	images.MediaTypeDockerSchema2LayerGzip:        ocispecs.MediaTypeImageLayerGzip,
-	images.MediaTypeDockerSchema2LayerForeign:     ocispecs.MediaTypeImageLayer,
-	images.MediaTypeDockerSchema2LayerForeignGzip: ocispecs.MediaTypeImageLayerGzip,
+	ocispecs.MediaTypeImageLayer:                     ocispecs.MediaTypeImageLayer,
+	images.MediaTypeDockerSchema2Layer:               ocispecs.MediaTypeImageLayer,
+	ocispecs.MediaTypeImageLayerGzip:                 ocispecs.MediaTypeImageLayerGzip,
+	images.MediaTypeDockerSchema2LayerGzip:           ocispecs.MediaTypeImageLayerGzip,
+	images.MediaTypeDockerSchema2LayerForeign:        ocispecs.MediaTypeImageLayerNonDistributable,
+	images.MediaTypeDockerSchema2LayerForeignGzip:    ocispecs.MediaTypeImageLayerNonDistributableGzip,
+	ocispecs.MediaTypeImageLayerNonDistributable:     ocispecs.MediaTypeImageLayerNonDistributable,
+	ocispecs.MediaTypeImageLayerNonDistributableGzip: ocispecs.MediaTypeImageLayerNonDistributableGzip,
+	MediaTypeImageLayerZstd:                          MediaTypeImageLayerZstd,
+	MediaTypeNydusBlob:                               MediaTypeNydusBlob,
 }
 
 func convertLayerMediaType(mediaType string, oci bool) string {
@@ -0,0 +1,76 @@
+package compression
+
+import (
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// Config is the compression of the layer blobs of an export
+type Config struct {
+	Type Type
+	// Force converts existing blobs of other compressions to Type
+	Force bool
+	// Level is the compression level of the blobs created for the export.
+	// nil uses the default level of Type. Levels out of the range of Type
+	// are clamped.
+	Level *int
+}
+
+// New returns the configuration of compression type t with the default level
+func New(t Type) Config {
+	return Config{Type: t}
+}
+
+// GzipLevel returns the level of gzip and eStargz compressed blobs
+func (c Config) GzipLevel() int {
+	if c.Level == nil {
+		return gzip.DefaultCompression
+	}
+	return clamp(*c.Level, gzip.HuffmanOnly, gzip.BestCompression)
+}
+
+// ZstdLevel returns the encoder level of zstd and zstd:chunked compressed
+// blobs
+func (c Config) ZstdLevel() zstd.EncoderLevel {
+	if c.Level == nil {
+		return zstd.SpeedDefault
+	}
+	return zstd.EncoderLevelFromZstd(clamp(*c.Level, 1, 22))
+}
+
+// NewWriter returns a writer compressing the data written to w with the
+// type and level of the configuration. eStargz blobs are written as gzip and
+// zstd:chunked blobs as zstd.
+func (c Config) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c.Type {
+	case Uncompressed:
+		return nopWriteCloser{w}, nil
+	case Gzip, EStargz:
+		return gzip.NewWriterLevel(w, c.GzipLevel())
+	case Zstd, ZstdChunked:
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(c.ZstdLevel()))
+	default:
+		return nil, errors.Errorf("unsupported layer compression type: %v", c.Type)
+	}
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
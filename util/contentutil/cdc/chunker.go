@@ -0,0 +1,64 @@
+package cdc
+
+import (
+	"bufio"
+	"io"
+	"math/rand"
+)
+
+const (
+	// MinChunkSize is the minimum size of a chunk, except the last chunk
+	// of a stream
+	MinChunkSize = 16 << 10
+	// MaxChunkSize is the maximum size of a chunk
+	MaxChunkSize = 256 << 10
+
+	// avgChunkBits sets the average size of the chunks to 64KiB over
+	// MinChunkSize
+	avgChunkBits = 16
+)
+
+// gear is the table of the gear rolling hash. It has to be the same across
+// versions, so that blobs written earlier are chunked at the same positions.
+var gear [256]uint64
+
+func init() {
+	r := rand.New(rand.NewSource(0x6275696c646b6974))
+	for i := range gear {
+		gear[i] = r.Uint64()
+	}
+}
+
+// Split splits the stream r into content-defined chunks and calls fn with
+// each of them. A chunk ends where the gear hash of the last 64 bytes has
+// avgChunkBits leading zero bits, so that inserting data into a stream only
+// changes the chunks around it. The chunk passed to fn is only valid until
+// fn returns.
+func Split(r io.Reader, fn func([]byte) error) error {
+	br := bufio.NewReaderSize(r, MaxChunkSize)
+	buf := make([]byte, 0, MaxChunkSize)
+	for {
+		buf = buf[:0]
+		var h uint64
+		for len(buf) < MaxChunkSize {
+			b, err := br.ReadByte()
+			if err != nil {
+				if err != io.EOF {
+					return err
+				}
+				if len(buf) > 0 {
+					return fn(buf)
+				}
+				return nil
+			}
+			buf = append(buf, b)
+			h = h<<1 + gear[b]
+			if len(buf) >= MinChunkSize && h>>(64-avgChunkBits) == 0 {
+				break
+			}
+		}
+		if err := fn(buf); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,784 @@
+// Package cdc implements a content store that splits blobs into
+// content-defined chunks, so that identical ranges of blobs are stored once.
+// Gzip compressed layers are split uncompressed, as a change in a layer
+// changes its compressed stream from there to the end. They are compressed
+// again on read, which is verified to reproduce the blob after a change of
+// the Go version.
+package cdc
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/filters"
+	"github.com/klauspost/compress/zstd"
+	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/locker"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketBlobs  = []byte("blobs")
+	bucketChunks = []byte("chunks")
+
+	// gzipLevels are the levels gzip compressed blobs are reproduced with.
+	// The default level is the one of the layers created by buildkit and
+	// docker.
+	gzipLevels = []int{gzip.DefaultCompression, gzip.BestSpeed}
+
+	// the chunk files are compressed, as the chunks of gzip compressed
+	// blobs are uncompressed
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// Store is a content store that splits committed blobs into content-defined
+// chunks. Chunks are stored once and reference counted by the blobs that
+// contain them, blobs are reconstructed from their chunks on read. Gzip
+// compressed blobs that compress/gzip reproduces are split uncompressed and
+// compressed again on read, other blobs are split as they are. Chunks that
+// no blob references are removed when the store is opened.
+// Ingests and blobs that haven't been chunked yet, e.g. blobs written before
+// the store was enabled, are kept in a local content store in the same root.
+type Store struct {
+	content.Store
+	root string
+	db   *bolt.DB
+	// blobs serializes chunking and verifying a blob
+	blobs *locker.Locker
+	// mu protects pending and the removal of chunk files, so that a chunk
+	// that is added again isn't removed by the deletion of its last blob
+	mu sync.Mutex
+	// pending counts the chunks of blobs that are being chunked and aren't
+	// referenced by the database yet
+	pending map[digest.Digest]int
+}
+
+type blobRecord struct {
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Chunks    []chunk   `json:"chunks"`
+	// Gzip is set for blobs whose chunks are uncompressed, the blob is
+	// the chunks compressed with compress/gzip at GzipLevel
+	Gzip      bool `json:"gzip,omitempty"`
+	GzipLevel int  `json:"gzipLevel,omitempty"`
+	// GoVersion is the version of Go that reproduced the gzip compressed
+	// blob last. The output of compress/gzip may change between versions.
+	GoVersion string `json:"goVersion,omitempty"`
+}
+
+type chunk struct {
+	Digest digest.Digest `json:"digest"`
+	Size   int64         `json:"size"`
+}
+
+// NewStore returns a chunking content store in root
+func NewStore(root string) (*Store, error) {
+	ls, err := local.NewStore(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(root, "chunks"), 0700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	db, err := bolt.Open(filepath.Join(root, "chunks.db"), 0600, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{bucketBlobs, bucketChunks} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, errors.WithStack(err)
+	}
+	s := &Store{
+		Store:   ls,
+		root:    root,
+		db:      db,
+		blobs:   locker.New(),
+		pending: map[digest.Digest]int{},
+	}
+	if err := s.pruneChunks(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// pruneChunks removes the chunk files that no blob references, e.g. after
+// the daemon exited while a blob was chunked
+func (s *Store) pruneChunks() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.View(func(tx *bolt.Tx) error {
+		cb := tx.Bucket(bucketChunks)
+		return filepath.Walk(filepath.Join(s.root, "chunks"), func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				return nil
+			}
+			if !strings.HasPrefix(fi.Name(), ".tmp-") {
+				dgst := digest.NewDigestFromEncoded(digest.Algorithm(filepath.Base(filepath.Dir(p))), fi.Name())
+				if cb.Get([]byte(dgst)) != nil || s.pending[dgst] > 0 {
+					return nil
+				}
+			}
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return errors.WithStack(err)
+			}
+			return nil
+		})
+	})
+}
+
+// Close closes the chunk database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) Info(ctx context.Context, dgst digest.Digest) (content.Info, error) {
+	rec, err := s.getBlob(dgst)
+	if err != nil {
+		return content.Info{}, err
+	}
+	if rec == nil {
+		return s.Store.Info(ctx, dgst)
+	}
+	return rec.info(dgst), nil
+}
+
+func (s *Store) Update(ctx context.Context, info content.Info, fieldpaths ...string) (content.Info, error) {
+	rec, err := s.getBlob(info.Digest)
+	if err != nil {
+		return content.Info{}, err
+	}
+	if rec == nil {
+		return s.Store.Update(ctx, info, fieldpaths...)
+	}
+	// like the local store, labels are kept by the metadata store
+	return content.Info{}, errors.Wrapf(errdefs.ErrFailedPrecondition, "update not supported on immutable content store")
+}
+
+func (s *Store) Walk(ctx context.Context, fn content.WalkFunc, fs ...string) error {
+	filter, err := filters.ParseAll(fs...)
+	if err != nil {
+		return err
+	}
+	var infos []content.Info
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketBlobs).ForEach(func(k, v []byte) error {
+			var rec blobRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			info := rec.info(digest.Digest(k))
+			if filter.Match(content.AdaptInfo(info)) {
+				infos = append(infos, info)
+			}
+			return nil
+		})
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, info := range infos {
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return s.Store.Walk(ctx, fn, fs...)
+}
+
+func (s *Store) Delete(ctx context.Context, dgst digest.Digest) error {
+	var found bool
+	var unused []digest.Digest
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketBlobs)
+		v := b.Get([]byte(dgst))
+		if v == nil {
+			return nil
+		}
+		found = true
+		var rec blobRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			return err
+		}
+		if err := b.Delete([]byte(dgst)); err != nil {
+			return err
+		}
+		cb := tx.Bucket(bucketChunks)
+		for _, c := range rec.Chunks {
+			n, _ := binary.Uvarint(cb.Get([]byte(c.Digest)))
+			if n <= 1 {
+				if err := cb.Delete([]byte(c.Digest)); err != nil {
+					return err
+				}
+				unused = append(unused, c.Digest)
+				continue
+			}
+			if err := cb.Put([]byte(c.Digest), encodeCount(n-1)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	if !found {
+		return s.Store.Delete(ctx, dgst)
+	}
+	s.removeUnused(ctx, unused)
+	return nil
+}
+
+// removeUnused removes the files of the chunks that no blob references and
+// that aren't being added by a blob that is chunked
+func (s *Store) removeUnused(ctx context.Context, dgsts []digest.Digest) {
+	if len(dgsts) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		cb := tx.Bucket(bucketChunks)
+		for _, dgst := range dgsts {
+			if cb.Get([]byte(dgst)) != nil || s.pending[dgst] > 0 {
+				continue
+			}
+			if err := os.Remove(s.chunkPath(dgst)); err != nil && !os.IsNotExist(err) {
+				bklog.G(ctx).Warnf("failed to remove chunk %s: %v", dgst, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		bklog.G(ctx).Warnf("failed to remove chunks: %v", err)
+	}
+}
+
+// acquire marks the chunk as pending so that it isn't removed before the
+// blob that is chunked references it
+func (s *Store) acquire(dgst digest.Digest) {
+	s.mu.Lock()
+	s.pending[dgst]++
+	s.mu.Unlock()
+}
+
+func (s *Store) release(dgsts []digest.Digest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, dgst := range dgsts {
+		if s.pending[dgst] <= 1 {
+			delete(s.pending, dgst)
+		} else {
+			s.pending[dgst]--
+		}
+	}
+}
+
+func (s *Store) ReaderAt(ctx context.Context, desc ocispecs.Descriptor) (content.ReaderAt, error) {
+	rec, err := s.getBlob(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return s.Store.ReaderAt(ctx, desc)
+	}
+	ra := &chunkReaderAt{s: s, chunks: rec.Chunks, cur: -1}
+	for _, c := range rec.Chunks {
+		ra.offsets = append(ra.offsets, ra.size)
+		ra.size += c.Size
+	}
+	if rec.Gzip {
+		if rec.GoVersion != runtime.Version() {
+			if err := s.verifyGzip(ctx, desc.Digest); err != nil {
+				return nil, err
+			}
+		}
+		return &gzipReaderAt{ra: ra, level: rec.GzipLevel, size: rec.Size}, nil
+	}
+	return ra, nil
+}
+
+// verifyGzip checks that compress/gzip of this Go version still reproduces
+// the gzip compressed blob dgst. Blobs that aren't reproduced are removed and
+// not found is returned, so that they are fetched again from their source.
+func (s *Store) verifyGzip(ctx context.Context, dgst digest.Digest) error {
+	s.blobs.Lock(dgst.String())
+	defer s.blobs.Unlock(dgst.String())
+
+	rec, err := s.getBlob(dgst)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return errors.Wrapf(errdefs.ErrNotFound, "content %v", dgst)
+	}
+	if rec.GoVersion == runtime.Version() {
+		return nil
+	}
+
+	ra := &chunkReaderAt{s: s, chunks: rec.Chunks, cur: -1}
+	for _, c := range rec.Chunks {
+		ra.offsets = append(ra.offsets, ra.size)
+		ra.size += c.Size
+	}
+	defer ra.Close()
+	digester := dgst.Algorithm().Digester()
+	gw, err := gzip.NewWriterLevel(digester.Hash(), rec.GzipLevel)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := io.Copy(gw, io.NewSectionReader(ra, 0, ra.size)); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	if digester.Digest() != dgst {
+		bklog.G(ctx).Warnf("compress/gzip of %s doesn't reproduce blob %s, removing it", runtime.Version(), dgst)
+		if err := s.Delete(ctx, dgst); err != nil {
+			return err
+		}
+		return errors.Wrapf(errdefs.ErrNotFound, "content %v", dgst)
+	}
+
+	rec.GoVersion = runtime.Version()
+	dt, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketBlobs)
+		if b.Get([]byte(dgst)) == nil {
+			return nil
+		}
+		return b.Put([]byte(dgst), dt)
+	}))
+}
+
+func (s *Store) Writer(ctx context.Context, opts ...content.WriterOpt) (content.Writer, error) {
+	var wOpts content.WriterOpts
+	for _, opt := range opts {
+		if err := opt(&wOpts); err != nil {
+			return nil, err
+		}
+	}
+	if wOpts.Desc.Digest != "" {
+		rec, err := s.getBlob(wOpts.Desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if rec != nil {
+			return nil, errors.Wrapf(errdefs.ErrAlreadyExists, "content %v", wOpts.Desc.Digest)
+		}
+	}
+	w, err := s.Store.Writer(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{Writer: w, s: s}, nil
+}
+
+func (s *Store) getBlob(dgst digest.Digest) (*blobRecord, error) {
+	var rec *blobRecord
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketBlobs).Get([]byte(dgst))
+		if v == nil {
+			return nil
+		}
+		rec = &blobRecord{}
+		return json.Unmarshal(v, rec)
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return rec, nil
+}
+
+// chunkBlob moves the committed blob dgst from the local store into chunks
+func (s *Store) chunkBlob(ctx context.Context, dgst digest.Digest) (err error) {
+	s.blobs.Lock(dgst.String())
+	defer s.blobs.Unlock(dgst.String())
+
+	rec, err := s.getBlob(dgst)
+	if err != nil {
+		return err
+	}
+	if rec != nil {
+		// the blob was committed again while it was already chunked
+		return s.Store.Delete(ctx, dgst)
+	}
+
+	info, err := s.Store.Info(ctx, dgst)
+	if err != nil {
+		return err
+	}
+	ra, err := s.Store.ReaderAt(ctx, ocispecs.Descriptor{Digest: dgst})
+	if err != nil {
+		return err
+	}
+	defer ra.Close()
+
+	var acquired []digest.Digest
+	defer func() {
+		s.release(acquired)
+		if err != nil {
+			s.removeUnused(ctx, acquired)
+		}
+	}()
+	rec = &blobRecord{Size: info.Size, CreatedAt: info.CreatedAt, UpdatedAt: info.UpdatedAt}
+	rec.Chunks, rec.GzipLevel, rec.Gzip, err = s.splitGzip(ctx, ra, dgst, &acquired)
+	if err != nil {
+		return errors.Wrapf(err, "failed to chunk %s", dgst)
+	}
+	if rec.Gzip {
+		rec.GoVersion = runtime.Version()
+	} else {
+		rec.Chunks, err = s.split(io.NewSectionReader(ra, 0, ra.Size()), &acquired)
+		if err != nil {
+			return errors.Wrapf(err, "failed to chunk %s", dgst)
+		}
+	}
+
+	dt, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketBlobs).Put([]byte(dgst), dt); err != nil {
+			return err
+		}
+		cb := tx.Bucket(bucketChunks)
+		for _, c := range rec.Chunks {
+			n, _ := binary.Uvarint(cb.Get([]byte(c.Digest)))
+			if err := cb.Put([]byte(c.Digest), encodeCount(n+1)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return s.Store.Delete(ctx, dgst)
+}
+
+// splitGzip splits the uncompressed stream of the gzip compressed blob dgst
+// into chunks. The blob is compressed again with each of gzipLevels and
+// false is returned if none of them reproduces it, e.g. for blobs that
+// weren't compressed by compress/gzip. The chunks are added to acquired.
+func (s *Store) splitGzip(ctx context.Context, ra content.ReaderAt, dgst digest.Digest, acquired *[]digest.Digest) ([]chunk, int, bool, error) {
+	zr, err := gzip.NewReader(io.NewSectionReader(ra, 0, ra.Size()))
+	if err != nil {
+		return nil, 0, false, nil
+	}
+	zr.Multistream(false)
+
+	digesters := make([]digest.Digester, len(gzipLevels))
+	gws := make([]*gzip.Writer, len(gzipLevels))
+	ws := make([]io.Writer, len(gzipLevels))
+	for i, l := range gzipLevels {
+		digesters[i] = dgst.Algorithm().Digester()
+		gw, err := gzip.NewWriterLevel(digesters[i].Hash(), l)
+		if err != nil {
+			return nil, 0, false, errors.WithStack(err)
+		}
+		gws[i], ws[i] = gw, gw
+	}
+
+	n := len(*acquired)
+	unused := func() {
+		dgsts := append([]digest.Digest{}, (*acquired)[n:]...)
+		*acquired = (*acquired)[:n]
+		s.release(dgsts)
+		s.removeUnused(ctx, dgsts)
+	}
+	er := &errReader{r: zr}
+	chunks, err := s.split(io.TeeReader(er, io.MultiWriter(ws...)), acquired)
+	if err != nil {
+		unused()
+		if er.err != nil {
+			// the blob isn't a valid gzip stream
+			return nil, 0, false, nil
+		}
+		return nil, 0, false, err
+	}
+	for i, gw := range gws {
+		if err := gw.Close(); err != nil {
+			return nil, 0, false, errors.WithStack(err)
+		}
+		if digesters[i].Digest() == dgst {
+			return chunks, gzipLevels[i], true, nil
+		}
+	}
+	unused()
+	return nil, 0, false, nil
+}
+
+// split splits r into chunks and writes the chunks that don't exist. The
+// chunks are marked pending and added to acquired.
+func (s *Store) split(r io.Reader, acquired *[]digest.Digest) ([]chunk, error) {
+	var chunks []chunk
+	err := Split(r, func(dt []byte) error {
+		c := chunk{Digest: digest.FromBytes(dt), Size: int64(len(dt))}
+		s.acquire(c.Digest)
+		*acquired = append(*acquired, c.Digest)
+		if err := s.writeChunk(c.Digest, dt); err != nil {
+			return err
+		}
+		chunks = append(chunks, c)
+		return nil
+	})
+	return chunks, err
+}
+
+// writeChunk writes the chunk dgst compressed if it doesn't exist
+func (s *Store) writeChunk(dgst digest.Digest, dt []byte) error {
+	p := s.chunkPath(dgst)
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := f.Write(zstdEncoder.EncodeAll(dt, nil)); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+	if err := os.Rename(f.Name(), p); err != nil {
+		os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *Store) chunkPath(dgst digest.Digest) string {
+	return filepath.Join(s.root, "chunks", dgst.Algorithm().String(), dgst.Hex())
+}
+
+func (rec *blobRecord) info(dgst digest.Digest) content.Info {
+	return content.Info{
+		Digest:    dgst,
+		Size:      rec.Size,
+		CreatedAt: rec.CreatedAt,
+		UpdatedAt: rec.UpdatedAt,
+	}
+}
+
+func encodeCount(n uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, n)]
+}
+
+// writer moves the blob into chunks after it is committed
+type writer struct {
+	content.Writer
+	s *Store
+}
+
+func (w *writer) Commit(ctx context.Context, size int64, expected digest.Digest, opts ...content.Opt) error {
+	if err := w.Writer.Commit(ctx, size, expected, opts...); err != nil {
+		return err
+	}
+	dgst := expected
+	if dgst == "" {
+		dgst = w.Writer.Digest()
+	}
+	if err := w.s.chunkBlob(ctx, dgst); err != nil {
+		// the blob stays readable from the local store
+		bklog.G(ctx).Warnf("failed to chunk blob %s: %v", dgst, err)
+	}
+	return nil
+}
+
+// chunkReaderAt reads a blob from its chunks. The chunk that was read last
+// is kept, as reads are mostly sequential.
+type chunkReaderAt struct {
+	s       *Store
+	chunks  []chunk
+	offsets []int64
+	size    int64
+
+	mu  sync.Mutex
+	cur int
+	dt  []byte
+}
+
+func (ra *chunkReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	if off >= ra.size {
+		return 0, io.EOF
+	}
+	var n int
+	for n < len(p) && off < ra.size {
+		i := sort.Search(len(ra.offsets), func(i int) bool { return ra.offsets[i] > off }) - 1
+		dt, err := ra.chunk(i)
+		if err != nil {
+			return n, err
+		}
+		cn := copy(p[n:], dt[off-ra.offsets[i]:])
+		n += cn
+		off += int64(cn)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (ra *chunkReaderAt) chunk(i int) ([]byte, error) {
+	if ra.cur == i {
+		return ra.dt, nil
+	}
+	c := ra.chunks[i]
+	f, err := ioutil.ReadFile(ra.s.chunkPath(c.Digest))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Wrapf(errdefs.ErrNotFound, "chunk %s", c.Digest)
+		}
+		return nil, errors.WithStack(err)
+	}
+	dt, err := zstdDecoder.DecodeAll(f, make([]byte, 0, c.Size))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decompress chunk %s", c.Digest)
+	}
+	if int64(len(dt)) != c.Size {
+		return nil, errors.Errorf("chunk %s is truncated", c.Digest)
+	}
+	ra.dt, ra.cur = dt, i
+	return dt, nil
+}
+
+func (ra *chunkReaderAt) Size() int64 {
+	return ra.size
+}
+
+func (ra *chunkReaderAt) Close() error {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	ra.dt, ra.cur = nil, -1
+	return nil
+}
+
+// gzipReaderAt reads a gzip compressed blob by compressing its uncompressed
+// chunks again. Reads are mostly sequential, the stream is only compressed
+// from the start again for reads before the current offset.
+type gzipReaderAt struct {
+	ra    *chunkReaderAt
+	level int
+	size  int64
+
+	mu  sync.Mutex
+	pr  *io.PipeReader
+	off int64
+}
+
+func (r *gzipReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if r.pr != nil && off < r.off {
+		r.reset()
+	}
+	if r.pr == nil {
+		pr, pw := io.Pipe()
+		go func() {
+			gw, err := gzip.NewWriterLevel(pw, r.level)
+			if err == nil {
+				_, err = io.Copy(gw, io.NewSectionReader(r.ra, 0, r.ra.Size()))
+				if err == nil {
+					err = gw.Close()
+				}
+			}
+			pw.CloseWithError(err)
+		}()
+		r.pr, r.off = pr, 0
+	}
+	if off > r.off {
+		n, err := io.CopyN(ioutil.Discard, r.pr, off-r.off)
+		r.off += n
+		if err != nil {
+			r.reset()
+			return 0, errors.Wrap(err, "failed to compress blob")
+		}
+	}
+	n, err := io.ReadFull(r.pr, p)
+	r.off += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if r.off < r.size {
+			err = errors.Errorf("compressed blob ended at %d of %d bytes", r.off, r.size)
+		} else {
+			err = io.EOF
+		}
+	}
+	if err != nil {
+		r.reset()
+	}
+	return n, err
+}
+
+func (r *gzipReaderAt) reset() {
+	r.pr.Close()
+	r.pr = nil
+}
+
+func (r *gzipReaderAt) Size() int64 {
+	return r.size
+}
+
+func (r *gzipReaderAt) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pr != nil {
+		r.reset()
+	}
+	return nil
+}
+
+// errReader records the error of reads from r
+type errReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,397 @@
+package cdc
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestSplit(t *testing.T) {
+	t.Parallel()
+
+	dt := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(dt)
+
+	split := func(dt []byte) []digest.Digest {
+		var chunks []digest.Digest
+		err := Split(bytes.NewReader(dt), func(c []byte) error {
+			require.LessOrEqual(t, len(c), MaxChunkSize)
+			chunks = append(chunks, digest.FromBytes(c))
+			return nil
+		})
+		require.NoError(t, err)
+		return chunks
+	}
+
+	chunks := split(dt)
+	require.Greater(t, len(chunks), 4)
+
+	// inserting data only changes the chunks around it
+	changed := append(append(append([]byte{}, dt[:2<<20]...), []byte("inserted")...), dt[2<<20:]...)
+	changedChunks := split(changed)
+	m := map[digest.Digest]struct{}{}
+	for _, c := range chunks {
+		m[c] = struct{}{}
+	}
+	var shared int
+	for _, c := range changedChunks {
+		if _, ok := m[c]; ok {
+			shared++
+		}
+	}
+	require.GreaterOrEqual(t, shared, len(chunks)-2)
+
+	require.Len(t, split(nil), 0)
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	root := t.TempDir()
+	s, err := NewStore(root)
+	require.NoError(t, err)
+	defer s.Close()
+
+	rnd := rand.New(rand.NewSource(1))
+	base := make([]byte, 1<<20)
+	rnd.Read(base)
+	other := append(append([]byte{}, base...), []byte("suffix")...)
+
+	write := func(dt []byte) ocispecs.Descriptor {
+		desc := ocispecs.Descriptor{Digest: digest.FromBytes(dt), Size: int64(len(dt))}
+		err := content.WriteBlob(ctx, s, desc.Digest.String(), bytes.NewReader(dt), desc)
+		require.NoError(t, err)
+		return desc
+	}
+	desc1 := write(base)
+	desc2 := write(other)
+
+	// the blobs are only stored as chunks
+	_, err = os.Stat(filepath.Join(root, "blobs", "sha256", desc1.Digest.Hex()))
+	require.True(t, os.IsNotExist(err))
+	size := chunksSize(t, root)
+	require.Less(t, size, int64(len(base)+len(other)))
+	require.GreaterOrEqual(t, size, int64(len(other)))
+
+	for _, tc := range []struct {
+		desc ocispecs.Descriptor
+		dt   []byte
+	}{{desc1, base}, {desc2, other}} {
+		info, err := s.Info(ctx, tc.desc.Digest)
+		require.NoError(t, err)
+		require.Equal(t, tc.desc.Size, info.Size)
+
+		dt, err := content.ReadBlob(ctx, s, tc.desc)
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(tc.dt, dt))
+	}
+
+	// writing existing content fails
+	_, err = s.Writer(ctx, content.WithRef("again"), content.WithDescriptor(desc1))
+	require.True(t, errdefs.IsAlreadyExists(err))
+
+	var walked []digest.Digest
+	err = s.Walk(ctx, func(info content.Info) error {
+		walked = append(walked, info.Digest)
+		return nil
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []digest.Digest{desc1.Digest, desc2.Digest}, walked)
+
+	// shared chunks are kept until the last blob is deleted
+	require.NoError(t, s.Delete(ctx, desc1.Digest))
+	_, err = s.Info(ctx, desc1.Digest)
+	require.True(t, errdefs.IsNotFound(err))
+	dt, err := content.ReadBlob(ctx, s, desc2)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(other, dt))
+
+	require.NoError(t, s.Delete(ctx, desc2.Digest))
+	require.Equal(t, int64(0), chunksSize(t, root))
+}
+
+func TestGzipLayers(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	root := t.TempDir()
+	s, err := NewStore(root)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// two layers with the same files except one in the middle, compressed
+	// like the layers created by buildkit
+	rnd := rand.New(rand.NewSource(1))
+	files := make([][]byte, 64)
+	for i := range files {
+		files[i] = randomText(rnd, 32<<10)
+	}
+	tar1 := layerTar(t, files)
+	files[32] = randomText(rnd, 32<<10)
+	tar2 := layerTar(t, files)
+	gz1, gz2 := gzipBlob(t, tar1, gzip.DefaultCompression), gzipBlob(t, tar2, gzip.DefaultCompression)
+
+	// chunks of the compressed streams are only shared up to the change
+	require.Less(t, sharedChunks(t, gz1, gz2), 0.6)
+	require.Greater(t, sharedChunks(t, tar1, tar2), 0.9)
+
+	var descs []ocispecs.Descriptor
+	for _, dt := range [][]byte{gz1, gz2} {
+		desc := ocispecs.Descriptor{Digest: digest.FromBytes(dt), Size: int64(len(dt))}
+		require.NoError(t, content.WriteBlob(ctx, s, desc.Digest.String(), bytes.NewReader(dt), desc))
+		rec, err := s.getBlob(desc.Digest)
+		require.NoError(t, err)
+		require.True(t, rec.Gzip)
+		descs = append(descs, desc)
+	}
+	size := chunksSize(t, root)
+	ratio := float64(size) / float64(len(gz1)+len(gz2))
+	t.Logf("chunks: %d bytes, blobs: %d bytes, ratio %.2f", size, len(gz1)+len(gz2), ratio)
+	require.Less(t, ratio, 0.65)
+
+	dt, err := content.ReadBlob(ctx, s, descs[1])
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(gz2, dt))
+
+	// reads before the current offset compress the blob again
+	ra, err := s.ReaderAt(ctx, descs[0])
+	require.NoError(t, err)
+	defer ra.Close()
+	buf := make([]byte, 1024)
+	for _, off := range []int64{int64(len(gz1)) / 2, 10, int64(len(gz1)) - 100} {
+		n, err := ra.ReadAt(buf, off)
+		if off+int64(len(buf)) > int64(len(gz1)) {
+			require.Equal(t, io.EOF, err)
+		} else {
+			require.NoError(t, err)
+		}
+		require.Equal(t, gz1[off:off+int64(n)], buf[:n])
+	}
+
+	// blobs that compress/gzip doesn't reproduce are split compressed
+	var b bytes.Buffer
+	gw := gzip.NewWriter(&b)
+	gw.Name = "layer.tar"
+	_, err = gw.Write(tar1)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	desc := ocispecs.Descriptor{Digest: digest.FromBytes(b.Bytes()), Size: int64(b.Len())}
+	require.NoError(t, content.WriteBlob(ctx, s, desc.Digest.String(), bytes.NewReader(b.Bytes()), desc))
+	rec, err := s.getBlob(desc.Digest)
+	require.NoError(t, err)
+	require.False(t, rec.Gzip)
+	dt, err = content.ReadBlob(ctx, s, desc)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(b.Bytes(), dt))
+
+	for _, desc := range append(descs, desc) {
+		require.NoError(t, s.Delete(ctx, desc.Digest))
+	}
+	require.Equal(t, int64(0), chunksSize(t, root))
+}
+
+// randomText returns compressible text of random words
+func randomText(rnd *rand.Rand, size int) []byte {
+	words := make([]string, 256)
+	for i := range words {
+		w := make([]byte, 3+rnd.Intn(6))
+		for j := range w {
+			w[j] = byte('a' + rnd.Intn(26))
+		}
+		words[i] = string(w)
+	}
+	var b bytes.Buffer
+	for b.Len() < size {
+		b.WriteString(words[rnd.Intn(len(words))])
+		b.WriteByte(' ')
+	}
+	return b.Bytes()[:size]
+}
+
+func layerTar(t *testing.T, files [][]byte) []byte {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for i, dt := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "file" + strconv.Itoa(i), Mode: 0644, Size: int64(len(dt))}))
+		_, err := tw.Write(dt)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return b.Bytes()
+}
+
+func gzipBlob(t *testing.T, dt []byte, level int) []byte {
+	var b bytes.Buffer
+	gw, err := gzip.NewWriterLevel(&b, level)
+	require.NoError(t, err)
+	_, err = gw.Write(dt)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	return b.Bytes()
+}
+
+// sharedChunks returns the fraction of the chunks of b that are chunks of a
+func sharedChunks(t *testing.T, a, b []byte) float64 {
+	m := map[digest.Digest]struct{}{}
+	require.NoError(t, Split(bytes.NewReader(a), func(c []byte) error {
+		m[digest.FromBytes(c)] = struct{}{}
+		return nil
+	}))
+	var n, shared int
+	require.NoError(t, Split(bytes.NewReader(b), func(c []byte) error {
+		n++
+		if _, ok := m[digest.FromBytes(c)]; ok {
+			shared++
+		}
+		return nil
+	}))
+	return float64(shared) / float64(n)
+}
+
+func chunksSize(t *testing.T, root string) int64 {
+	var size int64
+	err := filepath.Walk(filepath.Join(root, "chunks"), func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	return size
+}
+
+func TestVerifyGzip(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	root := t.TempDir()
+	s, err := NewStore(root)
+	require.NoError(t, err)
+	defer s.Close()
+
+	rnd := rand.New(rand.NewSource(1))
+	gz := gzipBlob(t, layerTar(t, [][]byte{randomText(rnd, 64<<10)}), gzip.DefaultCompression)
+	desc := ocispecs.Descriptor{Digest: digest.FromBytes(gz), Size: int64(len(gz))}
+	require.NoError(t, content.WriteBlob(ctx, s, desc.Digest.String(), bytes.NewReader(gz), desc))
+
+	setRecord := func(fn func(*blobRecord)) {
+		rec, err := s.getBlob(desc.Digest)
+		require.NoError(t, err)
+		fn(rec)
+		dt, err := json.Marshal(rec)
+		require.NoError(t, err)
+		require.NoError(t, s.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(bucketBlobs).Put([]byte(desc.Digest), dt)
+		}))
+	}
+
+	// blobs chunked by another Go version are verified once
+	setRecord(func(rec *blobRecord) { rec.GoVersion = "go1.0" })
+	dt, err := content.ReadBlob(ctx, s, desc)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(gz, dt))
+	rec, err := s.getBlob(desc.Digest)
+	require.NoError(t, err)
+	require.Equal(t, runtime.Version(), rec.GoVersion)
+
+	// blobs that aren't reproduced anymore are removed to be fetched again
+	setRecord(func(rec *blobRecord) {
+		rec.GoVersion = "go1.0"
+		rec.GzipLevel = gzip.BestCompression
+	})
+	_, err = s.ReaderAt(ctx, desc)
+	require.True(t, errdefs.IsNotFound(err))
+	_, err = s.Info(ctx, desc.Digest)
+	require.True(t, errdefs.IsNotFound(err))
+	require.Equal(t, int64(0), chunksSize(t, root))
+}
+
+func TestPruneChunks(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	root := t.TempDir()
+	s, err := NewStore(root)
+	require.NoError(t, err)
+
+	dt := []byte("blob")
+	desc := ocispecs.Descriptor{Digest: digest.FromBytes(dt), Size: int64(len(dt))}
+	require.NoError(t, content.WriteBlob(ctx, s, desc.Digest.String(), bytes.NewReader(dt), desc))
+	size := chunksSize(t, root)
+
+	// chunks of a blob that was never committed to the database
+	require.NoError(t, s.writeChunk(digest.FromString("orphan"), []byte("orphan")))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "chunks", "sha256", ".tmp-1"), []byte("tmp"), 0600))
+	require.NoError(t, s.Close())
+
+	s, err = NewStore(root)
+	require.NoError(t, err)
+	defer s.Close()
+	require.Equal(t, size, chunksSize(t, root))
+	got, err := content.ReadBlob(ctx, s, desc)
+	require.NoError(t, err)
+	require.Equal(t, dt, got)
+}
+
+func TestConcurrentBlobs(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	root := t.TempDir()
+	s, err := NewStore(root)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// blobs sharing chunks are written and deleted concurrently
+	rnd := rand.New(rand.NewSource(1))
+	base := make([]byte, 512<<10)
+	rnd.Read(base)
+	var eg errgroup.Group
+	for i := 0; i < 8; i++ {
+		dt := append(append([]byte{}, base...), []byte(strconv.Itoa(i))...)
+		eg.Go(func() error {
+			for j := 0; j < 4; j++ {
+				desc := ocispecs.Descriptor{Digest: digest.FromBytes(dt), Size: int64(len(dt))}
+				if err := content.WriteBlob(ctx, s, desc.Digest.String()+strconv.Itoa(j), bytes.NewReader(dt), desc); err != nil {
+					return err
+				}
+				got, err := content.ReadBlob(ctx, s, desc)
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(dt, got) {
+					return errors.Errorf("blob %s changed", desc.Digest)
+				}
+				if err := s.Delete(ctx, desc.Digest); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	require.NoError(t, eg.Wait())
+	require.Equal(t, int64(0), chunksSize(t, root))
+}
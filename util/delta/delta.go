@@ -0,0 +1,303 @@
+// Package delta computes binary deltas between two versions of a file. The
+// delta is a sequence of instructions that copy blocks of the old version or
+// insert literal data, found with a rolling checksum like rsync.
+package delta
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// BlockSize is the size of the blocks of the old version that are matched
+	// in the new version
+	BlockSize = 4096
+
+	opCopy    = 'C'
+	opLiteral = 'L'
+	opEnd     = 'E'
+
+	maxLiteral = 1 << 20
+)
+
+var magic = []byte("BKDELTA1")
+
+// Diff writes the delta from old, of size oldSize, to new to w
+func Diff(w io.Writer, old io.ReaderAt, oldSize int64, new io.Reader) error {
+	idx, err := indexBlocks(old, oldSize)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(magic); err != nil {
+		return err
+	}
+	e := &encoder{w: bw}
+	br := bufio.NewReader(new)
+
+	win := newWindow()
+	if err := win.fill(br); err != nil {
+		return err
+	}
+	oldBlock := make([]byte, BlockSize)
+	for win.n == BlockSize {
+		if off, ok, err := idx.match(old, win, oldBlock); err != nil {
+			return err
+		} else if ok {
+			if err := e.copy(off, BlockSize); err != nil {
+				return err
+			}
+			win.reset()
+			if err := win.fill(br); err != nil {
+				return err
+			}
+			continue
+		}
+		b, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if err := e.literal(win.roll(b)); err != nil {
+			return err
+		}
+	}
+	for _, b := range win.bytes() {
+		if err := e.literal(b); err != nil {
+			return err
+		}
+	}
+	if err := e.end(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Apply writes the new version of the file to w from old and the delta
+// created by Diff
+func Apply(w io.Writer, old io.ReaderAt, delta io.Reader) error {
+	br := bufio.NewReader(delta)
+	m := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, m); err != nil || !bytes.Equal(m, magic) {
+		return errors.New("invalid delta header")
+	}
+	for {
+		op, err := br.ReadByte()
+		if err != nil {
+			return errors.Wrap(err, "failed to read delta")
+		}
+		switch op {
+		case opCopy:
+			off, err := binary.ReadUvarint(br)
+			if err != nil {
+				return errors.Wrap(err, "failed to read delta")
+			}
+			n, err := binary.ReadUvarint(br)
+			if err != nil {
+				return errors.Wrap(err, "failed to read delta")
+			}
+			if _, err := io.Copy(w, io.NewSectionReader(old, int64(off), int64(n))); err != nil {
+				return err
+			}
+		case opLiteral:
+			n, err := binary.ReadUvarint(br)
+			if err != nil {
+				return errors.Wrap(err, "failed to read delta")
+			}
+			if _, err := io.CopyN(w, br, int64(n)); err != nil {
+				return errors.Wrap(err, "failed to read delta")
+			}
+		case opEnd:
+			return nil
+		default:
+			return errors.Errorf("invalid delta instruction %q", op)
+		}
+	}
+}
+
+// blockIndex maps the weak checksums of the blocks of the old version to
+// their offsets
+type blockIndex map[uint32][]int64
+
+func indexBlocks(old io.ReaderAt, size int64) (blockIndex, error) {
+	idx := blockIndex{}
+	buf := make([]byte, BlockSize)
+	for off := int64(0); off+BlockSize <= size; off += BlockSize {
+		if _, err := old.ReadAt(buf, off); err != nil {
+			return nil, errors.Wrap(err, "failed to read old version")
+		}
+		h := checksum(buf)
+		idx[h] = append(idx[h], off)
+	}
+	return idx, nil
+}
+
+// match returns the offset of a block of the old version with the same
+// contents as the window
+func (idx blockIndex) match(old io.ReaderAt, win *window, buf []byte) (int64, bool, error) {
+	offs, ok := idx[win.sum()]
+	if !ok {
+		return 0, false, nil
+	}
+	cur := win.bytes()
+	for _, off := range offs {
+		if _, err := old.ReadAt(buf, off); err != nil {
+			return 0, false, errors.Wrap(err, "failed to read old version")
+		}
+		if bytes.Equal(buf, cur) {
+			return off, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// window is a ring buffer of the last BlockSize bytes of the new version with
+// their rolling checksum
+type window struct {
+	buf  []byte
+	pos  int
+	n    int
+	a, b uint32
+}
+
+func newWindow() *window {
+	return &window{buf: make([]byte, BlockSize)}
+}
+
+func (w *window) reset() {
+	w.pos, w.n, w.a, w.b = 0, 0, 0, 0
+}
+
+func (w *window) fill(r *bufio.Reader) error {
+	n, err := io.ReadFull(r, w.buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	w.pos, w.n = 0, n
+	w.a, w.b = checksumParts(w.buf[:n])
+	return nil
+}
+
+// roll adds c to the window and returns the byte that was removed
+func (w *window) roll(c byte) byte {
+	out := w.buf[w.pos]
+	w.buf[w.pos] = c
+	w.pos = (w.pos + 1) % BlockSize
+	w.a = (w.a - uint32(out) + uint32(c)) & 0xffff
+	w.b = (w.b - BlockSize*uint32(out) + w.a) & 0xffff
+	return out
+}
+
+func (w *window) sum() uint32 {
+	return w.a | w.b<<16
+}
+
+func (w *window) bytes() []byte {
+	if w.n < BlockSize {
+		return w.buf[:w.n]
+	}
+	return append(append(make([]byte, 0, BlockSize), w.buf[w.pos:]...), w.buf[:w.pos]...)
+}
+
+func checksum(dt []byte) uint32 {
+	a, b := checksumParts(dt)
+	return a | b<<16
+}
+
+func checksumParts(dt []byte) (uint32, uint32) {
+	var a, b uint32
+	for i, c := range dt {
+		a += uint32(c)
+		b += uint32(len(dt)-i) * uint32(c)
+	}
+	return a & 0xffff, b & 0xffff
+}
+
+// encoder writes the instructions of a delta, merging adjacent copies
+type encoder struct {
+	w       *bufio.Writer
+	lit     []byte
+	copyOff int64
+	copyLen int64
+}
+
+func (e *encoder) copy(off, n int64) error {
+	if err := e.flushLiteral(); err != nil {
+		return err
+	}
+	if e.copyLen > 0 && e.copyOff+e.copyLen == off {
+		e.copyLen += n
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.copyOff, e.copyLen = off, n
+	return nil
+}
+
+func (e *encoder) literal(c byte) error {
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.lit = append(e.lit, c)
+	if len(e.lit) >= maxLiteral {
+		return e.flushLiteral()
+	}
+	return nil
+}
+
+func (e *encoder) end() error {
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	if err := e.flushLiteral(); err != nil {
+		return err
+	}
+	return e.w.WriteByte(opEnd)
+}
+
+func (e *encoder) flushCopy() error {
+	if e.copyLen == 0 {
+		return nil
+	}
+	if err := e.writeOp(opCopy, uint64(e.copyOff), uint64(e.copyLen)); err != nil {
+		return err
+	}
+	e.copyLen = 0
+	return nil
+}
+
+func (e *encoder) flushLiteral() error {
+	if len(e.lit) == 0 {
+		return nil
+	}
+	if err := e.writeOp(opLiteral, uint64(len(e.lit))); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(e.lit); err != nil {
+		return err
+	}
+	e.lit = e.lit[:0]
+	return nil
+}
+
+func (e *encoder) writeOp(op byte, args ...uint64) error {
+	if err := e.w.WriteByte(op); err != nil {
+		return err
+	}
+	var buf [binary.MaxVarintLen64]byte
+	for _, v := range args {
+		n := binary.PutUvarint(buf[:], v)
+		if _, err := e.w.Write(buf[:n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
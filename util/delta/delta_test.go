@@ -0,0 +1,67 @@
+package delta
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffApply(t *testing.T) {
+	t.Parallel()
+
+	rnd := rand.New(rand.NewSource(1))
+	randBytes := func(n int) []byte {
+		dt := make([]byte, n)
+		rnd.Read(dt)
+		return dt
+	}
+
+	base := randBytes(20 * BlockSize)
+	changed := append([]byte{}, base[:5*BlockSize+100]...)
+	changed = append(changed, []byte("inserted data")...)
+	changed = append(changed, base[5*BlockSize+100:12*BlockSize]...)
+	changed = append(changed, randBytes(BlockSize/2)...)
+	changed = append(changed, base[15*BlockSize:]...)
+
+	for _, tc := range []struct {
+		name string
+		old  []byte
+		new  []byte
+	}{
+		{name: "changed", old: base, new: changed},
+		{name: "equal", old: base, new: base},
+		{name: "emptyold", old: nil, new: changed},
+		{name: "emptynew", old: base, new: nil},
+		{name: "short", old: []byte("foo"), new: []byte("foobar")},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := Diff(buf, bytes.NewReader(tc.old), int64(len(tc.old)), bytes.NewReader(tc.new))
+			require.NoError(t, err)
+
+			out := &bytes.Buffer{}
+			err = Apply(out, bytes.NewReader(tc.old), bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+			require.Equal(t, len(tc.new), out.Len())
+			require.True(t, bytes.Equal(tc.new, out.Bytes()))
+		})
+	}
+
+	buf := &bytes.Buffer{}
+	err := Diff(buf, bytes.NewReader(base), int64(len(base)), bytes.NewReader(changed))
+	require.NoError(t, err)
+	require.Less(t, buf.Len(), 2*BlockSize)
+}
+
+func TestApplyInvalid(t *testing.T) {
+	t.Parallel()
+
+	err := Apply(&bytes.Buffer{}, bytes.NewReader(nil), bytes.NewReader([]byte("foo")))
+	require.Error(t, err)
+
+	err = Apply(&bytes.Buffer{}, bytes.NewReader(nil), bytes.NewReader(append(append([]byte{}, magic...), 'X')))
+	require.Error(t, err)
+}
@@ -0,0 +1,220 @@
+// Package filemanifest lists the files of image layers with their sizes,
+// modes and digests, per layer and merged into the root filesystem of the
+// image, so that images can be compared file by file.
+package filemanifest
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// PredicateType is the in-toto predicate type of file manifests attached to
+// images
+const PredicateType = "https://github.com/moby/buildkit/file-manifest/v0.1"
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+// Entry is a file of a layer or root filesystem
+type Entry struct {
+	// Path is the absolute path of the file
+	Path string `json:"path"`
+	// Mode contains the file type and permission bits as in os.FileMode
+	Mode uint32 `json:"mode"`
+	// UID and GID are the owner of the file
+	UID      int    `json:"uid,omitempty"`
+	GID      int    `json:"gid,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Digest   string `json:"digest,omitempty"`
+	Linkname string `json:"linkname,omitempty"`
+	// Deleted marks whiteouts of layers that delete the path of the lower
+	// layers
+	Deleted bool `json:"deleted,omitempty"`
+	// Opaque marks directories of layers that hide the contents of the
+	// directory in the lower layers
+	Opaque bool `json:"opaque,omitempty"`
+}
+
+// Layer is the file list of a layer
+type Layer struct {
+	Digest digest.Digest `json:"digest"`
+	Files  []Entry       `json:"files"`
+}
+
+// Manifest is the file list of the layers of an image and of its root
+// filesystem
+type Manifest struct {
+	Layers []Layer `json:"layers"`
+	Files  []Entry `json:"files"`
+}
+
+// ReadLayer lists the files of an uncompressed layer tarball. Regular files
+// have the digest of their contents.
+func ReadLayer(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read layer")
+		}
+		p := path.Join("/", h.Name)
+		dir, base := path.Split(p)
+		switch {
+		case base == whiteoutOpaque:
+			entries = append(entries, Entry{Path: path.Clean(dir), Opaque: true})
+			continue
+		case strings.HasPrefix(base, whiteoutPrefix):
+			entries = append(entries, Entry{Path: path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), Deleted: true})
+			continue
+		}
+		e := Entry{
+			Path: p,
+			Mode: uint32(h.FileInfo().Mode()),
+			UID:  h.Uid,
+			GID:  h.Gid,
+		}
+		switch h.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			dgst, err := digest.FromReader(tr)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to read %s", p)
+			}
+			e.Size = h.Size
+			e.Digest = dgst.String()
+		case tar.TypeSymlink:
+			e.Linkname = h.Linkname
+		case tar.TypeLink:
+			e.Linkname = path.Join("/", h.Linkname)
+		}
+		entries = append(entries, e)
+	}
+	sortEntries(entries)
+	return mergeOpaque(entries), nil
+}
+
+// mergeOpaque folds the opaque marker of a directory into the entry of the
+// directory if the layer contains one
+func mergeOpaque(entries []Entry) []Entry {
+	out := entries[:0]
+	for _, e := range entries {
+		if n := len(out); n > 0 && out[n-1].Path == e.Path && (e.Opaque || out[n-1].Opaque) {
+			out[n-1].Opaque = true
+			if e.Opaque {
+				continue
+			}
+			e.Opaque = true
+			out[n-1] = e
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// Merge applies the layers in order, from the bottom layer, and returns the
+// files of the resulting root filesystem
+func Merge(layers ...[]Entry) []Entry {
+	files := map[string]Entry{}
+	for _, l := range layers {
+		for _, e := range l {
+			if e.Deleted || e.Opaque {
+				removeChildren(files, e.Path)
+			}
+			if e.Deleted {
+				delete(files, e.Path)
+				continue
+			}
+			if e.Opaque && e.Mode == 0 {
+				continue
+			}
+			e.Opaque = false
+			files[e.Path] = e
+		}
+	}
+	out := make([]Entry, 0, len(files))
+	for _, e := range files {
+		out = append(out, e)
+	}
+	sortEntries(out)
+	return out
+}
+
+func removeChildren(files map[string]Entry, dir string) {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	for p := range files {
+		if strings.HasPrefix(p, prefix) {
+			delete(files, p)
+		}
+	}
+}
+
+func sortEntries(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+}
+
+// FromLayers reads the layer blobs of an image from the content store and
+// returns its manifest
+func FromLayers(ctx context.Context, provider content.Provider, layers []ocispecs.Descriptor) (*Manifest, error) {
+	m := &Manifest{}
+	files := make([][]Entry, 0, len(layers))
+	for _, desc := range layers {
+		entries, err := readBlob(ctx, provider, desc)
+		if err != nil {
+			return nil, err
+		}
+		m.Layers = append(m.Layers, Layer{Digest: desc.Digest, Files: entries})
+		files = append(files, entries)
+	}
+	m.Files = Merge(files...)
+	return m, nil
+}
+
+func readBlob(ctx context.Context, provider content.Provider, desc ocispecs.Descriptor) ([]Entry, error) {
+	ra, err := provider.ReaderAt(ctx, desc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open layer %s", desc.Digest)
+	}
+	defer ra.Close()
+	r, err := compression.DecompressStream(content.NewReader(ra))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decompress layer %s", desc.Digest)
+	}
+	defer r.Close()
+	entries, err := ReadLayer(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "layer %s", desc.Digest)
+	}
+	if _, ok := desc.Annotations[estargz.TOCJSONDigestAnnotation]; ok {
+		// the TOC and landmark files of eStargz layers are not part of the
+		// filesystem
+		out := entries[:0]
+		for _, e := range entries {
+			switch strings.TrimPrefix(e.Path, "/") {
+			case estargz.TOCTarName, estargz.PrefetchLandmark, estargz.NoPrefetchLandmark:
+				continue
+			}
+			out = append(out, e)
+		}
+		entries = out
+	}
+	return entries, nil
+}
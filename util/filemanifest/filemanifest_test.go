@@ -0,0 +1,96 @@
+package filemanifest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+type file struct {
+	name string
+	data string
+	mode int64
+	uid  int
+	dir  bool
+}
+
+func writeLayer(ctx context.Context, t *testing.T, cs content.Store, files ...file) ocispecs.Descriptor {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		h := &tar.Header{Name: f.name, Mode: f.mode, Uid: f.uid, Gid: f.uid, Size: int64(len(f.data)), Typeflag: tar.TypeReg}
+		if f.dir {
+			h.Typeflag = tar.TypeDir
+			h.Size = 0
+		}
+		require.NoError(t, tw.WriteHeader(h))
+		_, err := tw.Write([]byte(f.data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	desc := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageLayerGzip,
+		Digest:    digest.FromBytes(buf.Bytes()),
+		Size:      int64(buf.Len()),
+	}
+	require.NoError(t, content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(buf.Bytes()), desc))
+	return desc
+}
+
+func TestFromLayers(t *testing.T) {
+	ctx := context.TODO()
+	cs, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	l1 := writeLayer(ctx, t, cs,
+		file{name: "etc/", mode: 0755, dir: true},
+		file{name: "etc/hosts", data: "localhost", mode: 0644},
+		file{name: "etc/passwd", data: "root", mode: 0644},
+		file{name: "opt/", mode: 0755, dir: true},
+		file{name: "opt/a", data: "a", mode: 0755},
+	)
+	l2 := writeLayer(ctx, t, cs,
+		file{name: "etc/.wh.hosts"},
+		file{name: "etc/passwd", data: "root,user", mode: 0600},
+		file{name: "opt/.wh..wh..opq"},
+		file{name: "opt/", mode: 0700, dir: true},
+		file{name: "opt/b", data: "b", mode: 0644, uid: 1000},
+	)
+
+	m, err := FromLayers(ctx, cs, []ocispecs.Descriptor{l1, l2})
+	require.NoError(t, err)
+	require.Len(t, m.Layers, 2)
+	require.Equal(t, l1.Digest, m.Layers[0].Digest)
+	require.Len(t, m.Layers[0].Files, 5)
+
+	layer := m.Layers[1].Files
+	require.Len(t, layer, 4)
+	require.Equal(t, Entry{Path: "/etc/hosts", Deleted: true}, layer[0])
+	require.Equal(t, "/opt", layer[2].Path)
+	require.True(t, layer[2].Opaque)
+	require.Equal(t, uint32(os.ModeDir|0700), layer[2].Mode)
+
+	var paths []string
+	for _, e := range m.Files {
+		paths = append(paths, e.Path)
+		require.False(t, e.Opaque)
+	}
+	require.Equal(t, []string{"/etc", "/etc/passwd", "/opt", "/opt/b"}, paths)
+	require.Equal(t, int64(9), m.Files[1].Size)
+	require.Equal(t, digest.FromString("root,user").String(), m.Files[1].Digest)
+	require.Equal(t, uint32(0600), m.Files[1].Mode)
+	require.Equal(t, 1000, m.Files[3].UID)
+	require.Equal(t, 1000, m.Files[3].GID)
+}
@@ -0,0 +1,288 @@
+// Package imagediff compares the configs, layers and files of two images.
+package imagediff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/moby/buildkit/util/filemanifest"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+type Change string
+
+const (
+	Unchanged Change = "unchanged"
+	Added     Change = "added"
+	Removed   Change = "removed"
+	Changed   Change = "changed"
+)
+
+// Image is an image of a single platform
+type Image struct {
+	Manifest ocispecs.Descriptor
+	Config   ocispecs.Image
+	Layers   []ocispecs.Descriptor
+}
+
+// Load reads the image of desc from provider. Indexes are resolved to the
+// manifest best matching platform.
+func Load(ctx context.Context, provider content.Provider, desc ocispecs.Descriptor, platform platforms.MatchComparer) (*Image, error) {
+	for images.IsIndexType(desc.MediaType) {
+		dt, err := content.ReadBlob(ctx, provider, desc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read index %s", desc.Digest)
+		}
+		var idx ocispecs.Index
+		if err := json.Unmarshal(dt, &idx); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse index %s", desc.Digest)
+		}
+		var matching []ocispecs.Descriptor
+		for _, m := range idx.Manifests {
+			if m.Platform == nil || platform.Match(*m.Platform) {
+				matching = append(matching, m)
+			}
+		}
+		if len(matching) == 0 {
+			return nil, errors.Errorf("no manifest of index %s matches the platform", desc.Digest)
+		}
+		sort.SliceStable(matching, func(i, j int) bool {
+			if matching[i].Platform == nil || matching[j].Platform == nil {
+				return matching[j].Platform == nil && matching[i].Platform != nil
+			}
+			return platform.Less(*matching[i].Platform, *matching[j].Platform)
+		})
+		desc = matching[0]
+	}
+
+	dt, err := content.ReadBlob(ctx, provider, desc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read manifest %s", desc.Digest)
+	}
+	var mfst ocispecs.Manifest
+	if err := json.Unmarshal(dt, &mfst); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse manifest %s", desc.Digest)
+	}
+	img := &Image{Manifest: desc, Layers: mfst.Layers}
+	dt, err = content.ReadBlob(ctx, provider, mfst.Config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read image config %s", mfst.Config.Digest)
+	}
+	if err := json.Unmarshal(dt, &img.Config); err != nil {
+		return nil, errors.Wrap(err, "failed to parse image config")
+	}
+	return img, nil
+}
+
+// ConfigChange is a changed field of the image config
+type ConfigChange struct {
+	Field string
+	A, B  string
+}
+
+// Config compares the fields of the image configs that affect containers
+// and the platform of the images. Env, Labels, ExposedPorts and Volumes are
+// compared by key.
+func Config(a, b ocispecs.Image) []ConfigChange {
+	var out []ConfigChange
+	add := func(field, va, vb string) {
+		if va != vb {
+			out = append(out, ConfigChange{Field: field, A: va, B: vb})
+		}
+	}
+	add("Platform", platformString(a), platformString(b))
+	add("User", a.Config.User, b.Config.User)
+	add("WorkingDir", a.Config.WorkingDir, b.Config.WorkingDir)
+	add("Entrypoint", jsonString(a.Config.Entrypoint), jsonString(b.Config.Entrypoint))
+	add("Cmd", jsonString(a.Config.Cmd), jsonString(b.Config.Cmd))
+	add("StopSignal", a.Config.StopSignal, b.Config.StopSignal)
+	out = append(out, compareMaps("Env", envMap(a.Config.Env), envMap(b.Config.Env))...)
+	out = append(out, compareMaps("Labels", a.Config.Labels, b.Config.Labels)...)
+	out = append(out, compareMaps("ExposedPorts", setMap(a.Config.ExposedPorts), setMap(b.Config.ExposedPorts))...)
+	out = append(out, compareMaps("Volumes", setMap(a.Config.Volumes), setMap(b.Config.Volumes))...)
+	return out
+}
+
+func platformString(img ocispecs.Image) string {
+	return platforms.Format(ocispecs.Platform{OS: img.OS, Architecture: img.Architecture})
+}
+
+func jsonString(v []string) string {
+	if v == nil {
+		return ""
+	}
+	dt, _ := json.Marshal(v)
+	return string(dt)
+}
+
+func envMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, e := range env {
+		k, v := e, ""
+		if i := strings.Index(e, "="); i >= 0 {
+			k, v = e[:i], e[i+1:]
+		}
+		m[k] = v
+	}
+	return m
+}
+
+func setMap(s map[string]struct{}) map[string]string {
+	m := make(map[string]string, len(s))
+	for k := range s {
+		m[k] = k
+	}
+	return m
+}
+
+func compareMaps(field string, a, b map[string]string) []ConfigChange {
+	keys := map[string]struct{}{}
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var out []ConfigChange
+	for _, k := range sorted {
+		if a[k] != b[k] || hasKey(a, k) != hasKey(b, k) {
+			out = append(out, ConfigChange{Field: fmt.Sprintf("%s.%s", field, k), A: a[k], B: b[k]})
+		}
+	}
+	return out
+}
+
+func hasKey(m map[string]string, k string) bool {
+	_, ok := m[k]
+	return ok
+}
+
+// LayerChange is a layer of one of the images
+type LayerChange struct {
+	Digest digest.Digest
+	Size   int64
+	Change Change
+}
+
+// Layers compares the layer chains of the images. The common base layers are
+// unchanged, the following layers of a are removed and those of b added.
+func Layers(a, b []ocispecs.Descriptor) []LayerChange {
+	var out []LayerChange
+	i := 0
+	for ; i < len(a) && i < len(b) && a[i].Digest == b[i].Digest; i++ {
+		out = append(out, LayerChange{Digest: a[i].Digest, Size: a[i].Size, Change: Unchanged})
+	}
+	for _, l := range a[i:] {
+		out = append(out, LayerChange{Digest: l.Digest, Size: l.Size, Change: Removed})
+	}
+	for _, l := range b[i:] {
+		out = append(out, LayerChange{Digest: l.Digest, Size: l.Size, Change: Added})
+	}
+	return out
+}
+
+// FileChange is a file that differs between the images
+type FileChange struct {
+	Path         string
+	Change       Change
+	SizeA, SizeB int64
+	// Layer is the top layer of b containing the change, empty for files
+	// that were removed with the layers of a
+	Layer digest.Digest
+}
+
+// Files compares the root filesystems of the file manifests of the images
+func Files(a, b *filemanifest.Manifest) []FileChange {
+	filesA := make(map[string]filemanifest.Entry, len(a.Files))
+	for _, e := range a.Files {
+		filesA[e.Path] = e
+	}
+	filesB := make(map[string]filemanifest.Entry, len(b.Files))
+	for _, e := range b.Files {
+		filesB[e.Path] = e
+	}
+
+	layers := indexLayers(b)
+	var out []FileChange
+	for _, eb := range b.Files {
+		ea, ok := filesA[eb.Path]
+		switch {
+		case !ok:
+			out = append(out, FileChange{Path: eb.Path, Change: Added, SizeB: eb.Size, Layer: layers.changedIn(eb.Path)})
+		case ea != eb:
+			out = append(out, FileChange{Path: eb.Path, Change: Changed, SizeA: ea.Size, SizeB: eb.Size, Layer: layers.changedIn(eb.Path)})
+		}
+	}
+	for _, ea := range a.Files {
+		if _, ok := filesB[ea.Path]; !ok {
+			out = append(out, FileChange{Path: ea.Path, Change: Removed, SizeA: ea.Size, Layer: layers.changedIn(ea.Path)})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+// layerIndex is the entries of the layers of a manifest by path
+type layerIndex []struct {
+	digest digest.Digest
+	// paths are the paths the layer adds, changes or deletes
+	paths map[string]struct{}
+	// removedDirs are the directories the layer deletes or makes opaque,
+	// which change all paths below them
+	removedDirs map[string]struct{}
+}
+
+func indexLayers(m *filemanifest.Manifest) layerIndex {
+	idx := make(layerIndex, len(m.Layers))
+	for i, l := range m.Layers {
+		idx[i].digest = l.Digest
+		idx[i].paths = make(map[string]struct{}, len(l.Files))
+		idx[i].removedDirs = map[string]struct{}{}
+		for _, e := range l.Files {
+			idx[i].paths[e.Path] = struct{}{}
+			if e.Deleted || e.Opaque {
+				idx[i].removedDirs[e.Path] = struct{}{}
+			}
+		}
+	}
+	return idx
+}
+
+// changedIn returns the top layer that adds, changes or deletes p,
+// including deletions of its parent directories
+func (idx layerIndex) changedIn(p string) digest.Digest {
+	for i := len(idx) - 1; i >= 0; i-- {
+		if _, ok := idx[i].paths[p]; ok {
+			return idx[i].digest
+		}
+		if len(idx[i].removedDirs) == 0 {
+			continue
+		}
+		for dir := path.Dir(p); ; dir = path.Dir(dir) {
+			if _, ok := idx[i].removedDirs[dir]; ok {
+				return idx[i].digest
+			}
+			if dir == "/" || dir == "." {
+				break
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package imagediff
+
+import (
+	"testing"
+
+	"github.com/moby/buildkit/util/filemanifest"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	a := ocispecs.Image{OS: "linux", Architecture: "amd64"}
+	a.Config.Env = []string{"PATH=/bin", "A=1"}
+	a.Config.Cmd = []string{"sh"}
+	a.Config.ExposedPorts = map[string]struct{}{"80/tcp": {}}
+
+	b := a
+	b.Config.Env = []string{"PATH=/bin", "B="}
+	b.Config.Cmd = []string{"bash"}
+	b.Config.Labels = map[string]string{"l": "v"}
+
+	require.Equal(t, []ConfigChange{
+		{Field: "Cmd", A: `["sh"]`, B: `["bash"]`},
+		{Field: "Env.A", A: "1"},
+		{Field: "Env.B"},
+		{Field: "Labels.l", B: "v"},
+	}, Config(a, b))
+	require.Empty(t, Config(a, a))
+}
+
+func TestLayers(t *testing.T) {
+	l := func(s string) ocispecs.Descriptor {
+		return ocispecs.Descriptor{Digest: digest.FromString(s), Size: int64(len(s))}
+	}
+	changes := Layers([]ocispecs.Descriptor{l("base"), l("a")}, []ocispecs.Descriptor{l("base"), l("bb"), l("ccc")})
+	require.Equal(t, []LayerChange{
+		{Digest: digest.FromString("base"), Size: 4, Change: Unchanged},
+		{Digest: digest.FromString("a"), Size: 1, Change: Removed},
+		{Digest: digest.FromString("bb"), Size: 2, Change: Added},
+		{Digest: digest.FromString("ccc"), Size: 3, Change: Added},
+	}, changes)
+}
+
+func TestFiles(t *testing.T) {
+	d1, d2 := digest.FromString("l1"), digest.FromString("l2")
+	base := []filemanifest.Entry{
+		{Path: "/etc", Mode: 0755},
+		{Path: "/etc/hosts", Size: 9},
+		{Path: "/opt", Mode: 0755},
+		{Path: "/opt/a", Size: 1},
+	}
+	a := &filemanifest.Manifest{
+		Layers: []filemanifest.Layer{{Digest: d1, Files: base}},
+		Files:  base,
+	}
+	top := []filemanifest.Entry{
+		{Path: "/etc", Mode: 0755, UID: 1000},
+		{Path: "/etc/hosts", Size: 15},
+		{Path: "/opt", Deleted: true},
+		{Path: "/usr", Mode: 0755},
+		{Path: "/usr/b", Size: 2},
+	}
+	b := &filemanifest.Manifest{
+		Layers: []filemanifest.Layer{{Digest: d1, Files: base}, {Digest: d2, Files: top}},
+		Files:  filemanifest.Merge(base, top),
+	}
+
+	require.Equal(t, []FileChange{
+		{Path: "/etc", Change: Changed, Layer: d2},
+		{Path: "/etc/hosts", Change: Changed, SizeA: 9, SizeB: 15, Layer: d2},
+		{Path: "/opt", Change: Removed, Layer: d2},
+		{Path: "/opt/a", Change: Removed, SizeA: 1, Layer: d2},
+		{Path: "/usr", Change: Added, Layer: d2},
+		{Path: "/usr/b", Change: Added, SizeB: 2, Layer: d2},
+	}, Files(a, b))
+}
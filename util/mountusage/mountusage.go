@@ -0,0 +1,190 @@
+// Package mountusage tracks the writable mounts of the running exec steps so
+// that their disk usage can be inspected while the steps are still running.
+package mountusage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// Ref is a writable mount whose current disk usage can be queried
+type Ref interface {
+	ID() string
+	CurrentSize(context.Context) (int64, error)
+}
+
+// Mount is a writable mount of a running step
+type Mount struct {
+	Ref  Ref
+	Dest string
+	// Type is the type of the mount, e.g. "bind" or "cache"
+	Type string
+}
+
+// Step is the info about a running step registered with Register
+type Step struct {
+	Vertex   digest.Digest
+	Name     string
+	Sessions []string
+	Mounts   []Mount
+}
+
+// Usage is the disk usage of a mount of a running step
+type Usage struct {
+	Vertex   digest.Digest `json:"vertex"`
+	Name     string        `json:"name"`
+	Sessions []string      `json:"sessions,omitempty"`
+	Dest     string        `json:"dest"`
+	Type     string        `json:"type"`
+	ID       string        `json:"id"`
+	Size     int64         `json:"size"`
+	// Delta is the growth of the mount since the previous listing
+	Delta   int64         `json:"delta"`
+	Elapsed time.Duration `json:"elapsed"`
+	Running time.Duration `json:"running"`
+	Error   string        `json:"error,omitempty"`
+}
+
+type record struct {
+	Step
+	started time.Time
+	// last sizes and times of the mounts from the previous listing
+	sizes []int64
+	times []time.Time
+}
+
+// Registry is the set of running steps
+type Registry struct {
+	mu    sync.Mutex
+	steps map[*record]struct{}
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{steps: map[*record]struct{}{}}
+}
+
+// Default is the registry of the exec steps of the daemon
+var Default = NewRegistry()
+
+// Register adds a running step to the registry. The returned function
+// removes it again and has to be called before the mounts are released.
+func (r *Registry) Register(s Step) func() {
+	rec := &record{
+		Step:    s,
+		started: time.Now(),
+		sizes:   make([]int64, len(s.Mounts)),
+		times:   make([]time.Time, len(s.Mounts)),
+	}
+	for i := range rec.times {
+		rec.times[i] = rec.started
+	}
+	r.mu.Lock()
+	r.steps[rec] = struct{}{}
+	r.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			delete(r.steps, rec)
+			r.mu.Unlock()
+		})
+	}
+}
+
+// List returns the current disk usage of the mounts of all running steps,
+// largest first
+func (r *Registry) List(ctx context.Context) []Usage {
+	r.mu.Lock()
+	recs := make([]*record, 0, len(r.steps))
+	for rec := range r.steps {
+		recs = append(recs, rec)
+	}
+	r.mu.Unlock()
+
+	out := []Usage{}
+	for _, rec := range recs {
+		for i, m := range rec.Mounts {
+			u := Usage{
+				Vertex:   rec.Vertex,
+				Name:     rec.Name,
+				Sessions: rec.Sessions,
+				Dest:     m.Dest,
+				Type:     m.Type,
+				ID:       m.Ref.ID(),
+			}
+			size, err := m.Ref.CurrentSize(ctx)
+			now := time.Now()
+			u.Running = now.Sub(rec.started)
+			if err != nil {
+				u.Error = err.Error()
+				out = append(out, u)
+				continue
+			}
+			r.mu.Lock()
+			u.Size = size
+			u.Delta = size - rec.sizes[i]
+			u.Elapsed = now.Sub(rec.times[i])
+			rec.sizes[i] = size
+			rec.times[i] = now
+			r.mu.Unlock()
+			out = append(out, u)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Size != out[j].Size {
+			return out[i].Size > out[j].Size
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Handler returns a handler writing the listing of r as JSON. With the
+// "watch" query parameter set to a duration a new listing is written on every
+// interval until the client goes away.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var interval time.Duration
+		if v := req.URL.Query().Get("watch"); v != "" {
+			var err error
+			interval, err = time.ParseDuration(v)
+			if err != nil {
+				if secs, err2 := strconv.Atoi(v); err2 == nil {
+					interval, err = time.Duration(secs)*time.Second, nil
+				}
+			}
+			if err != nil || interval <= 0 {
+				http.Error(rw, "invalid watch interval "+strconv.Quote(v), http.StatusBadRequest)
+				return
+			}
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(rw)
+		enc.SetIndent("", "  ")
+		ctx := req.Context()
+		for {
+			if err := enc.Encode(r.List(ctx)); err != nil {
+				return
+			}
+			if interval == 0 {
+				return
+			}
+			if f, ok := rw.(http.Flusher); ok {
+				f.Flush()
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	})
+}
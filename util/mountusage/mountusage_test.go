@@ -0,0 +1,85 @@
+package mountusage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type testRef struct {
+	id   string
+	size int64
+	err  error
+}
+
+func (r *testRef) ID() string {
+	return r.id
+}
+
+func (r *testRef) CurrentSize(context.Context) (int64, error) {
+	return r.size, r.err
+}
+
+func TestList(t *testing.T) {
+	r := NewRegistry()
+	require.Equal(t, []Usage{}, r.List(context.TODO()))
+
+	root := &testRef{id: "root", size: 10}
+	cache := &testRef{id: "cache", size: 100}
+	done := r.Register(Step{
+		Vertex:   "sha256:aaa",
+		Name:     "RUN make",
+		Sessions: []string{"s1"},
+		Mounts: []Mount{
+			{Ref: root, Dest: "/", Type: "bind"},
+			{Ref: cache, Dest: "/root/.cache", Type: "cache"},
+		},
+	})
+	broken := r.Register(Step{
+		Name:   "RUN true",
+		Mounts: []Mount{{Ref: &testRef{id: "broken", err: errors.New("gone")}, Dest: "/"}},
+	})
+
+	l := r.List(context.TODO())
+	require.Len(t, l, 3)
+	require.Equal(t, "cache", l[0].ID)
+	require.Equal(t, int64(100), l[0].Delta)
+	require.Equal(t, "/root/.cache", l[0].Dest)
+	require.Equal(t, []string{"s1"}, l[0].Sessions)
+	require.Equal(t, "root", l[1].ID)
+	require.Equal(t, "broken", l[2].ID)
+	require.Equal(t, "gone", l[2].Error)
+
+	root.size = 500
+	l = r.List(context.TODO())
+	require.Equal(t, "root", l[0].ID)
+	require.Equal(t, int64(500), l[0].Size)
+	require.Equal(t, int64(490), l[0].Delta)
+	require.Equal(t, int64(0), l[1].Delta)
+
+	broken()
+	done()
+	done()
+	require.Equal(t, []Usage{}, r.List(context.TODO()))
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	defer r.Register(Step{Name: "RUN make", Mounts: []Mount{{Ref: &testRef{id: "root", size: 42}, Dest: "/"}}})()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/mounts", nil))
+	require.Equal(t, 200, rec.Code)
+	var l []Usage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &l))
+	require.Len(t, l, 1)
+	require.Equal(t, int64(42), l[0].Size)
+
+	rec = httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/mounts?watch=foo", nil))
+	require.Equal(t, 400, rec.Code)
+}
@@ -0,0 +1,159 @@
+// Package netcheck checks connectivity to network endpoints separately for
+// each IP family and with the happy eyeballs dialing the daemon uses. It
+// helps diagnosing IPv6-only and dual-stack setups where an endpoint may
+// only be reachable over one of the families.
+package netcheck
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Family is an IP address family
+type Family string
+
+const (
+	IPv4 Family = "ipv4"
+	IPv6 Family = "ipv6"
+	// Dual races both families like the daemon does when it connects to
+	// registries and sources (RFC 6555 happy eyeballs)
+	Dual Family = "dual"
+)
+
+// Families lists all checked address families
+var Families = []Family{IPv4, IPv6}
+
+// DefaultEndpoints are checked if no endpoints are requested
+var DefaultEndpoints = []string{
+	"registry-1.docker.io:443",
+	"auth.docker.io:443",
+	"github.com:443",
+}
+
+// FallbackDelay is how long the happy eyeballs dial waits for the preferred
+// family before it also tries the other one
+const FallbackDelay = 300 * time.Millisecond
+
+// Dialer returns the dialer of the daemon for registries and sources. It
+// races both families with FallbackDelay, so that endpoints that are only
+// reachable over one of them don't wait for the timeout of the other one.
+func Dialer(timeout, keepAlive time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout:       timeout,
+		KeepAlive:     keepAlive,
+		FallbackDelay: FallbackDelay,
+	}
+}
+
+// Normalize returns endpoint in the form host:port, defaulting to port 443
+func Normalize(endpoint string) string {
+	if _, _, err := net.SplitHostPort(endpoint); err == nil {
+		return endpoint
+	}
+	return net.JoinHostPort(strings.Trim(endpoint, "[]"), "443")
+}
+
+func (f Family) network(proto string) string {
+	if f == IPv6 {
+		return proto + "6"
+	}
+	return proto + "4"
+}
+
+// Result is the result of checking an endpoint over a single address family
+type Result struct {
+	Endpoint  string
+	Family    Family
+	Addresses []net.IP
+	Latency   time.Duration
+	Err       error
+}
+
+// Reachable returns true if a connection could be established
+func (r Result) Reachable() bool {
+	return r.Err == nil
+}
+
+// Check resolves the endpoint and tries to open a TCP connection to it over
+// every address family and with happy eyeballs over both families. The
+// results are in the order of Families followed by the Dual result.
+// endpoint is in the form host[:port] and defaults to port 443.
+func Check(ctx context.Context, endpoint string, timeout time.Duration) []Result {
+	host, port, err := net.SplitHostPort(Normalize(endpoint))
+	if err != nil {
+		return []Result{{Endpoint: endpoint, Family: Dual, Err: err}}
+	}
+	out := make([]Result, len(Families)+1)
+	var wg sync.WaitGroup
+	for i, f := range Families {
+		wg.Add(1)
+		go func(i int, f Family) {
+			defer wg.Done()
+			out[i] = check(ctx, endpoint, host, port, f, timeout)
+		}(i, f)
+	}
+	out[len(Families)] = checkDual(ctx, endpoint, host, port, timeout)
+	wg.Wait()
+	return out
+}
+
+// checkDual dials the endpoint with the fast fallback of net.Dialer and
+// reports the address that won the race
+func checkDual(ctx context.Context, endpoint, host, port string, timeout time.Duration) Result {
+	res := Result{Endpoint: endpoint, Family: Dual}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	d := Dialer(0, 0)
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Latency = time.Since(start)
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		res.Addresses = []net.IP{addr.IP}
+	}
+	conn.Close()
+	return res
+}
+
+func check(ctx context.Context, endpoint, host, port string, f Family, timeout time.Duration) Result {
+	res := Result{Endpoint: endpoint, Family: f}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, f.network("ip"), host)
+	if err != nil {
+		res.Err = errors.Wrapf(err, "failed to resolve %s", host)
+		return res
+	}
+	res.Addresses = ips
+	if len(ips) == 0 {
+		res.Err = errors.Errorf("no %s address for %s", f, host)
+		return res
+	}
+
+	var d net.Dialer
+	for _, ip := range ips {
+		start := time.Now()
+		conn, err := d.DialContext(ctx, f.network("tcp"), net.JoinHostPort(ip.String(), port))
+		if err != nil {
+			res.Err = err
+			continue
+		}
+		res.Latency = time.Since(start)
+		res.Err = nil
+		conn.Close()
+		break
+	}
+	return res
+}
@@ -0,0 +1,49 @@
+package netcheck
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLoopback(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	res := Check(context.TODO(), l.Addr().String(), 5*time.Second)
+	require.Equal(t, 3, len(res))
+
+	require.Equal(t, IPv4, res[0].Family)
+	require.True(t, res[0].Reachable())
+	require.Equal(t, 1, len(res[0].Addresses))
+
+	// a v4 literal has no v6 address
+	require.Equal(t, IPv6, res[1].Family)
+	require.False(t, res[1].Reachable())
+
+	require.Equal(t, Dual, res[2].Family)
+	require.True(t, res[2].Reachable())
+	require.Equal(t, []net.IP{net.ParseIP("127.0.0.1").To4()}, res[2].Addresses)
+}
+
+func TestNormalize(t *testing.T) {
+	require.Equal(t, "github.com:443", Normalize("github.com"))
+	require.Equal(t, "github.com:22", Normalize("github.com:22"))
+	require.Equal(t, "[::1]:443", Normalize("::1"))
+	require.Equal(t, "[::1]:443", Normalize("[::1]"))
+	require.Equal(t, "[::1]:5000", Normalize("[::1]:5000"))
+}
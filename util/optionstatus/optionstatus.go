@@ -0,0 +1,149 @@
+// Package optionstatus is the registry of the stability of the attribute
+// keys of exporters and frontends. Keys that are not registered are stable.
+// Using a deprecated key produces a warning and experimental keys are only
+// accepted if the daemon enables experimental options.
+package optionstatus
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type Status string
+
+const (
+	Stable       Status = "stable"
+	Experimental Status = "experimental"
+	Deprecated   Status = "deprecated"
+)
+
+// Option is the status of an attribute key
+type Option struct {
+	// Key is the attribute key. Keys of prefix attributes end with a
+	// placeholder, e.g. "annotation.<key>".
+	Key    string
+	Status Status
+	// Replacement is the key to use instead of a deprecated key
+	Replacement string
+	// Message is additional information for users of the key
+	Message string
+}
+
+// Exporter returns the scope of the attributes of the exporter type
+func Exporter(typ string) string {
+	return "exporter " + typ
+}
+
+// Frontend returns the scope of the attributes of the frontend
+func Frontend(name string) string {
+	return "frontend " + name
+}
+
+var (
+	mu   sync.RWMutex
+	keys = map[string][]Option{
+		Exporter("image"): {
+			{Key: "delta", Status: Experimental, Message: "the delta format may change between releases"},
+		},
+		Frontend("dockerfile.v0"): {
+			{Key: "cache-from", Status: Deprecated, Replacement: "cache-imports"},
+			{Key: "override-copy-image", Status: Deprecated, Message: "COPY is run with file operations of the daemon"},
+		},
+	}
+)
+
+// Register sets the status of the keys of the scope, e.g. for exporters and
+// frontends added by daemons embedding buildkit
+func Register(scope string, opts ...Option) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, k := range opts {
+		replaced := false
+		for i, existing := range keys[scope] {
+			if existing.Key == k.Key {
+				keys[scope][i] = k
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			keys[scope] = append(keys[scope], k)
+		}
+	}
+}
+
+// Lookup returns the status of the attribute key of the scope. Keys matching
+// no registered key are stable.
+func Lookup(scope, key string) Option {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, k := range keys[scope] {
+		if k.Key == key {
+			return k
+		}
+		if i := strings.Index(k.Key, "<"); i > 0 && strings.HasPrefix(key, k.Key[:i]) {
+			return k
+		}
+	}
+	return Option{Key: key, Status: Stable}
+}
+
+// Warning is produced for a deprecated attribute of a request
+type Warning struct {
+	Scope string
+	Option
+}
+
+func (w Warning) String() string {
+	s := fmt.Sprintf("attribute %q of %s is %s", w.Key, w.Scope, w.Status)
+	if w.Replacement != "" {
+		s += fmt.Sprintf(", use %q instead", w.Replacement)
+	}
+	if w.Message != "" {
+		s += ": " + w.Message
+	}
+	return s
+}
+
+// ExperimentalError is returned for experimental attributes while
+// experimental options are disabled
+type ExperimentalError struct {
+	Scope string
+	Option
+}
+
+func (e *ExperimentalError) Error() string {
+	s := fmt.Sprintf("attribute %q of %s is experimental and requires experimental-options to be enabled in the daemon", e.Key, e.Scope)
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	return s
+}
+
+// Check returns warnings for the deprecated attributes of attrs. Experimental
+// attributes return an ExperimentalError unless experimental is set.
+func Check(scope string, attrs map[string]string, experimental bool) ([]Warning, error) {
+	names := make([]string, 0, len(attrs))
+	for k := range attrs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var warnings []Warning
+	for _, name := range names {
+		k := Lookup(scope, name)
+		switch k.Status {
+		case Experimental:
+			if !experimental {
+				return nil, errors.WithStack(&ExperimentalError{Scope: scope, Option: k})
+			}
+		case Deprecated:
+			warnings = append(warnings, Warning{Scope: scope, Option: k})
+		}
+	}
+	return warnings, nil
+}
@@ -0,0 +1,37 @@
+package optionstatus
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	scope := Exporter("test")
+	Register(scope,
+		Option{Key: "old", Status: Deprecated, Replacement: "new"},
+		Option{Key: "preview.<key>", Status: Experimental},
+	)
+
+	warnings, err := Check(scope, map[string]string{"old": "1", "new": "1"}, false)
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	require.Equal(t, "old", warnings[0].Key)
+	require.Equal(t, `attribute "old" of exporter test is deprecated, use "new" instead`, warnings[0].String())
+
+	_, err = Check(scope, map[string]string{"preview.foo": "1"}, false)
+	require.Error(t, err)
+	var experr *ExperimentalError
+	require.True(t, errors.As(err, &experr))
+	require.Equal(t, "preview.<key>", experr.Key)
+
+	warnings, err = Check(scope, map[string]string{"preview.foo": "1"}, true)
+	require.NoError(t, err)
+	require.Len(t, warnings, 0)
+
+	// registering a key again replaces its status
+	Register(scope, Option{Key: "old", Status: Stable})
+	require.Equal(t, Stable, Lookup(scope, "old").Status)
+	require.Equal(t, Stable, Lookup(Frontend("unknown"), "old").Status)
+}
@@ -0,0 +1,132 @@
+// Package overlay creates the diffs of overlayfs snapshots from their
+// upperdir. The upperdir of a snapshot contains exactly the changes to its
+// parent, so the diff doesn't need to walk and compare both filesystems.
+package overlay
+
+import (
+	"strings"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/diff"
+	"github.com/containerd/containerd/mount"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DifferAuto creates diffs from the upperdir if the mounts are overlays
+	// and the kernel doesn't store renames or metadata-only copies in the
+	// upperdir
+	DifferAuto = "auto"
+	// DifferOverlayfs creates diffs from the upperdir whenever the mounts
+	// are overlays, without checking the overlayfs features of the kernel
+	DifferOverlayfs = "overlayfs"
+	// DifferWalking always walks and compares both filesystems
+	DifferWalking = "walking"
+)
+
+// NewDiffer returns the differ for mode, which falls back to d if a diff
+// can't be created from the upperdir
+func NewDiffer(mode string, store content.Store, d diff.Comparer) (diff.Comparer, error) {
+	switch mode {
+	case "", DifferAuto:
+		return newDiffer(store, d, true), nil
+	case DifferOverlayfs:
+		return newDiffer(store, d, false), nil
+	case DifferWalking:
+		return d, nil
+	default:
+		return nil, errors.Errorf("invalid differ %q, expected %s, %s or %s", mode, DifferAuto, DifferOverlayfs, DifferWalking)
+	}
+}
+
+// upperdirOf returns the upperdir of upper if upper is an overlay of the
+// layers of lower with one additional layer on top. Read-only overlays have
+// the upperdir of their snapshot as first lowerdir.
+func upperdirOf(lower, upper []mount.Mount) (dir string, userxattr bool, ok bool) {
+	if len(lower) != 1 || len(upper) != 1 || upper[0].Type != "overlay" {
+		return "", false, false
+	}
+	upperLayers, opts := overlayLayers(upper[0])
+	userxattr, ok = upperdirOpts(opts)
+	if !ok {
+		return "", false, false
+	}
+
+	var lowerLayers []string
+	switch lower[0].Type {
+	case "bind":
+		lowerLayers = []string{lower[0].Source}
+	case "overlay":
+		lowerLayers, _ = overlayLayers(lower[0])
+	default:
+		return "", false, false
+	}
+
+	if len(upperLayers) != len(lowerLayers)+1 {
+		return "", false, false
+	}
+	for i, l := range lowerLayers {
+		if upperLayers[i+1] != l {
+			return "", false, false
+		}
+	}
+	return upperLayers[0], userxattr, true
+}
+
+// writableUpperdir returns the upperdir of m if it is a writable overlay
+func writableUpperdir(m []mount.Mount) (dir string, userxattr bool, ok bool) {
+	if len(m) != 1 || m[0].Type != "overlay" {
+		return "", false, false
+	}
+	for _, o := range m[0].Options {
+		if strings.HasPrefix(o, "upperdir=") {
+			dir = strings.TrimPrefix(o, "upperdir=")
+		}
+	}
+	if dir == "" {
+		return "", false, false
+	}
+	_, opts := overlayLayers(m[0])
+	userxattr, ok = upperdirOpts(opts)
+	if !ok {
+		return "", false, false
+	}
+	return dir, userxattr, true
+}
+
+// upperdirOpts returns false if the overlay options make the upperdir an
+// incomplete diff, see kernelSafe
+func upperdirOpts(opts []string) (userxattr bool, ok bool) {
+	for _, o := range opts {
+		switch {
+		case o == "userxattr":
+			userxattr = true
+		case strings.HasPrefix(o, "metacopy=") && o != "metacopy=off":
+			return false, false
+		case strings.HasPrefix(o, "redirect_dir=") && o != "redirect_dir=off":
+			return false, false
+		}
+	}
+	return userxattr, true
+}
+
+// overlayLayers returns the layer directories of an overlay mount from the
+// top and the options other than the directories
+func overlayLayers(m mount.Mount) (layers []string, opts []string) {
+	var upper string
+	for _, o := range m.Options {
+		switch {
+		case strings.HasPrefix(o, "upperdir="):
+			upper = strings.TrimPrefix(o, "upperdir=")
+		case strings.HasPrefix(o, "lowerdir="):
+			layers = strings.Split(strings.TrimPrefix(o, "lowerdir="), ":")
+		case strings.HasPrefix(o, "workdir="):
+		default:
+			opts = append(opts, o)
+		}
+	}
+	if upper != "" {
+		layers = append([]string{upper}, layers...)
+	}
+	return layers, opts
+}
@@ -0,0 +1,340 @@
+package overlay
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/diff"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/continuity/sysx"
+	"github.com/moby/buildkit/util/bklog"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = whiteoutPrefix + whiteoutPrefix + ".opq"
+	uncompressed   = "containerd.io/uncompressed"
+)
+
+var emptyDesc = ocispecs.Descriptor{}
+
+type overlayDiffer struct {
+	store content.Store
+	d     diff.Comparer
+	// checkKernel falls back to d if the kernel may store renamed
+	// directories or metadata-only copies in the upperdir
+	checkKernel bool
+}
+
+func newDiffer(store content.Store, d diff.Comparer, checkKernel bool) diff.Comparer {
+	return &overlayDiffer{store: store, d: d, checkKernel: checkKernel}
+}
+
+// Compare creates the diff of upper from its upperdir if upper is an overlay
+// of lower and uploads the result to the content store
+func (s *overlayDiffer) Compare(ctx context.Context, lower, upper []mount.Mount, opts ...diff.Opt) (ocispecs.Descriptor, error) {
+	upperdir, userxattr, ok := upperdirOf(lower, upper)
+	if ok && s.checkKernel && !kernelSafe() {
+		ok = false
+	}
+	if !ok {
+		return s.d.Compare(ctx, lower, upper, opts...)
+	}
+
+	var config diff.Config
+	for _, opt := range opts {
+		if err := opt(&config); err != nil {
+			return emptyDesc, err
+		}
+	}
+	if config.MediaType == "" {
+		config.MediaType = ocispecs.MediaTypeImageLayerGzip
+	}
+	var isCompressed bool
+	switch config.MediaType {
+	case ocispecs.MediaTypeImageLayer:
+	case ocispecs.MediaTypeImageLayerGzip:
+		isCompressed = true
+	default:
+		return emptyDesc, errors.Wrapf(errdefs.ErrNotImplemented, "unsupported diff media type: %v", config.MediaType)
+	}
+
+	var ocidesc ocispecs.Descriptor
+	if err := mount.WithTempMount(ctx, upper, func(upperRoot string) (err error) {
+		var newReference bool
+		if config.Reference == "" {
+			newReference = true
+			config.Reference = uniqueRef()
+		}
+		cw, err := s.store.Writer(ctx,
+			content.WithRef(config.Reference),
+			content.WithDescriptor(ocispecs.Descriptor{MediaType: config.MediaType}))
+		if err != nil {
+			return errors.Wrap(err, "failed to open writer")
+		}
+		defer func() {
+			if err != nil {
+				cw.Close()
+				if newReference {
+					if abortErr := s.store.Abort(ctx, config.Reference); abortErr != nil {
+						bklog.G(ctx).WithError(abortErr).WithField("ref", config.Reference).Warnf("failed to delete diff upload")
+					}
+				}
+			}
+		}()
+		if !newReference {
+			if err := cw.Truncate(0); err != nil {
+				return err
+			}
+		}
+
+		if config.Labels == nil {
+			config.Labels = map[string]string{}
+		}
+		if isCompressed {
+			dgstr := digest.SHA256.Digester()
+			compressed, err := compression.CompressStream(cw, compression.Gzip)
+			if err != nil {
+				return errors.Wrap(err, "failed to get compressed stream")
+			}
+			err = WriteUpperdir(ctx, io.MultiWriter(compressed, dgstr.Hash()), upperdir, upperRoot, userxattr)
+			compressed.Close()
+			if err != nil {
+				return errors.Wrap(err, "failed to write compressed diff")
+			}
+			config.Labels[uncompressed] = dgstr.Digest().String()
+		} else {
+			if err := WriteUpperdir(ctx, cw, upperdir, upperRoot, userxattr); err != nil {
+				return errors.Wrap(err, "failed to write diff")
+			}
+			config.Labels[uncompressed] = cw.Digest().String()
+		}
+
+		dgst := cw.Digest()
+		if err := cw.Commit(ctx, 0, dgst, content.WithLabels(config.Labels)); err != nil {
+			if !errdefs.IsAlreadyExists(err) {
+				return errors.Wrap(err, "failed to commit")
+			}
+		}
+		info, err := s.store.Info(ctx, dgst)
+		if err != nil {
+			return errors.Wrap(err, "failed to get info from content store")
+		}
+		if _, ok := info.Labels[uncompressed]; !ok {
+			if info.Labels == nil {
+				info.Labels = map[string]string{}
+			}
+			info.Labels[uncompressed] = config.Labels[uncompressed]
+			if _, err := s.store.Update(ctx, info, "labels."+uncompressed); err != nil {
+				return errors.Wrap(err, "error setting uncompressed label")
+			}
+		}
+		ocidesc = ocispecs.Descriptor{
+			MediaType: config.MediaType,
+			Size:      info.Size,
+			Digest:    info.Digest,
+		}
+		return nil
+	}); err != nil {
+		return emptyDesc, err
+	}
+	return ocidesc, nil
+}
+
+// WriteUpperdir writes the changes in the overlayfs upperdir as a tar stream
+// with OCI whiteouts. File contents are read from the mounted overlay root,
+// so that the diff is complete even if the upperdir only contains the
+// metadata of copied up files.
+func WriteUpperdir(ctx context.Context, w io.Writer, upperdir, root string, userxattr bool) error {
+	opaqueXattr := "trusted.overlay.opaque"
+	if userxattr {
+		opaqueXattr = "user.overlay.opaque"
+	}
+	whiteoutT := time.Now()
+	links := map[uint64]string{}
+	tw := tar.NewWriter(w)
+
+	err := filepath.Walk(upperdir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(upperdir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		name := filepath.ToSlash(rel)
+
+		st, _ := fi.Sys().(*syscall.Stat_t)
+		if fi.Mode()&os.ModeCharDevice != 0 && st != nil && st.Rdev == 0 {
+			dir, base := filepath.Split(name)
+			return tw.WriteHeader(&tar.Header{
+				Typeflag:   tar.TypeReg,
+				Name:       dir + whiteoutPrefix + base,
+				ModTime:    whiteoutT,
+				AccessTime: whiteoutT,
+				ChangeTime: whiteoutT,
+			})
+		}
+		if fi.Mode()&os.ModeSocket != 0 {
+			return nil
+		}
+
+		var link string
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Format = tar.FormatPAX
+		hdr.ModTime = hdr.ModTime.Truncate(time.Second)
+		hdr.AccessTime = time.Time{}
+		hdr.ChangeTime = time.Time{}
+		// the names of the daemon's users aren't the names in the image
+		hdr.Uname = ""
+		hdr.Gname = ""
+		hdr.Name = name
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if st != nil && st.Nlink > 1 && fi.Mode().IsRegular() {
+			if source, ok := links[st.Ino]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = source
+				hdr.Size = 0
+			} else {
+				links[st.Ino] = hdr.Name
+			}
+		}
+		if err := setXattrs(hdr, p); err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return errors.Wrapf(err, "failed to write header of %s", name)
+		}
+
+		if fi.IsDir() {
+			if opaque, err := sysx.LGetxattr(p, opaqueXattr); err == nil && string(opaque) == "y" {
+				return tw.WriteHeader(&tar.Header{
+					Typeflag:   tar.TypeReg,
+					Name:       hdr.Name + whiteoutOpaque,
+					ModTime:    whiteoutT,
+					AccessTime: whiteoutT,
+					ChangeTime: whiteoutT,
+				})
+			}
+			return nil
+		}
+		if hdr.Typeflag == tar.TypeReg && hdr.Size > 0 {
+			f, err := os.Open(filepath.Join(root, rel))
+			if err != nil {
+				return errors.Wrapf(err, "failed to open %s", name)
+			}
+			defer f.Close()
+			n, err := io.Copy(tw, io.LimitReader(f, hdr.Size))
+			if err != nil {
+				return errors.Wrapf(err, "failed to copy %s", name)
+			}
+			if n != hdr.Size {
+				return errors.Errorf("short write copying %s", name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// setXattrs adds the extended attributes of p to hdr, except the ones of
+// overlayfs itself
+func setXattrs(hdr *tar.Header, p string) error {
+	keys, err := sysx.LListxattr(p)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to list xattrs of %s", p)
+	}
+	for _, k := range keys {
+		if strings.HasPrefix(k, "trusted.overlay.") || strings.HasPrefix(k, "user.overlay.") {
+			continue
+		}
+		v, err := sysx.LGetxattr(p, k)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get xattr %s of %s", k, p)
+		}
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = map[string]string{}
+		}
+		hdr.PAXRecords["SCHILY.xattr."+k] = string(v)
+	}
+	return nil
+}
+
+var (
+	kernelSafeOnce sync.Once
+	kernelSafeRes  bool
+)
+
+// kernelSafe returns true if overlayfs doesn't store renamed directories or
+// metadata-only copies in the upperdir by default. Both need the lower
+// layers to read the changes, so the upperdir alone isn't a complete diff.
+func kernelSafe() bool {
+	kernelSafeOnce.Do(func() {
+		kernelSafeRes = true
+		for _, param := range []string{"metacopy", "redirect_dir"} {
+			dt, err := ioutil.ReadFile(filepath.Join("/sys/module/overlay/parameters", param))
+			if err != nil || strings.TrimSpace(string(dt)) != "N" {
+				kernelSafeRes = false
+			}
+		}
+	})
+	return kernelSafeRes
+}
+
+func uniqueRef() string {
+	t := time.Now()
+	var b [3]byte
+	// Ignore read failures, just decreases uniqueness
+	rand.Read(b[:])
+	return fmt.Sprintf("%d-%s", t.UnixNano(), base64.URLEncoding.EncodeToString(b[:]))
+}
+
+// Upperdir returns the upperdir of the writable overlay mount m if it
+// contains all changes to the lower layers, so that WriteUpperdir writes a
+// complete diff of m
+func Upperdir(m []mount.Mount) (dir string, userxattr bool, ok bool) {
+	if !kernelSafe() {
+		return "", false, false
+	}
+	return writableUpperdir(m)
+}
@@ -0,0 +1,64 @@
+package overlay
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestWriteUpperdir(t *testing.T) {
+	upperdir := t.TempDir()
+	root := t.TempDir()
+	for _, dir := range []string{upperdir, root} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "etc"), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "etc/hosts"), []byte("localhost"), 0644))
+		require.NoError(t, os.Link(filepath.Join(dir, "etc/hosts"), filepath.Join(dir, "etc/hosts.bak")))
+		require.NoError(t, os.Symlink("hosts", filepath.Join(dir, "etc/hosts.link")))
+	}
+	whiteout := unix.Mknod(filepath.Join(upperdir, "etc/passwd"), unix.S_IFCHR, 0) == nil
+	xattrs := unix.Lsetxattr(filepath.Join(upperdir, "etc/hosts"), "user.foo", []byte("bar"), 0) == nil &&
+		unix.Lsetxattr(filepath.Join(upperdir, "etc"), "user.overlay.origin", []byte("x"), 0) == nil
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteUpperdir(context.TODO(), buf, upperdir, root, false))
+
+	files := map[string]*tar.Header{}
+	tr := tar.NewReader(buf)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if h.Name == "etc/hosts" {
+			dt, err := ioutil.ReadAll(tr)
+			require.NoError(t, err)
+			require.Equal(t, "localhost", string(dt))
+		}
+		files[h.Name] = h
+	}
+	require.Equal(t, byte(tar.TypeDir), files["etc/"].Typeflag)
+	require.Equal(t, byte(tar.TypeLink), files["etc/hosts.bak"].Typeflag)
+	require.Equal(t, "etc/hosts", files["etc/hosts.bak"].Linkname)
+	require.Equal(t, "hosts", files["etc/hosts.link"].Linkname)
+	for _, h := range files {
+		require.Equal(t, "", h.Uname)
+		require.Equal(t, "", h.Gname)
+	}
+	if xattrs {
+		require.Equal(t, "bar", files["etc/hosts"].PAXRecords["SCHILY.xattr.user.foo"])
+		require.NotContains(t, files["etc/"].PAXRecords, "SCHILY.xattr.user.overlay.origin")
+	}
+	if whiteout {
+		require.Contains(t, files, "etc/.wh.passwd")
+		require.NotContains(t, files, "etc/passwd")
+	}
+}
@@ -0,0 +1,27 @@
+// +build !linux
+
+package overlay
+
+import (
+	"context"
+	"io"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/diff"
+	"github.com/containerd/containerd/mount"
+	"github.com/pkg/errors"
+)
+
+func newDiffer(store content.Store, d diff.Comparer, checkKernel bool) diff.Comparer {
+	return d
+}
+
+// Upperdir returns false as overlayfs is only supported on Linux
+func Upperdir(m []mount.Mount) (dir string, userxattr bool, ok bool) {
+	return "", false, false
+}
+
+// WriteUpperdir is only supported on Linux
+func WriteUpperdir(ctx context.Context, w io.Writer, upperdir, root string, userxattr bool) error {
+	return errors.New("overlayfs is only supported on Linux")
+}
@@ -0,0 +1,61 @@
+package overlay
+
+import (
+	"testing"
+
+	"github.com/containerd/containerd/mount"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpperdirOf(t *testing.T) {
+	bind := []mount.Mount{{Type: "bind", Source: "/s/1/fs", Options: []string{"ro", "rbind"}}}
+	ro := []mount.Mount{{Type: "overlay", Source: "overlay", Options: []string{"lowerdir=/s/2/fs:/s/1/fs", "index=off"}}}
+
+	dir, userxattr, ok := upperdirOf(bind, ro)
+	require.True(t, ok)
+	require.False(t, userxattr)
+	require.Equal(t, "/s/2/fs", dir)
+
+	rw := []mount.Mount{{Type: "overlay", Source: "overlay", Options: []string{"workdir=/s/3/work", "upperdir=/s/3/fs", "lowerdir=/s/2/fs:/s/1/fs", "userxattr"}}}
+	dir, userxattr, ok = upperdirOf(ro, rw)
+	require.True(t, ok)
+	require.True(t, userxattr)
+	require.Equal(t, "/s/3/fs", dir)
+
+	// upper is not based on lower
+	_, _, ok = upperdirOf(bind, rw)
+	require.False(t, ok)
+	// no parent
+	_, _, ok = upperdirOf(nil, bind)
+	require.False(t, ok)
+	// the upperdir isn't a complete diff with redirected directories
+	redirect := []mount.Mount{{Type: "overlay", Options: []string{"lowerdir=/s/2/fs:/s/1/fs", "redirect_dir=on"}}}
+	_, _, ok = upperdirOf(bind, redirect)
+	require.False(t, ok)
+}
+
+func TestWritableUpperdir(t *testing.T) {
+	rw := []mount.Mount{{Type: "overlay", Source: "overlay", Options: []string{"workdir=/s/3/work", "upperdir=/s/3/fs", "lowerdir=/s/2/fs:/s/1/fs", "userxattr"}}}
+	dir, userxattr, ok := writableUpperdir(rw)
+	require.True(t, ok)
+	require.True(t, userxattr)
+	require.Equal(t, "/s/3/fs", dir)
+
+	// read-only
+	_, _, ok = writableUpperdir([]mount.Mount{{Type: "overlay", Options: []string{"lowerdir=/s/2/fs:/s/1/fs"}}})
+	require.False(t, ok)
+	// no layers, e.g. the native snapshotter
+	_, _, ok = writableUpperdir([]mount.Mount{{Type: "bind", Source: "/s/3/fs", Options: []string{"rbind"}}})
+	require.False(t, ok)
+	_, _, ok = writableUpperdir([]mount.Mount{{Type: "overlay", Options: []string{"workdir=/s/3/work", "upperdir=/s/3/fs", "lowerdir=/s/2/fs", "metacopy=on"}}})
+	require.False(t, ok)
+}
+
+func TestNewDiffer(t *testing.T) {
+	_, err := NewDiffer("native", nil, nil)
+	require.Error(t, err)
+	for _, mode := range []string{"", DifferAuto, DifferOverlayfs, DifferWalking} {
+		_, err := NewDiffer(mode, nil, nil)
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,48 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/identity"
+	"github.com/tonistiigi/units"
+)
+
+// FileLogger writes the path and size of every file of a transfer to the log
+// of the vertex of the context it was created with, so that unexpectedly
+// large files in a transfer can be found. The file lines are subject to the
+// same size and speed limits as the stdout stream of a step.
+type FileLogger struct {
+	name  string
+	sw    *streamWriter
+	mu    sync.Mutex
+	count int
+	size  int64
+}
+
+func NewFileLogger(ctx context.Context, name string) *FileLogger {
+	return &FileLogger{name: name, sw: newStreamWriter(ctx, stdout, false).(*streamWriter)}
+}
+
+// Add logs the file p with size bytes and the totals of the transfer so far
+func (fl *FileLogger) Add(p string, size int64) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	fl.count++
+	fl.size += size
+	fl.sw.Write([]byte(fmt.Sprintf("%s %s %#g (%d files, %#g)\n", fl.name, p, units.Bytes(size), fl.count, units.Bytes(fl.size))))
+}
+
+// Close logs the totals of the transfer. The totals are logged even if the
+// file lines were clipped.
+func (fl *FileLogger) Close() error {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	fl.sw.pw.Write(identity.NewID(), client.VertexLog{
+		Stream: stdout,
+		Data:   []byte(fmt.Sprintf("%s %d files, %#g total\n", fl.name, fl.count, units.Bytes(fl.size))),
+	})
+	return fl.sw.Close()
+}
@@ -0,0 +1,69 @@
+package logs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/util/progress"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileLogger(t *testing.T) {
+	pr, ctx, cancel := progress.NewContext(context.TODO())
+	defer cancel()
+
+	fl := NewFileLogger(ctx, "transferring context:")
+	fl.Add("a.txt", 1024)
+	fl.Add("b/c.bin", 2048)
+	require.NoError(t, fl.Close())
+	cancel()
+
+	require.Equal(t, []string{
+		"transferring context: a.txt 1KiB (1 files, 1KiB)",
+		"transferring context: b/c.bin 2KiB (2 files, 3KiB)",
+		"transferring context: 2 files, 3KiB total",
+	}, readLines(pr))
+}
+
+func TestFileLoggerLimit(t *testing.T) {
+	configCheckOnce.Do(func() {})
+	maxSize, maxSpeed := defaultMaxLogSize, defaultMaxLogSpeed
+	defer func() {
+		defaultMaxLogSize, defaultMaxLogSpeed = maxSize, maxSpeed
+	}()
+	defaultMaxLogSize, defaultMaxLogSpeed = 60, -1
+
+	pr, ctx, cancel := progress.NewContext(context.TODO())
+	defer cancel()
+
+	fl := NewFileLogger(ctx, "transferring context:")
+	fl.Add("a.txt", 1024)
+	fl.Add("b/c.bin", 2048)
+	fl.Add("d.txt", 1024)
+	require.NoError(t, fl.Close())
+	cancel()
+
+	require.Equal(t, []string{
+		"transferring context: a.txt 1KiB (1 files, 1KiB)",
+		"transferrin\n[output clipped, log limit 60B reached]",
+		"transferring context: 3 files, 4KiB total",
+	}, readLines(pr))
+}
+
+func readLines(pr progress.Reader) []string {
+	var lines []string
+	for {
+		ps, err := pr.Read(context.TODO())
+		if err != nil || len(ps) == 0 {
+			break
+		}
+		for _, p := range ps {
+			if l, ok := p.Sys.(client.VertexLog); ok {
+				lines = append(lines, strings.TrimSpace(string(l.Data)))
+			}
+		}
+	}
+	return lines
+}
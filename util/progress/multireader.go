@@ -3,6 +3,7 @@ package progress
 import (
 	"context"
 	"io"
+	"sort"
 	"sync"
 )
 
@@ -12,13 +13,39 @@ type MultiReader struct {
 	initialized bool
 	done        chan struct{}
 	writers     map[*progressWriter]func()
+	// sent is the latest progress of every ID, except for logs
+	sent map[string]*Progress
+	// logs are the latest logs of every vertex
+	logs    map[interface{}][]*Progress
+	isLog   func(*Progress) bool
+	logTail int
+	closed  bool
 }
 
-func NewMultiReader(pr Reader) *MultiReader {
+// MultiReaderOpt is an option for NewMultiReader
+type MultiReaderOpt func(*MultiReader)
+
+// WithLogTail limits the logs replayed to readers attaching late to the
+// last n items of every vertex. Logs are written with a new ID for every
+// chunk, so keeping all of them would grow with the log volume of the
+// build. isLog returns true for the progress items that are logs.
+func WithLogTail(n int, isLog func(*Progress) bool) MultiReaderOpt {
+	return func(mr *MultiReader) {
+		mr.logTail = n
+		mr.isLog = isLog
+	}
+}
+
+func NewMultiReader(pr Reader, opts ...MultiReaderOpt) *MultiReader {
 	mr := &MultiReader{
 		main:    pr,
 		writers: make(map[*progressWriter]func()),
 		done:    make(chan struct{}),
+		sent:    make(map[string]*Progress),
+		logs:    make(map[interface{}][]*Progress),
+	}
+	for _, o := range opts {
+		o(mr)
 	}
 	return mr
 }
@@ -31,6 +58,29 @@ func (mr *MultiReader) Reader(ctx context.Context) Reader {
 	pw, _, ctx := NewFromContext(ctx)
 
 	w := pw.(*progressWriter)
+
+	// replay the progress already sent so that readers attaching after the
+	// build has started see the complete state
+	plist := make([]*Progress, 0, len(mr.sent))
+	for _, p := range mr.sent {
+		plist = append(plist, p)
+	}
+	for _, logs := range mr.logs {
+		plist = append(plist, logs...)
+	}
+	sort.Slice(plist, func(i, j int) bool {
+		return plist[i].Timestamp.Before(plist[j].Timestamp)
+	})
+	for _, p := range plist {
+		w.writeRawProgress(p)
+	}
+
+	if mr.closed {
+		w.Close()
+		closeWriter()
+		return pr
+	}
+
 	mr.writers[w] = closeWriter
 
 	go func() {
@@ -61,6 +111,7 @@ func (mr *MultiReader) handle() error {
 					w.Close()
 					c()
 				}
+				mr.closed = true
 				mr.mu.Unlock()
 				return nil
 			}
@@ -68,6 +119,7 @@ func (mr *MultiReader) handle() error {
 		}
 		mr.mu.Lock()
 		for _, p := range p {
+			mr.record(p)
 			for w := range mr.writers {
 				w.writeRawProgress(p)
 			}
@@ -75,3 +127,21 @@ func (mr *MultiReader) handle() error {
 		mr.mu.Unlock()
 	}
 }
+
+// record stores p for the replay to new readers. mr.mu must be held.
+func (mr *MultiReader) record(p *Progress) {
+	if mr.isLog == nil || !mr.isLog(p) {
+		mr.sent[p.ID] = p
+		return
+	}
+	vtx, _ := p.Meta("vertex")
+	logs := append(mr.logs[vtx], p)
+	if len(logs) > mr.logTail {
+		n := copy(logs, logs[len(logs)-mr.logTail:])
+		for i := n; i < len(logs); i++ {
+			logs[i] = nil
+		}
+		logs = logs[:n]
+	}
+	mr.logs[vtx] = logs
+}
@@ -104,6 +104,10 @@ type Status struct {
 	Total     int
 	Started   *time.Time
 	Completed *time.Time
+	// Host is the registry host a pull is served from
+	Host string
+	// Retries is the number of times the transfer was retried
+	Retries int
 }
 
 type progressReader struct {
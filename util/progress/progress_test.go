@@ -65,6 +65,99 @@ func TestProgressNested(t *testing.T) {
 	assert.True(t, len(trace.items) <= 15)
 }
 
+func TestMultiReaderReplay(t *testing.T) {
+	t.Parallel()
+	pr, ctx, cancelProgress := NewContext(context.Background())
+	mr := NewMultiReader(pr)
+
+	var trace1 trace
+	eg, egCtx := errgroup.WithContext(context.Background())
+	r1 := mr.Reader(egCtx)
+	eg.Go(func() error {
+		return saveProgress(egCtx, r1, &trace1)
+	})
+
+	pw, _, _ := NewFromContext(ctx)
+	pw.Write("foo", Status{Action: "foo"})
+	pw.Write("bar", Status{Action: "bar"})
+
+	// wait for the first reader to receive the items
+	for i := 0; i < 100; i++ {
+		mr.mu.Lock()
+		n := len(mr.sent)
+		mr.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var trace2 trace
+	r2 := mr.Reader(egCtx)
+	eg.Go(func() error {
+		return saveProgress(egCtx, r2, &trace2)
+	})
+
+	pw.Write("baz", Status{Action: "baz"})
+	pw.Close()
+	cancelProgress()
+
+	assert.NoError(t, eg.Wait())
+
+	ids := map[string]struct{}{}
+	for _, p := range trace2.items {
+		ids[p.ID] = struct{}{}
+	}
+	assert.Equal(t, map[string]struct{}{"foo": {}, "bar": {}, "baz": {}}, ids)
+
+	// readers attaching after completion get the final state
+	var trace3 trace
+	assert.NoError(t, saveProgress(context.TODO(), mr.Reader(context.TODO()), &trace3))
+	assert.Equal(t, 3, len(trace3.items))
+}
+
+type testLog string
+
+func TestMultiReaderLogTail(t *testing.T) {
+	t.Parallel()
+	pr, ctx, cancelProgress := NewContext(context.Background())
+	mr := NewMultiReader(pr, WithLogTail(3, func(p *Progress) bool {
+		_, ok := p.Sys.(testLog)
+		return ok
+	}))
+
+	// the main reader is only consumed once a reader is attached
+	var trace1 trace
+	eg, egCtx := errgroup.WithContext(context.Background())
+	r1 := mr.Reader(egCtx)
+	eg.Go(func() error {
+		return saveProgress(egCtx, r1, &trace1)
+	})
+
+	for _, vtx := range []string{"v1", "v2"} {
+		pw, _, _ := NewFromContext(ctx, WithMetadata("vertex", vtx))
+		pw.Write(vtx, Status{Action: vtx})
+		for i := 0; i < 10; i++ {
+			pw.Write(fmt.Sprintf("%s-log%d", vtx, i), testLog("log"))
+		}
+		pw.Close()
+	}
+	cancelProgress()
+	assert.NoError(t, eg.Wait())
+	assert.Equal(t, 22, len(trace1.items))
+
+	var trace2 trace
+	assert.NoError(t, saveProgress(context.TODO(), mr.Reader(context.TODO()), &trace2))
+	ids := map[string]struct{}{}
+	for _, p := range trace2.items {
+		ids[p.ID] = struct{}{}
+	}
+	assert.Equal(t, map[string]struct{}{
+		"v1": {}, "v1-log7": {}, "v1-log8": {}, "v1-log9": {},
+		"v2": {}, "v2-log7": {}, "v2-log8": {}, "v2-log9": {},
+	}, ids)
+}
+
 func calc(ctx context.Context, total int, name string) (int, error) {
 	pw, _, ctx := NewFromContext(ctx)
 	defer pw.Close()
@@ -34,6 +34,12 @@ func DisplaySolveStatus(ctx context.Context, phase string, c console.Console, w
 
 	t := newTrace(w, modeConsole)
 
+	if v := os.Getenv("PROGRESS_SILENT_THRESHOLD"); v != "" {
+		if r, err := strconv.ParseInt(v, 10, 64); err == nil {
+			silentThreshold = time.Duration(r) * time.Second
+		}
+	}
+
 	tickerTimeout := 150 * time.Millisecond
 	displayTimeout := 100 * time.Millisecond
 
@@ -70,6 +76,7 @@ func DisplaySolveStatus(ctx context.Context, phase string, c console.Console, w
 			if done {
 				disp.print(t.displayInfo(), width, height, true)
 				t.printErrorLogs(c)
+				t.printWarnings(c)
 				return nil
 			} else if displayLimiter.Allow() {
 				ticker.Stop()
@@ -81,6 +88,7 @@ func DisplaySolveStatus(ctx context.Context, phase string, c console.Console, w
 				printer.print(t)
 				if done {
 					t.printErrorLogs(w)
+					t.printWarnings(w)
 					return nil
 				}
 				ticker.Stop()
@@ -93,6 +101,12 @@ func DisplaySolveStatus(ctx context.Context, phase string, c console.Console, w
 const termHeight = 6
 const termPad = 10
 
+// silentThreshold is the duration without any output after which a running
+// step is reported as silent.
+var silentThreshold = 10 * time.Second
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
 type displayInfo struct {
 	startTime      time.Time
 	jobs           []*job
@@ -109,6 +123,7 @@ type job struct {
 	isCanceled    bool
 	vertex        *vertex
 	showTerm      bool
+	lastOutput    *time.Time
 }
 
 type trace struct {
@@ -119,6 +134,8 @@ type trace struct {
 	nextIndex     int
 	updates       map[digest.Digest]struct{}
 	modeConsole   bool
+	// warnings are the logs of the build that don't belong to a vertex
+	warnings [][]byte
 }
 
 type vertex struct {
@@ -141,11 +158,55 @@ type vertex struct {
 	jobs      []*job
 	jobCached bool
 
+	// lastOutput is the timestamp of the last log or status update
+	lastOutput *time.Time
+	// logsLine is the raw content of the current log line and lastLog
+	// the raw content of the last completed one
+	logsLine      []byte
+	lastLog       []byte
+	logsRepeated  int
+	lastRepeatLog time.Time
+
 	term      *vt100.VT100
 	termBytes int
 	termCount int
 }
 
+func (v *vertex) logLine(tm time.Time, dt []byte) []byte {
+	ts := time.Duration(0)
+	if v.Started != nil {
+		ts = tm.Sub(*v.Started)
+	}
+	prec := 1
+	sec := ts.Seconds()
+	if sec < 10 {
+		prec = 3
+	} else if sec < 100 {
+		prec = 2
+	}
+	return []byte(fmt.Sprintf("#%d %s %s", v.index, fmt.Sprintf("%.[2]*[1]f", sec, prec), dt))
+}
+
+// flushRepeated adds a summary line for identical log lines that were
+// collapsed since the last printed one.
+func (v *vertex) flushRepeated() {
+	if v.logsRepeated == 0 {
+		return
+	}
+	msg := "[previous line repeated 1 more time]"
+	if v.logsRepeated > 1 {
+		msg = fmt.Sprintf("[previous line repeated %d more times]", v.logsRepeated)
+	}
+	v.logs = append(v.logs, v.logLine(v.lastRepeatLog, []byte(msg)))
+	v.logsRepeated = 0
+}
+
+func (v *vertex) updateOutput(tm time.Time) {
+	if v.lastOutput == nil || tm.After(*v.lastOutput) {
+		v.lastOutput = &tm
+	}
+}
+
 func (v *vertex) update(c int) {
 	if v.count == 0 {
 		now := time.Now()
@@ -249,11 +310,16 @@ func (t *trace) update(s *client.SolveStatus, termWidth int) {
 			v.statuses = append(v.statuses, v.byID[s.ID])
 		}
 		v.byID[s.ID].VertexStatus = s
+		v.updateOutput(s.Timestamp)
 		v.statusUpdates[s.ID] = struct{}{}
 		t.updates[v.Digest] = struct{}{}
 		v.update(1)
 	}
 	for _, l := range s.Logs {
+		if l.Vertex == "" {
+			t.warnings = append(t.warnings, l.Data)
+			continue
+		}
 		v, ok := t.byDigest[l.Vertex]
 		if !ok {
 			continue // shouldn't happen
@@ -266,23 +332,29 @@ func (t *trace) update(s *client.SolveStatus, termWidth int) {
 			v.termBytes += len(l.Data)
 			v.term.Write(l.Data) // error unhandled on purpose. don't trust vt100
 		}
+		v.updateOutput(l.Timestamp)
 		i := 0
-		complete := split(l.Data, byte('\n'), func(dt []byte) {
+		complete := split(l.Data, byte('\n'), func(dt []byte, eol bool) {
 			if v.logsPartial && len(v.logs) != 0 && i == 0 {
 				v.logs[len(v.logs)-1] = append(v.logs[len(v.logs)-1], dt...)
+				v.logsLine = append(v.logsLine, dt...)
 			} else {
-				ts := time.Duration(0)
-				if v.Started != nil {
-					ts = l.Timestamp.Sub(*v.Started)
-				}
-				prec := 1
-				sec := ts.Seconds()
-				if sec < 10 {
-					prec = 3
-				} else if sec < 100 {
-					prec = 2
+				// collapse identical complete lines into a single summary line
+				if eol && v.lastLog != nil && bytes.Equal(dt, v.lastLog) {
+					v.logsRepeated++
+					v.lastRepeatLog = l.Timestamp
+					i++
+					return
 				}
-				v.logs = append(v.logs, []byte(fmt.Sprintf("#%d %s %s", v.index, fmt.Sprintf("%.[2]*[1]f", sec, prec), dt)))
+				v.flushRepeated()
+				v.logs = append(v.logs, v.logLine(l.Timestamp, dt))
+				v.logsLine = append([]byte{}, dt...)
+			}
+			if eol {
+				v.lastLog = v.logsLine
+				v.logsLine = nil
+			} else {
+				v.lastLog = nil
 			}
 			i++
 		})
@@ -290,6 +362,18 @@ func (t *trace) update(s *client.SolveStatus, termWidth int) {
 		t.updates[v.Digest] = struct{}{}
 		v.update(1)
 	}
+	for _, v := range s.Vertexes {
+		if vtx, ok := t.byDigest[v.Digest]; ok && vtx.Completed != nil && vtx.logsRepeated > 0 {
+			vtx.flushRepeated()
+			t.updates[v.Digest] = struct{}{}
+		}
+	}
+}
+
+func (t *trace) printWarnings(f io.Writer) {
+	for _, dt := range t.warnings {
+		f.Write(dt)
+	}
 }
 
 func (t *trace) printErrorLogs(f io.Writer) {
@@ -339,6 +423,7 @@ func (t *trace) displayInfo() (d displayInfo) {
 			completedTime: addTime(v.Completed, t.localTimeDiff),
 			name:          strings.Replace(v.Name, "\t", " ", -1),
 			vertex:        v,
+			lastOutput:    addTime(v.lastOutput, t.localTimeDiff),
 		}
 		if v.Error != "" {
 			if strings.HasSuffix(v.Error, context.Canceled.Error()) {
@@ -365,6 +450,9 @@ func (t *trace) displayInfo() (d displayInfo) {
 			} else if s.Current != 0 {
 				j.status = fmt.Sprintf("%.2f", units.Bytes(s.Current))
 			}
+			if details := transferDetails(s.VertexStatus); details != "" {
+				j.status = strings.TrimSpace(j.status + " " + details)
+			}
 			jobs = append(jobs, j)
 		}
 		d.jobs = append(d.jobs, jobs...)
@@ -375,7 +463,7 @@ func (t *trace) displayInfo() (d displayInfo) {
 	return d
 }
 
-func split(dt []byte, sep byte, fn func([]byte)) bool {
+func split(dt []byte, sep byte, fn func([]byte, bool)) bool {
 	if len(dt) == 0 {
 		return false
 	}
@@ -385,10 +473,10 @@ func split(dt []byte, sep byte, fn func([]byte)) bool {
 		}
 		idx := bytes.IndexByte(dt, sep)
 		if idx == -1 {
-			fn(dt)
+			fn(dt, false)
 			return false
 		}
-		fn(dt[:idx])
+		fn(dt[:idx], true)
 		dt = dt[idx+1:]
 	}
 }
@@ -495,6 +583,9 @@ func (disp *display) print(d displayInfo, width, height int, all bool) {
 		pfx := " => "
 		timer := fmt.Sprintf(" %3.1fs\n", dt)
 		status := j.status
+		if status == "" && j.vertex != nil && j.completedTime == nil {
+			status = silentStatus(j, endTime)
+		}
 		showStatus := false
 
 		left := width - len(pfx) - len(timer) - 1
@@ -553,6 +644,24 @@ func (disp *display) print(d displayInfo, width, height int, all bool) {
 	disp.lineCount = lineCount
 }
 
+// silentStatus returns a spinner and the time since the last output for
+// running steps that have been silent longer than silentThreshold.
+func silentStatus(j *job, now time.Time) string {
+	last := j.lastOutput
+	if last == nil {
+		last = j.startTime
+	}
+	silent := now.Sub(*last)
+	if silent < silentThreshold {
+		return ""
+	}
+	frame := spinnerFrames[int(now.Sub(*j.startTime)/(250*time.Millisecond))%len(spinnerFrames)]
+	if j.lastOutput == nil {
+		return fmt.Sprintf("%s no output for %.0fs", frame, silent.Seconds())
+	}
+	return fmt.Sprintf("%s last output %.0fs ago at %s", frame, silent.Seconds(), last.Format("15:04:05"))
+}
+
 func isEmpty(l []rune) bool {
 	for _, r := range l {
 		if r != ' ' {
@@ -0,0 +1,94 @@
+package progressui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moby/buildkit/client"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollapseRepeatedLogs(t *testing.T) {
+	tr := newTrace(nil, false)
+	dgst := digest.FromBytes([]byte("vtx"))
+	now := time.Now()
+
+	tr.update(&client.SolveStatus{
+		Vertexes: []*client.Vertex{{Digest: dgst, Name: "test", Started: &now}},
+	}, 80)
+
+	logs := []string{"foo\n", "waiting\n", "waiting\nwaiting\n", "wait", "ing\n", "bar\n"}
+	for _, l := range logs {
+		tr.update(&client.SolveStatus{
+			Logs: []*client.VertexLog{{Vertex: dgst, Data: []byte(l), Timestamp: now}},
+		}, 80)
+	}
+
+	v := tr.byDigest[dgst]
+	var lines []string
+	for _, l := range v.logs {
+		lines = append(lines, strings.SplitN(string(l), " ", 3)[2])
+	}
+	require.Equal(t, []string{"foo", "waiting", "[previous line repeated 2 more times]", "waiting", "bar"}, lines)
+
+	tr.update(&client.SolveStatus{
+		Logs: []*client.VertexLog{{Vertex: dgst, Data: []byte("bar\n"), Timestamp: now}},
+	}, 80)
+	require.Equal(t, 1, v.logsRepeated)
+
+	completed := now.Add(time.Second)
+	tr.update(&client.SolveStatus{
+		Vertexes: []*client.Vertex{{Digest: dgst, Name: "test", Started: &now, Completed: &completed}},
+	}, 80)
+	require.Equal(t, 0, v.logsRepeated)
+	require.Contains(t, string(v.logs[len(v.logs)-1]), "[previous line repeated 1 more time]")
+}
+
+func TestWarnings(t *testing.T) {
+	tr := newTrace(nil, false)
+	tr.update(&client.SolveStatus{
+		Logs: []*client.VertexLog{{Data: []byte("WARNING: foo\n"), Timestamp: time.Now()}},
+	}, 80)
+	require.Equal(t, 0, len(tr.byDigest))
+
+	var buf bytes.Buffer
+	tr.printWarnings(&buf)
+	require.Equal(t, "WARNING: foo\n", buf.String())
+}
+
+func TestSilentStatus(t *testing.T) {
+	start := time.Now().Add(-time.Minute)
+	j := &job{startTime: &start}
+	require.Contains(t, silentStatus(j, time.Now()), "no output for 60s")
+
+	last := time.Now().Add(-time.Second)
+	j.lastOutput = &last
+	require.Equal(t, "", silentStatus(j, time.Now()))
+}
+
+func TestTransferDetails(t *testing.T) {
+	start := time.Now()
+	now := start.Add(2 * time.Second)
+
+	s := &client.VertexStatus{
+		ID:        "sha256:abc",
+		Current:   2 << 20,
+		Total:     6 << 20,
+		Timestamp: now,
+		Started:   &start,
+		Host:      "mirror.example.com",
+		Retries:   1,
+	}
+	require.Equal(t, "1.05MB/s eta 4s from mirror.example.com retry 1", transferDetails(s))
+
+	completed := start.Add(6 * time.Second)
+	s.Current = s.Total
+	s.Completed = &completed
+	s.Retries = 0
+	require.Equal(t, "1.05MB/s from mirror.example.com", transferDetails(s))
+
+	require.Equal(t, "", transferDetails(&client.VertexStatus{ID: "sha256:abc", Timestamp: now}))
+}
@@ -26,10 +26,16 @@ type lastStatus struct {
 	Timestamp time.Time
 }
 
+type silentReport struct {
+	lastOutput *time.Time
+	next       time.Duration
+}
+
 type textMux struct {
 	w        io.Writer
 	current  digest.Digest
 	last     map[string]lastStatus
+	silent   map[digest.Digest]*silentReport
 	notFirst bool
 }
 
@@ -106,6 +112,9 @@ func (p *textMux) printVtx(t *trace, dgst digest.Digest) {
 			} else if s.Current != 0 {
 				bytes = fmt.Sprintf(" %.2f", units.Bytes(s.Current))
 			}
+			if details := transferDetails(s.VertexStatus); details != "" {
+				bytes += " " + details
+			}
 			var tm string
 			endTime := s.Timestamp
 			if s.Completed != nil {
@@ -192,7 +201,50 @@ func sortCompleted(t *trace, m map[digest.Digest]struct{}) []digest.Digest {
 	return out
 }
 
+// printSilent reports running vertexes that haven't produced any output for
+// longer than silentThreshold. Reports are repeated with a doubling interval
+// so that hung steps don't flood the output.
+func (p *textMux) printSilent(t *trace) {
+	if p.silent == nil {
+		p.silent = make(map[digest.Digest]*silentReport)
+	}
+	now := time.Now()
+	for _, v := range t.vertexes {
+		if v.Started == nil || v.Completed != nil {
+			delete(p.silent, v.Digest)
+			continue
+		}
+		st, ok := p.silent[v.Digest]
+		if !ok || st.lastOutput != v.lastOutput {
+			st = &silentReport{lastOutput: v.lastOutput, next: silentThreshold}
+			p.silent[v.Digest] = st
+		}
+		last := v.Started
+		if v.lastOutput != nil {
+			last = v.lastOutput
+		}
+		silent := now.Sub(*addTime(last, t.localTimeDiff))
+		if silent < st.next {
+			continue
+		}
+		if v.logsPartial && p.current == v.Digest {
+			fmt.Fprintln(p.w, "")
+			v.logsOffset = 0
+			v.logs = nil
+			v.logsPartial = false
+		}
+		if v.lastOutput == nil {
+			fmt.Fprintf(p.w, "#%d still running, no output for %.0fs\n", v.index, silent.Seconds())
+		} else {
+			fmt.Fprintf(p.w, "#%d still running, last output %.0fs ago\n", v.index, silent.Seconds())
+		}
+		st.next *= 2
+	}
+}
+
 func (p *textMux) print(t *trace) {
+	defer p.printSilent(t)
+
 	completed := map[digest.Digest]struct{}{}
 	rest := map[digest.Digest]struct{}{}
 
@@ -0,0 +1,37 @@
+package progressui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/moby/buildkit/client"
+	"github.com/tonistiigi/units"
+)
+
+// transferDetails describes a data transfer status with its average rate,
+// the estimated time left, the host serving it and the number of retries
+func transferDetails(s *client.VertexStatus) string {
+	var parts []string
+	if s.Started != nil && s.Current > 0 {
+		end := s.Timestamp
+		if s.Completed != nil {
+			end = *s.Completed
+		}
+		if dt := end.Sub(*s.Started).Seconds(); dt >= 0.1 {
+			rate := float64(s.Current) / dt
+			parts = append(parts, fmt.Sprintf("%.2f/s", units.Bytes(int64(rate))))
+			if s.Completed == nil && s.Total > s.Current {
+				eta := time.Duration(float64(s.Total-s.Current) / rate * float64(time.Second))
+				parts = append(parts, "eta "+eta.Round(time.Second).String())
+			}
+		}
+	}
+	if s.Host != "" {
+		parts = append(parts, "from "+s.Host)
+	}
+	if s.Retries > 0 {
+		parts = append(parts, fmt.Sprintf("retry %d", s.Retries))
+	}
+	return strings.Join(parts, " ")
+}
@@ -3,12 +3,15 @@ package pullprogress
 import (
 	"context"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/remotes"
 	"github.com/moby/buildkit/util/progress"
+	"github.com/moby/buildkit/util/resolver/hostobserver"
+	"github.com/moby/buildkit/util/resolver/retryhandler"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -25,14 +28,15 @@ type ProviderWithProgress struct {
 }
 
 func (p *ProviderWithProgress) ReaderAt(ctx context.Context, desc ocispecs.Descriptor) (content.ReaderAt, error) {
-	ra, err := p.Provider.ReaderAt(ctx, desc)
+	h := &host{}
+	ra, err := p.Provider.ReaderAt(hostobserver.WithObserver(ctx, h.set), desc)
 	if err != nil {
 		return nil, err
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	doneCh := make(chan struct{})
-	go trackProgress(ctx, desc, p.Manager, doneCh)
+	go trackProgress(ctx, desc, p.Manager, h.get(), doneCh)
 	return readerAtWithCancel{ReaderAt: ra, cancel: cancel, doneCh: doneCh}, nil
 }
 
@@ -58,14 +62,15 @@ type FetcherWithProgress struct {
 }
 
 func (f *FetcherWithProgress) Fetch(ctx context.Context, desc ocispecs.Descriptor) (io.ReadCloser, error) {
-	rc, err := f.Fetcher.Fetch(ctx, desc)
+	h := &host{}
+	rc, err := f.Fetcher.Fetch(hostobserver.WithObserver(ctx, h.set), desc)
 	if err != nil {
 		return nil, err
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	doneCh := make(chan struct{})
-	go trackProgress(ctx, desc, f.Manager, doneCh)
+	go trackProgress(ctx, desc, f.Manager, h.get(), doneCh)
 	return readerWithCancel{ReadCloser: rc, cancel: cancel, doneCh: doneCh}, nil
 }
 
@@ -85,7 +90,25 @@ func (r readerWithCancel) Close() error {
 	return r.ReadCloser.Close()
 }
 
-func trackProgress(ctx context.Context, desc ocispecs.Descriptor, manager PullManager, doneCh chan<- struct{}) {
+// host records the registry host that served a fetch
+type host struct {
+	mu   sync.Mutex
+	name string
+}
+
+func (h *host) set(name string) {
+	h.mu.Lock()
+	h.name = name
+	h.mu.Unlock()
+}
+
+func (h *host) get() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.name
+}
+
+func trackProgress(ctx context.Context, desc ocispecs.Descriptor, manager PullManager, host string, doneCh chan<- struct{}) {
 
 	defer close(doneCh)
 
@@ -100,6 +123,7 @@ func trackProgress(ctx context.Context, desc ocispecs.Descriptor, manager PullMa
 	defer pw.Close()
 
 	ingestRef := remotes.MakeRefKey(ctx, desc)
+	retries := retryhandler.Retries(ctx)
 
 	started := time.Now()
 	onFinalStatus := false
@@ -116,6 +140,8 @@ func trackProgress(ctx context.Context, desc ocispecs.Descriptor, manager PullMa
 				Current: int(status.Offset),
 				Total:   int(status.Total),
 				Started: &started,
+				Host:    host,
+				Retries: retries,
 			})
 			continue
 		} else if !errors.Is(err, errdefs.ErrNotFound) {
@@ -130,6 +156,8 @@ func trackProgress(ctx context.Context, desc ocispecs.Descriptor, manager PullMa
 				Total:     int(info.Size),
 				Started:   &started,
 				Completed: &info.CreatedAt,
+				Host:      host,
+				Retries:   retries,
 			})
 			return
 		}
@@ -13,7 +13,10 @@ import (
 	"github.com/containerd/containerd/images"
 	"github.com/containerd/containerd/remotes/docker"
 	"github.com/docker/distribution/reference"
+	"github.com/moby/buildkit/exporter/attestation"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
 	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/util/compression"
 	"github.com/moby/buildkit/util/flightcontrol"
 	"github.com/moby/buildkit/util/imageutil"
 	"github.com/moby/buildkit/util/progress"
@@ -27,7 +30,23 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func Push(ctx context.Context, sm *session.Manager, sid string, provider content.Provider, manager content.Manager, dgst digest.Digest, ref string, insecure bool, hosts docker.RegistryHosts, byDigest bool, annotations map[digest.Digest]map[string]string) error {
+// Opt configures how the blobs of an image are uploaded
+type Opt struct {
+	// Retry configures the retries of requests that fail with temporary
+	// errors
+	Retry retryhandler.Opt
+	// Concurrency is the maximum number of parallel uploads of the push. If
+	// zero the uploads share the default limit per registry with other
+	// pushes and pulls.
+	Concurrency int
+	// ChunkSize is the maximum size of the requests a layer is uploaded
+	// with. If zero a layer is uploaded with a single request.
+	ChunkSize int64
+}
+
+// Push pushes the image dgst to ref. Requests that fail with temporary errors
+// are retried as configured by opt, interrupted layer uploads are resumed.
+func Push(ctx context.Context, sm *session.Manager, sid string, provider content.Provider, manager content.Manager, dgst digest.Digest, ref string, insecure bool, hosts docker.RegistryHosts, byDigest bool, annotations map[digest.Digest]map[string]string, opt Opt) error {
 	desc := ocispecs.Descriptor{
 		Digest: dgst,
 	}
@@ -50,18 +69,7 @@ func Push(ctx context.Context, sm *session.Manager, sid string, provider content
 		ref = r.String()
 	}
 
-	scope := "push"
-	if insecure {
-		insecureTrue := true
-		httpTrue := true
-		hosts = resolver.NewRegistryConfig(map[string]resolver.RegistryConfig{
-			reference.Domain(parsed): {
-				Insecure:  &insecureTrue,
-				PlainHTTP: &httpTrue,
-			},
-		})
-		scope += ":insecure"
-	}
+	hosts, scope := pushHosts(hosts, parsed, insecure)
 
 	resolver := resolver.DefaultPool.GetResolver(hosts, ref, scope, sm, session.NewGroup(sid))
 
@@ -69,6 +77,10 @@ func Push(ctx context.Context, sm *session.Manager, sid string, provider content
 	if err != nil {
 		return err
 	}
+	pusher, err = newResumablePusher(pusher, ref, resolver.HostsFunc, opt.ChunkSize)
+	if err != nil {
+		return err
+	}
 
 	var m sync.Mutex
 	manifestStack := []ocispecs.Descriptor{}
@@ -82,11 +94,20 @@ func Push(ctx context.Context, sm *session.Manager, sid string, provider content
 			m.Unlock()
 			return nil, images.ErrStopHandler
 		default:
+			if images.IsNonDistributable(desc.MediaType) {
+				// non-distributable layers, e.g. Windows base layers, are
+				// referenced by their URLs and never pushed
+				return nil, images.ErrStopHandler
+			}
 			return nil, nil
 		}
 	})
 
-	pushHandler := retryhandler.New(limited.PushHandler(pusher, provider, ref), logs.LoggerFromContext(ctx))
+	limiter := limited.Default
+	if opt.Concurrency > 0 {
+		limiter = limited.New(opt.Concurrency)
+	}
+	pushHandler := retryhandler.NewWithOpt(limiter.PushHandler(pusher, provider, ref), logs.LoggerFromContext(ctx), opt.Retry)
 	pushUpdateSourceHandler, err := updateDistributionSourceHandler(manager, pushHandler, ref)
 	if err != nil {
 		return err
@@ -127,6 +148,22 @@ func Push(ctx context.Context, sm *session.Manager, sid string, provider content
 	return mfstDone(nil)
 }
 
+// pushHosts returns the registry hosts and resolver scope for pushing to the
+// repository of ref
+func pushHosts(hosts docker.RegistryHosts, ref reference.Named, insecure bool) (docker.RegistryHosts, string) {
+	if !insecure {
+		return hosts, "push"
+	}
+	insecureTrue := true
+	httpTrue := true
+	return resolver.NewRegistryConfig(map[string]resolver.RegistryConfig{
+		reference.Domain(ref): {
+			Insecure:  &insecureTrue,
+			PlainHTTP: &httpTrue,
+		},
+	}), "push:insecure"
+}
+
 func annotateDistributionSourceHandler(manager content.Manager, annotations map[digest.Digest]map[string]string, f images.HandlerFunc) func(ctx context.Context, desc ocispecs.Descriptor) ([]ocispecs.Descriptor, error) {
 	return func(ctx context.Context, desc ocispecs.Descriptor) ([]ocispecs.Descriptor, error) {
 		children, err := f(ctx, desc)
@@ -235,8 +272,11 @@ func childrenHandler(provider content.Provider) images.HandlerFunc {
 				}
 			}
 		case images.MediaTypeDockerSchema2Layer, images.MediaTypeDockerSchema2LayerGzip,
+			images.MediaTypeDockerSchema2LayerForeign, images.MediaTypeDockerSchema2LayerForeignGzip,
+			ocispecs.MediaTypeImageLayerNonDistributable, ocispecs.MediaTypeImageLayerNonDistributableGzip,
 			images.MediaTypeDockerSchema2Config, ocispecs.MediaTypeImageConfig,
-			ocispecs.MediaTypeImageLayer, ocispecs.MediaTypeImageLayerGzip:
+			ocispecs.MediaTypeImageLayer, ocispecs.MediaTypeImageLayerGzip, compression.MediaTypeImageLayerZstd,
+			exptypes.MediaTypeWasmConfig, exptypes.MediaTypeWasmLayer, exptypes.MediaTypeLayerDelta, exptypes.MediaTypeEmptyJSON, attestation.MediaTypeInToto, MediaTypeSimpleSigning:
 			// childless data types.
 			return nil, nil
 		default:
@@ -263,7 +303,7 @@ func updateDistributionSourceHandler(manager content.Manager, pushF images.Handl
 
 		switch desc.MediaType {
 		case images.MediaTypeDockerSchema2Layer, images.MediaTypeDockerSchema2LayerGzip,
-			ocispecs.MediaTypeImageLayer, ocispecs.MediaTypeImageLayerGzip:
+			ocispecs.MediaTypeImageLayer, ocispecs.MediaTypeImageLayerGzip, compression.MediaTypeImageLayerZstd:
 			islayer = true
 		}
 
@@ -0,0 +1,263 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/containerd/containerd/content"
+	ctdreference "github.com/containerd/containerd/reference"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/docker/distribution/reference"
+	"github.com/moby/buildkit/exporter/attestation"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/util/resolver"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ReferrersMethodAPI is the push method of referrers that the registry
+	// indexes by their subject, see the referrers API of the OCI
+	// distribution spec
+	ReferrersMethodAPI = "referrers"
+	// ReferrersMethodTag is the push method of referrers that are listed in
+	// an index tagged sha256-<subject digest>, the referrers tag schema of
+	// the OCI distribution spec for registries without the referrers API
+	ReferrersMethodTag = "tag"
+)
+
+// PushReferrers pushes the manifests of referrers to the repository of ref.
+// The referrers have the subject set in their manifest and the digest of the
+// subject in the attestation.AnnotationReferenceDigest annotation of their
+// descriptor. The manifests are pushed by digest. If the registry doesn't
+// support the referrers API they are also added to the index tagged by the
+// digest of their subject. The method that was used is returned.
+func PushReferrers(ctx context.Context, sm *session.Manager, sid string, store content.Store, hosts docker.RegistryHosts, ref string, insecure bool, referrers []ocispecs.Descriptor, opt Opt) (string, error) {
+	if len(referrers) == 0 {
+		return "", nil
+	}
+	parsed, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", err
+	}
+	repo := reference.TrimNamed(parsed)
+
+	subject := digest.Digest(referrers[0].Annotations[attestation.AnnotationReferenceDigest])
+	if subject == "" {
+		return "", errors.Errorf("referrer %s has no subject", referrers[0].Digest)
+	}
+	hosts, scope := pushHosts(hosts, parsed, insecure)
+	r := resolver.DefaultPool.GetResolver(hosts, repo.String(), scope, sm, session.NewGroup(sid))
+	done := oneOffProgress(ctx, "checking referrers API support of "+reference.Domain(repo))
+	ok, err := referrersSupported(ctx, r.HostsFunc, repo.String(), subject)
+	if err := done(err); err != nil {
+		return "", err
+	}
+
+	bySubject := map[digest.Digest][]ocispecs.Descriptor{}
+	var subjects []digest.Digest
+	for _, desc := range referrers {
+		if err := Push(ctx, sm, sid, store, store, desc.Digest, repo.String(), insecure, hosts, true, nil, opt); err != nil {
+			return "", err
+		}
+		if ok {
+			continue
+		}
+		subject := digest.Digest(desc.Annotations[attestation.AnnotationReferenceDigest])
+		if subject == "" {
+			return "", errors.Errorf("referrer %s has no subject", desc.Digest)
+		}
+		if _, ok := bySubject[subject]; !ok {
+			subjects = append(subjects, subject)
+		}
+		bySubject[subject] = append(bySubject[subject], desc)
+	}
+	if ok {
+		return ReferrersMethodAPI, nil
+	}
+	for _, subject := range subjects {
+		done := oneOffProgress(ctx, "updating referrers tag of "+subject.String())
+		if err := done(updateReferrersTag(ctx, store, r.HostsFunc, repo.String(), subject, bySubject[subject])); err != nil {
+			return "", err
+		}
+	}
+	return ReferrersMethodTag, nil
+}
+
+// referrersTag returns the tag of the referrers index of dgst in registries
+// without the referrers API, <alg>-<encoded digest> truncated as in the
+// referrers tag schema of the OCI distribution spec
+func referrersTag(dgst digest.Digest) string {
+	alg, enc := dgst.Algorithm().String(), dgst.Encoded()
+	if len(alg) > 32 {
+		alg = alg[:32]
+	}
+	if len(enc) > 64 {
+		enc = enc[:64]
+	}
+	return alg + "-" + enc
+}
+
+// referrersIndex is the index tagged by the referrers tag of a subject. The
+// vendored image-spec doesn't have the artifactType field of descriptors yet.
+type referrersIndex struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType"`
+	Manifests     []referrerDescriptor `json:"manifests"`
+}
+
+type referrerDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       digest.Digest     `json:"digest"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// newReferrerDescriptor returns the descriptor of a referrer in the referrers
+// index, with the artifact type and the annotations of its manifest
+func newReferrerDescriptor(ctx context.Context, provider content.Provider, desc ocispecs.Descriptor) (referrerDescriptor, error) {
+	dt, err := content.ReadBlob(ctx, provider, desc)
+	if err != nil {
+		return referrerDescriptor{}, err
+	}
+	var mfst struct {
+		ArtifactType string              `json:"artifactType,omitempty"`
+		Config       ocispecs.Descriptor `json:"config"`
+		Annotations  map[string]string   `json:"annotations,omitempty"`
+	}
+	if err := json.Unmarshal(dt, &mfst); err != nil {
+		return referrerDescriptor{}, errors.Wrapf(err, "failed to parse referrer %s", desc.Digest)
+	}
+	artifactType := mfst.ArtifactType
+	if artifactType == "" {
+		artifactType = mfst.Config.MediaType
+	}
+	return referrerDescriptor{
+		MediaType:    desc.MediaType,
+		ArtifactType: artifactType,
+		Digest:       desc.Digest,
+		Size:         desc.Size,
+		Annotations:  mfst.Annotations,
+	}, nil
+}
+
+// updateReferrersTag adds referrers to the index tagged by the referrers tag
+// of subject, keeping the referrers pushed by other clients
+func updateReferrersTag(ctx context.Context, provider content.Provider, hostsFunc docker.RegistryHosts, ref string, subject digest.Digest, referrers []ocispecs.Descriptor) error {
+	ctx, host, repoURL, err := pushHost(ctx, hostsFunc, ref, true)
+	if err != nil {
+		return err
+	}
+	u := repoURL + "/manifests/" + referrersTag(subject)
+
+	idx := referrersIndex{SchemaVersion: 2, MediaType: ocispecs.MediaTypeImageIndex}
+	resp, err := doWithContentType(ctx, *host, http.MethodGet, u, ocispecs.MediaTypeImageIndex, nil)
+	if err != nil {
+		return err
+	}
+	dt, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.Unmarshal(dt, &idx); err != nil {
+			return errors.Wrapf(err, "failed to parse referrers index of %s", subject)
+		}
+	case http.StatusNotFound:
+	default:
+		return errors.Errorf("unexpected status fetching referrers index of %s: %s", subject, resp.Status)
+	}
+
+	existing := map[digest.Digest]struct{}{}
+	for _, desc := range idx.Manifests {
+		existing[desc.Digest] = struct{}{}
+	}
+	for _, desc := range referrers {
+		if _, ok := existing[desc.Digest]; ok {
+			continue
+		}
+		desc, err := newReferrerDescriptor(ctx, provider, desc)
+		if err != nil {
+			return err
+		}
+		idx.Manifests = append(idx.Manifests, desc)
+	}
+	dt, err = json.Marshal(idx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	resp, err = doWithContentType(ctx, *host, http.MethodPut, u, ocispecs.MediaTypeImageIndex, bytes.NewReader(dt))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return errors.Errorf("unexpected status pushing referrers index of %s: %s", subject, resp.Status)
+	}
+	return nil
+}
+
+// referrersSupported returns true if the registry of ref implements the
+// referrers API. Registries without it respond with 404 to the listing of the
+// referrers of subject.
+func referrersSupported(ctx context.Context, hostsFunc docker.RegistryHosts, ref string, subject digest.Digest) (bool, error) {
+	ctx, host, repoURL, err := pushHost(ctx, hostsFunc, ref, false)
+	if err != nil {
+		return false, err
+	}
+	resp, err := do(ctx, *host, http.MethodGet, repoURL+"/referrers/"+subject.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// registries that route unknown paths to a catch-all handler
+		// don't respond with an index
+		mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		return mt == ocispecs.MediaTypeImageIndex, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, errors.Errorf("unexpected status checking referrers API support: %s", resp.Status)
+	}
+}
+
+// pushHost returns the push host of ref, the URL of its repository on the
+// host and a context with the repository scope
+func pushHost(ctx context.Context, hostsFunc docker.RegistryHosts, ref string, push bool) (context.Context, *docker.RegistryHost, string, error) {
+	refspec, err := ctdreference.Parse(ref)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	hosts, err := hostsFunc(refspec.Hostname())
+	if err != nil {
+		return nil, nil, "", err
+	}
+	var host *docker.RegistryHost
+	for i, h := range hosts {
+		if h.Capabilities.Has(docker.HostCapabilityPush) {
+			host = &hosts[i]
+			break
+		}
+	}
+	if host == nil {
+		return nil, nil, "", errors.Errorf("no push host for %s", ref)
+	}
+	ctx, err = docker.ContextWithRepositoryScope(ctx, refspec, push)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	repo := strings.TrimPrefix(refspec.Locator, refspec.Hostname()+"/")
+	return ctx, host, fmt.Sprintf("%s://%s%s/%s", host.Scheme, host.Host, host.Path, repo), nil
+}
@@ -0,0 +1,167 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/remotes/docker"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferrersSupported(t *testing.T) {
+	t.Parallel()
+
+	subject := digest.FromString("manifest")
+
+	for _, tc := range []struct {
+		name        string
+		status      int
+		contentType string
+		supported   bool
+		err         bool
+	}{
+		{name: "api", status: http.StatusOK, contentType: ocispecs.MediaTypeImageIndex, supported: true},
+		{name: "no api", status: http.StatusNotFound},
+		{name: "catch-all", status: http.StatusOK, contentType: "text/html; charset=utf-8"},
+		{name: "error", status: http.StatusInternalServerError, err: true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var path string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				path = req.URL.Path
+				if tc.contentType != "" {
+					w.Header().Set("Content-Type", tc.contentType)
+				}
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+			u, err := url.Parse(srv.URL)
+			require.NoError(t, err)
+			hosts := func(string) ([]docker.RegistryHost, error) {
+				return []docker.RegistryHost{{
+					Client:       srv.Client(),
+					Host:         u.Host,
+					Scheme:       "http",
+					Path:         "/v2",
+					Capabilities: docker.HostCapabilityPush | docker.HostCapabilityPull | docker.HostCapabilityResolve,
+				}}, nil
+			}
+
+			ok, err := referrersSupported(context.TODO(), hosts, u.Host+"/foo/bar", subject)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.supported, ok)
+			require.Equal(t, "/v2/foo/bar/referrers/"+subject.String(), path)
+		})
+	}
+}
+
+func TestReferrersTag(t *testing.T) {
+	t.Parallel()
+
+	subject := digest.FromString("manifest")
+	require.Equal(t, "sha256-"+subject.Hex(), referrersTag(subject))
+	require.Equal(t, "sha512-"+digest.SHA512.FromString("manifest").Hex()[:64], referrersTag(digest.SHA512.FromString("manifest")))
+}
+
+func TestUpdateReferrersTag(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.TODO()
+	store, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	subject := digest.FromString("manifest")
+	existing := referrerDescriptor{
+		MediaType:    ocispecs.MediaTypeImageManifest,
+		ArtifactType: "application/vnd.example",
+		Digest:       digest.FromString("other"),
+		Size:         5,
+	}
+	dt, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     ocispecs.MediaTypeImageManifest,
+		"config":        ocispecs.Descriptor{MediaType: "application/vnd.in-toto+json", Digest: digest.FromString("config"), Size: 6},
+		"layers":        []ocispecs.Descriptor{},
+		"annotations":   map[string]string{"foo": "bar"},
+	})
+	require.NoError(t, err)
+	desc := ocispecs.Descriptor{MediaType: ocispecs.MediaTypeImageManifest, Digest: digest.FromBytes(dt), Size: int64(len(dt))}
+	require.NoError(t, content.WriteBlob(ctx, store, desc.Digest.String(), bytes.NewReader(dt), desc))
+
+	for _, tc := range []struct {
+		name     string
+		existing bool
+	}{
+		{name: "new"},
+		{name: "merge", existing: true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var put referrersIndex
+			var contentType string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Path != "/v2/foo/bar/manifests/"+referrersTag(subject) {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				switch req.Method {
+				case http.MethodGet:
+					if !tc.existing {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					w.Header().Set("Content-Type", ocispecs.MediaTypeImageIndex)
+					json.NewEncoder(w).Encode(referrersIndex{SchemaVersion: 2, MediaType: ocispecs.MediaTypeImageIndex, Manifests: []referrerDescriptor{existing}})
+				case http.MethodPut:
+					contentType = req.Header.Get("Content-Type")
+					dt, _ := ioutil.ReadAll(req.Body)
+					json.Unmarshal(dt, &put)
+					w.WriteHeader(http.StatusCreated)
+				}
+			}))
+			defer srv.Close()
+			u, err := url.Parse(srv.URL)
+			require.NoError(t, err)
+			hosts := func(string) ([]docker.RegistryHost, error) {
+				return []docker.RegistryHost{{
+					Client:       srv.Client(),
+					Host:         u.Host,
+					Scheme:       "http",
+					Path:         "/v2",
+					Capabilities: docker.HostCapabilityPush | docker.HostCapabilityPull | docker.HostCapabilityResolve,
+				}}, nil
+			}
+
+			require.NoError(t, updateReferrersTag(ctx, store, hosts, u.Host+"/foo/bar", subject, []ocispecs.Descriptor{desc}))
+			require.Equal(t, ocispecs.MediaTypeImageIndex, contentType)
+			require.Equal(t, ocispecs.MediaTypeImageIndex, put.MediaType)
+			added := referrerDescriptor{
+				MediaType:    ocispecs.MediaTypeImageManifest,
+				ArtifactType: "application/vnd.in-toto+json",
+				Digest:       desc.Digest,
+				Size:         desc.Size,
+				Annotations:  map[string]string{"foo": "bar"},
+			}
+			if tc.existing {
+				require.Equal(t, []referrerDescriptor{existing, added}, put.Manifests)
+			} else {
+				require.Equal(t, []referrerDescriptor{added}, put.Manifests)
+			}
+		})
+	}
+}
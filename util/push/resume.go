@@ -0,0 +1,540 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/reference"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/moby/buildkit/util/bklog"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// minResumableSize is the size from which layer blobs are uploaded in a way
+// that can be resumed. Smaller blobs are pushed with a single request.
+const minResumableSize = 1 << 20
+
+var errUploadInterrupted = errors.New("upload interrupted")
+
+type uploadKey struct {
+	host string
+	repo string
+	dgst digest.Digest
+}
+
+// uploadSessionTTL is how long the location of an interrupted upload is
+// kept. Registries purge upload sessions that don't progress.
+const uploadSessionTTL = time.Hour
+
+// uploadSessions remembers the upload locations of blob pushes that didn't
+// complete, so that pushing the same blob again continues the upload from the
+// offset the registry has already received
+var uploadSessions = newUploadStore()
+
+// uploadStore holds the upload locations of the blobs. Only one push of a
+// blob uses its location at a time, concurrent pushes of the same blob wait
+// for it to end.
+type uploadStore struct {
+	mu       sync.Mutex
+	sessions map[uploadKey]uploadSession
+	// active are the blobs that are being pushed, the channels are closed
+	// when the push ends
+	active map[uploadKey]chan struct{}
+	now    func() time.Time
+}
+
+type uploadSession struct {
+	location string
+	updated  time.Time
+}
+
+func newUploadStore() *uploadStore {
+	return &uploadStore{
+		sessions: map[uploadKey]uploadSession{},
+		active:   map[uploadKey]chan struct{}{},
+		now:      time.Now,
+	}
+}
+
+// acquire waits for the other push of k to end and returns the location of
+// the interrupted upload of k. release must be called when the push ends.
+func (s *uploadStore) acquire(ctx context.Context, k uploadKey) (string, bool, error) {
+	for {
+		s.mu.Lock()
+		ch, ok := s.active[k]
+		if !ok {
+			s.active[k] = make(chan struct{})
+			s.expire()
+			sess, ok := s.sessions[k]
+			s.mu.Unlock()
+			return sess.location, ok, nil
+		}
+		s.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return "", false, ctx.Err()
+		case <-ch:
+		}
+	}
+}
+
+func (s *uploadStore) release(k uploadKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ch, ok := s.active[k]; ok {
+		close(ch)
+		delete(s.active, k)
+	}
+}
+
+func (s *uploadStore) set(k uploadKey, location string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[k] = uploadSession{location: location, updated: s.now()}
+}
+
+func (s *uploadStore) delete(k uploadKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, k)
+}
+
+// expire removes the sessions that weren't updated within uploadSessionTTL
+func (s *uploadStore) expire() {
+	now := s.now()
+	for k, sess := range s.sessions {
+		if now.Sub(sess.updated) > uploadSessionTTL {
+			delete(s.sessions, k)
+		}
+	}
+}
+
+// resumablePusher uploads layer blobs with streamed PATCH requests instead
+// of a single PUT, so that a push that was interrupted can continue where it
+// stopped. Other content and blobs that can be mounted from another
+// repository are pushed by the wrapped pusher.
+type resumablePusher struct {
+	remotes.Pusher
+	refspec reference.Spec
+	repo    string
+	hosts   []docker.RegistryHost
+	uploads *uploadStore
+	// chunkSize is the maximum size of a PATCH request, zero sends the
+	// whole blob with one request
+	chunkSize int64
+}
+
+func newResumablePusher(p remotes.Pusher, ref string, hostsFunc docker.RegistryHosts, chunkSize int64) (remotes.Pusher, error) {
+	refspec, err := reference.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := hostsFunc(refspec.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	var pushHosts []docker.RegistryHost
+	for _, h := range hosts {
+		if h.Capabilities.Has(docker.HostCapabilityPush) {
+			pushHosts = append(pushHosts, h)
+		}
+	}
+	if len(pushHosts) == 0 {
+		return p, nil
+	}
+	return &resumablePusher{
+		Pusher:    p,
+		refspec:   refspec,
+		repo:      strings.TrimPrefix(refspec.Locator, refspec.Hostname()+"/"),
+		hosts:     pushHosts,
+		uploads:   uploadSessions,
+		chunkSize: chunkSize,
+	}, nil
+}
+
+func (p *resumablePusher) Push(ctx context.Context, desc ocispecs.Descriptor) (content.Writer, error) {
+	if !images.IsLayerType(desc.MediaType) || desc.Size < minResumableSize || p.canMount(desc) {
+		return p.Pusher.Push(ctx, desc)
+	}
+	host := p.hosts[0]
+	ctx, err := docker.ContextWithRepositoryScope(ctx, p.refspec, true)
+	if err != nil {
+		return nil, err
+	}
+
+	key := uploadKey{host: host.Host, repo: p.repo, dgst: desc.Digest}
+	location, ok, err := p.uploads.acquire(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	w, err := p.push(ctx, host, key, location, ok, desc)
+	if err != nil {
+		p.uploads.release(key)
+		return nil, err
+	}
+	return w, nil
+}
+
+// push starts the upload of desc or resumes the upload at location. The
+// blob exists if it was pushed concurrently.
+func (p *resumablePusher) push(ctx context.Context, host docker.RegistryHost, key uploadKey, location string, ok bool, desc ocispecs.Descriptor) (content.Writer, error) {
+	resp, err := do(ctx, host, http.MethodHead, p.url(host, "blobs", desc.Digest.String()), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil, errors.Wrapf(errdefs.ErrAlreadyExists, "content %v on remote", desc.Digest)
+	case http.StatusNotFound:
+	default:
+		return nil, errors.Errorf("unexpected status checking blob %s: %s", desc.Digest, resp.Status)
+	}
+
+	var offset int64
+	if ok {
+		offset, err = p.uploadOffset(ctx, host, location)
+		if err != nil || offset > desc.Size {
+			bklog.G(ctx).Debugf("can't resume upload of %s, starting a new one: %v", desc.Digest, err)
+			p.uploads.delete(key)
+			ok = false
+			offset = 0
+		} else {
+			bklog.G(ctx).Debugf("resuming upload of %s at %d of %d bytes", desc.Digest, offset, desc.Size)
+		}
+	}
+	if !ok {
+		location, err = p.startUpload(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		p.uploads.set(key, location)
+	}
+
+	return &resumableWriter{
+		ctx:      ctx,
+		pusher:   p,
+		host:     host,
+		key:      key,
+		location: location,
+		status: content.Status{
+			Ref:       remotes.MakeRefKey(ctx, desc),
+			Offset:    offset,
+			Total:     desc.Size,
+			Expected:  desc.Digest,
+			StartedAt: time.Now(),
+		},
+	}, nil
+}
+
+// canMount returns true if the blob can be mounted from another repository
+// of the same registry
+func (p *resumablePusher) canMount(desc ocispecs.Descriptor) bool {
+	_, ok := desc.Annotations["containerd.io/distribution.source."+p.refspec.Hostname()]
+	return ok
+}
+
+func (p *resumablePusher) url(host docker.RegistryHost, ps ...string) string {
+	return fmt.Sprintf("%s://%s%s/%s/%s", host.Scheme, host.Host, host.Path, p.repo, strings.Join(ps, "/"))
+}
+
+func (p *resumablePusher) startUpload(ctx context.Context, host docker.RegistryHost) (string, error) {
+	resp, err := do(ctx, host, http.MethodPost, p.url(host, "blobs", "uploads/"), nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return "", errors.Errorf("unexpected status starting upload: %s", resp.Status)
+	}
+	return resolveLocation(host, resp.Header.Get("Location"))
+}
+
+// uploadOffset returns the number of bytes the registry has received for the
+// upload
+func (p *resumablePusher) uploadOffset(ctx context.Context, host docker.RegistryHost, location string) (int64, error) {
+	resp, err := do(ctx, host, http.MethodGet, location, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, errors.Errorf("unexpected upload status: %s", resp.Status)
+	}
+	return parseRangeEnd(resp.Header.Get("Range"))
+}
+
+// do sends a request to the registry. Requests without a body are retried
+// once after an authorization challenge.
+func do(ctx context.Context, host docker.RegistryHost, method, u string, body io.Reader) (*http.Response, error) {
+	return doWithContentType(ctx, host, method, u, "", body)
+}
+
+// doWithContentType is do with the content type of body, or the accepted
+// content type of the response for requests without a body
+func doWithContentType(ctx context.Context, host docker.RegistryHost, method, u, contentType string, body io.Reader) (*http.Response, error) {
+	for i := 0; ; i++ {
+		req, err := http.NewRequest(method, u, body)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for k, v := range host.Header {
+			req.Header[k] = append(req.Header[k], v...)
+		}
+		if body != nil {
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			req.Header.Set("Content-Type", contentType)
+		} else if contentType != "" {
+			req.Header.Set("Accept", contentType)
+		}
+		authorize := host.Authorizer != nil && req.URL.Host == host.Host
+		if authorize {
+			if err := host.Authorizer.Authorize(ctx, req); err != nil {
+				return nil, err
+			}
+		}
+		if r, ok := body.(*uploadBody); ok {
+			req.ContentLength = r.size
+			req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", r.offset, r.offset+r.size-1))
+		}
+		resp, err := ctxhttp.Do(ctx, host.Client, req)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && authorize && body == nil && i == 0 {
+			err := host.Authorizer.AddResponses(ctx, []*http.Response{resp})
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return resp, nil
+	}
+}
+
+type uploadBody struct {
+	io.Reader
+	offset int64
+	size   int64
+}
+
+// resumableWriter streams the data to the registry. The status reports the
+// offset the upload continues from, content.Copy only writes the rest.
+type resumableWriter struct {
+	ctx      context.Context
+	pusher   *resumablePusher
+	host     docker.RegistryHost
+	key      uploadKey
+	location string
+
+	mu       sync.Mutex
+	released bool
+	status   content.Status
+	pw       *io.PipeWriter
+	respC    chan response
+	// left is the number of bytes the current PATCH request still sends
+	left int64
+}
+
+type response struct {
+	*http.Response
+	err error
+}
+
+func (w *resumableWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var written int
+	for len(b) > 0 {
+		if w.pw == nil {
+			w.startPatch()
+		}
+		if w.left == 0 {
+			return written, errors.Errorf("unexpected data beyond size %d of %s", w.status.Total, w.key.dgst)
+		}
+		p := b
+		if int64(len(p)) > w.left {
+			p = p[:w.left]
+		}
+		n, err := w.pw.Write(p)
+		written += n
+		w.left -= int64(n)
+		w.status.Offset += int64(n)
+		w.status.UpdatedAt = time.Now()
+		if err != nil {
+			return written, err
+		}
+		if w.left == 0 && w.status.Offset < w.status.Total {
+			// the chunk is complete, the next write starts a new request
+			if err := w.wait(nil); err != nil {
+				return written, err
+			}
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+func (w *resumableWriter) startPatch() {
+	pr, pw := io.Pipe()
+	w.pw = pw
+	w.respC = make(chan response, 1)
+	size := w.status.Total - w.status.Offset
+	if w.pusher.chunkSize > 0 && size > w.pusher.chunkSize {
+		size = w.pusher.chunkSize
+	}
+	w.left = size
+	body := &uploadBody{Reader: pr, offset: w.status.Offset, size: size}
+	go func() {
+		resp, err := do(w.ctx, w.host, http.MethodPatch, w.location, body)
+		if err != nil {
+			pr.CloseWithError(err)
+		} else if resp.StatusCode != http.StatusAccepted {
+			resp.Body.Close()
+			err = errors.Errorf("unexpected status uploading %s: %s", w.key.dgst, resp.Status)
+			pr.CloseWithError(err)
+		} else {
+			resp.Body.Close()
+			pr.Close()
+		}
+		w.respC <- response{Response: resp, err: err}
+	}()
+}
+
+// wait closes the request body and waits for the PATCH response
+func (w *resumableWriter) wait(closeErr error) error {
+	if w.pw == nil {
+		return nil
+	}
+	if closeErr != nil {
+		w.pw.CloseWithError(closeErr)
+	} else {
+		w.pw.Close()
+	}
+	resp := <-w.respC
+	w.pw = nil
+	if resp.err != nil {
+		return resp.err
+	}
+	if loc := resp.Header.Get("Location"); loc != "" {
+		location, err := resolveLocation(w.host, loc)
+		if err != nil {
+			return err
+		}
+		w.location = location
+		w.pusher.uploads.set(w.key, location)
+	}
+	return nil
+}
+
+// Close aborts an upload that wasn't committed. The upload location is kept
+// so that the next push of the blob can resume it.
+func (w *resumableWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.wait(errUploadInterrupted)
+	w.release()
+	return nil
+}
+
+// release lets the other pushes of the blob continue
+func (w *resumableWriter) release() {
+	if !w.released {
+		w.released = true
+		w.pusher.uploads.release(w.key)
+	}
+}
+
+func (w *resumableWriter) Status() (content.Status, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status, nil
+}
+
+func (w *resumableWriter) Digest() digest.Digest {
+	return w.key.dgst
+}
+
+func (w *resumableWriter) Commit(ctx context.Context, size int64, expected digest.Digest, opts ...content.Opt) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if size > 0 && size != w.status.Offset {
+		w.wait(errUploadInterrupted)
+		return errors.Errorf("unexpected commit size %d, expected %d", w.status.Offset, size)
+	}
+	if err := w.wait(nil); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(w.location)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	q := u.Query()
+	q.Set("digest", w.key.dgst.String())
+	u.RawQuery = q.Encode()
+	resp, err := do(ctx, w.host, http.MethodPut, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent, http.StatusAccepted:
+	default:
+		return errors.Errorf("unexpected status committing %s: %s", w.key.dgst, resp.Status)
+	}
+	w.pusher.uploads.delete(w.key)
+	w.release()
+	return nil
+}
+
+func (w *resumableWriter) Truncate(size int64) error {
+	return errors.New("cannot truncate remote upload")
+}
+
+// resolveLocation returns the absolute URL of an upload location header
+func resolveLocation(host docker.RegistryHost, location string) (string, error) {
+	base, err := url.Parse(host.Scheme + "://" + host.Host)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	u, err := base.Parse(location)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid upload location %q", location)
+	}
+	return u.String(), nil
+}
+
+// parseRangeEnd returns the number of bytes received from a "0-<end>" range
+// header. Registries report empty uploads as "0-0".
+func parseRangeEnd(r string) (int64, error) {
+	if r == "" || r == "0-0" {
+		return 0, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r, "bytes="), "-", 2)
+	if len(parts) != 2 || parts[0] != "0" {
+		return 0, errors.Errorf("invalid upload range %q", r)
+	}
+	end, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid upload range %q", r)
+	}
+	return end + 1, nil
+}
@@ -0,0 +1,327 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestResumeUpload(t *testing.T) {
+	t.Parallel()
+
+	reg := newTestRegistry()
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	hosts := func(string) ([]docker.RegistryHost, error) {
+		return []docker.RegistryHost{{
+			Client:       srv.Client(),
+			Host:         u.Host,
+			Scheme:       "http",
+			Path:         "/v2",
+			Capabilities: docker.HostCapabilityPush | docker.HostCapabilityPull | docker.HostCapabilityResolve,
+		}}, nil
+	}
+
+	p, err := newResumablePusher(nil, u.Host+"/foo/bar:latest", hosts, 0)
+	require.NoError(t, err)
+	rp := p.(*resumablePusher)
+	rp.uploads = newUploadStore()
+
+	dt := bytes.Repeat([]byte("0123456789abcdef"), minResumableSize/8)
+	desc := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageLayerGzip,
+		Digest:    digest.FromBytes(dt),
+		Size:      int64(len(dt)),
+	}
+	ctx := context.TODO()
+
+	// interrupted push
+	w, err := rp.Push(ctx, desc)
+	require.NoError(t, err)
+	half := len(dt) / 2
+	_, err = w.Write(dt[:half])
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, 1, reg.uploadCount())
+
+	// resumed push only sends the rest
+	w, err = rp.Push(ctx, desc)
+	require.NoError(t, err)
+	st, err := w.Status()
+	require.NoError(t, err)
+	require.Equal(t, int64(half), st.Offset)
+	require.NoError(t, content.Copy(ctx, w, bytes.NewReader(dt), desc.Size, desc.Digest))
+	require.NoError(t, w.Close())
+	require.Equal(t, 1, reg.uploadCount())
+	require.Equal(t, dt, reg.blob(desc.Digest))
+	require.Equal(t, int64(len(dt)-half), reg.patched[1])
+
+	_, err = rp.Push(ctx, desc)
+	require.True(t, errdefs.IsAlreadyExists(err))
+	require.Len(t, rp.uploads.sessions, 0)
+	require.Len(t, rp.uploads.active, 0)
+
+	// small blobs are pushed by the wrapped pusher
+	rp.Pusher = pusherFunc(func(ctx context.Context, desc ocispecs.Descriptor) (content.Writer, error) {
+		return nil, errdefs.ErrNotImplemented
+	})
+	_, err = rp.Push(ctx, ocispecs.Descriptor{MediaType: ocispecs.MediaTypeImageLayerGzip, Digest: digest.FromBytes([]byte("foo")), Size: 3})
+	require.True(t, errdefs.IsNotImplemented(err))
+}
+
+func TestChunkedUpload(t *testing.T) {
+	t.Parallel()
+
+	reg := newTestRegistry()
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	hosts := func(string) ([]docker.RegistryHost, error) {
+		return []docker.RegistryHost{{
+			Client:       srv.Client(),
+			Host:         u.Host,
+			Scheme:       "http",
+			Path:         "/v2",
+			Capabilities: docker.HostCapabilityPush | docker.HostCapabilityPull | docker.HostCapabilityResolve,
+		}}, nil
+	}
+
+	const chunkSize = minResumableSize / 2
+	p, err := newResumablePusher(nil, u.Host+"/foo/bar:latest", hosts, chunkSize)
+	require.NoError(t, err)
+	rp := p.(*resumablePusher)
+	rp.uploads = newUploadStore()
+
+	dt := bytes.Repeat([]byte("0123456789abcdef"), minResumableSize/7)
+	desc := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageLayerGzip,
+		Digest:    digest.FromBytes(dt),
+		Size:      int64(len(dt)),
+	}
+	ctx := context.TODO()
+
+	w, err := rp.Push(ctx, desc)
+	require.NoError(t, err)
+	require.NoError(t, content.Copy(ctx, w, bytes.NewReader(dt), desc.Size, desc.Digest))
+	require.NoError(t, w.Close())
+	require.Equal(t, dt, reg.blob(desc.Digest))
+	require.Equal(t, []int64{chunkSize, chunkSize, chunkSize, chunkSize, int64(len(dt)) - 4*chunkSize}, reg.patched)
+
+	// writes beyond the size of the blob fail
+	w, err = rp.Push(ctx, ocispecs.Descriptor{MediaType: ocispecs.MediaTypeImageLayerGzip, Digest: digest.FromBytes(dt[:minResumableSize]), Size: minResumableSize})
+	require.NoError(t, err)
+	_, err = w.Write(dt[:minResumableSize+1])
+	require.Error(t, err)
+	require.NoError(t, w.Close())
+}
+
+func TestConcurrentPush(t *testing.T) {
+	t.Parallel()
+
+	reg := newTestRegistry()
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	hosts := func(string) ([]docker.RegistryHost, error) {
+		return []docker.RegistryHost{{
+			Client:       srv.Client(),
+			Host:         u.Host,
+			Scheme:       "http",
+			Path:         "/v2",
+			Capabilities: docker.HostCapabilityPush | docker.HostCapabilityPull | docker.HostCapabilityResolve,
+		}}, nil
+	}
+
+	p, err := newResumablePusher(nil, u.Host+"/foo/bar:latest", hosts, 0)
+	require.NoError(t, err)
+	rp := p.(*resumablePusher)
+	rp.uploads = newUploadStore()
+
+	dt := bytes.Repeat([]byte("0123456789abcdef"), minResumableSize/8)
+	desc := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageLayerGzip,
+		Digest:    digest.FromBytes(dt),
+		Size:      int64(len(dt)),
+	}
+
+	// the pushes of the same blob wait for the one that uploads it
+	eg, ctx := errgroup.WithContext(context.TODO())
+	for i := 0; i < 4; i++ {
+		eg.Go(func() error {
+			w, err := rp.Push(ctx, desc)
+			if errdefs.IsAlreadyExists(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			defer w.Close()
+			return content.Copy(ctx, w, bytes.NewReader(dt), desc.Size, desc.Digest)
+		})
+	}
+	require.NoError(t, eg.Wait())
+	require.Equal(t, dt, reg.blob(desc.Digest))
+	require.Equal(t, []int64{int64(len(dt))}, reg.patched)
+	require.Len(t, rp.uploads.active, 0)
+}
+
+func TestUploadSessionExpiry(t *testing.T) {
+	now := time.Now()
+	s := newUploadStore()
+	s.now = func() time.Time {
+		return now
+	}
+	ctx := context.TODO()
+	k := uploadKey{host: "example.com", repo: "foo/bar", dgst: digest.FromString("foo")}
+	s.set(k, "https://example.com/v2/foo/bar/blobs/uploads/1")
+
+	location, ok, err := s.acquire(ctx, k)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "https://example.com/v2/foo/bar/blobs/uploads/1", location)
+
+	// other pushes of the blob wait for the release
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, _, err = s.acquire(ctx2, k)
+	require.Equal(t, context.DeadlineExceeded, err)
+	s.release(k)
+
+	now = now.Add(uploadSessionTTL + time.Minute)
+	_, ok, err = s.acquire(ctx, k)
+	require.NoError(t, err)
+	require.False(t, ok)
+	s.release(k)
+	require.Len(t, s.sessions, 0)
+}
+
+func TestParseRangeEnd(t *testing.T) {
+	for r, expected := range map[string]int64{"": 0, "0-0": 0, "0-9": 10, "bytes=0-99": 100} {
+		n, err := parseRangeEnd(r)
+		require.NoError(t, err)
+		require.Equal(t, expected, n, r)
+	}
+	_, err := parseRangeEnd("5-9")
+	require.Error(t, err)
+}
+
+type pusherFunc func(ctx context.Context, desc ocispecs.Descriptor) (content.Writer, error)
+
+func (f pusherFunc) Push(ctx context.Context, desc ocispecs.Descriptor) (content.Writer, error) {
+	return f(ctx, desc)
+}
+
+var _ remotes.Pusher = pusherFunc(nil)
+
+// testRegistry implements the blob upload endpoints of the registry API
+type testRegistry struct {
+	mu      sync.Mutex
+	uploads map[string]*bytes.Buffer
+	blobs   map[digest.Digest][]byte
+	patched []int64
+}
+
+func newTestRegistry() *testRegistry {
+	return &testRegistry{
+		uploads: map[string]*bytes.Buffer{},
+		blobs:   map[digest.Digest][]byte{},
+	}
+}
+
+func (r *testRegistry) uploadCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.uploads) + len(r.blobs)
+}
+
+func (r *testRegistry) blob(dgst digest.Digest) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.blobs[dgst]
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	const uploadsPrefix = "/v2/foo/bar/blobs/uploads/"
+	switch {
+	case req.Method == http.MethodHead && strings.HasPrefix(req.URL.Path, "/v2/foo/bar/blobs/"):
+		r.mu.Lock()
+		_, ok := r.blobs[digest.Digest(strings.TrimPrefix(req.URL.Path, "/v2/foo/bar/blobs/"))]
+		r.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case req.Method == http.MethodPost && req.URL.Path == uploadsPrefix:
+		r.mu.Lock()
+		id := fmt.Sprintf("upload%d", len(r.uploads))
+		r.uploads[id] = &bytes.Buffer{}
+		r.mu.Unlock()
+		w.Header().Set("Location", uploadsPrefix+id)
+		w.WriteHeader(http.StatusAccepted)
+	case strings.HasPrefix(req.URL.Path, uploadsPrefix):
+		id := strings.TrimPrefix(req.URL.Path, uploadsPrefix)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		buf, ok := r.uploads[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch req.Method {
+		case http.MethodGet:
+			end := buf.Len() - 1
+			if end < 0 {
+				end = 0
+			}
+			w.Header().Set("Range", fmt.Sprintf("0-%d", end))
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodPatch:
+			if rng := req.Header.Get("Content-Range"); !strings.HasPrefix(rng, fmt.Sprintf("%d-", buf.Len())) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			// keep what was received from interrupted requests
+			n, _ := buf.ReadFrom(req.Body)
+			r.patched = append(r.patched, n)
+			w.Header().Set("Location", uploadsPrefix+id)
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodPut:
+			dgst := digest.Digest(req.URL.Query().Get("digest"))
+			dt, _ := ioutil.ReadAll(buf)
+			if digest.FromBytes(dt) != dgst {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			delete(r.uploads, id)
+			r.blobs[dgst] = dt
+			w.WriteHeader(http.StatusCreated)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
@@ -0,0 +1,232 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/docker/distribution/reference"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/sign"
+	"github.com/moby/buildkit/util/resolver"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MediaTypeSimpleSigning is the media type of cosign signature payloads
+	MediaTypeSimpleSigning = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// AnnotationSignature is the annotation holding the base64 encoded
+	// signature of the payload
+	AnnotationSignature = "dev.cosignproject.cosign/signature"
+
+	simpleSigningType = "cosign container image signature"
+)
+
+type simpleSigning struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest digest.Digest `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]string `json:"optional"`
+}
+
+// Sign signs the manifest dgst that was pushed to ref with the session
+// provided key keyID and pushes the signature to the repository of ref in
+// the format used by cosign. Like cosign, the signature is added as a layer
+// to the signatures of dgst that already exist in the repository.
+func Sign(ctx context.Context, sm *session.Manager, sid string, store content.Store, hosts docker.RegistryHosts, dgst digest.Digest, ref string, insecure bool, keyID string, opt Opt) error {
+	parsed, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return err
+	}
+	repo := reference.TrimNamed(parsed)
+	sigRef, err := reference.WithTag(repo, signatureTag(dgst))
+	if err != nil {
+		return err
+	}
+
+	done := oneOffProgress(ctx, "signing "+dgst.String())
+	payload, err := signaturePayload(repo, dgst)
+	if err != nil {
+		return done(err)
+	}
+	sig, err := sign.Sign(ctx, sm, session.NewGroup(sid), keyID, payload)
+	if err != nil {
+		return done(errors.Wrapf(err, "failed to sign %s", dgst))
+	}
+	existing, err := fetchSignatures(ctx, sm, sid, store, hosts, sigRef, insecure)
+	if err != nil {
+		return done(err)
+	}
+	desc, err := writeSignatureManifest(ctx, store, existing, payload, sig)
+	if err := done(err); err != nil {
+		return err
+	}
+	return Push(ctx, sm, sid, store, store, desc.Digest, sigRef.String(), insecure, hosts, false, nil, opt)
+}
+
+// fetchSignatures returns the layers of the signature manifest sigRef in
+// the registry, nil if there is none. The layers are written to the content
+// store so they are pushed with the new signature manifest.
+func fetchSignatures(ctx context.Context, sm *session.Manager, sid string, store content.Store, hosts docker.RegistryHosts, sigRef reference.Named, insecure bool) ([]ocispecs.Descriptor, error) {
+	hosts, scope := pushHosts(hosts, sigRef, insecure)
+	r := resolver.DefaultPool.GetResolver(hosts, sigRef.String(), scope, sm, session.NewGroup(sid))
+	_, desc, err := r.Resolve(ctx, sigRef.String())
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to resolve %s", sigRef)
+	}
+	fetcher, err := r.Fetcher(ctx, sigRef.String())
+	if err != nil {
+		return nil, err
+	}
+	dt, err := fetchBlob(ctx, fetcher, desc)
+	if err != nil {
+		return nil, err
+	}
+	var mfst ocispecs.Manifest
+	if err := json.Unmarshal(dt, &mfst); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse signature manifest %s", sigRef)
+	}
+	for _, l := range mfst.Layers {
+		if l.MediaType != MediaTypeSimpleSigning {
+			return nil, errors.Errorf("unexpected layer media type %s in signature manifest %s", l.MediaType, sigRef)
+		}
+		dt, err := fetchBlob(ctx, fetcher, l)
+		if err != nil {
+			return nil, err
+		}
+		if err := content.WriteBlob(ctx, store, l.Digest.String(), bytes.NewReader(dt), l); err != nil {
+			return nil, errors.Wrap(err, "error writing signature blob")
+		}
+	}
+	return mfst.Layers, nil
+}
+
+// fetchBlob reads the blob of desc and verifies its digest
+func fetchBlob(ctx context.Context, fetcher remotes.Fetcher, desc ocispecs.Descriptor) ([]byte, error) {
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch %s", desc.Digest)
+	}
+	dt, err := ioutil.ReadAll(io.LimitReader(rc, desc.Size+1))
+	rc.Close()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", desc.Digest)
+	}
+	if int64(len(dt)) != desc.Size || digest.FromBytes(dt) != desc.Digest {
+		return nil, errors.Errorf("blob %s does not match its digest", desc.Digest)
+	}
+	return dt, nil
+}
+
+// signatureTag returns the tag cosign looks up the signatures of dgst by
+func signatureTag(dgst digest.Digest) string {
+	return strings.Replace(dgst.String(), ":", "-", 1) + ".sig"
+}
+
+func signaturePayload(repo reference.Named, dgst digest.Digest) ([]byte, error) {
+	var p simpleSigning
+	p.Critical.Identity.DockerReference = repo.String()
+	p.Critical.Image.DockerManifestDigest = dgst
+	p.Critical.Type = simpleSigningType
+	dt, err := json.Marshal(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal signature payload")
+	}
+	return dt, nil
+}
+
+// writeSignatureManifest writes a manifest with the existing signature
+// layers and payload as the last layer to the content store
+func writeSignatureManifest(ctx context.Context, store content.Store, existing []ocispecs.Descriptor, payload, sig []byte) (*ocispecs.Descriptor, error) {
+	layer := ocispecs.Descriptor{
+		MediaType: MediaTypeSimpleSigning,
+		Digest:    digest.FromBytes(payload),
+		Size:      int64(len(payload)),
+		Annotations: map[string]string{
+			AnnotationSignature: base64.StdEncoding.EncodeToString(sig),
+		},
+	}
+	if err := content.WriteBlob(ctx, store, layer.Digest.String(), bytes.NewReader(payload), layer); err != nil {
+		return nil, errors.Wrap(err, "error writing signature blob")
+	}
+	layers := append(append([]ocispecs.Descriptor{}, existing...), layer)
+	diffIDs := make([]digest.Digest, len(layers))
+	for i, l := range layers {
+		diffIDs[i] = l.Digest
+	}
+
+	config, err := json.Marshal(ocispecs.Image{
+		RootFS: ocispecs.RootFS{
+			Type:    "layers",
+			DiffIDs: diffIDs,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal signature config")
+	}
+	configDesc := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageConfig,
+		Digest:    digest.FromBytes(config),
+		Size:      int64(len(config)),
+	}
+	if err := content.WriteBlob(ctx, store, configDesc.Digest.String(), bytes.NewReader(config), configDesc); err != nil {
+		return nil, errors.Wrap(err, "error writing config blob")
+	}
+
+	mfst := struct {
+		// MediaType is reserved in the OCI spec but
+		// excluded from go types.
+		MediaType string `json:"mediaType,omitempty"`
+
+		ocispecs.Manifest
+	}{
+		MediaType: ocispecs.MediaTypeImageManifest,
+		Manifest: ocispecs.Manifest{
+			Versioned: specs.Versioned{
+				SchemaVersion: 2,
+			},
+			Config: configDesc,
+			Layers: layers,
+		},
+	}
+	mfstJSON, err := json.Marshal(mfst)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal manifest")
+	}
+	desc := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(mfstJSON),
+		Size:      int64(len(mfstJSON)),
+	}
+	labels := map[string]string{
+		"containerd.io/gc.ref.content.0": configDesc.Digest.String(),
+	}
+	for i, l := range layers {
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.%d", i+1)] = l.Digest.String()
+	}
+	if err := content.WriteBlob(ctx, store, desc.Digest.String(), bytes.NewReader(mfstJSON), desc, content.WithLabels(labels)); err != nil {
+		return nil, errors.Wrapf(err, "error writing manifest blob %s", desc.Digest)
+	}
+	return &desc, nil
+}
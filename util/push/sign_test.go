@@ -0,0 +1,143 @@
+package push
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/docker/distribution/reference"
+	"github.com/moby/buildkit/session/sign"
+	"github.com/moby/buildkit/session/sign/signprovider"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignatureManifest(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	cs, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	dgst := digest.FromString("manifest")
+	require.Equal(t, "sha256-"+dgst.Hex()+".sig", signatureTag(dgst))
+
+	repo, err := reference.ParseNormalizedNamed("example.com/foo/bar")
+	require.NoError(t, err)
+	payload, err := signaturePayload(repo, dgst)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"critical":{"identity":{"docker-reference":"example.com/foo/bar"},"image":{"docker-manifest-digest":"`+dgst.String()+`"},"type":"cosign container image signature"},"optional":null}`, string(payload))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	resp, err := signprovider.FromMap(map[string]crypto.Signer{"mykey": key}).(sign.SignerServer).Sign(ctx, &sign.SignRequest{Payload: payload})
+	require.NoError(t, err)
+
+	desc, err := writeSignatureManifest(ctx, cs, nil, payload, resp.Signature)
+	require.NoError(t, err)
+	require.Equal(t, ocispecs.MediaTypeImageManifest, desc.MediaType)
+
+	dt, err := content.ReadBlob(ctx, cs, *desc)
+	require.NoError(t, err)
+	var mfst ocispecs.Manifest
+	require.NoError(t, json.Unmarshal(dt, &mfst))
+	require.Equal(t, 1, len(mfst.Layers))
+	require.Equal(t, MediaTypeSimpleSigning, mfst.Layers[0].MediaType)
+
+	dt, err = content.ReadBlob(ctx, cs, mfst.Layers[0])
+	require.NoError(t, err)
+	require.Equal(t, payload, dt)
+
+	sig, err := base64.StdEncoding.DecodeString(mfst.Layers[0].Annotations[AnnotationSignature])
+	require.NoError(t, err)
+	h := sha256.Sum256(payload)
+	require.True(t, ecdsa.VerifyASN1(&key.PublicKey, h[:], sig))
+}
+
+func TestAppendSignature(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	cs, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+	dgst := digest.FromString("manifest")
+	repo, err := reference.ParseNormalizedNamed("example.com/foo/bar")
+	require.NoError(t, err)
+	payload, err := signaturePayload(repo, dgst)
+	require.NoError(t, err)
+
+	// the signature of another key that is already in the registry
+	other, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+	existing, err := writeSignatureManifest(ctx, other, nil, payload, []byte("othersig"))
+	require.NoError(t, err)
+	mfst, err := content.ReadBlob(ctx, other, *existing)
+	require.NoError(t, err)
+	var m ocispecs.Manifest
+	require.NoError(t, json.Unmarshal(mfst, &m))
+	blob, err := content.ReadBlob(ctx, other, m.Layers[0])
+	require.NoError(t, err)
+
+	reg := &manifestRegistry{manifests: map[string][]byte{
+		signatureTag(dgst):       mfst,
+		existing.Digest.String(): mfst,
+	}}
+	mux := http.NewServeMux()
+	mux.Handle("/v2/foo/bar/manifests/", reg)
+	mux.HandleFunc("/v2/foo/bar/blobs/"+m.Layers[0].Digest.String(), func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+		w.Write(blob)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	hosts := func(string) ([]docker.RegistryHost, error) {
+		return []docker.RegistryHost{{
+			Client:       srv.Client(),
+			Host:         u.Host,
+			Scheme:       "http",
+			Path:         "/v2",
+			Capabilities: docker.HostCapabilityPush | docker.HostCapabilityPull | docker.HostCapabilityResolve,
+		}}, nil
+	}
+
+	sigRef, err := reference.ParseNormalizedNamed(u.Host + "/foo/bar:" + signatureTag(dgst))
+	require.NoError(t, err)
+	layers, err := fetchSignatures(ctx, nil, "", cs, hosts, sigRef, false)
+	require.NoError(t, err)
+	require.Equal(t, m.Layers, layers)
+	dt, err := content.ReadBlob(ctx, cs, layers[0])
+	require.NoError(t, err)
+	require.Equal(t, blob, dt)
+
+	desc, err := writeSignatureManifest(ctx, cs, layers, payload, []byte("sig"))
+	require.NoError(t, err)
+	dt, err = content.ReadBlob(ctx, cs, *desc)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(dt, &m))
+	require.Equal(t, 2, len(m.Layers))
+	require.Equal(t, "b3RoZXJzaWc=", m.Layers[0].Annotations[AnnotationSignature])
+	require.Equal(t, "c2ln", m.Layers[1].Annotations[AnnotationSignature])
+
+	// images that weren't signed have no signatures
+	sigRef, err = reference.ParseNormalizedNamed(u.Host + "/foo/bar:" + signatureTag(digest.FromString("other")))
+	require.NoError(t, err)
+	layers, err = fetchSignatures(ctx, nil, "", cs, hosts, sigRef, false)
+	require.NoError(t, err)
+	require.Nil(t, layers)
+}
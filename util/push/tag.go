@@ -0,0 +1,97 @@
+package push
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/docker/distribution/reference"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/util/resolver"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// Tag adds tags to the manifest that ref points to in the registry. The
+// manifest is copied to the tags in the repository of ref without
+// transferring any layers.
+func Tag(ctx context.Context, sm *session.Manager, sid string, hosts docker.RegistryHosts, ref string, tags []string, insecure bool) (digest.Digest, error) {
+	parsed, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", err
+	}
+	if reference.IsNameOnly(parsed) {
+		return "", errors.Errorf("ref %s has no tag or digest", ref)
+	}
+	targets, err := tagRefs(parsed, tags)
+	if err != nil {
+		return "", err
+	}
+
+	hosts, scope := pushHosts(hosts, parsed, insecure)
+	r := resolver.DefaultPool.GetResolver(hosts, parsed.String(), scope, sm, session.NewGroup(sid))
+
+	_, desc, err := r.Resolve(ctx, parsed.String())
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve %s", ref)
+	}
+	fetcher, err := r.Fetcher(ctx, parsed.String())
+	if err != nil {
+		return "", err
+	}
+	dt, err := fetchBlob(ctx, fetcher, desc)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to fetch manifest of %s", ref)
+	}
+
+	for _, target := range targets {
+		done := oneOffProgress(ctx, "tagging "+target)
+		pusher, err := r.Pusher(ctx, target)
+		if err != nil {
+			return "", done(err)
+		}
+		push := pusher.Push
+		if ing, ok := pusher.(content.Ingester); ok {
+			// the push tracker is shared by the pushers of the repository,
+			// so the manifest needs a separate ref for every tag
+			target := target
+			push = func(ctx context.Context, desc ocispecs.Descriptor) (content.Writer, error) {
+				return ing.Writer(ctx, content.WithRef("tag-"+target), content.WithDescriptor(desc))
+			}
+		}
+		if err := done(writeManifest(ctx, push, desc, dt)); err != nil {
+			return "", errors.Wrapf(err, "failed to tag %s", target)
+		}
+	}
+	return desc.Digest, nil
+}
+
+func tagRefs(ref reference.Named, tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, errors.New("no tags specified")
+	}
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		r, err := reference.WithTag(reference.TrimNamed(ref), t)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid tag %q", t)
+		}
+		out = append(out, r.String())
+	}
+	return out, nil
+}
+
+func writeManifest(ctx context.Context, push func(context.Context, ocispecs.Descriptor) (content.Writer, error), desc ocispecs.Descriptor, dt []byte) error {
+	w, err := push(ctx, desc)
+	if err != nil {
+		if errdefs.IsAlreadyExists(err) {
+			return nil
+		}
+		return err
+	}
+	defer w.Close()
+	return content.Copy(ctx, w, bytes.NewReader(dt), desc.Size, desc.Digest)
+}
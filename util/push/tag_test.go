@@ -0,0 +1,126 @@
+package push
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/docker/distribution/reference"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTag(t *testing.T) {
+	t.Parallel()
+
+	mfst := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+	dgst := digest.FromBytes(mfst)
+	reg := &manifestRegistry{manifests: map[string][]byte{
+		"staging":     mfst,
+		dgst.String(): mfst,
+	}}
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	hosts := func(string) ([]docker.RegistryHost, error) {
+		return []docker.RegistryHost{{
+			Client:       srv.Client(),
+			Host:         u.Host,
+			Scheme:       "http",
+			Path:         "/v2",
+			Capabilities: docker.HostCapabilityPush | docker.HostCapabilityPull | docker.HostCapabilityResolve,
+		}}, nil
+	}
+
+	got, err := Tag(context.TODO(), nil, "", hosts, u.Host+"/foo/bar:staging", []string{"prod", "v1"}, false)
+	require.NoError(t, err)
+	require.Equal(t, dgst, got)
+	require.Equal(t, mfst, reg.get("prod"))
+	require.Equal(t, mfst, reg.get("v1"))
+
+	got, err = Tag(context.TODO(), nil, "", hosts, u.Host+"/foo/bar@"+dgst.String(), []string{"prod"}, false)
+	require.NoError(t, err)
+	require.Equal(t, dgst, got)
+
+	_, err = Tag(context.TODO(), nil, "", hosts, u.Host+"/foo/bar:missing", []string{"prod"}, false)
+	require.Error(t, err)
+
+	_, err = Tag(context.TODO(), nil, "", hosts, u.Host+"/foo/bar", []string{"prod"}, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no tag or digest")
+}
+
+func TestTagRefs(t *testing.T) {
+	ref, err := reference.ParseNormalizedNamed("example.com/foo/bar:staging")
+	require.NoError(t, err)
+
+	refs, err := tagRefs(ref, []string{"prod", "v1.0"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"example.com/foo/bar:prod", "example.com/foo/bar:v1.0"}, refs)
+
+	_, err = tagRefs(ref, nil)
+	require.Error(t, err)
+
+	_, err = tagRefs(ref, []string{"other/repo:prod"})
+	require.Error(t, err)
+}
+
+// manifestRegistry implements the manifest endpoints of the registry API for
+// the foo/bar repository
+type manifestRegistry struct {
+	mu        sync.Mutex
+	manifests map[string][]byte
+}
+
+func (r *manifestRegistry) get(ref string) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.manifests[ref]
+}
+
+func (r *manifestRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	const prefix = "/v2/foo/bar/manifests/"
+	if !strings.HasPrefix(req.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	ref := strings.TrimPrefix(req.URL.Path, prefix)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch req.Method {
+	case http.MethodHead, http.MethodGet:
+		dt, ok := r.manifests[ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", ocispecs.MediaTypeImageManifest)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(dt).String())
+		w.Header().Set("Content-Length", strconv.Itoa(len(dt)))
+		w.WriteHeader(http.StatusOK)
+		if req.Method == http.MethodGet {
+			w.Write(dt)
+		}
+	case http.MethodPut:
+		dt, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.manifests[ref] = dt
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(dt).String())
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
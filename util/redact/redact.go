@@ -0,0 +1,55 @@
+// Package redact hides values that may contain credentials, e.g. build args
+// and cache attributes that are recorded or attested.
+package redact
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Mask replaces the values that are redacted
+const Mask = "*****"
+
+// secretKeyParts are parts of names whose values are redacted
+var secretKeyParts = []string{"SECRET", "PASSWORD", "PASSWD", "TOKEN", "CREDENTIAL", "PRIVATE", "APIKEY", "API_KEY", "ACCESS_KEY", "AUTH"}
+
+// IsSecretKey returns true if the values of the key k look like secrets
+func IsSecretKey(k string) bool {
+	uk := strings.ToUpper(k)
+	for _, p := range secretKeyParts {
+		if strings.Contains(uk, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Value hides the value v of k if k looks like it holds a secret and the
+// password of v if it's a URL with credentials, e.g. of a proxy. It returns
+// true if v was changed.
+func Value(k, v string) (string, bool) {
+	if v == "" {
+		return v, false
+	}
+	if IsSecretKey(k) {
+		return Mask, true
+	}
+	if u, err := url.Parse(v); err == nil && u.User != nil {
+		if pw, ok := u.User.Password(); ok && pw != "" {
+			return strings.Replace(v, ":"+pw+"@", ":"+Mask+"@", 1), true
+		}
+	}
+	return v, false
+}
+
+// Map returns a copy of m with the values redacted by Value
+func Map(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k], _ = Value(k, v)
+	}
+	return out
+}
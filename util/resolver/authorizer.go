@@ -22,25 +22,43 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// workerSessionID is the session the handlers using the worker credentials
+// are stored for
+const workerSessionID = "worker"
+
 type authHandlerNS struct {
 	counter int64 // needs to be 64bit aligned for 32bit systems
 
-	mu       sync.Mutex
-	handlers map[string]*authHandler
-	hosts    map[string][]docker.RegistryHost
-	sm       *session.Manager
-	g        flightcontrol.Group
+	mu          sync.Mutex
+	handlers    map[string]*authHandler
+	hosts       map[string][]docker.RegistryHost
+	sm          *session.Manager
+	credentials WorkerCredentials
+	g           flightcontrol.Group
 }
 
-func newAuthHandlerNS(sm *session.Manager) *authHandlerNS {
+func newAuthHandlerNS(sm *session.Manager, credentials WorkerCredentials) *authHandlerNS {
 	return &authHandlerNS{
-		handlers: map[string]*authHandler{},
-		hosts:    map[string][]docker.RegistryHost{},
-		sm:       sm,
+		handlers:    map[string]*authHandler{},
+		hosts:       map[string][]docker.RegistryHost{},
+		sm:          sm,
+		credentials: credentials,
 	}
 }
 
-func (a *authHandlerNS) get(ctx context.Context, host string, sm *session.Manager, g session.Group) *authHandler {
+// get returns the handler for host. workerCreds are the current worker
+// credentials for host, a handler for expired or rotated worker credentials
+// is removed.
+func (a *authHandlerNS) get(ctx context.Context, host string, sm *session.Manager, g session.Group, workerCreds *credentials) *authHandler {
+	// the worker credentials are shared by all sessions
+	if h, ok := a.handlers[host+"/"+workerSessionID]; ok {
+		if workerCreds != nil && h.common.Username == workerCreds.username && h.common.Secret == workerCreds.secret {
+			h.lastUsed = time.Now()
+			return h
+		}
+		a.delete(h)
+	}
+
 	if g != nil {
 		if iter := g.SessionIterator(); iter != nil {
 			for {
@@ -118,11 +136,15 @@ func newDockerAuthorizer(client *http.Client, handlers *authHandlerNS, sm *sessi
 
 // Authorize handles auth request.
 func (a *dockerAuthorizer) Authorize(ctx context.Context, req *http.Request) error {
+	// the worker credentials may be exchanged with the cloud provider, so
+	// they are fetched before the handlers of all hosts are locked
+	workerCreds := a.getWorkerCredentials(ctx, req.URL.Host)
+
 	a.handlers.mu.Lock()
 	defer a.handlers.mu.Unlock()
 
 	// skip if there is no auth handler
-	ah := a.handlers.get(ctx, req.URL.Host, a.sm, a.session)
+	ah := a.handlers.get(ctx, req.URL.Host, a.sm, a.session, workerCreds)
 	if ah == nil {
 		return nil
 	}
@@ -136,18 +158,47 @@ func (a *dockerAuthorizer) Authorize(ctx context.Context, req *http.Request) err
 	return nil
 }
 
-func (a *dockerAuthorizer) getCredentials(host string) (sessionID, username, secret string, err error) {
+func (a *dockerAuthorizer) getCredentials(host string, workerCreds *credentials) (sessionID, username, secret string, err error) {
+	if workerCreds != nil {
+		return workerSessionID, workerCreds.username, workerCreds.secret, nil
+	}
 	return sessionauth.CredentialsFunc(a.sm, a.session)(host)
 }
 
-func (a *dockerAuthorizer) AddResponses(ctx context.Context, responses []*http.Response) error {
-	a.handlers.mu.Lock()
-	defer a.handlers.mu.Unlock()
+// credentials are a username and secret for a registry
+type credentials struct {
+	username string
+	secret   string
+}
 
+// getWorkerCredentials returns the credentials the daemon has itself for
+// host, nil if it has none. If they can't be obtained the client is asked
+// for credentials.
+func (a *dockerAuthorizer) getWorkerCredentials(ctx context.Context, host string) *credentials {
+	if a.handlers.credentials == nil {
+		return nil
+	}
+	username, secret, ok, err := a.handlers.credentials(ctx, host)
+	if err != nil {
+		log.G(ctx).WithError(err).Warnf("failed to get worker credentials for %s, falling back to session credentials", host)
+		return nil
+	}
+	if !ok || secret == "" {
+		return nil
+	}
+	return &credentials{username: username, secret: secret}
+}
+
+func (a *dockerAuthorizer) AddResponses(ctx context.Context, responses []*http.Response) error {
 	last := responses[len(responses)-1]
 	host := last.Request.URL.Host
 
-	handler := a.handlers.get(ctx, host, a.sm, a.session)
+	workerCreds := a.getWorkerCredentials(ctx, host)
+
+	a.handlers.mu.Lock()
+	defer a.handlers.mu.Unlock()
+
+	handler := a.handlers.get(ctx, host, a.sm, a.session, workerCreds)
 
 	for _, c := range auth.ParseAuthHeader(last.Header) {
 		if c.Scheme == auth.BearerAuth {
@@ -176,16 +227,23 @@ func (a *dockerAuthorizer) AddResponses(ctx context.Context, responses []*http.R
 				return nil
 			}
 
+			var pubKey *[32]byte
+			var err error
 			var username, secret string
-			session, pubKey, err := sessionauth.GetTokenAuthority(ctx, host, a.sm, a.session)
-			if err != nil {
-				return err
-			}
-			if pubKey == nil {
-				session, username, secret, err = a.getCredentials(host)
+			session := workerSessionID
+			if workerCreds != nil {
+				username, secret = workerCreds.username, workerCreds.secret
+			} else {
+				session, pubKey, err = sessionauth.GetTokenAuthority(ctx, host, a.sm, a.session)
 				if err != nil {
 					return err
 				}
+				if pubKey == nil {
+					session, username, secret, err = sessionauth.CredentialsFunc(a.sm, a.session)(host)
+					if err != nil {
+						return err
+					}
+				}
 			}
 
 			common, err := auth.GenerateTokenOptions(ctx, host, username, secret, c)
@@ -198,7 +256,7 @@ func (a *dockerAuthorizer) AddResponses(ctx context.Context, responses []*http.R
 
 			return nil
 		} else if c.Scheme == auth.BasicAuth {
-			session, username, secret, err := a.getCredentials(host)
+			session, username, secret, err := a.getCredentials(host, workerCreds)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,49 @@
+package resolver
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerCredentialsRotation(t *testing.T) {
+	secret := "secret1"
+	var ns *authHandlerNS
+	ns = newAuthHandlerNS(nil, func(ctx context.Context, host string) (string, string, bool, error) {
+		// the credentials are fetched without holding the handlers
+		require.True(t, ns.mu.TryLock())
+		ns.mu.Unlock()
+		return "AWS", secret, true, nil
+	})
+	a := newDockerAuthorizer(http.DefaultClient, ns, nil, nil)
+
+	authorize := func() string {
+		req := &http.Request{URL: &url.URL{Scheme: "https", Host: "example.com", Path: "/v2/"}, Header: http.Header{}}
+		require.NoError(t, a.Authorize(context.TODO(), req))
+		return req.Header.Get("Authorization")
+	}
+	challenge := func() {
+		req := &http.Request{URL: &url.URL{Scheme: "https", Host: "example.com", Path: "/v2/"}}
+		resp := &http.Response{StatusCode: http.StatusUnauthorized, Request: req, Header: http.Header{}}
+		resp.Header.Set("WWW-Authenticate", `Basic realm="example.com"`)
+		require.NoError(t, a.AddResponses(context.TODO(), []*http.Response{resp}))
+	}
+	basic := func(secret string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte("AWS:"+secret))
+	}
+
+	require.Equal(t, "", authorize())
+	challenge()
+	require.Equal(t, basic("secret1"), authorize())
+
+	// the handler of expired credentials is dropped, so that the next
+	// challenge uses the new ones
+	secret = "secret2"
+	require.Equal(t, "", authorize())
+	challenge()
+	require.Equal(t, basic("secret2"), authorize())
+}
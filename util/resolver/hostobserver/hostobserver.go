@@ -0,0 +1,37 @@
+package hostobserver
+
+import (
+	"context"
+	"net/http"
+)
+
+type observerKey struct{}
+
+// WithObserver returns a context that reports the registry host of every
+// successful request made with it to f. Requests following a redirect are
+// not reported, so f sees the registry or mirror and not the blob storage
+// backing it.
+func WithObserver(ctx context.Context, f func(host string)) context.Context {
+	return context.WithValue(ctx, observerKey{}, f)
+}
+
+// NewTransport wraps rt so that requests report their host to the observer
+// set in the request context.
+func NewTransport(rt http.RoundTripper) http.RoundTripper {
+	return &transport{rt: rt}
+}
+
+type transport struct {
+	rt http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if f, ok := req.Context().Value(observerKey{}).(func(string)); ok && req.Response == nil && resp.StatusCode < 400 {
+		f(req.URL.Host)
+	}
+	return resp, nil
+}
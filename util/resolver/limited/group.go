@@ -196,7 +196,12 @@ func FetchHandler(ingester content.Ingester, fetcher remotes.Fetcher, ref string
 }
 
 func PushHandler(pusher remotes.Pusher, provider content.Provider, ref string) images.HandlerFunc {
-	return remotes.PushHandler(Default.WrapPusher(pusher, ref), provider)
+	return Default.PushHandler(pusher, provider, ref)
+}
+
+// PushHandler returns a handler pushing content with the limits of the group
+func (g *Group) PushHandler(pusher remotes.Pusher, provider content.Provider, ref string) images.HandlerFunc {
+	return remotes.PushHandler(g.WrapPusher(pusher, ref), provider)
 }
 
 func domain(ref string) string {
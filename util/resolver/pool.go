@@ -22,10 +22,16 @@ var DefaultPool = NewPool()
 
 // Pool is a cache of recently used resolvers
 type Pool struct {
-	mu sync.Mutex
-	m  map[string]*authHandlerNS
+	mu          sync.Mutex
+	m           map[string]*authHandlerNS
+	credentials WorkerCredentials
 }
 
+// WorkerCredentials returns registry credentials the daemon has itself. ok
+// is false if there are none for host and the credentials are requested from
+// the client.
+type WorkerCredentials func(ctx context.Context, host string) (username, secret string, ok bool, err error)
+
 // NewPool creates a new pool for caching resolvers
 func NewPool() *Pool {
 	p := &Pool{
@@ -71,6 +77,15 @@ func (p *Pool) Clear() {
 	p.m = map[string]*authHandlerNS{}
 }
 
+// SetWorkerCredentials sets the credentials that are used instead of the
+// credentials of the client
+func (p *Pool) SetWorkerCredentials(f WorkerCredentials) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.credentials = f
+	p.m = map[string]*authHandlerNS{}
+}
+
 // GetResolver gets a resolver for a specified scope from the pool
 func (p *Pool) GetResolver(hosts docker.RegistryHosts, ref, scope string, sm *session.Manager, g session.Group) *Resolver {
 	name := ref
@@ -85,7 +100,7 @@ func (p *Pool) GetResolver(hosts docker.RegistryHosts, ref, scope string, sm *se
 	defer p.mu.Unlock()
 	h, ok := p.m[key]
 	if !ok {
-		h = newAuthHandlerNS(sm)
+		h = newAuthHandlerNS(sm, p.credentials)
 		p.m[key] = h
 	}
 	return newResolver(hosts, h, sm, g)
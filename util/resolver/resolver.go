@@ -9,14 +9,39 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/containerd/containerd/remotes/docker"
+	"github.com/moby/buildkit/util/netcheck"
+	"github.com/moby/buildkit/util/resolver/hostobserver"
+	"github.com/moby/buildkit/util/resolver/workloadidentity"
 	"github.com/moby/buildkit/util/tracing"
 	"github.com/pkg/errors"
 )
 
+var (
+	rootCAsMu sync.Mutex
+	rootCAs   *x509.CertPool
+)
+
+// SetRootCAs sets the CAs the registries are verified with instead of the
+// CAs of the system. The CAs of registry configs are added to them.
+func SetRootCAs(pool *x509.CertPool) {
+	rootCAsMu.Lock()
+	defer rootCAsMu.Unlock()
+	rootCAs = pool
+}
+
+// getRootCAs returns the CAs set with SetRootCAs, nil for the system CAs
+func getRootCAs() *x509.CertPool {
+	rootCAsMu.Lock()
+	defer rootCAsMu.Unlock()
+	return rootCAs
+}
+
 func fillInsecureOpts(host string, c RegistryConfig, h docker.RegistryHost) ([]docker.RegistryHost, error) {
 	var hosts []docker.RegistryHost
 
@@ -38,26 +63,23 @@ func fillInsecureOpts(host string, c RegistryConfig, h docker.RegistryHost) ([]d
 	if isHTTP {
 		h2 := h
 		h2.Scheme = "http"
+		h2.Client = newClient(newTransport(c))
 		hosts = append(hosts, h2)
 	}
 	if c.Insecure != nil && *c.Insecure {
 		h2 := h
-		transport := newDefaultTransport()
+		transport := newTransport(c)
 		transport.TLSClientConfig = tc
-		h2.Client = &http.Client{
-			Transport: tracing.NewTransport(transport),
-		}
+		h2.Client = newClient(transport)
 		tc.InsecureSkipVerify = true
 		hosts = append(hosts, h2)
 	}
 
 	if len(hosts) == 0 {
-		transport := newDefaultTransport()
+		transport := newTransport(c)
 		transport.TLSClientConfig = tc
 
-		h.Client = &http.Client{
-			Transport: tracing.NewTransport(transport),
-		}
+		h.Client = newClient(transport)
 		hosts = append(hosts, h)
 	}
 
@@ -83,17 +105,21 @@ func loadTLSConfig(c RegistryConfig) (*tls.Config, error) {
 		}
 	}
 
-	tc := &tls.Config{}
+	tc := &tls.Config{RootCAs: getRootCAs()}
 	if len(c.RootCAs) > 0 {
-		systemPool, err := x509.SystemCertPool()
-		if err != nil {
-			if runtime.GOOS == "windows" {
-				systemPool = x509.NewCertPool()
-			} else {
-				return nil, errors.Wrapf(err, "unable to get system cert pool")
+		if tc.RootCAs != nil {
+			tc.RootCAs = tc.RootCAs.Clone()
+		} else {
+			systemPool, err := x509.SystemCertPool()
+			if err != nil {
+				if runtime.GOOS == "windows" {
+					systemPool = x509.NewCertPool()
+				} else {
+					return nil, errors.Wrapf(err, "unable to get system cert pool")
+				}
 			}
+			tc.RootCAs = systemPool
 		}
-		tc.RootCAs = systemPool
 	}
 
 	for _, p := range c.RootCAs {
@@ -111,6 +137,10 @@ func loadTLSConfig(c RegistryConfig) (*tls.Config, error) {
 		}
 		tc.Certificates = append(tc.Certificates, cert)
 	}
+
+	if c.TLSSessionCache != nil && *c.TLSSessionCache > 0 {
+		tc.ClientSessionCache = tls.NewLRUClientSessionCache(*c.TLSSessionCache)
+	}
 	return tc, nil
 }
 
@@ -121,6 +151,17 @@ type RegistryConfig struct {
 	RootCAs      []string     `toml:"ca"`
 	KeyPairs     []TLSKeyPair `toml:"keypair"`
 	TLSConfigDir []string     `toml:"tlsconfigdir"`
+
+	// HTTP client tuning. Unset values keep the defaults.
+	MaxIdleConns        *int  `toml:"maxidleconns"`
+	MaxIdleConnsPerHost *int  `toml:"maxidleconnsperhost"`
+	MaxConnsPerHost     *int  `toml:"maxconnsperhost"`
+	HTTP2               *bool `toml:"http2"`
+	TLSSessionCache     *int  `toml:"tlssessioncache"`
+
+	// WorkloadIdentity makes the daemon exchange its service account token
+	// for the credentials of the registry instead of asking the client
+	WorkloadIdentity *workloadidentity.Config `toml:"workload-identity"`
 }
 
 type TLSKeyPair struct {
@@ -183,9 +224,134 @@ func NewRegistryConfig(m map[string]RegistryConfig) docker.RegistryHosts {
 	)
 }
 
+// Endpoints returns the host:port endpoints of the registries and mirrors
+// of the registry config
+func Endpoints(m map[string]RegistryConfig) []string {
+	var out []string
+	seen := map[string]struct{}{}
+	add := func(host string) {
+		if host == "docker.io" {
+			host = "registry-1.docker.io"
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			port := "443"
+			if c := m[host]; c.PlainHTTP != nil && *c.PlainHTTP {
+				port = "80"
+			}
+			host = net.JoinHostPort(host, port)
+		}
+		if _, ok := seen[host]; ok {
+			return
+		}
+		seen[host] = struct{}{}
+		out = append(out, host)
+	}
+	for host, c := range m {
+		add(host)
+		for _, mirror := range c.Mirrors {
+			add(mirror)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// NewWorkerCredentials returns the credentials the daemon gets itself for the
+// registries with a workload identity config, nil if there are none
+func NewWorkerCredentials(m map[string]RegistryConfig) (WorkerCredentials, error) {
+	configs := map[string]workloadidentity.Config{}
+	for host, c := range m {
+		if c.WorkloadIdentity != nil {
+			configs[host] = *c.WorkloadIdentity
+		}
+	}
+	if len(configs) == 0 {
+		return nil, nil
+	}
+	p, err := workloadidentity.New(configs)
+	if err != nil {
+		return nil, err
+	}
+	return p.Credentials, nil
+}
+
+// newTransport returns a transport with the HTTP client tuning of the
+// registry config applied on top of the defaults
+func newTransport(c RegistryConfig) *http.Transport {
+	tr := newDefaultTransport()
+	if c.MaxIdleConns != nil {
+		tr.MaxIdleConns = *c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost != nil {
+		tr.MaxIdleConnsPerHost = *c.MaxIdleConnsPerHost
+	}
+	if c.MaxConnsPerHost != nil {
+		tr.MaxConnsPerHost = *c.MaxConnsPerHost
+	}
+	if c.HTTP2 != nil && *c.HTTP2 {
+		// see the note on newDefaultTransport about push performance
+		tr.TLSNextProto = nil
+		tr.ForceAttemptHTTP2 = true
+	}
+	return tr
+}
+
 func newDefaultClient() *http.Client {
+	return newClient(newDefaultTransport())
+}
+
+func newClient(tr *http.Transport) *http.Client {
 	return &http.Client{
-		Transport: tracing.NewTransport(newDefaultTransport()),
+		Transport: &registryTransport{
+			RoundTripper: tracing.NewTransport(hostobserver.NewTransport(tr)),
+			base:         tr,
+		},
+	}
+}
+
+// registryTransport keeps the transport a registry client was created with
+// so that InsecureHosts can derive a client with the same TLS and tuning
+// options
+type registryTransport struct {
+	http.RoundTripper
+	base *http.Transport
+}
+
+// InsecureHosts wraps hosts so that host is also tried over plain HTTP and
+// with HTTPS without verifying its certificate. Mirrors and the other
+// options of the registry config are kept.
+func InsecureHosts(hosts docker.RegistryHosts, host string) docker.RegistryHosts {
+	return func(domain string) ([]docker.RegistryHost, error) {
+		res, err := hosts(domain)
+		if err != nil || domain != host {
+			return res, err
+		}
+		var out []docker.RegistryHost
+		for _, h := range res {
+			// mirrors only have the pull and resolve capabilities
+			if !h.Capabilities.Has(docker.HostCapabilityPush) || h.Scheme != "https" {
+				out = append(out, h)
+				continue
+			}
+			h2 := h
+			h2.Scheme = "http"
+			out = append(out, h2)
+
+			var tr *http.Transport
+			if rt, ok := h.Client.Transport.(*registryTransport); ok {
+				tr = rt.base.Clone()
+			} else {
+				tr = newDefaultTransport()
+			}
+			if tr.TLSClientConfig == nil {
+				tr.TLSClientConfig = &tls.Config{}
+			}
+			tr.TLSClientConfig.InsecureSkipVerify = true
+			h3 := h
+			h3.Client = newClient(tr)
+			out = append(out, h3)
+		}
+		return out, nil
 	}
 }
 
@@ -198,16 +364,14 @@ func newDefaultClient() *http.Client {
 // REF: https://github.com/golang/go/issues/14077
 func newDefaultTransport() *http.Transport {
 	return &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 60 * time.Second,
-		}).DialContext,
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           netcheck.Dialer(30*time.Second, 60*time.Second).DialContext,
 		MaxIdleConns:          30,
 		IdleConnTimeout:       120 * time.Second,
 		MaxIdleConnsPerHost:   4,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 5 * time.Second,
 		TLSNextProto:          make(map[string]func(authority string, c *tls.Conn) http.RoundTripper),
+		TLSClientConfig:       &tls.Config{RootCAs: getRootCAs()},
 	}
 }
@@ -0,0 +1,55 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsecureHosts(t *testing.T) {
+	maxConns := 3
+	hosts := InsecureHosts(NewRegistryConfig(map[string]RegistryConfig{
+		"example.com": {
+			Mirrors:         []string{"mirror.example.com"},
+			MaxConnsPerHost: &maxConns,
+		},
+	}), "example.com")
+
+	res, err := hosts("example.com")
+	require.NoError(t, err)
+	require.Equal(t, 3, len(res))
+
+	require.Equal(t, "mirror.example.com", res[0].Host)
+	require.Equal(t, "https", res[0].Scheme)
+
+	require.Equal(t, "example.com", res[1].Host)
+	require.Equal(t, "http", res[1].Scheme)
+
+	require.Equal(t, "example.com", res[2].Host)
+	require.Equal(t, "https", res[2].Scheme)
+	tr := res[2].Client.Transport.(*registryTransport).base
+	require.True(t, tr.TLSClientConfig.InsecureSkipVerify)
+	require.Equal(t, maxConns, tr.MaxConnsPerHost)
+
+	// the daemon config must not be changed
+	res, err = hosts("other.example.com")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+	base := res[0].Client.Transport.(*registryTransport).base
+	require.False(t, base.TLSClientConfig.InsecureSkipVerify)
+}
+
+func TestEndpoints(t *testing.T) {
+	plain := true
+	m := map[string]RegistryConfig{
+		"docker.io":            {Mirrors: []string{"mirror.example.com", "localhost:5000"}},
+		"localhost:5000":       {PlainHTTP: &plain},
+		"registry.example.com": {PlainHTTP: &plain},
+	}
+	require.Equal(t, []string{
+		"localhost:5000",
+		"mirror.example.com:443",
+		"registry-1.docker.io:443",
+		"registry.example.com:80",
+	}, Endpoints(m))
+}
@@ -14,11 +14,49 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	// DefaultAttempts is the number of attempts of a request if Opt doesn't
+	// set them
+	DefaultAttempts = 4
+
+	initialBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+)
+
+type retriesKey struct{}
+
+// Retries returns the number of times the current request has been retried
+// by the handler
+func Retries(ctx context.Context) int {
+	n, _ := ctx.Value(retriesKey{}).(int)
+	return n
+}
+
+// Opt configures the retries of a handler
+type Opt struct {
+	// Attempts is the maximum number of attempts of a request, including
+	// the first one. Defaults to DefaultAttempts.
+	Attempts int
+	// Timeout limits the duration of every attempt. Attempts that time out
+	// are retried. Zero means no timeout.
+	Timeout time.Duration
+}
+
 func New(f images.HandlerFunc, logger func([]byte)) images.HandlerFunc {
+	return NewWithOpt(f, logger, Opt{})
+}
+
+// NewWithOpt returns a handler that retries f on temporary errors with
+// exponential backoff
+func NewWithOpt(f images.HandlerFunc, logger func([]byte), opt Opt) images.HandlerFunc {
+	attempts := opt.Attempts
+	if attempts <= 0 {
+		attempts = DefaultAttempts
+	}
 	return func(ctx context.Context, desc ocispecs.Descriptor) ([]ocispecs.Descriptor, error) {
-		backoff := time.Second
-		for {
-			descs, err := f(ctx, desc)
+		backoff := initialBackoff
+		for retries := 0; ; retries++ {
+			descs, err := attempt(ctx, f, desc, retries, opt.Timeout)
 			if err != nil {
 				select {
 				case <-ctx.Done():
@@ -35,19 +73,60 @@ func New(f images.HandlerFunc, logger func([]byte)) images.HandlerFunc {
 				return descs, nil
 			}
 			// backoff logic
-			if backoff >= 8*time.Second {
+			if retries+1 >= attempts {
 				return nil, err
 			}
 			if logger != nil {
 				logger([]byte(fmt.Sprintf("retrying in %v\n", backoff)))
 			}
-			time.Sleep(backoff)
+			select {
+			case <-ctx.Done():
+				return nil, err
+			case <-time.After(backoff):
+			}
 			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
 		}
 	}
 }
 
+func attempt(ctx context.Context, f images.HandlerFunc, desc ocispecs.Descriptor, retries int, timeout time.Duration) ([]ocispecs.Descriptor, error) {
+	ctx = context.WithValue(ctx, retriesKey{}, retries)
+	if timeout <= 0 {
+		return f(ctx, desc)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	descs, err := f(ctx, desc)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, &timeoutError{error: err, timeout: timeout}
+	}
+	return descs, err
+}
+
+// timeoutError is returned when an attempt didn't complete within the
+// timeout of the handler
+type timeoutError struct {
+	error
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("timed out after %v: %v", e.timeout, e.error)
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.error
+}
+
 func retryError(err error) bool {
+	var te *timeoutError
+	if errors.As(err, &te) {
+		return true
+	}
+
 	// Retry on 5xx errors
 	var errUnexpectedStatus remoteserrors.ErrUnexpectedStatus
 	if errors.As(err, &errUnexpectedStatus) &&
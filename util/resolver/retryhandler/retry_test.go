@@ -0,0 +1,54 @@
+package retryhandler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	remoteserrors "github.com/containerd/containerd/remotes/errors"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryAttempts(t *testing.T) {
+	t.Parallel()
+
+	var calls int
+	h := NewWithOpt(func(ctx context.Context, desc ocispecs.Descriptor) ([]ocispecs.Descriptor, error) {
+		require.Equal(t, calls, Retries(ctx))
+		calls++
+		return nil, remoteserrors.ErrUnexpectedStatus{StatusCode: http.StatusServiceUnavailable}
+	}, nil, Opt{Attempts: 2})
+	_, err := h(context.TODO(), ocispecs.Descriptor{})
+	require.Error(t, err)
+	require.Equal(t, 2, calls)
+
+	calls = 0
+	h = NewWithOpt(func(ctx context.Context, desc ocispecs.Descriptor) ([]ocispecs.Descriptor, error) {
+		calls++
+		return nil, errors.New("denied")
+	}, nil, Opt{Attempts: 5})
+	_, err = h(context.TODO(), ocispecs.Descriptor{})
+	require.Error(t, err)
+	require.Equal(t, 1, calls)
+}
+
+func TestRetryTimeout(t *testing.T) {
+	t.Parallel()
+
+	var calls int
+	h := NewWithOpt(func(ctx context.Context, desc ocispecs.Descriptor) ([]ocispecs.Descriptor, error) {
+		calls++
+		if calls == 1 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return []ocispecs.Descriptor{desc}, nil
+	}, nil, Opt{Attempts: 2, Timeout: 10 * time.Millisecond})
+	descs, err := h(context.TODO(), ocispecs.Descriptor{MediaType: "foo"})
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+	require.Equal(t, "foo", descs[0].MediaType)
+}
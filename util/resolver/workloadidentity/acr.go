@@ -0,0 +1,77 @@
+package workloadidentity
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// acrUsername is the username ACR expects with refresh tokens
+const acrUsername = "00000000-0000-0000-0000-000000000000"
+
+var (
+	azureAuthorityHost = "https://login.microsoftonline.com"
+	acrExchangeURL     = func(host string) string { return "https://" + host + "/oauth2/exchange" }
+)
+
+// acr exchanges token for an Azure AD access token of the application with
+// the token as client assertion and the access token for an ACR refresh token
+func (p *Provider) acr(ctx context.Context, host string, c Config, token string) (Credentials, error) {
+	authority := azureAuthorityHost
+	if v := os.Getenv("AZURE_AUTHORITY_HOST"); v != "" {
+		authority = v
+	}
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_id":             {c.ClientID},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {token},
+		"scope":                 {"https://management.azure.com/.default"},
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(authority, "/")+"/"+url.PathEscape(c.TenantID)+"/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return Credentials{}, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var aad struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := p.do(req, &aad); err != nil {
+		return Credentials{}, err
+	}
+
+	form = url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {host},
+		"tenant":       {c.TenantID},
+		"access_token": {aad.AccessToken},
+	}
+	req, err = http.NewRequest("POST", acrExchangeURL(host), strings.NewReader(form.Encode()))
+	if err != nil {
+		return Credentials{}, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var acr struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := p.do(req, &acr); err != nil {
+		return Credentials{}, err
+	}
+	// the refresh token is valid at least as long as the access token it
+	// was exchanged for
+	return Credentials{
+		Username: acrUsername,
+		Secret:   acr.RefreshToken,
+		Expires:  time.Now().Add(time.Duration(aad.ExpiresIn) * time.Second),
+	}, nil
+}
@@ -0,0 +1,190 @@
+package workloadidentity
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ecrHostPattern matches the host of a private ECR registry, e.g.
+// 123456789012.dkr.ecr.us-east-1.amazonaws.com
+var ecrHostPattern = regexp.MustCompile(`^\d{12}\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.(amazonaws\.com(?:\.cn)?)$`)
+
+var (
+	awsSTSURL = func(region, domain string) string { return "https://sts." + region + "." + domain + "/" }
+	awsECRURL = func(region, domain string) string { return "https://api.ecr." + region + "." + domain + "/" }
+)
+
+type awsCredentials struct {
+	AccessKeyID     string    `xml:"AccessKeyId"`
+	SecretAccessKey string    `xml:"SecretAccessKey"`
+	SessionToken    string    `xml:"SessionToken"`
+	Expiration      time.Time `xml:"Expiration"`
+}
+
+// ecr assumes the role with token as web identity and gets an authorization
+// token of the ECR API with the credentials of the role
+func (p *Provider) ecr(ctx context.Context, host string, c Config, token string) (Credentials, error) {
+	region, domain := c.Region, "amazonaws.com"
+	if m := ecrHostPattern.FindStringSubmatch(host); m != nil {
+		if region == "" {
+			region = m[1]
+		}
+		domain = m[2]
+	}
+	if region == "" {
+		return Credentials{}, errors.Errorf("no region in %s, set region in the config", host)
+	}
+
+	aws, err := p.assumeRoleWithWebIdentity(ctx, awsSTSURL(region, domain), c.RoleARN, token)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	body := []byte("{}")
+	req, err := http.NewRequest("POST", awsECRURL(region, domain), bytes.NewReader(body))
+	if err != nil {
+		return Credentials{}, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+	signV4(req, body, aws, region, "ecr", time.Now())
+
+	var resp struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"`
+		} `json:"authorizationData"`
+	}
+	if err := p.do(req, &resp); err != nil {
+		return Credentials{}, err
+	}
+	if len(resp.AuthorizationData) == 0 {
+		return Credentials{}, errors.New("no authorization data in ECR response")
+	}
+	data := resp.AuthorizationData[0]
+	dt, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "invalid ECR authorization token")
+	}
+	parts := strings.SplitN(string(dt), ":", 2)
+	if len(parts) != 2 {
+		return Credentials{}, errors.New("invalid ECR authorization token")
+	}
+	return Credentials{
+		Username: parts[0],
+		Secret:   parts[1],
+		Expires:  time.Unix(int64(data.ExpiresAt), 0),
+	}, nil
+}
+
+// assumeRoleWithWebIdentity gets temporary credentials of role from the STS.
+// The request is authenticated by the token and not signed.
+func (p *Provider) assumeRoleWithWebIdentity(ctx context.Context, endpoint, role, token string) (awsCredentials, error) {
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {fmt.Sprintf("buildkit-%d", time.Now().UnixNano())},
+		"WebIdentityToken": {token},
+	}
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return awsCredentials{}, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return awsCredentials{}, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		dt, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<12))
+		return awsCredentials{}, errors.Errorf("failed to assume role %s: unexpected status %s: %s", role, resp.Status, strings.TrimSpace(string(dt)))
+	}
+	var out struct {
+		Credentials awsCredentials `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return awsCredentials{}, errors.Wrap(err, "failed to decode STS response")
+	}
+	return out.Credentials, nil
+}
+
+// signV4 adds the AWS signature version 4 headers for body to req
+func signV4(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hexSHA256(dt []byte) string {
+	h := sha256.Sum256(dt)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
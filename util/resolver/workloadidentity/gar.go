@@ -0,0 +1,81 @@
+package workloadidentity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	garUsername = "oauth2accesstoken"
+	gcpScope    = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+var (
+	gcpSTSURL            = "https://sts.googleapis.com/v1/token"
+	gcpIAMCredentialsURL = "https://iamcredentials.googleapis.com/v1"
+)
+
+// gar exchanges token for a federated access token with the Google STS and,
+// if a service account is set, for an access token of the service account
+func (p *Provider) gar(ctx context.Context, c Config, token string) (Credentials, error) {
+	form := url.Values{
+		"grant_type":           {"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"audience":             {c.Audience},
+		"scope":                {gcpScope},
+		"requested_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+		"subject_token":        {token},
+		"subject_token_type":   {"urn:ietf:params:oauth:token-type:jwt"},
+	}
+	req, err := http.NewRequest("POST", gcpSTSURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Credentials{}, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var sts struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := p.do(req, &sts); err != nil {
+		return Credentials{}, err
+	}
+	creds := Credentials{
+		Username: garUsername,
+		Secret:   sts.AccessToken,
+		Expires:  time.Now().Add(time.Duration(sts.ExpiresIn) * time.Second),
+	}
+	if c.ServiceAccount == "" {
+		return creds, nil
+	}
+
+	dt, err := json.Marshal(map[string][]string{"scope": {gcpScope}})
+	if err != nil {
+		return Credentials{}, errors.WithStack(err)
+	}
+	req, err = http.NewRequest("POST", gcpIAMCredentialsURL+"/projects/-/serviceAccounts/"+url.PathEscape(c.ServiceAccount)+":generateAccessToken", bytes.NewReader(dt))
+	if err != nil {
+		return Credentials{}, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+sts.AccessToken)
+
+	var sa struct {
+		AccessToken string    `json:"accessToken"`
+		ExpireTime  time.Time `json:"expireTime"`
+	}
+	if err := p.do(req, &sa); err != nil {
+		return Credentials{}, errors.Wrapf(err, "failed to impersonate %s", c.ServiceAccount)
+	}
+	creds.Secret = sa.AccessToken
+	creds.Expires = sa.ExpireTime
+	return creds, nil
+}
@@ -0,0 +1,214 @@
+// Package workloadidentity exchanges the Kubernetes service account token of
+// buildkitd for registry credentials with the workload identity federation of
+// the cloud provider hosting the registry, so that in-cluster builders can
+// pull and push without a mounted docker config.
+package workloadidentity
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moby/buildkit/util/flightcontrol"
+	"github.com/pkg/errors"
+)
+
+const (
+	ProviderECR = "ecr"
+	ProviderGAR = "gar"
+	ProviderACR = "acr"
+
+	// DefaultTokenPath is the token of the service account of the pod
+	DefaultTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	// expiryMargin is subtracted from the lifetime of the credentials so
+	// they aren't used while they expire
+	expiryMargin = 5 * time.Minute
+)
+
+// Config configures the token exchange for a registry
+type Config struct {
+	// Provider is the cloud provider of the registry: ecr, gar or acr
+	Provider string `toml:"provider"`
+	// TokenPath is the projected service account token. Defaults to the
+	// token file set by the identity webhook of the provider or
+	// DefaultTokenPath.
+	TokenPath string `toml:"token-path"`
+
+	// RoleARN is the IAM role assumed for ECR. Defaults to AWS_ROLE_ARN.
+	RoleARN string `toml:"role-arn"`
+	// Region of the ECR API. Defaults to the region in the registry host.
+	Region string `toml:"region"`
+
+	// Audience is the full resource name of the workload identity pool
+	// provider for GAR, e.g.
+	// //iam.googleapis.com/projects/<num>/locations/global/workloadIdentityPools/<pool>/providers/<provider>
+	Audience string `toml:"audience"`
+	// ServiceAccount is the Google service account impersonated for GAR. If
+	// empty the federated token is used directly.
+	ServiceAccount string `toml:"service-account"`
+
+	// TenantID of the Azure AD application for ACR. Defaults to
+	// AZURE_TENANT_ID.
+	TenantID string `toml:"tenant-id"`
+	// ClientID of the Azure AD application for ACR. Defaults to
+	// AZURE_CLIENT_ID.
+	ClientID string `toml:"client-id"`
+}
+
+// Validate checks that the config is complete after applying the defaults
+func (c Config) Validate() error {
+	c = c.withDefaults()
+	switch c.Provider {
+	case ProviderECR:
+		if c.RoleARN == "" {
+			return errors.New("role-arn is required for ecr")
+		}
+	case ProviderGAR:
+		if c.Audience == "" {
+			return errors.New("audience is required for gar")
+		}
+	case ProviderACR:
+		if c.TenantID == "" || c.ClientID == "" {
+			return errors.New("tenant-id and client-id are required for acr")
+		}
+	case "":
+		return errors.New("provider is required")
+	default:
+		return errors.Errorf("unsupported provider %q", c.Provider)
+	}
+	return nil
+}
+
+// withDefaults fills in the values the identity webhooks of EKS and AKS set
+// in the environment of the pod
+func (c Config) withDefaults() Config {
+	switch c.Provider {
+	case ProviderECR:
+		if c.RoleARN == "" {
+			c.RoleARN = os.Getenv("AWS_ROLE_ARN")
+		}
+		if c.TokenPath == "" {
+			c.TokenPath = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+		}
+	case ProviderACR:
+		if c.TenantID == "" {
+			c.TenantID = os.Getenv("AZURE_TENANT_ID")
+		}
+		if c.ClientID == "" {
+			c.ClientID = os.Getenv("AZURE_CLIENT_ID")
+		}
+		if c.TokenPath == "" {
+			c.TokenPath = os.Getenv("AZURE_FEDERATED_TOKEN_FILE")
+		}
+	}
+	if c.TokenPath == "" {
+		c.TokenPath = DefaultTokenPath
+	}
+	return c
+}
+
+// Credentials are the registry credentials a token was exchanged for
+type Credentials struct {
+	Username string
+	Secret   string
+	// Expires is zero if the lifetime of the credentials is unknown
+	Expires time.Time
+}
+
+// Provider returns the registry credentials of the hosts it has a config for
+type Provider struct {
+	client  *http.Client
+	configs map[string]Config
+
+	g     flightcontrol.Group
+	mu    sync.Mutex
+	cache map[string]Credentials
+}
+
+// New returns a provider for the registry hosts in m
+func New(m map[string]Config) (*Provider, error) {
+	configs := make(map[string]Config, len(m))
+	for host, c := range m {
+		if err := c.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid workload identity config for %s", host)
+		}
+		configs[host] = c.withDefaults()
+	}
+	return &Provider{
+		client:  &http.Client{Transport: http.DefaultTransport, Timeout: time.Minute},
+		configs: configs,
+		cache:   map[string]Credentials{},
+	}, nil
+}
+
+// Credentials returns the registry credentials for host. ok is false if host
+// has no workload identity config.
+func (p *Provider) Credentials(ctx context.Context, host string) (username, secret string, ok bool, err error) {
+	c, ok := p.configs[host]
+	if !ok {
+		return "", "", false, nil
+	}
+
+	p.mu.Lock()
+	creds, cached := p.cache[host]
+	p.mu.Unlock()
+	if cached && time.Now().Before(creds.Expires) {
+		return creds.Username, creds.Secret, true, nil
+	}
+
+	v, err := p.g.Do(ctx, host, func(ctx context.Context) (interface{}, error) {
+		token, err := ioutil.ReadFile(c.TokenPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read service account token")
+		}
+		creds, err := p.exchange(ctx, host, c, strings.TrimSpace(string(token)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get %s credentials for %s", c.Provider, host)
+		}
+		if !creds.Expires.IsZero() {
+			creds.Expires = creds.Expires.Add(-expiryMargin)
+			p.mu.Lock()
+			p.cache[host] = creds
+			p.mu.Unlock()
+		}
+		return creds, nil
+	})
+	if err != nil {
+		return "", "", true, err
+	}
+	creds = v.(Credentials)
+	return creds.Username, creds.Secret, true, nil
+}
+
+func (p *Provider) exchange(ctx context.Context, host string, c Config, token string) (Credentials, error) {
+	switch c.Provider {
+	case ProviderECR:
+		return p.ecr(ctx, host, c, token)
+	case ProviderGAR:
+		return p.gar(ctx, c, token)
+	case ProviderACR:
+		return p.acr(ctx, host, c, token)
+	}
+	return Credentials{}, errors.Errorf("unsupported provider %q", c.Provider)
+}
+
+// do sends req and decodes the JSON response into v
+func (p *Provider) do(req *http.Request, v interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		dt, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<12))
+		return errors.Errorf("%s %s: unexpected status %s: %s", req.Method, req.URL.Host, resp.Status, strings.TrimSpace(string(dt)))
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(v), "failed to decode response of %s", req.URL.Host)
+}
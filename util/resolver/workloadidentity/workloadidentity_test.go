@@ -0,0 +1,164 @@
+package workloadidentity
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignV4(t *testing.T) {
+	// get-vanilla of the AWS signature version 4 test suite
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+	now, err := time.Parse("20060102T150405Z", "20150830T123600Z")
+	require.NoError(t, err)
+	signV4(req, nil, awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}, "us-east-1", "service", now)
+	require.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", req.Header.Get("Authorization"))
+}
+
+func TestConfigValidate(t *testing.T) {
+	t.Setenv("AWS_ROLE_ARN", "")
+	t.Setenv("AZURE_TENANT_ID", "")
+	t.Setenv("AZURE_CLIENT_ID", "")
+
+	require.Error(t, Config{}.Validate())
+	require.Error(t, Config{Provider: "foo"}.Validate())
+	require.Error(t, Config{Provider: ProviderECR}.Validate())
+	require.NoError(t, Config{Provider: ProviderECR, RoleARN: "arn:aws:iam::123456789012:role/builder"}.Validate())
+	require.Error(t, Config{Provider: ProviderGAR}.Validate())
+	require.Error(t, Config{Provider: ProviderACR, TenantID: "tenant"}.Validate())
+
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/builder")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "/var/run/secrets/eks.amazonaws.com/serviceaccount/token")
+	require.NoError(t, Config{Provider: ProviderECR}.Validate())
+	c := Config{Provider: ProviderECR}.withDefaults()
+	require.Equal(t, "/var/run/secrets/eks.amazonaws.com/serviceaccount/token", c.TokenPath)
+	require.Equal(t, DefaultTokenPath, Config{Provider: ProviderGAR}.withDefaults().TokenPath)
+}
+
+func TestECR(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.Header.Get("X-Amz-Target") == "" {
+			require.Equal(t, "AssumeRoleWithWebIdentity", r.Form.Get("Action"))
+			require.Equal(t, "sa-token", r.Form.Get("WebIdentityToken"))
+			require.Equal(t, "arn:aws:iam::123456789012:role/builder", r.Form.Get("RoleArn"))
+			fmt.Fprint(w, `<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials><AccessKeyId>AKID</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>session</SessionToken><Expiration>2030-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`)
+			return
+		}
+		require.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"))
+		require.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		require.Contains(t, r.Header.Get("Authorization"), "/eu-west-1/ecr/aws4_request")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"authorizationData": []map[string]interface{}{{
+				"authorizationToken": base64.StdEncoding.EncodeToString([]byte("AWS:password")),
+				"expiresAt":          time.Now().Add(12 * time.Hour).Unix(),
+			}},
+		})
+	}))
+	defer srv.Close()
+	defer func(sts, ecr func(string, string) string) {
+		awsSTSURL, awsECRURL = sts, ecr
+	}(awsSTSURL, awsECRURL)
+	awsSTSURL = func(string, string) string { return srv.URL + "/" }
+	awsECRURL = awsSTSURL
+
+	host := "123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+	p := newTestProvider(t, host, Config{Provider: ProviderECR, RoleARN: "arn:aws:iam::123456789012:role/builder"})
+	username, secret, ok, err := p.Credentials(context.TODO(), host)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "AWS", username)
+	require.Equal(t, "password", secret)
+
+	_, _, ok, err = p.Credentials(context.TODO(), "docker.io")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestGAR(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/token" {
+			require.NoError(t, r.ParseForm())
+			require.Equal(t, "sa-token", r.Form.Get("subject_token"))
+			require.Equal(t, "//iam.googleapis.com/pool", r.Form.Get("audience"))
+			fmt.Fprint(w, `{"access_token":"federated","expires_in":3600}`)
+			return
+		}
+		require.Equal(t, "/projects/-/serviceAccounts/builder@project.iam.gserviceaccount.com:generateAccessToken", r.URL.Path)
+		require.Equal(t, "Bearer federated", r.Header.Get("Authorization"))
+		fmt.Fprintf(w, `{"accessToken":"impersonated","expireTime":%q}`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer srv.Close()
+	defer func(sts, iam string) {
+		gcpSTSURL, gcpIAMCredentialsURL = sts, iam
+	}(gcpSTSURL, gcpIAMCredentialsURL)
+	gcpSTSURL = srv.URL + "/token"
+	gcpIAMCredentialsURL = srv.URL
+
+	host := "europe-docker.pkg.dev"
+	p := newTestProvider(t, host, Config{Provider: ProviderGAR, Audience: "//iam.googleapis.com/pool", ServiceAccount: "builder@project.iam.gserviceaccount.com"})
+	username, secret, ok, err := p.Credentials(context.TODO(), host)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, garUsername, username)
+	require.Equal(t, "impersonated", secret)
+	require.Equal(t, 2, calls)
+
+	// cached until shortly before they expire
+	_, secret, _, err = p.Credentials(context.TODO(), host)
+	require.NoError(t, err)
+	require.Equal(t, "impersonated", secret)
+	require.Equal(t, 2, calls)
+}
+
+func TestACR(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.URL.Path == "/tenant/oauth2/v2.0/token" {
+			require.Equal(t, "client", r.Form.Get("client_id"))
+			require.Equal(t, "sa-token", r.Form.Get("client_assertion"))
+			fmt.Fprint(w, `{"access_token":"aad","expires_in":3600}`)
+			return
+		}
+		require.Equal(t, "/oauth2/exchange", r.URL.Path)
+		require.Equal(t, "aad", r.Form.Get("access_token"))
+		require.Equal(t, "example.azurecr.io", r.Form.Get("service"))
+		fmt.Fprint(w, `{"refresh_token":"refresh"}`)
+	}))
+	defer srv.Close()
+	defer func(authority string, exchange func(string) string) {
+		azureAuthorityHost, acrExchangeURL = authority, exchange
+	}(azureAuthorityHost, acrExchangeURL)
+	t.Setenv("AZURE_AUTHORITY_HOST", "")
+	azureAuthorityHost = srv.URL
+	acrExchangeURL = func(string) string { return srv.URL + "/oauth2/exchange" }
+
+	host := "example.azurecr.io"
+	p := newTestProvider(t, host, Config{Provider: ProviderACR, TenantID: "tenant", ClientID: "client"})
+	username, secret, ok, err := p.Credentials(context.TODO(), host)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, acrUsername, username)
+	require.Equal(t, "refresh", secret)
+}
+
+func newTestProvider(t *testing.T, host string, c Config) *Provider {
+	c.TokenPath = filepath.Join(t.TempDir(), "token")
+	require.NoError(t, ioutil.WriteFile(c.TokenPath, []byte("sa-token\n"), 0600))
+	p, err := New(map[string]Config{host: c})
+	require.NoError(t, err)
+	return p
+}
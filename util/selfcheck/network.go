@@ -0,0 +1,30 @@
+package selfcheck
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+)
+
+func checkNetwork(ctx context.Context, opt Opt) *Result {
+	const name = "network"
+	switch opt.NetworkMode {
+	case "host":
+		return pass(name, "using host network")
+	case "cni", "auto", "":
+	default:
+		return fail(name, "invalid network mode "+opt.NetworkMode, `set the network mode to "auto", "cni" or "host"`)
+	}
+
+	if _, err := os.Stat(opt.CNIConfigPath); err != nil {
+		if opt.NetworkMode == "cni" {
+			return fail(name, "CNI config "+opt.CNIConfigPath+" not found", "create the CNI config or set the network mode to host")
+		}
+		return warning(name, "CNI config "+opt.CNIConfigPath+" not found, falling back to host network", "create the CNI config to run build containers in an isolated network")
+	}
+	files, err := ioutil.ReadDir(opt.CNIBinaryDir)
+	if err != nil || len(files) == 0 {
+		return fail(name, "no CNI plugins found in "+opt.CNIBinaryDir, "install the CNI plugins (https://github.com/containernetworking/plugins) to "+opt.CNIBinaryDir)
+	}
+	return pass(name, "using CNI config "+opt.CNIConfigPath)
+}
@@ -0,0 +1,102 @@
+// Package selfcheck validates that the host supports the kernel and system
+// features used by the daemon, e.g. the snapshotter, network providers and
+// emulators, and suggests how to fix missing ones.
+package selfcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusWarning Status = "warning"
+	StatusError   Status = "error"
+)
+
+// Result is the result of a single check. Hint describes how to fix a failed
+// check.
+type Result struct {
+	Name    string
+	Status  Status
+	Message string
+	Hint    string
+}
+
+// Opt describes the daemon configuration to check the host against
+type Opt struct {
+	// Root is the state directory of the daemon
+	Root string
+	// Snapshotter is the configured snapshotter, e.g. "auto" or "overlayfs".
+	// Snapshotter checks are skipped if empty.
+	Snapshotter string
+	// NetworkMode is the configured network mode: "auto", "cni" or "host"
+	NetworkMode   string
+	CNIConfigPath string
+	CNIBinaryDir  string
+	Rootless      bool
+	// UserRemap is set if build containers run with a user namespace remap
+	UserRemap bool
+}
+
+// Run runs all checks for the current platform
+func Run(ctx context.Context, opt Opt) []Result {
+	var out []Result
+	for _, c := range checks(opt) {
+		if ctx.Err() != nil {
+			break
+		}
+		if r := c(ctx, opt); r != nil {
+			out = append(out, *r)
+		}
+	}
+	return out
+}
+
+// Failed returns true if any of the results is an error
+func Failed(results []Result) bool {
+	for _, r := range results {
+		if r.Status == StatusError {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintReport writes the results as a table followed by the hints for the
+// checks that did not pass
+func PrintReport(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAILS")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Name, r.Status, r.Message)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Status != StatusOK && r.Hint != "" {
+			fmt.Fprintf(w, "\n%s: %s\n", r.Name, r.Hint)
+		}
+	}
+	return nil
+}
+
+type checkFunc func(context.Context, Opt) *Result
+
+func pass(name, msg string) *Result {
+	return &Result{Name: name, Status: StatusOK, Message: msg}
+}
+
+func warning(name, msg, hint string) *Result {
+	return &Result{Name: name, Status: StatusWarning, Message: msg, Hint: hint}
+}
+
+func fail(name, msg, hint string) *Result {
+	return &Result{Name: name, Status: StatusError, Message: msg, Hint: hint}
+}
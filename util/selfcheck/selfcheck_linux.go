@@ -0,0 +1,140 @@
+package selfcheck
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/snapshots/overlay/overlayutils"
+	fuseoverlayfs "github.com/containerd/fuse-overlayfs-snapshotter"
+	"github.com/moby/buildkit/util/archutil"
+	"golang.org/x/sys/unix"
+)
+
+const binfmtHint = "install QEMU emulators to build for other platforms, e.g. with `docker run --privileged --rm tonistiigi/binfmt --install all`"
+
+func checks(opt Opt) []checkFunc {
+	return []checkFunc{
+		checkSnapshotter,
+		checkWhiteout,
+		checkNetwork,
+		checkBinfmt,
+		checkCgroups,
+		checkUserNamespaces,
+	}
+}
+
+func isOverlay(snapshotter string) bool {
+	return snapshotter == "auto" || snapshotter == "overlayfs"
+}
+
+func checkSnapshotter(ctx context.Context, opt Opt) *Result {
+	const name = "snapshotter"
+	switch opt.Snapshotter {
+	case "":
+		return nil
+	case "auto":
+		if err := overlayutils.Supported(opt.Root); err == nil {
+			return pass(name, "overlayfs is supported")
+		} else if err2 := fuseoverlayfs.Supported(opt.Root); err2 == nil {
+			return warning(name, "overlayfs is not supported, using fuse-overlayfs: "+err.Error(), "")
+		}
+		return warning(name, "overlayfs and fuse-overlayfs are not supported, using the slower native snapshotter", "use a filesystem with d_type support for "+opt.Root+", or install fuse-overlayfs")
+	case "overlayfs":
+		if err := overlayutils.Supported(opt.Root); err != nil {
+			return fail(name, "overlayfs is not supported: "+err.Error(), "use a filesystem with d_type support for "+opt.Root+" or switch to the fuse-overlayfs or native snapshotter")
+		}
+		return pass(name, "overlayfs is supported")
+	case "fuse-overlayfs":
+		if err := fuseoverlayfs.Supported(opt.Root); err != nil {
+			return fail(name, "fuse-overlayfs is not supported: "+err.Error(), "install fuse-overlayfs and make /dev/fuse available, or switch to the native snapshotter")
+		}
+		return pass(name, "fuse-overlayfs is supported")
+	default:
+		return pass(name, opt.Snapshotter+" is not checked")
+	}
+}
+
+// checkWhiteout checks that overlayfs whiteouts, which are character devices
+// with 0/0 device number, can be created
+func checkWhiteout(ctx context.Context, opt Opt) *Result {
+	const name = "overlayfs whiteout"
+	if !isOverlay(opt.Snapshotter) {
+		return nil
+	}
+	if err := os.MkdirAll(opt.Root, 0700); err != nil {
+		return fail(name, err.Error(), "")
+	}
+	dir, err := ioutil.TempDir(opt.Root, "selfcheck-")
+	if err != nil {
+		return fail(name, err.Error(), "")
+	}
+	defer os.RemoveAll(dir)
+
+	if err := unix.Mknod(filepath.Join(dir, "whiteout"), unix.S_IFCHR, 0); err != nil {
+		hint := "grant CAP_MKNOD to the daemon"
+		if opt.Rootless {
+			hint = "rootless overlayfs needs kernel 5.11 or later, otherwise use the fuse-overlayfs snapshotter"
+		}
+		return fail(name, "failed to create whiteout device: "+err.Error(), hint)
+	}
+	return pass(name, "whiteouts can be created")
+}
+
+func checkBinfmt(ctx context.Context, opt Opt) *Result {
+	const name = "binfmt"
+	pp := archutil.SupportedPlatforms(true)
+	if len(pp) < 2 {
+		return warning(name, "only the native platform "+strings.Join(pp, ",")+" is supported", binfmtHint)
+	}
+	return pass(name, "supported platforms: "+strings.Join(pp, ","))
+}
+
+func checkCgroups(ctx context.Context, opt Opt) *Result {
+	const name = "cgroups"
+	var missing []string
+	if dt, err := ioutil.ReadFile("/sys/fs/cgroup/cgroup.controllers"); err == nil {
+		available := map[string]struct{}{}
+		for _, c := range strings.Fields(string(dt)) {
+			available[c] = struct{}{}
+		}
+		for _, c := range []string{"cpu", "memory", "pids"} {
+			if _, ok := available[c]; !ok {
+				missing = append(missing, c)
+			}
+		}
+		if len(missing) > 0 {
+			return warning(name, "cgroup v2 controllers not available: "+strings.Join(missing, ","), "delegate the controllers to the daemon, e.g. with Delegate=yes in the systemd unit")
+		}
+		return pass(name, "cgroup v2")
+	}
+	for _, c := range []string{"cpu", "memory", "pids"} {
+		if _, err := os.Stat(filepath.Join("/sys/fs/cgroup", c)); err != nil {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		return warning(name, "cgroup v1 controllers not mounted: "+strings.Join(missing, ","), "mount the cgroup controllers under /sys/fs/cgroup")
+	}
+	return pass(name, "cgroup v1")
+}
+
+func checkUserNamespaces(ctx context.Context, opt Opt) *Result {
+	const name = "idmap"
+	if !opt.Rootless && !opt.UserRemap {
+		if _, err := os.Stat("/proc/self/ns/user"); err != nil {
+			return warning(name, "user namespaces are not supported", "")
+		}
+		return pass(name, "user namespaces are supported")
+	}
+	hint := "enable user namespaces with `sysctl -w user.max_user_namespaces=28633`"
+	if dt, err := ioutil.ReadFile("/proc/sys/user/max_user_namespaces"); err == nil && strings.TrimSpace(string(dt)) == "0" {
+		return fail(name, "user namespaces are disabled", hint)
+	}
+	if dt, err := ioutil.ReadFile("/proc/sys/kernel/unprivileged_userns_clone"); err == nil && strings.TrimSpace(string(dt)) == "0" {
+		return fail(name, "unprivileged user namespaces are disabled", "enable them with `sysctl -w kernel.unprivileged_userns_clone=1`")
+	}
+	return pass(name, "user namespaces are enabled")
+}
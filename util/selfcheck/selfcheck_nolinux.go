@@ -0,0 +1,7 @@
+// +build !linux
+
+package selfcheck
+
+func checks(opt Opt) []checkFunc {
+	return []checkFunc{checkNetwork}
+}
@@ -0,0 +1,61 @@
+package selfcheck
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckNetwork(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "selfcheck")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	opt := Opt{
+		NetworkMode:   "auto",
+		CNIConfigPath: filepath.Join(tmpdir, "cni.json"),
+		CNIBinaryDir:  filepath.Join(tmpdir, "bin"),
+	}
+	r := checkNetwork(context.TODO(), opt)
+	require.Equal(t, StatusWarning, r.Status)
+
+	opt.NetworkMode = "cni"
+	r = checkNetwork(context.TODO(), opt)
+	require.Equal(t, StatusError, r.Status)
+
+	require.NoError(t, ioutil.WriteFile(opt.CNIConfigPath, []byte("{}"), 0600))
+	r = checkNetwork(context.TODO(), opt)
+	require.Equal(t, StatusError, r.Status)
+	require.Contains(t, r.Message, "no CNI plugins")
+
+	require.NoError(t, os.MkdirAll(opt.CNIBinaryDir, 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(opt.CNIBinaryDir, "bridge"), nil, 0700))
+	r = checkNetwork(context.TODO(), opt)
+	require.Equal(t, StatusOK, r.Status)
+
+	opt.NetworkMode = "host"
+	r = checkNetwork(context.TODO(), opt)
+	require.Equal(t, StatusOK, r.Status)
+}
+
+func TestPrintReport(t *testing.T) {
+	results := []Result{
+		{Name: "network", Status: StatusOK, Message: "using host network"},
+		{Name: "binfmt", Status: StatusWarning, Message: "only the native platform is supported", Hint: "install emulators"},
+	}
+	require.False(t, Failed(results))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, PrintReport(buf, results))
+	require.Contains(t, buf.String(), "binfmt\twarning\tonly the native platform is supported\n")
+	require.Contains(t, buf.String(), "\nbinfmt: install emulators\n")
+	require.NotContains(t, buf.String(), "network:")
+
+	results = append(results, Result{Name: "cgroups", Status: StatusError})
+	require.True(t, Failed(results))
+}
@@ -0,0 +1,183 @@
+// Package solverecord records solve requests received by the daemon so that
+// they can be replayed later, e.g. to reproduce solver bugs.
+package solverecord
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containerd/continuity"
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/moby/buildkit/identity"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/redact"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+const recordVersion = 1
+
+const (
+	// DefaultKeepDuration is the age records are removed after if no other
+	// duration is set
+	DefaultKeepDuration = 48 * time.Hour
+	// DefaultMaxSize is the total size in bytes the oldest records are
+	// removed above if no other size is set
+	DefaultMaxSize = 100 << 20
+)
+
+// Record is a recorded solve request
+type Record struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	// Request is the solve request with the session ID removed
+	Request *controlapi.SolveRequest `json:"request"`
+	// SessionIDHash is the digest of the session ID of the request, so that
+	// requests of the same client session can be matched
+	SessionIDHash digest.Digest `json:"sessionIDHash,omitempty"`
+	// Locals are the names of the local sources the definition reads from
+	// the client session. Frontends may read additional ones.
+	Locals []string `json:"locals,omitempty"`
+}
+
+// New returns a record of the request. Attributes that look like
+// credentials, e.g. the token of the gha cache or secret build args, are
+// redacted.
+func New(req *controlapi.SolveRequest) *Record {
+	r := &Record{
+		Version: recordVersion,
+		Time:    time.Now().UTC(),
+	}
+	cp := *req
+	if cp.Session != "" {
+		r.SessionIDHash = digest.FromString(cp.Session)
+		cp.Session = ""
+	}
+	cp.ExporterAttrs = redact.Map(cp.ExporterAttrs)
+	cp.FrontendAttrs = redact.Map(cp.FrontendAttrs)
+	cp.Cache.ExportAttrsDeprecated = redact.Map(cp.Cache.ExportAttrsDeprecated)
+	cp.Cache.Exports = redactCacheEntries(cp.Cache.Exports)
+	cp.Cache.Imports = redactCacheEntries(cp.Cache.Imports)
+	r.Request = &cp
+	r.Locals = locals(req.Definition)
+	return r
+}
+
+// Write stores the record of the request in dir and returns the path of the
+// record file
+func Write(dir string, req *controlapi.SolveRequest) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", errors.WithStack(err)
+	}
+	dt, err := json.MarshalIndent(New(req), "", "  ")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	ref := req.Ref
+	if ref == "" || strings.ContainsAny(ref, `/\`) {
+		ref = identity.NewID()
+	}
+	p := filepath.Join(dir, time.Now().UTC().Format("20060102T150405")+"-"+ref+".json")
+	if err := continuity.AtomicWriteFile(p, dt, 0600); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return p, nil
+}
+
+// Prune removes the records in dir that are older than keepDuration and the
+// oldest records until the total size of the records is at most maxSize. The
+// defaults are used for zero values.
+func Prune(dir string, keepDuration time.Duration, maxSize int64) error {
+	if keepDuration == 0 {
+		keepDuration = DefaultKeepDuration
+	}
+	if maxSize == 0 {
+		maxSize = DefaultMaxSize
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	records := make([]os.FileInfo, 0, len(fis))
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() && strings.HasSuffix(fi.Name(), ".json") {
+			records = append(records, fi)
+		}
+	}
+	// newest first
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ModTime().After(records[j].ModTime())
+	})
+	cutoff := time.Now().Add(-keepDuration)
+	var size int64
+	for _, fi := range records {
+		size += fi.Size()
+		if fi.ModTime().After(cutoff) && size <= maxSize {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, fi.Name())); err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Load reads a record file
+func Load(p string) (*Record, error) {
+	dt, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var r Record
+	if err := json.Unmarshal(dt, &r); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse solve record %s", p)
+	}
+	if r.Version != recordVersion {
+		return nil, errors.Errorf("unsupported solve record version %d", r.Version)
+	}
+	if r.Request == nil {
+		return nil, errors.Errorf("solve record %s has no request", p)
+	}
+	return &r, nil
+}
+
+func redactCacheEntries(entries []*controlapi.CacheOptionsEntry) []*controlapi.CacheOptionsEntry {
+	if entries == nil {
+		return nil
+	}
+	out := make([]*controlapi.CacheOptionsEntry, len(entries))
+	for i, e := range entries {
+		out[i] = &controlapi.CacheOptionsEntry{Type: e.Type, Attrs: redact.Map(e.Attrs)}
+	}
+	return out
+}
+
+func locals(def *pb.Definition) []string {
+	if def == nil {
+		return nil
+	}
+	m := map[string]struct{}{}
+	for _, dt := range def.Def {
+		var op pb.Op
+		if err := op.Unmarshal(dt); err != nil {
+			continue
+		}
+		if src := op.GetSource(); src != nil && strings.HasPrefix(src.Identifier, "local://") {
+			m[strings.TrimPrefix(src.Identifier, "local://")] = struct{}{}
+		}
+	}
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
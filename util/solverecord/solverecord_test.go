@@ -0,0 +1,87 @@
+package solverecord
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/util/redact"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteLoad(t *testing.T) {
+	st := llb.Image("alpine").Run(llb.Shlex("ls /src")).AddMount("/src", llb.Local("context"))
+	def, err := st.Marshal(context.TODO())
+	require.NoError(t, err)
+
+	req := &controlapi.SolveRequest{
+		Ref:           "ref1",
+		Definition:    def.ToPB(),
+		Session:       "session1",
+		Frontend:      "dockerfile.v0",
+		FrontendAttrs: map[string]string{"build-arg:foo": "bar", "build-arg:NPM_TOKEN": "npmtoken"},
+		Cache: controlapi.CacheOptions{
+			Imports: []*controlapi.CacheOptionsEntry{{Type: "registry", Attrs: map[string]string{"ref": "example.com/cache"}}},
+			Exports: []*controlapi.CacheOptionsEntry{
+				{Type: "gha", Attrs: map[string]string{"scope": "main", "token": "ghtoken"}},
+				{Type: "s3", Attrs: map[string]string{"bucket": "cache", "secret_access_key": "key", "session_token": "token"}},
+			},
+		},
+	}
+
+	p, err := Write(t.TempDir(), req)
+	require.NoError(t, err)
+
+	r, err := Load(p)
+	require.NoError(t, err)
+	require.Equal(t, digest.FromString("session1"), r.SessionIDHash)
+	require.Equal(t, "", r.Request.Session)
+	require.Equal(t, "session1", req.Session)
+	require.Equal(t, "ref1", r.Request.Ref)
+	require.Equal(t, req.Definition.Def, r.Request.Definition.Def)
+	require.Equal(t, req.Definition.Metadata, r.Request.Definition.Metadata)
+	require.Equal(t, "bar", r.Request.FrontendAttrs["build-arg:foo"])
+	require.Equal(t, "example.com/cache", r.Request.Cache.Imports[0].Attrs["ref"])
+	require.Equal(t, []string{"context"}, r.Locals)
+
+	// credentials aren't written to disk
+	require.Equal(t, redact.Mask, r.Request.FrontendAttrs["build-arg:NPM_TOKEN"])
+	require.Equal(t, map[string]string{"scope": "main", "token": redact.Mask}, r.Request.Cache.Exports[0].Attrs)
+	require.Equal(t, map[string]string{"bucket": "cache", "secret_access_key": redact.Mask, "session_token": redact.Mask}, r.Request.Cache.Exports[1].Attrs)
+	require.Equal(t, "ghtoken", req.Cache.Exports[0].Attrs["token"])
+	dt, err := ioutil.ReadFile(p)
+	require.NoError(t, err)
+	for _, secret := range []string{"npmtoken", "ghtoken", `"key"`} {
+		require.NotContains(t, string(dt), secret)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, age := range []time.Duration{0, time.Hour, 2 * time.Hour, 72 * time.Hour} {
+		p := filepath.Join(dir, fmt.Sprintf("record%d.json", i))
+		require.NoError(t, ioutil.WriteFile(p, make([]byte, 10), 0600))
+		require.NoError(t, os.Chtimes(p, now.Add(-age), now.Add(-age)))
+	}
+
+	// the record older than the keep duration and then the oldest ones
+	// above the size limit are removed
+	require.NoError(t, Prune(dir, 48*time.Hour, 25))
+	fis, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	require.Equal(t, []string{"record0.json", "record1.json"}, names)
+
+	require.NoError(t, Prune(filepath.Join(dir, "missing"), 0, 0))
+}
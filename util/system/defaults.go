@@ -0,0 +1,92 @@
+package system
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	// LabelDefaultPathPrefix is the prefix of worker labels that set the
+	// default PATH for an OS, e.g. "org.mobyproject.buildkit.worker.default-path.linux"
+	LabelDefaultPathPrefix = "org.mobyproject.buildkit.worker.default-path."
+	// LabelDefaultShellPrefix is the prefix of worker labels that set the
+	// default shell for an OS as a JSON array
+	LabelDefaultShellPrefix = "org.mobyproject.buildkit.worker.default-shell."
+)
+
+// Defaults overrides the PATH and shell used when the image config doesn't
+// set them. Maps are keyed by OS, e.g. "linux" or "windows".
+type Defaults struct {
+	PathEnv map[string]string
+	Shell   map[string][]string
+}
+
+// DefaultPathEnv returns the configured PATH for os, or the built-in default
+func (d Defaults) DefaultPathEnv(os string) string {
+	if v, ok := d.PathEnv[os]; ok && v != "" {
+		return v
+	}
+	return DefaultPathEnv(os)
+}
+
+// DefaultShell returns the configured shell for os, or the built-in default
+func (d Defaults) DefaultShell(os string) []string {
+	if v, ok := d.Shell[os]; ok && len(v) > 0 {
+		return append([]string{}, v...)
+	}
+	return DefaultShell(os)
+}
+
+// Merge returns d with the values of o taking precedence
+func (d Defaults) Merge(o Defaults) Defaults {
+	out := Defaults{
+		PathEnv: map[string]string{},
+		Shell:   map[string][]string{},
+	}
+	for _, m := range []Defaults{d, o} {
+		for k, v := range m.PathEnv {
+			out.PathEnv[k] = v
+		}
+		for k, v := range m.Shell {
+			out.Shell[k] = v
+		}
+	}
+	return out
+}
+
+// Labels returns the worker labels advertising the defaults
+func (d Defaults) Labels() map[string]string {
+	labels := map[string]string{}
+	for os, v := range d.PathEnv {
+		labels[LabelDefaultPathPrefix+os] = v
+	}
+	for os, v := range d.Shell {
+		dt, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		labels[LabelDefaultShellPrefix+os] = string(dt)
+	}
+	return labels
+}
+
+// DefaultsFromLabels parses the defaults advertised in worker labels.
+// Invalid shell values are ignored.
+func DefaultsFromLabels(labels map[string]string) Defaults {
+	d := Defaults{
+		PathEnv: map[string]string{},
+		Shell:   map[string][]string{},
+	}
+	for k, v := range labels {
+		switch {
+		case strings.HasPrefix(k, LabelDefaultPathPrefix):
+			d.PathEnv[strings.TrimPrefix(k, LabelDefaultPathPrefix)] = v
+		case strings.HasPrefix(k, LabelDefaultShellPrefix):
+			var shell []string
+			if err := json.Unmarshal([]byte(v), &shell); err == nil {
+				d.Shell[strings.TrimPrefix(k, LabelDefaultShellPrefix)] = shell
+			}
+		}
+	}
+	return d
+}
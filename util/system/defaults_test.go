@@ -0,0 +1,30 @@
+package system
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultsLabels(t *testing.T) {
+	d := Defaults{
+		PathEnv: map[string]string{"linux": "/busybox"},
+		Shell:   map[string][]string{"windows": {"powershell", "-Command"}},
+	}
+	labels := d.Labels()
+	require.Equal(t, "/busybox", labels[LabelDefaultPathPrefix+"linux"])
+	require.Equal(t, `["powershell","-Command"]`, labels[LabelDefaultShellPrefix+"windows"])
+
+	labels["org.mobyproject.buildkit.worker.executor"] = "oci"
+	labels[LabelDefaultShellPrefix+"freebsd"] = "/bin/sh -c"
+	d = DefaultsFromLabels(labels)
+	require.Equal(t, "/busybox", d.DefaultPathEnv("linux"))
+	require.Equal(t, DefaultPathEnvWindows, d.DefaultPathEnv("windows"))
+	require.Equal(t, []string{"powershell", "-Command"}, d.DefaultShell("windows"))
+	require.Equal(t, []string{"/bin/sh", "-c"}, d.DefaultShell("linux"))
+	require.Equal(t, []string{"/bin/sh", "-c"}, d.DefaultShell("freebsd"))
+
+	d = d.Merge(Defaults{PathEnv: map[string]string{"linux": "/bin"}})
+	require.Equal(t, "/bin", d.DefaultPathEnv("linux"))
+	require.Equal(t, []string{"powershell", "-Command"}, d.DefaultShell("windows"))
+}
@@ -16,3 +16,12 @@ func DefaultPathEnv(os string) string {
 	}
 	return DefaultPathEnvUnix
 }
+
+// DefaultShell returns the shell used for the shell form of commands when the
+// image config doesn't set one
+func DefaultShell(os string) []string {
+	if os == "windows" {
+		return []string{"cmd", "/S", "/C"}
+	}
+	return []string{"/bin/sh", "-c"}
+}
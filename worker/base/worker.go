@@ -6,9 +6,11 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/diff"
 	"github.com/containerd/containerd/gc"
@@ -23,6 +25,7 @@ import (
 	"github.com/moby/buildkit/client/llb"
 	"github.com/moby/buildkit/executor"
 	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/attestation"
 	imageexporter "github.com/moby/buildkit/exporter/containerimage"
 	localexporter "github.com/moby/buildkit/exporter/local"
 	ociexporter "github.com/moby/buildkit/exporter/oci"
@@ -33,18 +36,23 @@ import (
 	"github.com/moby/buildkit/snapshot"
 	"github.com/moby/buildkit/snapshot/imagerefchecker"
 	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/solver/llbsolver"
 	"github.com/moby/buildkit/solver/llbsolver/mounts"
 	"github.com/moby/buildkit/solver/llbsolver/ops"
 	"github.com/moby/buildkit/solver/pb"
 	"github.com/moby/buildkit/source"
 	"github.com/moby/buildkit/source/containerimage"
+	"github.com/moby/buildkit/source/downloadcache"
 	"github.com/moby/buildkit/source/git"
 	"github.com/moby/buildkit/source/http"
 	"github.com/moby/buildkit/source/local"
 	"github.com/moby/buildkit/util/archutil"
 	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/buildkit/util/compression"
 	"github.com/moby/buildkit/util/progress"
 	"github.com/moby/buildkit/util/progress/controller"
+	"github.com/moby/buildkit/util/push"
+	"github.com/moby/buildkit/util/tracing"
 	"github.com/moby/buildkit/worker"
 	digest "github.com/opencontainers/go-digest"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
@@ -76,6 +84,52 @@ type WorkerOpt struct {
 	LeaseManager    leases.Manager
 	GarbageCollect  func(context.Context) (gc.Stats, error)
 	ParallelismSem  *semaphore.Weighted
+	// MaxCacheRecords, MaxCacheRecordSize and MaxParallelConversions limit
+	// the cache, see cache.ManagerOpt
+	MaxCacheRecords        int
+	MaxCacheRecordSize     int64
+	MaxParallelConversions int
+	// CompressionLevels are the default compression levels of the layer
+	// blobs, see cache.ManagerOpt
+	CompressionLevels map[compression.Type]int
+	// VerifyBlobsInterval is the interval of verifying the blobs of the
+	// content store, see cache.ManagerOpt
+	VerifyBlobsInterval time.Duration
+	// FinalizePolicy controls when committed refs are finalized, see
+	// cache.ManagerOpt
+	FinalizePolicy cache.FinalizePolicy
+	// MinFreeSpace is the free space in bytes the filesystems of
+	// FreeSpacePaths need for build steps, see cache.ManagerOpt
+	MinFreeSpace   int64
+	FreeSpacePaths []string
+	// Root is the state directory of the worker, temporary files of the
+	// exporters are written under it
+	Root string
+	// SBOMScanner generates SBOMs for attestations, nil uses the default
+	SBOMScanner attestation.Scanner
+	// PushOpt are the defaults of the push attrs of the image exporter
+	PushOpt push.Opt
+	// ExportContainerdAddresses are the containerd instances the image
+	// exporter may export images to with containerd.address
+	ExportContainerdAddresses []string
+	// ExportContainerdNamespaces are the other namespaces of containerd the
+	// image exporter may create images in with namespaces
+	ExportContainerdNamespaces []string
+	// MountTemplates are mounted into the build steps that request them or
+	// into every build step if they are automatic
+	MountTemplates []executor.MountTemplate
+	// UnpackSnapshotter returns other snapshotters of the worker by name that
+	// the image exporter can unpack images into, optional
+	UnpackSnapshotter func(name string) (snapshot.Snapshotter, error)
+	// Containerd is the client of the containerd worker for exporting images
+	// to other namespaces than the one in the labels, optional
+	Containerd *containerd.Client
+	// Exporters are additional exporters by name provided by a daemon that
+	// embeds buildkit, e.g. the moby exporter, optional
+	Exporters map[string]func(sm *session.Manager) (exporter.Exporter, error)
+	// DownloadCache is shared by the http and git sources of the workers of
+	// the daemon, optional
+	DownloadCache *downloadcache.Cache
 }
 
 // Worker is a local worker instance with dedicated snapshotter, cache, and so on.
@@ -96,14 +150,23 @@ func NewWorker(ctx context.Context, opt WorkerOpt) (*Worker, error) {
 	})
 
 	cm, err := cache.NewManager(cache.ManagerOpt{
-		Snapshotter:     opt.Snapshotter,
-		MetadataStore:   opt.MetadataStore,
-		PruneRefChecker: imageRefChecker,
-		Applier:         opt.Applier,
-		GarbageCollect:  opt.GarbageCollect,
-		LeaseManager:    opt.LeaseManager,
-		ContentStore:    opt.ContentStore,
-		Differ:          opt.Differ,
+		Snapshotter:            opt.Snapshotter,
+		MetadataStore:          opt.MetadataStore,
+		PruneRefChecker:        imageRefChecker,
+		Applier:                opt.Applier,
+		GarbageCollect:         opt.GarbageCollect,
+		LeaseManager:           opt.LeaseManager,
+		ContentStore:           opt.ContentStore,
+		Differ:                 opt.Differ,
+		MaxRecords:             opt.MaxCacheRecords,
+		MaxRecordSize:          opt.MaxCacheRecordSize,
+		MaxParallelConversions: opt.MaxParallelConversions,
+		CompressionLevels:      opt.CompressionLevels,
+		VerifyInterval:         opt.VerifyBlobsInterval,
+		FinalizePolicy:         opt.FinalizePolicy,
+		MinFreeSpace:           opt.MinFreeSpace,
+		FreeSpacePaths:         opt.FreeSpacePaths,
+		GCPolicy:               opt.GCPolicy,
 	})
 	if err != nil {
 		return nil, err
@@ -133,6 +196,7 @@ func NewWorker(ctx context.Context, opt WorkerOpt) (*Worker, error) {
 		gs, err := git.NewSource(git.Opt{
 			CacheAccessor: cm,
 			MetadataStore: opt.MetadataStore,
+			DownloadCache: opt.DownloadCache,
 		})
 		if err != nil {
 			return nil, err
@@ -142,10 +206,14 @@ func NewWorker(ctx context.Context, opt WorkerOpt) (*Worker, error) {
 		bklog.G(ctx).Warnf("git source cannot be enabled: %v", err)
 	}
 
-	hs, err := http.NewSource(http.Opt{
+	httpOpt := http.Opt{
 		CacheAccessor: cm,
 		MetadataStore: opt.MetadataStore,
-	})
+	}
+	if opt.DownloadCache != nil {
+		httpOpt.Transport = opt.DownloadCache.Transport(tracing.DefaultTransport)
+	}
+	hs, err := http.NewSource(httpOpt)
 	if err != nil {
 		return nil, err
 	}
@@ -166,6 +234,8 @@ func NewWorker(ctx context.Context, opt WorkerOpt) (*Worker, error) {
 		ContentStore: opt.ContentStore,
 		Applier:      opt.Applier,
 		Differ:       opt.Differ,
+		SBOMScanner:  opt.SBOMScanner,
+		TempDir:      opt.Root,
 	})
 	if err != nil {
 		return nil, err
@@ -265,7 +335,11 @@ func (w *Worker) ResolveOp(v solver.Vertex, s frontend.FrontendLLBBridge, sm *se
 		case *pb.Op_Source:
 			return ops.NewSourceOp(v, op, baseOp.Platform, w.SourceManager, w.ParallelismSem, sm, w)
 		case *pb.Op_Exec:
-			return ops.NewExecOp(v, op, baseOp.Platform, w.CacheMgr, w.ParallelismSem, sm, w.WorkerOpt.MetadataStore, w.WorkerOpt.Executor, w)
+			templates, err := w.mountTemplates(s)
+			if err != nil {
+				return nil, err
+			}
+			return ops.NewExecOp(v, op, baseOp.Platform, w.CacheMgr, w.ParallelismSem, sm, w.WorkerOpt.MetadataStore, w.WorkerOpt.Executor, templates, w)
 		case *pb.Op_File:
 			return ops.NewFileOp(v, op, w.CacheMgr, w.ParallelismSem, w.WorkerOpt.MetadataStore, w)
 		case *pb.Op_Build:
@@ -277,6 +351,32 @@ func (w *Worker) ResolveOp(v solver.Vertex, s frontend.FrontendLLBBridge, sm *se
 	return nil, errors.Errorf("could not resolve %v", v)
 }
 
+// mountTemplates returns the automatic mount templates and the ones requested
+// by the solves of s
+func (w *Worker) mountTemplates(s frontend.FrontendLLBBridge) ([]executor.MountTemplate, error) {
+	names, err := llbsolver.MountTemplates(s)
+	if err != nil {
+		return nil, err
+	}
+	requested := map[string]struct{}{}
+	for _, name := range names {
+		requested[name] = struct{}{}
+	}
+	var templates []executor.MountTemplate
+	for _, t := range w.WorkerOpt.MountTemplates {
+		if _, ok := requested[t.Name]; ok || t.Auto {
+			templates = append(templates, t)
+		}
+		delete(requested, t.Name)
+	}
+	for _, name := range names {
+		if _, ok := requested[name]; ok {
+			return nil, errors.Errorf("mount template %q is not defined on worker %s", name, w.ID())
+		}
+	}
+	return templates, nil
+}
+
 func (w *Worker) PruneCacheMounts(ctx context.Context, ids []string) error {
 	mu := mounts.CacheMountsLocker()
 	mu.Lock()
@@ -339,11 +439,17 @@ func (w *Worker) Exporter(name string, sm *session.Manager) (exporter.Exporter,
 	switch name {
 	case client.ExporterImage:
 		return imageexporter.New(imageexporter.Opt{
-			Images:         w.ImageStore,
-			SessionManager: sm,
-			ImageWriter:    w.imageWriter,
-			RegistryHosts:  w.RegistryHosts,
-			LeaseManager:   w.LeaseManager,
+			Images:               w.ImageStore,
+			SessionManager:       sm,
+			ImageWriter:          w.imageWriter,
+			RegistryHosts:        w.RegistryHosts,
+			LeaseManager:         w.LeaseManager,
+			Push:                 w.PushOpt,
+			UnpackSnapshotter:    w.UnpackSnapshotter,
+			Containerd:           w.Containerd,
+			Namespace:            w.Labels()[worker.LabelContainerdNamespace],
+			ContainerdAddresses:  w.ExportContainerdAddresses,
+			ContainerdNamespaces: w.ExportContainerdNamespaces,
 		})
 	case client.ExporterLocal:
 		return localexporter.New(localexporter.Opt{
@@ -368,10 +474,23 @@ func (w *Worker) Exporter(name string, sm *session.Manager) (exporter.Exporter,
 			LeaseManager:   w.LeaseManager,
 		})
 	default:
+		if f, ok := w.Exporters[name]; ok {
+			return f(sm)
+		}
 		return nil, errors.Errorf("exporter %q could not be found", name)
 	}
 }
 
+func (w *Worker) ExporterTypes() []string {
+	types := []string{client.ExporterImage, client.ExporterLocal, client.ExporterTar, client.ExporterOCI, client.ExporterDocker}
+	extra := make([]string, 0, len(w.Exporters))
+	for name := range w.Exporters {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	return append(types, extra...)
+}
+
 func (w *Worker) FromRemote(ctx context.Context, remote *solver.Remote) (ref cache.ImmutableRef, err error) {
 	descHandler := &cache.DescHandler{
 		Provider: func(session.Group) content.Provider { return remote.Provider },
@@ -5,6 +5,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/moby/buildkit/executor"
 	"github.com/stretchr/testify/require"
 )
 
@@ -32,3 +33,14 @@ func TestID(t *testing.T) {
 
 	require.NoError(t, os.RemoveAll(tmpdir))
 }
+
+func TestMountTemplates(t *testing.T) {
+	t.Parallel()
+	w := &Worker{WorkerOpt: WorkerOpt{MountTemplates: []executor.MountTemplate{
+		{Name: "ca", Source: "/etc/ssl/certs/ca.pem", Dest: "/etc/ssl/certs/ca.pem", Auto: true},
+		{Name: "pip", Source: "/etc/buildkit/pip.conf", Dest: "/etc/pip.conf"},
+	}}}
+	templates, err := w.mountTemplates(nil)
+	require.NoError(t, err)
+	require.Equal(t, w.WorkerOpt.MountTemplates[:1], templates)
+}
@@ -14,9 +14,12 @@ import (
 	"github.com/moby/buildkit/cache/metadata"
 	"github.com/moby/buildkit/executor/containerdexecutor"
 	"github.com/moby/buildkit/executor/oci"
+	"github.com/moby/buildkit/snapshot"
 	containerdsnapshot "github.com/moby/buildkit/snapshot/containerd"
+	"github.com/moby/buildkit/util/bklog"
 	"github.com/moby/buildkit/util/leaseutil"
 	"github.com/moby/buildkit/util/network/netproviders"
+	"github.com/moby/buildkit/util/overlay"
 	"github.com/moby/buildkit/util/winlayers"
 	"github.com/moby/buildkit/worker"
 	"github.com/moby/buildkit/worker/base"
@@ -26,16 +29,16 @@ import (
 )
 
 // NewWorkerOpt creates a WorkerOpt.
-func NewWorkerOpt(root string, address, snapshotterName, ns string, labels map[string]string, dns *oci.DNSConfig, nopt netproviders.Opt, apparmorProfile string, parallelismSem *semaphore.Weighted, traceSocket string, opts ...containerd.ClientOpt) (base.WorkerOpt, error) {
+func NewWorkerOpt(root string, address, snapshotterName, ns string, labels map[string]string, dns *oci.DNSConfig, nopt netproviders.Opt, apparmorProfile string, parallelismSem *semaphore.Weighted, traceSocket, differ string, opts ...containerd.ClientOpt) (base.WorkerOpt, error) {
 	opts = append(opts, containerd.WithDefaultNamespace(ns))
 	client, err := containerd.New(address, opts...)
 	if err != nil {
 		return base.WorkerOpt{}, errors.Wrapf(err, "failed to connect client to %q . make sure containerd is running", address)
 	}
-	return newContainerd(root, client, snapshotterName, ns, labels, dns, nopt, apparmorProfile, parallelismSem, traceSocket)
+	return newContainerd(root, client, snapshotterName, ns, labels, dns, nopt, apparmorProfile, parallelismSem, traceSocket, differ)
 }
 
-func newContainerd(root string, client *containerd.Client, snapshotterName, ns string, labels map[string]string, dns *oci.DNSConfig, nopt netproviders.Opt, apparmorProfile string, parallelismSem *semaphore.Weighted, traceSocket string) (base.WorkerOpt, error) {
+func newContainerd(root string, client *containerd.Client, snapshotterName, ns string, labels map[string]string, dns *oci.DNSConfig, nopt netproviders.Opt, apparmorProfile string, parallelismSem *semaphore.Weighted, traceSocket, differ string) (base.WorkerOpt, error) {
 	if strings.Contains(snapshotterName, "/") {
 		return base.WorkerOpt{}, errors.Errorf("bad snapshotter name: %q", snapshotterName)
 	}
@@ -75,6 +78,10 @@ func newContainerd(root string, client *containerd.Client, snapshotterName, ns s
 	}
 
 	cs := containerdsnapshot.NewContentStore(client.ContentStore(), ns)
+	dc, err := overlay.NewDiffer(differ, cs, df)
+	if err != nil {
+		return base.WorkerOpt{}, err
+	}
 
 	resp, err := client.IntrospectionService().Plugins(context.TODO(), []string{"type==io.containerd.runtime.v1", "type==io.containerd.runtime.v2"})
 	if err != nil {
@@ -113,18 +120,61 @@ func newContainerd(root string, client *containerd.Client, snapshotterName, ns s
 
 	opt := base.WorkerOpt{
 		ID:             id,
+		Root:           root,
 		Labels:         xlabels,
 		MetadataStore:  md,
 		Executor:       containerdexecutor.New(client, root, "", np, dns, apparmorProfile, traceSocket),
 		Snapshotter:    snap,
 		ContentStore:   cs,
 		Applier:        winlayers.NewFileSystemApplierWithWindows(cs, df),
-		Differ:         winlayers.NewWalkingDiffWithWindows(cs, df),
+		Differ:         winlayers.NewWalkingDiffWithWindows(cs, dc),
 		ImageStore:     client.ImageService(),
 		Platforms:      platforms,
 		LeaseManager:   lm,
 		GarbageCollect: gc,
 		ParallelismSem: parallelismSem,
+		Containerd:     client,
+	}
+	opt.UnpackSnapshotter = func(name string) (snapshot.Snapshotter, error) {
+		if strings.Contains(name, "/") {
+			return nil, errors.Errorf("bad snapshotter name: %q", name)
+		}
+		resp, err := client.IntrospectionService().Plugins(context.TODO(), []string{"type==io.containerd.snapshotter.v1,id==" + name})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Plugins) == 0 {
+			return nil, errors.Errorf("snapshotter %s is not available in containerd", name)
+		}
+		if initErr := resp.Plugins[0].InitErr; initErr != nil {
+			return nil, errors.Errorf("snapshotter %s failed to load in containerd: %s", name, initErr.Message)
+		}
+		return containerdsnapshot.NewSnapshotter(name, client.SnapshotService(name), ns, nil), nil
 	}
+	opt.FreeSpacePaths = storagePaths(context.TODO(), client, snapshotterName)
 	return opt, nil
 }
+
+// storagePaths returns the directories of the snapshotter and of the content
+// store of containerd, as exported by its plugins. Directories that aren't
+// accessible by buildkitd, e.g. of a remote containerd, are skipped.
+func storagePaths(ctx context.Context, client *containerd.Client, snapshotterName string) []string {
+	resp, err := client.IntrospectionService().Plugins(ctx, []string{"type==io.containerd.snapshotter.v1,id==" + snapshotterName, "type==io.containerd.content.v1"})
+	if err != nil {
+		bklog.G(ctx).Warnf("failed to list storage plugins of containerd: %v", err)
+		return nil
+	}
+	var paths []string
+	for _, p := range resp.Plugins {
+		root, ok := p.Exports["root"]
+		if !ok {
+			continue
+		}
+		if _, err := os.Stat(root); err != nil {
+			bklog.G(ctx).Debugf("skipping free space check of %s: %v", root, err)
+			continue
+		}
+		paths = append(paths, root)
+	}
+	return paths
+}
@@ -0,0 +1,268 @@
+package runc
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/containerd/archive"
+	"github.com/containerd/containerd/mount"
+	ctdsnapshot "github.com/containerd/containerd/snapshots"
+	"github.com/containerd/continuity/fs"
+	"github.com/moby/buildkit/identity"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// MigrateSnapshotter moves the cache state of the worker using the snapshotter
+// from to a worker using the snapshotter to. Snapshot contents are copied as
+// diffs so the two snapshotters may use different storage formats, but both
+// need to be usable on the host. The state of the source worker is left in
+// place and can be removed manually once the new worker has been verified.
+// Migration is skipped if the destination state already exists.
+func MigrateSnapshotter(ctx context.Context, root string, from, to SnapshotterFactory) error {
+	srcRoot := filepath.Join(root, "runc-"+from.Name)
+	dstRoot := filepath.Join(root, "runc-"+to.Name)
+	if from.Name == to.Name {
+		return errors.Errorf("cannot migrate snapshotter %s to itself", from.Name)
+	}
+	if _, err := os.Stat(dstRoot); err == nil {
+		logrus.Debugf("skipping migration from %s, state for %s already exists", from.Name, to.Name)
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(srcRoot, "containerdmeta.db")); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	tmpRoot := dstRoot + ".migrating"
+	if err := os.RemoveAll(tmpRoot); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmpRoot, 0700); err != nil {
+		return err
+	}
+	if err := migrateState(ctx, srcRoot, tmpRoot, from, to); err != nil {
+		os.RemoveAll(tmpRoot)
+		return errors.Wrapf(err, "failed to migrate snapshots from %s to %s", from.Name, to.Name)
+	}
+	if err := os.Rename(tmpRoot, dstRoot); err != nil {
+		return err
+	}
+	logrus.Infof("migrated cache from snapshotter %s to %s", from.Name, to.Name)
+	return nil
+}
+
+func migrateState(ctx context.Context, srcRoot, dstRoot string, from, to SnapshotterFactory) error {
+	if err := fs.CopyDir(filepath.Join(dstRoot, "content"), filepath.Join(srcRoot, "content")); err != nil {
+		return errors.Wrap(err, "failed to copy content store")
+	}
+	for _, f := range []string{"metadata_v2.db", "containerdmeta.db"} {
+		if err := fs.CopyFile(filepath.Join(dstRoot, f), filepath.Join(srcRoot, f)); err != nil {
+			return errors.Wrapf(err, "failed to copy %s", f)
+		}
+	}
+	if err := renameSnapshotter(filepath.Join(dstRoot, "containerdmeta.db"), from.Name, to.Name); err != nil {
+		return err
+	}
+
+	src, err := from.New(filepath.Join(srcRoot, "snapshots"))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := to.New(filepath.Join(dstRoot, "snapshots"))
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	return copySnapshots(ctx, src, dst)
+}
+
+// renameSnapshotter moves the snapshot references and lease resources that
+// the containerd metadata store keeps per snapshotter name
+func renameSnapshotter(dbPath, from, to string) error {
+	db, err := bolt.Open(dbPath, 0644, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		vbkt := tx.Bucket([]byte("v1"))
+		if vbkt == nil {
+			return nil
+		}
+		return vbkt.ForEach(func(ns, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			nsbkt := vbkt.Bucket(ns)
+			if err := moveBucket(nsbkt.Bucket([]byte("snapshots")), from, to); err != nil {
+				return err
+			}
+			lbkt := nsbkt.Bucket([]byte("leases"))
+			if lbkt == nil {
+				return nil
+			}
+			return lbkt.ForEach(func(id, v []byte) error {
+				if v != nil {
+					return nil
+				}
+				return moveBucket(lbkt.Bucket(id).Bucket([]byte("snapshots")), from, to)
+			})
+		})
+	})
+}
+
+func moveBucket(parent *bolt.Bucket, from, to string) error {
+	if parent == nil {
+		return nil
+	}
+	src := parent.Bucket([]byte(from))
+	if src == nil {
+		return nil
+	}
+	dst, err := parent.CreateBucket([]byte(to))
+	if err != nil {
+		return err
+	}
+	if err := copyBucket(dst, src); err != nil {
+		return err
+	}
+	return parent.DeleteBucket([]byte(from))
+}
+
+func copyBucket(dst, src *bolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		child, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(child, src.Bucket(k))
+	})
+}
+
+func copySnapshots(ctx context.Context, src, dst ctdsnapshot.Snapshotter) error {
+	infos := map[string]ctdsnapshot.Info{}
+	if err := src.Walk(ctx, func(ctx context.Context, info ctdsnapshot.Info) error {
+		infos[info.Name] = info
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	done := map[string]struct{}{}
+	var migrate func(name string) error
+	migrate = func(name string) error {
+		if _, ok := done[name]; ok {
+			return nil
+		}
+		info, ok := infos[name]
+		if !ok {
+			return errors.Errorf("parent snapshot %s does not exist", name)
+		}
+		if info.Parent != "" {
+			if err := migrate(info.Parent); err != nil {
+				return err
+			}
+		}
+		if err := copySnapshot(ctx, src, dst, info); err != nil {
+			return errors.Wrapf(err, "failed to migrate snapshot %s", name)
+		}
+		done[name] = struct{}{}
+		return nil
+	}
+	for name := range infos {
+		if err := migrate(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copySnapshot(ctx context.Context, src, dst ctdsnapshot.Snapshotter, info ctdsnapshot.Info) error {
+	opt := ctdsnapshot.WithLabels(info.Labels)
+
+	switch info.Kind {
+	case ctdsnapshot.KindView:
+		_, err := dst.View(ctx, info.Name, info.Parent, opt)
+		return err
+	case ctdsnapshot.KindActive:
+		mounts, err := dst.Prepare(ctx, info.Name, info.Parent, opt)
+		if err != nil {
+			return err
+		}
+		upper, err := src.Mounts(ctx, info.Name)
+		if err != nil {
+			return err
+		}
+		return applyDiff(ctx, src, info.Parent, upper, mounts)
+	case ctdsnapshot.KindCommitted:
+		key := identity.NewID()
+		mounts, err := dst.Prepare(ctx, key, info.Parent)
+		if err != nil {
+			return err
+		}
+		viewKey := identity.NewID()
+		upper, err := src.View(ctx, viewKey, info.Name)
+		if err != nil {
+			dst.Remove(ctx, key)
+			return err
+		}
+		err = applyDiff(ctx, src, info.Parent, upper, mounts)
+		src.Remove(ctx, viewKey)
+		if err != nil {
+			dst.Remove(ctx, key)
+			return err
+		}
+		return dst.Commit(ctx, info.Name, key, opt)
+	default:
+		return errors.Errorf("unknown snapshot kind %v", info.Kind)
+	}
+}
+
+// applyDiff writes the changes between parent and upper in the src
+// snapshotter to the dst mounts
+func applyDiff(ctx context.Context, src ctdsnapshot.Snapshotter, parent string, upper, dst []mount.Mount) error {
+	withLower := func(f func(string) error) error {
+		if parent == "" {
+			dir, err := ioutil.TempDir("", "buildkit-migrate")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(dir)
+			return f(dir)
+		}
+		key := identity.NewID()
+		lower, err := src.View(ctx, key, parent)
+		if err != nil {
+			return err
+		}
+		defer src.Remove(ctx, key)
+		return mount.WithTempMount(ctx, lower, f)
+	}
+
+	return withLower(func(lowerDir string) error {
+		return mount.WithTempMount(ctx, upper, func(upperDir string) error {
+			return mount.WithTempMount(ctx, dst, func(dstDir string) error {
+				pr, pw := io.Pipe()
+				go func() {
+					pw.CloseWithError(archive.WriteDiff(ctx, pw, lowerDir, upperDir))
+				}()
+				_, err := archive.Apply(ctx, dstDir, pr)
+				pr.CloseWithError(err)
+				return err
+			})
+		})
+	})
+}
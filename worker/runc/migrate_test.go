@@ -0,0 +1,117 @@
+// +build linux
+
+package runc
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/metadata"
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/namespaces"
+	ctdsnapshot "github.com/containerd/containerd/snapshots"
+	"github.com/containerd/containerd/snapshots/native"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func openMetadata(t *testing.T, root string, name string, sn ctdsnapshot.Snapshotter) (ctdsnapshot.Snapshotter, func()) {
+	c, err := local.NewStore(filepath.Join(root, "content"))
+	require.NoError(t, err)
+	db, err := bolt.Open(filepath.Join(root, "containerdmeta.db"), 0644, nil)
+	require.NoError(t, err)
+	mdb := metadata.NewDB(db, c, map[string]ctdsnapshot.Snapshotter{name: sn})
+	require.NoError(t, mdb.Init(context.TODO()))
+	return mdb.Snapshotter(name), func() { db.Close() }
+}
+
+func TestMigrateSnapshotter(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+	ctx := namespaces.WithNamespace(context.TODO(), "buildkit")
+
+	tmpdir, err := ioutil.TempDir("", "migratetest")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	from := SnapshotterFactory{Name: "native", New: native.NewSnapshotter}
+	to := SnapshotterFactory{Name: "native-copy", New: native.NewSnapshotter}
+
+	srcRoot := filepath.Join(tmpdir, "runc-native")
+	require.NoError(t, os.MkdirAll(srcRoot, 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(srcRoot, "metadata_v2.db"), nil, 0600))
+
+	backend, err := from.New(filepath.Join(srcRoot, "snapshots"))
+	require.NoError(t, err)
+	sn, closeDB := openMetadata(t, srcRoot, from.Name, backend)
+
+	write := func(key, parent string, files map[string]string) {
+		mounts, err := sn.Prepare(ctx, key, parent)
+		require.NoError(t, err)
+		err = mount.WithTempMount(ctx, mounts, func(root string) error {
+			for p, data := range files {
+				if data == "" {
+					if err := os.Remove(filepath.Join(root, p)); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := ioutil.WriteFile(filepath.Join(root, p), []byte(data), 0644); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	}
+	write("base-active", "", map[string]string{"foo": "foo0", "bar": "bar0"})
+	require.NoError(t, sn.Commit(ctx, "base", "base-active", ctdsnapshot.WithLabels(map[string]string{"l": "v"})))
+	write("child-active", "base", map[string]string{"foo": "foo1", "bar": ""})
+	require.NoError(t, sn.Commit(ctx, "child", "child-active"))
+	write("mutable", "child", map[string]string{"baz": "baz0"})
+	closeDB()
+	backend.Close()
+
+	require.NoError(t, MigrateSnapshotter(ctx, tmpdir, from, to))
+
+	dstRoot := filepath.Join(tmpdir, "runc-native-copy")
+	_, err = os.Stat(dstRoot + ".migrating")
+	require.True(t, os.IsNotExist(err))
+
+	backend, err = to.New(filepath.Join(dstRoot, "snapshots"))
+	require.NoError(t, err)
+	defer backend.Close()
+	sn, closeDB = openMetadata(t, dstRoot, to.Name, backend)
+	defer closeDB()
+
+	info, err := sn.Stat(ctx, "base")
+	require.NoError(t, err)
+	require.Equal(t, "v", info.Labels["l"])
+
+	info, err = sn.Stat(ctx, "mutable")
+	require.NoError(t, err)
+	require.Equal(t, ctdsnapshot.KindActive, info.Kind)
+
+	mounts, err := sn.Mounts(ctx, "mutable")
+	require.NoError(t, err)
+	err = mount.WithTempMount(ctx, mounts, func(root string) error {
+		dt, err := ioutil.ReadFile(filepath.Join(root, "foo"))
+		require.NoError(t, err)
+		require.Equal(t, "foo1", string(dt))
+		dt, err = ioutil.ReadFile(filepath.Join(root, "baz"))
+		require.NoError(t, err)
+		require.Equal(t, "baz0", string(dt))
+		_, err = os.Stat(filepath.Join(root, "bar"))
+		require.True(t, os.IsNotExist(err))
+		return nil
+	})
+	require.NoError(t, err)
+
+	// existing state is never overwritten
+	require.NoError(t, MigrateSnapshotter(ctx, tmpdir, from, to))
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/content/local"
 	"github.com/containerd/containerd/diff/apply"
 	"github.com/containerd/containerd/diff/walking"
@@ -17,8 +19,10 @@ import (
 	"github.com/moby/buildkit/executor/oci"
 	"github.com/moby/buildkit/executor/runcexecutor"
 	containerdsnapshot "github.com/moby/buildkit/snapshot/containerd"
+	"github.com/moby/buildkit/util/contentutil/cdc"
 	"github.com/moby/buildkit/util/leaseutil"
 	"github.com/moby/buildkit/util/network/netproviders"
+	"github.com/moby/buildkit/util/overlay"
 	"github.com/moby/buildkit/util/winlayers"
 	"github.com/moby/buildkit/worker/base"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
@@ -33,7 +37,7 @@ type SnapshotterFactory struct {
 }
 
 // NewWorkerOpt creates a WorkerOpt.
-func NewWorkerOpt(root string, snFactory SnapshotterFactory, rootless bool, processMode oci.ProcessMode, labels map[string]string, idmap *idtools.IdentityMapping, nopt netproviders.Opt, dns *oci.DNSConfig, binary, apparmorProfile string, parallelismSem *semaphore.Weighted, traceSocket string) (base.WorkerOpt, error) {
+func NewWorkerOpt(root string, snFactory SnapshotterFactory, rootless bool, processMode oci.ProcessMode, labels map[string]string, idmap *idtools.IdentityMapping, nopt netproviders.Opt, dns *oci.DNSConfig, binary, apparmorProfile string, parallelismSem *semaphore.Weighted, traceSocket string, checkpointInterval time.Duration, contentDedup bool, differ string) (base.WorkerOpt, error) {
 	var opt base.WorkerOpt
 	name := "runc-" + snFactory.Name
 	root = filepath.Join(root, name)
@@ -65,6 +69,8 @@ func NewWorkerOpt(root string, snFactory SnapshotterFactory, rootless bool, proc
 		DNS:             dns,
 		ApparmorProfile: apparmorProfile,
 		TracingSocket:   traceSocket,
+		// experimental checkpointing of long running processes
+		CheckpointInterval: checkpointInterval,
 	}, np)
 	if err != nil {
 		return opt, err
@@ -74,7 +80,12 @@ func NewWorkerOpt(root string, snFactory SnapshotterFactory, rootless bool, proc
 		return opt, err
 	}
 
-	c, err := local.NewStore(filepath.Join(root, "content"))
+	var c content.Store
+	if contentDedup {
+		c, err = cdc.NewStore(filepath.Join(root, "content"))
+	} else {
+		c, err = local.NewStore(filepath.Join(root, "content"))
+	}
 	if err != nil {
 		return opt, err
 	}
@@ -92,6 +103,10 @@ func NewWorkerOpt(root string, snFactory SnapshotterFactory, rootless bool, proc
 	}
 
 	c = containerdsnapshot.NewContentStore(mdb.ContentStore(), "buildkit")
+	df, err := overlay.NewDiffer(differ, c, walking.NewWalkingDiff(c))
+	if err != nil {
+		return opt, err
+	}
 
 	id, err := base.ID(root)
 	if err != nil {
@@ -114,13 +129,14 @@ func NewWorkerOpt(root string, snFactory SnapshotterFactory, rootless bool, proc
 
 	opt = base.WorkerOpt{
 		ID:              id,
+		Root:            root,
 		Labels:          xlabels,
 		MetadataStore:   md,
 		Executor:        exe,
 		Snapshotter:     snap,
 		ContentStore:    c,
 		Applier:         winlayers.NewFileSystemApplierWithWindows(c, apply.NewFileSystemApplier(c)),
-		Differ:          winlayers.NewWalkingDiffWithWindows(c, walking.NewWalkingDiff(c)),
+		Differ:          winlayers.NewWalkingDiffWithWindows(c, df),
 		ImageStore:      nil, // explicitly
 		Platforms:       []ocispecs.Platform{platforms.Normalize(platforms.DefaultSpec())},
 		IdentityMapping: idmap,